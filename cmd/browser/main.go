@@ -2,11 +2,16 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
+	neturl "net/url"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"fyne.io/fyne/v2"
+	"github.com/vyquocvu/goosie/internal/adblock"
 	"github.com/vyquocvu/goosie/internal/dom"
 	"github.com/vyquocvu/goosie/internal/js"
 	"github.com/vyquocvu/goosie/internal/net"
@@ -15,11 +20,82 @@ import (
 	"golang.org/x/net/html"
 )
 
+// Size limits of the HTTP cache in memory and on disk
+const (
+	httpCacheMemory = 50 << 20
+	httpCacheDisk   = 250 << 20
+)
+
 func main() {
+	recordHAR := flag.String("record-har", "", "record the session's requests into a HAR file, written on exit")
+	replayHAR := flag.String("replay-har", "", "serve requests from a HAR file instead of the network")
+	var filterLists []string
+	flag.Func("filter-list", "block ads and trackers with an Adblock Plus or uBlock Origin filter list file; may be repeated", func(path string) error {
+		filterLists = append(filterLists, path)
+		return nil
+	})
+	flag.Parse()
+
+	// Replayed sessions are answered by the archive alone, so they skip the
+	// disk cache and saved cookies below
+	if *replayHAR != "" {
+		archive, err := net.LoadHAR(*replayHAR)
+		if err != nil {
+			log.Fatalf("Failed to load the HAR archive: %v", err)
+		}
+		net.DefaultTransport = archive
+		log.Printf("Replaying requests from %s", *replayHAR)
+	}
+	if *recordHAR != "" {
+		net.DefaultRecorder = net.NewHARRecorder()
+	}
+
+	// Keep the HTTP cache in the user cache directory across sessions
+	if dir, err := os.UserCacheDir(); err == nil && *replayHAR == "" {
+		cache, err := net.NewDiskCache(filepath.Join(dir, "goosie", "http"), httpCacheMemory, httpCacheDisk)
+		if err != nil {
+			log.Printf("Using a memory-only HTTP cache: %v", err)
+		} else {
+			net.DefaultCache = cache
+		}
+	}
+
+	// Keep persistent cookies in the profile directory
+	if dir, err := os.UserConfigDir(); err == nil && *replayHAR == "" {
+		jar, err := net.NewPersistentCookieJar(filepath.Join(dir, "goosie", "cookies.json"))
+		if err != nil {
+			log.Printf("Using a session-only cookie jar: %v", err)
+		} else {
+			net.DefaultCookieJar = jar
+		}
+	}
+
 	// Initialize components
 	fetcher := net.NewFetcher()
 	parser := dom.NewParser()
 	browser := ui.NewBrowser()
+	browser.SetCookieJar(net.DefaultCookieJar)
+	fetcher.HandleAbout("history", browser.HistoryPage)
+	fetcher.HandleAbout("bookmarks", browser.BookmarksPage)
+	fetcher.HandleAbout("settings", browser.SettingsPage)
+
+	// Block the requests and hide the elements of the filter lists
+	if len(filterLists) > 0 {
+		blocker := adblock.NewEngine()
+		for _, path := range filterLists {
+			stats, err := blocker.LoadFile(path)
+			if err != nil {
+				log.Printf("Skipping filter list: %v", err)
+				continue
+			}
+			log.Printf("Loaded %d network and %d element hiding filters from %s (%d unsupported)", stats.Network, stats.Cosmetic, path, stats.Unsupported)
+		}
+		browser.SetContentBlocker(blocker)
+	}
+
+	// Page loads, images and fonts share one queue and its connection limits
+	scheduler := net.NewScheduler(fetcher)
+	net.DefaultScheduler = scheduler
 	browser.RendererFactory = func() ui.HTMLRenderer {
 		return renderer.NewRenderer(1000, 700)
 	}
@@ -28,8 +104,8 @@ func main() {
 	var currentLoadCtx context.Context
 	var currentLoadCancel context.CancelFunc
 
-	// Set up navigation callback
-	browser.SetNavigationCallback(func(url string) {
+	// Set up navigation callbacks
+	navigate := func(url string, navigationType ui.NavigationType) {
 		// Cancel any ongoing page load
 		if currentLoadCancel != nil {
 			currentLoadCancel()
@@ -38,12 +114,37 @@ func main() {
 		// Create new context for this load
 		currentLoadCtx, currentLoadCancel = context.WithCancel(context.Background())
 
+		// Back and forward show stored pages even when stale; reloads revalidate them
+		switch navigationType {
+		case ui.NavigationBackForward:
+			currentLoadCtx = net.WithCacheMode(currentLoadCtx, net.CacheHistory)
+		case ui.NavigationReload:
+			currentLoadCtx = net.WithCacheMode(currentLoadCtx, net.CacheRevalidate)
+		}
+
+		// Requests of the page go through the interceptors of its tab
+		if tab := browser.ActiveTab(); tab != nil {
+			currentLoadCtx = net.WithNetworkContext(currentLoadCtx, tab.Network())
+		}
+
 		// Load page asynchronously
-		loadPageAsync(browser, fetcher, parser, url, currentLoadCtx)
+		loadPageAsync(browser, scheduler, parser, url, currentLoadCtx)
+	}
+	browser.SetNavigationCallback(func(url string) {
+		navigate(url, ui.NavigationNormal)
 	})
+	browser.SetTypedNavigationCallback(navigate)
 
 	// Show browser window
 	browser.Show()
+
+	if net.DefaultRecorder != nil {
+		if err := net.DefaultRecorder.Save(*recordHAR); err != nil {
+			log.Printf("Failed to save the HAR file: %v", err)
+		} else {
+			log.Printf("Recorded the session into %s", *recordHAR)
+		}
+	}
 }
 
 // pageLoadResult represents the result of an async page load
@@ -53,7 +154,7 @@ type pageLoadResult struct {
 }
 
 // loadPageAsync fetches and displays a web page asynchronously
-func loadPageAsync(browser *ui.Browser, fetcher *net.Fetcher, parser *dom.Parser, url string, ctx context.Context) {
+func loadPageAsync(browser *ui.Browser, scheduler *net.Scheduler, parser *dom.Parser, url string, ctx context.Context) {
 	log.Printf("Navigating to: %s", url)
 
 	// Update browser state on main thread
@@ -81,7 +182,7 @@ func loadPageAsync(browser *ui.Browser, fetcher *net.Fetcher, parser *dom.Parser
 		}
 
 		// Fetch the page in background
-		html, err := fetcher.FetchWithContext(ctx, resolvedURL, nil)
+		resp, err := scheduler.Fetch(ctx, net.ResourceRequest{URL: resolvedURL, Type: net.ResourceDocument})
 
 		// Check if context was cancelled
 		if ctx.Err() != nil {
@@ -89,7 +190,41 @@ func loadPageAsync(browser *ui.Browser, fetcher *net.Fetcher, parser *dom.Parser
 			return
 		}
 
-		if err != nil {
+		// The page's images and fonts are cancelled with it when the tab navigates away,
+		// and they and its scripts' requests are held to its security policy and
+		// carry SameSite cookies only to its own site
+		if tab := browser.ActiveTab(); tab != nil {
+			if err == nil {
+				policy := documentPolicy(tab, resp)
+				ctx = net.WithCookieSite(net.WithDocumentPolicy(ctx, policy), policy.URL)
+			}
+			tab.SetLoadContext(ctx)
+			tabRuntime(tab).SetLoadContext(ctx)
+		}
+
+		var html string
+		if err == nil {
+			// The page's relative links resolve against the URL redirects ended at
+			if resp.URL != url {
+				if len(resp.Redirects) > 0 {
+					log.Printf("Redirected to: %s", resp.URL)
+				}
+				browser.ReplaceCurrentURL(resp.URL)
+			}
+			resolvedURL = resp.URL
+
+			// Error statuses come with pages of their own, such as 404 pages
+			if !resp.OK() {
+				log.Printf("Server returned %s for: %s", resp.Status, resolvedURL)
+				if strings.TrimSpace(resp.Text) == "" {
+					updateUIWithError(browser, fmt.Errorf("server returned %s", resp.Status), resolvedURL)
+					return
+				}
+			}
+			html = resp.Text
+			log.Printf("Page encoding: %s (%s)", resp.Encoding, resp.EncodingSource)
+			log.Printf("Fetched in %v after %v queued", resp.Timing.Total, resp.Timing.Queued)
+		} else {
 			// Fallback to mock HTML for example.com if network is unavailable
 			log.Printf("Network error (%v), checking if example.com for mock HTML", err)
 			if resolvedURL == "https://example.com" {
@@ -166,15 +301,23 @@ func updateUIWithContent(browser *ui.Browser, html string, url string) {
 	// Get or create JS runtime for the active tab
 	tab := browser.ActiveTab()
 	if tab != nil {
-		if tab.GetJSRuntime() == nil {
-			jsRuntime := js.NewRuntime()
-			tab.SetJSRuntime(jsRuntime)
-		}
-		
-		jsRuntime := tab.GetJSRuntime()
+		jsRuntime := tabRuntime(tab)
 		
 		// Set HTML content for JS runtime
 		jsRuntime.SetHTMLContent(html)
+		
+		// Give document.cookie the page's cookies
+		jsRuntime.SetCookieStore(net.DefaultCookieJar)
+		if err := jsRuntime.SetDocumentURL(url); err != nil {
+			log.Printf("Error setting the document URL: %v", err)
+		}
+		
+		// Deliver transition and animation end events to the page's listeners
+		if htmlRenderer, ok := tab.GetRenderer().(*renderer.Renderer); ok {
+			htmlRenderer.SetAnimationEventHandler(func(event renderer.AnimationEvent) {
+				dispatchAnimationEvent(jsRuntime, event)
+			})
+		}
 
 		// Run any JavaScript on the page
 		testScript := `
@@ -188,9 +331,62 @@ func updateUIWithContent(browser *ui.Browser, html string, url string) {
 	}
 }
 
+// tabRuntime returns the JavaScript runtime of a tab, creating it if needed.
+// Its fetch goes through the shared fetcher.
+func tabRuntime(tab *ui.Tab) *js.Runtime {
+	if tab.GetJSRuntime() == nil {
+		jsRuntime := js.NewRuntime()
+		if net.DefaultScheduler != nil {
+			jsRuntime.SetFetcher(net.DefaultScheduler.Fetcher())
+		}
+		tab.SetJSRuntime(jsRuntime)
+	}
+	return tab.GetJSRuntime()
+}
+
+// documentPolicy creates the security policy of a fetched page from its
+// headers and <meta http-equiv="Content-Security-Policy"> elements. Loads it
+// blocks or reports are logged to the console of the tab's runtime.
+func documentPolicy(tab *ui.Tab, resp *net.Response) *net.DocumentPolicy {
+	pageURL, err := neturl.Parse(resp.URL)
+	if err != nil {
+		pageURL = &neturl.URL{}
+	}
+	policy := net.NewDocumentPolicy(pageURL, resp.Header)
+	if resp.ContentType == "text/html" {
+		for _, content := range dom.MetaCSP(resp.Text) {
+			policy.CSP.AddMeta(content)
+		}
+	}
+	jsRuntime := tabRuntime(tab)
+	policy.OnViolation = func(v net.Violation) {
+		log.Print(v)
+		level := "error"
+		if v.ReportOnly {
+			level = "warn"
+		}
+		jsRuntime.LogMessage(level, v.String())
+	}
+	return policy
+}
+
+// dispatchAnimationEvent passes a transitionend or animationend event to the
+// listeners of its element. The runtime parses the same markup as the
+// renderer, so the element's position in the document identifies it.
+func dispatchAnimationEvent(jsRuntime *js.Runtime, event renderer.AnimationEvent) {
+	if event.Node == nil || event.Node.Source == nil {
+		return
+	}
+	jsRuntime.DispatchElementEvent(dom.ElementIndex(event.Node.Source), event.Type, map[string]interface{}{
+		"propertyName":  event.PropertyName,
+		"animationName": event.AnimationName,
+		"elapsedTime":   event.ElapsedTime.Seconds(),
+	})
+}
+
 // loadPage fetches and displays a web page (deprecated - use loadPageAsync)
-func loadPage(browser *ui.Browser, fetcher *net.Fetcher, parser *dom.Parser, url string) {
-	loadPageAsync(browser, fetcher, parser, url, context.Background())
+func loadPage(browser *ui.Browser, scheduler *net.Scheduler, parser *dom.Parser, url string) {
+	loadPageAsync(browser, scheduler, parser, url, context.Background())
 }
 
 // extractTitle parses the HTML and returns the content of the <title> tag.
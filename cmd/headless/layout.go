@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/vyquocvu/goosie/internal/renderer"
+)
+
+// layoutNode is the JSON form of a layout box
+// Boxes and lines are in page coordinates; inline boxes are relative to their line.
+type layoutNode struct {
+	Tag      string       `json:"tag,omitempty"`
+	ID       string       `json:"id,omitempty"`
+	Text     string       `json:"text,omitempty"`
+	Display  string       `json:"display"`
+	X        float32      `json:"x"`
+	Y        float32      `json:"y"`
+	Width    float32      `json:"width"`
+	Height   float32      `json:"height"`
+	Margin   [4]float32   `json:"margin"`  // Top, right, bottom, left
+	Padding  [4]float32   `json:"padding"` // Top, right, bottom, left
+	Border   [4]float32   `json:"border"`  // Top, right, bottom, left
+	Lines    []layoutLine `json:"lines,omitempty"`
+	Children []layoutNode `json:"children,omitempty"`
+}
+
+// layoutLine is the JSON form of a line box
+type layoutLine struct {
+	X      float32        `json:"x"`
+	Y      float32        `json:"y"`
+	Width  float32        `json:"width"`
+	Height float32        `json:"height"`
+	Boxes  []layoutInline `json:"boxes"`
+}
+
+// layoutInline is the JSON form of an inline box
+type layoutInline struct {
+	Tag       string  `json:"tag,omitempty"`
+	Text      string  `json:"text,omitempty"`
+	X         float32 `json:"x"`
+	Y         float32 `json:"y"`
+	Width     float32 `json:"width"`
+	Height    float32 `json:"height"`
+	BidiLevel int     `json:"bidiLevel,omitempty"`
+}
+
+// writeLayoutJSON writes a layout tree as indented JSON
+func writeLayoutJSON(w io.Writer, renderTree *renderer.RenderNode, layoutTree *renderer.LayoutBox) error {
+	nodes := make(map[int64]*renderer.RenderNode)
+	var index func(*renderer.RenderNode)
+	index = func(node *renderer.RenderNode) {
+		nodes[node.ID] = node
+		for _, child := range node.Children {
+			index(child)
+		}
+	}
+	if renderTree != nil {
+		index(renderTree)
+	}
+
+	var root *layoutNode
+	if layoutTree != nil {
+		node := convertLayoutBox(layoutTree, nodes)
+		root = &node
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(root)
+}
+
+// convertLayoutBox converts a layout box and its descendants
+func convertLayoutBox(box *renderer.LayoutBox, nodes map[int64]*renderer.RenderNode) layoutNode {
+	result := layoutNode{
+		Display: string(box.Display),
+		X:       box.Box.X,
+		Y:       box.Box.Y,
+		Width:   box.Box.Width,
+		Height:  box.Box.Height,
+		Margin:  [4]float32{box.MarginTop, box.MarginRight, box.MarginBottom, box.MarginLeft},
+		Padding: [4]float32{box.PaddingTop, box.PaddingRight, box.PaddingBottom, box.PaddingLeft},
+		Border:  [4]float32{box.BorderTopWidth, box.BorderRightWidth, box.BorderBottomWidth, box.BorderLeftWidth},
+	}
+	if node := nodes[box.NodeID]; node != nil {
+		if node.Type == renderer.NodeTypeText {
+			result.Text = node.Text
+		} else {
+			result.Tag = node.TagName
+			result.ID, _ = node.GetAttribute("id")
+		}
+	}
+
+	for _, line := range box.LineBoxes {
+		jsonLine := layoutLine{X: line.X, Y: line.Y, Width: line.Width, Height: line.Height, Boxes: []layoutInline{}}
+		for _, inline := range line.InlineBoxes {
+			jsonInline := layoutInline{
+				Text:      inline.Text,
+				X:         inline.X,
+				Y:         inline.Y,
+				Width:     inline.Width,
+				Height:    inline.Height,
+				BidiLevel: inline.BidiLevel,
+			}
+			if node := nodes[inline.NodeID]; node != nil && node.Type == renderer.NodeTypeElement {
+				jsonInline.Tag = node.TagName
+			}
+			jsonLine.Boxes = append(jsonLine.Boxes, jsonInline)
+		}
+		result.Lines = append(result.Lines, jsonLine)
+	}
+
+	for _, child := range box.Children {
+		result.Children = append(result.Children, convertLayoutBox(child, nodes))
+	}
+	return result
+}
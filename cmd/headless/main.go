@@ -0,0 +1,509 @@
+// Command goosie-headless loads a page without a window, runs its scripts and
+// writes a screenshot, its text or a dump of its layout or DOM.
+//
+// Usage:
+//
+//	goosie-headless [flags] <url or file>
+//
+// The exit code tells build pipelines what went wrong: 2 when the page could
+// not be loaded, 3 when it could not be parsed or laid out, 4 when one of its
+// scripts failed or timed out, and 1 for usage and output errors. The
+// artifact is still written when a script fails.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vyquocvu/goosie/internal/dom"
+	"github.com/vyquocvu/goosie/internal/js"
+	"github.com/vyquocvu/goosie/internal/net"
+	"github.com/vyquocvu/goosie/internal/renderer"
+	"golang.org/x/net/html"
+)
+
+// Exit codes
+const (
+	exitOK      = 0
+	exitFailure = 1 // Usage or output error
+	exitNetwork = 2 // The page could not be fetched or read
+	exitParse   = 3 // The page could not be parsed or laid out
+	exitScript  = 4 // A script failed, timed out or could not be loaded
+)
+
+// Output formats
+const (
+	formatPNG      = "png"
+	formatText     = "text"
+	formatMarkdown = "markdown"
+	formatLayout   = "layout"
+	formatDOM      = "dom"
+)
+
+// options holds the command line flags
+type options struct {
+	format   string
+	output   string
+	width    int
+	height   int
+	fullPage bool
+	timeout  time.Duration
+	wait     time.Duration
+	scripts  bool
+	verbose  bool
+
+	recordHAR string // HAR file to record the requests into
+	replayHAR string // HAR file to serve requests from instead of the network
+}
+
+// exitError is an error with the exit code it maps to
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command and returns its exit code
+func run(args []string, stdout, stderr io.Writer) (code int) {
+	opts, target, err := parseFlags(args, stderr)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		fmt.Fprintf(stderr, "goosie-headless: %v\n", err)
+		return exitFailure
+	}
+
+	finishHAR, err := setUpHAR(opts)
+	if err != nil {
+		fmt.Fprintf(stderr, "goosie-headless: %v\n", err)
+		return exitFailure
+	}
+	defer func() {
+		if err := finishHAR(); err != nil {
+			fmt.Fprintf(stderr, "goosie-headless: failed to save the HAR file: %v\n", err)
+			if code == exitOK {
+				code = exitFailure
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+
+	page, err := loadPage(ctx, target)
+	if err != nil {
+		fmt.Fprintf(stderr, "goosie-headless: %v\n", err)
+		return exitNetwork
+	}
+	if opts.verbose {
+		page.policy.OnViolation = func(v net.Violation) {
+			fmt.Fprintln(stderr, v)
+		}
+	}
+
+	// Scripts run before the artifact is produced, so that it reflects them
+	content, scriptErr := page.html, error(nil)
+	if opts.scripts {
+		var console io.Writer = io.Discard
+		if opts.verbose {
+			console = stderr
+		}
+		content, scriptErr = runScripts(ctx, page, opts.wait, console)
+	}
+
+	var out io.Writer = stdout
+	if opts.output != "" && opts.output != "-" {
+		file, err := os.Create(opts.output)
+		if err != nil {
+			fmt.Fprintf(stderr, "goosie-headless: %v\n", err)
+			return exitFailure
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if err := writeArtifact(ctx, out, opts, page, content); err != nil {
+		fmt.Fprintf(stderr, "goosie-headless: %v\n", err)
+		var exit *exitError
+		if errors.As(err, &exit) {
+			return exit.code
+		}
+		return exitFailure
+	}
+
+	if scriptErr != nil {
+		fmt.Fprintf(stderr, "goosie-headless: %v\n", scriptErr)
+		return exitScript
+	}
+	return exitOK
+}
+
+// parseFlags parses the command line into options and the page to load
+func parseFlags(args []string, stderr io.Writer) (*options, string, error) {
+	opts := &options{}
+	fs := flag.NewFlagSet("goosie-headless", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&opts.format, "format", formatPNG, "output format: png, text, markdown, layout or dom")
+	fs.StringVar(&opts.output, "o", "", "output file (default standard output)")
+	fs.IntVar(&opts.width, "width", 1024, "viewport width in pixels")
+	fs.IntVar(&opts.height, "height", 768, "viewport height in pixels")
+	fs.BoolVar(&opts.fullPage, "full-page", false, "capture the whole page instead of the viewport")
+	fs.DurationVar(&opts.timeout, "timeout", 30*time.Second, "time limit for loading the page and running its scripts")
+	fs.DurationVar(&opts.wait, "wait", 0, "time to let timers run after the page scripts, within the timeout")
+	fs.BoolVar(&opts.scripts, "scripts", true, "run the page's scripts")
+	fs.BoolVar(&opts.verbose, "v", false, "print console messages to standard error")
+	fs.StringVar(&opts.recordHAR, "record-har", "", "record the page's requests into a HAR file")
+	fs.StringVar(&opts.replayHAR, "replay-har", "", "serve requests from a HAR file instead of the network")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: goosie-headless [flags] <url or file>")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, "", err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return nil, "", errors.New("expected exactly one URL or file")
+	}
+	switch opts.format {
+	case formatPNG, formatText, formatMarkdown, formatLayout, formatDOM:
+	default:
+		return nil, "", fmt.Errorf("unknown format %q", opts.format)
+	}
+	if opts.width <= 0 || opts.height <= 0 {
+		return nil, "", errors.New("the viewport size must be positive")
+	}
+	if opts.timeout <= 0 {
+		return nil, "", errors.New("the timeout must be positive")
+	}
+	return opts, fs.Arg(0), nil
+}
+
+// setUpHAR makes requests replay from and record into the HAR files the
+// flags name. The returned function saves the recording and restores the
+// network defaults.
+func setUpHAR(opts *options) (func() error, error) {
+	oldTransport, oldRecorder, oldScheduler := net.DefaultTransport, net.DefaultRecorder, net.DefaultScheduler
+	if opts.replayHAR != "" {
+		archive, err := net.LoadHAR(opts.replayHAR)
+		if err != nil {
+			return nil, err
+		}
+		net.DefaultTransport = archive
+	}
+	if opts.recordHAR != "" {
+		net.DefaultRecorder = net.NewHARRecorder()
+	}
+	// A new scheduler creates its fetcher with the transport and recorder
+	net.DefaultScheduler = net.NewScheduler(nil)
+
+	return func() error {
+		recorder := net.DefaultRecorder
+		net.DefaultTransport, net.DefaultRecorder, net.DefaultScheduler = oldTransport, oldRecorder, oldScheduler
+		if opts.recordHAR == "" {
+			return nil
+		}
+		return recorder.Save(opts.recordHAR)
+	}, nil
+}
+
+// page is a loaded document
+type page struct {
+	html      string
+	baseURL   string // URL that relative references resolve against
+	scheduler *net.Scheduler
+
+	// Security policy of the document from its headers and <meta> elements,
+	// which its subresources and inline scripts are held to
+	policy *net.DocumentPolicy
+}
+
+// loadPage fetches a page from a URL, or reads it from a local file
+func loadPage(ctx context.Context, target string) (*page, error) {
+	p := &page{scheduler: net.DefaultScheduler}
+	if !p.scheduler.Fetcher().CanLoad(target) {
+		path, err := filepath.Abs(target)
+		if err != nil {
+			return nil, err
+		}
+		target = (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+	}
+	p.baseURL = target
+
+	resp, err := p.fetch(ctx, target, net.ResourceDocument)
+	if err != nil {
+		return nil, err
+	}
+	if resp.URL != "" {
+		// Relative references resolve against the URL a redirect ended at
+		p.baseURL = resp.URL
+	}
+	p.html = resp.Text
+
+	pageURL, err := url.Parse(p.baseURL)
+	if err != nil {
+		pageURL = &url.URL{}
+	}
+	p.policy = net.NewDocumentPolicy(pageURL, resp.Header)
+	if resp.ContentType == "text/html" {
+		for _, content := range dom.MetaCSP(resp.Text) {
+			p.policy.CSP.AddMeta(content)
+		}
+	}
+	return p, nil
+}
+
+// loadContext returns a context for the page's subresources, carrying its
+// security policy and its site for SameSite cookies
+func (p *page) loadContext(ctx context.Context) context.Context {
+	if p.policy == nil {
+		return ctx
+	}
+	return net.WithCookieSite(net.WithDocumentPolicy(ctx, p.policy), p.policy.URL)
+}
+
+// fetch loads a resource from the network, the file system or a data:
+// URL; error statuses fail like network errors
+func (p *page) fetch(ctx context.Context, ref string, resourceType net.ResourceType) (*net.Response, error) {
+	resp, err := p.scheduler.Fetch(p.loadContext(ctx), net.ResourceRequest{URL: ref, Type: resourceType})
+	if err == nil && !resp.OK() {
+		err = fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp, err
+}
+
+// resolve resolves a reference against the page's base URL
+func (p *page) resolve(ref string) string {
+	base, err := url.Parse(p.baseURL)
+	if err != nil {
+		return ref
+	}
+	rel, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return base.ResolveReference(rel).String()
+}
+
+// runScripts runs the page's scripts in document order and returns the
+// document as the scripts leave it, with the first script error. Inline
+// scripts the page's Content-Security-Policy blocks are skipped.
+func runScripts(ctx context.Context, p *page, wait time.Duration, console io.Writer) (string, error) {
+	doc, err := html.Parse(strings.NewReader(p.html))
+	if err != nil {
+		return p.html, nil // Reported when the artifact is produced
+	}
+
+	runtime := js.NewRuntime()
+	runtime.SetOutput(console)
+	runtime.SetHTMLContent(p.html)
+	defer runtime.Cleanup()
+
+	// fetch() is held to the page's origin and security policy
+	runtime.SetFetcher(p.scheduler.Fetcher())
+	runtime.SetLoadContext(p.loadContext(ctx))
+	if err := runtime.SetDocumentURL(p.baseURL); err != nil {
+		return p.html, err
+	}
+
+	// Scripts still running at the deadline are interrupted
+	stop := context.AfterFunc(ctx, func() { runtime.Interrupt("timeout") })
+	defer stop()
+
+	var firstErr error
+	for _, script := range findScripts(doc) {
+		code := script.text
+		name := "inline script"
+		if script.src != "" {
+			name = p.resolve(script.src)
+			resp, err := p.fetch(ctx, name, net.ResourceScript)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("failed to load script %s: %w", name, err)
+				}
+				continue
+			}
+			code = resp.Text
+		} else if p.policy != nil && !p.policy.AllowsInline(net.ResourceScript, script.nonce, code) {
+			continue
+		}
+
+		if _, err := runtime.RunScript(code); err != nil && firstErr == nil {
+			if ctx.Err() != nil {
+				firstErr = fmt.Errorf("%s timed out", name)
+			} else {
+				firstErr = fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+
+	// Let timers set by the scripts fire
+	if wait > 0 && ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+	}
+	// Settle the fetches still in flight, so the output does not depend on
+	// when their responses arrive
+	runtime.WaitForFetches()
+	return runtime.HTMLContent(), firstErr
+}
+
+// script is a classic script element
+type script struct {
+	src   string
+	text  string
+	nonce string
+}
+
+// findScripts returns the classic scripts of a document in document order
+// Module scripts and data blocks are skipped.
+func findScripts(doc *html.Node) []script {
+	var scripts []script
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "script" {
+			if s, ok := classicScript(n); ok {
+				scripts = append(scripts, s)
+			}
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return scripts
+}
+
+// classicScript reads a script element, reporting false unless it is JavaScript
+func classicScript(n *html.Node) (script, bool) {
+	var s script
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case "src":
+			s.src = strings.TrimSpace(attr.Val)
+		case "nonce":
+			s.nonce = attr.Val
+		case "type":
+			switch strings.ToLower(strings.TrimSpace(attr.Val)) {
+			case "", "text/javascript", "application/javascript", "text/ecmascript", "application/ecmascript":
+			default:
+				return s, false
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			s.text += c.Data
+		}
+	}
+	return s, true
+}
+
+// writeArtifact writes the chosen artifact of a document
+func writeArtifact(ctx context.Context, w io.Writer, opts *options, p *page, content string) error {
+	parser := dom.NewParser()
+	switch opts.format {
+	case formatText:
+		text, err := parser.ParseBodyText(content)
+		if err != nil {
+			return &exitError{exitParse, err}
+		}
+		_, err = fmt.Fprintln(w, text)
+		return err
+
+	case formatMarkdown:
+		markdown, err := parser.ParseBodyHTML(content)
+		if err != nil {
+			return &exitError{exitParse, err}
+		}
+		_, err = fmt.Fprintln(w, markdown)
+		return err
+
+	case formatDOM:
+		doc, err := html.Parse(strings.NewReader(content))
+		if err != nil {
+			return &exitError{exitParse, err}
+		}
+		if err := html.Render(w, doc); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w)
+		return err
+	}
+
+	r, err := layoutPage(ctx, opts, p, content)
+	if err != nil {
+		return &exitError{exitParse, err}
+	}
+
+	if opts.format == formatLayout {
+		return writeLayoutJSON(w, r.RenderTree(), r.LayoutTree())
+	}
+
+	height := opts.height
+	if opts.fullPage {
+		height = max(height, int(math.Ceil(float64(r.GetContentHeight()))))
+	}
+	raster := renderer.NewRasterRenderer()
+	raster.SetFontFaces(r.FontFaces())
+	return raster.RenderPNG(w, r.DisplayList(), opts.width, height)
+}
+
+// layoutPage lays out a document and loads its web fonts and images
+func layoutPage(ctx context.Context, opts *options, p *page, content string) (*renderer.Renderer, error) {
+	r := renderer.NewRenderer(float32(opts.width), float32(opts.height))
+	r.SetCurrentURL(p.baseURL)
+	r.SetLoadContext(p.loadContext(ctx))
+	r.SetFontFetcher(func(ref string) ([]byte, error) {
+		resp, err := p.fetch(ctx, ref, net.ResourceFont)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Body, nil
+	})
+
+	if _, err := r.LayoutHTML(content); err != nil {
+		return nil, err
+	}
+
+	// Fonts start loading during layout; lay out again once they are in
+	if r.FontFaces().Loading() {
+		ticker := time.NewTicker(10 * time.Millisecond)
+		for r.FontFaces().Loading() && ctx.Err() == nil {
+			select {
+			case <-ctx.Done():
+			case <-ticker.C:
+			}
+		}
+		ticker.Stop()
+		r.Relayout()
+	}
+
+	r.LoadImagesSync()
+	return r, nil
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vyquocvu/goosie/internal/net"
+)
+
+// writePage writes files into a temporary directory and returns the path of the first one
+func writePage(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	return filepath.Join(dir, "index.html")
+}
+
+func TestRunFormats(t *testing.T) {
+	path := writePage(t, map[string]string{
+		"index.html": `<html><head><title>Test</title></head><body><h1 id="title">Hello</h1><p>World</p></body></html>`,
+	})
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-format", "text", path}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("Expected exit code %d, got %d: %s", exitOK, code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Hello") || !strings.Contains(stdout.String(), "World") {
+		t.Errorf("Expected the page text, got %q", stdout.String())
+	}
+
+	stdout.Reset()
+	run([]string{"-format", "markdown", path}, &stdout, &stderr)
+	if !strings.HasPrefix(stdout.String(), "# Hello") {
+		t.Errorf("Expected a Markdown heading, got %q", stdout.String())
+	}
+
+	stdout.Reset()
+	run([]string{"-format", "dom", path}, &stdout, &stderr)
+	if !strings.Contains(stdout.String(), `<h1 id="title">Hello</h1>`) {
+		t.Errorf("Expected the serialized DOM, got %q", stdout.String())
+	}
+
+	stdout.Reset()
+	run([]string{"-format", "layout", path}, &stdout, &stderr)
+	var root layoutNode
+	if err := json.Unmarshal(stdout.Bytes(), &root); err != nil {
+		t.Fatalf("Expected a JSON layout tree: %v", err)
+	}
+	if root.Tag != "body" || len(root.Children) == 0 || root.Children[0].ID != "title" {
+		t.Errorf("Expected the body with the heading as first child, got %+v", root)
+	}
+
+	output := filepath.Join(t.TempDir(), "shot.png")
+	if code := run([]string{"-width", "320", "-height", "200", "-o", output, path}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("Expected exit code %d for a screenshot, got %d: %s", exitOK, code, stderr.String())
+	}
+	file, err := os.Open(output)
+	if err != nil {
+		t.Fatalf("Expected the screenshot to be written: %v", err)
+	}
+	defer file.Close()
+	img, err := png.Decode(file)
+	if err != nil {
+		t.Fatalf("Expected a PNG screenshot: %v", err)
+	}
+	if img.Bounds().Dx() != 320 || img.Bounds().Dy() != 200 {
+		t.Errorf("Expected a 320x200 screenshot, got %v", img.Bounds())
+	}
+}
+
+func TestRunExitCodes(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		args  []string
+		code  int
+	}{
+		{"missing file", nil, []string{"-format", "text"}, exitNetwork},
+		{"unknown format", map[string]string{"index.html": "<p>x</p>"}, []string{"-format", "gif"}, exitFailure},
+		{"script error", map[string]string{"index.html": `<p>x</p><script>undefinedFunction()</script>`}, []string{"-format", "text"}, exitScript},
+		{"missing script", map[string]string{"index.html": `<p>x</p><script src="missing.js"></script>`}, []string{"-format", "text"}, exitScript},
+		{"script timeout", map[string]string{"index.html": `<p>x</p><script>while (true) {}</script>`}, []string{"-format", "text", "-timeout", "200ms"}, exitScript},
+		{"external script", map[string]string{"index.html": `<p>x</p><script src="app.js"></script>`, "app.js": `console.log("loaded")`}, []string{"-format", "text"}, exitOK},
+		{"scripts disabled", map[string]string{"index.html": `<p>x</p><script>undefinedFunction()</script>`}, []string{"-format", "text", "-scripts=false"}, exitOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "index.html")
+			if tt.files != nil {
+				path = writePage(t, tt.files)
+			}
+			var stdout, stderr bytes.Buffer
+			if code := run(append(tt.args, path), &stdout, &stderr); code != tt.code {
+				t.Errorf("Expected exit code %d, got %d: %s", tt.code, code, stderr.String())
+			}
+			if tt.code == exitScript && !strings.Contains(stdout.String(), "x") {
+				t.Error("Expected the artifact to be written when a script fails")
+			}
+		})
+	}
+}
+
+func TestRunRecordAndReplayHAR(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><h1>Archived page</h1></body></html>`))
+	}))
+	archive := filepath.Join(t.TempDir(), "page.har")
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-format", "text", "-record-har", archive, server.URL}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("Expected exit code %d when recording, got %d: %s", exitOK, code, stderr.String())
+	}
+	recorded := stdout.String()
+	data, err := os.ReadFile(archive)
+	if err != nil || !strings.Contains(string(data), `"version": "1.2"`) || !strings.Contains(string(data), "Archived page") {
+		t.Fatalf("Expected a HAR file with the page, got %v: %s", err, data)
+	}
+	server.Close()
+
+	stdout.Reset()
+	if code := run([]string{"-format", "text", "-replay-har", archive, server.URL}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("Expected exit code %d when replaying, got %d: %s", exitOK, code, stderr.String())
+	}
+	if stdout.String() != recorded || !strings.Contains(recorded, "Archived page") {
+		t.Errorf("Expected the replay to match the recording %q, got %q", recorded, stdout.String())
+	}
+	if code := run([]string{"-replay-har", archive, server.URL + "/other"}, &stdout, &stderr); code != exitNetwork {
+		t.Errorf("Expected exit code %d for a page not in the archive, got %d", exitNetwork, code)
+	}
+}
+
+func TestRunContentSecurityPolicy(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`console.log("cross-origin ran")`))
+	}))
+	defer other.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/app.js" {
+			w.Write([]byte(`console.log("same-origin ran")`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Security-Policy", "script-src 'self' 'nonce-ok'")
+		w.Write([]byte(`<html><body><p>x</p>
+			<script>console.log("inline ran")</script>
+			<script nonce="ok">console.log("nonce ran")</script>
+			<script src="/app.js"></script>
+			<script src="` + other.URL + `/evil.js"></script>
+		</body></html>`))
+	}))
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+	// The blocked cross-origin script fails to load
+	if code := run([]string{"-format", "text", "-v", server.URL}, &stdout, &stderr); code != exitScript {
+		t.Errorf("Expected exit code %d, got %d: %s", exitScript, code, stderr.String())
+	}
+	console := stderr.String()
+	for _, ran := range []string{"nonce ran", "same-origin ran"} {
+		if !strings.Contains(console, ran) {
+			t.Errorf("Expected %q in the console, got %q", ran, console)
+		}
+	}
+	for _, blocked := range []string{"inline ran", "cross-origin ran"} {
+		if strings.Contains(console, blocked) {
+			t.Errorf("Expected the policy to block the script logging %q", blocked)
+		}
+	}
+	if !strings.Contains(console, "Refused to execute inline script") {
+		t.Errorf("Expected the violation to be reported, got %q", console)
+	}
+
+	// Policies of <meta> elements apply too
+	path := writePage(t, map[string]string{
+		"index.html": `<html><head><meta http-equiv="Content-Security-Policy" content="script-src 'none'"></head>` +
+			`<body><p>x</p><script>undefinedFunction()</script></body></html>`,
+	})
+	if code := run([]string{"-format", "text", path}, &stdout, &stderr); code != exitOK {
+		t.Errorf("Expected the blocked script not to run, got exit code %d: %s", code, stderr.String())
+	}
+}
+
+func TestRunScriptFetch(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Write([]byte("cross-origin"))
+	}))
+	defer other.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/data" {
+			time.Sleep(50 * time.Millisecond)
+			w.Write([]byte("same-origin"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Security-Policy", "connect-src 'self'")
+		w.Write([]byte(`<html><body><p>x</p><script>
+			fetch("/data")
+				.then(function(response) { return response.text(); })
+				.then(function(text) { console.log("fetched " + text); });
+			fetch("` + other.URL + `/data")
+				.then(function() { console.log("fetched cross-origin"); })
+				.catch(function() { console.log("blocked cross-origin"); });
+		</script></body></html>`))
+	}))
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-format", "text", "-v", server.URL}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("Expected exit code %d, got %d: %s", exitOK, code, stderr.String())
+	}
+	// The slow response still settles before the output is written
+	console := stderr.String()
+	if !strings.Contains(console, "fetched same-origin") {
+		t.Errorf("Expected the same-origin fetch to go through the network, got %q", console)
+	}
+	if !strings.Contains(console, "blocked cross-origin") || !strings.Contains(console, "connect-src 'self'") {
+		t.Errorf("Expected connect-src to block the cross-origin fetch, got %q", console)
+	}
+}
+
+func TestRunSameSiteCookies(t *testing.T) {
+	t.Cleanup(net.DefaultCookieJar.Clear)
+	var mu sync.Mutex
+	var imageRequested bool
+	var imageCookies string
+	images := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "strict", Value: "1", SameSite: http.SameSiteStrictMode})
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<p>Signed in</p>`))
+		case "/photo.png":
+			mu.Lock()
+			imageRequested, imageCookies = true, r.Header.Get("Cookie")
+			mu.Unlock()
+			http.NotFound(w, r)
+		}
+	}))
+	defer images.Close()
+	// The page is on 127.0.0.1 and the images on localhost, another site
+	imagesURL := strings.Replace(images.URL, "127.0.0.1", "localhost", 1)
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><img src="` + imagesURL + `/photo.png"></body></html>`))
+	}))
+	defer page.Close()
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-format", "text", imagesURL + "/login"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("Expected exit code %d, got %d: %s", exitOK, code, stderr.String())
+	}
+	if len(net.DefaultCookieJar.All()) != 1 {
+		t.Fatalf("Expected the navigation to store the Strict cookie, got %+v", net.DefaultCookieJar.All())
+	}
+
+	if code := run([]string{"-format", "layout", page.URL}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("Expected exit code %d, got %d: %s", exitOK, code, stderr.String())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !imageRequested {
+		t.Fatal("Expected the image to be requested")
+	}
+	if strings.Contains(imageCookies, "strict=1") {
+		t.Errorf("Expected the cross-site image request to drop the Strict cookie, got %q", imageCookies)
+	}
+}
@@ -14,10 +14,12 @@ func main() {
 	// Test 1: Fetch example.com
 	log.Println("\n1. Testing HTTP Fetcher...")
 	fetcher := net.NewFetcher()
-	html, err := fetcher.Fetch("https://example.com")
-
-	// If network is unavailable, use mock HTML for testing
-	if err != nil {
+	var html string
+	resp, err := fetcher.Fetch("https://example.com")
+	if err == nil {
+		html = resp.Text
+	} else {
+		// If network is unavailable, use mock HTML for testing
 		log.Printf("Network unavailable (%v), using mock HTML for testing", err)
 		html = `<!DOCTYPE html>
 <html>
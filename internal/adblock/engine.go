@@ -0,0 +1,313 @@
+package adblock
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/vyquocvu/goosie/internal/net"
+	"golang.org/x/net/publicsuffix"
+)
+
+// ListStats counts the filters read from lists
+type ListStats struct {
+	Network     int // Blocking filters and their exceptions
+	Cosmetic    int // Element hiding filters and their exceptions
+	Unsupported int // Filters of a syntax the engine skips
+}
+
+// Request is a request to check against network filters
+type Request struct {
+	URL      *url.URL
+	Document *url.URL // The page the request loads a resource of; nil if unknown
+	Type     net.ResourceType
+}
+
+// Engine matches requests and pages against the filters of lists. It is
+// safe for concurrent use.
+type Engine struct {
+	mu               sync.RWMutex
+	blocking         filterIndex
+	exceptions       filterIndex
+	hidingExceptions []*Filter                    // $elemhide and $generichide exceptions
+	generic          []*cosmeticFilter            // Element hiding filters for all domains but excluded ones
+	specific         map[string][]*cosmeticFilter // Element hiding filters by included domain
+	unhiding         []*cosmeticFilter            // #@# exceptions
+	stats            ListStats
+}
+
+// NewEngine creates an engine without filters
+func NewEngine() *Engine {
+	return &Engine{specific: make(map[string][]*cosmeticFilter)}
+}
+
+// LoadFile adds the filters of a list file, returning what it held
+func (e *Engine) LoadFile(path string) (ListStats, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return ListStats{}, err
+	}
+	defer file.Close()
+	stats, err := e.AddList(file)
+	if err != nil {
+		return stats, fmt.Errorf("failed to read filter list %s: %w", path, err)
+	}
+	return stats, nil
+}
+
+// AddList adds the filters of a list, one per line, skipping those of an
+// unsupported syntax
+func (e *Engine) AddList(r io.Reader) (ListStats, error) {
+	var stats ListStats
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		e.add(scanner.Text(), &stats)
+	}
+	return stats, scanner.Err()
+}
+
+// AddFilter adds one filter. Filters of an unsupported syntax return an
+// error wrapping ErrUnsupported; comments are ignored.
+func (e *Engine) AddFilter(line string) error {
+	return e.add(line, &ListStats{})
+}
+
+// add parses and indexes a line of a list, counting it in stats
+func (e *Engine) add(line string, stats *ListStats) error {
+	network, cosmetic, err := parseFilter(line)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, s := range []*ListStats{stats, &e.stats} {
+		switch {
+		case err != nil:
+			s.Unsupported++
+		case network != nil:
+			s.Network++
+		case cosmetic != nil:
+			s.Cosmetic++
+		}
+	}
+	switch {
+	case network != nil:
+		e.addNetwork(network)
+	case cosmetic != nil:
+		e.addCosmetic(cosmetic)
+	}
+	return err
+}
+
+// Stats returns how many filters the engine has read
+func (e *Engine) Stats() ListStats {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.stats
+}
+
+// addNetwork indexes a network filter. The caller holds e.mu.
+func (e *Engine) addNetwork(f *Filter) {
+	switch {
+	case f.elemHide || f.genericHide:
+		e.hidingExceptions = append(e.hidingExceptions, f)
+	case f.Exception:
+		e.exceptions.add(f)
+	default:
+		e.blocking.add(f)
+	}
+}
+
+// addCosmetic indexes an element hiding filter. The caller holds e.mu.
+func (e *Engine) addCosmetic(c *cosmeticFilter) {
+	switch {
+	case c.exception:
+		e.unhiding = append(e.unhiding, c)
+	case len(c.domains.include) == 0:
+		e.generic = append(e.generic, c)
+	default:
+		for _, domain := range c.domains.include {
+			e.specific[domain] = append(e.specific[domain], c)
+		}
+	}
+}
+
+// Match returns the filter blocking a request, or nil when no filter blocks
+// it or an exception allows it. Top-level documents are never blocked.
+func (e *Engine) Match(req Request) *Filter {
+	if req.Type == net.ResourceDocument || req.URL == nil {
+		return nil
+	}
+	r := newMatchRequest(req.URL, req.Document, requestType(req.Type))
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	f := e.blocking.match(r)
+	if f == nil || f.important {
+		return f
+	}
+	if e.exceptions.match(r) != nil {
+		return nil
+	}
+	return f
+}
+
+// HidingSelectors returns the selectors of the elements element hiding
+// filters hide on a page, in the order of their lists
+func (e *Engine) HidingSelectors(pageURL string) []string {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+	page := newMatchRequest(u, u, typeDocument)
+	host := page.documentHost
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	generic := true
+	for _, f := range e.hidingExceptions {
+		if f.matches(page) {
+			if f.elemHide {
+				return nil
+			}
+			generic = false
+		}
+	}
+
+	var selectors []string
+	seen := make(map[string]bool)
+	add := func(c *cosmeticFilter) {
+		if !seen[c.selector] && c.domains.matches(host) {
+			seen[c.selector] = true
+			selectors = append(selectors, c.selector)
+		}
+	}
+	if generic {
+		for _, c := range e.generic {
+			add(c)
+		}
+	}
+	// Filters for the host and its parent domains
+	for domain := host; domain != ""; {
+		for _, c := range e.specific[domain] {
+			add(c)
+		}
+		_, parent, ok := strings.Cut(domain, ".")
+		if !ok {
+			break
+		}
+		domain = parent
+	}
+	if len(selectors) == 0 {
+		return nil
+	}
+
+	unhidden := make(map[string]bool)
+	for _, c := range e.unhiding {
+		if seen[c.selector] && c.domains.matches(host) {
+			unhidden[c.selector] = true
+		}
+	}
+	hidden := selectors[:0]
+	for _, selector := range selectors {
+		if !unhidden[selector] {
+			hidden = append(hidden, selector)
+		}
+	}
+	return hidden
+}
+
+// HidingCSS returns a style sheet hiding the elements element hiding
+// filters hide on a page, "" when they hide none
+func (e *Engine) HidingCSS(pageURL string) string {
+	var sheet strings.Builder
+	for _, selector := range e.HidingSelectors(pageURL) {
+		sheet.WriteString(selector)
+		sheet.WriteString(" { display: none !important; }\n")
+	}
+	return sheet.String()
+}
+
+// matchRequest is a request prepared for matching against many filters
+type matchRequest struct {
+	url          string
+	tokens       []string
+	types        typeMask
+	documentHost string // "" when the document is unknown
+	thirdParty   bool
+}
+
+func newMatchRequest(u, document *url.URL, types typeMask) *matchRequest {
+	r := &matchRequest{url: u.String(), types: types}
+	r.tokens = urlTokens(strings.ToLower(r.url))
+	if document != nil {
+		r.documentHost = strings.ToLower(document.Hostname())
+		r.thirdParty = registrableDomain(u.Hostname()) != registrableDomain(document.Hostname())
+	}
+	return r
+}
+
+// registrableDomain returns the domain a host was registered under, such
+// as example.co.uk for www.example.co.uk
+func registrableDomain(host string) string {
+	host = strings.ToLower(host)
+	if domain, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return domain
+	}
+	return host
+}
+
+// matches reports whether a network filter applies to a request
+func (f *Filter) matches(r *matchRequest) bool {
+	if f.types&r.types == 0 {
+		return false
+	}
+	if f.thirdParty == 1 && !r.thirdParty || f.thirdParty == -1 && r.thirdParty {
+		return false
+	}
+	if !f.domains.empty() && !f.domains.matches(r.documentHost) {
+		return false
+	}
+	return f.pattern.MatchString(r.url)
+}
+
+// filterIndex finds the filters matching a URL by the tokens they contain
+type filterIndex struct {
+	byToken   map[string][]*Filter
+	untokened []*Filter // Filters without a token, tried for every URL
+}
+
+func (x *filterIndex) add(f *Filter) {
+	if f.token == "" {
+		x.untokened = append(x.untokened, f)
+		return
+	}
+	if x.byToken == nil {
+		x.byToken = make(map[string][]*Filter)
+	}
+	x.byToken[f.token] = append(x.byToken[f.token], f)
+}
+
+// match returns a filter matching a request, preferring $important ones
+func (x *filterIndex) match(r *matchRequest) *Filter {
+	var found *Filter
+	try := func(filters []*Filter) bool {
+		for _, f := range filters {
+			if (found == nil || f.important) && f.matches(r) {
+				found = f
+				if f.important {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	for _, token := range r.tokens {
+		if try(x.byToken[token]) {
+			return found
+		}
+	}
+	try(x.untokened)
+	return found
+}
@@ -0,0 +1,148 @@
+package adblock
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/vyquocvu/goosie/internal/net"
+)
+
+const testList = `[Adblock Plus 2.0]
+! Title: Test list
+||ads.example^
+||tracker.test^$script,third-party
+/banner/*$image
+|https://cdn.example/pixel.gif|
+@@||ads.example/allowed^
+||ads.example/forced^$important
+/^https?://[a-z]+\.doubleclick\.net\//$image
+||fonts.test^$font,domain=news.example|~sports.news.example
+##.ad-banner
+##div[id^="sponsor"]
+news.example##.promo
+~shop.example##.sidebar-ad
+news.example#@#.ad-banner
+@@||nohide.example^$elemhide
+@@||nogeneric.example^$generichide
+example.com##+js(set-constant, adsbygoogle, true)
+example.com#?#div:has(> .ad)
+||popup.example^$popup
+`
+
+func testEngine(t *testing.T) *Engine {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "list.txt")
+	if err := os.WriteFile(path, []byte(testList), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine()
+	stats, err := e.LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (ListStats{Network: 10, Cosmetic: 5, Unsupported: 3}) || e.Stats() != stats {
+		t.Fatalf("Unexpected list stats %+v", stats)
+	}
+	return e
+}
+
+func mustParse(t *testing.T, rawURL string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestNetworkFilters(t *testing.T) {
+	e := testEngine(t)
+	tests := []struct {
+		url, document string
+		resource      net.ResourceType
+		blockedBy     string
+	}{
+		{"https://ads.example/a.js", "https://news.example/", net.ResourceScript, "||ads.example^"},
+		{"https://sub.ads.example:8080/img.png", "https://news.example/", net.ResourceImage, "||ads.example^"},
+		{"https://notads.example/a.js", "https://news.example/", net.ResourceScript, ""},
+		{"https://ads.example.org/a.js", "https://news.example/", net.ResourceScript, ""},
+		// Top-level documents are never blocked
+		{"https://ads.example/", "", net.ResourceDocument, ""},
+		{"https://tracker.test/t.js", "https://news.example/", net.ResourceScript, "||tracker.test^$script,third-party"},
+		{"https://tracker.test/t.js", "https://www.tracker.test/", net.ResourceScript, ""},
+		{"https://tracker.test/t.png", "https://news.example/", net.ResourceImage, ""},
+		{"https://cdn.example/banner/728.png", "https://news.example/", net.ResourceImage, "/banner/*$image"},
+		{"https://cdn.example/banner/728.js", "https://news.example/", net.ResourceScript, ""},
+		{"https://cdn.example/pixel.gif", "https://news.example/", net.ResourceImage, "|https://cdn.example/pixel.gif|"},
+		{"https://cdn.example/pixel.gif?x=1", "https://news.example/", net.ResourceImage, ""},
+		{"https://ads.example/allowed/x.js", "https://news.example/", net.ResourceScript, ""},
+		{"https://ads.example/forced/x.js", "https://news.example/", net.ResourceScript, "||ads.example/forced^$important"},
+		{"https://stats.g.doubleclick.net/x.gif", "https://news.example/", net.ResourceImage, ""},
+		{"https://ad.doubleclick.net/x.gif", "https://news.example/", net.ResourceImage, `/^https?://[a-z]+\.doubleclick\.net\//$image`},
+		{"https://fonts.test/f.woff2", "https://www.news.example/", net.ResourceFont, "||fonts.test^$font,domain=news.example|~sports.news.example"},
+		{"https://fonts.test/f.woff2", "https://sports.news.example/", net.ResourceFont, ""},
+		{"https://fonts.test/f.woff2", "https://blog.example/", net.ResourceFont, ""},
+	}
+	for _, tt := range tests {
+		req := Request{URL: mustParse(t, tt.url), Type: tt.resource}
+		if tt.document != "" {
+			req.Document = mustParse(t, tt.document)
+		}
+		got := ""
+		if f := e.Match(req); f != nil {
+			got = f.String()
+		}
+		if got != tt.blockedBy {
+			t.Errorf("Match(%s %s on %s) = %q, expected %q", tt.resource, tt.url, tt.document, got, tt.blockedBy)
+		}
+	}
+}
+
+func TestPatternTokens(t *testing.T) {
+	tests := map[string]string{
+		"||ads.example^":           "example",
+		"/banner/*$image":          "banner",
+		"ads":                      "",
+		"*/advert-*":               "advert",
+		"*advert*":                 "",
+		"|https://cdn.test/p.gif|": "https",
+	}
+	for pattern, expected := range tests {
+		if got := patternToken(strings.Split(pattern, "$")[0]); got != expected {
+			t.Errorf("patternToken(%q) = %q, expected %q", pattern, got, expected)
+		}
+	}
+}
+
+func TestElementHiding(t *testing.T) {
+	e := testEngine(t)
+	tests := map[string][]string{
+		"https://blog.example/":       {".ad-banner", `div[id^="sponsor"]`, ".sidebar-ad"},
+		"https://www.news.example/":   {`div[id^="sponsor"]`, ".sidebar-ad", ".promo"},
+		"https://shop.example/cart":   {".ad-banner", `div[id^="sponsor"]`},
+		"https://nohide.example/":     nil,
+		"https://nogeneric.example/":  nil,
+		"file:///home/user/page.html": {".ad-banner", `div[id^="sponsor"]`, ".sidebar-ad"},
+	}
+	for page, expected := range tests {
+		if got := e.HidingSelectors(page); !slices.Equal(got, expected) {
+			t.Errorf("HidingSelectors(%s) = %q, expected %q", page, got, expected)
+		}
+	}
+
+	css := e.HidingCSS("https://shop.example/")
+	if css != ".ad-banner { display: none !important; }\ndiv[id^=\"sponsor\"] { display: none !important; }\n" {
+		t.Errorf("Unexpected hiding CSS %q", css)
+	}
+	if err := e.AddFilter("example.com#$#body { overflow: auto }"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported for a CSS injection filter, got %v", err)
+	}
+	if err := e.AddFilter("! comment"); err != nil {
+		t.Errorf("Expected comments to be ignored, got %v", err)
+	}
+}
@@ -0,0 +1,390 @@
+// Package adblock blocks ads and trackers with Adblock Plus and uBlock
+// Origin filter lists. Network filters block the requests of a page's
+// subresources; element hiding filters hide parts of the page with CSS.
+package adblock
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/vyquocvu/goosie/internal/css"
+	"github.com/vyquocvu/goosie/internal/net"
+)
+
+// ErrUnsupported is returned for filters of a syntax the engine does not
+// implement, such as scriptlets or procedural cosmetic filters
+var ErrUnsupported = errors.New("unsupported filter")
+
+// typeMask is a set of the request types of filter options
+type typeMask uint16
+
+const (
+	typeScript typeMask = 1 << iota
+	typeImage
+	typeStylesheet
+	typeFont
+	typeXHR
+	typeSubdocument
+	typeDocument
+	typeMedia
+	typeObject
+	typeOther
+	typePing
+	typeWebSocket
+
+	// typeDefault are the types of filters without type options; top-level
+	// documents are only blocked by filters asking for them
+	typeDefault = typeScript | typeImage | typeStylesheet | typeFont | typeXHR | typeSubdocument |
+		typeMedia | typeObject | typeOther | typePing | typeWebSocket
+	typeAll = typeDefault | typeDocument
+)
+
+// filterTypes are the type options of filters, with uBlock Origin's aliases
+var filterTypes = map[string]typeMask{
+	"script":         typeScript,
+	"image":          typeImage,
+	"stylesheet":     typeStylesheet,
+	"css":            typeStylesheet,
+	"font":           typeFont,
+	"xmlhttprequest": typeXHR,
+	"xhr":            typeXHR,
+	"subdocument":    typeSubdocument,
+	"frame":          typeSubdocument,
+	"document":       typeDocument,
+	"doc":            typeDocument,
+	"media":          typeMedia,
+	"object":         typeObject,
+	"other":          typeOther,
+	"ping":           typePing,
+	"websocket":      typeWebSocket,
+	"all":            typeAll,
+}
+
+// requestType returns the filter types of a resource the browser loads.
+// Requests that are not typed, such as script fetches, count as both
+// XMLHttpRequests and other requests.
+func requestType(t net.ResourceType) typeMask {
+	switch t {
+	case net.ResourceDocument:
+		return typeDocument
+	case net.ResourceStylesheet:
+		return typeStylesheet
+	case net.ResourceScript:
+		return typeScript
+	case net.ResourceFont:
+		return typeFont
+	case net.ResourceImage:
+		return typeImage
+	default:
+		return typeXHR | typeOther
+	}
+}
+
+// Filter is a network filter, blocking the requests it matches or, as an
+// exception, allowing them
+type Filter struct {
+	Text      string // The line of the list the filter was parsed from
+	Exception bool   // An @@ filter allowing requests blocking filters match
+
+	pattern     *regexp.Regexp
+	token       string // A token every URL the filter matches contains, "" if none is known
+	types       typeMask
+	thirdParty  int8 // 1 for third-party requests only, -1 for first-party ones only
+	domains     domainList
+	important   bool // Blocks even requests exception filters allow
+	elemHide    bool // An exception disabling element hiding on the pages it matches
+	genericHide bool // An exception disabling generic element hiding on the pages it matches
+}
+
+// String returns the filter as it was written in its list
+func (f *Filter) String() string {
+	return f.Text
+}
+
+// cosmeticFilter is an element hiding filter, hiding the elements a
+// selector matches on the pages of its domains
+type cosmeticFilter struct {
+	selector  string
+	domains   domainList
+	exception bool // A #@# filter, unhiding what other filters hide
+}
+
+// cosmeticSyntax splits element hiding filters into their domains, the
+// kind of filter and the selector
+var cosmeticSyntax = regexp.MustCompile(`^([^/|@"!$]*?)#([@?$%]{0,2})#(.+)$`)
+
+// parseFilter parses a line of a filter list into a network or element
+// hiding filter. Comments and blank lines give neither.
+func parseFilter(line string) (*Filter, *cosmeticFilter, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "!") || strings.HasPrefix(line, "[") {
+		return nil, nil, nil
+	}
+	if m := cosmeticSyntax.FindStringSubmatch(line); m != nil {
+		c, err := parseCosmetic(m[1], m[2], m[3])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %s", err, line)
+		}
+		return nil, c, nil
+	}
+	f, err := parseNetwork(line)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", err, line)
+	}
+	return f, nil, nil
+}
+
+// parseCosmetic parses an element hiding filter. Only plain CSS selectors
+// are supported, not procedural filters, scriptlets or HTML filters.
+func parseCosmetic(domains, kind, selector string) (*cosmeticFilter, error) {
+	if kind != "" && kind != "@" {
+		return nil, ErrUnsupported
+	}
+	selector = strings.TrimSpace(selector)
+	if strings.HasPrefix(selector, "+js(") || strings.HasPrefix(selector, "^") || strings.ContainsAny(selector, "{}") {
+		return nil, ErrUnsupported
+	}
+	// Selectors the style engine cannot parse would drop the page's hiding rules
+	stylesheet, err := css.NewParser(selector + " {}").Parse()
+	if err != nil || len(stylesheet.Rules) != 1 {
+		return nil, ErrUnsupported
+	}
+	return &cosmeticFilter{
+		selector:  selector,
+		domains:   parseDomains(domains, ","),
+		exception: kind == "@",
+	}, nil
+}
+
+// parseNetwork parses a network filter: an optional @@, a URL pattern and
+// options after a $
+func parseNetwork(line string) (*Filter, error) {
+	f := &Filter{Text: line, types: typeDefault}
+	rule := line
+	if strings.HasPrefix(rule, "@@") {
+		f.Exception = true
+		rule = rule[2:]
+	}
+
+	pattern, options := rule, ""
+	if i := strings.LastIndex(pattern, "/$"); strings.HasPrefix(pattern, "/") && i > 0 {
+		// Options follow the closing slash of regular expressions, which
+		// may contain $ themselves
+		pattern, options = pattern[:i+1], pattern[i+2:]
+	} else if i := strings.LastIndex(pattern, "$"); i >= 0 && !(strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/")) {
+		pattern, options = pattern[:i], pattern[i+1:]
+	}
+
+	matchCase, err := f.parseOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		expr := pattern[1 : len(pattern)-1]
+		if !matchCase {
+			expr = "(?i)" + expr
+		}
+		if f.pattern, err = regexp.Compile(expr); err != nil {
+			return nil, ErrUnsupported
+		}
+		return f, nil
+	}
+	f.pattern = compilePattern(pattern, matchCase)
+	f.token = patternToken(pattern)
+	return f, nil
+}
+
+// parseOptions applies the options of a network filter, reporting whether
+// it matches case
+func (f *Filter) parseOptions(options string) (matchCase bool, err error) {
+	if options == "" {
+		return false, nil
+	}
+	var include, exclude typeMask
+	for _, option := range strings.Split(options, ",") {
+		option = strings.ToLower(strings.TrimSpace(option))
+		negated := strings.HasPrefix(option, "~")
+		name := strings.TrimPrefix(option, "~")
+		if t, ok := filterTypes[name]; ok {
+			if negated {
+				exclude |= t
+			} else {
+				include |= t
+			}
+			continue
+		}
+		switch {
+		case name == "third-party" || name == "3p" || name == "first-party" || name == "1p":
+			// ~third-party is first-party and ~first-party third-party
+			f.thirdParty = 1
+			if (name == "first-party" || name == "1p") != negated {
+				f.thirdParty = -1
+			}
+		case negated:
+			return false, ErrUnsupported
+		case name == "match-case":
+			matchCase = true
+		case name == "important":
+			f.important = true
+		case name == "elemhide" || name == "ehide":
+			f.elemHide = true
+		case name == "generichide" || name == "ghide":
+			f.genericHide = true
+		case name == "genericblock":
+			// Generic filters are never skipped, so there is nothing to disable
+		case strings.HasPrefix(name, "domain="):
+			f.domains = parseDomains(name[len("domain="):], "|")
+		default:
+			return false, ErrUnsupported
+		}
+	}
+	if include != 0 {
+		f.types = include
+	}
+	f.types &^= exclude
+	if (f.elemHide || f.genericHide) && include == 0 {
+		// Hiding exceptions apply to the pages they match
+		f.types |= typeDocument
+	}
+	if (f.elemHide || f.genericHide) && !f.Exception {
+		return false, ErrUnsupported
+	}
+	return matchCase, nil
+}
+
+// compilePattern translates the URL pattern of a filter into a regular
+// expression. || anchors at the start of the host or one of its parent
+// domains, | at the start or end of the URL, * matches anything and ^ a
+// separator: a character other than a letter, digit or _ - . %, or the end.
+func compilePattern(pattern string, matchCase bool) *regexp.Regexp {
+	var expr strings.Builder
+	if !matchCase {
+		expr.WriteString("(?i)")
+	}
+	switch {
+	case strings.HasPrefix(pattern, "||"):
+		expr.WriteString(`^[a-z][a-z0-9+.-]*://(?:[^/?#]*\.)?`)
+		pattern = pattern[2:]
+	case strings.HasPrefix(pattern, "|"):
+		expr.WriteString("^")
+		pattern = pattern[1:]
+	}
+	anchorEnd := strings.HasSuffix(pattern, "|")
+	pattern = strings.TrimSuffix(pattern, "|")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '^':
+			expr.WriteString(`(?:[^\w.%-]|$)`)
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if anchorEnd {
+		expr.WriteString("$")
+	}
+	return regexp.MustCompile(expr.String())
+}
+
+// patternToken picks the longest run of token characters in a pattern that
+// any URL the pattern matches has as a whole run too, so filters can be
+// looked up by the tokens of a URL. Runs next to a wildcard or at an
+// unanchored end may be part of longer runs and are not used.
+func patternToken(pattern string) string {
+	pattern = strings.ToLower(pattern)
+	best := ""
+	for i := 0; i < len(pattern); {
+		if !isTokenChar(pattern[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(pattern) && isTokenChar(pattern[j]) {
+			j++
+		}
+		// Anchors, separators and other characters end runs; wildcards and
+		// the ends of the pattern may not
+		bounded := i > 0 && j < len(pattern) && pattern[i-1] != '*' && pattern[j] != '*'
+		if bounded && j-i > len(best) {
+			best = pattern[i:j]
+		}
+		i = j
+	}
+	return best
+}
+
+// isTokenChar reports whether a byte is part of the tokens URLs are indexed by
+func isTokenChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '%'
+}
+
+// urlTokens returns the runs of token characters of a lowercased URL
+func urlTokens(u string) []string {
+	var tokens []string
+	for i := 0; i < len(u); {
+		if !isTokenChar(u[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(u) && isTokenChar(u[j]) {
+			j++
+		}
+		tokens = append(tokens, u[i:j])
+		i = j
+	}
+	return tokens
+}
+
+// domainList is the domains a filter applies to; a filter without
+// included domains applies to all but the excluded ones
+type domainList struct {
+	include []string
+	exclude []string
+}
+
+// parseDomains parses a list of domains, with ~ before those excluded
+func parseDomains(list, sep string) domainList {
+	var d domainList
+	for _, domain := range strings.Split(list, sep) {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if excluded, ok := strings.CutPrefix(domain, "~"); ok {
+			d.exclude = append(d.exclude, excluded)
+		} else if domain != "" {
+			d.include = append(d.include, domain)
+		}
+	}
+	return d
+}
+
+// empty reports whether the list applies to every domain
+func (d domainList) empty() bool {
+	return len(d.include) == 0 && len(d.exclude) == 0
+}
+
+// matches reports whether the list applies to a host
+func (d domainList) matches(host string) bool {
+	for _, domain := range d.exclude {
+		if hostMatches(host, domain) {
+			return false
+		}
+	}
+	if len(d.include) == 0 {
+		return true
+	}
+	for _, domain := range d.include {
+		if hostMatches(host, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostMatches reports whether a host is a domain or one of its subdomains
+func hostMatches(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
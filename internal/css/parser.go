@@ -2,6 +2,7 @@ package css
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -100,8 +101,14 @@ func (p *Parser) parseAtRule() (AtRule, error) {
 				atRule.Rules = append(atRule.Rules, Rule{Selectors: selectors, Declarations: declarations})
 				p.consumeWhitespaceAndComments()
 			}
+		} else if isKeyframesRule(atRule.Name) {
+			keyframes, err := p.parseKeyframes()
+			if err != nil {
+				return atRule, err
+			}
+			atRule.Keyframes = keyframes
 		} else {
-			// For @keyframes and others, just parse declarations
+			// For @font-face and others, just parse declarations
 			atRule.Declarations = p.parseDeclarations()
 		}
 		
@@ -116,6 +123,63 @@ func (p *Parser) parseAtRule() (AtRule, error) {
 	return atRule, nil
 }
 
+// isKeyframesRule reports whether an at-rule name is @keyframes or a
+// vendor prefixed variant of it
+func isKeyframesRule(name string) bool {
+	name = strings.ToLower(name)
+	return name == "keyframes" || strings.HasPrefix(name, "-") && strings.HasSuffix(name, "-keyframes")
+}
+
+// parseKeyframes parses the keyframe blocks of a @keyframes rule
+// Blocks whose selectors are not from, to or percentages are skipped.
+func (p *Parser) parseKeyframes() ([]Keyframe, error) {
+	var keyframes []Keyframe
+	for p.peek() != '}' && p.pos < len(p.input) {
+		selectors := p.consumeUntil('{')
+		if !p.consumeChar('{') {
+			return keyframes, fmt.Errorf("expected '{' in keyframe")
+		}
+		p.consumeWhitespaceAndComments()
+		declarations := p.parseDeclarations()
+		p.consumeWhitespaceAndComments()
+		if !p.consumeChar('}') {
+			return keyframes, fmt.Errorf("expected '}' in keyframe")
+		}
+		p.consumeWhitespaceAndComments()
+		
+		if offsets, ok := parseKeyframeSelectors(selectors); ok {
+			keyframes = append(keyframes, Keyframe{Offsets: offsets, Declarations: declarations})
+		}
+	}
+	return keyframes, nil
+}
+
+// parseKeyframeSelectors parses a comma-separated keyframe selector list
+// like "from, 50%" into offsets from 0 to 1
+func parseKeyframeSelectors(selectors string) ([]float64, bool) {
+	var offsets []float64
+	for _, selector := range strings.Split(selectors, ",") {
+		selector = strings.ToLower(strings.TrimSpace(selector))
+		switch selector {
+		case "from":
+			offsets = append(offsets, 0)
+		case "to":
+			offsets = append(offsets, 1)
+		default:
+			percent, ok := strings.CutSuffix(selector, "%")
+			if !ok {
+				return nil, false
+			}
+			value, err := strconv.ParseFloat(percent, 64)
+			if err != nil || value < 0 || value > 100 {
+				return nil, false
+			}
+			offsets = append(offsets, value/100)
+		}
+	}
+	return offsets, true
+}
+
 // parseSelectorSequences parses a comma-separated list of selector sequences
 func (p *Parser) parseSelectorSequences() ([]SelectorSequence, error) {
 	var sequences []SelectorSequence
@@ -443,6 +443,43 @@ func TestParserAtMedia(t *testing.T) {
 	}
 }
 
+func TestParserAtKeyframes(t *testing.T) {
+	css := `
+		@keyframes pulse {
+			from { opacity: 0; }
+			50%, 75% { opacity: 1; transform: scale(1.5); }
+			bogus { color: red; }
+			to { opacity: 0.5; }
+		}
+		p { animation: pulse 1s; }
+	`
+	p := NewParser(css)
+	stylesheet, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	if len(stylesheet.AtRules) != 1 || len(stylesheet.Rules) != 1 {
+		t.Fatalf("expected 1 at-rule and 1 rule, got %d and %d", len(stylesheet.AtRules), len(stylesheet.Rules))
+	}
+	atRule := stylesheet.AtRules[0]
+	if atRule.Name != "keyframes" || atRule.Prelude != "pulse" {
+		t.Errorf("expected @keyframes pulse, got @%s %s", atRule.Name, atRule.Prelude)
+	}
+	if len(atRule.Keyframes) != 3 {
+		t.Fatalf("expected 3 keyframes, got %d", len(atRule.Keyframes))
+	}
+	middle := atRule.Keyframes[1]
+	if len(middle.Offsets) != 2 || middle.Offsets[0] != 0.5 || middle.Offsets[1] != 0.75 {
+		t.Errorf("expected offsets 0.5 and 0.75, got %v", middle.Offsets)
+	}
+	if len(middle.Declarations) != 2 || middle.Declarations[1].Value != "scale(1.5)" {
+		t.Errorf("expected the keyframe declarations, got %v", middle.Declarations)
+	}
+	if last := atRule.Keyframes[2]; last.Offsets[0] != 1 || last.Declarations[0].Value != "0.5" {
+		t.Errorf("expected the to keyframe last, got %v", last)
+	}
+}
+
 func TestParserComplexSelector(t *testing.T) {
 	css := `
 		div.container > p#intro.highlight:first-child {
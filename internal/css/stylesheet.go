@@ -18,6 +18,13 @@ type AtRule struct {
 	Prelude      string
 	Rules        []Rule
 	Declarations []Declaration
+	Keyframes    []Keyframe // Keyframe blocks of @keyframes, in source order
+}
+
+// Keyframe represents one block of a @keyframes rule, e.g. "from, 50% { ... }"
+type Keyframe struct {
+	Offsets      []float64 // Offsets of the keyframe selectors, from 0 to 1
+	Declarations []Declaration
 }
 
 // SelectorSequence represents a complete selector with combinators
@@ -61,6 +61,7 @@ type Element struct {
 	Attributes map[string]string
 	TextContent string
 	Node       *html.Node
+	Index      int // Position among the document's elements in tree order
 }
 
 // GetElementByID searches for an element by ID (basic implementation)
@@ -263,12 +264,72 @@ func (p *Parser) matchesSelector(n *html.Node, selector string) bool {
 	return strings.ToLower(n.Data) == strings.ToLower(selector)
 }
 
+// GetElementByIndex returns the element at a position among the document's
+// elements in tree order, or nil if there is none
+func (p *Parser) GetElementByIndex(htmlContent string, index int) (*Element, error) {
+	doc, err := html.Parse(strings.NewReader(htmlContent))
+	if err != nil {
+		return nil, err
+	}
+
+	var result *html.Node
+	count := 0
+	var findElement func(*html.Node)
+	findElement = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if count == index {
+				result = n
+				return
+			}
+			count++
+		}
+		for c := n.FirstChild; c != nil && result == nil; c = c.NextSibling {
+			findElement(c)
+		}
+	}
+
+	findElement(doc)
+	if result == nil {
+		return nil, nil
+	}
+	return p.nodeToElement(result), nil
+}
+
+// ElementIndex returns the position of an element among the elements of its
+// document in tree order. Parsing the same markup again gives its element
+// the same index, so it identifies the element across parses.
+func ElementIndex(n *html.Node) int {
+	root := n
+	for root.Parent != nil {
+		root = root.Parent
+	}
+
+	index := 0
+	found := false
+	var count func(*html.Node)
+	count = func(c *html.Node) {
+		if c == n {
+			found = true
+			return
+		}
+		if c.Type == html.ElementNode {
+			index++
+		}
+		for child := c.FirstChild; child != nil && !found; child = child.NextSibling {
+			count(child)
+		}
+	}
+	count(root)
+	return index
+}
+
 // nodeToElement converts an html.Node to an Element
 func (p *Parser) nodeToElement(n *html.Node) *Element {
 	elem := &Element{
 		TagName:    strings.ToLower(n.Data),
 		Attributes: make(map[string]string),
 		Node:       n,
+		Index:      ElementIndex(n),
 	}
 	
 	for _, attr := range n.Attr {
@@ -392,3 +453,37 @@ func (p *Parser) convertToMarkdown(n *html.Node, builder *strings.Builder) {
 		}
 	}
 }
+
+// MetaCSP returns the policies of the <meta http-equiv="Content-Security-Policy">
+// elements in the <head> of an HTML document
+func MetaCSP(htmlContent string) []string {
+	doc, err := html.Parse(strings.NewReader(htmlContent))
+	if err != nil {
+		return nil
+	}
+
+	var policies []string
+	var crawler func(*html.Node, bool)
+	crawler = func(node *html.Node, inHead bool) {
+		if node.Type == html.ElementNode && node.Data == "meta" && inHead {
+			var httpEquiv, content string
+			for _, attr := range node.Attr {
+				switch attr.Key {
+				case "http-equiv":
+					httpEquiv = attr.Val
+				case "content":
+					content = attr.Val
+				}
+			}
+			if strings.EqualFold(httpEquiv, "Content-Security-Policy") && content != "" {
+				policies = append(policies, content)
+			}
+		}
+		for c := node.FirstChild; c != nil; c = c.NextSibling {
+			crawler(c, inHead || node.Type == html.ElementNode && node.Data == "head")
+		}
+	}
+	crawler(doc, false)
+
+	return policies
+}
@@ -386,3 +386,33 @@ func TestQuerySelectorAll(t *testing.T) {
 		})
 	}
 }
+
+func TestGetElementByIndex(t *testing.T) {
+	parser := NewParser()
+	
+	html := `<html><head><title>T</title></head><body>
+		<div class="item">Item 1</div>
+		<p class="item">Item 2</p>
+	</body></html>`
+	
+	items, err := parser.QuerySelectorAll(html, ".item")
+	if err != nil || len(items) != 2 {
+		t.Fatalf("QuerySelectorAll() = %v, %v", items, err)
+	}
+	// html, head, title, body, div, p
+	if items[0].Index != 4 || items[1].Index != 5 {
+		t.Errorf("Expected indexes 4 and 5, got %d and %d", items[0].Index, items[1].Index)
+	}
+	
+	// The index finds the same element in a new parse
+	got, err := parser.GetElementByIndex(html, items[1].Index)
+	if err != nil || got == nil {
+		t.Fatalf("GetElementByIndex() = %v, %v", got, err)
+	}
+	if got.TagName != "p" || got.TextContent != "Item 2" {
+		t.Errorf("Expected the paragraph, got <%s> %q", got.TagName, got.TextContent)
+	}
+	if got, _ := parser.GetElementByIndex(html, 100); got != nil {
+		t.Errorf("Expected no element past the end, got <%s>", got.TagName)
+	}
+}
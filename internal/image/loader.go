@@ -2,6 +2,8 @@ package image
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"image"
 	_ "image/gif"
@@ -13,6 +15,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/vyquocvu/goosie/internal/net"
 	_ "golang.org/x/image/webp"
 )
 
@@ -43,9 +46,11 @@ type OnLoadCallback func(source string)
 
 // loader handles loading images from various sources
 type loader struct {
-	httpClient *http.Client
-	cache      *Cache
-	mu         sync.RWMutex
+	scheduler *net.Scheduler
+	cache     *Cache
+	mu        sync.RWMutex
+	// Context of the page loading images; done when it is left
+	ctx context.Context
 	// Track in-progress loads to avoid duplicate requests
 	inProgress map[string]*sync.WaitGroup
 	// OnLoad is called when an image is successfully loaded
@@ -55,22 +60,43 @@ type loader struct {
 // NewLoader creates a new image loader with a cache
 func NewLoader(cacheSize int) Loader {
 	return &loader{
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		scheduler:  net.DefaultScheduler,
+		ctx:        context.Background(),
 		cache:      NewCache(cacheSize),
 		inProgress: make(map[string]*sync.WaitGroup),
 	}
 }
 
+// fetchTimeout limits how long an image may take to load
+const fetchTimeout = 30 * time.Second
+
 // SetOnLoadCallback sets the callback for when an image is loaded
 func (l *loader) SetOnLoadCallback(callback OnLoadCallback) {
 	l.OnLoad = callback
 }
 
+// SetContext sets the context images are loaded under from now on
+// Loads still queued or in flight when it is done are cancelled and not
+// cached, so that leaving a page stops the loads of its images.
+func (l *loader) SetContext(ctx context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ctx = ctx
+}
+
 // Load loads an image from a URL or file path
 // Returns cached image if available, otherwise loads asynchronously
 func (l *loader) Load(source string) (*ImageData, error) {
+	return l.load(source, false)
+}
+
+// LoadOffscreen loads an image outside the viewport like Load, after the
+// images that are visible
+func (l *loader) LoadOffscreen(source string) (*ImageData, error) {
+	return l.load(source, true)
+}
+
+func (l *loader) load(source string, offscreen bool) (*ImageData, error) {
 	// Check cache first
 	if cached := l.cache.Get(source); cached != nil {
 		return cached, nil
@@ -94,10 +120,11 @@ func (l *loader) Load(source string) (*ImageData, error) {
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	l.inProgress[source] = wg
+	ctx := l.ctx
 	l.mu.Unlock()
 
 	// Return loading state immediately and load in background
-	go l.loadAsync(source, wg)
+	go l.loadAsync(ctx, source, offscreen, wg)
 
 	return &ImageData{State: StateLoading}, nil
 }
@@ -110,7 +137,10 @@ func (l *loader) LoadSync(source string) (*ImageData, error) {
 	}
 
 	// Load the image
-	data, err := l.loadImage(source)
+	l.mu.RLock()
+	ctx := l.ctx
+	l.mu.RUnlock()
+	data, err := l.loadImage(ctx, source, false)
 	if err != nil {
 		data = &ImageData{
 			State: StateError,
@@ -118,14 +148,16 @@ func (l *loader) LoadSync(source string) (*ImageData, error) {
 		}
 	}
 
-	// Cache the result (even errors)
-	l.cache.Put(source, data)
+	// Cache the result (even errors), unless the load was cancelled
+	if !errors.Is(err, context.Canceled) {
+		l.cache.Put(source, data)
+	}
 
 	return data, err
 }
 
 // loadAsync loads an image asynchronously
-func (l *loader) loadAsync(source string, wg *sync.WaitGroup) {
+func (l *loader) loadAsync(ctx context.Context, source string, offscreen bool, wg *sync.WaitGroup) {
 	defer wg.Done()
 	defer func() {
 		l.mu.Lock()
@@ -133,7 +165,11 @@ func (l *loader) loadAsync(source string, wg *sync.WaitGroup) {
 		l.mu.Unlock()
 	}()
 
-	data, err := l.loadImage(source)
+	data, err := l.loadImage(ctx, source, offscreen)
+	if errors.Is(err, context.Canceled) {
+		// The page was left; load the image again if it comes back
+		return
+	}
 	if err != nil {
 		data = &ImageData{
 			State: StateError,
@@ -151,33 +187,30 @@ func (l *loader) loadAsync(source string, wg *sync.WaitGroup) {
 }
 
 // loadImage loads an image from a source (URL or file path)
-func (l *loader) loadImage(source string) (*ImageData, error) {
+func (l *loader) loadImage(ctx context.Context, source string, offscreen bool) (*ImageData, error) {
 	// Determine if it's a URL or file path
-	if isURL(source) {
-		return l.loadFromURL(source)
+	if l.scheduler.Fetcher().CanLoad(source) {
+		return l.loadFromURL(ctx, source, offscreen)
 	}
 	return l.loadFromFile(source)
 }
 
-// loadFromURL loads an image from a remote URL
-func (l *loader) loadFromURL(url string) (*ImageData, error) {
-	resp, err := l.httpClient.Get(url)
+// loadFromURL loads an image from a URL, such as an http:, file: or data: URL
+// Fetches are scheduled with page loads and share their HTTP cache and
+// cookie jar.
+func (l *loader) loadFromURL(ctx context.Context, url string, offscreen bool) (*ImageData, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	resp, err := l.scheduler.Fetch(ctx, net.ResourceRequest{URL: url, Type: net.ResourceImage, Offscreen: offscreen})
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch image: %w", err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("HTTP error: %d", resp.StatusCode)
 	}
 
-	// Read the response body
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read image data: %w", err)
-	}
-
-	return l.decodeImage(bytes.NewReader(data))
+	return l.decodeImage(bytes.NewReader(resp.Body))
 }
 
 // loadFromFile loads an image from a local file
@@ -212,8 +245,3 @@ func (l *loader) decodeImage(r io.Reader) (*ImageData, error) {
 func (l *loader) GetCache() *Cache {
 	return l.cache
 }
-
-// isURL checks if a string is a URL
-func isURL(s string) bool {
-	return len(s) > 7 && (s[:7] == "http://" || s[:8] == "https://")
-}
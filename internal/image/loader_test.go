@@ -1,16 +1,23 @@
 package image
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
 	"image/png"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/vyquocvu/goosie/internal/net"
 )
 
 func TestNewLoader(t *testing.T) {
@@ -22,12 +29,12 @@ func TestNewLoader(t *testing.T) {
 	if loader.cache == nil {
 		t.Error("Cache not initialized")
 	}
-	if loader.httpClient == nil {
-		t.Error("HTTP client not initialized")
+	if loader.scheduler == nil {
+		t.Error("Scheduler not initialized")
 	}
 }
 
-func TestIsURL(t *testing.T) {
+func TestLoadsURLs(t *testing.T) {
 	tests := []struct {
 		input    string
 		expected bool
@@ -38,12 +45,16 @@ func TestIsURL(t *testing.T) {
 		{"/path/to/file.png", false},
 		{"file.png", false},
 		{"htt://invalid", false},
+		{"file:///path/to/file.png", true},
+		{"data:image/png;base64,iVBORw0KGgo=", true},
+		{"C:\\images\\file.png", false},
 	}
 
+	loader := NewLoader(10).(*loader)
 	for _, tt := range tests {
-		result := isURL(tt.input)
+		result := loader.scheduler.Fetcher().CanLoad(tt.input)
 		if result != tt.expected {
-			t.Errorf("isURL(%q) = %v, expected %v", tt.input, result, tt.expected)
+			t.Errorf("CanLoad(%q) = %v, expected %v", tt.input, result, tt.expected)
 		}
 	}
 }
@@ -153,6 +164,72 @@ func TestLoadFromURLError(t *testing.T) {
 	}
 }
 
+func TestLoadFromLocalURLs(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 3, 2)))
+	path := filepath.Join(t.TempDir(), "small.png")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loader := NewLoader(10).(*loader)
+	sources := []string{
+		"data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+		(&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String(),
+	}
+	for _, source := range sources {
+		data, err := loader.LoadSync(source)
+		if err != nil {
+			t.Fatalf("LoadSync(%.40s) failed: %v", source, err)
+		}
+		if data.Width != 3 || data.Height != 2 {
+			t.Errorf("Expected a 3x2 image from %.40s, got %dx%d", source, data.Width, data.Height)
+		}
+	}
+}
+
+func TestCancelledLoadsAreNotCached(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		png.Encode(w, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+	}))
+	defer server.Close()
+
+	loader := NewLoader(10).(*loader)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	loader.SetContext(ctx)
+	if _, err := loader.LoadSync(server.URL); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the load to be cancelled, got %v", err)
+	}
+	if loader.cache.Get(server.URL) != nil {
+		t.Error("Expected the cancelled load not to be cached")
+	}
+
+	loader.SetContext(context.Background())
+	if data, err := loader.LoadSync(server.URL); err != nil || data.State != StateLoaded {
+		t.Errorf("Expected the image to load on the next page, got %+v, %v", data, err)
+	}
+}
+
+func TestLoadsThroughInterceptors(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+	nc := net.NewNetworkContext()
+	nc.Add(net.Block(func(req *http.Request) bool { return req.URL.Host == "ads.example" }))
+	nc.Add(net.Mock(func(req *http.Request) *http.Response {
+		return net.NewMockResponse(req, http.StatusOK, "image/png", buf.Bytes())
+	}))
+
+	loader := NewLoader(10).(*loader)
+	loader.SetContext(net.WithNetworkContext(context.Background(), nc))
+	if data, err := loader.LoadSync("http://images.example/logo.png"); err != nil || data.Width != 4 {
+		t.Errorf("Expected the mocked image, got %+v, %v", data, err)
+	}
+	if _, err := loader.LoadSync("http://ads.example/banner.png"); !errors.Is(err, net.ErrBlocked) {
+		t.Errorf("Expected the image to be blocked, got %v", err)
+	}
+}
+
 func TestCaching(t *testing.T) {
 	tmpDir := t.TempDir()
 	testImagePath := filepath.Join(tmpDir, "test.png")
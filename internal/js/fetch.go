@@ -0,0 +1,154 @@
+package js
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/vyquocvu/goosie/internal/net"
+)
+
+// Fetcher sends the requests of fetch, checking them against the CORS and
+// Content-Security-Policy of the document whose policy ctx carries
+type Fetcher interface {
+	FetchFromScript(ctx context.Context, req net.ScriptRequest) (*net.Response, error)
+}
+
+// SetFetcher makes fetch send its requests with a fetcher instead of
+// answering them with mock responses
+func (r *Runtime) SetFetcher(fetcher Fetcher) {
+	r.fetcher = fetcher
+}
+
+// SetLoadContext sets the context fetch requests are made under, which
+// carries the document's policy and is cancelled when the page goes away
+func (r *Runtime) SetLoadContext(ctx context.Context) {
+	r.loadCtx = ctx
+}
+
+// fetch sends a request with the fetcher and returns a promise of its
+// response. The request is sent on its own goroutine, and the promise is
+// settled once the script that called fetch has finished, as a task of the
+// runtime's event loop. Failures, such as requests blocked by CORS, reject
+// the promise with a TypeError and are logged to the console. Responses that
+// arrive after the load context is cancelled are dropped.
+func (r *Runtime) fetch(call goja.FunctionCall) goja.Value {
+	promise, resolve, reject := r.vm.NewPromise()
+	req, err := r.scriptRequest(call)
+	if err != nil {
+		reject(r.vm.NewTypeError(err.Error()))
+		return r.vm.ToValue(promise)
+	}
+
+	ctx := r.loadCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	r.fetches.Add(1)
+	go func() {
+		defer r.fetches.Done()
+		resp, err := r.fetcher.FetchFromScript(ctx, req)
+
+		r.loop.Lock()
+		defer r.loop.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			r.addConsoleMessage("error", fmt.Sprintf("Failed to fetch %s: %v", req.URL, err), nil)
+			reject(r.vm.NewTypeError("Failed to fetch"))
+			return
+		}
+		resolve(r.newFetchResponse(resp))
+	}()
+	return r.vm.ToValue(promise)
+}
+
+// WaitForFetches waits until the promises of the fetch requests sent so far,
+// and of those sent by their callbacks, are settled
+func (r *Runtime) WaitForFetches() {
+	r.fetches.Wait()
+}
+
+// scriptRequest reads the URL and init options of a fetch call
+func (r *Runtime) scriptRequest(call goja.FunctionCall) (net.ScriptRequest, error) {
+	req := net.ScriptRequest{URL: call.Argument(0).String(), Header: http.Header{}}
+	if r.documentURL != nil {
+		resolved, err := r.documentURL.Parse(req.URL)
+		if err != nil {
+			return req, fmt.Errorf("failed to parse URL from %s", req.URL)
+		}
+		req.URL = resolved.String()
+	}
+
+	init, ok := call.Argument(1).(*goja.Object)
+	if !ok {
+		return req, nil
+	}
+	if method := init.Get("method"); method != nil && !goja.IsUndefined(method) {
+		req.Method = method.String()
+	}
+	if headers, ok := init.Get("headers").(*goja.Object); ok {
+		for _, name := range headers.Keys() {
+			req.Header.Add(name, headers.Get(name).String())
+		}
+	}
+	if body := init.Get("body"); body != nil && !goja.IsUndefined(body) && !goja.IsNull(body) {
+		if req.Method == "" || strings.EqualFold(req.Method, http.MethodGet) || strings.EqualFold(req.Method, http.MethodHead) {
+			return req, fmt.Errorf("request with GET/HEAD method cannot have body")
+		}
+		req.Body = []byte(body.String())
+		if req.Header.Get("Content-Type") == "" {
+			req.Header.Set("Content-Type", "text/plain;charset=UTF-8")
+		}
+	}
+	if credentials := init.Get("credentials"); credentials != nil && !goja.IsUndefined(credentials) {
+		req.Credentials = net.ParseCredentialsMode(credentials.String())
+	}
+	return req, nil
+}
+
+// newFetchResponse creates the Response object of a fetched response
+func (r *Runtime) newFetchResponse(resp *net.Response) *goja.Object {
+	response := r.vm.NewObject()
+	response.Set("ok", resp.OK())
+	response.Set("status", resp.StatusCode)
+	response.Set("statusText", strings.TrimSpace(strings.TrimPrefix(resp.Status, fmt.Sprint(resp.StatusCode))))
+	response.Set("url", resp.URL)
+
+	headers := r.vm.NewObject()
+	headers.Set("get", func(name string) goja.Value {
+		if values := resp.Header.Values(name); len(values) > 0 {
+			return r.vm.ToValue(strings.Join(values, ", "))
+		}
+		return goja.Null()
+	})
+	headers.Set("has", func(name string) bool {
+		return len(resp.Header.Values(name)) > 0
+	})
+	response.Set("headers", headers)
+
+	response.Set("text", func() *goja.Promise {
+		promise, resolve, _ := r.vm.NewPromise()
+		resolve(resp.Text)
+		return promise
+	})
+	response.Set("json", func() *goja.Promise {
+		promise, resolve, reject := r.vm.NewPromise()
+		parse, _ := goja.AssertFunction(r.vm.Get("JSON").ToObject(r.vm).Get("parse"))
+		value, err := parse(goja.Undefined(), r.vm.ToValue(resp.Text))
+		if err != nil {
+			if exception, ok := err.(*goja.Exception); ok {
+				reject(exception.Value())
+			} else {
+				reject(r.vm.NewTypeError(err.Error()))
+			}
+		} else {
+			resolve(value)
+		}
+		return promise
+	})
+	return response
+}
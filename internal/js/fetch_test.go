@@ -0,0 +1,107 @@
+package js
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/vyquocvu/goosie/internal/net"
+)
+
+func TestFetchWithFetcher(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"secret": true}`))
+	}))
+	defer api.Close()
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Method", r.Method)
+		w.Write([]byte(`{"name": "goosie"}`))
+	}))
+	defer site.Close()
+
+	page, _ := url.Parse(site.URL + "/page")
+	runtime := NewRuntime()
+	runtime.SetOutput(&strings.Builder{})
+	runtime.SetFetcher(net.NewFetcherWith(nil, nil))
+	runtime.SetLoadContext(net.WithDocumentPolicy(context.Background(), net.NewDocumentPolicy(page, nil)))
+	if err := runtime.SetDocumentURL(page.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := runtime.RunScript(`
+var result = {};
+fetch("/data", {method: "POST", body: "x"})
+	.then(function(response) {
+		result.status = response.status;
+		result.method = response.headers.get("X-Method");
+		return response.json();
+	})
+	.then(function(data) { result.name = data.name; });
+fetch("` + api.URL + `/secret")
+	.then(function() { result.cors = "allowed"; })
+	.catch(function(err) { result.cors = err instanceof TypeError ? err.message : "other"; });
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runtime.WaitForFetches()
+	val, err := runtime.RunScript(`[result.status, result.method, result.name, result.cors].join(" ")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.String() != "200 POST goosie Failed to fetch" {
+		t.Errorf("Unexpected fetch results: %s", val)
+	}
+
+	var logged bool
+	for _, message := range runtime.GetConsoleMessages() {
+		if message.Level == "error" && strings.Contains(message.Message, "blocked by CORS policy") {
+			logged = true
+		}
+	}
+	if !logged {
+		t.Errorf("Expected the CORS error in the console, got %v", runtime.GetConsoleMessages())
+	}
+}
+
+func TestFetchDoesNotBlockScripts(t *testing.T) {
+	release := make(chan struct{})
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("late"))
+	}))
+	defer site.Close()
+
+	page, _ := url.Parse(site.URL + "/page")
+	runtime := NewRuntime()
+	runtime.SetOutput(&strings.Builder{})
+	runtime.SetFetcher(net.NewFetcherWith(nil, nil))
+	runtime.SetLoadContext(net.WithDocumentPolicy(context.Background(), net.NewDocumentPolicy(page, nil)))
+	if err := runtime.SetDocumentURL(page.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := runtime.RunScript(`
+var body = "pending";
+fetch("/slow")
+	.then(function(response) { return response.text(); })
+	.then(function(text) { body = text; });
+body;
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.String() != "pending" {
+		t.Errorf("Expected the script to finish before the response, got %s", val)
+	}
+
+	close(release)
+	runtime.WaitForFetches()
+	if val, _ := runtime.RunScript(`body`); val.String() != "late" {
+		t.Errorf("Expected the response to settle the promise, got %s", val)
+	}
+}
@@ -1,8 +1,11 @@
 package js
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"net/url"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -42,6 +45,13 @@ const (
 	tableMapValueTruncate   = 17
 )
 
+// CookieStore holds the cookies document.cookie reads and writes for the
+// URL of the document
+type CookieStore interface {
+	CookieString(u *url.URL) string
+	SetCookieString(u *url.URL, cookie string)
+}
+
 // Runtime wraps the Goja JavaScript runtime
 type Runtime struct {
 	vm         *goja.Runtime
@@ -62,6 +72,18 @@ type Runtime struct {
 	// JavaScript errors
 	jsErrors        []string
 	jsErrorsMu      sync.Mutex
+	// Where console output and diagnostics are printed
+	output          io.Writer
+	// Cookies of the document, which document.cookie needs its URL for
+	cookies         CookieStore
+	documentURL     *url.URL
+	// Where fetch sends requests; a mock responds without one
+	fetcher         Fetcher
+	loadCtx         context.Context
+	fetches         sync.WaitGroup
+	// Held while JavaScript runs, so scripts, event listeners, timer
+	// callbacks and fetch responses run one at a time, as tasks of an event loop
+	loop            sync.Mutex
 }
 
 // NewRuntime creates a new JavaScript runtime with console.log and document APIs
@@ -81,6 +103,7 @@ func NewRuntime() *Runtime {
 		historyIndex:    -1,
 		consoleMessages: make([]ConsoleMessage, 0),
 		jsErrors:        make([]string, 0),
+		output:          os.Stdout,
 	}
 
 	// Setup enhanced console API
@@ -110,29 +133,7 @@ func (r *Runtime) setupConsoleAPI() {
 	
 	// Helper function to log a console message
 	logMessage := func(level string, args []goja.Value, data interface{}) {
-		message := formatArgs(args)
-		r.consoleMu.Lock()
-		r.consoleMessages = append(r.consoleMessages, ConsoleMessage{
-			Level:     level,
-			Message:   message,
-			Timestamp: time.Now(),
-			Data:      data,
-		})
-		r.consoleMu.Unlock()
-		
-		// Also print to stdout with level prefix
-		prefix := ""
-		switch level {
-		case "error":
-			prefix = "[ERROR] "
-		case "warn":
-			prefix = "[WARN] "
-		case "info":
-			prefix = "[INFO] "
-		case "table":
-			prefix = "[TABLE] "
-		}
-		fmt.Println(prefix + message)
+		r.addConsoleMessage(level, formatArgs(args), data)
 	}
 	
 	// console.log
@@ -332,6 +333,21 @@ func (r *Runtime) setupDocumentAPI() {
 		return obj
 	})
 	
+	// document.cookie, empty until there is a cookie store and a document URL
+	getCookie := func(call goja.FunctionCall) goja.Value {
+		if r.cookies == nil || r.documentURL == nil {
+			return r.vm.ToValue("")
+		}
+		return r.vm.ToValue(r.cookies.CookieString(r.documentURL))
+	}
+	setCookie := func(call goja.FunctionCall) goja.Value {
+		if r.cookies != nil && r.documentURL != nil && len(call.Arguments) > 0 {
+			r.cookies.SetCookieString(r.documentURL, call.Arguments[0].String())
+		}
+		return goja.Undefined()
+	}
+	document.DefineAccessorProperty("cookie", r.vm.ToValue(getCookie), r.vm.ToValue(setCookie), goja.FLAG_FALSE, goja.FLAG_TRUE)
+	
 	r.vm.Set("document", document)
 }
 
@@ -369,7 +385,7 @@ func (r *Runtime) createElementObject(id, textContent, tagName string, elem *dom
 	
 	// Add manipulation methods
 	r.addManipulationMethods(obj)
-	r.addEventMethods(obj)
+	r.addEventMethods(obj, elementKey(obj, elem))
 	
 	return obj
 }
@@ -534,8 +550,9 @@ func (r *Runtime) addManipulationMethods(obj *goja.Object) {
 	})
 }
 
-// addEventMethods adds event listener methods to an element object
-func (r *Runtime) addEventMethods(obj *goja.Object) {
+// addEventMethods adds event listener methods to an element object whose
+// listeners are stored under key
+func (r *Runtime) addEventMethods(obj *goja.Object, key string) {
 	// addEventListener
 	obj.Set("addEventListener", func(call goja.FunctionCall) goja.Value {
 		if len(call.Arguments) < 2 {
@@ -549,8 +566,8 @@ func (r *Runtime) addEventMethods(obj *goja.Object) {
 		}
 		
 		// Store the listener
-		key := fmt.Sprintf("%p:%s", obj, eventType)
-		r.eventListeners[key] = append(r.eventListeners[key], callback)
+		listenersKey := key + ":" + eventType
+		r.eventListeners[listenersKey] = append(r.eventListeners[listenersKey], callback)
 		
 		return goja.Undefined()
 	})
@@ -565,43 +582,199 @@ func (r *Runtime) addEventMethods(obj *goja.Object) {
 		
 		// Clear all listeners for this event type (simplified implementation)
 		// In a full implementation, we'd need to track function identity
-		key := fmt.Sprintf("%p:%s", obj, eventType)
-		r.eventListeners[key] = make([]goja.Callable, 0)
+		r.eventListeners[key+":"+eventType] = make([]goja.Callable, 0)
 		
 		return goja.Undefined()
 	})
 }
 
+// elementKey returns the key the event listeners of an element object are
+// stored under. Document elements are keyed by their position in the
+// document, so every lookup of an element, with or without an ID, shares its
+// listeners and events dispatched to the element reach them.
+func elementKey(obj *goja.Object, elem *dom.Element) string {
+	if elem != nil {
+		return fmt.Sprintf("@%d", elem.Index)
+	}
+	if id := obj.Get("id"); id != nil && !goja.IsUndefined(id) && id.String() != "" {
+		return "#" + id.String()
+	}
+	return fmt.Sprintf("%p", obj)
+}
+
+// DispatchEvent calls the listeners of an event type added to the element
+// with the given ID, in the order they were added. Listeners receive an event
+// object with the type, the target element, and the given properties.
+// Errors thrown by listeners are recorded like script errors. It returns the
+// number of listeners called.
+func (r *Runtime) DispatchEvent(elementID, eventType string, properties map[string]interface{}) int {
+	r.loop.Lock()
+	defer r.loop.Unlock()
+	var element *dom.Element
+	if r.htmlCache != "" {
+		element, _ = r.parser.GetElementByIDFull(r.htmlCache, elementID)
+	}
+	if element == nil {
+		target := r.vm.NewObject()
+		target.Set("id", elementID)
+		return r.dispatch("#"+elementID, target, eventType, properties)
+	}
+	return r.dispatchElementEvent(element.Index, eventType, properties)
+}
+
+// DispatchElementEvent is DispatchEvent for the element at a position among
+// the document's elements in tree order (see dom.ElementIndex), for elements
+// without an ID
+func (r *Runtime) DispatchElementEvent(index int, eventType string, properties map[string]interface{}) int {
+	r.loop.Lock()
+	defer r.loop.Unlock()
+	return r.dispatchElementEvent(index, eventType, properties)
+}
+
+func (r *Runtime) dispatchElementEvent(index int, eventType string, properties map[string]interface{}) int {
+	if r.htmlCache == "" {
+		return 0
+	}
+	element, err := r.parser.GetElementByIndex(r.htmlCache, index)
+	if err != nil || element == nil {
+		return 0
+	}
+	target := r.createElementObject(element.ID, element.TextContent, element.TagName, element)
+	return r.dispatch(fmt.Sprintf("@%d", index), target, eventType, properties)
+}
+
+// dispatch calls the listeners stored under an element key with an event
+func (r *Runtime) dispatch(key string, target goja.Value, eventType string, properties map[string]interface{}) int {
+	listeners := r.eventListeners[key+":"+eventType]
+	if len(listeners) == 0 {
+		return 0
+	}
+	
+	event := r.vm.NewObject()
+	event.Set("type", eventType)
+	event.Set("target", target)
+	for name, value := range properties {
+		event.Set(name, value)
+	}
+	
+	for _, listener := range listeners {
+		if _, err := listener(goja.Undefined(), event); err != nil {
+			r.recordError(fmt.Sprintf("JavaScript Error: %v", err))
+		}
+	}
+	return len(listeners)
+}
+
 // SetHTMLContent sets the HTML content for document operations
 func (r *Runtime) SetHTMLContent(html string) {
+	r.loop.Lock()
+	defer r.loop.Unlock()
 	r.htmlCache = html
 }
 
+// SetOutput sets where console messages and diagnostics are printed
+// (standard output by default)
+func (r *Runtime) SetOutput(w io.Writer) {
+	r.output = w
+}
+
+// SetCookieStore sets the store behind document.cookie
+func (r *Runtime) SetCookieStore(store CookieStore) {
+	r.cookies = store
+}
+
+// SetDocumentURL sets the URL of the document, whose cookies document.cookie
+// reads and writes
+func (r *Runtime) SetDocumentURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid document URL: %w", err)
+	}
+	r.documentURL = parsed
+	return nil
+}
+
+// HTMLContent returns the HTML content used for document operations
+func (r *Runtime) HTMLContent() string {
+	r.loop.Lock()
+	defer r.loop.Unlock()
+	return r.htmlCache
+}
+
+// Interrupt stops the script that is running, which then fails with an
+// interrupted error; scripts run after that are interrupted immediately
+// until ClearInterrupt is called
+func (r *Runtime) Interrupt(reason string) {
+	r.vm.Interrupt(reason)
+}
+
+// ClearInterrupt lets scripts run again after Interrupt
+func (r *Runtime) ClearInterrupt() {
+	r.vm.ClearInterrupt()
+}
+
 // RunScript executes JavaScript code and catches errors
 func (r *Runtime) RunScript(script string) (goja.Value, error) {
+	r.loop.Lock()
+	defer r.loop.Unlock()
 	val, err := r.vm.RunString(script)
 	if err != nil {
-		// Log JavaScript error
-		errorMsg := fmt.Sprintf("JavaScript Error: %v", err)
-		r.jsErrorsMu.Lock()
-		r.jsErrors = append(r.jsErrors, errorMsg)
-		r.jsErrorsMu.Unlock()
-		
-		// Also add to console as an error
-		r.consoleMu.Lock()
-		r.consoleMessages = append(r.consoleMessages, ConsoleMessage{
-			Level:     "error",
-			Message:   errorMsg,
-			Timestamp: time.Now(),
-			Data:      nil,
-		})
-		r.consoleMu.Unlock()
-		
-		fmt.Println("[JS ERROR]", errorMsg)
+		r.recordError(fmt.Sprintf("JavaScript Error: %v", err))
 	}
 	return val, err
 }
 
+// LogMessage adds a message of the browser to the console, such as a
+// Content-Security-Policy violation of the page
+func (r *Runtime) LogMessage(level, message string) {
+	r.addConsoleMessage(level, message, nil)
+}
+
+// addConsoleMessage records a console message and prints it with its level
+func (r *Runtime) addConsoleMessage(level, message string, data interface{}) {
+	r.consoleMu.Lock()
+	r.consoleMessages = append(r.consoleMessages, ConsoleMessage{
+		Level:     level,
+		Message:   message,
+		Timestamp: time.Now(),
+		Data:      data,
+	})
+	r.consoleMu.Unlock()
+	
+	// Also print to stdout with level prefix
+	prefix := ""
+	switch level {
+	case "error":
+		prefix = "[ERROR] "
+	case "warn":
+		prefix = "[WARN] "
+	case "info":
+		prefix = "[INFO] "
+	case "table":
+		prefix = "[TABLE] "
+	}
+	fmt.Fprintln(r.output, prefix + message)
+}
+
+// recordError logs a JavaScript error and adds it to the console
+func (r *Runtime) recordError(errorMsg string) {
+	r.jsErrorsMu.Lock()
+	r.jsErrors = append(r.jsErrors, errorMsg)
+	r.jsErrorsMu.Unlock()
+	
+	// Also add to console as an error
+	r.consoleMu.Lock()
+	r.consoleMessages = append(r.consoleMessages, ConsoleMessage{
+		Level:     "error",
+		Message:   errorMsg,
+		Timestamp: time.Now(),
+		Data:      nil,
+	})
+	r.consoleMu.Unlock()
+	
+	fmt.Fprintln(r.output, "[JS ERROR]", errorMsg)
+}
+
 // GetConsoleMessages returns all console messages
 func (r *Runtime) GetConsoleMessages() []ConsoleMessage {
 	r.consoleMu.Lock()
@@ -696,7 +869,7 @@ func (r *Runtime) setupLocationAPI(window *goja.Object) {
 	location.Set("reload", func(call goja.FunctionCall) goja.Value {
 		// In a real browser this would reload the page
 		// For now, we just log the action
-		fmt.Println("Location reload called")
+		fmt.Fprintln(r.output, "Location reload called")
 		return goja.Undefined()
 	})
 	
@@ -816,7 +989,7 @@ func (r *Runtime) setupHistoryAPI(window *goja.Object) {
 	history.Set("back", func(call goja.FunctionCall) goja.Value {
 		if r.historyIndex > 0 {
 			r.historyIndex--
-			fmt.Printf("History: navigated back to index %d\n", r.historyIndex)
+			fmt.Fprintf(r.output, "History: navigated back to index %d\n", r.historyIndex)
 		}
 		return goja.Undefined()
 	})
@@ -825,7 +998,7 @@ func (r *Runtime) setupHistoryAPI(window *goja.Object) {
 	history.Set("forward", func(call goja.FunctionCall) goja.Value {
 		if r.historyIndex < len(r.historyStack)-1 {
 			r.historyIndex++
-			fmt.Printf("History: navigated forward to index %d\n", r.historyIndex)
+			fmt.Fprintf(r.output, "History: navigated forward to index %d\n", r.historyIndex)
 		}
 		return goja.Undefined()
 	})
@@ -841,7 +1014,7 @@ func (r *Runtime) setupHistoryAPI(window *goja.Object) {
 		
 		if newIndex >= 0 && newIndex < len(r.historyStack) {
 			r.historyIndex = newIndex
-			fmt.Printf("History: navigated to index %d\n", r.historyIndex)
+			fmt.Fprintf(r.output, "History: navigated to index %d\n", r.historyIndex)
 		}
 		
 		return goja.Undefined()
@@ -916,7 +1089,7 @@ func (r *Runtime) setupLocalStorageAPI() {
 		
 		// Basic validation: check key and value are not empty
 		if key == "" {
-			fmt.Println("localStorage: key cannot be empty")
+			fmt.Fprintln(r.output, "localStorage: key cannot be empty")
 			return goja.Undefined()
 		}
 		
@@ -1010,7 +1183,7 @@ func (r *Runtime) setupSessionStorageAPI() {
 		
 		// Basic validation
 		if key == "" {
-			fmt.Println("sessionStorage: key cannot be empty")
+			fmt.Fprintln(r.output, "sessionStorage: key cannot be empty")
 			return goja.Undefined()
 		}
 		
@@ -1093,6 +1266,8 @@ func (r *Runtime) setupTimerAPIs() {
 		}
 		
 		timer.Timer = time.AfterFunc(delay, func() {
+			r.loop.Lock()
+			defer r.loop.Unlock()
 			timer.mu.Lock()
 			defer timer.mu.Unlock()
 			
@@ -1166,9 +1341,13 @@ func (r *Runtime) setupTimerAPIs() {
 				case <-timer.Cancel:
 					return
 				case <-timer.Ticker.C:
+					r.loop.Lock()
 					timer.mu.Lock()
-					callback(goja.Undefined())
+					if !timer.stopped {
+						callback(goja.Undefined())
+					}
 					timer.mu.Unlock()
+					r.loop.Unlock()
 				}
 			}
 		}()
@@ -1209,6 +1388,9 @@ func (r *Runtime) setupFetchAPI() {
 		if len(call.Arguments) == 0 {
 			return r.vm.ToValue(r.createRejectedPromise("fetch requires a URL"))
 		}
+		if r.fetcher != nil {
+			return r.fetch(call)
+		}
 		
 		urlStr := call.Arguments[0].String()
 		
@@ -1227,7 +1409,12 @@ func (r *Runtime) setupFetchAPI() {
 			}
 			
 			// Simulate async fetch (in real implementation, would use net/http)
+			r.fetches.Add(1)
 			go func() {
+				defer r.fetches.Done()
+				r.loop.Lock()
+				defer r.loop.Unlock()
+				
 				// Create response object
 				response := r.vm.NewObject()
 				response.Set("ok", true)
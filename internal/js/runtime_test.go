@@ -1,6 +1,8 @@
 package js
 
 import (
+	"io"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
@@ -66,6 +68,9 @@ func TestSetHTMLContent(t *testing.T) {
 	if runtime.htmlCache != html {
 		t.Errorf("SetHTMLContent() did not set htmlCache correctly")
 	}
+	if runtime.HTMLContent() != html {
+		t.Errorf("HTMLContent() = %q, want %q", runtime.HTMLContent(), html)
+	}
 }
 
 func TestRunScript(t *testing.T) {
@@ -354,6 +359,45 @@ func TestRemoveEventListener(t *testing.T) {
 	}
 }
 
+func TestDispatchEvent(t *testing.T) {
+	runtime := NewRuntime()
+	runtime.SetOutput(io.Discard)
+	
+	html := `<html><body><div id="box">Box</div></body></html>`
+	runtime.SetHTMLContent(html)
+	
+	_, err := runtime.RunScript(`
+		var ended = [];
+		document.getElementById("box").addEventListener("transitionend", function(e) {
+			ended.push(e.type + ":" + e.target.id + ":" + e.propertyName + ":" + e.elapsedTime);
+		});
+		document.getElementById("box").addEventListener("animationend", function(e) {
+			throw new Error("listener failed");
+		});
+	`)
+	if err != nil {
+		t.Fatalf("Failed to add listeners: %v", err)
+	}
+	
+	// Listeners added through another lookup of the element still receive events
+	called := runtime.DispatchEvent("box", "transitionend", map[string]interface{}{"propertyName": "opacity", "elapsedTime": 0.5})
+	if called != 1 {
+		t.Errorf("Expected 1 listener called, got %d", called)
+	}
+	value, _ := runtime.RunScript(`ended.join(",")`)
+	if value.String() != "transitionend:box:opacity:0.5" {
+		t.Errorf("Expected the event passed to the listener, got %q", value.String())
+	}
+	
+	if called := runtime.DispatchEvent("other", "transitionend", nil); called != 0 {
+		t.Errorf("Expected no listeners for another element, got %d", called)
+	}
+	runtime.DispatchEvent("box", "animationend", nil)
+	if errors := runtime.GetJavaScriptErrors(); len(errors) != 1 || !strings.Contains(errors[0], "listener failed") {
+		t.Errorf("Expected the listener error recorded, got %v", errors)
+	}
+}
+
 func TestElementProperties(t *testing.T) {
 	runtime := NewRuntime()
 	
@@ -1073,3 +1117,97 @@ func TestClearJavaScriptErrors(t *testing.T) {
 	}
 }
 
+
+func TestInterruptScript(t *testing.T) {
+	runtime := NewRuntime()
+	
+	timer := time.AfterFunc(50*time.Millisecond, func() {
+		runtime.Interrupt("timeout")
+	})
+	defer timer.Stop()
+	
+	_, err := runtime.RunScript(`while (true) {}`)
+	if err == nil {
+		t.Fatal("Expected an interrupted script to fail")
+	}
+	if !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("Expected the interrupt reason in the error, got %v", err)
+	}
+	
+	runtime.ClearInterrupt()
+	val, err := runtime.RunScript(`1 + 1`)
+	if err != nil || val.ToInteger() != 2 {
+		t.Errorf("Expected scripts to run after ClearInterrupt, got %v, %v", val, err)
+	}
+}
+
+// fakeCookieStore records document.cookie writes by document URL
+type fakeCookieStore map[string][]string
+
+func (s fakeCookieStore) CookieString(u *url.URL) string {
+	return strings.Join(s[u.String()], "; ")
+}
+
+func (s fakeCookieStore) SetCookieString(u *url.URL, cookie string) {
+	s[u.String()] = append(s[u.String()], strings.Split(cookie, ";")[0])
+}
+
+func TestDocumentCookie(t *testing.T) {
+	runtime := NewRuntime()
+	
+	// Without a store and a document URL there are no cookies
+	val, err := runtime.RunScript(`document.cookie = "a=1"; document.cookie`)
+	if err != nil || val.String() != "" {
+		t.Errorf("Expected an empty document.cookie, got %v, %v", val, err)
+	}
+	
+	store := fakeCookieStore{}
+	runtime.SetCookieStore(store)
+	if err := runtime.SetDocumentURL("https://example.com/page"); err != nil {
+		t.Fatal(err)
+	}
+	val, err = runtime.RunScript(`
+		document.cookie = "theme=dark; path=/";
+		document.cookie = "lang=en";
+		document.cookie;
+	`)
+	if err != nil || val.String() != "theme=dark; lang=en" {
+		t.Errorf("Expected the cookies written for the document, got %v, %v", val, err)
+	}
+	if len(store["https://example.com/page"]) != 2 {
+		t.Errorf("Expected the cookies to reach the store, got %v", store)
+	}
+}
+
+func TestDispatchElementEvent(t *testing.T) {
+	runtime := NewRuntime()
+	runtime.SetOutput(io.Discard)
+	
+	html := `<html><body><div class="box">First</div><div class="box">Second</div></body></html>`
+	runtime.SetHTMLContent(html)
+	
+	_, err := runtime.RunScript(`
+		var ended = [];
+		document.querySelectorAll(".box").forEach(function(box) {
+			box.addEventListener("animationend", function(e) {
+				ended.push(e.target.textContent + ":" + e.animationName);
+			});
+		});
+	`)
+	if err != nil {
+		t.Fatalf("Failed to add listeners: %v", err)
+	}
+	
+	// Elements without an ID are found by their position in the document:
+	// html, head, body, first box, second box
+	if called := runtime.DispatchElementEvent(4, "animationend", map[string]interface{}{"animationName": "fade"}); called != 1 {
+		t.Errorf("Expected 1 listener called, got %d", called)
+	}
+	value, _ := runtime.RunScript(`ended.join(",")`)
+	if value.String() != "Second:fade" {
+		t.Errorf("Expected the event delivered to the second box only, got %q", value.String())
+	}
+	if called := runtime.DispatchElementEvent(2, "animationend", nil); called != 0 {
+		t.Errorf("Expected no listeners on the body, got %d", called)
+	}
+}
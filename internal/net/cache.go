@@ -0,0 +1,784 @@
+package net
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultCacheMemory is the memory limit of DefaultCache
+	defaultCacheMemory = 50 << 20
+	// maxHeuristicFreshness caps the freshness guessed from Last-Modified
+	maxHeuristicFreshness = 7 * 24 * time.Hour
+	// cacheFileSuffix names the files of a disk cache
+	cacheFileSuffix = ".entry"
+)
+
+// DefaultCache is the HTTP cache shared by fetchers and image loaders that
+// are not given their own. Replace it before creating them to use a disk
+// cache.
+var DefaultCache = NewCache(defaultCacheMemory)
+
+// CacheMode says how a request uses the HTTP cache, like the cache mode of
+// the Fetch standard
+type CacheMode int
+
+const (
+	// CacheDefault serves fresh responses from the cache and revalidates stale ones
+	CacheDefault CacheMode = iota
+	// CacheHistory serves stored responses even when stale, for back and
+	// forward navigations
+	CacheHistory
+	// CacheRevalidate revalidates stored responses with the server, for reloads
+	CacheRevalidate
+	// CacheBypass neither reads nor writes the cache
+	CacheBypass
+)
+
+type cacheModeKey struct{}
+
+// WithCacheMode returns a context whose requests use the cache with the given mode
+func WithCacheMode(ctx context.Context, mode CacheMode) context.Context {
+	return context.WithValue(ctx, cacheModeKey{}, mode)
+}
+
+// cacheModeFrom returns the cache mode of a request context
+func cacheModeFrom(ctx context.Context) CacheMode {
+	mode, _ := ctx.Value(cacheModeKey{}).(CacheMode)
+	return mode
+}
+
+// heuristicallyCacheable are the status codes that may be stored without
+// explicit freshness (RFC 9110, section 15.1)
+var heuristicallyCacheable = map[int]bool{
+	200: true, 203: true, 204: true, 300: true, 301: true, 308: true,
+	404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+// cacheControl holds the directives of Cache-Control headers
+type cacheControl map[string]string
+
+// parseCacheControl parses the Cache-Control headers of a request or response
+func parseCacheControl(header http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				cc[name] = strings.Trim(strings.TrimSpace(arg), `"`)
+			}
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+// seconds returns the delta-seconds argument of a directive
+func (cc cacheControl) seconds(name string) (time.Duration, bool) {
+	arg, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// cacheEntry is a stored response. Entries are replaced rather than
+// modified, except for body, which is dropped from memory when the entry is
+// also on disk.
+type cacheEntry struct {
+	key          string
+	url          string
+	status       int
+	header       http.Header
+	vary         http.Header // Request header values the response varies on
+	requestTime  time.Time
+	responseTime time.Time
+	size         int64
+	body         []byte // Nil when only on disk
+	stored       bool   // Written to the cache directory
+	element      *list.Element
+}
+
+// date returns the Date of the response, or when it was received
+func (e *cacheEntry) date() time.Time {
+	if t, err := http.ParseTime(e.header.Get("Date")); err == nil {
+		return t
+	}
+	return e.responseTime
+}
+
+// freshnessLifetime returns how long the response is fresh (RFC 9111,
+// section 4.2.1)
+func (e *cacheEntry) freshnessLifetime() time.Duration {
+	cc := parseCacheControl(e.header)
+	if maxAge, ok := cc.seconds("max-age"); ok {
+		return maxAge
+	}
+	if expires := e.header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			// Invalid dates, such as 0, mean already expired
+			return 0
+		}
+		return t.Sub(e.date())
+	}
+	if lastModified, err := http.ParseTime(e.header.Get("Last-Modified")); err == nil && (heuristicallyCacheable[e.status] || cc.has("public")) {
+		return min(e.date().Sub(lastModified)/10, maxHeuristicFreshness)
+	}
+	return 0
+}
+
+// age returns the current age of the response (RFC 9111, section 4.2.3)
+func (e *cacheEntry) age(now time.Time) time.Duration {
+	apparentAge := max(0, e.responseTime.Sub(e.date()))
+	ageValue, _ := strconv.ParseInt(e.header.Get("Age"), 10, 64)
+	correctedAge := time.Duration(ageValue)*time.Second + e.responseTime.Sub(e.requestTime)
+	return max(apparentAge, correctedAge) + now.Sub(e.responseTime)
+}
+
+// satisfies reports whether the entry may answer a request without
+// revalidation, given the request's Cache-Control directives
+func (e *cacheEntry) satisfies(requestCC cacheControl, now time.Time) bool {
+	cc := parseCacheControl(e.header)
+	if cc.has("no-cache") {
+		return false
+	}
+	age, lifetime := e.age(now), e.freshnessLifetime()
+	if maxAge, ok := requestCC.seconds("max-age"); ok && age > maxAge {
+		return false
+	}
+	if minFresh, ok := requestCC.seconds("min-fresh"); ok {
+		lifetime -= minFresh
+	}
+	if lifetime > age {
+		return true
+	}
+
+	// Stale responses are served only if the request accepts them
+	if cc.has("must-revalidate") || !requestCC.has("max-stale") {
+		return false
+	}
+	maxStale, ok := requestCC.seconds("max-stale")
+	return !ok && requestCC["max-stale"] == "" || ok && age-lifetime <= maxStale
+}
+
+// matches reports whether a request has the header values the entry varies on
+// An entry that varies on "*" matches no request.
+func (e *cacheEntry) matches(req *http.Request) bool {
+	for field, values := range e.vary {
+		if field == "*" {
+			return false
+		}
+		if strings.Join(req.Header.Values(field), ", ") != values[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// response builds the response served from the entry
+func (e *cacheEntry) response(req *http.Request, body []byte, now time.Time) *http.Response {
+	header := e.header.Clone()
+	header.Set("Age", strconv.FormatInt(int64(e.age(now)/time.Second), 10))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.status, http.StatusText(e.status)),
+		StatusCode:    e.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// varyValues returns the request header values named by a response's Vary header
+func varyValues(req *http.Request, header http.Header) http.Header {
+	vary := http.Header{}
+	for _, value := range header.Values("Vary") {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				vary.Set(field, strings.Join(req.Header.Values(field), ", "))
+			}
+		}
+	}
+	return vary
+}
+
+// varyAll reports whether a response's Vary header lists "*", alone or
+// among other fields, so it varies on more than request headers
+func varyAll(header http.Header) bool {
+	for _, value := range header.Values("Vary") {
+		for _, field := range strings.Split(value, ",") {
+			if strings.TrimSpace(field) == "*" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cacheKey identifies a response by its URL and the values it varies on
+func cacheKey(url string, vary http.Header) string {
+	fields := make([]string, 0, len(vary))
+	for field, values := range vary {
+		fields = append(fields, field+": "+values[0])
+	}
+	sort.Strings(fields)
+	return url + "\n" + strings.Join(fields, "\n")
+}
+
+// CacheEntryInfo describes a stored response
+type CacheEntryInfo struct {
+	URL        string
+	Status     int
+	Size       int64
+	Received   time.Time   // When the response was received
+	FreshUntil time.Time   // When the response becomes stale
+	Vary       http.Header // Request header values the response varies on
+	InMemory   bool
+	OnDisk     bool
+}
+
+// Cache is a private HTTP cache (RFC 9111). Response bodies are kept in
+// memory up to a size limit; a disk cache also writes them to a directory up
+// to its own limit, so they outlive the process. The least recently used
+// responses are evicted first.
+type Cache struct {
+	mu        sync.Mutex
+	dir       string
+	maxMemory int64
+	maxDisk   int64
+	memory    int64                    // Bytes of bodies held in memory
+	disk      int64                    // Bytes of bodies on disk
+	entries   map[string][]*cacheEntry // Variants by URL
+	lru       *list.List               // Most recently used first
+	now       func() time.Time
+}
+
+// NewCache creates an in-memory cache holding up to maxMemory bytes of
+// response bodies
+func NewCache(maxMemory int64) *Cache {
+	return &Cache{
+		maxMemory: maxMemory,
+		entries:   make(map[string][]*cacheEntry),
+		lru:       list.New(),
+		now:       time.Now,
+	}
+}
+
+// NewDiskCache creates a cache that also stores responses in dir, up to
+// maxDisk bytes, and loads the responses stored there by earlier sessions
+func NewDiskCache(dir string, maxMemory, maxDisk int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	c := NewCache(maxMemory)
+	c.dir, c.maxDisk = dir, maxDisk
+	var loaded []*cacheEntry
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), cacheFileSuffix) {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		entry, err := readCacheEntry(path)
+		if err != nil {
+			// Unreadable entries are dropped, as if evicted
+			os.Remove(path)
+			continue
+		}
+		loaded = append(loaded, entry)
+	}
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].responseTime.Before(loaded[j].responseTime) })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, entry := range loaded {
+		entry.element = c.lru.PushFront(entry)
+		c.entries[entry.url] = append(c.entries[entry.url], entry)
+		c.disk += entry.size
+	}
+	c.evict()
+	return c, nil
+}
+
+// Entries describes the stored responses, most recently used first
+func (c *Cache) Entries() []CacheEntryInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	infos := make([]CacheEntryInfo, 0, c.lru.Len())
+	for el := c.lru.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*cacheEntry)
+		infos = append(infos, CacheEntryInfo{
+			URL:        e.url,
+			Status:     e.status,
+			Size:       e.size,
+			Received:   e.responseTime,
+			FreshUntil: c.now().Add(e.freshnessLifetime() - e.age(c.now())),
+			Vary:       e.vary.Clone(),
+			InMemory:   e.body != nil,
+			OnDisk:     e.stored,
+		})
+	}
+	return infos
+}
+
+// Size returns the bytes of response bodies held in memory and on disk
+func (c *Cache) Size() (memory, disk int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.memory, c.disk
+}
+
+// Remove drops all stored responses of a URL
+func (c *Cache) Remove(url string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range c.entries[url] {
+		c.remove(e)
+	}
+}
+
+// Clear drops all stored responses, in memory and on disk
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for el := c.lru.Front(); el != nil; el = c.lru.Front() {
+		c.remove(el.Value.(*cacheEntry))
+	}
+}
+
+// lookup returns the entry answering a request and its body, loading the
+// body from disk when it is not in memory
+func (c *Cache) lookup(req *http.Request) (*cacheEntry, []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range c.entries[req.URL.String()] {
+		if !e.matches(req) {
+			continue
+		}
+		c.lru.MoveToFront(e.element)
+		if e.body == nil {
+			entry, body, err := readCacheFile(c.path(e.key))
+			if err != nil || entry.key != e.key {
+				c.remove(e)
+				return nil, nil
+			}
+			e.body = body
+			c.memory += e.size
+			c.evict()
+			return e, body
+		}
+		return e, e.body
+	}
+	return nil, nil
+}
+
+// store adds a response, replacing the stored response with the same key
+func (c *Cache) store(req *http.Request, resp *http.Response, body []byte, requestTime, responseTime time.Time) {
+	if body == nil {
+		// A nil body means the body is only on disk
+		body = []byte{}
+	}
+	vary := varyValues(req, resp.Header)
+	header := resp.Header.Clone()
+	// Cookies are stored by the cookie jar when the response arrives, never
+	// replayed from the cache
+	header.Del("Set-Cookie")
+	entry := &cacheEntry{
+		url:          req.URL.String(),
+		status:       resp.StatusCode,
+		header:       header,
+		vary:         vary,
+		requestTime:  requestTime,
+		responseTime: responseTime,
+		size:         int64(len(body)),
+		body:         body,
+	}
+	entry.key = cacheKey(entry.url, vary)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.insert(entry)
+}
+
+// refresh replaces an entry with one whose headers are updated from a 304
+// Not Modified response (RFC 9111, section 4.3.4)
+func (c *Cache) refresh(e *cacheEntry, body []byte, header http.Header, requestTime, responseTime time.Time) *cacheEntry {
+	updated := *e
+	updated.header = e.header.Clone()
+	for field, values := range header {
+		if field != "Content-Length" && field != "Set-Cookie" {
+			updated.header[field] = values
+		}
+	}
+	updated.requestTime, updated.responseTime = requestTime, responseTime
+	updated.body, updated.stored, updated.element = body, false, nil
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.insert(&updated)
+	return &updated
+}
+
+// insert adds an entry as the most recently used one, writing it to disk
+func (c *Cache) insert(entry *cacheEntry) {
+	variants := c.entries[entry.url]
+	for _, e := range variants {
+		if e.key == entry.key {
+			c.remove(e)
+			break
+		}
+	}
+	if entry.size > c.maxMemory && (c.dir == "" || entry.size > c.maxDisk) {
+		return
+	}
+
+	entry.element = c.lru.PushFront(entry)
+	c.entries[entry.url] = append(c.entries[entry.url], entry)
+	c.memory += entry.size
+	if c.dir != "" && entry.size <= c.maxDisk {
+		if err := writeCacheFile(c.path(entry.key), entry); err == nil {
+			entry.stored = true
+			c.disk += entry.size
+		}
+	}
+	c.evict()
+}
+
+// remove drops an entry from memory and disk
+func (c *Cache) remove(e *cacheEntry) {
+	variants := c.entries[e.url]
+	for i, variant := range variants {
+		if variant == e {
+			variants = append(variants[:i], variants[i+1:]...)
+			break
+		}
+	}
+	if len(variants) == 0 {
+		delete(c.entries, e.url)
+	} else {
+		c.entries[e.url] = variants
+	}
+	c.lru.Remove(e.element)
+	if e.body != nil {
+		c.memory -= e.size
+		e.body = nil
+	}
+	if e.stored {
+		os.Remove(c.path(e.key))
+		c.disk -= e.size
+		e.stored = false
+	}
+}
+
+// evict drops the least recently used bodies from memory, keeping those on
+// disk, and the least recently used entries until both limits are met
+func (c *Cache) evict() {
+	for el := c.lru.Back(); el != nil && (c.memory > c.maxMemory || c.disk > c.maxDisk); {
+		prev := el.Prev()
+		e := el.Value.(*cacheEntry)
+		switch {
+		case c.disk > c.maxDisk || !e.stored:
+			c.remove(e)
+		case e.body != nil:
+			c.memory -= e.size
+			e.body = nil
+		}
+		el = prev
+	}
+}
+
+// path returns the file of an entry in the cache directory
+func (c *Cache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+cacheFileSuffix)
+}
+
+// cacheFileHeader is the first line of a cache file, followed by the body
+type cacheFileHeader struct {
+	URL          string      `json:"url"`
+	Status       int         `json:"status"`
+	Header       http.Header `json:"header"`
+	Vary         http.Header `json:"vary,omitempty"`
+	RequestTime  time.Time   `json:"requestTime"`
+	ResponseTime time.Time   `json:"responseTime"`
+}
+
+// writeCacheFile writes an entry and its body to a file
+func writeCacheFile(path string, e *cacheEntry) error {
+	line, err := json.Marshal(cacheFileHeader{
+		URL:          e.url,
+		Status:       e.status,
+		Header:       e.header,
+		Vary:         e.vary,
+		RequestTime:  e.requestTime,
+		ResponseTime: e.responseTime,
+	})
+	if err != nil {
+		return err
+	}
+	data := append(append(line, '\n'), e.body...)
+	return os.WriteFile(path, data, 0o600)
+}
+
+// readCacheEntry reads the entry of a cache file without its body
+func readCacheEntry(path string) (*cacheEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	entry, headerSize, err := readCacheFileHeader(bufio.NewReader(file))
+	if err != nil {
+		return nil, err
+	}
+	entry.size = info.Size() - headerSize
+	entry.stored = true
+	return entry, nil
+}
+
+// readCacheFile reads an entry and its body from a file
+func readCacheFile(path string) (*cacheEntry, []byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	entry, headerSize, err := readCacheFileHeader(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return nil, nil, err
+	}
+	return entry, data[headerSize:], nil
+}
+
+// readCacheFileHeader reads the first line of a cache file, returning the
+// entry it describes and the line's length
+func readCacheFileHeader(r *bufio.Reader) (*cacheEntry, int64, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, 0, fmt.Errorf("truncated cache file: %w", err)
+	}
+	var header cacheFileHeader
+	if err := json.Unmarshal(line, &header); err != nil {
+		return nil, 0, fmt.Errorf("invalid cache file: %w", err)
+	}
+	if header.Vary == nil {
+		header.Vary = http.Header{}
+	}
+	return &cacheEntry{
+		key:          cacheKey(header.URL, header.Vary),
+		url:          header.URL,
+		status:       header.Status,
+		header:       header.Header,
+		vary:         header.Vary,
+		requestTime:  header.RequestTime,
+		responseTime: header.ResponseTime,
+	}, int64(len(line)), nil
+}
+
+// CacheTransport is an http.RoundTripper answering GET requests from a
+// Cache and storing the responses of the wrapped transport in it
+type CacheTransport struct {
+	Cache     *Cache
+	Transport http.RoundTripper // DefaultTransport when nil
+}
+
+// NewCachingClient returns an HTTP client whose requests go through a
+// cache, or a plain client when the cache is nil
+func NewCachingClient(cache *Cache) *http.Client {
+	return NewClient(cache, nil)
+}
+
+// NewClient returns an HTTP client sending the cookies of a jar and going
+// through a cache; either may be nil. Cookies are added before the cache so
+// responses varying on Cookie are told apart. With DefaultRecorder set,
+// requests are recorded between the two, so that responses served from
+// the cache are recorded too. The interceptors of a request's network
+// context come first, so mocked and blocked requests reach neither the
+// jar nor the cache. Redirects are checked against the document policy of
+// the request's context.
+func NewClient(cache *Cache, jar *CookieJar) *http.Client {
+	var transport http.RoundTripper
+	if cache != nil {
+		transport = &CacheTransport{Cache: cache}
+	}
+	if DefaultRecorder != nil {
+		transport = DefaultRecorder.Transport(transport)
+	}
+	if transport == nil {
+		transport = networkTransport(nil)
+	}
+	if jar != nil {
+		transport = &CookieTransport{Jar: jar, Transport: transport}
+	}
+	return &http.Client{Transport: &InterceptTransport{Transport: transport}, CheckRedirect: checkRedirect}
+}
+
+// RoundTrip serves a request from the cache when a stored response may be
+// used, revalidates stale responses with their validators, and stores
+// cacheable responses once their body has been read
+func (t *CacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := networkTransport(t.Transport)
+	if req.Method != http.MethodGet {
+		resp, err := transport.RoundTrip(req)
+		// Unsafe methods invalidate stored responses (RFC 9111, section 4.4)
+		if err == nil && req.Method != http.MethodHead && req.Method != http.MethodOptions && resp.StatusCode < 400 {
+			t.Cache.Remove(req.URL.String())
+		}
+		return resp, err
+	}
+
+	mode := cacheModeFrom(req.Context())
+	requestCC := parseCacheControl(req.Header)
+	if requestCC.has("no-cache") || req.Header.Get("Pragma") == "no-cache" {
+		mode = max(mode, CacheRevalidate)
+	}
+	if requestCC.has("no-store") || req.Header.Get("Range") != "" {
+		mode = CacheBypass
+	}
+	if mode == CacheBypass {
+		return transport.RoundTrip(req)
+	}
+
+	now := t.Cache.now()
+	entry, body := t.Cache.lookup(req)
+	if entry != nil && (mode == CacheHistory || mode == CacheDefault && entry.satisfies(requestCC, now)) {
+		return entry.response(req, body, now), nil
+	}
+	if requestCC.has("only-if-cached") {
+		return &http.Response{
+			Status:     "504 Gateway Timeout",
+			StatusCode: http.StatusGatewayTimeout,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{},
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	}
+
+	// Requests with their own validators get the server's answer as is
+	outgoing := req
+	if entry != nil && req.Header.Get("If-None-Match") == "" && req.Header.Get("If-Modified-Since") == "" {
+		outgoing = conditionalRequest(req, entry)
+	}
+	resp, err := transport.RoundTrip(outgoing)
+	if err != nil {
+		return nil, err
+	}
+	responseTime := t.Cache.now()
+
+	if resp.StatusCode == http.StatusNotModified && outgoing != req {
+		resp.Body.Close()
+		refreshed := t.Cache.refresh(entry, body, resp.Header, now, responseTime)
+		stored := refreshed.response(req, body, responseTime)
+		if cookies := resp.Header.Values("Set-Cookie"); len(cookies) > 0 {
+			stored.Header["Set-Cookie"] = cookies
+		}
+		return stored, nil
+	}
+	if !storable(req, resp) {
+		return resp, nil
+	}
+	resp.Body = &cachingBody{
+		ReadCloser: resp.Body,
+		limit:      max(t.Cache.maxMemory, t.Cache.maxDisk),
+		done: func(body []byte) {
+			t.Cache.store(req, resp, body, now, responseTime)
+		},
+	}
+	return resp, nil
+}
+
+// conditionalRequest returns a request revalidating an entry with its ETag
+// and Last-Modified validators, or the request itself when it has none
+func conditionalRequest(req *http.Request, e *cacheEntry) *http.Request {
+	etag, lastModified := e.header.Get("ETag"), e.header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return req
+	}
+	conditional := req.Clone(req.Context())
+	if etag != "" {
+		conditional.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		conditional.Header.Set("If-Modified-Since", lastModified)
+	}
+	return conditional
+}
+
+// storable reports whether a response may be stored (RFC 9111, section 3)
+func storable(req *http.Request, resp *http.Response) bool {
+	cc := parseCacheControl(resp.Header)
+	if cc.has("no-store") || resp.StatusCode == http.StatusPartialContent {
+		return false
+	}
+	if varyAll(resp.Header) {
+		return false
+	}
+	if req.Header.Get("Authorization") != "" && !cc.has("public") && !cc.has("must-revalidate") && !cc.has("s-maxage") {
+		return false
+	}
+	return heuristicallyCacheable[resp.StatusCode] || cc.has("max-age") || cc.has("public") || resp.Header.Get("Expires") != ""
+}
+
+// cachingBody passes a response body through, handing the whole body to
+// done once it has been read to the end within the size limit
+type cachingBody struct {
+	io.ReadCloser
+	buf      bytes.Buffer
+	limit    int64
+	overflow bool
+	done     func(body []byte)
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && !b.overflow {
+		if int64(b.buf.Len()+n) > b.limit {
+			b.overflow = true
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF && !b.overflow && b.done != nil {
+		b.done(bytes.Clone(b.buf.Bytes()))
+		b.done = nil
+	}
+	return n, err
+}
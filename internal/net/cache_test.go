@@ -0,0 +1,283 @@
+package net
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// cacheTestServer counts the requests a handler receives
+type cacheTestServer struct {
+	*httptest.Server
+	requests atomic.Int32
+}
+
+func newCacheTestServer(t *testing.T, handler http.HandlerFunc) *cacheTestServer {
+	t.Helper()
+	s := &cacheTestServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// cachedGet fetches a URL through a cache and returns the body and response
+func cachedGet(t *testing.T, client *http.Client, ctx context.Context, url string, header http.Header) (string, *http.Response) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for field, values := range header {
+		req.Header[field] = values
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body), resp
+}
+
+// fakeClock lets tests move a cache through time
+func fakeClock(c *Cache) *time.Time {
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	return &now
+}
+
+func TestCacheServesFreshResponses(t *testing.T) {
+	server := newCacheTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("fresh"))
+	})
+	cache := NewCache(1 << 20)
+	now := fakeClock(cache)
+	client := NewCachingClient(cache)
+
+	for i := 0; i < 3; i++ {
+		if body, _ := cachedGet(t, client, context.Background(), server.URL, nil); body != "fresh" {
+			t.Fatalf("Expected body %q, got %q", "fresh", body)
+		}
+	}
+	if got := server.requests.Load(); got != 1 {
+		t.Errorf("Expected 1 request while fresh, got %d", got)
+	}
+
+	*now = now.Add(30 * time.Second)
+	if _, resp := cachedGet(t, client, context.Background(), server.URL, nil); resp.Header.Get("Age") != "30" {
+		t.Errorf("Expected Age 30, got %q", resp.Header.Get("Age"))
+	}
+	cachedGet(t, client, context.Background(), server.URL, http.Header{"Cache-Control": {"max-age=10"}})
+	if server.requests.Load() != 2 {
+		t.Error("Expected a request max-age older than the response to go to the server")
+	}
+
+	*now = now.Add(2 * time.Minute)
+	cachedGet(t, client, context.Background(), server.URL, nil)
+	if got := server.requests.Load(); got != 3 {
+		t.Errorf("Expected a stale response to be fetched again, got %d requests", got)
+	}
+}
+
+func TestCacheRevalidatesWithValidators(t *testing.T) {
+	var conditional atomic.Int32
+	server := newCacheTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "no-cache")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional.Add(1)
+			w.Header().Set("X-Revalidated", "yes")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("validated"))
+	})
+	cache := NewCache(1 << 20)
+	client := NewCachingClient(cache)
+
+	cachedGet(t, client, context.Background(), server.URL, nil)
+	body, resp := cachedGet(t, client, context.Background(), server.URL, nil)
+	if body != "validated" || resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the stored body with status 200, got %q and %d", body, resp.StatusCode)
+	}
+	if conditional.Load() != 1 || resp.Header.Get("X-Revalidated") != "yes" {
+		t.Errorf("Expected a conditional request updating the headers, got %d", conditional.Load())
+	}
+
+	// History navigations use the stored response without asking
+	cachedGet(t, client, WithCacheMode(context.Background(), CacheHistory), server.URL, nil)
+	if got := server.requests.Load(); got != 2 {
+		t.Errorf("Expected back/forward to be served from the cache, got %d requests", got)
+	}
+}
+
+func TestCacheHeuristicFreshnessAndExpires(t *testing.T) {
+	lastModified := time.Now().Add(-10 * 24 * time.Hour).UTC().Format(http.TimeFormat)
+	server := newCacheTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/heuristic":
+			w.Header().Set("Last-Modified", lastModified)
+		case "/expired":
+			w.Header().Set("Expires", "0")
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store, max-age=60")
+		}
+		w.Write([]byte(r.URL.Path))
+	})
+	cache := NewCache(1 << 20)
+	now := fakeClock(cache)
+	client := NewCachingClient(cache)
+
+	for _, path := range []string{"/heuristic", "/expired", "/no-store"} {
+		cachedGet(t, client, context.Background(), server.URL+path, nil)
+		cachedGet(t, client, context.Background(), server.URL+path, nil)
+	}
+	if got := server.requests.Load(); got != 5 {
+		t.Errorf("Expected only the heuristically fresh response to be reused, got %d requests", got)
+	}
+	if entries := cache.Entries(); len(entries) != 2 {
+		t.Errorf("Expected no-store responses not to be stored, got %+v", entries)
+	}
+
+	// A tenth of the time since the last modification is one day
+	*now = now.Add(25 * time.Hour)
+	cachedGet(t, client, context.Background(), server.URL+"/heuristic", nil)
+	if got := server.requests.Load(); got != 6 {
+		t.Errorf("Expected the heuristic freshness to end after a day, got %d requests", got)
+	}
+}
+
+func TestCacheVary(t *testing.T) {
+	server := newCacheTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		w.Write([]byte(r.Header.Get("Accept-Language")))
+	})
+	client := NewCachingClient(NewCache(1 << 20))
+
+	english := http.Header{"Accept-Language": {"en"}}
+	french := http.Header{"Accept-Language": {"fr"}}
+	cachedGet(t, client, context.Background(), server.URL, english)
+	cachedGet(t, client, context.Background(), server.URL, french)
+	if body, _ := cachedGet(t, client, context.Background(), server.URL, english); body != "en" {
+		t.Errorf("Expected the English variant, got %q", body)
+	}
+	if body, _ := cachedGet(t, client, context.Background(), server.URL, french); body != "fr" {
+		t.Errorf("Expected the French variant, got %q", body)
+	}
+	if got := server.requests.Load(); got != 2 {
+		t.Errorf("Expected one request per variant, got %d", got)
+	}
+}
+
+func TestCacheVaryStar(t *testing.T) {
+	varies := map[string][]string{
+		"/alone":    {"*"},
+		"/list":     {"Accept-Language, *"},
+		"/spaced":   {"Accept-Language ,  * "},
+		"/repeated": {"Accept-Language", "*"},
+	}
+	server := newCacheTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		for _, vary := range varies[r.URL.Path] {
+			w.Header().Add("Vary", vary)
+		}
+		w.Write([]byte("body"))
+	})
+	cache := NewCache(1 << 20)
+	client := NewCachingClient(cache)
+
+	for path := range varies {
+		before := server.requests.Load()
+		cachedGet(t, client, context.Background(), server.URL+path, nil)
+		cachedGet(t, client, context.Background(), server.URL+path, nil)
+		if got := server.requests.Load() - before; got != 2 {
+			t.Errorf("Expected Vary %q not to be served from the cache, got %d requests", varies[path], got)
+		}
+	}
+	if entries := cache.Entries(); len(entries) != 0 {
+		t.Errorf("Expected no stored responses, got %+v", entries)
+	}
+
+	// Entries varying on "*", such as ones stored before the list form was
+	// recognised, never match
+	entry := &cacheEntry{vary: http.Header{"Accept-Language": {""}, "*": {""}}}
+	if entry.matches(httptest.NewRequest(http.MethodGet, "/", nil)) {
+		t.Error("Expected an entry varying on * to match no request")
+	}
+}
+
+func TestCacheInvalidationAndLimits(t *testing.T) {
+	server := newCacheTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("0123456789"))
+	})
+	cache := NewCache(25)
+	client := NewCachingClient(cache)
+
+	for _, path := range []string{"/a", "/b", "/c"} {
+		cachedGet(t, client, context.Background(), server.URL+path, nil)
+	}
+	entries := cache.Entries()
+	if len(entries) != 2 || entries[0].URL != server.URL+"/c" || entries[1].URL != server.URL+"/b" {
+		t.Fatalf("Expected the least recently used response to be evicted, got %+v", entries)
+	}
+	if memory, _ := cache.Size(); memory != 20 {
+		t.Errorf("Expected 20 bytes in memory, got %d", memory)
+	}
+
+	if _, err := client.Post(server.URL+"/b", "text/plain", nil); err != nil {
+		t.Fatal(err)
+	}
+	if entries := cache.Entries(); len(entries) != 1 {
+		t.Errorf("Expected POST to invalidate the stored response, got %+v", entries)
+	}
+	cache.Clear()
+	if entries := cache.Entries(); len(entries) != 0 {
+		t.Errorf("Expected Clear to empty the cache, got %+v", entries)
+	}
+}
+
+func TestDiskCachePersists(t *testing.T) {
+	server := newCacheTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Write([]byte("persisted"))
+	})
+	dir := t.TempDir()
+	cache, err := NewDiskCache(dir, 1<<20, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cachedGet(t, NewCachingClient(cache), context.Background(), server.URL, nil)
+
+	reopened, err := NewDiskCache(dir, 1<<20, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := reopened.Entries()
+	if len(entries) != 1 || !entries[0].OnDisk || entries[0].InMemory || entries[0].Size != int64(len("persisted")) {
+		t.Fatalf("Expected the response to be loaded from disk, got %+v", entries)
+	}
+	if body, _ := cachedGet(t, NewCachingClient(reopened), context.Background(), server.URL, nil); body != "persisted" {
+		t.Errorf("Expected the stored body, got %q", body)
+	}
+	if got := server.requests.Load(); got != 1 {
+		t.Errorf("Expected the reopened cache to answer, got %d requests", got)
+	}
+
+	reopened.Clear()
+	if _, disk := reopened.Size(); disk != 0 {
+		t.Errorf("Expected Clear to delete the cache files, %d bytes left", disk)
+	}
+}
@@ -0,0 +1,611 @@
+package net
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	// maxCookieSize limits the name and value of a cookie together
+	maxCookieSize = 4096
+	// maxCookieLifetime caps the expiry date of a cookie (RFC 6265bis, section 5.5)
+	maxCookieLifetime = 400 * 24 * time.Hour
+	// maxCookiesPerDomain and maxCookies bound the jar; the least recently
+	// used cookies are evicted first
+	maxCookiesPerDomain = 50
+	maxCookies          = 3000
+)
+
+// DefaultCookieJar is the cookie store shared by fetchers, image loaders and
+// document.cookie. Replace it before creating them to persist cookies.
+var DefaultCookieJar = NewCookieJar()
+
+type cookieSiteKey struct{}
+
+// WithCookieSite returns a context whose requests are subresource requests
+// of a document at the given URL. SameSite cookies are only sent and stored
+// when the request goes to the document's own site; requests without a
+// site are top-level navigations, which the user started.
+func WithCookieSite(ctx context.Context, document *url.URL) context.Context {
+	return context.WithValue(ctx, cookieSiteKey{}, document)
+}
+
+// cookieSiteFrom returns the document URL of a request context, nil for navigations
+func cookieSiteFrom(ctx context.Context) *url.URL {
+	document, _ := ctx.Value(cookieSiteKey{}).(*url.URL)
+	return document
+}
+
+// CookieInfo describes a stored cookie
+type CookieInfo struct {
+	Name     string        `json:"name"`
+	Value    string        `json:"value"`
+	Domain   string        `json:"domain"`
+	Path     string        `json:"path"`
+	HostOnly bool          `json:"hostOnly,omitempty"` // Only sent to Domain itself, not its subdomains
+	Secure   bool          `json:"secure,omitempty"`
+	HttpOnly bool          `json:"httpOnly,omitempty"`
+	SameSite http.SameSite `json:"sameSite,omitempty"`
+	Expires  time.Time     `json:"expires"` // Zero for session cookies
+	Created  time.Time     `json:"created"`
+}
+
+// key identifies a cookie by its name, domain, host-only flag and path
+func (c *CookieInfo) key() string {
+	return fmt.Sprintf("%s;%s;%t;%s", c.Name, c.Domain, c.HostOnly, c.Path)
+}
+
+// storedCookie is a cookie with the time it was last sent or set
+type storedCookie struct {
+	CookieInfo
+	lastAccess time.Time
+}
+
+// cookieRequest describes who sets or reads cookies
+type cookieRequest struct {
+	url       *url.URL
+	script    bool // document.cookie, which cannot see HttpOnly cookies
+	crossSite bool // A subresource request to another site
+}
+
+// CookieJar stores cookies as described by RFC 6265bis: domains are matched
+// against the public suffix list, and the Secure, HttpOnly and SameSite
+// attributes, expiry dates and cookie name prefixes are enforced. A jar
+// with a file keeps its persistent cookies there; session cookies end with
+// the process.
+type CookieJar struct {
+	mu          sync.Mutex
+	path        string
+	cookies     map[string]*storedCookie
+	lastCreated time.Time // Creation times are unique so cookies sort stably
+	now         func() time.Time
+}
+
+// NewCookieJar creates an in-memory cookie jar
+func NewCookieJar() *CookieJar {
+	return &CookieJar{
+		cookies: make(map[string]*storedCookie),
+		now:     time.Now,
+	}
+}
+
+// NewPersistentCookieJar creates a cookie jar saving its persistent cookies
+// to a file, and loads the cookies saved there by earlier sessions
+func NewPersistentCookieJar(path string) (*CookieJar, error) {
+	j := NewCookieJar()
+	j.path = path
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cookie file: %w", err)
+	}
+	var saved []CookieInfo
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("failed to parse cookie file: %w", err)
+	}
+	now := j.now()
+	for _, cookie := range saved {
+		if !cookie.Expires.IsZero() && cookie.Expires.After(now) {
+			j.cookies[cookie.key()] = &storedCookie{CookieInfo: cookie, lastAccess: cookie.Created}
+			if cookie.Created.After(j.lastCreated) {
+				j.lastCreated = cookie.Created
+			}
+		}
+	}
+	return j, nil
+}
+
+// SetCookies stores the cookies of a response from u, as received by a
+// top-level navigation. It implements http.CookieJar.
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.setCookies(cookieRequest{url: u}, cookies)
+}
+
+// Cookies returns the cookies to send to u with a top-level navigation. It
+// implements http.CookieJar.
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	selected := j.cookiesFor(cookieRequest{url: u})
+	cookies := make([]*http.Cookie, len(selected))
+	for i, cookie := range selected {
+		value, quoted := cookie.Value, false
+		if len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"' {
+			value, quoted = value[1:len(value)-1], true
+		}
+		cookies[i] = &http.Cookie{Name: cookie.Name, Value: value, Quoted: quoted}
+	}
+	return cookies
+}
+
+// CookieString returns the document.cookie string of a document at u: the
+// cookies it may read as "name=value" pairs separated by "; "
+func (j *CookieJar) CookieString(u *url.URL) string {
+	return cookieHeader(j.cookiesFor(cookieRequest{url: u, script: true}))
+}
+
+// SetCookieString stores a cookie written to document.cookie by a document
+// at u. Cookies that cannot be parsed or stored are ignored, as browsers do.
+func (j *CookieJar) SetCookieString(u *url.URL, cookie string) {
+	parsed, err := http.ParseSetCookie(cookie)
+	if err != nil {
+		return
+	}
+	j.setCookies(cookieRequest{url: u, script: true}, []*http.Cookie{parsed})
+}
+
+// All returns the stored cookies sorted by domain, name and path
+func (j *CookieJar) All() []CookieInfo {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.removeExpired(j.now())
+	all := make([]CookieInfo, 0, len(j.cookies))
+	for _, cookie := range j.cookies {
+		all = append(all, cookie.CookieInfo)
+	}
+	sort.Slice(all, func(a, b int) bool {
+		if all[a].Domain != all[b].Domain {
+			return all[a].Domain < all[b].Domain
+		}
+		if all[a].Name != all[b].Name {
+			return all[a].Name < all[b].Name
+		}
+		return all[a].Path < all[b].Path
+	})
+	return all
+}
+
+// Remove deletes a stored cookie
+func (j *CookieJar) Remove(cookie CookieInfo) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, ok := j.cookies[cookie.key()]; ok {
+		delete(j.cookies, cookie.key())
+		j.save()
+	}
+}
+
+// Clear deletes every cookie
+func (j *CookieJar) Clear() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.cookies = make(map[string]*storedCookie)
+	j.save()
+}
+
+// setCookies runs the storage model of RFC 6265bis (section 5.7) on the
+// cookies received by a request
+func (j *CookieJar) setCookies(req cookieRequest, cookies []*http.Cookie) {
+	host, ok := cookieHost(req.url)
+	if !ok {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := j.now()
+	changed := false
+	for _, c := range cookies {
+		cookie, ok := newCookie(req, host, c, now)
+		if !ok || !j.allowed(req, cookie) {
+			continue
+		}
+		key := cookie.key()
+		if old, ok := j.cookies[key]; ok {
+			if old.HttpOnly && req.script {
+				continue
+			}
+			cookie.Created = old.Created
+		} else {
+			if !cookie.Created.After(j.lastCreated) {
+				cookie.Created = j.lastCreated.Add(time.Nanosecond)
+			}
+			j.lastCreated = cookie.Created
+		}
+		if !cookie.Expires.IsZero() && !cookie.Expires.After(now) {
+			// An expiry date in the past deletes the cookie
+			if _, ok := j.cookies[key]; ok {
+				delete(j.cookies, key)
+				changed = true
+			}
+			continue
+		}
+		j.cookies[key] = &storedCookie{CookieInfo: cookie, lastAccess: now}
+		j.evict(cookie.Domain, now)
+		changed = true
+	}
+	if changed {
+		j.save()
+	}
+}
+
+// newCookie turns a received cookie into a stored one, reporting false when
+// its attributes make the user agent ignore it
+func newCookie(req cookieRequest, host string, c *http.Cookie, now time.Time) (CookieInfo, bool) {
+	if c.Name == "" || len(c.Name)+len(c.Value) > maxCookieSize {
+		return CookieInfo{}, false
+	}
+	value := c.Value
+	if c.Quoted {
+		value = `"` + value + `"`
+	}
+	cookie := CookieInfo{
+		Name:     c.Name,
+		Value:    value,
+		Path:     c.Path,
+		Secure:   c.Secure,
+		HttpOnly: c.HttpOnly,
+		SameSite: c.SameSite,
+		Created:  now,
+	}
+
+	// Max-Age takes precedence over Expires; both are capped
+	switch {
+	case c.MaxAge < 0:
+		cookie.Expires = time.Unix(0, 0)
+	case c.MaxAge > 0:
+		cookie.Expires = now.Add(min(time.Duration(c.MaxAge)*time.Second, maxCookieLifetime))
+	case !c.Expires.IsZero():
+		cookie.Expires = c.Expires
+		if limit := now.Add(maxCookieLifetime); cookie.Expires.After(limit) {
+			cookie.Expires = limit
+		}
+	}
+
+	domain := strings.ToLower(strings.TrimPrefix(c.Domain, "."))
+	if domain != "" && isPublicSuffix(domain) {
+		// A public suffix may only name the host itself
+		if domain != host {
+			return CookieInfo{}, false
+		}
+		domain = ""
+	}
+	if domain == "" {
+		cookie.Domain, cookie.HostOnly = host, true
+	} else if domainMatch(host, domain) {
+		cookie.Domain = domain
+	} else {
+		return CookieInfo{}, false
+	}
+
+	if cookie.Path == "" || cookie.Path[0] != '/' {
+		cookie.Path = defaultCookiePath(req.url)
+	}
+
+	if cookie.Secure && !secureURL(req.url) {
+		return CookieInfo{}, false
+	}
+	if cookie.HttpOnly && req.script {
+		return CookieInfo{}, false
+	}
+	if cookie.SameSite == http.SameSiteNoneMode && !cookie.Secure {
+		return CookieInfo{}, false
+	}
+
+	// Name prefixes promise how the cookie was set (section 4.1.3)
+	if hasPrefixFold(cookie.Name, "__Secure-") && !cookie.Secure {
+		return CookieInfo{}, false
+	}
+	if hasPrefixFold(cookie.Name, "__Host-") && (!cookie.Secure || !cookie.HostOnly || cookie.Path != "/") {
+		return CookieInfo{}, false
+	}
+	return cookie, true
+}
+
+// allowed reports whether a request may store a cookie given the SameSite
+// rules and the secure cookies already stored
+func (j *CookieJar) allowed(req cookieRequest, cookie CookieInfo) bool {
+	if req.crossSite && cookie.SameSite != http.SameSiteNoneMode {
+		return false
+	}
+	if cookie.Secure || secureURL(req.url) {
+		return true
+	}
+	// Insecure origins cannot overwrite or shadow secure cookies (section 5.7, step 16)
+	for _, old := range j.cookies {
+		if old.Secure && old.Name == cookie.Name &&
+			(domainMatch(old.Domain, cookie.Domain) || domainMatch(cookie.Domain, old.Domain)) &&
+			pathMatch(cookie.Path, old.Path) {
+			return false
+		}
+	}
+	return true
+}
+
+// cookiesFor returns the cookies to send with a request (RFC 6265bis,
+// section 5.8.3), longest paths first
+func (j *CookieJar) cookiesFor(req cookieRequest) []CookieInfo {
+	host, ok := cookieHost(req.url)
+	if !ok {
+		return nil
+	}
+	path := req.url.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	secure := secureURL(req.url)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := j.now()
+	if j.removeExpired(now) {
+		j.save()
+	}
+
+	var selected []*storedCookie
+	for _, cookie := range j.cookies {
+		if cookie.HostOnly && host != cookie.Domain || !cookie.HostOnly && !domainMatch(host, cookie.Domain) {
+			continue
+		}
+		if !pathMatch(path, cookie.Path) || cookie.Secure && !secure || cookie.HttpOnly && req.script {
+			continue
+		}
+		// Lax, the default, and Strict cookies stay on their own site
+		if req.crossSite && cookie.SameSite != http.SameSiteNoneMode {
+			continue
+		}
+		selected = append(selected, cookie)
+	}
+	sort.Slice(selected, func(a, b int) bool {
+		if len(selected[a].Path) != len(selected[b].Path) {
+			return len(selected[a].Path) > len(selected[b].Path)
+		}
+		return selected[a].Created.Before(selected[b].Created)
+	})
+
+	cookies := make([]CookieInfo, len(selected))
+	for i, cookie := range selected {
+		cookie.lastAccess = now
+		cookies[i] = cookie.CookieInfo
+	}
+	return cookies
+}
+
+// cookieHeader joins cookies as "name=value" pairs, the form of the Cookie
+// header and of document.cookie
+func cookieHeader(cookies []CookieInfo) string {
+	pairs := make([]string, len(cookies))
+	for i, cookie := range cookies {
+		pairs[i] = cookie.Name + "=" + cookie.Value
+	}
+	return strings.Join(pairs, "; ")
+}
+
+// removeExpired drops the cookies whose expiry date has passed, reporting
+// whether there were any
+func (j *CookieJar) removeExpired(now time.Time) bool {
+	removed := false
+	for key, cookie := range j.cookies {
+		if !cookie.Expires.IsZero() && !cookie.Expires.After(now) {
+			delete(j.cookies, key)
+			removed = true
+		}
+	}
+	return removed
+}
+
+// evict enforces the per-domain and total limits after a cookie has been
+// stored for domain, dropping expired cookies first and then the least
+// recently used ones
+func (j *CookieJar) evict(domain string, now time.Time) {
+	count := func() int {
+		n := 0
+		for _, cookie := range j.cookies {
+			if cookie.Domain == domain {
+				n++
+			}
+		}
+		return n
+	}
+	if count() <= maxCookiesPerDomain && len(j.cookies) <= maxCookies {
+		return
+	}
+	j.removeExpired(now)
+
+	byAccess := make([]*storedCookie, 0, len(j.cookies))
+	for _, cookie := range j.cookies {
+		byAccess = append(byAccess, cookie)
+	}
+	sort.Slice(byAccess, func(a, b int) bool {
+		return byAccess[a].lastAccess.Before(byAccess[b].lastAccess)
+	})
+	inDomain := count()
+	for _, cookie := range byAccess {
+		switch {
+		case inDomain > maxCookiesPerDomain && cookie.Domain == domain:
+			inDomain--
+		case len(j.cookies) > maxCookies:
+		default:
+			continue
+		}
+		delete(j.cookies, cookie.key())
+	}
+}
+
+// save writes the persistent cookies to the jar's file, replacing it
+// atomically. Failures are ignored; the cookies stay in memory.
+func (j *CookieJar) save() {
+	if j.path == "" {
+		return
+	}
+	persistent := make([]CookieInfo, 0, len(j.cookies))
+	for _, cookie := range j.cookies {
+		if !cookie.Expires.IsZero() {
+			persistent = append(persistent, cookie.CookieInfo)
+		}
+	}
+	sort.Slice(persistent, func(a, b int) bool { return persistent[a].key() < persistent[b].key() })
+	data, err := json.MarshalIndent(persistent, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), 0o700); err != nil {
+		return
+	}
+	temp, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".*")
+	if err != nil {
+		return
+	}
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || os.Rename(temp.Name(), j.path) != nil {
+		os.Remove(temp.Name())
+	}
+}
+
+// cookieHost returns the canonical host of a URL that may have cookies
+func cookieHost(u *url.URL) (string, bool) {
+	if u == nil || u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "ws" && u.Scheme != "wss" {
+		return "", false
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	return host, host != ""
+}
+
+// domainMatch reports whether host is domain or one of its subdomains;
+// IP addresses only match themselves
+func domainMatch(host, domain string) bool {
+	if host == domain {
+		return true
+	}
+	return strings.HasSuffix(host, "."+domain) && net.ParseIP(host) == nil
+}
+
+// pathMatch reports whether a request path is within a cookie path
+func pathMatch(path, cookiePath string) bool {
+	if !strings.HasPrefix(path, cookiePath) {
+		return false
+	}
+	return len(path) == len(cookiePath) || strings.HasSuffix(cookiePath, "/") || path[len(cookiePath)] == '/'
+}
+
+// defaultCookiePath returns the directory of a URL's path (section 5.1.4)
+func defaultCookiePath(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" || path[0] != '/' {
+		return "/"
+	}
+	i := strings.LastIndex(path, "/")
+	if i == 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+// isPublicSuffix reports whether a domain is a public suffix such as "com"
+// or "co.uk", under which any site may register a name
+func isPublicSuffix(domain string) bool {
+	if net.ParseIP(domain) != nil {
+		return false
+	}
+	suffix, _ := publicsuffix.PublicSuffix(domain)
+	return suffix == domain
+}
+
+// secureURL reports whether a URL is a secure context for cookies; like
+// other browsers, loopback hosts count as secure
+func secureURL(u *url.URL) bool {
+	if u.Scheme == "https" || u.Scheme == "wss" {
+		return true
+	}
+	host := u.Hostname()
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// site returns the scheme and registrable domain of a URL, which decide
+// whether two URLs are same-site
+func site(u *url.URL) string {
+	host := strings.ToLower(u.Hostname())
+	if domain, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		host = domain
+	}
+	scheme := u.Scheme
+	if scheme == "wss" {
+		scheme = "https"
+	} else if scheme == "ws" {
+		scheme = "http"
+	}
+	return scheme + "://" + host
+}
+
+// hasPrefixFold reports whether s starts with prefix, ignoring case
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// CookieTransport is an http.RoundTripper adding the cookies of a jar to
+// requests and storing the cookies their responses set
+type CookieTransport struct {
+	Jar       *CookieJar
+	Transport http.RoundTripper // DefaultTransport when nil
+}
+
+// RoundTrip sends a request with its cookies and stores the response's
+// cookies, applying the SameSite rules of the request's cookie site.
+// Script requests whose credentials mode omits cookies neither send nor
+// store them.
+func (t *CookieTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := networkTransport(t.Transport)
+	if !sendsCredentials(req.Context(), req.URL) {
+		return transport.RoundTrip(req)
+	}
+	cookieReq := cookieRequest{url: req.URL}
+	if document := cookieSiteFrom(req.Context()); document != nil {
+		cookieReq.crossSite = site(document) != site(req.URL)
+	}
+
+	if cookies := t.Jar.cookiesFor(cookieReq); len(cookies) > 0 {
+		header := cookieHeader(cookies)
+		if existing := req.Header.Get("Cookie"); existing != "" {
+			header = existing + "; " + header
+		}
+		req = req.Clone(req.Context())
+		req.Header.Set("Cookie", header)
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if cookies := resp.Cookies(); len(cookies) > 0 {
+		t.Jar.setCookies(cookieReq, cookies)
+	}
+	return resp, nil
+}
@@ -0,0 +1,213 @@
+package net
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// mustURL parses a URL for a test
+func mustURL(t *testing.T, rawURL string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// setCookie stores a Set-Cookie line as received from a URL
+func setCookie(t *testing.T, j *CookieJar, rawURL, line string) {
+	t.Helper()
+	cookie, err := http.ParseSetCookie(line)
+	if err != nil {
+		t.Fatalf("ParseSetCookie(%q) failed: %v", line, err)
+	}
+	j.SetCookies(mustURL(t, rawURL), []*http.Cookie{cookie})
+}
+
+// cookiesAt returns the Cookie header a jar sends to a URL
+func cookiesAt(t *testing.T, j *CookieJar, rawURL string) string {
+	t.Helper()
+	return cookieHeader(j.cookiesFor(cookieRequest{url: mustURL(t, rawURL)}))
+}
+
+func TestCookieDomainMatching(t *testing.T) {
+	j := NewCookieJar()
+	setCookie(t, j, "https://www.example.com/", "host=1")
+	setCookie(t, j, "https://www.example.com/", "shared=2; Domain=.Example.com")
+	setCookie(t, j, "https://www.example.com/", "suffix=3; Domain=com")
+	setCookie(t, j, "https://www.example.co.uk/", "suffix=4; Domain=co.uk")
+	setCookie(t, j, "https://www.example.com/", "other=5; Domain=example.org")
+	setCookie(t, j, "https://127.0.0.1/", "ip=6; Domain=0.0.1")
+
+	tests := map[string]string{
+		"https://www.example.com/":  "host=1; shared=2",
+		"https://example.com/":      "shared=2",
+		"https://api.example.com/":  "shared=2",
+		"https://badexample.com/":   "",
+		"https://www.example.co.uk": "",
+		"https://127.0.0.1/":        "",
+	}
+	for rawURL, expected := range tests {
+		if got := cookiesAt(t, j, rawURL); got != expected {
+			t.Errorf("Expected %q for %s, got %q", expected, rawURL, got)
+		}
+	}
+
+	// A public suffix naming the host itself makes a host-only cookie
+	setCookie(t, j, "https://localhost/", "local=7; Domain=localhost")
+	if got := cookiesAt(t, j, "https://localhost/"); got != "local=7" {
+		t.Errorf("Expected the host-only cookie, got %q", got)
+	}
+}
+
+func TestCookiePathsAndOrder(t *testing.T) {
+	j := NewCookieJar()
+	now := time.Now()
+	j.now = func() time.Time { return now }
+	setCookie(t, j, "https://example.com/docs/guide/intro", "dir=1")
+	now = now.Add(time.Second)
+	setCookie(t, j, "https://example.com/", "root=2; Path=/")
+	now = now.Add(time.Second)
+	setCookie(t, j, "https://example.com/", "early=3")
+	setCookie(t, j, "https://example.com/", "api=4; Path=/api")
+
+	tests := map[string]string{
+		"https://example.com/docs/guide/page": "dir=1; root=2; early=3",
+		"https://example.com/docs/guide":      "dir=1; root=2; early=3",
+		"https://example.com/docs/guidebook":  "root=2; early=3",
+		"https://example.com/api/v1":          "api=4; root=2; early=3",
+		"https://example.com":                 "root=2; early=3",
+	}
+	for rawURL, expected := range tests {
+		if got := cookiesAt(t, j, rawURL); got != expected {
+			t.Errorf("Expected %q for %s, got %q", expected, rawURL, got)
+		}
+	}
+}
+
+func TestCookieSecureHttpOnlyAndPrefixes(t *testing.T) {
+	j := NewCookieJar()
+	setCookie(t, j, "http://example.com/", "insecure=1; Secure")
+	setCookie(t, j, "https://example.com/", "session=2; Secure; HttpOnly")
+	setCookie(t, j, "http://example.com/", "session=3")
+	if got := cookiesAt(t, j, "http://example.com/"); got != "" {
+		t.Errorf("Expected no cookies over http, got %q", got)
+	}
+	if got := cookiesAt(t, j, "https://example.com/"); got != "session=2" {
+		t.Errorf("Expected the secure cookie not to be overwritten over http, got %q", got)
+	}
+
+	page := mustURL(t, "https://example.com/")
+	j.SetCookieString(page, "visible=4")
+	j.SetCookieString(page, "session=5")
+	j.SetCookieString(page, "script=6; HttpOnly")
+	if got := j.CookieString(page); got != "visible=4" {
+		t.Errorf("Expected scripts to neither see nor replace HttpOnly cookies, got %q", got)
+	}
+
+	setCookie(t, j, "https://example.com/", "__Secure-a=1")
+	setCookie(t, j, "https://example.com/", "__Secure-b=1; Secure")
+	setCookie(t, j, "https://www.example.com/", "__Host-c=1; Secure; Path=/; Domain=example.com")
+	setCookie(t, j, "https://example.com/app/", "__Host-d=1; Secure")
+	setCookie(t, j, "https://example.com/", "__host-e=1; Secure; Path=/")
+	setCookie(t, j, "https://example.com/", "none=1; SameSite=None")
+	if got := cookiesAt(t, j, "https://example.com/app/"); got != "session=2; visible=4; __Secure-b=1; __host-e=1" {
+		t.Errorf("Expected only cookies meeting their prefix rules, got %q", got)
+	}
+}
+
+func TestCookieExpiry(t *testing.T) {
+	j := NewCookieJar()
+	now := time.Now()
+	j.now = func() time.Time { return now }
+	setCookie(t, j, "https://example.com/", "short=1; Max-Age=60; Expires=Fri, 01 Jan 2100 00:00:00 GMT")
+	setCookie(t, j, "https://example.com/", "long=2; Expires=Fri, 01 Jan 2100 00:00:00 GMT")
+	setCookie(t, j, "https://example.com/", "session=3")
+
+	all := j.All()
+	if len(all) != 3 || !all[0].Expires.Equal(now.Add(maxCookieLifetime)) || !all[2].Expires.Equal(now.Add(time.Minute)) || !all[1].Expires.IsZero() {
+		t.Errorf("Expected Max-Age to win and expiry dates to be capped, got %+v", all)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if got := cookiesAt(t, j, "https://example.com/"); got != "long=2; session=3" {
+		t.Errorf("Expected the expired cookie to be gone, got %q", got)
+	}
+	setCookie(t, j, "https://example.com/", "long=; Expires=Thu, 01 Jan 1970 00:00:00 GMT")
+	setCookie(t, j, "https://example.com/", "session=; Max-Age=0")
+	if got := cookiesAt(t, j, "https://example.com/"); got != "" {
+		t.Errorf("Expected past expiry dates to delete cookies, got %q", got)
+	}
+}
+
+func TestCookieTransportSameSite(t *testing.T) {
+	server := newCacheTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "lax", Value: "1"})
+			http.SetCookie(w, &http.Cookie{Name: "strict", Value: "2", SameSite: http.SameSiteStrictMode})
+			http.SetCookie(w, &http.Cookie{Name: "none", Value: "3", SameSite: http.SameSiteNoneMode, Secure: true})
+			w.Header().Set("Cache-Control", "max-age=60")
+			http.Redirect(w, r, "/home", http.StatusFound)
+		case "/tracker":
+			http.SetCookie(w, &http.Cookie{Name: "tracker", Value: "4"})
+		}
+		w.Write([]byte(r.Header.Get("Cookie")))
+	})
+	jar := NewCookieJar()
+	client := NewClient(NewCache(1<<20), jar)
+
+	// Cookies set before a redirect are sent to its target
+	if body, _ := cachedGet(t, client, context.Background(), server.URL+"/login", nil); body != "lax=1; strict=2; none=3" {
+		t.Errorf("Expected the redirect to carry the new cookies, got %q", body)
+	}
+
+	sameSite := WithCookieSite(context.Background(), mustURL(t, server.URL+"/page"))
+	if body, _ := cachedGet(t, client, sameSite, server.URL+"/data", nil); body != "lax=1; strict=2; none=3" {
+		t.Errorf("Expected same-site requests to carry every cookie, got %q", body)
+	}
+	crossSite := WithCookieSite(context.Background(), mustURL(t, "https://news.example/article"))
+	if body, _ := cachedGet(t, client, crossSite, server.URL+"/data", nil); body != "none=3" {
+		t.Errorf("Expected cross-site requests to carry only SameSite=None cookies, got %q", body)
+	}
+	cachedGet(t, client, crossSite, server.URL+"/tracker", nil)
+	if len(jar.All()) != 3 {
+		t.Errorf("Expected cross-site responses not to set Lax cookies, got %+v", jar.All())
+	}
+
+	// Cached responses do not set cookies again
+	jar.Clear()
+	cachedGet(t, client, context.Background(), server.URL+"/login", nil)
+	if len(jar.All()) != 0 {
+		t.Errorf("Expected the cached redirect not to replay Set-Cookie, got %+v", jar.All())
+	}
+}
+
+func TestPersistentCookieJar(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profile", "cookies.json")
+	j, err := NewPersistentCookieJar(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setCookie(t, j, "https://example.com/", "persistent=1; Max-Age=3600; HttpOnly")
+	setCookie(t, j, "https://example.com/", "session=2")
+
+	reopened, err := NewPersistentCookieJar(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := reopened.All()
+	if len(all) != 1 || all[0].Name != "persistent" || !all[0].HttpOnly || !all[0].HostOnly {
+		t.Fatalf("Expected only the persistent cookie to be saved, got %+v", all)
+	}
+
+	reopened.Remove(all[0])
+	if reopened, err = NewPersistentCookieJar(path); err != nil || len(reopened.All()) != 0 {
+		t.Errorf("Expected the removal to be saved, got %+v, %v", reopened.All(), err)
+	}
+}
@@ -0,0 +1,371 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrCORS is returned for script requests of other origins that the
+// server did not allow
+var ErrCORS = errors.New("blocked by CORS policy")
+
+// CredentialsMode is whether a script request sends and stores cookies,
+// as in the credentials option of fetch
+type CredentialsMode int
+
+const (
+	CredentialsSameOrigin CredentialsMode = iota // Only for the document's own origin
+	CredentialsInclude                           // Also for other origins, which must allow them
+	CredentialsOmit                              // Never
+)
+
+// ParseCredentialsMode parses the credentials option of fetch, such as
+// "include"; other values are the default, CredentialsSameOrigin
+func ParseCredentialsMode(mode string) CredentialsMode {
+	switch mode {
+	case "include":
+		return CredentialsInclude
+	case "omit":
+		return CredentialsOmit
+	default:
+		return CredentialsSameOrigin
+	}
+}
+
+// ScriptRequest is a request made by a document's script, such as with
+// fetch
+type ScriptRequest struct {
+	Method      string // GET when empty
+	URL         string // Resolved against the URL of the document
+	Header      http.Header
+	Body        []byte
+	Credentials CredentialsMode
+}
+
+// preflightMaxAge is how long preflight results without
+// Access-Control-Max-Age are cached
+const preflightMaxAge = 5 * time.Second
+
+// preflightResult is a cached preflight response: the methods and headers
+// the server allowed until it expires
+type preflightResult struct {
+	methods []string
+	headers []string
+	expires time.Time
+}
+
+// FetchFromScript sends a request of the script of the document whose
+// policy ctx carries, see WithDocumentPolicy; without one the script's
+// origin is opaque. Requests of other origins are made with CORS: ones
+// that are not simple are preflighted with OPTIONS, and responses are
+// only returned when the server allows the document's origin, filtered to
+// the headers scripts may read.
+func (f *Fetcher) FetchFromScript(ctx context.Context, sr ScriptRequest) (*Response, error) {
+	start := time.Now()
+	policy := DocumentPolicyFrom(ctx)
+	u, err := url.Parse(sr.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	var origin Origin
+	if policy != nil {
+		u = policy.URL.ResolveReference(u)
+		origin = policy.Origin
+		if cookieSiteFrom(ctx) == nil {
+			ctx = WithCookieSite(ctx, policy.URL)
+		}
+	}
+	ctx = WithResourceType(ctx, ResourceOther)
+	if scheme := strings.ToLower(u.Scheme); scheme != "http" && scheme != "https" {
+		if scheme != "data" {
+			return nil, fmt.Errorf("%w %q", ErrUnsupportedScheme, u.Scheme)
+		}
+		return readAll(f.openLocal(ctx, scheme, u, start))
+	}
+	if policy != nil {
+		if err := policy.Check(u, ResourceOther, false); err != nil {
+			return nil, err
+		}
+	}
+
+	method := strings.ToUpper(sr.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	header := http.Header{}
+	for name, values := range sr.Header {
+		if !forbiddenHeader(name) {
+			header[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+	crossOrigin := !origin.SameOrigin(OriginOf(u))
+	if crossOrigin {
+		header.Set("Origin", origin.String())
+		if err := f.preflight(ctx, origin, u, method, header, sr.Credentials); err != nil {
+			return nil, err
+		}
+	}
+
+	var body io.Reader
+	if sr.Body != nil {
+		body = bytes.NewReader(sr.Body)
+	}
+	req, err := http.NewRequestWithContext(withCredentials(ctx, sr.Credentials, origin), method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header = header
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch URL: %w", err)
+	}
+
+	// A redirect to another origin makes the response cross-origin too
+	for hop := resp.Request; hop != nil && !crossOrigin; hop = responseRequest(hop.Response) {
+		crossOrigin = !origin.SameOrigin(OriginOf(hop.URL))
+	}
+	if crossOrigin {
+		if err := checkCORS(resp.Header, origin, sr.Credentials == CredentialsInclude); err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%w: access to fetch at '%s' from origin '%s': %v", ErrCORS, u, origin, err)
+		}
+	}
+	r, err := readAll(newHTTPResponse(resp, start), nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Header = scriptHeaders(r.Header, crossOrigin, sr.Credentials == CredentialsInclude)
+	return r, nil
+}
+
+// responseRequest returns the request of a redirect response, nil for none
+func responseRequest(resp *http.Response) *http.Request {
+	if resp == nil {
+		return nil
+	}
+	return resp.Request
+}
+
+// readAll reads the body of an opened response
+func readAll(r *Response, err error) (*Response, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer r.Stream.Close()
+	body, err := io.ReadAll(r.Stream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	r.Stream = nil
+	r.setBody(body)
+	r.Timing.Total = time.Since(r.Timing.Start)
+	return r, nil
+}
+
+// preflight asks the server of a cross-origin request whether it allows
+// its method and headers, unless the request is simple or a cached
+// preflight allowed them
+func (f *Fetcher) preflight(ctx context.Context, origin Origin, u *url.URL, method string, header http.Header, credentials CredentialsMode) error {
+	var unsafeHeaders []string
+	for name, values := range header {
+		if name != "Origin" && !safelistedHeader(name, strings.Join(values, ", ")) {
+			unsafeHeaders = append(unsafeHeaders, strings.ToLower(name))
+		}
+	}
+	simpleMethod := method == http.MethodGet || method == http.MethodHead || method == http.MethodPost
+	if simpleMethod && len(unsafeHeaders) == 0 {
+		return nil
+	}
+	slices.Sort(unsafeHeaders)
+	include := credentials == CredentialsInclude
+
+	key := origin.String() + " " + u.String() + " " + strconv.FormatBool(include)
+	f.preflightMu.Lock()
+	cached, ok := f.preflights[key]
+	f.preflightMu.Unlock()
+	if ok && time.Now().Before(cached.expires) && cached.allows(method, unsafeHeaders, include) == nil {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(withCredentials(ctx, CredentialsOmit, origin), http.MethodOptions, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Origin", origin.String())
+	req.Header.Set("Access-Control-Request-Method", method)
+	if len(unsafeHeaders) > 0 {
+		req.Header.Set("Access-Control-Request-Headers", strings.Join(unsafeHeaders, ","))
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch URL: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%w: response to preflight request for '%s' has status %s", ErrCORS, u, resp.Status)
+	}
+	if err := checkCORS(resp.Header, origin, include); err != nil {
+		return fmt.Errorf("%w: response to preflight request for '%s': %v", ErrCORS, u, err)
+	}
+	result := preflightResult{
+		methods: headerList(resp.Header, "Access-Control-Allow-Methods", false),
+		headers: headerList(resp.Header, "Access-Control-Allow-Headers", true),
+		expires: time.Now().Add(preflightMaxAge),
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Access-Control-Max-Age")); err == nil && seconds >= 0 {
+		result.expires = time.Now().Add(time.Duration(seconds) * time.Second)
+	}
+	f.preflightMu.Lock()
+	f.preflights[key] = result
+	f.preflightMu.Unlock()
+	return result.allows(method, unsafeHeaders, include)
+}
+
+// allows checks that a preflight result allows a method and the headers
+// that are not safelisted. Wildcards allow any method and header, but not
+// with credentials, and never Authorization.
+func (p preflightResult) allows(method string, headers []string, credentials bool) error {
+	wildcard := func(list []string) bool { return !credentials && slices.Contains(list, "*") }
+	simpleMethod := method == http.MethodGet || method == http.MethodHead || method == http.MethodPost
+	if !simpleMethod && !slices.Contains(p.methods, method) && !wildcard(p.methods) {
+		return fmt.Errorf("%w: method %s is not allowed by Access-Control-Allow-Methods in preflight response", ErrCORS, method)
+	}
+	for _, name := range headers {
+		if !slices.Contains(p.headers, name) && (!wildcard(p.headers) || name == "authorization") {
+			return fmt.Errorf("%w: request header field %s is not allowed by Access-Control-Allow-Headers in preflight response", ErrCORS, name)
+		}
+	}
+	return nil
+}
+
+// checkCORS checks that the headers of a cross-origin response allow the
+// origin to read it
+func checkCORS(header http.Header, origin Origin, credentials bool) error {
+	allowed := header.Get("Access-Control-Allow-Origin")
+	switch {
+	case allowed == "":
+		return errors.New("no 'Access-Control-Allow-Origin' header is present on the requested resource")
+	case allowed == "*" && credentials:
+		return errors.New("the 'Access-Control-Allow-Origin' header must not be the wildcard '*' when the credentials mode is 'include'")
+	case allowed != "*" && allowed != origin.String():
+		return fmt.Errorf("the 'Access-Control-Allow-Origin' header has a value '%s' that is not equal to the supplied origin", allowed)
+	case credentials && header.Get("Access-Control-Allow-Credentials") != "true":
+		return errors.New("the 'Access-Control-Allow-Credentials' header must be 'true' when the credentials mode is 'include'")
+	}
+	return nil
+}
+
+// headerList splits the comma separated values of a header. Methods are
+// case-sensitive; header names are lowercased.
+func headerList(header http.Header, name string, lower bool) []string {
+	var list []string
+	for _, value := range header.Values(name) {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				if lower {
+					item = strings.ToLower(item)
+				}
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// forbiddenHeader reports whether scripts may not set a request header,
+// which the browser controls
+func forbiddenHeader(name string) bool {
+	name = strings.ToLower(name)
+	if strings.HasPrefix(name, "proxy-") || strings.HasPrefix(name, "sec-") {
+		return true
+	}
+	switch name {
+	case "accept-charset", "accept-encoding", "access-control-request-headers", "access-control-request-method",
+		"connection", "content-length", "cookie", "cookie2", "date", "dnt", "expect", "host", "keep-alive",
+		"origin", "referer", "set-cookie", "te", "trailer", "transfer-encoding", "upgrade", "via":
+		return true
+	}
+	return false
+}
+
+// safelistedHeader reports whether a request header keeps a cross-origin
+// request simple, needing no preflight
+func safelistedHeader(name, value string) bool {
+	switch strings.ToLower(name) {
+	case "accept", "accept-language", "content-language":
+		return len(value) <= 128
+	case "content-type":
+		mediaType, _, _ := strings.Cut(strings.ToLower(value), ";")
+		switch strings.TrimSpace(mediaType) {
+		case "application/x-www-form-urlencoded", "multipart/form-data", "text/plain":
+			return len(value) <= 128
+		}
+	}
+	return false
+}
+
+// scriptHeaders returns the response headers a script may read: cookies
+// never, and of cross-origin responses only the safelisted ones and those
+// in Access-Control-Expose-Headers
+func scriptHeaders(header http.Header, crossOrigin, credentials bool) http.Header {
+	filtered := http.Header{}
+	exposed := headerList(header, "Access-Control-Expose-Headers", true)
+	for name, values := range header {
+		lower := strings.ToLower(name)
+		if lower == "set-cookie" || lower == "set-cookie2" {
+			continue
+		}
+		if crossOrigin {
+			switch lower {
+			case "cache-control", "content-language", "content-length", "content-type", "expires", "last-modified", "pragma":
+			default:
+				if !slices.Contains(exposed, lower) && (credentials || !slices.Contains(exposed, "*")) {
+					continue
+				}
+			}
+		}
+		filtered[name] = values
+	}
+	return filtered
+}
+
+type credentialsKey struct{}
+
+// scriptCredentials is the credentials mode of a script request and the
+// origin of its document
+type scriptCredentials struct {
+	mode   CredentialsMode
+	origin Origin
+}
+
+// withCredentials returns a context whose requests send and store cookies
+// according to a credentials mode
+func withCredentials(ctx context.Context, mode CredentialsMode, origin Origin) context.Context {
+	return context.WithValue(ctx, credentialsKey{}, scriptCredentials{mode: mode, origin: origin})
+}
+
+// sendsCredentials reports whether a request to a URL may send and store
+// cookies; requests not made by scripts always may
+func sendsCredentials(ctx context.Context, u *url.URL) bool {
+	credentials, ok := ctx.Value(credentialsKey{}).(scriptCredentials)
+	if !ok {
+		return true
+	}
+	switch credentials.mode {
+	case CredentialsInclude:
+		return true
+	case CredentialsSameOrigin:
+		return credentials.origin.SameOrigin(OriginOf(u))
+	default:
+		return false
+	}
+}
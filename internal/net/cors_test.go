@@ -0,0 +1,129 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestFetchFromScript(t *testing.T) {
+	var mu sync.Mutex
+	var preflights []*http.Request
+	var cookies []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		cookies = append(cookies, r.Header.Get("Cookie"))
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/public":
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("X-Secret", "hidden")
+			w.Header().Set("X-Exposed", "shown")
+			w.Header().Set("Access-Control-Expose-Headers", "X-Exposed")
+		case "/private":
+			// No CORS headers
+		case "/login":
+			w.Header().Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "1"})
+		case "/update":
+			if r.Method == http.MethodOptions {
+				mu.Lock()
+				preflights = append(preflights, r)
+				mu.Unlock()
+				w.Header().Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
+				w.Header().Set("Access-Control-Allow-Methods", "PUT")
+				w.Header().Set("Access-Control-Allow-Headers", "X-Token, Content-Type")
+				w.Header().Set("Access-Control-Max-Age", "60")
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
+		}
+		w.Write([]byte(r.Method + " " + r.Header.Get("Origin")))
+	}))
+	t.Cleanup(api.Close)
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/to-api" {
+			http.Redirect(w, r, api.URL+"/private", http.StatusFound)
+			return
+		}
+		w.Write([]byte("same origin " + r.Header.Get("Origin")))
+	}))
+	t.Cleanup(site.Close)
+
+	f := NewFetcherWith(nil, NewCookieJar())
+	policy := NewDocumentPolicy(mustParse(t, site.URL+"/page"), nil)
+	ctx := WithDocumentPolicy(context.Background(), policy)
+	origin := policy.Origin.String()
+
+	resp, err := f.FetchFromScript(ctx, ScriptRequest{URL: "/data"})
+	if err != nil || resp.Text != "same origin " {
+		t.Errorf("Expected the same-origin request without an Origin header, got %+v, %v", resp, err)
+	}
+
+	resp, err = f.FetchFromScript(ctx, ScriptRequest{URL: api.URL + "/public"})
+	if err != nil || resp.Text != "GET "+origin {
+		t.Fatalf("Expected the public resource, got %+v, %v", resp, err)
+	}
+	if resp.Header.Get("X-Secret") != "" || resp.Header.Get("X-Exposed") != "shown" || resp.Header.Get("Content-Type") == "" {
+		t.Errorf("Expected only safelisted and exposed headers, got %v", resp.Header)
+	}
+
+	if _, err := f.FetchFromScript(ctx, ScriptRequest{URL: api.URL + "/private"}); !errors.Is(err, ErrCORS) {
+		t.Errorf("Expected the response without CORS headers to be blocked, got %v", err)
+	}
+	if _, err := f.FetchFromScript(ctx, ScriptRequest{URL: "/to-api"}); !errors.Is(err, ErrCORS) {
+		t.Errorf("Expected the redirect to another origin to be checked, got %v", err)
+	}
+
+	// Requests that are not simple are preflighted, and the result cached
+	put := ScriptRequest{Method: "PUT", URL: api.URL + "/update", Header: http.Header{"X-Token": {"t"}, "Cookie": {"forged=1"}}, Body: []byte("{}")}
+	for range 2 {
+		if resp, err := f.FetchFromScript(ctx, put); err != nil || resp.Text != "PUT "+origin {
+			t.Errorf("Expected the preflighted request to be sent, got %+v, %v", resp, err)
+		}
+	}
+	if len(preflights) != 1 {
+		t.Fatalf("Expected one cached preflight, got %d", len(preflights))
+	}
+	if preflights[0].Header.Get("Access-Control-Request-Method") != "PUT" || preflights[0].Header.Get("Access-Control-Request-Headers") != "x-token" {
+		t.Errorf("Unexpected preflight headers: %v", preflights[0].Header)
+	}
+	if _, err := f.FetchFromScript(ctx, ScriptRequest{Method: "DELETE", URL: api.URL + "/update"}); !errors.Is(err, ErrCORS) {
+		t.Errorf("Expected a method the preflight did not allow to be blocked, got %v", err)
+	}
+
+	// Cookies of other origins are only sent and stored with credentials included
+	if _, err := f.FetchFromScript(ctx, ScriptRequest{URL: api.URL + "/login"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.CookieJar().Cookies(mustParse(t, api.URL)); len(got) != 0 {
+		t.Errorf("Expected the cookie not to be stored without credentials, got %v", got)
+	}
+	if _, err := f.FetchFromScript(ctx, ScriptRequest{URL: api.URL + "/login", Credentials: CredentialsInclude}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.FetchFromScript(ctx, ScriptRequest{URL: api.URL + "/login", Credentials: CredentialsInclude}); err != nil {
+		t.Fatal(err)
+	}
+	if last := cookies[len(cookies)-1]; last != "session=1" {
+		t.Errorf("Expected the cookie to be sent with credentials included, got %q", last)
+	}
+	for _, cookie := range cookies[:len(cookies)-1] {
+		if cookie != "" {
+			t.Errorf("Expected no other request to send cookies, got %q", cookie)
+		}
+	}
+	if _, err := f.FetchFromScript(ctx, ScriptRequest{URL: api.URL + "/public", Credentials: CredentialsInclude}); !errors.Is(err, ErrCORS) {
+		t.Errorf("Expected a wildcard origin to be refused with credentials, got %v", err)
+	}
+
+	// connect-src is enforced on script requests
+	policy.CSP.AddMeta("connect-src 'self'")
+	if _, err := f.FetchFromScript(ctx, ScriptRequest{URL: api.URL + "/public"}); !errors.Is(err, ErrCSPViolation) {
+		t.Errorf("Expected connect-src to block the request, got %v", err)
+	}
+}
@@ -0,0 +1,290 @@
+package net
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// CSP is the Content-Security-Policy of a document: the policies of its
+// headers and <meta> elements. A load must be allowed by every enforced
+// policy; report-only policies report what they would block.
+type CSP struct {
+	policies []cspPolicy
+}
+
+// cspPolicy is one policy, a set of directives and their source lists
+type cspPolicy struct {
+	directives map[string][]string
+	order      []string // Directive names as written, for reports
+	reportOnly bool
+}
+
+// cspFallbacks are the directives a fetch directive falls back to when a
+// policy does not have it
+var cspFallbacks = map[string][]string{
+	"script-src":  {"script-src", "default-src"},
+	"style-src":   {"style-src", "default-src"},
+	"img-src":     {"img-src", "default-src"},
+	"font-src":    {"font-src", "default-src"},
+	"connect-src": {"connect-src", "default-src"},
+}
+
+// directiveFor returns the fetch directive restricting a resource type,
+// "" for types no directive restricts
+func directiveFor(t ResourceType) string {
+	switch t {
+	case ResourceScript:
+		return "script-src"
+	case ResourceStylesheet:
+		return "style-src"
+	case ResourceImage:
+		return "img-src"
+	case ResourceFont:
+		return "font-src"
+	case ResourceOther:
+		return "connect-src"
+	default:
+		return ""
+	}
+}
+
+// CSPFromHeader parses the Content-Security-Policy and
+// Content-Security-Policy-Report-Only headers of a document
+func CSPFromHeader(header http.Header) *CSP {
+	c := &CSP{}
+	for _, value := range header.Values("Content-Security-Policy") {
+		c.add(value, false, false)
+	}
+	for _, value := range header.Values("Content-Security-Policy-Report-Only") {
+		c.add(value, true, false)
+	}
+	return c
+}
+
+// AddMeta adds the policy of a <meta http-equiv="Content-Security-Policy">
+// element. Such policies cannot be report-only, and their frame-ancestors,
+// report-uri and sandbox directives are ignored.
+func (c *CSP) AddMeta(content string) {
+	c.add(content, false, true)
+}
+
+// Empty reports whether the document has no policy
+func (c *CSP) Empty() bool {
+	return c == nil || len(c.policies) == 0
+}
+
+// add parses a header value, which may hold several comma separated
+// policies
+func (c *CSP) add(value string, reportOnly, meta bool) {
+	for _, serialized := range strings.Split(value, ",") {
+		p := cspPolicy{directives: make(map[string][]string), reportOnly: reportOnly}
+		for _, directive := range strings.Split(serialized, ";") {
+			fields := strings.Fields(directive)
+			if len(fields) == 0 {
+				continue
+			}
+			name := strings.ToLower(fields[0])
+			if _, seen := p.directives[name]; seen {
+				// Only the first of a repeated directive counts
+				continue
+			}
+			if meta && (name == "frame-ancestors" || name == "report-uri" || name == "sandbox") {
+				continue
+			}
+			p.directives[name] = fields[1:]
+			p.order = append(p.order, name)
+		}
+		if len(p.directives) > 0 {
+			c.policies = append(c.policies, p)
+		}
+	}
+}
+
+// cspCheck is a load checked against a policy
+type cspCheck struct {
+	url        *url.URL
+	self       Origin
+	selfScheme string // The scheme of the document, for sources without one
+	redirected bool   // Paths are not matched after a redirect
+}
+
+// sourceList returns the directive restricting a load and its sources, or
+// "" when the policy does not restrict it
+func (p *cspPolicy) sourceList(directive string) (string, []string) {
+	for _, name := range cspFallbacks[directive] {
+		if sources, ok := p.directives[name]; ok {
+			return name, sources
+		}
+	}
+	return "", nil
+}
+
+// allowsURL reports whether a source list allows loading a URL
+func allowsURL(sources []string, check cspCheck) bool {
+	for _, source := range sources {
+		if matchesSource(source, check) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesSource reports whether a source expression matches a URL
+// (CSP Level 3, section 6.7.2.8)
+func matchesSource(source string, check cspCheck) bool {
+	u := check.url
+	scheme := strings.ToLower(u.Scheme)
+	lower := strings.ToLower(source)
+	switch {
+	case lower == "*":
+		// Any network scheme, and the document's own
+		return scheme == "http" || scheme == "https" || scheme == "ws" || scheme == "wss" || scheme == check.selfScheme
+	case lower == "'self'":
+		if check.self.Opaque() {
+			return false
+		}
+		origin := OriginOf(u)
+		if check.self.SameOrigin(origin) {
+			return true
+		}
+		// http: documents may load their own host over https:
+		return check.self.Scheme == "http" && (scheme == "https" || scheme == "wss") &&
+			origin.Host == check.self.Host && (check.self.Port == "80" && origin.Port == "443" || origin.Port == check.self.Port)
+	case strings.HasPrefix(lower, "'"):
+		// Keywords, nonces and hashes allow inline content, not URLs
+		return false
+	case strings.HasSuffix(lower, ":") && !strings.Contains(lower, "/"):
+		return schemeMatches(strings.TrimSuffix(lower, ":"), scheme)
+	}
+
+	// A host source: [scheme://]host[:port][/path]
+	rest := source
+	if sourceScheme, after, ok := strings.Cut(rest, "://"); ok {
+		if !schemeMatches(strings.ToLower(sourceScheme), scheme) {
+			return false
+		}
+		rest = after
+	} else if !schemeMatches(check.selfScheme, scheme) {
+		return false
+	}
+	hostPort, path := rest, ""
+	if i := strings.Index(rest, "/"); i >= 0 {
+		hostPort, path = rest[:i], rest[i:]
+	}
+	host, port := hostPort, ""
+	if i := strings.LastIndex(hostPort, ":"); i >= 0 && !strings.HasSuffix(hostPort, "]") {
+		host, port = hostPort[:i], hostPort[i+1:]
+	}
+
+	urlHost := strings.ToLower(u.Hostname())
+	host = strings.ToLower(host)
+	if wildcard, ok := strings.CutPrefix(host, "*."); ok {
+		if !strings.HasSuffix(urlHost, "."+wildcard) {
+			return false
+		}
+	} else if host != "*" && host != urlHost {
+		return false
+	}
+
+	if port != "*" {
+		urlPort := u.Port()
+		if urlPort == "" {
+			urlPort = OriginOf(u).Port
+		}
+		if port == "" {
+			port = OriginOf(&url.URL{Scheme: scheme, Host: "h"}).Port
+			if urlPort != port && !(port == "80" && urlPort == "443" && (scheme == "https" || scheme == "wss")) {
+				return false
+			}
+		} else if port != urlPort {
+			return false
+		}
+	}
+
+	if path != "" && !check.redirected {
+		urlPath, _ := url.PathUnescape(u.EscapedPath())
+		if urlPath == "" {
+			urlPath = "/"
+		}
+		if strings.HasSuffix(path, "/") {
+			return strings.HasPrefix(urlPath, path)
+		}
+		return urlPath == path
+	}
+	return true
+}
+
+// schemeMatches reports whether a URL scheme matches the scheme of a
+// source (CSP3 scheme-part match): http: allows https:, ws: allows wss:,
+// http: and https:, and wss: allows https:
+func schemeMatches(source, scheme string) bool {
+	switch source {
+	case scheme:
+		return true
+	case "http":
+		return scheme == "https"
+	case "ws":
+		return scheme == "wss" || scheme == "http" || scheme == "https"
+	case "wss":
+		return scheme == "https"
+	}
+	return false
+}
+
+// allowsInline reports whether a source list allows an inline <script> or
+// <style> with a nonce attribute and content. Nonces and hashes turn off
+// 'unsafe-inline'.
+func allowsInline(sources []string, nonce, content string) bool {
+	unsafeInline, hashed := false, false
+	for _, source := range sources {
+		lower := strings.ToLower(source)
+		switch {
+		case lower == "'unsafe-inline'":
+			unsafeInline = true
+		case strings.HasPrefix(lower, "'nonce-") && strings.HasSuffix(source, "'"):
+			hashed = true
+			if nonce != "" && source[len("'nonce-"):len(source)-1] == nonce {
+				return true
+			}
+		case strings.HasPrefix(lower, "'sha") && strings.HasSuffix(source, "'"):
+			hashed = true
+			algorithm, digest, _ := strings.Cut(source[1:len(source)-1], "-")
+			if contentHash(strings.ToLower(algorithm), content) == digest {
+				return true
+			}
+		}
+	}
+	return unsafeInline && !hashed
+}
+
+// contentHash returns the base64 digest of content for a hash source
+func contentHash(algorithm, content string) string {
+	var sum []byte
+	switch algorithm {
+	case "sha256":
+		s := sha256.Sum256([]byte(content))
+		sum = s[:]
+	case "sha384":
+		s := sha512.Sum384([]byte(content))
+		sum = s[:]
+	case "sha512":
+		s := sha512.Sum512([]byte(content))
+		sum = s[:]
+	default:
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(sum)
+}
+
+// directiveText returns a directive of a policy as written, for reports
+func (p *cspPolicy) directiveText(name string) string {
+	if !slices.Contains(p.order, name) {
+		return name
+	}
+	return strings.TrimSpace(name + " " + strings.Join(p.directives[name], " "))
+}
@@ -0,0 +1,292 @@
+package net
+
+import (
+	"bytes"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+)
+
+const (
+	// prescanLimit is how far into a document <meta charset> is looked for
+	prescanLimit = 1024
+	// detectLimit is how much of a document the detector decodes
+	detectLimit = 64 << 10
+)
+
+// EncodingSource says how the character encoding of a response was chosen
+type EncodingSource int
+
+const (
+	// EncodingDefault is UTF-8 for text types without sniffing, or no
+	// encoding for binary types
+	EncodingDefault EncodingSource = iota
+	// EncodingFromBOM is a byte order mark at the start of the body
+	EncodingFromBOM
+	// EncodingFromHeader is the charset parameter of Content-Type
+	EncodingFromHeader
+	// EncodingFromMeta is a <meta charset> or <meta http-equiv> in the document
+	EncodingFromMeta
+	// EncodingDetected is guessed from the bytes of the body
+	EncodingDetected
+)
+
+// String names the source for page information
+func (s EncodingSource) String() string {
+	switch s {
+	case EncodingFromBOM:
+		return "byte order mark"
+	case EncodingFromHeader:
+		return "Content-Type header"
+	case EncodingFromMeta:
+		return "meta element"
+	case EncodingDetected:
+		return "detected"
+	default:
+		return "default"
+	}
+}
+
+// byteOrderMarks are the BOMs that decide the encoding before anything else
+var byteOrderMarks = []struct {
+	bom  []byte
+	name string
+	enc  encoding.Encoding
+}{
+	{[]byte{0xEF, 0xBB, 0xBF}, "utf-8", unicode.UTF8},
+	{[]byte{0xFE, 0xFF}, "utf-16be", unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)},
+	{[]byte{0xFF, 0xFE}, "utf-16le", unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)},
+}
+
+// detectedEncodings are the legacy encodings the detector chooses between,
+// ahead of the windows-1252 fallback. Ties go to the earlier one.
+var detectedEncodings = []string{"gb18030", "shift_jis", "euc-jp", "euc-kr"}
+
+// DecodeText decodes a response body to UTF-8. The encoding is chosen like
+// the HTML encoding sniffing algorithm: a byte order mark, then the charset
+// of contentType, then for HTML a <meta> charset in the first 1024 bytes,
+// and finally a detector guessing from the bytes themselves. Binary types
+// are not decoded and have no encoding.
+func DecodeText(body []byte, contentType string) (text, encodingName string, source EncodingSource) {
+	for _, mark := range byteOrderMarks {
+		if bytes.HasPrefix(body, mark.bom) {
+			return decode(mark.enc, body[len(mark.bom):]), mark.name, EncodingFromBOM
+		}
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	if !textual(mediaType) {
+		return "", "", EncodingDefault
+	}
+	if enc, name := lookupEncoding(params["charset"]); enc != nil {
+		return decode(enc, body), name, EncodingFromHeader
+	}
+
+	sniffed := mediaType == "" || mediaType == "text/html" || mediaType == "text/plain"
+	if mediaType == "" || mediaType == "text/html" {
+		if enc, name := metaEncoding(prescanMeta(body)); enc != nil {
+			return decode(enc, body), name, EncodingFromMeta
+		}
+	}
+	if !sniffed {
+		return decode(unicode.UTF8, body), "utf-8", EncodingDefault
+	}
+	enc, name := detectEncoding(body)
+	return decode(enc, body), name, EncodingDetected
+}
+
+// textual reports whether a media type is text; an empty type is sniffed
+func textual(mediaType string) bool {
+	switch mediaType {
+	case "", "application/json", "application/javascript", "application/ecmascript",
+		"application/x-javascript", "application/xml", "application/xhtml+xml":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "+xml") || strings.HasSuffix(mediaType, "+json")
+}
+
+// lookupEncoding finds an encoding by label. x-user-defined means
+// windows-1252 as in the HTML standard.
+func lookupEncoding(label string) (encoding.Encoding, string) {
+	if label == "" {
+		return nil, ""
+	}
+	enc, name := charset.Lookup(label)
+	if name == "x-user-defined" {
+		return charset.Lookup("windows-1252")
+	}
+	return enc, name
+}
+
+// metaEncoding finds the encoding declared by a <meta> element. A document
+// cannot declare itself UTF-16 from within, so those labels mean UTF-8.
+func metaEncoding(label string) (encoding.Encoding, string) {
+	enc, name := lookupEncoding(label)
+	if name == "utf-16be" || name == "utf-16le" {
+		return unicode.UTF8, "utf-8"
+	}
+	return enc, name
+}
+
+// decode converts bytes in an encoding to UTF-8, replacing invalid
+// sequences with U+FFFD
+func decode(enc encoding.Encoding, body []byte) string {
+	if enc == unicode.UTF8 {
+		return strings.ToValidUTF8(string(body), "�")
+	}
+	text, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return strings.ToValidUTF8(string(body), "�")
+	}
+	return string(text)
+}
+
+// prescanMeta returns the charset declared by a <meta> element in the
+// first 1024 bytes of a document, or ""
+func prescanMeta(body []byte) string {
+	if len(body) > prescanLimit {
+		body = body[:prescanLimit]
+	}
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			if string(name) != "meta" {
+				continue
+			}
+			var httpEquiv, content string
+			for hasAttr {
+				var key, value []byte
+				key, value, hasAttr = z.TagAttr()
+				switch string(key) {
+				case "charset":
+					if label := strings.TrimSpace(string(value)); label != "" {
+						return label
+					}
+				case "http-equiv":
+					httpEquiv = string(value)
+				case "content":
+					content = string(value)
+				}
+			}
+			if strings.EqualFold(httpEquiv, "content-type") {
+				if label := charsetFromContent(content); label != "" {
+					return label
+				}
+			}
+		}
+	}
+}
+
+// charsetFromContent extracts the charset from the content attribute of a
+// <meta http-equiv="Content-Type">, such as "text/html; charset=shift_jis"
+func charsetFromContent(content string) string {
+	lower := strings.ToLower(content)
+	for {
+		i := strings.Index(lower, "charset")
+		if i < 0 {
+			return ""
+		}
+		lower, content = lower[i+len("charset"):], content[i+len("charset"):]
+		rest := strings.TrimLeft(content, " \t\n\f\r")
+		if !strings.HasPrefix(rest, "=") {
+			continue
+		}
+		rest = strings.TrimLeft(rest[1:], " \t\n\f\r")
+		if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+			if end := strings.IndexByte(rest[1:], rest[0]); end >= 0 {
+				return rest[1 : end+1]
+			}
+			return ""
+		}
+		if end := strings.IndexAny(rest, " \t\n\f\r;"); end >= 0 {
+			rest = rest[:end]
+		}
+		return rest
+	}
+}
+
+// detectEncoding guesses the encoding of a document without a declared
+// one. Valid UTF-8 is taken as UTF-8. Otherwise each legacy CJK encoding
+// decodes the bytes and is scored by how much the result looks like the
+// text of its language; when none fits, windows-1252 is used like in other
+// browsers.
+func detectEncoding(body []byte) (encoding.Encoding, string) {
+	cut := 0
+	if len(body) > detectLimit {
+		body = body[:detectLimit]
+		// A character cut in two by the limit is not evidence against UTF-8
+		cut = utf8.UTFMax - 1
+	}
+	for i := 0; i <= min(cut, len(body)); i++ {
+		if utf8.Valid(body[:len(body)-i]) {
+			return unicode.UTF8, "utf-8"
+		}
+	}
+
+	best, bestName, bestScore := encoding.Encoding(nil), "", 0
+	for _, label := range detectedEncodings {
+		enc, name := charset.Lookup(label)
+		text, err := enc.NewDecoder().Bytes(body)
+		if err != nil {
+			continue
+		}
+		if score := scoreText(name, string(text)); score > bestScore {
+			best, bestName, bestScore = enc, name, score
+		}
+	}
+	if best == nil {
+		return charset.Lookup("windows-1252")
+	}
+	return best, bestName
+}
+
+// scoreText rates how plausible decoded text is for an encoding's
+// language. Kana only appears in Japanese, and Korean is written with
+// Hangul separated by spaces, so each counts for its language and against
+// the others; replacement characters, halfwidth katakana and rare
+// characters count against every encoding.
+func scoreText(encodingName, text string) int {
+	var kana, hangul, spacedHangul, han, punctuation, unlikely int
+	prev := rune(0)
+	for _, r := range text {
+		isHangul := r >= 0xAC00 && r <= 0xD7A3
+		if isHangul && prev == ' ' || r == ' ' && prev >= 0xAC00 && prev <= 0xD7A3 {
+			spacedHangul++
+		}
+		prev = r
+		switch {
+		case r < 0x80:
+		case r == utf8.RuneError:
+			unlikely += 10
+		case r >= 0x3040 && r <= 0x30FF:
+			kana++
+		case isHangul:
+			hangul++
+		case r >= 0x4E00 && r <= 0x9FFF:
+			han++
+		case r >= 0x3000 && r <= 0x303F, r >= 0xFF01 && r <= 0xFF60:
+			punctuation++
+		case r >= 0xFF61 && r <= 0xFF9F:
+			unlikely += 2
+		default:
+			unlikely++
+		}
+	}
+	switch encodingName {
+	case "shift_jis", "euc-jp":
+		return 2*kana + han + punctuation - 2*hangul - unlikely
+	case "euc-kr":
+		return hangul + 2*spacedHangul + punctuation - 2*han - 2*kana - unlikely
+	default:
+		return han + punctuation - 2*kana - 2*hangul - unlikely
+	}
+}
@@ -0,0 +1,91 @@
+package net
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html/charset"
+)
+
+// encode converts UTF-8 text to an encoding for a test
+func encode(t *testing.T, label, text string) []byte {
+	t.Helper()
+	enc, _ := charset.Lookup(label)
+	data, err := enc.NewEncoder().Bytes([]byte(text))
+	if err != nil {
+		t.Fatalf("Failed to encode %q as %s: %v", text, label, err)
+	}
+	return data
+}
+
+func TestDecodeTextDeclaredEncodings(t *testing.T) {
+	japanese := "日本語のページ"
+	tests := []struct {
+		name        string
+		body        []byte
+		contentType string
+		encoding    string
+		source      EncodingSource
+		suffix      string // Expected end of the decoded text
+	}{
+		{"BOM beats header", append([]byte{0xFF, 0xFE}, encode(t, "utf-16le", japanese)...), "text/html; charset=shift_jis", "utf-16le", EncodingFromBOM, japanese},
+		{"header", encode(t, "shift_jis", japanese), "text/html; charset=Shift_JIS", "shift_jis", EncodingFromHeader, japanese},
+		{"header beats meta", encode(t, "euc-jp", `<meta charset="shift_jis">`+japanese), "text/html; charset=euc-jp", "euc-jp", EncodingFromHeader, japanese},
+		{"meta charset", encode(t, "shift_jis", `<html><head><meta charset="shift_jis"></head><body>`+japanese), "text/html", "shift_jis", EncodingFromMeta, japanese},
+		{"meta http-equiv", encode(t, "gbk", `<meta http-equiv="Content-Type" content="text/html; charset='gbk'">中文网页`), "", "gbk", EncodingFromMeta, "中文网页"},
+		{"header utf-16", encode(t, "utf-16le", japanese), "text/html; charset=utf-16le", "utf-16le", EncodingFromHeader, japanese},
+		{"meta utf-16 means utf-8", []byte(`<meta charset="utf-16">` + japanese), "text/html", "utf-8", EncodingFromMeta, japanese},
+		{"scripts default to utf-8", []byte("var s = '" + japanese + "';"), "application/javascript", "utf-8", EncodingDefault, japanese + "';"},
+	}
+	for _, tt := range tests {
+		text, encoding, source := DecodeText(tt.body, tt.contentType)
+		if encoding != tt.encoding || source != tt.source {
+			t.Errorf("%s: expected %s from %s, got %s from %s", tt.name, tt.encoding, tt.source, encoding, source)
+		}
+		if !strings.HasSuffix(text, tt.suffix) {
+			t.Errorf("%s: expected the text to end with %q, got %q", tt.name, tt.suffix, text)
+		}
+	}
+
+	if text, encoding, _ := DecodeText([]byte{0x89, 'P', 'N', 'G'}, "image/png"); text != "" || encoding != "" {
+		t.Errorf("Expected binary types not to be decoded, got %q as %q", text, encoding)
+	}
+}
+
+func TestDecodeTextDetection(t *testing.T) {
+	tests := []struct {
+		encoding, text string
+	}{
+		{"utf-8", "<p>Ünïcödé ✓</p>"},
+		{"windows-1252", "<p>Café crème brûlée à la française. Résumé naïve.</p>"},
+		{"shift_jis", "<p>日本語のテキストです。これはテストです。</p>"},
+		{"euc-jp", "<p>日本語のテキストです。これはテストです。</p>"},
+		{"gb18030", "<p>这是一个中文网页，欢迎访问我们的网站。</p>"},
+		{"euc-kr", "<p>한국어 웹 페이지에 오신 것을 환영합니다.</p>"},
+	}
+	for _, tt := range tests {
+		text, encoding, source := DecodeText(encode(t, tt.encoding, tt.text), "text/html")
+		if encoding != tt.encoding || source != EncodingDetected || text != tt.text {
+			t.Errorf("Expected %q to be detected as %s, got %s (%s): %q", tt.text, tt.encoding, encoding, source, text)
+		}
+	}
+}
+
+func TestFetchDecodesText(t *testing.T) {
+	server := newCacheTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=windows-1252")
+		w.Write([]byte("<p>Caf\xe9</p>"))
+	})
+	resp, err := NewFetcherWith(nil, nil).FetchWithContext(context.Background(), server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text != "<p>Café</p>" || string(resp.Body) != "<p>Caf\xe9</p>" {
+		t.Errorf("Expected the decoded text and the raw body, got %q and %q", resp.Text, resp.Body)
+	}
+	if resp.Encoding != "windows-1252" || resp.EncodingSource != EncodingFromHeader || resp.Header.Get("Content-Type") == "" {
+		t.Errorf("Expected windows-1252 from the header, got %s from %s", resp.Encoding, resp.EncodingSource)
+	}
+}
@@ -5,55 +5,192 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
+// DefaultTransport is the transport requests reach the network with.
+// Replace it before creating clients and fetchers, such as with a
+// HARArchive to replay a recorded session without a network.
+var DefaultTransport = http.DefaultTransport
+
+// networkTransport returns a transport, or DefaultTransport when it is nil
+func networkTransport(transport http.RoundTripper) http.RoundTripper {
+	if transport != nil {
+		return transport
+	}
+	if DefaultTransport != nil {
+		return DefaultTransport
+	}
+	return http.DefaultTransport
+}
+
 // ProgressCallback is a function that can be used to report download progress.
 type ProgressCallback func(progress float64)
 
-// Fetcher handles HTTP requests
+// Response is a fetched resource. Responses with error statuses are
+// returned too, so their pages can be shown.
+type Response struct {
+	URL            string     // The final URL, after redirects
+	Redirects      []Redirect // The redirects followed to reach URL, in order
+	StatusCode     int
+	Status         string // Such as "404 Not Found"
+	Header         http.Header
+	ContentType    string         // Media type of Content-Type without parameters, such as "text/html"
+	Body           []byte         // The body as received
+	Text           string         // The body decoded to UTF-8; empty for binary types
+	Encoding       string         // Name of the character encoding Text was decoded from
+	EncodingSource EncodingSource // How Encoding was chosen
+	Stream         io.ReadCloser  // The unread body of a response from Open; nil otherwise
+	Timing         Timing
+}
+
+// Redirect is a response that sent a request on to another URL
+type Redirect struct {
+	URL        string // The URL that redirected
+	StatusCode int
+}
+
+// Timing records how long the phases of a fetch took
+type Timing struct {
+	Queued  time.Duration // Waiting for a connection slot in a Scheduler
+	Start   time.Time     // When the request was sent
+	Headers time.Duration // Until the headers of the final response arrived
+	Total   time.Duration // Until the body was read; zero while streaming
+}
+
+// NewResponse creates a successful response for a body, decoding it as
+// text when the Content-Type of header is textual or missing
+func NewResponse(header http.Header, body []byte) *Response {
+	r := &Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Header:     header,
+	}
+	if r.Header == nil {
+		r.Header = http.Header{}
+	}
+	r.ContentType, _, _ = mime.ParseMediaType(r.Header.Get("Content-Type"))
+	r.setBody(body)
+	return r
+}
+
+// newHTTPResponse creates a response from the headers of an HTTP response,
+// leaving its body in Stream
+func newHTTPResponse(resp *http.Response, start time.Time) *Response {
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return &Response{
+		URL:         resp.Request.URL.String(),
+		Redirects:   redirectsOf(resp.Request),
+		StatusCode:  resp.StatusCode,
+		Status:      resp.Status,
+		Header:      resp.Header,
+		ContentType: contentType,
+		Stream:      resp.Body,
+		Timing:      Timing{Start: start, Headers: time.Since(start)},
+	}
+}
+
+// redirectsOf walks back from the last request of a fetch through the
+// responses that redirected to it
+func redirectsOf(req *http.Request) []Redirect {
+	var redirects []Redirect
+	for ; req.Response != nil; req = req.Response.Request {
+		redirects = append(redirects, Redirect{URL: req.Response.Request.URL.String(), StatusCode: req.Response.StatusCode})
+	}
+	slices.Reverse(redirects)
+	return redirects
+}
+
+// setBody sets the body of a response and decodes its text
+func (r *Response) setBody(body []byte) {
+	r.Body = body
+	r.Text, r.Encoding, r.EncodingSource = DecodeText(body, r.Header.Get("Content-Type"))
+}
+
+// OK reports whether the response has a 2xx success status
+func (r *Response) OK() bool {
+	return r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// Fetcher loads resources by URL. HTTP and HTTPS go through the network;
+// file:, data:, about: and view-source: URLs are loaded by scheme handlers.
 type Fetcher struct {
 	client *http.Client
+	cache  *Cache
+	jar    *CookieJar
+
+	mu         sync.RWMutex
+	schemes    map[string]SchemeHandler
+	aboutPages map[string]AboutPage
+
+	preflightMu sync.Mutex
+	preflights  map[string]preflightResult // CORS preflights of script requests
 }
 
-// NewFetcher creates a new Fetcher instance
+// NewFetcher creates a new Fetcher instance using DefaultCache and DefaultCookieJar
 func NewFetcher() *Fetcher {
-	return &Fetcher{
-		client: &http.Client{},
+	return NewFetcherWith(DefaultCache, DefaultCookieJar)
+}
+
+// NewFetcherWith creates a Fetcher whose requests go through the given HTTP
+// cache and cookie jar; nil disables caching or cookies
+func NewFetcherWith(cache *Cache, jar *CookieJar) *Fetcher {
+	f := &Fetcher{
+		client:     NewClient(cache, jar),
+		cache:      cache,
+		jar:        jar,
+		aboutPages: make(map[string]AboutPage),
+		preflights: make(map[string]preflightResult),
+	}
+	f.schemes = map[string]SchemeHandler{
+		"file":        loadFile,
+		"data":        loadData,
+		"about":       f.loadAbout,
+		"view-source": f.loadViewSource,
 	}
+	return f
+}
+
+// Cache returns the HTTP cache of the fetcher, nil if it has none
+func (f *Fetcher) Cache() *Cache {
+	return f.cache
+}
+
+// CookieJar returns the cookie jar of the fetcher, nil if it has none
+func (f *Fetcher) CookieJar() *CookieJar {
+	return f.jar
 }
 
 // Fetch retrieves the content from the given URL
-func (f *Fetcher) Fetch(url string) (string, error) {
+func (f *Fetcher) Fetch(url string) (*Response, error) {
 	return f.FetchWithContext(context.Background(), url, nil)
 }
 
 // FetchWithContext retrieves the content from the given URL with cancellation support
-func (f *Fetcher) FetchWithContext(ctx context.Context, url string, onProgress ProgressCallback) (string, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
-
-	resp, err := f.client.Do(req)
+// The context's CacheMode says how the HTTP cache is used. Error statuses
+// are not errors; check Response.OK.
+func (f *Fetcher) FetchWithContext(ctx context.Context, url string, onProgress ProgressCallback) (*Response, error) {
+	r, err := f.Open(ctx, url)
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch URL: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, err
 	}
+	defer r.Stream.Close()
 
 	// Try to get content length for progress calculation
-	totalSizeStr := resp.Header.Get("Content-Length")
+	totalSizeStr := r.Header.Get("Content-Length")
 	totalSize, _ := strconv.ParseInt(totalSizeStr, 10, 64)
 
-	var reader io.Reader = resp.Body
+	var reader io.Reader = r.Stream
 	if onProgress != nil && totalSize > 0 {
 		reader = &progressReader{
-			Reader:   resp.Body,
+			Reader:   r.Stream,
 			total:    totalSize,
 			callback: onProgress,
 		}
@@ -62,10 +199,72 @@ func (f *Fetcher) FetchWithContext(ctx context.Context, url string, onProgress P
 	var buf bytes.Buffer
 	_, err = io.Copy(&buf, reader)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %w", err)
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	r.Stream = nil
+	r.setBody(buf.Bytes())
+	r.Timing.Total = time.Since(r.Timing.Start)
+	return r, nil
+}
+
+// Open requests the given URL and returns the response once its headers
+// have arrived, leaving the body in Response.Stream for the caller to read
+// and close. Subresources of a document are checked against the
+// document policy of ctx.
+func (f *Fetcher) Open(ctx context.Context, rawURL string) (*Response, error) {
+	start := time.Now()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if policy := DocumentPolicyFrom(ctx); policy != nil {
+		if err := policy.Check(u, ResourceTypeFrom(ctx), false); err != nil {
+			return nil, err
+		}
+	}
+	if scheme := strings.ToLower(u.Scheme); scheme != "http" && scheme != "https" {
+		return f.openLocal(ctx, scheme, u, start)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch URL: %w", err)
+	}
+	return newHTTPResponse(resp, start), nil
+}
+
+// openLocal loads a URL with the handler of its scheme
+func (f *Fetcher) openLocal(ctx context.Context, scheme string, u *url.URL, start time.Time) (*Response, error) {
+	if !localResourceAllowed(ctx, scheme) {
+		return nil, fmt.Errorf("%w %s", ErrLocalResource, u)
+	}
+	handler := f.schemeHandler(scheme)
+	if handler == nil {
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedScheme, u.Scheme)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	header, body, err := handler(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		header = http.Header{}
 	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
 
-	return buf.String(), nil
+	r := NewResponse(header, nil)
+	r.URL = u.String()
+	r.Stream = io.NopCloser(bytes.NewReader(body))
+	r.Timing = Timing{Start: start, Headers: time.Since(start)}
+	return r, nil
 }
 
 // progressReader wraps an io.Reader to report progress.
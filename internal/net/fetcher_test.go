@@ -2,6 +2,9 @@ package net
 
 import (
 	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -52,3 +55,69 @@ func TestFetchWithContextTimeout(t *testing.T) {
 		t.Error("Expected error for timed out context, got nil")
 	}
 }
+
+func TestFetchFollowsRedirects(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/moved", http.StatusMovedPermanently)
+		case "/moved":
+			http.Redirect(w, r, server.URL+"/page", http.StatusFound)
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<p>Page</p>"))
+		}
+	}))
+	defer server.Close()
+	
+	// Redirects are followed through the cache and the cookie jar
+	resp, err := NewFetcherWith(NewCache(1<<20), NewCookieJar()).Fetch(server.URL + "/old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.URL != server.URL+"/page" || resp.StatusCode != http.StatusOK || resp.ContentType != "text/html" {
+		t.Errorf("Expected the final page, got %s with %d and %q", resp.URL, resp.StatusCode, resp.ContentType)
+	}
+	expected := []Redirect{{server.URL + "/old", http.StatusMovedPermanently}, {server.URL + "/moved", http.StatusFound}}
+	if len(resp.Redirects) != 2 || resp.Redirects[0] != expected[0] || resp.Redirects[1] != expected[1] {
+		t.Errorf("Expected redirects %v, got %v", expected, resp.Redirects)
+	}
+	if resp.Timing.Start.IsZero() || resp.Timing.Total < resp.Timing.Headers {
+		t.Errorf("Expected timings, got %+v", resp.Timing)
+	}
+}
+
+func TestFetchKeepsErrorPages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such page", http.StatusNotFound)
+	}))
+	defer server.Close()
+	
+	resp, err := NewFetcherWith(nil, nil).Fetch(server.URL)
+	if err != nil {
+		t.Fatalf("Expected an error status not to be an error, got %v", err)
+	}
+	if resp.OK() || resp.Status != "404 Not Found" || resp.Text != "no such page\n" {
+		t.Errorf("Expected the 404 page, got %q: %q", resp.Status, resp.Text)
+	}
+}
+
+func TestOpenStreamsBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("streamed"))
+	}))
+	defer server.Close()
+	
+	resp, err := NewFetcherWith(nil, nil).Open(context.Background(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Stream.Close()
+	if resp.Body != nil || resp.Timing.Total != 0 {
+		t.Error("Expected Open to leave the body unread")
+	}
+	if body, err := io.ReadAll(resp.Stream); err != nil || string(body) != "streamed" {
+		t.Errorf("Expected the body from the stream, got %q, %v", body, err)
+	}
+}
@@ -0,0 +1,377 @@
+package net
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// harCreator names the browser in the HAR files it records
+const harCreator = "Goosie"
+
+// DefaultRecorder records the requests of clients created while it is
+// set; nil records nothing. Set it before creating fetchers and image
+// loaders to record a session.
+var DefaultRecorder *HARRecorder
+
+// ErrNotInArchive is returned when replaying a request a HAR archive has
+// no response for
+var ErrNotInArchive = errors.New("request not in HAR archive")
+
+// HAR is an HTTP Archive, the HAR 1.2 format browser developer tools
+// export page loads in
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog is the log of a HAR file
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator is the application that recorded a HAR file
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is one request and its response
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"` // Total milliseconds
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+}
+
+// HARRequest is a recorded request
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARResponse is a recorded response
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARContent is the body of a recorded response. Text bodies are stored
+// as is and binary ones in base64.
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// HARNameValue is a header or query parameter
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARCookie is a cookie sent with a request or set by a response
+type HARCookie struct {
+	Name     string     `json:"name"`
+	Value    string     `json:"value"`
+	Path     string     `json:"path,omitempty"`
+	Domain   string     `json:"domain,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	HTTPOnly bool       `json:"httpOnly,omitempty"`
+	Secure   bool       `json:"secure,omitempty"`
+}
+
+// HARTimings are the phases of a request in milliseconds; -1 is a phase
+// that was not measured
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// HARRecorder records the requests of a session for saving as a HAR file
+type HARRecorder struct {
+	mu      sync.Mutex
+	entries []HAREntry
+}
+
+// NewHARRecorder creates an empty recorder
+func NewHARRecorder() *HARRecorder {
+	return &HARRecorder{}
+}
+
+// HAR returns the entries recorded so far, in the order requests were sent
+func (r *HARRecorder) HAR() *HAR {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := make([]HAREntry, len(r.entries))
+	copy(entries, r.entries)
+	return &HAR{Log: HARLog{
+		Version: "1.2",
+		Creator: HARCreator{Name: harCreator, Version: "1.0"},
+		Entries: entries,
+	}}
+}
+
+// Save writes the recorded entries to a HAR file
+func (r *HARRecorder) Save(path string) error {
+	data, err := json.MarshalIndent(r.HAR(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Transport returns a transport recording the requests it sends through
+// another one, DefaultTransport when nil. Bodies are read in full so
+// they can be recorded.
+func (r *HARRecorder) Transport(next http.RoundTripper) http.RoundTripper {
+	return &harTransport{recorder: r, transport: next}
+}
+
+// harTransport is the transport of a HARRecorder
+type harTransport struct {
+	recorder  *HARRecorder
+	transport http.RoundTripper
+}
+
+// RoundTrip sends a request and records it with its response
+func (t *harTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := networkTransport(t.transport).RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	headers := time.Since(start)
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	entry := HAREntry{
+		StartedDateTime: start,
+		Time:            milliseconds(time.Since(start)),
+		Request:         harRequest(req),
+		Response:        harResponse(resp, body),
+		Timings: HARTimings{
+			Blocked: -1, DNS: -1, Connect: -1,
+			Wait:    milliseconds(headers),
+			Receive: milliseconds(time.Since(start) - headers),
+		},
+	}
+	t.recorder.mu.Lock()
+	t.recorder.entries = append(t.recorder.entries, entry)
+	t.recorder.mu.Unlock()
+	return resp, nil
+}
+
+// harRequest records a request
+func harRequest(req *http.Request) HARRequest {
+	r := HARRequest{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		HTTPVersion: httpVersion(req.Proto),
+		Cookies:     []HARCookie{},
+		Headers:     harHeaders(req.Header),
+		QueryString: []HARNameValue{},
+		HeadersSize: -1,
+		BodySize:    int(max(req.ContentLength, 0)),
+	}
+	for _, cookie := range req.Cookies() {
+		r.Cookies = append(r.Cookies, HARCookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			r.QueryString = append(r.QueryString, HARNameValue{Name: name, Value: value})
+		}
+	}
+	return r
+}
+
+// harResponse records a response with its body
+func harResponse(resp *http.Response, body []byte) HARResponse {
+	r := HARResponse{
+		Status:      resp.StatusCode,
+		StatusText:  strings.TrimSpace(strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode))),
+		HTTPVersion: httpVersion(resp.Proto),
+		Cookies:     []HARCookie{},
+		Headers:     harHeaders(resp.Header),
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    len(body),
+		Content: HARContent{
+			Size:     len(body),
+			MimeType: resp.Header.Get("Content-Type"),
+		},
+	}
+	for _, cookie := range resp.Cookies() {
+		c := HARCookie{Name: cookie.Name, Value: cookie.Value, Path: cookie.Path, Domain: cookie.Domain, HTTPOnly: cookie.HttpOnly, Secure: cookie.Secure}
+		if !cookie.Expires.IsZero() {
+			c.Expires = &cookie.Expires
+		}
+		r.Cookies = append(r.Cookies, c)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Content.MimeType)
+	if (mediaType == "" || textual(mediaType)) && utf8.Valid(body) {
+		r.Content.Text = string(body)
+	} else if len(body) > 0 {
+		r.Content.Text = base64.StdEncoding.EncodeToString(body)
+		r.Content.Encoding = "base64"
+	}
+	return r
+}
+
+// harHeaders lists headers in a stable order
+func harHeaders(header http.Header) []HARNameValue {
+	headers := []HARNameValue{}
+	for _, name := range slices.Sorted(maps.Keys(header)) {
+		for _, value := range header[name] {
+			headers = append(headers, HARNameValue{Name: name, Value: value})
+		}
+	}
+	return headers
+}
+
+// httpVersion names the protocol of a request or response, HTTP/1.1 when
+// it is unknown
+func httpVersion(proto string) string {
+	if proto == "" {
+		return "HTTP/1.1"
+	}
+	return proto
+}
+
+// milliseconds converts a duration to the milliseconds HAR timings are in
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// HARArchive serves requests from the responses of a HAR file, without a
+// network. It is a transport; set DefaultTransport to it to replay a
+// session.
+type HARArchive struct {
+	mu      sync.Mutex
+	entries map[string][]HAREntry // By method and URL, in recorded order
+	served  map[string]int        // How many responses of a key were served
+}
+
+// LoadHAR reads a HAR file for replay
+func LoadHAR(path string) (*HARArchive, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var har HAR
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("invalid HAR file %s: %w", path, err)
+	}
+	return NewHARArchive(&har), nil
+}
+
+// NewHARArchive creates an archive serving the entries of a HAR
+func NewHARArchive(har *HAR) *HARArchive {
+	a := &HARArchive{
+		entries: make(map[string][]HAREntry),
+		served:  make(map[string]int),
+	}
+	for _, entry := range har.Log.Entries {
+		key := entry.Request.Method + " " + entry.Request.URL
+		a.entries[key] = append(a.entries[key], entry)
+	}
+	return a
+}
+
+// RoundTrip serves the recorded response of a request. A URL requested
+// several times gets its responses in the order they were recorded, and
+// the last one once they run out.
+func (a *HARArchive) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	key := req.Method + " " + req.URL.String()
+	a.mu.Lock()
+	entries := a.entries[key]
+	if len(entries) == 0 {
+		a.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrNotInArchive, key)
+	}
+	entry := entries[min(a.served[key], len(entries)-1)]
+	a.served[key]++
+	a.mu.Unlock()
+
+	body := []byte(entry.Response.Content.Text)
+	if entry.Response.Content.Encoding == "base64" {
+		decoded, err := base64.StdEncoding.DecodeString(entry.Response.Content.Text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body for %s in HAR archive: %w", key, err)
+		}
+		body = decoded
+	}
+
+	header := http.Header{}
+	for _, h := range entry.Response.Headers {
+		header.Add(h.Name, h.Value)
+	}
+	// Bodies are stored decoded
+	header.Del("Content-Encoding")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	statusText := entry.Response.StatusText
+	if statusText == "" {
+		statusText = http.StatusText(entry.Response.Status)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", entry.Response.Status, statusText),
+		StatusCode:    entry.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
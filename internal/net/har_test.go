@@ -0,0 +1,87 @@
+package net
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+// useHARDefaults replaces DefaultRecorder and DefaultTransport for a test
+func useHARDefaults(t *testing.T, recorder *HARRecorder, transport http.RoundTripper) {
+	t.Helper()
+	oldRecorder, oldTransport := DefaultRecorder, DefaultTransport
+	DefaultRecorder, DefaultTransport = recorder, transport
+	t.Cleanup(func() { DefaultRecorder, DefaultTransport = oldRecorder, oldTransport })
+}
+
+func TestHARRecordAndReplay(t *testing.T) {
+	binary := []byte{0x89, 'P', 'N', 'G', 0x00, 0xFF}
+	server := newCacheTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "1"})
+			http.Redirect(w, r, "/page?lang=en", http.StatusFound)
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Write([]byte("<p>Recorded ✓ " + r.Header.Get("Cookie") + "</p>"))
+		case "/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(binary)
+		}
+	})
+
+	recorder := NewHARRecorder()
+	useHARDefaults(t, recorder, nil)
+	f := NewFetcherWith(NewCache(1<<20), NewCookieJar())
+	page, err := f.Fetch(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logo, _ := f.Fetch(server.URL + "/logo.png")
+	// Served from the cache, and recorded all the same
+	f.Fetch(server.URL + "/page?lang=en")
+
+	har := recorder.HAR()
+	if len(har.Log.Entries) != 4 || server.requests.Load() != 3 || har.Log.Version != "1.2" {
+		t.Fatalf("Expected 4 entries for 3 network requests, got %d for %d", len(har.Log.Entries), server.requests.Load())
+	}
+	redirect, html, image := har.Log.Entries[0], har.Log.Entries[1], har.Log.Entries[2]
+	if redirect.Response.Status != 302 || redirect.Response.RedirectURL != "/page?lang=en" || len(redirect.Response.Cookies) != 1 {
+		t.Errorf("Expected the redirect with its cookie, got %+v", redirect.Response)
+	}
+	if len(html.Request.Cookies) != 1 || len(html.Request.QueryString) != 1 || html.Response.Content.Text != page.Text {
+		t.Errorf("Expected the page request's cookie and query and its text, got %+v", html)
+	}
+	if image.Response.Content.Encoding != "base64" {
+		t.Errorf("Expected the binary body in base64, got %+v", image.Response.Content)
+	}
+
+	path := filepath.Join(t.TempDir(), "session.har")
+	if err := recorder.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	archive, err := LoadHAR(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	useHARDefaults(t, nil, archive)
+	replay := NewFetcherWith(nil, NewCookieJar())
+	replayed, err := replay.Fetch(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.Text != page.Text || replayed.URL != page.URL || len(replayed.Redirects) != 1 {
+		t.Errorf("Expected the recorded page after its redirect, got %q at %s", replayed.Text, replayed.URL)
+	}
+	if replayedLogo, err := replay.Fetch(server.URL + "/logo.png"); err != nil || !bytes.Equal(replayedLogo.Body, logo.Body) {
+		t.Errorf("Expected the recorded image, got %v", err)
+	}
+	if _, err := replay.Fetch(server.URL + "/missing"); !errors.Is(err, ErrNotInArchive) {
+		t.Errorf("Expected ErrNotInArchive, got %v", err)
+	}
+}
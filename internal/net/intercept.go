@@ -0,0 +1,196 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// ErrBlocked is returned for requests an interceptor blocked
+var ErrBlocked = errors.New("request blocked")
+
+// RoundTripFunc sends a request on to the rest of an interceptor chain
+type RoundTripFunc func(req *http.Request) (*http.Response, error)
+
+// Interceptor handles a request on its way to the network. It may change
+// the request before passing it to next, change the response next returns,
+// or answer the request itself without calling next. Requests must be
+// cloned before they are changed.
+type Interceptor func(req *http.Request, next RoundTripFunc) (*http.Response, error)
+
+// NetworkContext holds the interceptors of a tab. Requests whose context
+// carries it, see WithNetworkContext, go through its interceptors in the
+// order they were added, the first outermost.
+type NetworkContext struct {
+	mu           sync.RWMutex
+	interceptors []*interceptorEntry
+}
+
+// interceptorEntry wraps an interceptor so it can be told apart for removal
+type interceptorEntry struct {
+	intercept Interceptor
+}
+
+// NewNetworkContext creates a network context without interceptors
+func NewNetworkContext() *NetworkContext {
+	return &NetworkContext{}
+}
+
+// Add appends an interceptor to the chain and returns a function removing it
+func (nc *NetworkContext) Add(interceptor Interceptor) (remove func()) {
+	entry := &interceptorEntry{intercept: interceptor}
+	nc.mu.Lock()
+	nc.interceptors = append(nc.interceptors, entry)
+	nc.mu.Unlock()
+	return func() {
+		nc.mu.Lock()
+		defer nc.mu.Unlock()
+		for i, e := range nc.interceptors {
+			if e == entry {
+				nc.interceptors = append(nc.interceptors[:i:i], nc.interceptors[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Len returns how many interceptors are in the chain
+func (nc *NetworkContext) Len() int {
+	nc.mu.RLock()
+	defer nc.mu.RUnlock()
+	return len(nc.interceptors)
+}
+
+// RoundTrip sends a request through the interceptors, then through send
+func (nc *NetworkContext) RoundTrip(req *http.Request, send RoundTripFunc) (*http.Response, error) {
+	nc.mu.RLock()
+	chain := make([]*interceptorEntry, len(nc.interceptors))
+	copy(chain, nc.interceptors)
+	nc.mu.RUnlock()
+
+	next := send
+	for i := len(chain) - 1; i >= 0; i-- {
+		intercept, inner := chain[i].intercept, next
+		next = func(req *http.Request) (*http.Response, error) {
+			return intercept(req, inner)
+		}
+	}
+	return next(req)
+}
+
+type networkContextKey struct{}
+
+// WithNetworkContext returns a context whose requests go through the
+// interceptors of a network context
+func WithNetworkContext(ctx context.Context, nc *NetworkContext) context.Context {
+	return context.WithValue(ctx, networkContextKey{}, nc)
+}
+
+// NetworkContextFrom returns the network context of a request context, nil
+// when it has none
+func NetworkContextFrom(ctx context.Context) *NetworkContext {
+	nc, _ := ctx.Value(networkContextKey{}).(*NetworkContext)
+	return nc
+}
+
+// InterceptTransport is an http.RoundTripper sending requests through the
+// interceptors of the network context of their context
+type InterceptTransport struct {
+	Transport http.RoundTripper // DefaultTransport when nil
+}
+
+// RoundTrip sends a request through its network context's interceptors,
+// then the wrapped transport
+func (t *InterceptTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := networkTransport(t.Transport)
+	nc := NetworkContextFrom(req.Context())
+	if nc == nil {
+		return transport.RoundTrip(req)
+	}
+	return nc.RoundTrip(req, transport.RoundTrip)
+}
+
+// ModifyRequest returns an interceptor changing requests before they are
+// sent, such as to add headers. It is given a clone of each request.
+func ModifyRequest(modify func(req *http.Request)) Interceptor {
+	return func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		req = req.Clone(req.Context())
+		modify(req)
+		return next(req)
+	}
+}
+
+// ModifyResponse returns an interceptor changing responses before they
+// are returned; an error fails the request. It is given a copy of each
+// response, so headers the cache holds are left alone.
+func ModifyResponse(modify func(resp *http.Response) error) Interceptor {
+	return func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		resp, err := next(req)
+		if err != nil {
+			return nil, err
+		}
+		copied := *resp
+		copied.Header = resp.Header.Clone()
+		resp = &copied
+		if err := modify(resp); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		return resp, nil
+	}
+}
+
+// Mock returns an interceptor answering the requests respond returns a
+// response for, without sending them; requests it returns nil for are
+// sent on
+func Mock(respond func(req *http.Request) *http.Response) Interceptor {
+	return func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		if resp := respond(req); resp != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return resp, nil
+		}
+		return next(req)
+	}
+}
+
+// Block returns an interceptor failing the requests match returns true
+// for with ErrBlocked
+func Block(match func(req *http.Request) bool) Interceptor {
+	return func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		if match(req) {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, fmt.Errorf("%w: %s", ErrBlocked, req.URL)
+		}
+		return next(req)
+	}
+}
+
+// NewMockResponse creates a response to a request with a status, content
+// type and body, for Mock
+func NewMockResponse(req *http.Request, status int, contentType string, body []byte) *http.Response {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
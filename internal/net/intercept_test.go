@@ -0,0 +1,97 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestInterceptors(t *testing.T) {
+	server := newCacheTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(r.URL.Path + " " + r.Header.Get("X-Tab")))
+	})
+	f := NewFetcherWith(NewCache(1<<20), NewCookieJar())
+	nc := NewNetworkContext()
+	ctx := WithNetworkContext(context.Background(), nc)
+
+	var order []string
+	nc.Add(func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		order = append(order, "outer")
+		return next(req)
+	})
+	nc.Add(ModifyRequest(func(req *http.Request) {
+		order = append(order, "inner")
+		req.Header.Set("X-Tab", "1")
+	}))
+	nc.Add(ModifyResponse(func(resp *http.Response) error {
+		resp.Header.Set("X-Intercepted", "yes")
+		return nil
+	}))
+	nc.Add(Mock(func(req *http.Request) *http.Response {
+		if req.URL.Path == "/api/user" {
+			return NewMockResponse(req, http.StatusOK, "application/json", []byte(`{"name":"test"}`))
+		}
+		return nil
+	}))
+	removeBlock := nc.Add(Block(func(req *http.Request) bool {
+		return strings.HasSuffix(req.URL.Path, "/tracker.js")
+	}))
+
+	resp, err := f.FetchWithContext(ctx, server.URL+"/page", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text != "/page 1" || resp.Header.Get("X-Intercepted") != "yes" {
+		t.Errorf("Expected the modified request and response, got %q, %v", resp.Text, resp.Header)
+	}
+	if !slices.Equal(order, []string{"outer", "inner"}) {
+		t.Errorf("Expected interceptors in the order they were added, got %v", order)
+	}
+
+	mocked, err := f.FetchWithContext(ctx, server.URL+"/api/user", nil)
+	if err != nil || mocked.Text != `{"name":"test"}` || mocked.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Expected the mocked response, got %+v, %v", mocked, err)
+	}
+	if _, err := f.FetchWithContext(ctx, server.URL+"/tracker.js", nil); !errors.Is(err, ErrBlocked) {
+		t.Errorf("Expected ErrBlocked, got %v", err)
+	}
+	if server.requests.Load() != 1 {
+		t.Errorf("Expected mocked and blocked requests not to be sent, got %d requests", server.requests.Load())
+	}
+
+	// Scheduled requests carry the context too
+	s := NewScheduler(f)
+	if _, err := s.Fetch(ctx, ResourceRequest{URL: server.URL + "/ad/tracker.js", Type: ResourceScript}); !errors.Is(err, ErrBlocked) {
+		t.Errorf("Expected the scheduled request to be blocked, got %v", err)
+	}
+
+	var resourceType ResourceType
+	removeObserver := nc.Add(ModifyRequest(func(req *http.Request) {
+		resourceType = ResourceTypeFrom(req.Context())
+	}))
+	s.Fetch(ctx, ResourceRequest{URL: server.URL + "/font.woff2", Type: ResourceFont})
+	if removeObserver(); resourceType != ResourceFont {
+		t.Errorf("Expected scheduled requests to carry their resource type, got %s", resourceType)
+	}
+
+	removeBlock()
+	if nc.Len() != 4 {
+		t.Errorf("Expected 4 interceptors after removing one, got %d", nc.Len())
+	}
+	if resp, err := f.FetchWithContext(ctx, server.URL+"/tracker.js", nil); err != nil || resp.Text != "/tracker.js 1" {
+		t.Errorf("Expected the request to be sent once unblocked, got %+v, %v", resp, err)
+	}
+
+	// Other tabs' requests are not intercepted, and the cache is shared
+	other, err := f.FetchWithContext(context.Background(), server.URL+"/page", nil)
+	if err != nil || other.Header.Get("X-Intercepted") != "" {
+		t.Errorf("Expected a request without a network context not to be intercepted, got %+v, %v", other, err)
+	}
+	if _, err := f.FetchWithContext(context.Background(), server.URL+"/api/user", nil); err != nil || server.requests.Load() != 4 {
+		t.Errorf("Expected the mocked URL to be sent without the mock, got %d requests, %v", server.requests.Load(), err)
+	}
+}
@@ -0,0 +1,79 @@
+package net
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Origin is the scheme, host and port of a URL, which documents are
+// isolated by. Documents of file:, data: and about: URLs have opaque
+// origins, the zero Origin, which are not the same origin as any other.
+type Origin struct {
+	Scheme string
+	Host   string
+	Port   string // The default port of the scheme when the URL has none
+}
+
+// OriginOf returns the origin of a URL
+func OriginOf(u *url.URL) Origin {
+	scheme := strings.ToLower(u.Scheme)
+	port := u.Port()
+	switch scheme {
+	case "http", "ws":
+		if port == "" {
+			port = "80"
+		}
+	case "https", "wss":
+		if port == "" {
+			port = "443"
+		}
+	default:
+		return Origin{}
+	}
+	if u.Hostname() == "" {
+		return Origin{}
+	}
+	return Origin{Scheme: scheme, Host: strings.ToLower(u.Hostname()), Port: port}
+}
+
+// Opaque reports whether the origin is opaque
+func (o Origin) Opaque() bool {
+	return o.Scheme == ""
+}
+
+// SameOrigin reports whether two origins are the same; opaque origins are
+// not the same as any origin
+func (o Origin) SameOrigin(other Origin) bool {
+	return !o.Opaque() && o == other
+}
+
+// Secure reports whether documents of the origin were delivered securely:
+// over HTTPS, or from the local machine
+func (o Origin) Secure() bool {
+	if o.Scheme == "https" || o.Scheme == "wss" {
+		return true
+	}
+	if o.Host == "localhost" || strings.HasSuffix(o.Host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(o.Host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// String serializes the origin as in the Origin header, such as
+// "https://example.com" or "null" when opaque
+func (o Origin) String() string {
+	if o.Opaque() {
+		return "null"
+	}
+	host := o.Host
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if o.Scheme == "http" && o.Port == "80" || o.Scheme == "https" && o.Port == "443" ||
+		o.Scheme == "ws" && o.Port == "80" || o.Scheme == "wss" && o.Port == "443" {
+		return o.Scheme + "://" + host
+	}
+	return o.Scheme + "://" + host + ":" + o.Port
+}
@@ -0,0 +1,181 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrMixedContent is returned for insecure scripts, stylesheets, fonts and
+// fetches of pages delivered over HTTPS
+var ErrMixedContent = errors.New("mixed content blocked")
+
+// ErrCSPViolation is returned for loads the document's
+// Content-Security-Policy does not allow
+var ErrCSPViolation = errors.New("refused by Content-Security-Policy")
+
+// DocumentPolicy is the security policy of a document: its origin and
+// Content-Security-Policy, which the loads of its subresources and the
+// requests of its scripts are checked against
+type DocumentPolicy struct {
+	URL    *url.URL
+	Origin Origin
+	CSP    *CSP
+
+	// OnViolation, when set, is told about every blocked or reported load,
+	// such as to show it in the page's console
+	OnViolation func(Violation)
+}
+
+// NewDocumentPolicy creates the policy of a document from its URL and the
+// headers it was delivered with
+func NewDocumentPolicy(u *url.URL, header http.Header) *DocumentPolicy {
+	return &DocumentPolicy{URL: u, Origin: OriginOf(u), CSP: CSPFromHeader(header)}
+}
+
+type documentPolicyKey struct{}
+
+// WithDocumentPolicy returns a context whose requests load subresources of
+// a document with the given policy
+func WithDocumentPolicy(ctx context.Context, policy *DocumentPolicy) context.Context {
+	return context.WithValue(ctx, documentPolicyKey{}, policy)
+}
+
+// DocumentPolicyFrom returns the document policy of a request context, nil
+// when it has none
+func DocumentPolicyFrom(ctx context.Context) *DocumentPolicy {
+	policy, _ := ctx.Value(documentPolicyKey{}).(*DocumentPolicy)
+	return policy
+}
+
+// Violation is a load a document policy blocked, or would have blocked had
+// its policy not been report-only
+type Violation struct {
+	Page         string // URL of the document
+	URL          string // The blocked URL; "" for inline content
+	Type         ResourceType
+	Directive    string // The violated directive as written, such as "img-src 'self'"
+	Inline       bool   // An inline <script> or <style> was refused
+	MixedContent bool   // An insecure URL was requested by a secure page
+	ReportOnly   bool
+}
+
+// String describes the violation the way browsers log it to the console
+func (v Violation) String() string {
+	if v.MixedContent {
+		return fmt.Sprintf("Mixed Content: The page at '%s' was loaded over HTTPS, but requested an insecure %s '%s'. This request has been blocked; the content must be served over HTTPS.",
+			v.Page, v.Type, v.URL)
+	}
+	prefix := ""
+	if v.ReportOnly {
+		prefix = "[Report Only] "
+	}
+	if v.Inline {
+		what := "execute inline script"
+		if v.Type == ResourceStylesheet {
+			what = "apply inline style"
+		}
+		return fmt.Sprintf("%sRefused to %s because it violates the following Content Security Policy directive: \"%s\".",
+			prefix, what, v.Directive)
+	}
+	what := "load the " + v.Type.String()
+	if v.Type == ResourceOther {
+		what = "connect to"
+	}
+	return fmt.Sprintf("%sRefused to %s '%s' because it violates the following Content Security Policy directive: \"%s\".",
+		prefix, what, v.URL, v.Directive)
+}
+
+// Check reports whether the document may load a URL as a resource of the
+// given type, returning ErrMixedContent or ErrCSPViolation when it may
+// not. redirected is set for the URLs of redirects, whose paths CSP does
+// not look at. Documents are not checked.
+func (p *DocumentPolicy) Check(u *url.URL, t ResourceType, redirected bool) error {
+	if t == ResourceDocument {
+		return nil
+	}
+	if p.blocksMixedContent(u, t) {
+		p.report(Violation{URL: u.String(), Type: t, MixedContent: true})
+		return fmt.Errorf("%w: %s", ErrMixedContent, u)
+	}
+
+	directive := directiveFor(t)
+	if directive == "" || p.CSP.Empty() {
+		return nil
+	}
+	check := cspCheck{url: u, self: p.Origin, selfScheme: strings.ToLower(p.URL.Scheme), redirected: redirected}
+	var err error
+	for i := range p.CSP.policies {
+		policy := &p.CSP.policies[i]
+		name, sources := policy.sourceList(directive)
+		if name == "" || allowsURL(sources, check) {
+			continue
+		}
+		p.report(Violation{URL: u.String(), Type: t, Directive: policy.directiveText(name), ReportOnly: policy.reportOnly})
+		if !policy.reportOnly && err == nil {
+			err = fmt.Errorf("%w: %s", ErrCSPViolation, u)
+		}
+	}
+	return err
+}
+
+// AllowsInline reports whether the document may run an inline <script>,
+// for ResourceScript, or apply an inline <style>, for ResourceStylesheet,
+// with a nonce attribute and content
+func (p *DocumentPolicy) AllowsInline(t ResourceType, nonce, content string) bool {
+	directive := directiveFor(t)
+	if directive == "" || p.CSP.Empty() {
+		return true
+	}
+	allowed := true
+	for i := range p.CSP.policies {
+		policy := &p.CSP.policies[i]
+		name, sources := policy.sourceList(directive)
+		if name == "" || allowsInline(sources, nonce, content) {
+			continue
+		}
+		p.report(Violation{Type: t, Directive: policy.directiveText(name), Inline: true, ReportOnly: policy.reportOnly})
+		if !policy.reportOnly {
+			allowed = false
+		}
+	}
+	return allowed
+}
+
+// blocksMixedContent reports whether a load is active mixed content: an
+// insecure request of a page delivered over HTTPS. Images are passive and
+// still load.
+func (p *DocumentPolicy) blocksMixedContent(u *url.URL, t ResourceType) bool {
+	if p.Origin.Scheme != "https" || t == ResourceImage {
+		return false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "ws" {
+		return false
+	}
+	return !OriginOf(u).Secure()
+}
+
+// report passes a violation to OnViolation
+func (p *DocumentPolicy) report(v Violation) {
+	if p.OnViolation == nil {
+		return
+	}
+	v.Page = p.URL.String()
+	p.OnViolation(v)
+}
+
+// checkRedirect checks each redirect of a request against the policy of
+// its document
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if policy := DocumentPolicyFrom(req.Context()); policy != nil {
+		return policy.Check(req.URL, ResourceTypeFrom(req.Context()), true)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func mustParse(t *testing.T, rawURL string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestOrigins(t *testing.T) {
+	tests := []struct {
+		url    string
+		origin string
+		secure bool
+	}{
+		{"https://Example.com/page", "https://example.com", true},
+		{"http://example.com:80/", "http://example.com", false},
+		{"http://example.com:8080/", "http://example.com:8080", false},
+		{"http://localhost:3000/", "http://localhost:3000", true},
+		{"http://[::1]/", "http://[::1]", true},
+		{"file:///tmp/page.html", "null", false},
+		{"data:text/html,hi", "null", false},
+	}
+	for _, tt := range tests {
+		origin := OriginOf(mustParse(t, tt.url))
+		if origin.String() != tt.origin || origin.Secure() != tt.secure {
+			t.Errorf("%s: expected origin %s (secure %v), got %s (secure %v)", tt.url, tt.origin, tt.secure, origin, origin.Secure())
+		}
+	}
+
+	if !OriginOf(mustParse(t, "https://a.example/")).SameOrigin(OriginOf(mustParse(t, "https://a.example:443/x"))) {
+		t.Error("Expected the default port to be the same origin")
+	}
+	if OriginOf(mustParse(t, "https://a.example/")).SameOrigin(OriginOf(mustParse(t, "http://a.example/"))) {
+		t.Error("Expected other schemes to be other origins")
+	}
+	if opaque := OriginOf(mustParse(t, "about:blank")); opaque.SameOrigin(opaque) {
+		t.Error("Expected opaque origins not to be the same origin as themselves")
+	}
+}
+
+func TestContentSecurityPolicy(t *testing.T) {
+	header := http.Header{}
+	header.Set("Content-Security-Policy", "default-src 'self'; img-src *.cdn.example https://photos.example/albums/; script-src 'self' 'nonce-abc' https://js.example:*, connect-src 'self' api.example")
+	policy := NewDocumentPolicy(mustParse(t, "https://site.example/page"), header)
+	var violations []Violation
+	policy.OnViolation = func(v Violation) { violations = append(violations, v) }
+
+	tests := []struct {
+		url     string
+		t       ResourceType
+		allowed bool
+	}{
+		{"https://site.example/app.js", ResourceScript, true},
+		{"https://js.example:8443/lib.js", ResourceScript, true},
+		{"https://evil.example/x.js", ResourceScript, false},
+		{"https://img.cdn.example/a.png", ResourceImage, true},
+		{"https://cdn.example/a.png", ResourceImage, false},
+		{"https://photos.example/albums/1.png", ResourceImage, true},
+		{"https://photos.example/other.png", ResourceImage, false},
+		{"https://site.example/style.css", ResourceStylesheet, true},
+		{"https://fonts.example/a.woff2", ResourceFont, false},
+		{"https://site.example/data", ResourceOther, true},
+		{"https://api.example/data", ResourceOther, false}, // The second policy allows it, the first does not
+		{"https://evil.example/", ResourceDocument, true},
+	}
+	for _, tt := range tests {
+		err := policy.Check(mustParse(t, tt.url), tt.t, false)
+		if allowed := err == nil; allowed != tt.allowed {
+			t.Errorf("%s (%s): expected allowed %v, got %v", tt.url, tt.t, tt.allowed, err)
+		}
+		if err != nil && !errors.Is(err, ErrCSPViolation) {
+			t.Errorf("%s: expected ErrCSPViolation, got %v", tt.url, err)
+		}
+	}
+
+	// Paths are not matched after redirects
+	if err := policy.Check(mustParse(t, "https://photos.example/cdn/1.png"), ResourceImage, true); err != nil {
+		t.Errorf("Expected a redirect to the allowed host to load, got %v", err)
+	}
+
+	if len(violations) == 0 || violations[0].String() != `Refused to load the script 'https://evil.example/x.js' because it violates the following Content Security Policy directive: "script-src 'self' 'nonce-abc' https://js.example:*".` {
+		t.Errorf("Unexpected violation report: %v", violations)
+	}
+
+	// Every policy must allow a load
+	header.Add("Content-Security-Policy", "connect-src 'none'")
+	policy = NewDocumentPolicy(mustParse(t, "https://site.example/page"), header)
+	if err := policy.Check(mustParse(t, "https://site.example/data"), ResourceOther, false); !errors.Is(err, ErrCSPViolation) {
+		t.Errorf("Expected connect-src 'none' to block fetches, got %v", err)
+	}
+}
+
+func TestSchemeMatches(t *testing.T) {
+	tests := []struct {
+		source, scheme string
+		matches        bool
+	}{
+		{"https", "https", true},
+		{"http", "https", true},
+		{"https", "http", false},
+		{"ws", "wss", true},
+		{"ws", "http", true},
+		{"ws", "https", true},
+		{"wss", "https", true},
+		{"wss", "http", false},
+		{"wss", "ws", false},
+		{"https", "wss", false},
+		{"http", "ws", false},
+	}
+	for _, tt := range tests {
+		if got := schemeMatches(tt.source, tt.scheme); got != tt.matches {
+			t.Errorf("schemeMatches(%q, %q) = %v, expected %v", tt.source, tt.scheme, got, tt.matches)
+		}
+	}
+
+	header := http.Header{}
+	header.Set("Content-Security-Policy", "connect-src wss://live.example")
+	policy := NewDocumentPolicy(mustParse(t, "https://site.example/page"), header)
+	for _, rawURL := range []string{"wss://live.example/socket", "https://live.example/poll"} {
+		if err := policy.Check(mustParse(t, rawURL), ResourceOther, false); err != nil {
+			t.Errorf("Expected connect-src wss://live.example to allow %s, got %v", rawURL, err)
+		}
+	}
+	if err := policy.Check(mustParse(t, "http://live.example/poll"), ResourceOther, false); err == nil {
+		t.Error("Expected connect-src wss://live.example to block http://live.example")
+	}
+}
+
+func TestInlineContentSecurityPolicy(t *testing.T) {
+	policy := NewDocumentPolicy(mustParse(t, "https://site.example/"), nil)
+	policy.CSP.AddMeta("style-src 'self' 'unsafe-inline'; script-src 'nonce-r4nd0m' 'sha256-" + contentHash("sha256", "alert(1)") + "'; report-uri /csp")
+	if _, ok := policy.CSP.policies[0].directives["report-uri"]; ok {
+		t.Error("Expected report-uri to be ignored in <meta> policies")
+	}
+
+	if !policy.AllowsInline(ResourceStylesheet, "", "p { color: red }") {
+		t.Error("Expected 'unsafe-inline' to allow inline styles")
+	}
+	if !policy.AllowsInline(ResourceScript, "r4nd0m", "anything()") {
+		t.Error("Expected the nonce to allow the script")
+	}
+	if !policy.AllowsInline(ResourceScript, "", "alert(1)") {
+		t.Error("Expected the hash to allow the script")
+	}
+	if policy.AllowsInline(ResourceScript, "wrong", "alert(2)") {
+		t.Error("Expected a script without the nonce or hash to be refused")
+	}
+
+	// Nonces and hashes turn off 'unsafe-inline'
+	policy.CSP.AddMeta("style-src 'unsafe-inline' 'nonce-xyz'")
+	if policy.AllowsInline(ResourceStylesheet, "", "p { color: red }") {
+		t.Error("Expected 'unsafe-inline' to be ignored next to a nonce")
+	}
+
+	// Report-only policies report without blocking
+	header := http.Header{}
+	header.Set("Content-Security-Policy-Report-Only", "style-src 'self'")
+	reportOnly := NewDocumentPolicy(mustParse(t, "https://site.example/"), header)
+	var reports []Violation
+	reportOnly.OnViolation = func(v Violation) { reports = append(reports, v) }
+	if !reportOnly.AllowsInline(ResourceStylesheet, "", "p {}") || len(reports) != 1 || !strings.HasPrefix(reports[0].String(), "[Report Only] Refused to apply inline style") {
+		t.Errorf("Expected the inline style to be reported and applied, got %v", reports)
+	}
+}
+
+func TestMixedContent(t *testing.T) {
+	policy := NewDocumentPolicy(mustParse(t, "https://site.example/"), nil)
+	var violations []Violation
+	policy.OnViolation = func(v Violation) { violations = append(violations, v) }
+
+	for _, rawURL := range []string{"http://cdn.example/app.js", "ws://cdn.example/socket"} {
+		if err := policy.Check(mustParse(t, rawURL), ResourceScript, false); !errors.Is(err, ErrMixedContent) {
+			t.Errorf("%s: expected ErrMixedContent, got %v", rawURL, err)
+		}
+	}
+	if err := policy.Check(mustParse(t, "http://cdn.example/photo.png"), ResourceImage, false); err != nil {
+		t.Errorf("Expected passive mixed content to load, got %v", err)
+	}
+	if err := policy.Check(mustParse(t, "http://localhost:8080/dev.js"), ResourceScript, false); err != nil {
+		t.Errorf("Expected loopback URLs to load, got %v", err)
+	}
+	if len(violations) != 2 || !strings.HasPrefix(violations[0].String(), "Mixed Content: The page at 'https://site.example/'") {
+		t.Errorf("Unexpected violations: %v", violations)
+	}
+
+	insecure := NewDocumentPolicy(mustParse(t, "http://site.example/"), nil)
+	if err := insecure.Check(mustParse(t, "http://cdn.example/app.js"), ResourceScript, false); err != nil {
+		t.Errorf("Expected HTTP pages to load HTTP scripts, got %v", err)
+	}
+}
+
+func TestFetcherEnforcesDocumentPolicy(t *testing.T) {
+	server := newCacheTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "https://elsewhere.example/app.js", http.StatusFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	header := http.Header{}
+	header.Set("Content-Security-Policy", "script-src 'self'; img-src 'none'")
+	policy := NewDocumentPolicy(mustParse(t, server.URL+"/page"), header)
+	ctx := WithDocumentPolicy(context.Background(), policy)
+	s := NewScheduler(NewFetcherWith(nil, nil))
+
+	if _, err := s.Fetch(ctx, ResourceRequest{URL: server.URL + "/app.js", Type: ResourceScript}); err != nil {
+		t.Errorf("Expected the page's own script to load, got %v", err)
+	}
+	if _, err := s.Fetch(ctx, ResourceRequest{URL: server.URL + "/a.png", Type: ResourceImage}); !errors.Is(err, ErrCSPViolation) {
+		t.Errorf("Expected img-src 'none' to block images, got %v", err)
+	}
+	if _, err := s.Fetch(ctx, ResourceRequest{URL: "data:image/png;base64,", Type: ResourceImage}); !errors.Is(err, ErrCSPViolation) {
+		t.Errorf("Expected img-src 'none' to block data: images, got %v", err)
+	}
+	if _, err := s.Fetch(ctx, ResourceRequest{URL: server.URL + "/redirect", Type: ResourceScript}); !errors.Is(err, ErrCSPViolation) {
+		t.Errorf("Expected the redirect to another origin to be blocked, got %v", err)
+	}
+	if server.requests.Load() != 2 {
+		t.Errorf("Expected blocked loads not to be sent, got %d requests", server.requests.Load())
+	}
+}
@@ -0,0 +1,277 @@
+package net
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Connection limits of a Scheduler, as in other browsers
+const (
+	DefaultMaxPerHost     = 6
+	DefaultMaxConnections = 16
+)
+
+// ResourceType is the kind of resource a request loads
+type ResourceType int
+
+const (
+	ResourceDocument ResourceType = iota
+	ResourceStylesheet
+	ResourceScript
+	ResourceFont
+	ResourceImage
+	ResourceOther
+)
+
+// String names the resource type, such as "stylesheet"
+func (t ResourceType) String() string {
+	switch t {
+	case ResourceDocument:
+		return "document"
+	case ResourceStylesheet:
+		return "stylesheet"
+	case ResourceScript:
+		return "script"
+	case ResourceFont:
+		return "font"
+	case ResourceImage:
+		return "image"
+	default:
+		return "other"
+	}
+}
+
+type resourceTypeKey struct{}
+
+// WithResourceType returns a context whose requests load a resource of the
+// given type, so interceptors can tell scripts from images
+func WithResourceType(ctx context.Context, t ResourceType) context.Context {
+	return context.WithValue(ctx, resourceTypeKey{}, t)
+}
+
+// ResourceTypeFrom returns the resource type of a request context,
+// ResourceOther when it has none
+func ResourceTypeFrom(ctx context.Context) ResourceType {
+	if t, ok := ctx.Value(resourceTypeKey{}).(ResourceType); ok {
+		return t
+	}
+	return ResourceOther
+}
+
+// Priority orders queued requests; lower priorities are sent first
+type Priority int
+
+const (
+	PriorityDocument Priority = iota
+	PriorityStylesheet
+	PriorityScript
+	PriorityVisibleImage
+	PriorityOffscreenImage
+	PriorityLow
+)
+
+// ResourceRequest is a request for a resource through a Scheduler
+type ResourceRequest struct {
+	URL        string
+	Type       ResourceType
+	Offscreen  bool             // An image outside the viewport, loaded after visible ones
+	OnProgress ProgressCallback // Reports download progress; may be nil
+}
+
+// Priority returns the priority of the request: the document, then
+// stylesheets and the fonts they use, scripts, visible images and
+// offscreen images
+func (r ResourceRequest) Priority() Priority {
+	switch r.Type {
+	case ResourceDocument:
+		return PriorityDocument
+	case ResourceStylesheet, ResourceFont:
+		return PriorityStylesheet
+	case ResourceScript:
+		return PriorityScript
+	case ResourceImage:
+		if r.Offscreen {
+			return PriorityOffscreenImage
+		}
+		return PriorityVisibleImage
+	default:
+		return PriorityLow
+	}
+}
+
+// DefaultScheduler is the scheduler page loads and subresources share.
+// Its fetcher is created at the first request, after DefaultCache and
+// DefaultCookieJar are set up.
+var DefaultScheduler = NewScheduler(nil)
+
+// Scheduler queues resource requests by priority and sends them within
+// per-host and global connection limits. Requests of the same priority are
+// sent in the order they were made. A request is cancelled, queued or in
+// flight, when its context is done, such as when its tab navigates away.
+type Scheduler struct {
+	fetcher     *Fetcher
+	fetcherOnce sync.Once
+
+	mu           sync.Mutex
+	maxPerHost   int
+	maxTotal     int
+	queue        []*scheduledRequest // By priority, then sequence
+	active       int
+	activeByHost map[string]int
+	seq          uint64
+}
+
+// scheduledRequest is a request waiting for, or holding, a connection slot
+type scheduledRequest struct {
+	host     string
+	priority Priority
+	seq      uint64
+	ready    chan struct{} // Closed when the request is given a slot
+	granted  bool
+}
+
+// NewScheduler creates a scheduler sending requests with a fetcher; nil
+// means NewFetcher
+func NewScheduler(fetcher *Fetcher) *Scheduler {
+	return &Scheduler{
+		fetcher:      fetcher,
+		maxPerHost:   DefaultMaxPerHost,
+		maxTotal:     DefaultMaxConnections,
+		activeByHost: make(map[string]int),
+	}
+}
+
+// Fetcher returns the fetcher requests are sent with
+func (s *Scheduler) Fetcher() *Fetcher {
+	s.fetcherOnce.Do(func() {
+		if s.fetcher == nil {
+			s.fetcher = NewFetcher()
+		}
+	})
+	return s.fetcher
+}
+
+// SetLimits sets how many requests may be in flight to one host and in
+// total; values below one are treated as one
+func (s *Scheduler) SetLimits(maxPerHost, maxTotal int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxPerHost, s.maxTotal = max(maxPerHost, 1), max(maxTotal, 1)
+	s.dispatch()
+}
+
+// Pending returns how many requests are waiting for a connection slot
+func (s *Scheduler) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+// Active returns how many requests are in flight
+func (s *Scheduler) Active() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active
+}
+
+// Fetch queues a request and fetches it once its turn comes, returning
+// like Fetcher.FetchWithContext. Response.Timing.Queued says how long it
+// waited. URLs that are not fetched over the network, such as data: URLs,
+// need no connection and are not queued. The request's context carries
+// its resource type, see ResourceTypeFrom.
+func (s *Scheduler) Fetch(ctx context.Context, req ResourceRequest) (*Response, error) {
+	ctx = WithResourceType(ctx, req.Type)
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if scheme := strings.ToLower(u.Scheme); scheme != "http" && scheme != "https" {
+		return s.Fetcher().FetchWithContext(ctx, req.URL, req.OnProgress)
+	}
+
+	queuedAt := time.Now()
+	sr, err := s.wait(ctx, strings.ToLower(u.Host), req.Priority())
+	if err != nil {
+		return nil, err
+	}
+	defer s.release(sr)
+	queued := time.Since(queuedAt)
+
+	resp, err := s.Fetcher().FetchWithContext(ctx, req.URL, req.OnProgress)
+	if resp != nil {
+		resp.Timing.Queued = queued
+	}
+	return resp, err
+}
+
+// wait queues a request and blocks until it is given a connection slot or
+// its context is done
+func (s *Scheduler) wait(ctx context.Context, host string, priority Priority) (*scheduledRequest, error) {
+	s.mu.Lock()
+	s.seq++
+	sr := &scheduledRequest{host: host, priority: priority, seq: s.seq, ready: make(chan struct{})}
+	i, _ := slices.BinarySearchFunc(s.queue, sr, compareScheduled)
+	s.queue = slices.Insert(s.queue, i, sr)
+	s.dispatch()
+	s.mu.Unlock()
+
+	select {
+	case <-sr.ready:
+		return sr, nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		if sr.granted {
+			// The slot was given as the context ended; pass it on
+			s.mu.Unlock()
+			s.release(sr)
+			return nil, ctx.Err()
+		}
+		if i := slices.Index(s.queue, sr); i >= 0 {
+			s.queue = slices.Delete(s.queue, i, i+1)
+		}
+		s.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// release frees the connection slot of a finished request
+func (s *Scheduler) release(sr *scheduledRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active--
+	if s.activeByHost[sr.host]--; s.activeByHost[sr.host] == 0 {
+		delete(s.activeByHost, sr.host)
+	}
+	s.dispatch()
+}
+
+// dispatch gives free connection slots to queued requests in priority
+// order, skipping those whose host is at its limit. The caller holds s.mu.
+func (s *Scheduler) dispatch() {
+	for i := 0; i < len(s.queue) && s.active < s.maxTotal; {
+		sr := s.queue[i]
+		if s.activeByHost[sr.host] >= s.maxPerHost {
+			i++
+			continue
+		}
+		s.queue = slices.Delete(s.queue, i, i+1)
+		s.active++
+		s.activeByHost[sr.host]++
+		sr.granted = true
+		close(sr.ready)
+	}
+}
+
+// compareScheduled orders requests by priority, then by when they were made
+func compareScheduled(a, b *scheduledRequest) int {
+	if c := cmp.Compare(a.priority, b.priority); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.seq, b.seq)
+}
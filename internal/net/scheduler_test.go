@@ -0,0 +1,172 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingServer serves every path but /block at once; /block waits until
+// release is closed. It records the paths in the order they arrive.
+type blockingServer struct {
+	*cacheTestServer
+	release chan struct{}
+	mu      sync.Mutex
+	paths   []string
+}
+
+func newBlockingServer(t *testing.T) *blockingServer {
+	s := &blockingServer{release: make(chan struct{})}
+	s.cacheTestServer = newCacheTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.paths = append(s.paths, r.URL.Path)
+		s.mu.Unlock()
+		if r.URL.Path == "/block" {
+			<-s.release
+		}
+		w.Write([]byte(r.URL.Path))
+	})
+	// Handlers must return before the server can close
+	t.Cleanup(func() {
+		select {
+		case <-s.release:
+		default:
+			close(s.release)
+		}
+	})
+	return s
+}
+
+func (s *blockingServer) arrived() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.paths)
+}
+
+// waitFor polls until a condition holds or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestSchedulerPriorities(t *testing.T) {
+	server := newBlockingServer(t)
+	s := NewScheduler(NewFetcherWith(nil, nil))
+	s.SetLimits(1, 1)
+
+	var wg sync.WaitGroup
+	fetch := func(req ResourceRequest) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := s.Fetch(context.Background(), req)
+			if err != nil {
+				t.Errorf("Fetch(%s) failed: %v", req.URL, err)
+			} else if req.Type != ResourceOther && resp.Timing.Queued <= 0 {
+				t.Errorf("Expected %s to report its time in the queue", req.URL)
+			}
+		}()
+	}
+	fetch(ResourceRequest{URL: server.URL + "/block", Type: ResourceOther})
+	waitFor(t, "the first request", func() bool { return s.Active() == 1 })
+
+	requests := []ResourceRequest{
+		{URL: server.URL + "/offscreen.png", Type: ResourceImage, Offscreen: true},
+		{URL: server.URL + "/app.js", Type: ResourceScript},
+		{URL: server.URL + "/hero.png", Type: ResourceImage},
+		{URL: server.URL + "/font.woff2", Type: ResourceFont},
+		{URL: server.URL + "/style.css", Type: ResourceStylesheet},
+		{URL: server.URL + "/page", Type: ResourceDocument},
+	}
+	for i, req := range requests {
+		fetch(req)
+		waitFor(t, "the request to be queued", func() bool { return s.Pending() == i+1 })
+	}
+
+	// Local URLs need no connection and skip the queue
+	if resp, err := s.Fetch(context.Background(), ResourceRequest{URL: "data:,now"}); err != nil || resp.Text != "now" {
+		t.Errorf("Expected data: URLs not to wait, got %+v, %v", resp, err)
+	}
+
+	close(server.release)
+	wg.Wait()
+	expected := []string{"/block", "/page", "/font.woff2", "/style.css", "/app.js", "/hero.png", "/offscreen.png"}
+	if got := server.arrived(); !slices.Equal(got, expected) {
+		t.Errorf("Expected requests in priority order %v, got %v", expected, got)
+	}
+}
+
+func TestSchedulerHostLimits(t *testing.T) {
+	busy, other := newBlockingServer(t), newBlockingServer(t)
+	s := NewScheduler(NewFetcherWith(nil, nil))
+	s.SetLimits(1, 2)
+
+	done := make(chan struct{})
+	go func() {
+		s.Fetch(context.Background(), ResourceRequest{URL: busy.URL + "/block"})
+		close(done)
+	}()
+	waitFor(t, "the first request", func() bool { return s.Active() == 1 })
+	go s.Fetch(context.Background(), ResourceRequest{URL: busy.URL + "/second"})
+	waitFor(t, "the second request to be queued", func() bool { return s.Pending() == 1 })
+
+	// Another host still has a free slot
+	resp, err := s.Fetch(context.Background(), ResourceRequest{URL: other.URL + "/free"})
+	if err != nil || resp.Text != "/free" {
+		t.Fatalf("Expected the other host not to wait, got %+v, %v", resp, err)
+	}
+	if s.Pending() != 1 || len(busy.arrived()) != 1 {
+		t.Errorf("Expected the busy host to stay at its limit, got %v", busy.arrived())
+	}
+
+	close(busy.release)
+	<-done
+	waitFor(t, "the queued request", func() bool { return len(busy.arrived()) == 2 })
+	waitFor(t, "the slots to be freed", func() bool { return s.Active() == 0 })
+}
+
+func TestSchedulerCancellation(t *testing.T) {
+	server := newBlockingServer(t)
+	s := NewScheduler(NewFetcherWith(nil, nil))
+	s.SetLimits(1, 1)
+
+	go s.Fetch(context.Background(), ResourceRequest{URL: server.URL + "/block"})
+	waitFor(t, "the first request", func() bool { return s.Active() == 1 })
+
+	// Navigating away cancels the requests of the old page
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	for _, path := range []string{"/a.png", "/b.png"} {
+		go func() {
+			_, err := s.Fetch(ctx, ResourceRequest{URL: server.URL + path, Type: ResourceImage})
+			errs <- err
+		}()
+	}
+	waitFor(t, "the requests to be queued", func() bool { return s.Pending() == 2 })
+	cancel()
+	for range 2 {
+		if err := <-errs; !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	}
+	if s.Pending() != 0 {
+		t.Errorf("Expected the cancelled requests to leave the queue, %d remain", s.Pending())
+	}
+
+	close(server.release)
+	resp, err := s.Fetch(context.Background(), ResourceRequest{URL: server.URL + "/next", Type: ResourceDocument})
+	if err != nil || resp.Text != "/next" {
+		t.Fatalf("Expected the next page to load, got %+v, %v", resp, err)
+	}
+	if got := server.arrived(); !slices.Equal(got, []string{"/block", "/next"}) {
+		t.Errorf("Expected cancelled requests never to be sent, got %v", got)
+	}
+}
@@ -0,0 +1,270 @@
+package net
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// SchemeHandler loads the URLs of a scheme that is not fetched over HTTP,
+// returning the headers and body of the resource
+type SchemeHandler func(ctx context.Context, u *url.URL) (http.Header, []byte, error)
+
+// AboutPage generates the HTML of an internal about: page
+type AboutPage func() string
+
+// aboutBlank is the empty document of about:blank
+const aboutBlank = "<!DOCTYPE html><html><head></head><body></body></html>"
+
+// ErrUnsupportedScheme is returned for URLs of a scheme no handler loads
+var ErrUnsupportedScheme = errors.New("unsupported URL scheme")
+
+// ErrLocalResource is returned when a document that is not a local file
+// loads a file: or view-source: URL as a subresource
+var ErrLocalResource = errors.New("not allowed to load local resource")
+
+// localResourceAllowed reports whether a request may load a URL of a scheme
+// reading the local machine: navigations may, and so may the subresources
+// of a file: document or of requests made outside any document
+func localResourceAllowed(ctx context.Context, scheme string) bool {
+	if scheme != "file" && scheme != "view-source" || ResourceTypeFrom(ctx) == ResourceDocument {
+		return true
+	}
+	document := cookieSiteFrom(ctx)
+	if policy := DocumentPolicyFrom(ctx); policy != nil {
+		document = policy.URL
+	}
+	return document == nil || strings.EqualFold(document.Scheme, "file")
+}
+
+// HandleScheme sets the handler loading the URLs of a scheme, replacing
+// the built-in one. HTTP and HTTPS cannot be replaced.
+func (f *Fetcher) HandleScheme(scheme string, handler SchemeHandler) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.schemes[strings.ToLower(scheme)] = handler
+}
+
+// HandleAbout sets the page generated for about:name, such as about:history
+func (f *Fetcher) HandleAbout(name string, page AboutPage) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.aboutPages[strings.ToLower(name)] = page
+}
+
+// CanLoad reports whether rawURL is an absolute URL of a scheme the
+// fetcher loads, rather than a file path or a relative URL
+func (f *Fetcher) CanLoad(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	return scheme == "http" || scheme == "https" || f.schemeHandler(scheme) != nil
+}
+
+// schemeHandler returns the handler of a scheme, nil if it has none
+func (f *Fetcher) schemeHandler(scheme string) SchemeHandler {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.schemes[scheme]
+}
+
+// htmlHeader is the header of a generated page
+func htmlHeader() http.Header {
+	return http.Header{"Content-Type": {"text/html; charset=utf-8"}}
+}
+
+// loadFile reads a file:// URL; directories get a generated listing
+func loadFile(ctx context.Context, u *url.URL) (http.Header, []byte, error) {
+	if u.Host != "" && u.Host != "localhost" {
+		return nil, nil, fmt.Errorf("file URLs of remote host %q are not supported", u.Host)
+	}
+	path := u.Path
+	if runtime.GOOS == "windows" {
+		// file:///C:/dir names C:\dir
+		path = filepath.FromSlash(strings.TrimPrefix(path, "/"))
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if info.IsDir() {
+		listing, err := directoryListing(u, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return htmlHeader(), listing, nil
+	}
+
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	// Files declare no charset, so their encoding is sniffed like a server's
+	// pages without one, rather than taken from the system's MIME table
+	contentType, _, _ := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(path)))
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	return http.Header{"Content-Type": {contentType}}, body, nil
+}
+
+// directoryListing generates the page listing a directory, subdirectories first
+func directoryListing(u *url.URL, path string) ([]byte, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+	slices.SortStableFunc(entries, func(a, b os.DirEntry) int {
+		if a.IsDir() != b.IsDir() {
+			if a.IsDir() {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(strings.ToLower(a.Name()), strings.ToLower(b.Name()))
+	})
+
+	// Links are relative to the directory, so it must end in a slash
+	dir := *u
+	if !strings.HasSuffix(dir.Path, "/") {
+		dir.Path += "/"
+	}
+	title := html.EscapeString("Index of " + dir.Path)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html>\n<head>\n<title>%s</title>\n<base href=\"%s\">\n</head>\n<body>\n<h1>%s</h1>\n<table>\n",
+		title, html.EscapeString(dir.String()), title)
+	fmt.Fprintf(&b, "<tr><th>Name</th><th>Size</th><th>Modified</th></tr>\n")
+	if dir.Path != "/" {
+		fmt.Fprintf(&b, "<tr><td><a href=\"../\">../</a></td><td></td><td></td></tr>\n")
+	}
+	for _, entry := range entries {
+		name, size, modified := entry.Name(), "", ""
+		if info, err := entry.Info(); err == nil {
+			modified = info.ModTime().Format("2006-01-02 15:04")
+			if !entry.IsDir() {
+				size = formatSize(info.Size())
+			}
+		}
+		if entry.IsDir() {
+			name += "/"
+		}
+		href := (&url.URL{Path: name}).EscapedPath()
+		fmt.Fprintf(&b, "<tr><td><a href=\"%s\">%s</a></td><td>%s</td><td>%s</td></tr>\n",
+			html.EscapeString(href), html.EscapeString(name), size, modified)
+	}
+	b.WriteString("</table>\n</body>\n</html>\n")
+	return []byte(b.String()), nil
+}
+
+// formatSize formats a file size for a directory listing
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// loadData decodes a data: URL as in RFC 2397,
+// data:[<mediatype>][;base64],<data>
+func loadData(ctx context.Context, u *url.URL) (http.Header, []byte, error) {
+	// The data is in the opaque part as written, still percent-encoded
+	raw := u.Opaque
+	if raw == "" {
+		raw = strings.TrimPrefix(u.String(), u.Scheme+":")
+	} else if u.RawQuery != "" || u.ForceQuery {
+		raw += "?" + u.RawQuery
+	}
+	meta, data, ok := strings.Cut(raw, ",")
+	if !ok {
+		return nil, nil, errors.New("invalid data URL: missing comma")
+	}
+
+	isBase64 := strings.HasSuffix(strings.ToLower(meta), ";base64")
+	if isBase64 {
+		meta = meta[:len(meta)-len(";base64")]
+	}
+	mediaType := strings.TrimSpace(meta)
+	if mediaType == "" || strings.HasPrefix(mediaType, ";") {
+		mediaType = "text/plain" + mediaType
+		if !strings.Contains(strings.ToLower(mediaType), "charset=") {
+			mediaType += ";charset=US-ASCII"
+		}
+	}
+	if unescaped, err := url.PathUnescape(mediaType); err == nil {
+		mediaType = unescaped
+	}
+
+	body, err := url.PathUnescape(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid data URL: %w", err)
+	}
+	if isBase64 {
+		// Whitespace and missing padding are allowed, as in browsers
+		encoded := strings.TrimRight(strings.Join(strings.Fields(body), ""), "=")
+		decoded, err := base64.RawStdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid data URL: %w", err)
+		}
+		body = string(decoded)
+	}
+	return http.Header{"Content-Type": {mediaType}}, []byte(body), nil
+}
+
+// loadAbout generates an internal about: page
+func (f *Fetcher) loadAbout(ctx context.Context, u *url.URL) (http.Header, []byte, error) {
+	name := strings.ToLower(u.Opaque)
+	if name == "blank" {
+		return htmlHeader(), []byte(aboutBlank), nil
+	}
+	f.mu.RLock()
+	page := f.aboutPages[name]
+	f.mu.RUnlock()
+	if page == nil {
+		return nil, nil, fmt.Errorf("unknown page about:%s", name)
+	}
+	return htmlHeader(), []byte(page()), nil
+}
+
+// loadViewSource fetches the URL after view-source: and generates a page
+// showing its source as text
+func (f *Fetcher) loadViewSource(ctx context.Context, u *url.URL) (http.Header, []byte, error) {
+	target := strings.TrimPrefix(u.String(), u.Scheme+":")
+	if inner, err := url.Parse(target); err != nil || strings.EqualFold(inner.Scheme, "view-source") {
+		return nil, nil, fmt.Errorf("invalid view-source URL %q", target)
+	}
+	resp, err := f.FetchWithContext(ctx, target, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	source := resp.Text
+	if source == "" && len(resp.Body) > 0 {
+		source = string(resp.Body)
+	}
+
+	title := html.EscapeString(u.Scheme + ":" + resp.URL)
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html>\n<head>\n<title>%s</title>\n</head>\n<body>\n<pre>", title)
+	b.WriteString(html.EscapeString(source))
+	b.WriteString("</pre>\n</body>\n</html>\n")
+	return htmlHeader(), []byte(b.String()), nil
+}
@@ -0,0 +1,153 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFetchDataURLs(t *testing.T) {
+	tests := []struct {
+		url, contentType, text string
+	}{
+		{"data:,Hello%2C%20World!", "text/plain;charset=US-ASCII", "Hello, World!"},
+		{"data:text/plain;base64,SGVsbG8sIFdvcmxkIQ==", "text/plain", "Hello, World!"},
+		{"data:text/plain;BASE64,SGVs%20bG8%0A", "text/plain", "Hello"},
+		{"data:;charset=utf-8,%E2%9C%93", "text/plain;charset=utf-8", "✓"},
+		{"data:text/html,<p>a?b</p>", "text/html", "<p>a?b</p>"},
+	}
+	f := NewFetcherWith(nil, nil)
+	for _, tt := range tests {
+		resp, err := f.Fetch(tt.url)
+		if err != nil {
+			t.Errorf("Fetch(%q) failed: %v", tt.url, err)
+			continue
+		}
+		if got := resp.Header.Get("Content-Type"); got != tt.contentType || resp.Text != tt.text || !resp.OK() {
+			t.Errorf("Expected %q as %s from %q, got %q as %s", tt.text, tt.contentType, tt.url, resp.Text, got)
+		}
+	}
+
+	for _, bad := range []string{"data:text/plain", "data:;base64,!!!"} {
+		if _, err := f.Fetch(bad); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestFetchFileURLs(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "sub dir"), 0755)
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<p>Caf\xe9</p>"), 0644)
+	os.WriteFile(filepath.Join(dir, "notes"), []byte("plain text"), 0644)
+	f := NewFetcherWith(nil, nil)
+	fileURL := func(path string) string {
+		return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+	}
+
+	resp, err := f.Fetch(fileURL(filepath.Join(dir, "index.html")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ContentType != "text/html" || resp.Text != "<p>Café</p>" {
+		t.Errorf("Expected a decoded HTML file, got %q as %s", resp.Text, resp.ContentType)
+	}
+	if resp, err = f.Fetch(fileURL(filepath.Join(dir, "notes"))); err != nil || !strings.HasPrefix(resp.ContentType, "text/plain") {
+		t.Errorf("Expected a sniffed text file, got %+v, %v", resp, err)
+	}
+
+	resp, err = f.Fetch(fileURL(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, index := strings.Index(resp.Text, `href="sub%20dir/"`), strings.Index(resp.Text, `href="index.html"`)
+	if resp.ContentType != "text/html" || sub < 0 || index < sub || !strings.Contains(resp.Text, `href="../"`) {
+		t.Errorf("Expected a listing with directories first, got %s", resp.Text)
+	}
+
+	if _, err := f.Fetch(fileURL(filepath.Join(dir, "missing"))); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+	if _, err := f.Fetch("file://server/share/file"); err == nil {
+		t.Error("Expected an error for a remote file URL")
+	}
+}
+
+func TestFetchAboutAndViewSource(t *testing.T) {
+	server := newCacheTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<b>bold & brave</b>"))
+	})
+	f := NewFetcherWith(nil, nil)
+	f.HandleAbout("history", func() string { return "<h1>History</h1>" })
+
+	if resp, err := f.Fetch("about:blank"); err != nil || resp.ContentType != "text/html" || resp.URL != "about:blank" {
+		t.Errorf("Expected about:blank to be an empty document, got %+v, %v", resp, err)
+	}
+	if resp, err := f.Fetch("about:History"); err != nil || resp.Text != "<h1>History</h1>" {
+		t.Errorf("Expected the registered about page, got %+v, %v", resp, err)
+	}
+	if _, err := f.Fetch("about:nothing"); err == nil {
+		t.Error("Expected an error for an unknown about page")
+	}
+
+	resp, err := f.Fetch("view-source:" + server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(resp.Text, "<pre>&lt;b&gt;bold &amp; brave&lt;/b&gt;</pre>") || resp.URL != "view-source:"+server.URL {
+		t.Errorf("Expected the escaped source, got %s", resp.Text)
+	}
+	if _, err := f.Fetch("view-source:view-source:" + server.URL); err == nil {
+		t.Error("Expected nested view-source to be rejected")
+	}
+
+	if _, err := f.Fetch("gopher://example.com/"); !errors.Is(err, ErrUnsupportedScheme) {
+		t.Errorf("Expected ErrUnsupportedScheme, got %v", err)
+	}
+	f.HandleScheme("gopher", func(ctx context.Context, u *url.URL) (http.Header, []byte, error) {
+		return nil, []byte("hole"), nil
+	})
+	if resp, err := f.Fetch("gopher://example.com/"); err != nil || string(resp.Body) != "hole" || !f.CanLoad("gopher://x") {
+		t.Errorf("Expected the registered scheme handler, got %+v, %v", resp, err)
+	}
+}
+
+func TestLocalSubresources(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0644)
+	fileURL := (&url.URL{Scheme: "file", Path: filepath.ToSlash(filepath.Join(dir, "secret.txt"))}).String()
+	pageURL := (&url.URL{Scheme: "file", Path: filepath.ToSlash(filepath.Join(dir, "index.html"))}).String()
+	f := NewFetcherWith(nil, nil)
+
+	webPage := WithDocumentPolicy(context.Background(), NewDocumentPolicy(mustParse(t, "https://site.example/"), nil))
+	localPage := WithDocumentPolicy(context.Background(), NewDocumentPolicy(mustParse(t, pageURL), nil))
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		url     string
+		allowed bool
+	}{
+		{"web page image", WithResourceType(webPage, ResourceImage), fileURL, false},
+		{"web page script", WithResourceType(webPage, ResourceScript), "view-source:" + fileURL, false},
+		{"cookie site only", WithResourceType(WithCookieSite(context.Background(), mustParse(t, "https://site.example/")), ResourceFont), fileURL, false},
+		{"web page data URL", WithResourceType(webPage, ResourceImage), "data:,ok", true},
+		{"navigation", WithResourceType(webPage, ResourceDocument), fileURL, true},
+		{"local page image", WithResourceType(localPage, ResourceImage), fileURL, true},
+		{"no document", WithResourceType(context.Background(), ResourceImage), fileURL, true},
+	}
+	for _, tt := range tests {
+		_, err := f.FetchWithContext(tt.ctx, tt.url, nil)
+		if allowed := err == nil; allowed != tt.allowed {
+			t.Errorf("%s: expected allowed %v, got %v", tt.name, tt.allowed, err)
+		}
+		if err != nil && !errors.Is(err, ErrLocalResource) {
+			t.Errorf("%s: expected ErrLocalResource, got %v", tt.name, err)
+		}
+	}
+}
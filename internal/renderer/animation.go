@@ -0,0 +1,1113 @@
+package renderer
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vyquocvu/goosie/internal/css"
+)
+
+// frameInterval is the time between animation frames on screen
+const frameInterval = time.Second / 60
+
+// Clock is the time source of an animation timeline
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock reads the wall clock
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// VirtualClock is a Clock that only moves when advanced, so tests and
+// headless renders sample animations at exact times
+type VirtualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewVirtualClock creates a virtual clock starting at the Unix epoch
+func NewVirtualClock() *VirtualClock {
+	return &VirtualClock{now: time.Unix(0, 0)}
+}
+
+// Now returns the virtual time
+func (c *VirtualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the virtual time forward by d
+func (c *VirtualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// TimingFunction is a CSS easing function: a cubic Bézier curve from (0, 0)
+// to (1, 1) through two control points, or a step function when Steps is
+// positive
+type TimingFunction struct {
+	X1, Y1, X2, Y2 float64
+	Steps          int
+	JumpTerm       string // "jump-start", "jump-end", "jump-none" or "jump-both"
+}
+
+var easeTiming = TimingFunction{X1: 0.25, Y1: 0.1, X2: 0.25, Y2: 1}
+
+var timingKeywords = map[string]TimingFunction{
+	"linear":      {X1: 0, Y1: 0, X2: 1, Y2: 1},
+	"ease":        easeTiming,
+	"ease-in":     {X1: 0.42, Y1: 0, X2: 1, Y2: 1},
+	"ease-out":    {X1: 0, Y1: 0, X2: 0.58, Y2: 1},
+	"ease-in-out": {X1: 0.42, Y1: 0, X2: 0.58, Y2: 1},
+	"step-start":  {Steps: 1, JumpTerm: "jump-start"},
+	"step-end":    {Steps: 1, JumpTerm: "jump-end"},
+}
+
+// parseTimingFunction parses an easing keyword, cubic-bezier() or steps()
+func parseTimingFunction(value string) (TimingFunction, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if tf, ok := timingKeywords[value]; ok {
+		return tf, true
+	}
+	name, arg, ok := parseCSSFunction(value)
+	if !ok {
+		return TimingFunction{}, false
+	}
+	args := splitTopLevel(arg, ',')
+
+	switch name {
+	case "cubic-bezier":
+		if len(args) != 4 {
+			return TimingFunction{}, false
+		}
+		var points [4]float64
+		for i, arg := range args {
+			point, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return TimingFunction{}, false
+			}
+			points[i] = point
+		}
+		// The curve must be a function of x
+		if points[0] < 0 || points[0] > 1 || points[2] < 0 || points[2] > 1 {
+			return TimingFunction{}, false
+		}
+		return TimingFunction{X1: points[0], Y1: points[1], X2: points[2], Y2: points[3]}, true
+
+	case "steps":
+		if len(args) == 0 || len(args) > 2 {
+			return TimingFunction{}, false
+		}
+		steps, err := strconv.Atoi(args[0])
+		tf := TimingFunction{Steps: steps, JumpTerm: "jump-end"}
+		if len(args) == 2 {
+			switch args[1] {
+			case "start", "jump-start":
+				tf.JumpTerm = "jump-start"
+			case "end", "jump-end":
+			case "jump-none", "jump-both":
+				tf.JumpTerm = args[1]
+			default:
+				return TimingFunction{}, false
+			}
+		}
+		if err != nil || steps < 1 || tf.JumpTerm == "jump-none" && steps < 2 {
+			return TimingFunction{}, false
+		}
+		return tf, true
+	}
+	return TimingFunction{}, false
+}
+
+// At returns the eased progress for an input progress from 0 to 1
+func (tf TimingFunction) At(progress float64) float64 {
+	if tf.Steps > 0 {
+		return tf.step(progress)
+	}
+	if progress <= 0 || progress >= 1 || tf.X1 == tf.Y1 && tf.X2 == tf.Y2 {
+		return progress
+	}
+
+	// Find the curve parameter for the progress on the x axis by bisection,
+	// which converges for every valid curve
+	lo, hi := 0.0, 1.0
+	for i := 0; i < 40; i++ {
+		t := (lo + hi) / 2
+		if bezier(tf.X1, tf.X2, t) < progress {
+			lo = t
+		} else {
+			hi = t
+		}
+	}
+	return bezier(tf.Y1, tf.Y2, (lo+hi)/2)
+}
+
+// step returns the output of a step function
+func (tf TimingFunction) step(progress float64) float64 {
+	if progress >= 1 {
+		return 1
+	}
+	if progress < 0 {
+		return 0
+	}
+	step := math.Floor(progress * float64(tf.Steps))
+	jumps := float64(tf.Steps)
+	switch tf.JumpTerm {
+	case "jump-start":
+		step++
+	case "jump-none":
+		jumps--
+	case "jump-both":
+		step++
+		jumps++
+	}
+	return math.Min(step/jumps, 1)
+}
+
+// bezier evaluates one coordinate of a cubic Bézier curve from 0 to 1 with
+// control points p1 and p2
+func bezier(p1, p2, t float64) float64 {
+	u := 1 - t
+	return 3*u*u*t*p1 + 3*u*t*t*p2 + t*t*t
+}
+
+// parseTime parses a CSS time in seconds or milliseconds
+func parseTime(value string) (time.Duration, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	scale := time.Second
+	number, ok := strings.CutSuffix(value, "ms")
+	if ok {
+		scale = time.Millisecond
+	} else if number, ok = strings.CutSuffix(value, "s"); !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseFloat(number, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds * float64(scale)), true
+}
+
+// parseAnimationList splits the comma separated values of a transition or
+// animation longhand
+func parseAnimationList(value string) []string {
+	return splitTopLevel(strings.ToLower(value), ',')
+}
+
+// animationValue returns the value of a transition or animation list
+// property for the i-th name, repeating the list when it is shorter
+func animationValue(values []string, i int, initial string) string {
+	if len(values) == 0 {
+		return initial
+	}
+	return values[i%len(values)]
+}
+
+var (
+	animationDirectionKeywords = []string{"normal", "reverse", "alternate", "alternate-reverse"}
+	animationFillModeKeywords  = []string{"none", "forwards", "backwards", "both"}
+	animationPlayStateKeywords = []string{"running", "paused"}
+)
+
+// parseTransitionShorthand parses the transition shorthand into the
+// transition longhands, one value per comma separated transition
+func parseTransitionShorthand(value string, style *Style) {
+	var properties, durations, timings, delays []string
+	for _, item := range splitTopLevel(strings.ToLower(value), ',') {
+		property, duration, timing, delay := "all", "0s", "ease", "0s"
+		seenDuration := false
+		for _, part := range splitTopLevel(item, ' ') {
+			if _, ok := parseTime(part); ok {
+				if seenDuration {
+					delay = part
+				} else {
+					duration, seenDuration = part, true
+				}
+			} else if _, ok := parseTimingFunction(part); ok {
+				timing = part
+			} else {
+				property = part
+			}
+		}
+		properties = append(properties, property)
+		durations = append(durations, duration)
+		timings = append(timings, timing)
+		delays = append(delays, delay)
+	}
+	style.TransitionProperty = properties
+	style.TransitionDuration = durations
+	style.TransitionTimingFunction = timings
+	style.TransitionDelay = delays
+}
+
+// parseAnimationShorthand parses the animation shorthand into the animation
+// longhands, one value per comma separated animation
+func parseAnimationShorthand(value string, style *Style) {
+	var names, durations, timings, delays, counts, directions, fillModes, playStates []string
+	for _, item := range splitTopLevel(value, ',') {
+		name, duration, timing, delay := "none", "0s", "ease", "0s"
+		count, direction, fillMode, playState := "1", "normal", "none", "running"
+		seenDuration := false
+		for _, part := range splitTopLevel(item, ' ') {
+			lower := strings.ToLower(part)
+			if _, ok := parseTime(lower); ok {
+				if seenDuration {
+					delay = lower
+				} else {
+					duration, seenDuration = lower, true
+				}
+				continue
+			}
+			if _, err := strconv.ParseFloat(lower, 64); err == nil || lower == "infinite" {
+				count = lower
+				continue
+			}
+			switch {
+			case isKeyword(lower, animationDirectionKeywords):
+				direction = lower
+			case isKeyword(lower, animationFillModeKeywords):
+				fillMode = lower
+			case isKeyword(lower, animationPlayStateKeywords):
+				playState = lower
+			default:
+				if _, ok := parseTimingFunction(lower); ok {
+					timing = lower
+				} else {
+					name = strings.Trim(part, `"'`)
+				}
+			}
+		}
+		names = append(names, name)
+		durations = append(durations, duration)
+		timings = append(timings, timing)
+		delays = append(delays, delay)
+		counts = append(counts, count)
+		directions = append(directions, direction)
+		fillModes = append(fillModes, fillMode)
+		playStates = append(playStates, playState)
+	}
+	style.AnimationName = names
+	style.AnimationDuration = durations
+	style.AnimationTimingFunction = timings
+	style.AnimationDelay = delays
+	style.AnimationIterationCount = counts
+	style.AnimationDirection = directions
+	style.AnimationFillMode = fillModes
+	style.AnimationPlayState = playStates
+}
+
+// transitionSpec is one entry of the transition properties of a style
+type transitionSpec struct {
+	property        string
+	duration, delay time.Duration
+	timing          TimingFunction
+}
+
+// transitionSpecs resolves the transition lists of a style
+func transitionSpecs(style *Style) []transitionSpec {
+	properties := style.TransitionProperty
+	if len(properties) == 0 && len(style.TransitionDuration) > 0 {
+		properties = []string{"all"}
+	}
+	specs := make([]transitionSpec, 0, len(properties))
+	for i, property := range properties {
+		spec := transitionSpec{property: property, timing: easeTiming}
+		spec.duration, _ = parseTime(animationValue(style.TransitionDuration, i, "0s"))
+		spec.delay, _ = parseTime(animationValue(style.TransitionDelay, i, "0s"))
+		if tf, ok := parseTimingFunction(animationValue(style.TransitionTimingFunction, i, "ease")); ok {
+			spec.timing = tf
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// findTransition returns the last transition of a list that applies to a
+// property
+func findTransition(specs []transitionSpec, property string) (transitionSpec, bool) {
+	for i := len(specs) - 1; i >= 0; i-- {
+		spec := specs[i]
+		if spec.property == property || spec.property == "all" || isKeyword(property, animatableShorthands[spec.property]) {
+			return spec, true
+		}
+	}
+	return transitionSpec{}, false
+}
+
+// animatableShorthands maps transition-property shorthands to the animatable
+// longhands they stand for
+var animatableShorthands = map[string][]string{
+	"margin":        {"margin-top", "margin-right", "margin-bottom", "margin-left"},
+	"padding":       {"padding-top", "padding-right", "padding-bottom", "padding-left"},
+	"border-width":  {"border-top-width", "border-right-width", "border-bottom-width", "border-left-width"},
+	"border-color":  {"border-top-color", "border-right-color", "border-bottom-color", "border-left-color"},
+	"border-radius": {"border-top-left-radius", "border-top-right-radius", "border-bottom-right-radius", "border-bottom-left-radius"},
+	"border": {"border-top-width", "border-right-width", "border-bottom-width", "border-left-width",
+		"border-top-color", "border-right-color", "border-bottom-color", "border-left-color"},
+	"outline":    {"outline-color", "outline-width", "outline-offset"},
+	"background": {"background-color"},
+}
+
+// animatableProperties reads the computed values of the properties that
+// transitions and animations interpolate. Values are written back with
+// StyleManager.applyDeclaration.
+var animatableProperties = map[string]func(style *Style) string{
+	"opacity": func(s *Style) string {
+		// An opacity of 0 means the property is unset
+		if s.Opacity <= 0 {
+			return "1"
+		}
+		return formatNumber(float64(s.Opacity))
+	},
+	"font-size": func(s *Style) string {
+		if s.FontSize <= 0 {
+			return ""
+		}
+		return formatNumber(float64(s.FontSize)) + "px"
+	},
+	"color":               func(s *Style) string { return formatColor(s.Color, color.Black) },
+	"background-color":    func(s *Style) string { return formatColor(s.BackgroundColor, color.Transparent) },
+	"border-top-color":    func(s *Style) string { return formatColor(s.BorderTopColor, currentColor(s)) },
+	"border-right-color":  func(s *Style) string { return formatColor(s.BorderRightColor, currentColor(s)) },
+	"border-bottom-color": func(s *Style) string { return formatColor(s.BorderBottomColor, currentColor(s)) },
+	"border-left-color":   func(s *Style) string { return formatColor(s.BorderLeftColor, currentColor(s)) },
+	"outline-color":       func(s *Style) string { return formatColor(s.OutlineColor, currentColor(s)) },
+
+	"width":                      func(s *Style) string { return orInitial(s.Width, "auto") },
+	"height":                     func(s *Style) string { return orInitial(s.Height, "auto") },
+	"margin-top":                 func(s *Style) string { return orInitial(s.MarginTop, "0") },
+	"margin-right":               func(s *Style) string { return orInitial(s.MarginRight, "0") },
+	"margin-bottom":              func(s *Style) string { return orInitial(s.MarginBottom, "0") },
+	"margin-left":                func(s *Style) string { return orInitial(s.MarginLeft, "0") },
+	"padding-top":                func(s *Style) string { return orInitial(s.PaddingTop, "0") },
+	"padding-right":              func(s *Style) string { return orInitial(s.PaddingRight, "0") },
+	"padding-bottom":             func(s *Style) string { return orInitial(s.PaddingBottom, "0") },
+	"padding-left":               func(s *Style) string { return orInitial(s.PaddingLeft, "0") },
+	"border-top-width":           func(s *Style) string { return orInitial(s.BorderTopWidth, "0") },
+	"border-right-width":         func(s *Style) string { return orInitial(s.BorderRightWidth, "0") },
+	"border-bottom-width":        func(s *Style) string { return orInitial(s.BorderBottomWidth, "0") },
+	"border-left-width":          func(s *Style) string { return orInitial(s.BorderLeftWidth, "0") },
+	"border-top-left-radius":     func(s *Style) string { return orInitial(s.BorderTopLeftRadius, "0") },
+	"border-top-right-radius":    func(s *Style) string { return orInitial(s.BorderTopRightRadius, "0") },
+	"border-bottom-right-radius": func(s *Style) string { return orInitial(s.BorderBottomRightRadius, "0") },
+	"border-bottom-left-radius":  func(s *Style) string { return orInitial(s.BorderBottomLeftRadius, "0") },
+	"outline-width":              func(s *Style) string { return orInitial(s.OutlineWidth, "0") },
+	"outline-offset":             func(s *Style) string { return orInitial(s.OutlineOffset, "0") },
+	"letter-spacing":             func(s *Style) string { return orInitial(s.LetterSpacing, "0") },
+	"word-spacing":               func(s *Style) string { return orInitial(s.WordSpacing, "0") },
+	"text-indent":                func(s *Style) string { return orInitial(s.TextIndent, "0") },
+	"transform":                  func(s *Style) string { return orInitial(s.Transform, "none") },
+}
+
+// paintOnlyProperties are the animatable properties that change how boxes
+// are painted but not where they are laid out
+var paintOnlyProperties = map[string]bool{
+	"opacity":                    true,
+	"color":                      true,
+	"background-color":           true,
+	"border-top-color":           true,
+	"border-right-color":         true,
+	"border-bottom-color":        true,
+	"border-left-color":          true,
+	"outline-color":              true,
+	"outline-width":              true,
+	"outline-offset":             true,
+	"border-top-left-radius":     true,
+	"border-top-right-radius":    true,
+	"border-bottom-right-radius": true,
+	"border-bottom-left-radius":  true,
+	"transform":                  true,
+}
+
+// orInitial returns a style value, or the initial value when it is unset
+func orInitial(value, initial string) string {
+	if value == "" || value == "normal" {
+		return initial
+	}
+	return value
+}
+
+// currentColor returns the text color colors default to
+func currentColor(s *Style) color.Color {
+	if s.Color == nil {
+		return color.Black
+	}
+	return s.Color
+}
+
+// formatColor returns a color as an rgba() value, or the initial color's
+// value when it is nil
+func formatColor(c, initial color.Color) string {
+	if c == nil {
+		c = initial
+	}
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return fmt.Sprintf("rgba(%d, %d, %d, %s)", n.R, n.G, n.B, formatNumber(float64(n.A)/255))
+}
+
+// formatNumber formats a number with up to 4 decimals and no exponent
+func formatNumber(v float64) string {
+	// Adding zero turns negative zero into zero
+	return strconv.FormatFloat(math.Round(v*1e4)/1e4+0, 'f', -1, 64)
+}
+
+// interpolate returns the value a fraction p of the way between two computed
+// values, or false when the values cannot be interpolated. Lengths in
+// different units are converted to pixels with the font size.
+func interpolate(from, to string, p float64, fontSize float32) (string, bool) {
+	if from == to {
+		return to, true
+	}
+	if a, err := parseColor(from); err == nil {
+		b, err := parseColor(to)
+		if err != nil {
+			return "", false
+		}
+		return formatColor(lerpColor(a, b, p), nil), true
+	}
+	if a, ok := parseDimension(from); ok {
+		b, ok := parseDimension(to)
+		if !ok {
+			return "", false
+		}
+		return lerpDimension(a, b, p, fontSize)
+	}
+	return interpolateTransforms(from, to, p, fontSize)
+}
+
+// blend interpolates two values, switching from one to the other halfway
+// when they cannot be interpolated
+func blend(from, to string, p float64, fontSize float32) string {
+	if value, ok := interpolate(from, to, p, fontSize); ok {
+		return value
+	}
+	if p < 0.5 {
+		return from
+	}
+	return to
+}
+
+func lerp(a, b, p float64) float64 {
+	return a + (b-a)*p
+}
+
+// lerpColor interpolates two colors with premultiplied alpha, so fading from
+// transparent does not pass through black
+func lerpColor(a, b color.Color, p float64) color.NRGBA {
+	ca := color.NRGBAModel.Convert(a).(color.NRGBA)
+	cb := color.NRGBAModel.Convert(b).(color.NRGBA)
+	alpha := math.Max(0, math.Min(lerp(float64(ca.A), float64(cb.A), p), 255))
+	if alpha == 0 {
+		return color.NRGBA{}
+	}
+	channel := func(x, y uint8) uint8 {
+		v := lerp(float64(x)*float64(ca.A), float64(y)*float64(cb.A), p) / alpha
+		return uint8(math.Round(math.Max(0, math.Min(v, 255))))
+	}
+	return color.NRGBA{R: channel(ca.R, cb.R), G: channel(ca.G, cb.G), B: channel(ca.B, cb.B), A: uint8(math.Round(alpha))}
+}
+
+// dimension is a number and its unit, such as 10px, 50% or a plain 0.5
+type dimension struct {
+	value float64
+	unit  string
+}
+
+// parseDimension splits a value into its number and unit
+func parseDimension(value string) (dimension, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	end := len(value)
+	for end > 0 && (value[end-1] >= 'a' && value[end-1] <= 'z' || value[end-1] == '%') {
+		end--
+	}
+	number, err := strconv.ParseFloat(value[:end], 64)
+	if err != nil {
+		return dimension{}, false
+	}
+	return dimension{value: number, unit: value[end:]}, true
+}
+
+// lerpDimension interpolates two dimensions, converting lengths to pixels
+// when their units differ
+func lerpDimension(a, b dimension, p float64, fontSize float32) (string, bool) {
+	switch {
+	case a.unit == b.unit:
+	case a.value == 0 && a.unit == "":
+		a.unit = b.unit
+	case b.value == 0 && b.unit == "":
+		b.unit = a.unit
+	case isKeyword(a.unit, absoluteLengthUnits) && isKeyword(b.unit, absoluteLengthUnits):
+		a = dimension{value: float64(parseLength(formatNumber(a.value)+a.unit, fontSize)), unit: "px"}
+		b = dimension{value: float64(parseLength(formatNumber(b.value)+b.unit, fontSize)), unit: "px"}
+	default:
+		return "", false
+	}
+	return formatNumber(lerp(a.value, b.value, p)) + a.unit, true
+}
+
+// absoluteLengthUnits are the units parseLength converts to pixels
+var absoluteLengthUnits = []string{"px", "em", "rem"}
+
+// interpolateTransforms interpolates two transform lists whose functions
+// have the same kinds, treating none as the identity of the other list.
+// Matrices are interpolated component-wise rather than decomposed.
+func interpolateTransforms(from, to string, p float64, fontSize float32) (string, bool) {
+	a, ok := transformFunctions(from, fontSize)
+	if !ok {
+		return "", false
+	}
+	b, ok := transformFunctions(to, fontSize)
+	if !ok {
+		return "", false
+	}
+	if a == nil {
+		a = identityFunctions(b)
+	}
+	if b == nil {
+		b = identityFunctions(a)
+	}
+	if len(a) != len(b) || len(a) == 0 {
+		return "", false
+	}
+
+	parts := make([]string, len(a))
+	for i := range a {
+		if a[i].Kind != b[i].Kind {
+			return "", false
+		}
+		fn := a[i]
+		fn.X = LengthPercent{Pixels: float32(lerp(float64(a[i].X.Pixels), float64(b[i].X.Pixels), p)), Fraction: float32(lerp(float64(a[i].X.Fraction), float64(b[i].X.Fraction), p))}
+		fn.Y = LengthPercent{Pixels: float32(lerp(float64(a[i].Y.Pixels), float64(b[i].Y.Pixels), p)), Fraction: float32(lerp(float64(a[i].Y.Fraction), float64(b[i].Y.Fraction), p))}
+		for j := range fn.Values {
+			fn.Values[j] = float32(lerp(float64(a[i].Values[j]), float64(b[i].Values[j]), p))
+		}
+		part, ok := formatTransformFunction(fn)
+		if !ok {
+			return "", false
+		}
+		parts[i] = part
+	}
+	return strings.Join(parts, " "), true
+}
+
+// transformFunctions parses a transform list, returning nil for none
+func transformFunctions(value string, fontSize float32) ([]TransformFunction, bool) {
+	if strings.EqualFold(strings.TrimSpace(value), "none") {
+		return nil, true
+	}
+	t := parseTransform(value, "", fontSize)
+	if t == nil {
+		return nil, false
+	}
+	return t.Functions, true
+}
+
+// identityFunctions returns identity transform functions of the same kinds
+func identityFunctions(functions []TransformFunction) []TransformFunction {
+	identity := make([]TransformFunction, len(functions))
+	for i, fn := range functions {
+		identity[i].Kind = fn.Kind
+		switch fn.Kind {
+		case TransformScale:
+			identity[i].Values[0], identity[i].Values[1] = 1, 1
+		case TransformMatrix:
+			identity[i].Values = [6]float32{1, 0, 0, 1, 0, 0}
+		}
+	}
+	return identity
+}
+
+// formatTransformFunction formats a transform function as CSS. Translations
+// mixing pixels and percentages on one axis cannot be written without calc()
+// and report false.
+func formatTransformFunction(fn TransformFunction) (string, bool) {
+	v := fn.Values
+	switch fn.Kind {
+	case TransformTranslate:
+		x, okX := formatLengthPercent(fn.X)
+		y, okY := formatLengthPercent(fn.Y)
+		return "translate(" + x + ", " + y + ")", okX && okY
+	case TransformScale:
+		return fmt.Sprintf("scale(%s, %s)", formatNumber(float64(v[0])), formatNumber(float64(v[1]))), true
+	case TransformRotate:
+		return fmt.Sprintf("rotate(%sdeg)", formatNumber(float64(v[0]))), true
+	case TransformSkew:
+		return fmt.Sprintf("skew(%sdeg, %sdeg)", formatNumber(float64(v[0])), formatNumber(float64(v[1]))), true
+	default:
+		numbers := make([]string, len(v))
+		for i, number := range v {
+			numbers[i] = formatNumber(float64(number))
+		}
+		return "matrix(" + strings.Join(numbers, ", ") + ")", true
+	}
+}
+
+// formatLengthPercent formats a length or a percentage
+func formatLengthPercent(l LengthPercent) (string, bool) {
+	switch {
+	case l.Fraction == 0:
+		return formatNumber(float64(l.Pixels)) + "px", true
+	case l.Pixels == 0:
+		return formatNumber(float64(l.Fraction)*100) + "%", true
+	}
+	return "", false
+}
+
+// AnimationEvent is a transitionend or animationend event of an element
+type AnimationEvent struct {
+	Type          string // "transitionend" or "animationend"
+	Node          *RenderNode
+	PropertyName  string        // Transitioned property of a transitionend event
+	AnimationName string        // Keyframes name of an animationend event
+	ElapsedTime   time.Duration // Time the transition or animation ran, excluding delays
+}
+
+// keyframe is one offset of a @keyframes rule
+type keyframe struct {
+	offset       float64
+	declarations []css.Declaration
+	timing       *TimingFunction // animation-timing-function of the keyframe
+}
+
+// transition is a running transition of one property of an element
+type transition struct {
+	spec     transitionSpec
+	from, to string
+	start    time.Time
+}
+
+// animation is a @keyframes animation of an element. Animations stay after
+// their last iteration to fill forwards, until the element's animation-name
+// no longer lists them.
+type animation struct {
+	name            string
+	duration, delay time.Duration
+	timing          TimingFunction
+	iterations      float64 // Infinite for animation-iteration-count: infinite
+	direction       string
+	fillMode        string
+	start           time.Time
+	pausedAt        time.Time // Zero while running
+	ended           bool
+}
+
+// AnimationTimeline runs the CSS transitions and @keyframes animations of a
+// document. Style passes apply their values at the clock's time on top of
+// the cascaded styles, so inherited properties reach descendants.
+type AnimationTimeline struct {
+	clock       Clock
+	now         time.Time
+	keyframes   map[string][]keyframe
+	transitions map[*RenderNode]map[string]*transition
+	animations  map[*RenderNode][]*animation
+
+	// Values of elements before a restyle, to start transitions from
+	previous map[*RenderNode]map[string]string
+
+	// End events of the current style pass, in tree order
+	events []AnimationEvent
+}
+
+// NewAnimationTimeline creates a timeline driven by the given clock
+func NewAnimationTimeline(clock Clock) *AnimationTimeline {
+	tl := &AnimationTimeline{clock: clock}
+	tl.Reset(nil)
+	return tl
+}
+
+// Reset collects the @keyframes rules of a new document's stylesheet and
+// drops the transitions and animations of the previous document
+func (tl *AnimationTimeline) Reset(stylesheet *css.StyleSheet) {
+	tl.keyframes = make(map[string][]keyframe)
+	tl.transitions = make(map[*RenderNode]map[string]*transition)
+	tl.animations = make(map[*RenderNode][]*animation)
+	tl.previous = nil
+	tl.events = nil
+	if stylesheet == nil {
+		return
+	}
+
+	for _, rule := range stylesheet.AtRules {
+		if !strings.HasSuffix(strings.ToLower(rule.Name), "keyframes") {
+			continue
+		}
+		var frames []keyframe
+		for _, block := range rule.Keyframes {
+			var timing *TimingFunction
+			declarations := make([]css.Declaration, 0, len(block.Declarations))
+			for _, decl := range block.Declarations {
+				if decl.Property == "animation-timing-function" {
+					if tf, ok := parseTimingFunction(decl.Value); ok {
+						timing = &tf
+					}
+					continue
+				}
+				declarations = append(declarations, decl)
+			}
+			for _, offset := range block.Offsets {
+				frames = append(frames, keyframe{offset: offset, declarations: declarations, timing: timing})
+			}
+		}
+		sort.SliceStable(frames, func(i, j int) bool { return frames[i].offset < frames[j].offset })
+		// Later rules of the same name replace earlier ones
+		tl.keyframes[strings.Trim(strings.TrimSpace(rule.Prelude), `"'`)] = frames
+	}
+}
+
+// Running reports whether a transition or an unpaused animation is still in
+// progress, so frames need to be ticked
+func (tl *AnimationTimeline) Running() bool {
+	if len(tl.transitions) > 0 {
+		return true
+	}
+	for _, animations := range tl.animations {
+		for _, a := range animations {
+			if !a.ended && a.pausedAt.IsZero() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// snapshot records the values of elements before a restyle, so changed
+// properties transition from them. Properties driven by an animation do not
+// start transitions.
+func (tl *AnimationTimeline) snapshot(root *RenderNode) {
+	tl.previous = make(map[*RenderNode]map[string]string)
+	var walk func(node *RenderNode)
+	walk = func(node *RenderNode) {
+		if node.Type == NodeTypeElement && node.ComputedStyle != nil {
+			animated := tl.animatedProperties(node)
+			values := make(map[string]string, len(animatableProperties))
+			for property, get := range animatableProperties {
+				if !animated[property] {
+					values[property] = get(node.ComputedStyle)
+				}
+			}
+			tl.previous[node] = values
+		}
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(root)
+}
+
+// animatedProperties returns the properties the keyframes of an element's
+// animations declare
+func (tl *AnimationTimeline) animatedProperties(node *RenderNode) map[string]bool {
+	properties := make(map[string]bool)
+	for _, a := range tl.animations[node] {
+		for _, frame := range tl.keyframes[a.name] {
+			for _, decl := range frame.declarations {
+				properties[decl.Property] = true
+			}
+		}
+	}
+	return properties
+}
+
+// animating returns the elements with a running transition or animation and
+// the properties each of them animates
+func (tl *AnimationTimeline) animating() map[*RenderNode]map[string]bool {
+	nodes := make(map[*RenderNode]map[string]bool)
+	for node, running := range tl.transitions {
+		properties := make(map[string]bool, len(running))
+		for property := range running {
+			properties[property] = true
+		}
+		nodes[node] = properties
+	}
+	for node, animations := range tl.animations {
+		for _, a := range animations {
+			if a.ended || !a.pausedAt.IsZero() {
+				continue
+			}
+			if nodes[node] == nil {
+				nodes[node] = make(map[string]bool)
+			}
+			for _, frame := range tl.keyframes[a.name] {
+				for _, decl := range frame.declarations {
+					nodes[node][decl.Property] = true
+				}
+			}
+		}
+	}
+	return nodes
+}
+
+// begin fixes the time of a style pass
+func (tl *AnimationTimeline) begin() {
+	tl.now = tl.clock.Now()
+}
+
+// finish ends a style pass and returns the events of the transitions and
+// animations that ended during it
+func (tl *AnimationTimeline) finish() []AnimationEvent {
+	events := tl.events
+	tl.events = nil
+	tl.previous = nil
+	return events
+}
+
+// apply updates the transitions and animations of an element once its
+// cascaded styles are applied, and applies their current values
+func (tl *AnimationTimeline) apply(sm *StyleManager, node *RenderNode) {
+	style := node.ComputedStyle
+	fontSize := style.FontSize
+	if fontSize <= 0 {
+		fontSize = 16
+	}
+	tl.updateTransitions(node, style, fontSize)
+	tl.updateAnimations(node, style)
+
+	// Transitions override animations, as in the CSS cascade
+	for _, a := range tl.animations[node] {
+		tl.applyAnimation(sm, node, a, fontSize)
+	}
+	tl.applyTransitions(sm, node, fontSize)
+}
+
+// updateTransitions starts transitions of the properties that changed in a
+// restyle, and cancels those no longer listed in transition-property
+func (tl *AnimationTimeline) updateTransitions(node *RenderNode, style *Style, fontSize float32) {
+	specs := transitionSpecs(style)
+	running := tl.transitions[node]
+	for property := range running {
+		if _, ok := findTransition(specs, property); !ok {
+			delete(running, property)
+		}
+	}
+
+	before, restyled := tl.previous[node]
+	if restyled && len(specs) > 0 {
+		for property, get := range animatableProperties {
+			spec, ok := findTransition(specs, property)
+			to := get(style)
+			if t := running[property]; t != nil && t.to == to {
+				continue
+			}
+			from, had := before[property]
+			if _, interpolable := interpolate(from, to, 0, fontSize); !ok || !had || from == to || !interpolable || spec.duration+spec.delay <= 0 {
+				delete(running, property)
+				continue
+			}
+			if running == nil {
+				running = make(map[string]*transition)
+			}
+			running[property] = &transition{spec: spec, from: from, to: to, start: tl.now}
+		}
+	}
+
+	if len(running) == 0 {
+		delete(tl.transitions, node)
+	} else {
+		tl.transitions[node] = running
+	}
+}
+
+// applyTransitions applies the values of an element's transitions, ending
+// those that are complete
+func (tl *AnimationTimeline) applyTransitions(sm *StyleManager, node *RenderNode, fontSize float32) {
+	running := tl.transitions[node]
+	properties := make([]string, 0, len(running))
+	for property := range running {
+		properties = append(properties, property)
+	}
+	sort.Strings(properties)
+
+	for _, property := range properties {
+		t := running[property]
+		elapsed := tl.now.Sub(t.start) - t.spec.delay
+		if elapsed >= t.spec.duration {
+			delete(running, property)
+			tl.events = append(tl.events, AnimationEvent{Type: "transitionend", Node: node, PropertyName: property, ElapsedTime: t.spec.duration})
+			continue
+		}
+		p := 0.0
+		if elapsed > 0 {
+			p = float64(elapsed) / float64(t.spec.duration)
+		}
+		sm.applyDeclaration(node, css.Declaration{Property: property, Value: blend(t.from, t.to, t.spec.timing.At(p), fontSize)})
+	}
+	if len(running) == 0 {
+		delete(tl.transitions, node)
+	}
+}
+
+// updateAnimations matches an element's animation-name list against its
+// animations, starting new ones and updating the others from the style
+func (tl *AnimationTimeline) updateAnimations(node *RenderNode, style *Style) {
+	previous := tl.animations[node]
+	var current []*animation
+	for i, name := range style.AnimationName {
+		name = strings.Trim(strings.TrimSpace(name), `"'`)
+		if _, ok := tl.keyframes[name]; !ok {
+			continue
+		}
+
+		var a *animation
+		for j, candidate := range previous {
+			if candidate != nil && candidate.name == name {
+				a, previous[j] = candidate, nil
+				break
+			}
+		}
+		if a == nil {
+			a = &animation{name: name, start: tl.now}
+		}
+
+		a.duration, _ = parseTime(animationValue(style.AnimationDuration, i, "0s"))
+		a.delay, _ = parseTime(animationValue(style.AnimationDelay, i, "0s"))
+		a.timing = easeTiming
+		if tf, ok := parseTimingFunction(animationValue(style.AnimationTimingFunction, i, "ease")); ok {
+			a.timing = tf
+		}
+		a.iterations = 1
+		if count := animationValue(style.AnimationIterationCount, i, "1"); count == "infinite" {
+			a.iterations = math.Inf(1)
+		} else if n, err := strconv.ParseFloat(count, 64); err == nil && n >= 0 {
+			a.iterations = n
+		}
+		a.direction = animationValue(style.AnimationDirection, i, "normal")
+		a.fillMode = animationValue(style.AnimationFillMode, i, "none")
+
+		paused := animationValue(style.AnimationPlayState, i, "running") == "paused"
+		switch {
+		case paused && a.pausedAt.IsZero():
+			a.pausedAt = tl.now
+		case !paused && !a.pausedAt.IsZero():
+			a.start = a.start.Add(tl.now.Sub(a.pausedAt))
+			a.pausedAt = time.Time{}
+		}
+		current = append(current, a)
+	}
+
+	if len(current) == 0 {
+		delete(tl.animations, node)
+	} else {
+		tl.animations[node] = current
+	}
+}
+
+// activeDuration returns how long an animation runs, excluding its delay
+func (a *animation) activeDuration() float64 {
+	if a.duration == 0 || a.iterations == 0 {
+		return 0
+	}
+	return float64(a.duration) * a.iterations
+}
+
+// progress returns the progress through the keyframes of an animation at a
+// time, from 0 to 1 with its direction applied. It reports false when the
+// animation is not active and does not fill.
+func (a *animation) progress(now time.Time) (float64, bool) {
+	if !a.pausedAt.IsZero() {
+		now = a.pausedAt
+	}
+	elapsed := float64(now.Sub(a.start) - a.delay)
+	active := a.activeDuration()
+
+	var iteration, p float64
+	switch {
+	case elapsed < 0:
+		if a.fillMode != "backwards" && a.fillMode != "both" {
+			return 0, false
+		}
+	case elapsed >= active:
+		if a.fillMode != "forwards" && a.fillMode != "both" {
+			return 0, false
+		}
+		if a.iterations > 0 {
+			iteration = math.Ceil(a.iterations) - 1
+			p = a.iterations - iteration
+		}
+	default:
+		t := elapsed / float64(a.duration)
+		iteration = math.Floor(t)
+		p = t - iteration
+	}
+
+	odd := math.Mod(iteration, 2) == 1
+	if a.direction == "reverse" || a.direction == "alternate" && odd || a.direction == "alternate-reverse" && !odd {
+		p = 1 - p
+	}
+	return p, true
+}
+
+// applyAnimation applies the keyframe values of an animation to an element,
+// ending the animation once its last iteration is complete
+func (tl *AnimationTimeline) applyAnimation(sm *StyleManager, node *RenderNode, a *animation, fontSize float32) {
+	if !a.ended && a.pausedAt.IsZero() && float64(tl.now.Sub(a.start)-a.delay) >= a.activeDuration() {
+		a.ended = true
+		tl.events = append(tl.events, AnimationEvent{Type: "animationend", Node: node, AnimationName: a.name, ElapsedTime: time.Duration(a.activeDuration())})
+	}
+	p, ok := a.progress(tl.now)
+	if !ok {
+		return
+	}
+
+	frames := tl.keyframes[a.name]
+	var properties []string
+	seen := make(map[string]bool)
+	for _, frame := range frames {
+		for _, decl := range frame.declarations {
+			if !seen[decl.Property] {
+				seen[decl.Property] = true
+				properties = append(properties, decl.Property)
+			}
+		}
+	}
+
+	for _, property := range properties {
+		// Keyframes without the property are skipped; missing 0% and 100%
+		// keyframes take the cascaded value
+		var points []keyframe
+		for _, frame := range frames {
+			for _, decl := range frame.declarations {
+				if decl.Property == property {
+					points = append(points, keyframe{offset: frame.offset, declarations: []css.Declaration{decl}, timing: frame.timing})
+				}
+			}
+		}
+		base := ""
+		if get, ok := animatableProperties[property]; ok {
+			base = get(node.ComputedStyle)
+		}
+		if points[0].offset > 0 {
+			points = append([]keyframe{{offset: 0, declarations: []css.Declaration{{Property: property, Value: base}}}}, points...)
+		}
+		if points[len(points)-1].offset < 1 {
+			points = append(points, keyframe{offset: 1, declarations: []css.Declaration{{Property: property, Value: base}}})
+		}
+
+		i := 0
+		for i < len(points)-2 && p >= points[i+1].offset {
+			i++
+		}
+		from, to := points[i], points[i+1]
+		local := 1.0
+		if to.offset > from.offset {
+			local = math.Max(0, math.Min((p-from.offset)/(to.offset-from.offset), 1))
+		}
+		timing := a.timing
+		if from.timing != nil {
+			timing = *from.timing
+		}
+		value := blend(from.declarations[0].Value, to.declarations[0].Value, timing.At(local), fontSize)
+		if value != "" {
+			sm.applyDeclaration(node, css.Declaration{Property: property, Value: value})
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package renderer
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/vyquocvu/goosie/internal/dom"
+)
+
+// animatedRenderer lays out a document with a virtual animation clock
+func animatedRenderer(t *testing.T, document string) (*Renderer, *VirtualClock) {
+	t.Helper()
+	r := NewRenderer(800, 600)
+	clock := NewVirtualClock()
+	r.SetAnimationClock(clock)
+	if _, err := r.LayoutHTML(document); err != nil {
+		t.Fatalf("LayoutHTML failed: %v", err)
+	}
+	return r, clock
+}
+
+func TestTimingFunctions(t *testing.T) {
+	tests := []struct {
+		value    string
+		progress float64
+		expected float64
+	}{
+		{"linear", 0.3, 0.3},
+		{"ease-in-out", 0.5, 0.5},
+		{"ease", 0.5, 0.8024},
+		{"cubic-bezier(0, 0, 1, 1)", 0.7, 0.7},
+		{"steps(4)", 0.3, 0.25},
+		{"steps(4, jump-start)", 0.3, 0.5},
+		{"steps(3, jump-none)", 0.5, 0.5},
+		{"steps(3, jump-both)", 0.1, 0.25},
+		{"step-start", 0, 1},
+		{"step-end", 0.99, 0},
+		{"ease-in", 1, 1},
+	}
+	for _, tt := range tests {
+		tf, ok := parseTimingFunction(tt.value)
+		if !ok {
+			t.Errorf("parseTimingFunction(%q) failed", tt.value)
+			continue
+		}
+		if got := tf.At(tt.progress); math.Abs(got-tt.expected) > 1e-3 {
+			t.Errorf("%s at %v = %v, expected %v", tt.value, tt.progress, got, tt.expected)
+		}
+	}
+
+	for _, value := range []string{"bounce", "cubic-bezier(2, 0, 1, 1)", "steps(0)", "steps(1, jump-none)", "steps(2, middle)"} {
+		if _, ok := parseTimingFunction(value); ok {
+			t.Errorf("Expected %q to be invalid", value)
+		}
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	tests := []struct {
+		from, to string
+		p        float64
+		expected string
+	}{
+		{"0.2", "1", 0.5, "0.6"},
+		{"10px", "30px", 0.25, "15px"},
+		{"0", "50%", 0.5, "25%"},
+		{"1em", "24px", 0.5, "20px"},
+		{"red", "blue", 0.5, "rgba(128, 0, 128, 1)"},
+		{"transparent", "rgb(0, 0, 255)", 0.5, "rgba(0, 0, 255, 0.502)"},
+		{"none", "translate(100px, 50%)", 0.5, "translate(50px, 25%)"},
+		{"rotate(0deg) scale(1)", "rotate(90deg) scale(3)", 0.5, "rotate(45deg) scale(2, 2)"},
+	}
+	for _, tt := range tests {
+		got, ok := interpolate(tt.from, tt.to, tt.p, 16)
+		if !ok || got != tt.expected {
+			t.Errorf("interpolate(%q, %q, %v) = %q, %v, expected %q", tt.from, tt.to, tt.p, got, ok, tt.expected)
+		}
+	}
+
+	for _, pair := range [][2]string{{"auto", "100px"}, {"10px", "50%"}, {"red", "10px"}, {"rotate(10deg)", "scale(2)"}} {
+		if got, ok := interpolate(pair[0], pair[1], 0.5, 16); ok {
+			t.Errorf("Expected %q to %q not to interpolate, got %q", pair[0], pair[1], got)
+		}
+	}
+	if got := blend("block", "none", 0.4, 16); got != "block" {
+		t.Errorf("Expected discrete values to switch halfway, got %q at 0.4", got)
+	}
+}
+
+func TestParseTransitionAndAnimationShorthands(t *testing.T) {
+	style := &Style{}
+	parseTransitionShorthand("opacity 1s ease-in 200ms, width 2s cubic-bezier(0.1, 0.2, 0.3, 0.4)", style)
+	specs := transitionSpecs(style)
+	if len(specs) != 2 {
+		t.Fatalf("Expected 2 transitions, got %d", len(specs))
+	}
+	if specs[0].property != "opacity" || specs[0].duration != time.Second || specs[0].delay != 200*time.Millisecond || specs[0].timing != timingKeywords["ease-in"] {
+		t.Errorf("Unexpected first transition %+v", specs[0])
+	}
+	if specs[1].property != "width" || specs[1].duration != 2*time.Second || specs[1].timing.Y2 != 0.4 {
+		t.Errorf("Unexpected second transition %+v", specs[1])
+	}
+	if _, ok := findTransition(specs, "margin-top"); ok {
+		t.Error("Expected margin-top not to transition")
+	}
+
+	parseAnimationShorthand("Spin 3s linear 1s infinite alternate both paused", style)
+	expected := map[string][]string{
+		"name": style.AnimationName, "duration": style.AnimationDuration, "timing": style.AnimationTimingFunction,
+		"delay": style.AnimationDelay, "count": style.AnimationIterationCount, "direction": style.AnimationDirection,
+		"fill": style.AnimationFillMode, "state": style.AnimationPlayState,
+	}
+	values := map[string]string{
+		"name": "Spin", "duration": "3s", "timing": "linear", "delay": "1s", "count": "infinite",
+		"direction": "alternate", "fill": "both", "state": "paused",
+	}
+	for field, value := range values {
+		if got := expected[field]; len(got) != 1 || got[0] != value {
+			t.Errorf("Expected animation %s %q, got %v", field, value, got)
+		}
+	}
+}
+
+func TestTransitionOnRestyle(t *testing.T) {
+	r, clock := animatedRenderer(t, `<html><head><style>
+		.box { opacity: 0.2; width: 100px; transition: opacity 1s linear, width 2s linear 1s; }
+		.open { opacity: 1; width: 300px; }
+	</style></head><body><div id="box" class="box">Box</div></body></html>`)
+	box := findNodeByTag(r.RenderTree(), "div")
+	if r.AnimationsRunning() {
+		t.Fatal("Expected no transitions on the first style pass")
+	}
+
+	box.SetAttribute("class", "box open")
+	r.Restyle()
+	if box.ComputedStyle.Opacity != 0.2 || box.ComputedStyle.Width != "100px" {
+		t.Errorf("Expected transitions to start from the old values, got %v and %q", box.ComputedStyle.Opacity, box.ComputedStyle.Width)
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	if events := r.Tick(); len(events) != 0 {
+		t.Errorf("Expected no events halfway, got %+v", events)
+	}
+	if math.Abs(float64(box.ComputedStyle.Opacity)-0.6) > 1e-3 {
+		t.Errorf("Expected opacity 0.6 halfway, got %v", box.ComputedStyle.Opacity)
+	}
+	if box.ComputedStyle.Width != "100px" {
+		t.Errorf("Expected the width transition to be delayed, got %q", box.ComputedStyle.Width)
+	}
+
+	clock.Advance(time.Second)
+	events := r.Tick()
+	if len(events) != 1 || events[0].Type != "transitionend" || events[0].PropertyName != "opacity" || events[0].ElapsedTime != time.Second || events[0].Node != box {
+		t.Fatalf("Expected a transitionend event for opacity, got %+v", events)
+	}
+	if box.ComputedStyle.Opacity != 1 || box.ComputedStyle.Width != "150px" {
+		t.Errorf("Expected opacity 1 and width 150px, got %v and %q", box.ComputedStyle.Opacity, box.ComputedStyle.Width)
+	}
+	if got := r.LayoutTree().Children[0].Box.Width; got != 150 {
+		t.Errorf("Expected the layout to follow the transition, got width %v", got)
+	}
+
+	// Reverting midway transitions back from the current value
+	box.SetAttribute("class", "box")
+	r.Restyle()
+	clock.Advance(2 * time.Second)
+	r.Tick()
+	if box.ComputedStyle.Width != "125px" {
+		t.Errorf("Expected the reversed width transition at 125px, got %q", box.ComputedStyle.Width)
+	}
+
+	clock.Advance(time.Second)
+	events = r.Tick()
+	if len(events) != 1 || events[0].PropertyName != "width" {
+		t.Errorf("Expected a transitionend event for width, got %+v", events)
+	}
+	if r.AnimationsRunning() || box.ComputedStyle.Width != "100px" {
+		t.Errorf("Expected transitions to finish at 100px, got %q", box.ComputedStyle.Width)
+	}
+}
+
+func TestKeyframesAnimation(t *testing.T) {
+	r, clock := animatedRenderer(t, `<html><head><style>
+		@keyframes grow {
+			from { width: 100px; background-color: red; }
+			50% { width: 150px; animation-timing-function: step-end; }
+			to { width: 200px; background-color: blue; }
+		}
+		div { width: 50px; animation: grow 1s linear 2 alternate forwards; }
+	</style></head><body><div>Box</div></body></html>`)
+	div := findNodeByTag(r.RenderTree(), "div")
+	var events []AnimationEvent
+	r.SetAnimationEventHandler(func(event AnimationEvent) { events = append(events, event) })
+
+	steps := []struct {
+		advance time.Duration
+		width   string
+	}{
+		{0, "100px"},
+		{250 * time.Millisecond, "125px"},
+		{time.Second, "150px"}, // Second iteration runs backwards, stepping from 50%
+		{750 * time.Millisecond, "100px"},
+	}
+	for _, step := range steps {
+		clock.Advance(step.advance)
+		r.Tick()
+		if div.ComputedStyle.Width != step.width {
+			t.Errorf("Expected width %s after %v, got %q", step.width, clock.Now().Sub(time.Unix(0, 0)), div.ComputedStyle.Width)
+		}
+	}
+	if len(events) != 1 || events[0].Type != "animationend" || events[0].AnimationName != "grow" || events[0].ElapsedTime != 2*time.Second {
+		t.Errorf("Expected an animationend event, got %+v", events)
+	}
+	// Events name their element by its source node, even without an id
+	if len(events) == 1 && (events[0].Node.Source == nil || dom.ElementIndex(events[0].Node.Source) != 4) {
+		t.Errorf("Expected the event's node built from the div, the fifth element, got %+v", events[0].Node.Source)
+	}
+	if r.AnimationsRunning() {
+		t.Error("Expected the animation to have ended")
+	}
+}
+
+func TestKeyframesImplicitOffsetsAndPlayState(t *testing.T) {
+	r, clock := animatedRenderer(t, `<html><head><style>
+		@keyframes fade { 50% { opacity: 0.2; } }
+		p { opacity: 0.6; animation: fade 2s linear infinite; }
+		p.paused { animation-play-state: paused; }
+	</style></head><body><p>Text</p></body></html>`)
+	p := findNodeByTag(r.RenderTree(), "p")
+
+	clock.Advance(500 * time.Millisecond)
+	r.Tick()
+	if math.Abs(float64(p.ComputedStyle.Opacity)-0.4) > 1e-3 {
+		t.Errorf("Expected opacity 0.4 between the implicit 0%% keyframe and 50%%, got %v", p.ComputedStyle.Opacity)
+	}
+
+	p.SetAttribute("class", "paused")
+	r.Restyle()
+	clock.Advance(10 * time.Second)
+	if r.AnimationsRunning() || r.Tick() != nil {
+		t.Error("Expected a paused animation not to tick")
+	}
+	p.SetAttribute("class", "")
+	r.Restyle()
+	clock.Advance(time.Second)
+	r.Tick()
+	if math.Abs(float64(p.ComputedStyle.Opacity)-0.4) > 1e-3 {
+		t.Errorf("Expected the animation to resume where it paused, got opacity %v", p.ComputedStyle.Opacity)
+	}
+	if !r.AnimationsRunning() {
+		t.Error("Expected an infinite animation to keep running")
+	}
+}
+
+func TestTickRestylesOnlyAnimatedElements(t *testing.T) {
+	r, clock := animatedRenderer(t, `<html><head><style>
+		@keyframes fade { from { opacity: 0.2; } to { opacity: 1; } }
+		@keyframes spin { from { transform: rotate(0deg); } to { transform: rotate(90deg); } }
+		.fade { animation: fade 1s linear; }
+		.spin { animation: spin 1s linear; }
+	</style></head><body><div class="fade">Fade</div><div class="spin">Spin</div><p>Still</p></body></html>`)
+	body := findNodeByTag(r.RenderTree(), "body")
+	fade, spin, still := body.Children[0], body.Children[1], findNodeByTag(r.RenderTree(), "p")
+	stillStyle := still.ComputedStyle
+	layoutTree := r.LayoutTree()
+	spinBox := r.layoutEngine.nodeMap[spin.ID]
+	before := r.DisplayList()
+
+	clock.Advance(500 * time.Millisecond)
+	r.Tick()
+	if math.Abs(float64(fade.ComputedStyle.Opacity)-0.6) > 1e-3 {
+		t.Errorf("Expected opacity 0.6 halfway, got %v", fade.ComputedStyle.Opacity)
+	}
+	if still.ComputedStyle != stillStyle {
+		t.Error("Expected an element without animations not to be restyled")
+	}
+	// Paint-only animations keep the layout and update the transforms of their boxes
+	if r.LayoutTree() != layoutTree || r.layoutEngine.nodeMap[spin.ID] != spinBox {
+		t.Error("Expected paint-only animations not to lay the document out again")
+	}
+	if spinBox.Transform == nil || spin.ComputedStyle.Transform != "rotate(45deg)" {
+		t.Errorf("Expected the box transform to follow the animation, got %q", spin.ComputedStyle.Transform)
+	}
+	if diff := DiffDisplayLists(before, r.DisplayList(), nil); len(diff.Changed) == 0 {
+		t.Error("Expected the display list to paint the new opacity")
+	}
+}
+
+func TestTickRelaysOutAnimatedElements(t *testing.T) {
+	r, clock := animatedRenderer(t, `<html><head><style>
+		@keyframes grow { from { height: 100px; } to { height: 200px; } }
+		.grow { height: 100px; animation: grow 1s linear; }
+		.fixed { height: 50px; }
+	</style></head><body><div class="grow">Grow</div><div class="fixed">Fixed</div></body></html>`)
+	body := findNodeByTag(r.RenderTree(), "body")
+	grow, fixed := body.Children[0], body.Children[1]
+	fixedBox := r.layoutEngine.nodeMap[fixed.ID]
+
+	clock.Advance(500 * time.Millisecond)
+	r.Tick()
+	if got := r.layoutEngine.nodeMap[grow.ID].Box.Height; got != 150 {
+		t.Errorf("Expected the animated box at height 150, got %v", got)
+	}
+	// Boxes after the animated one move without being laid out again
+	if r.layoutEngine.nodeMap[fixed.ID] != fixedBox || fixedBox.Box.Y != r.layoutEngine.nodeMap[grow.ID].Box.Y+150 {
+		t.Errorf("Expected the following box to be moved down, got y %v", fixedBox.Box.Y)
+	}
+}
@@ -0,0 +1,982 @@
+package renderer
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+
+	imageloader "github.com/vyquocvu/goosie/internal/image"
+)
+
+// LengthPercent is a length in pixels plus a fraction of a reference length
+type LengthPercent struct {
+	Pixels   float32 `json:"px,omitempty"`
+	Fraction float32 `json:"fraction,omitempty"`
+}
+
+// resolve returns the length in pixels for a reference length
+func (l LengthPercent) resolve(reference float32) float32 {
+	return l.Pixels + l.Fraction*reference
+}
+
+// BackgroundTiling places the tiles of a background image or gradient
+// Tile sizes are resolved against the positioning area; the position is kept
+// relative to the free space because it depends on the size of images.
+type BackgroundTiling struct {
+	Area    Rect          `json:"area"`              // Positioning area, from background-origin
+	Fit     string        `json:"fit,omitempty"`     // "cover" or "contain", or "" to use Width and Height
+	Width   float32       `json:"width,omitempty"`   // Tile width, 0 for auto
+	Height  float32       `json:"height,omitempty"`  // Tile height, 0 for auto
+	X       LengthPercent `json:"x"`                 // Fraction of the free horizontal space
+	Y       LengthPercent `json:"y"`                 // Fraction of the free vertical space
+	RepeatX string        `json:"repeatX,omitempty"` // "repeat", "no-repeat", "space" or "round"
+	RepeatY string        `json:"repeatY,omitempty"`
+}
+
+// GradientKind is the shape of a gradient
+type GradientKind int
+
+const (
+	GradientLinear GradientKind = iota
+	GradientRadial
+	GradientConic
+)
+
+// Gradient is a CSS gradient with lengths resolved to pixels and fractions
+// of the tile it is painted in
+type Gradient struct {
+	Kind      GradientKind
+	Repeating bool
+
+	// Angle is the direction of linear gradients and the start of conic
+	// gradients, in degrees clockwise from up. With ToCorner, a linear gradient
+	// points at the corner in the quadrant of Angle, as in "to top right".
+	Angle    float32
+	ToCorner bool
+
+	// Center of radial and conic gradients
+	CenterX LengthPercent
+	CenterY LengthPercent
+
+	// Radial gradients are circles or ellipses sized by an extent keyword, or
+	// by RadiusX and RadiusY when Extent is empty
+	Circle  bool
+	Extent  string
+	RadiusX LengthPercent
+	RadiusY LengthPercent
+
+	Stops []GradientStop
+}
+
+// GradientStop is a color stop; its position is in pixels along the gradient
+// line plus a fraction of the line, or a fraction of a turn for conic gradients
+type GradientStop struct {
+	Color    color.Color
+	Position LengthPercent
+	Auto     bool // The position is interpolated from neighboring stops
+}
+
+// Background keywords
+var (
+	backgroundRepeatKeywords     = []string{"repeat", "no-repeat", "space", "round", "repeat-x", "repeat-y"}
+	backgroundAttachmentKeywords = []string{"scroll", "fixed", "local"}
+	backgroundBoxKeywords        = []string{"border-box", "padding-box", "content-box"}
+	backgroundPositionKeywords   = []string{"left", "center", "right", "top", "bottom"}
+)
+
+// isKeyword reports whether value is one of the keywords
+func isKeyword(value string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if value == keyword {
+			return true
+		}
+	}
+	return false
+}
+
+// backgroundValue returns the value of a background list property for a
+// layer, repeating the list when it is shorter than the number of layers
+func backgroundValue(values []string, layer int, initial string) string {
+	if len(values) == 0 {
+		return initial
+	}
+	return values[layer%len(values)]
+}
+
+// backgroundImageURL returns the URL of a url() background image
+func backgroundImageURL(value string) (string, bool) {
+	name, arg, ok := parseCSSFunction(value)
+	if !ok || name != "url" || arg == "" {
+		return "", false
+	}
+	return arg, true
+}
+
+// backgroundImageSources returns the URL of each url() background layer of
+// a node, or "" for other layers, and makes room for their images
+func backgroundImageSources(node *RenderNode) []string {
+	if node.ComputedStyle == nil {
+		return nil
+	}
+	var sources []string
+	for i, value := range node.ComputedStyle.BackgroundImage {
+		if src, ok := backgroundImageURL(value); ok {
+			if sources == nil {
+				sources = make([]string, len(node.ComputedStyle.BackgroundImage))
+			}
+			sources[i] = src
+		}
+	}
+	if len(node.BackgroundImages) != len(sources) {
+		node.BackgroundImages = make([]*imageloader.ImageData, len(sources))
+	}
+	return sources
+}
+
+// isBackgroundImage reports whether a value is a background-image layer
+func isBackgroundImage(value string) bool {
+	if value == "none" {
+		return true
+	}
+	name, _, ok := parseCSSFunction(value)
+	return ok && (name == "url" || strings.HasSuffix(name, "-gradient"))
+}
+
+// parseBackgroundShorthand parses the background shorthand, which resets the
+// background properties it does not set
+func parseBackgroundShorthand(value string, style *Style) {
+	layers := splitTopLevel(value, ',')
+	if len(layers) == 0 {
+		return
+	}
+
+	var images, positions, sizes, repeats, attachments, origins, clips []string
+	var background color.Color = color.NRGBA{}
+	for i, layer := range layers {
+		layerImage, position, size, repeat := "none", "0% 0%", "auto", "repeat"
+		attachment, origin, clip := "scroll", "padding-box", "border-box"
+
+		var positionParts, sizeParts, repeatParts, boxes []string
+		afterSlash := false
+		// Slashes separate the position from the size, even without spaces
+		tokens := splitTopLevel(strings.Join(splitTopLevel(layer, '/'), " / "), ' ')
+		for _, token := range tokens {
+			lower := strings.ToLower(token)
+			switch {
+			case token == "/":
+				afterSlash = true
+			case afterSlash && (lower == "cover" || lower == "contain" || lower == "auto" || isLengthPercent(lower)):
+				sizeParts = append(sizeParts, lower)
+			case isBackgroundImage(lower):
+				layerImage = token
+			case isKeyword(lower, backgroundRepeatKeywords):
+				repeatParts = append(repeatParts, lower)
+			case isKeyword(lower, backgroundAttachmentKeywords):
+				attachment = lower
+			case isKeyword(lower, backgroundBoxKeywords):
+				boxes = append(boxes, lower)
+			case isKeyword(lower, backgroundPositionKeywords) || isLengthPercent(lower):
+				positionParts = append(positionParts, lower)
+			default:
+				// Only the last layer may have a color
+				if c, err := parseColor(token); err == nil && i == len(layers)-1 {
+					background = c
+				}
+			}
+		}
+		if len(positionParts) > 0 {
+			position = strings.Join(positionParts, " ")
+		}
+		if len(sizeParts) > 0 {
+			size = strings.Join(sizeParts, " ")
+		}
+		if len(repeatParts) > 0 {
+			repeat = strings.Join(repeatParts, " ")
+		}
+		if len(boxes) > 0 {
+			origin, clip = boxes[0], boxes[0]
+		}
+		if len(boxes) > 1 {
+			clip = boxes[1]
+		}
+
+		images = append(images, layerImage)
+		positions = append(positions, position)
+		sizes = append(sizes, size)
+		repeats = append(repeats, repeat)
+		attachments = append(attachments, attachment)
+		origins = append(origins, origin)
+		clips = append(clips, clip)
+	}
+
+	style.BackgroundColor = background
+	style.BackgroundImage = images
+	style.BackgroundPosition = positions
+	style.BackgroundSize = sizes
+	style.BackgroundRepeat = repeats
+	style.BackgroundAttachment = attachments
+	style.BackgroundOrigin = origins
+	style.BackgroundClip = clips
+}
+
+// parseBackgroundList splits the comma separated layers of a background property
+func parseBackgroundList(value string) []string {
+	layers := splitTopLevel(value, ',')
+	for i, layer := range layers {
+		if !strings.HasPrefix(strings.ToLower(layer), "url(") {
+			layers[i] = strings.ToLower(layer)
+		}
+	}
+	return layers
+}
+
+// parseBackgroundRepeat returns the horizontal and vertical repeat of a
+// background-repeat value
+func parseBackgroundRepeat(value string) (string, string) {
+	parts := strings.Fields(value)
+	switch {
+	case len(parts) == 0:
+		return "repeat", "repeat"
+	case parts[0] == "repeat-x":
+		return "repeat", "no-repeat"
+	case parts[0] == "repeat-y":
+		return "no-repeat", "repeat"
+	case len(parts) == 1:
+		return parts[0], parts[0]
+	}
+	return parts[0], parts[1]
+}
+
+// isLengthPercent reports whether a value is a length or a percentage
+func isLengthPercent(value string) bool {
+	_, ok := parseLengthPercent(value, 16)
+	return ok
+}
+
+// parseLengthPercent parses a length or a percentage
+func parseLengthPercent(value string, fontSize float32) (LengthPercent, bool) {
+	value = strings.TrimSpace(value)
+	if strings.HasSuffix(value, "%") {
+		val, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 32)
+		if err != nil {
+			return LengthPercent{}, false
+		}
+		return LengthPercent{Fraction: float32(val) / 100}, true
+	}
+	if value == "0" {
+		return LengthPercent{}, true
+	}
+	for _, unit := range []string{"px", "em", "rem"} {
+		if number, ok := strings.CutSuffix(value, unit); ok {
+			if _, err := strconv.ParseFloat(number, 32); err == nil {
+				return LengthPercent{Pixels: parseLength(value, fontSize)}, true
+			}
+		}
+	}
+	return LengthPercent{}, false
+}
+
+// parseAngle parses a CSS angle and returns it in degrees
+func parseAngle(value string) (float32, bool) {
+	units := []struct {
+		suffix  string
+		degrees float64
+	}{
+		{"deg", 1}, {"grad", 0.9}, {"rad", 180 / math.Pi}, {"turn", 360},
+	}
+	for _, unit := range units {
+		if number, ok := strings.CutSuffix(value, unit.suffix); ok {
+			if val, err := strconv.ParseFloat(number, 64); err == nil {
+				return float32(val * unit.degrees), true
+			}
+			return 0, false
+		}
+	}
+	if value == "0" {
+		return 0, true
+	}
+	return 0, false
+}
+
+// parsePosition parses a background-position style value into horizontal
+// and vertical offsets, with one to four keywords, lengths and percentages
+func parsePosition(value string, fontSize float32) (LengthPercent, LengthPercent, bool) {
+	center := LengthPercent{Fraction: 0.5}
+	keywordFraction := map[string]float32{"left": 0, "top": 0, "center": 0.5, "right": 1, "bottom": 1}
+
+	// Group the parts into keywords with an optional offset from their edge
+	type group struct {
+		keyword string
+		offset  *LengthPercent
+	}
+	var groups []group
+	parts := strings.Fields(value)
+	for _, part := range parts {
+		if _, isKeyword := keywordFraction[part]; isKeyword {
+			groups = append(groups, group{keyword: part})
+			continue
+		}
+		length, ok := parseLengthPercent(part, fontSize)
+		if !ok {
+			return LengthPercent{}, LengthPercent{}, false
+		}
+		if len(groups) > 0 && groups[len(groups)-1].offset == nil && groups[len(groups)-1].keyword != "" &&
+			groups[len(groups)-1].keyword != "center" && len(parts) > 2 {
+			groups[len(groups)-1].offset = &length
+			continue
+		}
+		groups = append(groups, group{offset: &length})
+	}
+	if len(groups) == 0 || len(groups) > 2 {
+		return LengthPercent{}, LengthPercent{}, false
+	}
+
+	resolve := func(g group) LengthPercent {
+		if g.keyword == "" {
+			return *g.offset
+		}
+		position := LengthPercent{Fraction: keywordFraction[g.keyword]}
+		if g.offset != nil {
+			// Offsets from the right and bottom edges count inwards
+			if g.keyword == "right" || g.keyword == "bottom" {
+				position.Pixels -= g.offset.Pixels
+				position.Fraction -= g.offset.Fraction
+			} else {
+				position.Pixels += g.offset.Pixels
+				position.Fraction += g.offset.Fraction
+			}
+		}
+		return position
+	}
+	vertical := func(g group) bool { return g.keyword == "top" || g.keyword == "bottom" }
+	horizontal := func(g group) bool { return g.keyword == "left" || g.keyword == "right" }
+
+	if len(groups) == 1 {
+		if vertical(groups[0]) {
+			return center, resolve(groups[0]), true
+		}
+		return resolve(groups[0]), center, true
+	}
+	first, second := groups[0], groups[1]
+	if vertical(first) || horizontal(second) {
+		first, second = second, first
+	}
+	if vertical(first) || horizontal(second) {
+		return LengthPercent{}, LengthPercent{}, false
+	}
+	return resolve(first), resolve(second), true
+}
+
+// parseBackgroundSize resolves a background-size value against the
+// positioning area; zero width or height stand for auto
+func parseBackgroundSize(value string, area Rect, fontSize float32) (fit string, width, height float32, ok bool) {
+	parts := strings.Fields(value)
+	if len(parts) == 1 && (parts[0] == "cover" || parts[0] == "contain") {
+		return parts[0], 0, 0, true
+	}
+	if len(parts) == 1 {
+		parts = append(parts, "auto")
+	}
+	if len(parts) != 2 {
+		return "", 0, 0, false
+	}
+	var size [2]float32
+	for i, part := range parts {
+		if part == "auto" {
+			continue
+		}
+		length, valid := parseLengthPercent(part, fontSize)
+		if !valid {
+			return "", 0, 0, false
+		}
+		reference := area.Width
+		if i == 1 {
+			reference = area.Height
+		}
+		size[i] = length.resolve(reference)
+		if size[i] <= 0 {
+			// Empty tiles paint nothing
+			return "", 0, 0, false
+		}
+	}
+	return "", size[0], size[1], true
+}
+
+// parseGradient parses a linear, radial or conic gradient and its repeating
+// variant
+func parseGradient(value string, fontSize float32) (*Gradient, bool) {
+	open := strings.Index(value, "(")
+	if open <= 0 || !strings.HasSuffix(value, ")") {
+		return nil, false
+	}
+	name := strings.ToLower(strings.TrimSpace(value[:open]))
+	g := &Gradient{}
+	name, g.Repeating = strings.CutPrefix(name, "repeating-")
+	switch name {
+	case "linear-gradient":
+		g.Kind = GradientLinear
+		g.Angle = 180
+	case "radial-gradient":
+		g.Kind = GradientRadial
+		g.Extent = "farthest-corner"
+		g.CenterX, g.CenterY = LengthPercent{Fraction: 0.5}, LengthPercent{Fraction: 0.5}
+	case "conic-gradient":
+		g.Kind = GradientConic
+		g.CenterX, g.CenterY = LengthPercent{Fraction: 0.5}, LengthPercent{Fraction: 0.5}
+	default:
+		return nil, false
+	}
+
+	args := splitTopLevel(value[open+1:len(value)-1], ',')
+	if len(args) == 0 {
+		return nil, false
+	}
+	// The first argument configures the gradient unless it is a color stop
+	if first := splitTopLevel(args[0], ' '); len(first) > 0 {
+		if _, err := parseColor(first[0]); err != nil {
+			if !g.parseConfig(strings.ToLower(args[0]), fontSize) {
+				return nil, false
+			}
+			args = args[1:]
+		}
+	}
+
+	for _, arg := range args {
+		parts := splitTopLevel(arg, ' ')
+		c, err := parseColor(parts[0])
+		if err != nil {
+			// Interpolation hints are not supported and are skipped
+			if len(parts) == 1 {
+				continue
+			}
+			return nil, false
+		}
+		if len(parts) == 1 {
+			g.Stops = append(g.Stops, GradientStop{Color: c, Auto: true})
+			continue
+		}
+		if len(parts) > 3 {
+			return nil, false
+		}
+		// A stop with two positions is two stops of the same color
+		for _, part := range parts[1:] {
+			position, ok := g.parseStopPosition(strings.ToLower(part), fontSize)
+			if !ok {
+				return nil, false
+			}
+			g.Stops = append(g.Stops, GradientStop{Color: c, Position: position})
+		}
+	}
+	if len(g.Stops) < 2 {
+		return nil, false
+	}
+	return g, true
+}
+
+// parseConfig parses the direction, shape or position before the color stops
+func (g *Gradient) parseConfig(config string, fontSize float32) bool {
+	shape, position, hasPosition := strings.Cut(config, "at ")
+	if hasPosition {
+		if g.Kind == GradientLinear {
+			return false
+		}
+		x, y, ok := parsePosition(position, fontSize)
+		if !ok {
+			return false
+		}
+		g.CenterX, g.CenterY = x, y
+	}
+	parts := strings.Fields(shape)
+
+	switch g.Kind {
+	case GradientLinear:
+		if len(parts) == 1 {
+			angle, ok := parseAngle(parts[0])
+			g.Angle = angle
+			return ok
+		}
+		if len(parts) < 2 || len(parts) > 3 || parts[0] != "to" {
+			return false
+		}
+		sides := map[string]bool{}
+		for _, side := range parts[1:] {
+			sides[side] = true
+		}
+		switch {
+		case len(sides) != len(parts)-1:
+			return false
+		case len(sides) == 1 && sides["top"]:
+			g.Angle = 0
+		case len(sides) == 1 && sides["right"]:
+			g.Angle = 90
+		case len(sides) == 1 && sides["bottom"]:
+			g.Angle = 180
+		case len(sides) == 1 && sides["left"]:
+			g.Angle = 270
+		case sides["top"] && sides["right"]:
+			g.Angle, g.ToCorner = 45, true
+		case sides["bottom"] && sides["right"]:
+			g.Angle, g.ToCorner = 135, true
+		case sides["bottom"] && sides["left"]:
+			g.Angle, g.ToCorner = 225, true
+		case sides["top"] && sides["left"]:
+			g.Angle, g.ToCorner = 315, true
+		default:
+			return false
+		}
+		return true
+
+	case GradientConic:
+		if len(parts) == 0 {
+			return hasPosition
+		}
+		if len(parts) != 2 || parts[0] != "from" {
+			return false
+		}
+		angle, ok := parseAngle(parts[1])
+		g.Angle = angle
+		return ok
+
+	default:
+		var lengths []LengthPercent
+		for _, part := range parts {
+			switch part {
+			case "circle":
+				g.Circle = true
+			case "ellipse":
+			case "closest-side", "closest-corner", "farthest-side", "farthest-corner":
+				g.Extent = part
+			default:
+				length, ok := parseLengthPercent(part, fontSize)
+				if !ok {
+					return false
+				}
+				lengths = append(lengths, length)
+			}
+		}
+		switch len(lengths) {
+		case 0:
+		case 1:
+			// A single length is the radius of a circle
+			if lengths[0].Fraction != 0 {
+				return false
+			}
+			g.Circle, g.Extent = true, ""
+			g.RadiusX, g.RadiusY = lengths[0], lengths[0]
+		case 2:
+			if g.Circle {
+				return false
+			}
+			g.Extent = ""
+			g.RadiusX, g.RadiusY = lengths[0], lengths[1]
+		default:
+			return false
+		}
+		return len(parts) > 0 || hasPosition
+	}
+}
+
+// parseStopPosition parses the position of a color stop
+func (g *Gradient) parseStopPosition(value string, fontSize float32) (LengthPercent, bool) {
+	if g.Kind == GradientConic {
+		if strings.HasSuffix(value, "%") {
+			return parseLengthPercent(value, fontSize)
+		}
+		angle, ok := parseAngle(value)
+		return LengthPercent{Fraction: angle / 360}, ok
+	}
+	return parseLengthPercent(value, fontSize)
+}
+
+// tile returns the first tile of a background and the distance between the
+// origins of neighboring tiles, for an image of the given intrinsic size or
+// for a gradient when the size is zero
+func (t *BackgroundTiling) tile(intrinsicWidth, intrinsicHeight float32) (tile Rect, stepX, stepY float32) {
+	area := t.Area
+	hasRatio := intrinsicWidth > 0 && intrinsicHeight > 0
+
+	width, height := t.Width, t.Height
+	switch {
+	case t.Fit != "" && hasRatio:
+		scale := area.Width / intrinsicWidth
+		if t.Fit == "cover" {
+			scale = max(scale, area.Height/intrinsicHeight)
+		} else {
+			scale = min(scale, area.Height/intrinsicHeight)
+		}
+		width, height = intrinsicWidth*scale, intrinsicHeight*scale
+	case t.Fit != "":
+		width, height = area.Width, area.Height
+	case width == 0 && height == 0 && hasRatio:
+		width, height = intrinsicWidth, intrinsicHeight
+	case width == 0 && height == 0:
+		width, height = area.Width, area.Height
+	case width == 0 && hasRatio:
+		width = height * intrinsicWidth / intrinsicHeight
+	case width == 0:
+		width = area.Width
+	case height == 0 && hasRatio:
+		height = width * intrinsicHeight / intrinsicWidth
+	case height == 0:
+		height = area.Height
+	}
+
+	// Round tiles are scaled to fit a whole number of times, keeping the
+	// ratio of auto sizes
+	autoHeight, autoWidth := t.Height == 0 && t.Fit == "", t.Width == 0 && t.Fit == ""
+	if t.RepeatX == "round" && width > 0 {
+		rounded := area.Width / max(float32(math.Round(float64(area.Width/width))), 1)
+		if autoHeight && t.RepeatY != "round" {
+			height *= rounded / width
+		}
+		width = rounded
+	}
+	if t.RepeatY == "round" && height > 0 {
+		rounded := area.Height / max(float32(math.Round(float64(area.Height/height))), 1)
+		if autoWidth && t.RepeatX != "round" {
+			width *= rounded / height
+		}
+		height = rounded
+	}
+
+	tile = Rect{Width: width, Height: height}
+	tile.X, stepX = tileAxis(area.X, area.Width, width, t.X, t.RepeatX)
+	tile.Y, stepY = tileAxis(area.Y, area.Height, height, t.Y, t.RepeatY)
+	return tile, stepX, stepY
+}
+
+// tileAxis returns the position of the first tile on one axis and the step
+// between tiles, which is zero when the tile does not repeat
+func tileAxis(start, length, size float32, position LengthPercent, repeat string) (float32, float32) {
+	switch repeat {
+	case "no-repeat":
+		return start + position.resolve(length-size), 0
+	case "space":
+		count := float32(math.Floor(float64(length / size)))
+		if count < 2 {
+			return start + position.resolve(length-size), 0
+		}
+		// Spaced tiles fill the area, ignoring the position
+		return start, size + (length-count*size)/(count-1)
+	}
+	return start + position.resolve(length-size), size
+}
+
+// commandImage returns the image of an image or background image command,
+// or nil if it is not loaded
+func commandImage(cmd *PaintCommand) image.Image {
+	if cmd.Node == nil {
+		return nil
+	}
+	var data *imageloader.ImageData
+	switch cmd.Type {
+	case PaintImage:
+		data = cmd.Node.ImageData
+	case PaintBackgroundImage:
+		if cmd.BackgroundIndex >= 0 && cmd.BackgroundIndex < len(cmd.Node.BackgroundImages) {
+			data = cmd.Node.BackgroundImages[cmd.BackgroundIndex]
+		}
+	}
+	if data == nil || data.State != imageloader.StateLoaded || data.Image == nil {
+		return nil
+	}
+	return data.Image
+}
+
+// paintBackground paints a background image or gradient command, repeating
+// its tile over the command box and clipping it to the rounded corners
+func paintBackground(dst *image.RGBA, cmd *PaintCommand) {
+	if cmd.Tiling == nil {
+		return
+	}
+	var img image.Image
+	var intrinsicWidth, intrinsicHeight float32
+	switch {
+	case cmd.Type == PaintBackgroundImage:
+		if img = commandImage(cmd); img == nil {
+			return
+		}
+		intrinsicWidth, intrinsicHeight = float32(img.Bounds().Dx()), float32(img.Bounds().Dy())
+	case cmd.Gradient == nil:
+		return
+	}
+	tile, stepX, stepY := cmd.Tiling.tile(intrinsicWidth, intrinsicHeight)
+	if tile.Width <= 0 || tile.Height <= 0 {
+		return
+	}
+
+	var shader *gradientShader
+	if img == nil {
+		shader = newGradientShader(cmd.Gradient, tile.Width, tile.Height)
+	}
+	bounds := cmd.Box.outerPixels().Intersect(dst.Bounds())
+	rounded := !cmd.Radii.IsZero()
+	for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
+		y, ok := tileOffset(float32(py)+0.5-tile.Y, stepY, tile.Height)
+		if !ok {
+			continue
+		}
+		for px := bounds.Min.X; px < bounds.Max.X; px++ {
+			x, ok := tileOffset(float32(px)+0.5-tile.X, stepX, tile.Width)
+			if !ok {
+				continue
+			}
+			coverage := float32(1)
+			if rounded {
+				if coverage = roundedRectCoverage(cmd.Box, cmd.Radii, px, py); coverage <= 0 {
+					continue
+				}
+			}
+
+			var c color.NRGBA
+			if img != nil {
+				b := img.Bounds()
+				sx := b.Min.X + min(int(x*intrinsicWidth/tile.Width), b.Dx()-1)
+				sy := b.Min.Y + min(int(y*intrinsicHeight/tile.Height), b.Dy()-1)
+				c = color.NRGBAModel.Convert(img.At(sx, sy)).(color.NRGBA)
+			} else {
+				c = shader.at(x, y)
+			}
+			blendNRGBA(dst, px, py, c, coverage)
+		}
+	}
+}
+
+// tileOffset returns the offset of a point in the tile covering it, given its
+// offset from the first tile, or false if it falls between or beyond tiles
+func tileOffset(offset, step, size float32) (float32, bool) {
+	if step > 0 {
+		offset -= float32(math.Floor(float64(offset/step))) * step
+	}
+	return offset, offset >= 0 && offset < size
+}
+
+// renderBackground paints a background command into a transparent image
+// whose bounds are the pixels of its box, in page coordinates
+func renderBackground(cmd *PaintCommand) *image.RGBA {
+	bounds := cmd.Box.outerPixels()
+	if bounds.Empty() {
+		return nil
+	}
+	dst := image.NewRGBA(bounds)
+	paintBackground(dst, cmd)
+	return dst
+}
+
+// blendNRGBA blends a color over one pixel of dst with the given coverage
+func blendNRGBA(dst *image.RGBA, x, y int, c color.NRGBA, coverage float32) {
+	alpha := float32(c.A) / 255 * min(coverage, 1)
+	if alpha <= 0 {
+		return
+	}
+	i := dst.PixOffset(x, y)
+	pix := dst.Pix[i : i+4 : i+4]
+	keep := 1 - alpha
+	pix[0] = uint8(float32(c.R)*alpha + float32(pix[0])*keep + 0.5)
+	pix[1] = uint8(float32(c.G)*alpha + float32(pix[1])*keep + 0.5)
+	pix[2] = uint8(float32(c.B)*alpha + float32(pix[2])*keep + 0.5)
+	pix[3] = uint8(255*alpha + float32(pix[3])*keep + 0.5)
+}
+
+// gradientShader computes the colors of a gradient in a tile
+type gradientShader struct {
+	g *Gradient
+
+	// Gradient line in tile coordinates: linear gradients project points on
+	// the direction (dirX, dirY) through the center; radial gradients scale
+	// distances by the radii
+	centerX, centerY float32
+	dirX, dirY       float32
+	radiusX, radiusY float32
+	length           float32
+
+	// Stop positions along the line, in pixels or in turns
+	positions []float32
+	colors    [][4]float32 // Premultiplied
+}
+
+// newGradientShader resolves a gradient for a tile of the given size
+func newGradientShader(g *Gradient, width, height float32) *gradientShader {
+	s := &gradientShader{g: g}
+	switch g.Kind {
+	case GradientLinear:
+		angle := float64(g.Angle)
+		if g.ToCorner {
+			// The line is perpendicular to the diagonal between the other corners
+			corner := math.Atan2(float64(height), float64(width)) * 180 / math.Pi
+			switch g.Angle {
+			case 45:
+				angle = corner
+			case 135:
+				angle = 180 - corner
+			case 225:
+				angle = 180 + corner
+			default:
+				angle = 360 - corner
+			}
+		}
+		sin, cos := math.Sincos(angle * math.Pi / 180)
+		s.dirX, s.dirY = float32(sin), float32(-cos)
+		s.centerX, s.centerY = width/2, height/2
+		s.length = float32(math.Abs(float64(width)*sin) + math.Abs(float64(height)*cos))
+
+	case GradientRadial:
+		s.centerX, s.centerY = g.CenterX.resolve(width), g.CenterY.resolve(height)
+		s.radiusX, s.radiusY = s.radialRadii(width, height)
+		s.length = s.radiusX
+
+	case GradientConic:
+		s.centerX, s.centerY = g.CenterX.resolve(width), g.CenterY.resolve(height)
+		s.length = 1
+	}
+	s.resolveStops()
+	return s
+}
+
+// radialRadii returns the radii of the ending shape of a radial gradient
+func (s *gradientShader) radialRadii(width, height float32) (float32, float32) {
+	g := s.g
+	if g.Extent == "" {
+		if g.Circle {
+			return g.RadiusX.Pixels, g.RadiusX.Pixels
+		}
+		return g.RadiusX.resolve(width), g.RadiusY.resolve(height)
+	}
+
+	left, right := abs32(s.centerX), abs32(width-s.centerX)
+	top, bottom := abs32(s.centerY), abs32(height-s.centerY)
+	var sideX, sideY float32
+	if strings.HasPrefix(g.Extent, "closest") {
+		sideX, sideY = min(left, right), min(top, bottom)
+	} else {
+		sideX, sideY = max(left, right), max(top, bottom)
+	}
+
+	if strings.HasSuffix(g.Extent, "side") {
+		if g.Circle {
+			side := max(sideX, sideY)
+			if strings.HasPrefix(g.Extent, "closest") {
+				side = min(sideX, sideY)
+			}
+			return side, side
+		}
+		return sideX, sideY
+	}
+	// Corner extents pass through the corner, keeping the ratio of the sides
+	if g.Circle {
+		r := float32(math.Hypot(float64(sideX), float64(sideY)))
+		return r, r
+	}
+	return sideX * math.Sqrt2, sideY * math.Sqrt2
+}
+
+// resolveStops places stops without a position between their neighbors and
+// keeps positions increasing
+func (s *gradientShader) resolveStops() {
+	stops := s.g.Stops
+	s.positions = make([]float32, len(stops))
+	s.colors = make([][4]float32, len(stops))
+	for i, stop := range stops {
+		r, g, b, a := stop.Color.RGBA()
+		s.colors[i] = [4]float32{float32(r) / 0xffff, float32(g) / 0xffff, float32(b) / 0xffff, float32(a) / 0xffff}
+	}
+
+	auto := make([]bool, len(stops))
+	for i, stop := range stops {
+		auto[i] = stop.Auto
+		s.positions[i] = stop.Position.resolve(s.length)
+	}
+	if auto[0] {
+		auto[0], s.positions[0] = false, 0
+	}
+	if last := len(stops) - 1; auto[last] {
+		auto[last], s.positions[last] = false, s.length
+	}
+	for i := 1; i < len(stops); i++ {
+		if !auto[i] {
+			s.positions[i] = max(s.positions[i], s.positions[i-1])
+		}
+	}
+	for i := 1; i < len(stops); i++ {
+		if !auto[i] {
+			continue
+		}
+		end := i
+		for auto[end] {
+			end++
+		}
+		from, to := s.positions[i-1], s.positions[end]
+		for j := i; j < end; j++ {
+			s.positions[j] = from + (to-from)*float32(j-i+1)/float32(end-i+1)
+		}
+		i = end
+	}
+}
+
+// at returns the color of the gradient at a point of the tile
+func (s *gradientShader) at(x, y float32) color.NRGBA {
+	dx, dy := x-s.centerX, y-s.centerY
+	var position float32
+	switch s.g.Kind {
+	case GradientLinear:
+		position = dx*s.dirX + dy*s.dirY + s.length/2
+	case GradientRadial:
+		if s.radiusX <= 0 || s.radiusY <= 0 {
+			return s.color(len(s.colors) - 1)
+		}
+		position = float32(math.Hypot(float64(dx/s.radiusX), float64(dy/s.radiusY))) * s.radiusX
+	case GradientConic:
+		turn := math.Atan2(float64(dx), float64(-dy))/(2*math.Pi) - float64(s.g.Angle)/360
+		position = float32(turn - math.Floor(turn))
+	}
+	return s.colorAt(position)
+}
+
+// colorAt returns the color at a position along the gradient line
+func (s *gradientShader) colorAt(position float32) color.NRGBA {
+	first, last := s.positions[0], s.positions[len(s.positions)-1]
+	if s.g.Repeating {
+		period := last - first
+		if period <= 0 {
+			return s.color(len(s.colors) - 1)
+		}
+		position -= float32(math.Floor(float64((position-first)/period))) * period
+	}
+	if position <= first {
+		return s.color(0)
+	}
+	for i := 1; i < len(s.positions); i++ {
+		if position < s.positions[i] {
+			from, to := s.positions[i-1], s.positions[i]
+			t := (position - from) / (to - from)
+			a, b := s.colors[i-1], s.colors[i]
+			var mixed [4]float32
+			for j := range mixed {
+				mixed[j] = a[j] + (b[j]-a[j])*t
+			}
+			return premultipliedToNRGBA(mixed)
+		}
+	}
+	return s.color(len(s.colors) - 1)
+}
+
+// color returns the color of a stop
+func (s *gradientShader) color(i int) color.NRGBA {
+	return premultipliedToNRGBA(s.colors[i])
+}
+
+// premultipliedToNRGBA converts premultiplied channels in [0, 1] to a color
+func premultipliedToNRGBA(c [4]float32) color.NRGBA {
+	if c[3] <= 0 {
+		return color.NRGBA{}
+	}
+	channel := func(v float32) uint8 { return uint8(min(max(v, 0), 1)*255 + 0.5) }
+	return color.NRGBA{R: channel(c[0] / c[3]), G: channel(c[1] / c[3]), B: channel(c[2] / c[3]), A: channel(c[3])}
+}
+
+// abs32 returns the absolute value of x
+func abs32(x float32) float32 {
+	return float32(math.Abs(float64(x)))
+}
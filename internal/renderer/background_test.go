@@ -0,0 +1,250 @@
+package renderer
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/vyquocvu/goosie/internal/css"
+	imageloader "github.com/vyquocvu/goosie/internal/image"
+)
+
+func TestParseBackgroundShorthand(t *testing.T) {
+	sm := NewStyleManager(nil)
+	node := &RenderNode{Type: NodeTypeElement, ComputedStyle: &Style{BackgroundSize: []string{"cover"}}}
+	style := node.ComputedStyle
+	sm.applyDeclaration(node, css.Declaration{Property: "background",
+		Value: `url("a/b.png") no-repeat right 10px top/50% auto fixed content-box, linear-gradient(to right, red, blue) #00f`})
+
+	if len(style.BackgroundImage) != 2 || style.BackgroundImage[0] != `url("a/b.png")` || style.BackgroundImage[1] != "linear-gradient(to right, red, blue)" {
+		t.Fatalf("Unexpected images %q", style.BackgroundImage)
+	}
+	if style.BackgroundPosition[0] != "right 10px top" || style.BackgroundSize[0] != "50% auto" || style.BackgroundRepeat[0] != "no-repeat" {
+		t.Errorf("Unexpected position %q, size %q or repeat %q", style.BackgroundPosition[0], style.BackgroundSize[0], style.BackgroundRepeat[0])
+	}
+	if style.BackgroundAttachment[0] != "fixed" || style.BackgroundOrigin[0] != "content-box" || style.BackgroundClip[0] != "content-box" {
+		t.Errorf("Unexpected attachment %q, origin %q or clip %q", style.BackgroundAttachment[0], style.BackgroundOrigin[0], style.BackgroundClip[0])
+	}
+	// The shorthand resets the properties a layer does not set
+	if style.BackgroundSize[1] != "auto" || style.BackgroundPosition[1] != "0% 0%" || style.BackgroundOrigin[1] != "padding-box" {
+		t.Errorf("Expected initial values for the second layer, got %q, %q and %q", style.BackgroundSize[1], style.BackgroundPosition[1], style.BackgroundOrigin[1])
+	}
+	if style.BackgroundColor != (color.RGBA{B: 255, A: 255}) {
+		t.Errorf("Expected the color of the last layer, got %v", style.BackgroundColor)
+	}
+
+	sm.applyDeclaration(node, css.Declaration{Property: "background", Value: "red"})
+	if len(style.BackgroundImage) != 1 || style.BackgroundImage[0] != "none" || style.BackgroundColor != (color.RGBA{R: 255, A: 255}) {
+		t.Errorf("Expected a color only background, got %q and %v", style.BackgroundImage, style.BackgroundColor)
+	}
+}
+
+func TestParsePosition(t *testing.T) {
+	tests := []struct {
+		value string
+		x, y  LengthPercent
+	}{
+		{"center", LengthPercent{Fraction: 0.5}, LengthPercent{Fraction: 0.5}},
+		{"top", LengthPercent{Fraction: 0.5}, LengthPercent{}},
+		{"25% 10px", LengthPercent{Fraction: 0.25}, LengthPercent{Pixels: 10}},
+		{"bottom right", LengthPercent{Fraction: 1}, LengthPercent{Fraction: 1}},
+		{"right 10px bottom 20%", LengthPercent{Pixels: -10, Fraction: 1}, LengthPercent{Fraction: 0.8}},
+		{"left 5px top", LengthPercent{Pixels: 5}, LengthPercent{}},
+	}
+	for _, tt := range tests {
+		x, y, ok := parsePosition(tt.value, 16)
+		if !ok || x != tt.x || y != tt.y {
+			t.Errorf("parsePosition(%q) = %v, %v, %v; expected %v, %v", tt.value, x, y, ok, tt.x, tt.y)
+		}
+	}
+	for _, invalid := range []string{"", "left right", "top 10px 20px 30px 40px", "middle"} {
+		if _, _, ok := parsePosition(invalid, 16); ok {
+			t.Errorf("Expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestParseGradient(t *testing.T) {
+	g, ok := parseGradient("linear-gradient(to top right, red, rgba(0, 0, 255, 0.5) 30% 60%, white)", 16)
+	if !ok || g.Kind != GradientLinear || g.Angle != 45 || !g.ToCorner || len(g.Stops) != 4 {
+		t.Fatalf("Unexpected linear gradient %+v", g)
+	}
+	if !g.Stops[0].Auto || g.Stops[1].Position.Fraction != 0.3 || g.Stops[2].Position.Fraction != 0.6 || !g.Stops[3].Auto {
+		t.Errorf("Expected a stop with two positions to become two stops, got %+v", g.Stops)
+	}
+
+	g, ok = parseGradient("repeating-radial-gradient(circle closest-side at 25% 10px, red, blue 2em)", 10)
+	if !ok || g.Kind != GradientRadial || !g.Repeating || !g.Circle || g.Extent != "closest-side" ||
+		g.CenterX != (LengthPercent{Fraction: 0.25}) || g.CenterY != (LengthPercent{Pixels: 10}) || g.Stops[1].Position.Pixels != 20 {
+		t.Errorf("Unexpected radial gradient %+v", g)
+	}
+
+	g, ok = parseGradient("radial-gradient(40px 20%, red, blue)", 16)
+	if !ok || g.Circle || g.Extent != "" || g.RadiusX.Pixels != 40 || g.RadiusY.Fraction != 0.2 {
+		t.Errorf("Expected an ellipse with explicit radii, got %+v", g)
+	}
+
+	g, ok = parseGradient("conic-gradient(from 0.25turn, red 90deg, blue 50%)", 16)
+	if !ok || g.Kind != GradientConic || g.Angle != 90 || g.Stops[0].Position.Fraction != 0.25 || g.Stops[1].Position.Fraction != 0.5 {
+		t.Errorf("Unexpected conic gradient %+v", g)
+	}
+
+	for _, invalid := range []string{
+		"linear-gradient(red)",
+		"linear-gradient(to middle, red, blue)",
+		"linear-gradient(at center, red, blue)",
+		"radial-gradient(circle 10%, red, blue)",
+		"sparkle-gradient(red, blue)",
+		"linear-gradient(red 10 px, blue)",
+	} {
+		if _, ok := parseGradient(invalid, 16); ok {
+			t.Errorf("Expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestBackgroundTilingTile(t *testing.T) {
+	area := Rect{X: 10, Y: 20, Width: 200, Height: 100}
+	tests := []struct {
+		name         string
+		tiling       BackgroundTiling
+		iw, ih       float32
+		tile         Rect
+		stepX, stepY float32
+	}{
+		{"intrinsic", BackgroundTiling{RepeatX: "repeat", RepeatY: "repeat"}, 50, 25,
+			Rect{X: 10, Y: 20, Width: 50, Height: 25}, 50, 25},
+		{"gradient", BackgroundTiling{RepeatX: "repeat", RepeatY: "repeat"}, 0, 0,
+			Rect{X: 10, Y: 20, Width: 200, Height: 100}, 200, 100},
+		{"cover", BackgroundTiling{Fit: "cover", X: LengthPercent{Fraction: 0.5}, Y: LengthPercent{Fraction: 0.5}, RepeatX: "no-repeat", RepeatY: "no-repeat"}, 50, 50,
+			Rect{X: 10, Y: -30, Width: 200, Height: 200}, 0, 0},
+		{"contain", BackgroundTiling{Fit: "contain", X: LengthPercent{Fraction: 1}, RepeatX: "no-repeat", RepeatY: "no-repeat"}, 50, 50,
+			Rect{X: 110, Y: 20, Width: 100, Height: 100}, 0, 0},
+		{"width only", BackgroundTiling{Width: 100, RepeatX: "repeat", RepeatY: "repeat"}, 50, 25,
+			Rect{X: 10, Y: 20, Width: 100, Height: 50}, 100, 50},
+		{"offset", BackgroundTiling{Width: 40, Height: 40, X: LengthPercent{Pixels: -10, Fraction: 1}, RepeatX: "no-repeat", RepeatY: "repeat"}, 0, 0,
+			Rect{X: 160, Y: 20, Width: 40, Height: 40}, 0, 40},
+		{"space", BackgroundTiling{RepeatX: "space", RepeatY: "no-repeat"}, 60, 60,
+			Rect{X: 10, Y: 20, Width: 60, Height: 60}, 70, 0},
+		{"round", BackgroundTiling{RepeatX: "round", RepeatY: "repeat"}, 60, 30,
+			Rect{X: 10, Y: 20, Width: 200.0 / 3, Height: 200.0 / 3 / 2}, 200.0 / 3, 200.0 / 3 / 2},
+	}
+	for _, tt := range tests {
+		tt.tiling.Area = area
+		tile, stepX, stepY := tt.tiling.tile(tt.iw, tt.ih)
+		if tile != tt.tile || stepX != tt.stepX || stepY != tt.stepY {
+			t.Errorf("%s: got %v, %v, %v; expected %v, %v, %v", tt.name, tile, stepX, stepY, tt.tile, tt.stepX, tt.stepY)
+		}
+	}
+}
+
+// gradientColor returns the color of a gradient at a point of a tile
+func gradientColor(t *testing.T, value string, width, height, x, y float32) color.NRGBA {
+	t.Helper()
+	g, ok := parseGradient(value, 16)
+	if !ok {
+		t.Fatalf("Failed to parse %q", value)
+	}
+	return newGradientShader(g, width, height).at(x, y)
+}
+
+func TestGradientColors(t *testing.T) {
+	red, blue := color.NRGBA{R: 255, A: 255}, color.NRGBA{B: 255, A: 255}
+	tests := []struct {
+		gradient string
+		x, y     float32
+		expected color.NRGBA
+	}{
+		{"linear-gradient(red, blue)", 50, 0, red},
+		{"linear-gradient(red, blue)", 50, 100, blue},
+		{"linear-gradient(red, blue)", 50, 50, color.NRGBA{R: 128, B: 128, A: 255}},
+		{"linear-gradient(90deg, red 50%, blue 50%)", 49, 10, red},
+		{"linear-gradient(90deg, red 50%, blue 50%)", 51, 10, blue},
+		{"linear-gradient(to bottom right, red 50%, blue 50%)", 90, 20, blue},
+		{"linear-gradient(to bottom right, red 50%, blue 50%)", 10, 80, red},
+		{"repeating-linear-gradient(90deg, red 0 10px, blue 10px 20px)", 25, 0, blue},
+		{"repeating-linear-gradient(90deg, red 0 10px, blue 10px 20px)", 45, 0, red},
+		{"radial-gradient(circle 10px, red 50%, blue 50%)", 52, 50, red},
+		{"radial-gradient(circle 10px, red 50%, blue 50%)", 58, 50, blue},
+		{"radial-gradient(red, blue)", 0, 0, blue},
+		{"conic-gradient(red 25%, blue 25%)", 60, 40, red},
+		{"conic-gradient(red 25%, blue 25%)", 60, 60, blue},
+		{"conic-gradient(from 90deg, red 25%, blue 25%)", 60, 60, red},
+		{"linear-gradient(transparent, blue)", 50, 50, color.NRGBA{B: 255, A: 128}},
+	}
+	for _, tt := range tests {
+		c := gradientColor(t, tt.gradient, 100, 100, tt.x, tt.y)
+		if diff := int(c.R) - int(tt.expected.R) + int(c.B) - int(tt.expected.B) + int(c.A) - int(tt.expected.A); c.G != tt.expected.G || diff < -3 || diff > 3 {
+			t.Errorf("%s at (%v, %v): got %v, expected %v", tt.gradient, tt.x, tt.y, c, tt.expected)
+		}
+	}
+}
+
+func TestDisplayListBackgroundLayers(t *testing.T) {
+	commands := decoratedNode(t, `<html><head><style>
+.hero { border: 4px solid black; padding: 6px; height: 50px; background-color: yellow;
+	background-image: url(top.png), linear-gradient(red, blue);
+	background-clip: content-box, border-box; background-size: 20px;
+	background-attachment: scroll, fixed; background-repeat: no-repeat; }
+</style></head><body><div class="hero"></div></body></html>`, "hero")
+
+	if len(commands) != 4 || commands[0].Type != PaintRect || commands[1].Type != PaintGradient || commands[2].Type != PaintBackgroundImage {
+		t.Fatalf("Expected the color and the layers from the bottom up, got %+v", commands)
+	}
+	color, gradient, img := commands[0], commands[1], commands[2]
+	border := color.Box
+	if gradient.Box != border || gradient.BackgroundIndex != 1 || gradient.Gradient == nil {
+		t.Errorf("Expected the gradient clipped to the border box, got %+v", gradient)
+	}
+	if img.ImageSrc != "top.png" || img.BackgroundIndex != 0 || img.Box.X != border.X+10 || img.Box.Width != border.Width-20 {
+		t.Errorf("Expected the image clipped to the content box, got %+v", img)
+	}
+	if img.Tiling.Area.X != border.X+4 || img.Tiling.Width != 20 || img.Tiling.RepeatX != "no-repeat" {
+		t.Errorf("Expected the image positioned in the padding box, got %+v", img.Tiling)
+	}
+	if gradient.Tiling.Area.Y != 0 || gradient.Tiling.Area.Width != 800 {
+		t.Errorf("Expected the fixed gradient positioned against the root box, got %+v", gradient.Tiling.Area)
+	}
+}
+
+func TestRasterRendererBackgrounds(t *testing.T) {
+	tile := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 2; x++ {
+			tile.Set(x, y, testRed)
+		}
+	}
+	node := &RenderNode{BackgroundImages: []*imageloader.ImageData{
+		nil,
+		{Image: tile, Width: 2, Height: 2, State: imageloader.StateLoaded},
+	}}
+
+	dl := NewDisplayList()
+	dl.AddCommand(&PaintCommand{Type: PaintGradient, Box: Rect{Width: 40, Height: 40},
+		Tiling:   &BackgroundTiling{Area: Rect{Width: 40, Height: 40}, RepeatX: "repeat", RepeatY: "repeat"},
+		Gradient: &Gradient{Kind: GradientLinear, Angle: 90, Stops: []GradientStop{{Color: testBlue, Position: LengthPercent{Fraction: 0.5}}, {Color: color.Black, Position: LengthPercent{Fraction: 0.5}}}}})
+	// 12x12 tiles spaced vertically, clipped to a box with rounded corners
+	dl.AddCommand(&PaintCommand{Type: PaintBackgroundImage, Node: node, BackgroundIndex: 1, Box: Rect{X: 50, Y: 0, Width: 40, Height: 40},
+		Radii:  CornerRadii{{X: 10, Y: 10}, {X: 10, Y: 10}, {X: 10, Y: 10}, {X: 10, Y: 10}},
+		Tiling: &BackgroundTiling{Area: Rect{X: 50, Y: 0, Width: 40, Height: 40}, Width: 12, X: LengthPercent{Pixels: 10}, RepeatX: "repeat", RepeatY: "space"}})
+	// Backgrounds of images that are not loaded paint nothing
+	dl.AddCommand(&PaintCommand{Type: PaintBackgroundImage, Node: node, Box: Rect{X: 100, Width: 10, Height: 10},
+		Tiling: &BackgroundTiling{Area: Rect{X: 100, Width: 10, Height: 10}, RepeatX: "repeat", RepeatY: "repeat"}})
+
+	img := NewRasterRenderer().Render(dl, 120, 40)
+	if !sameColor(img, 10, 20, testBlue) || !sameColor(img, 30, 20, color.Black) {
+		t.Errorf("Expected the gradient halves, got %v and %v", img.At(10, 20), img.At(30, 20))
+	}
+	if !sameColor(img, 65, 5, testRed) || !sameColor(img, 55, 5, testRed) {
+		t.Errorf("Expected image tiles, got %v and %v", img.At(65, 5), img.At(55, 5))
+	}
+	if !sameColor(img, 62, 13, color.White) || !sameColor(img, 62, 15, testRed) {
+		t.Errorf("Expected spaces between tiles, got %v", img.At(62, 13))
+	}
+	if !sameColor(img, 50, 0, color.White) {
+		t.Error("Expected the rounded corner to clip the background")
+	}
+	if countInkPixels(img, image.Rect(100, 0, 110, 10)) != 0 {
+		t.Error("Expected nothing painted for an image that is not loaded")
+	}
+}
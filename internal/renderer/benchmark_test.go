@@ -2,6 +2,7 @@ package renderer
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -292,3 +293,116 @@ func benchmarkViewportScroll(b *testing.B, n int) {
 		cr.RenderWithViewport(root, layoutRoot)
 	}
 }
+
+// Incremental layout benchmarks edit a document of about 10k nodes: a body
+// with 100 sections of 50 paragraphs. The boxes-laid-out/op metric counts the
+// boxes an edit lays out again, which follows the size of the edited subtree.
+
+const (
+	incrementalSections   = 100
+	incrementalParagraphs = 50
+)
+
+// createIncrementalBenchmarkTree creates the styled benchmark document
+// Fixed sections have a fixed height and clip their content, so edits inside
+// them never move the following sections.
+func createIncrementalBenchmarkTree(b *testing.B, fixed bool) *RenderNode {
+	var page strings.Builder
+	page.WriteString(`<html><head><style>.fixed { height: 1200px; overflow: hidden; }</style></head><body>`)
+	for s := 0; s < incrementalSections; s++ {
+		if fixed {
+			page.WriteString(`<div class="fixed">`)
+		} else {
+			page.WriteString(`<div>`)
+		}
+		for p := 0; p < incrementalParagraphs; p++ {
+			fmt.Fprintf(&page, "<p>Section %d paragraph %d</p>", s, p)
+		}
+		page.WriteString(`</div>`)
+	}
+	page.WriteString(`</body></html>`)
+	return styledRenderTree(b, page.String())
+}
+
+// incrementalSection returns the element of a section of the benchmark document
+func incrementalSection(root *RenderNode, section int) *RenderNode {
+	return findText(root, fmt.Sprintf("Section %d paragraph 0", section)).Parent.Parent
+}
+
+// BenchmarkFullLayout10k lays out the whole document, the cost of any edit without incremental layout
+func BenchmarkFullLayout10k(b *testing.B) {
+	root := createIncrementalBenchmarkTree(b, true)
+	le := NewLayoutEngine(800, 600)
+	
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		le.ComputeLayout(root)
+	}
+}
+
+// BenchmarkIncrementalLayoutParagraph10k edits the text of one paragraph
+func BenchmarkIncrementalLayoutParagraph10k(b *testing.B) {
+	benchmarkIncrementalLayout(b, true, func(root *RenderNode) []*RenderNode {
+		return []*RenderNode{findText(root, "Section 50 paragraph 25")}
+	})
+}
+
+// BenchmarkIncrementalLayoutSection10k edits every paragraph of one section
+func BenchmarkIncrementalLayoutSection10k(b *testing.B) {
+	benchmarkIncrementalLayout(b, true, func(root *RenderNode) []*RenderNode {
+		return incrementalTexts(root, 50, 1)
+	})
+}
+
+// BenchmarkIncrementalLayoutTenSections10k edits every paragraph of ten sections
+func BenchmarkIncrementalLayoutTenSections10k(b *testing.B) {
+	benchmarkIncrementalLayout(b, true, func(root *RenderNode) []*RenderNode {
+		return incrementalTexts(root, 45, 10)
+	})
+}
+
+// BenchmarkIncrementalLayoutShift10k edits a paragraph in the first section
+// of a document without fixed sections, moving all the following content
+func BenchmarkIncrementalLayoutShift10k(b *testing.B) {
+	benchmarkIncrementalLayout(b, false, func(root *RenderNode) []*RenderNode {
+		return []*RenderNode{findText(root, "Section 0 paragraph 25")}
+	})
+}
+
+// incrementalTexts returns the text nodes of count sections from first
+func incrementalTexts(root *RenderNode, first, count int) []*RenderNode {
+	var texts []*RenderNode
+	for s := first; s < first+count; s++ {
+		for _, paragraph := range incrementalSection(root, s).Children {
+			texts = append(texts, paragraph.Children...)
+		}
+	}
+	return texts
+}
+
+// benchmarkIncrementalLayout alternates the edited texts between one and
+// two lines and lays out the document again
+func benchmarkIncrementalLayout(b *testing.B, fixed bool, edited func(*RenderNode) []*RenderNode) {
+	root := createIncrementalBenchmarkTree(b, fixed)
+	ile := NewIncrementalLayoutEngine(800, 600)
+	layoutRoot := ile.ComputeIncrementalLayout(root, nil)
+	texts := edited(root)
+	short := texts[0].Text
+	long := strings.Repeat(short+" ", 8)
+	
+	laidOut := 0
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, text := range texts {
+			if i%2 == 0 {
+				text.Text = long
+			} else {
+				text.Text = short
+			}
+			ile.InvalidateNode(text, DirtyLayout)
+		}
+		layoutRoot = ile.ComputeIncrementalLayout(root, layoutRoot)
+		laidOut += ile.lastLaidOut
+	}
+	b.ReportMetric(float64(laidOut)/float64(b.N), "boxes-laid-out/op")
+}
@@ -0,0 +1,644 @@
+package renderer
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/bidi"
+)
+
+// Bidi formatting characters used to express CSS unicode-bidi in the text of a paragraph
+const (
+	bidiLRE = '\u202A'
+	bidiRLE = '\u202B'
+	bidiPDF = '\u202C'
+	bidiLRO = '\u202D'
+	bidiRLO = '\u202E'
+	bidiLRI = '\u2066'
+	bidiRLI = '\u2067'
+	bidiFSI = '\u2068'
+	bidiPDI = '\u2069'
+)
+
+// maxBidiDepth is the deepest explicit embedding level (BD2)
+const maxBidiDepth = 125
+
+// bidiClass returns the UAX #9 bidi class of a rune
+func bidiClass(r rune) bidi.Class {
+	props, _ := bidi.LookupRune(r)
+	return props.Class()
+}
+
+// bidiBracket reports whether r is a paired bracket (BD14, BD15) and returns
+// the bracket it pairs with
+func bidiBracket(r rune) (pair rune, opening, ok bool) {
+	props, _ := bidi.LookupRune(r)
+	if !props.IsBracket() {
+		return 0, false, false
+	}
+	pair, _ = utf8.DecodeRuneInString(bidi.ReverseString(string(r)))
+	return pair, props.IsOpeningBracket(), true
+}
+
+// hasBidiContent reports whether text needs bidi resolution in a left-to-right paragraph
+func hasBidiContent(text string) bool {
+	for _, r := range text {
+		if r < 0x0590 {
+			continue
+		}
+		switch bidiClass(r) {
+		case bidi.R, bidi.AL, bidi.AN, bidi.RLE, bidi.RLO, bidi.RLI, bidi.FSI:
+			return true
+		}
+	}
+	return false
+}
+
+// bidiParagraph holds the state of the UAX #9 algorithm for one paragraph
+// Character classes and bracket pairs come from x/text/unicode/bidi, whose
+// Paragraph only reports run directions, not the embedding levels line layout needs
+type bidiParagraph struct {
+	text    []rune
+	classes []bidi.Class // original bidi classes
+	types   []bidi.Class // classes as resolved by the rules
+	levels  []int
+	level   int // paragraph embedding level
+
+	matchingPDI       []int // for isolate initiators, the index of the matching PDI or -1
+	matchingInitiator []int // for PDIs, the index of the matching isolate initiator or -1
+}
+
+// resolveBidiLevels resolves the embedding level of every rune of a paragraph
+// (UAX #9 rules P2 to I2); paragraphLevel is 0 or 1, or -1 to detect it from
+// the first strong character; it returns the levels and the paragraph level
+func resolveBidiLevels(text []rune, paragraphLevel int) ([]int, int) {
+	p := &bidiParagraph{
+		text:    text,
+		classes: make([]bidi.Class, len(text)),
+		types:   make([]bidi.Class, len(text)),
+		levels:  make([]int, len(text)),
+	}
+	for i, r := range text {
+		p.classes[i] = bidiClass(r)
+	}
+	copy(p.types, p.classes)
+	p.matchIsolates()
+
+	p.level = paragraphLevel
+	if p.level < 0 {
+		p.level = 0
+		if p.firstStrong(0, len(text)) == 1 {
+			p.level = 1
+		}
+	}
+
+	p.resolveExplicit()
+	for _, seq := range p.isolatingRunSequences() {
+		p.resolveSequence(seq)
+	}
+
+	// Characters removed by X9 take the level of the character before them
+	for i, c := range p.classes {
+		if !isRemovedByX9(c) {
+			continue
+		}
+		if i > 0 {
+			p.levels[i] = p.levels[i-1]
+		} else {
+			p.levels[i] = p.level
+		}
+	}
+	return p.levels, p.level
+}
+
+// isIsolateInitiator reports whether a class starts an isolate
+func isIsolateInitiator(c bidi.Class) bool {
+	return c == bidi.LRI || c == bidi.RLI || c == bidi.FSI
+}
+
+// isRemovedByX9 reports whether a class is ignored after the explicit rules
+func isRemovedByX9(c bidi.Class) bool {
+	switch c {
+	case bidi.LRE, bidi.RLE, bidi.LRO, bidi.RLO, bidi.PDF, bidi.BN:
+		return true
+	}
+	return false
+}
+
+// isNeutralOrIsolate reports whether a class is an NI for rules N1 and N2
+func isNeutralOrIsolate(c bidi.Class) bool {
+	switch c {
+	case bidi.B, bidi.S, bidi.WS, bidi.ON, bidi.LRI, bidi.RLI, bidi.FSI, bidi.PDI:
+		return true
+	}
+	return false
+}
+
+// matchIsolates pairs isolate initiators with their PDIs (BD9)
+func (p *bidiParagraph) matchIsolates() {
+	p.matchingPDI = make([]int, len(p.text))
+	p.matchingInitiator = make([]int, len(p.text))
+	stack := make([]int, 0)
+	for i, c := range p.classes {
+		p.matchingPDI[i] = -1
+		p.matchingInitiator[i] = -1
+		switch {
+		case isIsolateInitiator(c):
+			stack = append(stack, i)
+		case c == bidi.PDI && len(stack) > 0:
+			open := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			p.matchingPDI[open] = i
+			p.matchingInitiator[i] = open
+		case c == bidi.B:
+			stack = stack[:0]
+		}
+	}
+}
+
+// firstStrong returns the direction of the first strong character in
+// [start, end) skipping isolates (rules P2 and P3), or -1 if there is none
+func (p *bidiParagraph) firstStrong(start, end int) int {
+	for i := start; i < end; i++ {
+		switch p.classes[i] {
+		case bidi.L:
+			return 0
+		case bidi.R, bidi.AL:
+			return 1
+		case bidi.LRI, bidi.RLI, bidi.FSI:
+			if p.matchingPDI[i] < 0 {
+				return -1
+			}
+			i = p.matchingPDI[i]
+		}
+	}
+	return -1
+}
+
+// bidiStatus is an entry of the directional status stack
+type bidiStatus struct {
+	level    int
+	override bidi.Class // L, R or ON for no override
+	isolate  bool
+}
+
+// resolveExplicit applies the explicit embedding rules X1 to X9
+func (p *bidiParagraph) resolveExplicit() {
+	stack := []bidiStatus{{level: p.level, override: bidi.ON}}
+	overflowIsolates, overflowEmbeddings, validIsolates := 0, 0, 0
+
+	nextLevel := func(rtl bool) int {
+		level := stack[len(stack)-1].level
+		if rtl {
+			return (level + 1) | 1
+		}
+		return (level + 2) &^ 1
+	}
+
+	for i, c := range p.classes {
+		top := stack[len(stack)-1]
+		switch c {
+		case bidi.RLE, bidi.LRE, bidi.RLO, bidi.LRO:
+			p.levels[i] = top.level
+			level := nextLevel(c == bidi.RLE || c == bidi.RLO)
+			if level <= maxBidiDepth && overflowIsolates == 0 && overflowEmbeddings == 0 {
+				status := bidiStatus{level: level, override: bidi.ON}
+				if c == bidi.RLO {
+					status.override = bidi.R
+				} else if c == bidi.LRO {
+					status.override = bidi.L
+				}
+				stack = append(stack, status)
+			} else if overflowIsolates == 0 {
+				overflowEmbeddings++
+			}
+
+		case bidi.RLI, bidi.LRI, bidi.FSI:
+			p.levels[i] = top.level
+			if top.override != bidi.ON {
+				p.types[i] = top.override
+			}
+			rtl := c == bidi.RLI
+			if c == bidi.FSI {
+				end := p.matchingPDI[i]
+				if end < 0 {
+					end = len(p.text)
+				}
+				rtl = p.firstStrong(i+1, end) == 1
+			}
+			level := nextLevel(rtl)
+			if level <= maxBidiDepth && overflowIsolates == 0 && overflowEmbeddings == 0 {
+				validIsolates++
+				stack = append(stack, bidiStatus{level: level, override: bidi.ON, isolate: true})
+			} else {
+				overflowIsolates++
+			}
+
+		case bidi.PDI:
+			if overflowIsolates > 0 {
+				overflowIsolates--
+			} else if validIsolates > 0 {
+				overflowEmbeddings = 0
+				for !stack[len(stack)-1].isolate {
+					stack = stack[:len(stack)-1]
+				}
+				stack = stack[:len(stack)-1]
+				validIsolates--
+			}
+			top = stack[len(stack)-1]
+			p.levels[i] = top.level
+			if top.override != bidi.ON {
+				p.types[i] = top.override
+			}
+
+		case bidi.PDF:
+			p.levels[i] = top.level
+			switch {
+			case overflowIsolates > 0:
+				// The PDF is inside an overflowing isolate
+			case overflowEmbeddings > 0:
+				overflowEmbeddings--
+			case !top.isolate && len(stack) >= 2:
+				stack = stack[:len(stack)-1]
+			}
+
+		case bidi.B:
+			p.levels[i] = p.level
+
+		case bidi.BN:
+			p.levels[i] = top.level
+
+		default:
+			p.levels[i] = top.level
+			if top.override != bidi.ON {
+				p.types[i] = top.override
+			}
+		}
+	}
+
+	// X9: embedding controls and boundary neutrals take no further part
+	for i, c := range p.classes {
+		if isRemovedByX9(c) {
+			p.types[i] = bidi.BN
+		}
+	}
+}
+
+// isolatingRunSequences splits the paragraph into isolating run sequences (BD13, X10)
+func (p *bidiParagraph) isolatingRunSequences() [][]int {
+	// Level runs of the characters left after X9
+	runs := make([][]int, 0)
+	runOf := make([]int, len(p.text))
+	var current []int
+	for i := range p.text {
+		runOf[i] = -1
+		if isRemovedByX9(p.classes[i]) {
+			continue
+		}
+		if len(current) > 0 && p.levels[i] != p.levels[current[len(current)-1]] {
+			runs = append(runs, current)
+			current = nil
+		}
+		current = append(current, i)
+		runOf[i] = len(runs)
+	}
+	if len(current) > 0 {
+		runs = append(runs, current)
+	}
+
+	sequences := make([][]int, 0, len(runs))
+	for _, run := range runs {
+		first := run[0]
+		if p.classes[first] == bidi.PDI && p.matchingInitiator[first] >= 0 {
+			// Continues the sequence of its isolate initiator
+			continue
+		}
+		seq := append([]int(nil), run...)
+		for {
+			last := seq[len(seq)-1]
+			if !isIsolateInitiator(p.classes[last]) || p.matchingPDI[last] < 0 {
+				break
+			}
+			pdi := p.matchingPDI[last]
+			next := runOf[pdi]
+			if next < 0 || runs[next][0] != pdi {
+				break
+			}
+			seq = append(seq, runs[next]...)
+		}
+		sequences = append(sequences, seq)
+	}
+	return sequences
+}
+
+// levelDirection returns the strong type of an embedding level
+func levelDirection(level int) bidi.Class {
+	if level%2 == 1 {
+		return bidi.R
+	}
+	return bidi.L
+}
+
+// resolveSequence applies the weak, neutral and implicit rules to an isolating run sequence
+func (p *bidiParagraph) resolveSequence(seq []int) {
+	level := p.levels[seq[0]]
+
+	// sos and eos come from the higher of the sequence level and its neighbours
+	before := p.level
+	for i := seq[0] - 1; i >= 0; i-- {
+		if !isRemovedByX9(p.classes[i]) {
+			before = p.levels[i]
+			break
+		}
+	}
+	after := p.level
+	if last := seq[len(seq)-1]; !isIsolateInitiator(p.classes[last]) {
+		for i := last + 1; i < len(p.text); i++ {
+			if !isRemovedByX9(p.classes[i]) {
+				after = p.levels[i]
+				break
+			}
+		}
+	}
+	sos := levelDirection(max(before, level))
+	eos := levelDirection(max(after, level))
+
+	types := make([]bidi.Class, len(seq))
+	for k, i := range seq {
+		types[k] = p.types[i]
+	}
+
+	p.resolveWeak(types, sos)
+	p.resolveBrackets(seq, types, sos, level)
+	resolveNeutrals(types, sos, eos, level)
+
+	// I1 and I2
+	for k, i := range seq {
+		switch t := types[k]; {
+		case level%2 == 0 && t == bidi.R:
+			p.levels[i] = level + 1
+		case level%2 == 0 && (t == bidi.AN || t == bidi.EN):
+			p.levels[i] = level + 2
+		case level%2 == 1 && (t == bidi.L || t == bidi.AN || t == bidi.EN):
+			p.levels[i] = level + 1
+		default:
+			p.levels[i] = level
+		}
+	}
+}
+
+// resolveWeak applies the weak type rules W1 to W7
+func (p *bidiParagraph) resolveWeak(types []bidi.Class, sos bidi.Class) {
+	// W1: non-spacing marks take the type of the previous character
+	prev := sos
+	for k, t := range types {
+		if t == bidi.NSM {
+			if isIsolateInitiator(prev) || prev == bidi.PDI {
+				types[k] = bidi.ON
+			} else {
+				types[k] = prev
+			}
+		}
+		prev = types[k]
+	}
+
+	// W2 and W3: European numbers after Arabic letters become Arabic numbers
+	strong := sos
+	for k, t := range types {
+		switch t {
+		case bidi.L, bidi.R, bidi.AL:
+			strong = t
+		case bidi.EN:
+			if strong == bidi.AL {
+				types[k] = bidi.AN
+			}
+		}
+	}
+	for k, t := range types {
+		if t == bidi.AL {
+			types[k] = bidi.R
+		}
+	}
+
+	// W4: single separators between numbers of the same kind
+	for k := 1; k < len(types)-1; k++ {
+		prev, next := types[k-1], types[k+1]
+		switch types[k] {
+		case bidi.ES:
+			if prev == bidi.EN && next == bidi.EN {
+				types[k] = bidi.EN
+			}
+		case bidi.CS:
+			if prev == next && (prev == bidi.EN || prev == bidi.AN) {
+				types[k] = prev
+			}
+		}
+	}
+
+	// W5: terminators next to European numbers
+	for k := 0; k < len(types); k++ {
+		if types[k] != bidi.ET {
+			continue
+		}
+		end := k
+		for end < len(types) && types[end] == bidi.ET {
+			end++
+		}
+		if (k > 0 && types[k-1] == bidi.EN) || (end < len(types) && types[end] == bidi.EN) {
+			for j := k; j < end; j++ {
+				types[j] = bidi.EN
+			}
+		}
+		k = end - 1
+	}
+
+	// W6: remaining separators and terminators are neutral
+	for k, t := range types {
+		if t == bidi.ES || t == bidi.ET || t == bidi.CS {
+			types[k] = bidi.ON
+		}
+	}
+
+	// W7: European numbers after left-to-right text become L
+	strong = sos
+	for k, t := range types {
+		switch t {
+		case bidi.L, bidi.R:
+			strong = t
+		case bidi.EN:
+			if strong == bidi.L {
+				types[k] = bidi.L
+			}
+		}
+	}
+}
+
+// strongDirection maps a resolved type to the direction it counts as in the neutral rules
+func strongDirection(t bidi.Class) bidi.Class {
+	switch t {
+	case bidi.L:
+		return bidi.L
+	case bidi.R, bidi.EN, bidi.AN:
+		return bidi.R
+	}
+	return bidi.ON
+}
+
+// resolveBrackets applies rule N0 to the paired brackets of a sequence
+func (p *bidiParagraph) resolveBrackets(seq []int, types []bidi.Class, sos bidi.Class, level int) {
+	// BD16: find the bracket pairs
+	type opening struct {
+		closing rune
+		pos     int
+	}
+	type pair struct{ open, close int }
+	stack := make([]opening, 0)
+	pairs := make([]pair, 0)
+scan:
+	for k, i := range seq {
+		if types[k] != bidi.ON {
+			continue
+		}
+		r := p.text[i]
+		partner, isOpening, ok := bidiBracket(r)
+		if !ok {
+			continue
+		}
+		if isOpening {
+			if len(stack) == 63 {
+				break scan
+			}
+			stack = append(stack, opening{partner, k})
+			continue
+		}
+		for j := len(stack) - 1; j >= 0; j-- {
+			if stack[j].closing == r {
+				pairs = append(pairs, pair{stack[j].pos, k})
+				stack = stack[:j]
+				break
+			}
+		}
+	}
+	if len(pairs) == 0 {
+		return
+	}
+	// Pairs are resolved in the order of their opening brackets
+	for a := 1; a < len(pairs); a++ {
+		for b := a; b > 0 && pairs[b].open < pairs[b-1].open; b-- {
+			pairs[b], pairs[b-1] = pairs[b-1], pairs[b]
+		}
+	}
+
+	embedding := levelDirection(level)
+	for _, pr := range pairs {
+		found := bidi.ON
+		for k := pr.open + 1; k < pr.close; k++ {
+			if d := strongDirection(types[k]); d != bidi.ON {
+				found = d
+				if d == embedding {
+					break
+				}
+			}
+		}
+		if found == bidi.ON {
+			continue
+		}
+
+		resolved := embedding
+		if found != embedding {
+			context := sos
+			for k := pr.open - 1; k >= 0; k-- {
+				if d := strongDirection(types[k]); d != bidi.ON {
+					context = d
+					break
+				}
+			}
+			if context == found {
+				resolved = found
+			}
+		}
+
+		for _, k := range []int{pr.open, pr.close} {
+			types[k] = resolved
+			// Marks on a bracket follow it
+			for j := k + 1; j < len(types) && p.classes[seq[j]] == bidi.NSM; j++ {
+				types[j] = resolved
+			}
+		}
+	}
+}
+
+// resolveNeutrals applies rules N1 and N2
+func resolveNeutrals(types []bidi.Class, sos, eos bidi.Class, level int) {
+	for k := 0; k < len(types); k++ {
+		if !isNeutralOrIsolate(types[k]) {
+			continue
+		}
+		end := k
+		for end < len(types) && isNeutralOrIsolate(types[end]) {
+			end++
+		}
+
+		before := sos
+		if k > 0 {
+			before = strongDirection(types[k-1])
+		}
+		after := eos
+		if end < len(types) {
+			after = strongDirection(types[end])
+		}
+		resolved := levelDirection(level)
+		if before == after {
+			resolved = before
+		}
+		for j := k; j < end; j++ {
+			types[j] = resolved
+		}
+		k = end - 1
+	}
+}
+
+// bidiVisualOrder returns the indexes of items in visual order given their levels (rule L2)
+func bidiVisualOrder(levels []int) []int {
+	order := make([]int, len(levels))
+	highest, lowestOdd := 0, maxBidiDepth+2
+	for i, level := range levels {
+		order[i] = i
+		highest = max(highest, level)
+		if level%2 == 1 {
+			lowestOdd = min(lowestOdd, level)
+		}
+	}
+
+	for level := highest; level >= lowestOdd; level-- {
+		for i := 0; i < len(order); i++ {
+			if levels[order[i]] < level {
+				continue
+			}
+			end := i
+			for end < len(order) && levels[order[end]] >= level {
+				end++
+			}
+			for a, b := i, end-1; a < b; a, b = a+1, b-1 {
+				order[a], order[b] = order[b], order[a]
+			}
+			i = end
+		}
+	}
+	return order
+}
+
+// bidiVisualText returns the text of a right-to-left run in display order:
+// its grapheme clusters reversed and its paired brackets mirrored (rule L4)
+func bidiVisualText(text string) string {
+	clusters := graphemeClusters(text)
+	var visual strings.Builder
+	visual.Grow(len(text))
+	for i := len(clusters) - 1; i >= 0; i-- {
+		// Marks stay after their base, so only the base is mirrored
+		base, size := utf8.DecodeRuneInString(clusters[i])
+		visual.WriteString(bidi.ReverseString(string(base)))
+		visual.WriteString(clusters[i][size:])
+	}
+	return visual.String()
+}
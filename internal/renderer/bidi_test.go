@@ -0,0 +1,332 @@
+package renderer
+
+import (
+	"strings"
+	"testing"
+
+	"fyne.io/fyne/v2"
+
+	"github.com/vyquocvu/goosie/internal/ui"
+)
+
+// visualString reorders text for display at the given paragraph level, dropping formatting characters
+func visualString(text string, paragraphLevel int) string {
+	runes := []rune(text)
+	levels, _ := resolveBidiLevels(runes, paragraphLevel)
+
+	var visual strings.Builder
+	for _, i := range bidiVisualOrder(levels) {
+		switch runes[i] {
+		case bidiLRE, bidiRLE, bidiPDF, bidiLRO, bidiRLO, bidiLRI, bidiRLI, bidiFSI, bidiPDI:
+			continue
+		}
+		visual.WriteRune(runes[i])
+	}
+	return visual.String()
+}
+
+func TestResolveBidiLevels(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		level    int
+		expected []int
+	}{
+		{"left-to-right", "ab c", 0, []int{0, 0, 0, 0}},
+		{"hebrew in ltr", "a אב", 0, []int{0, 0, 1, 1}},
+		{"numbers in rtl", "א 12", 1, []int{1, 1, 2, 2}},
+		{"latin in rtl", "אב cd", 1, []int{1, 1, 1, 2, 2}},
+		{"auto level", "אב cd", -1, []int{1, 1, 1, 2, 2}},
+		{"arabic digits after arabic letters", "ع 1", 0, []int{1, 1, 2}},
+		{"override", "‮ab‬", 0, []int{0, 1, 1, 1}},
+		{"isolate", "a⁧b⁩c", 0, []int{0, 0, 2, 0, 0}},
+		{"first strong isolate", "a⁨אב⁩", 0, []int{0, 0, 1, 1, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			levels, _ := resolveBidiLevels([]rune(tt.text), tt.level)
+			if len(levels) != len(tt.expected) {
+				t.Fatalf("Expected %d levels, got %d", len(tt.expected), len(levels))
+			}
+			for i := range levels {
+				if levels[i] != tt.expected[i] {
+					t.Errorf("Expected levels %v, got %v", tt.expected, levels)
+					break
+				}
+			}
+		})
+	}
+
+	if _, level := resolveBidiLevels([]rune("123 אב"), -1); level != 1 {
+		t.Errorf("Expected the first strong character to make the paragraph rtl, got level %d", level)
+	}
+	if _, level := resolveBidiLevels([]rune("⁧אב⁩ ab"), -1); level != 0 {
+		t.Errorf("Expected isolates to be skipped when detecting the paragraph level, got level %d", level)
+	}
+}
+
+func TestBidiVisualOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		level    int
+		expected string
+	}{
+		{"plain", "abc def", 0, "abc def"},
+		{"hebrew words in ltr", "abc אבג דהו", 0, "abc והד גבא"},
+		{"numbers stay ltr", "abc אבג 123 דהו", 0, "abc והד 123 גבא"},
+		{"rtl paragraph", "אבג abc", 1, "abc גבא"},
+		{"european separators", "א 1.5-2", 1, "1.5-2 א"},
+		{"brackets follow embedding", "אבג (abc)", 1, ")abc( גבא"},
+		{"brackets around rtl in ltr", "abc (אבג)", 0, "abc (גבא)"},
+		{"paired brackets beyond ascii", "ab⦃cd⦄", 1, "ab⦃cd⦄"},
+		{"override", "a‮bcd‬e", 0, "adcbe"},
+		{"isolate keeps neutrals inside", "⁧abc!⁩ x", 0, "!abc x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := visualString(tt.text, tt.level); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestHasBidiContent(t *testing.T) {
+	if hasBidiContent("plain text, 123 and ünïcödé") {
+		t.Error("Expected Latin text to need no bidi resolution")
+	}
+	for _, text := range []string{"שלום", "مرحبا", "a‮b", "⁨x⁩"} {
+		if !hasBidiContent(text) {
+			t.Errorf("Expected %q to need bidi resolution", text)
+		}
+	}
+}
+
+// newBidiParagraph builds a paragraph from text nodes and elements
+func newBidiParagraph(children ...*RenderNode) *RenderNode {
+	p := NewRenderNode(NodeTypeElement)
+	p.TagName = "p"
+	for _, child := range children {
+		child.Parent = p
+		p.AddChild(child)
+	}
+	return p
+}
+
+// newTextNode creates a text node
+func newTextNode(text string) *RenderNode {
+	node := NewRenderNode(NodeTypeText)
+	node.Text = text
+	return node
+}
+
+// lineTexts returns the texts of a line's boxes in visual order, checking that they do not overlap
+func lineTexts(t *testing.T, line *LineBox) []string {
+	t.Helper()
+	texts := make([]string, 0, len(line.InlineBoxes))
+	for i, box := range line.InlineBoxes {
+		if i > 0 {
+			prev := line.InlineBoxes[i-1]
+			if box.X < prev.X+prev.Width-0.01 {
+				t.Errorf("Box %q at %f overlaps box %q ending at %f", box.Text, box.X, prev.Text, prev.X+prev.Width)
+			}
+		}
+		texts = append(texts, box.Text)
+	}
+	return texts
+}
+
+func TestInlineLayoutReordersBidiText(t *testing.T) {
+	ile := NewInlineLayoutEngine(NewFontMetrics(16.0), 16.0)
+
+	tests := []struct {
+		name     string
+		dir      string
+		text     string
+		expected []string
+		levels   []int
+	}{
+		{"hebrew in ltr", "", "abc אבג דהו", []string{"abc", "דהו", "אבג"}, []int{0, 1, 1}},
+		{"latin in rtl", "rtl", "אבג abc def", []string{"abc", "def", "אבג"}, []int{2, 2, 1}},
+		{"mixed word is split", "rtl", "אבג123", []string{"123", "אבג"}, []int{2, 1}},
+		{"auto direction", "auto", "אבג abc", []string{"abc", "אבג"}, []int{2, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newBidiParagraph(newTextNode(tt.text))
+			if tt.dir != "" {
+				p.SetAttribute("dir", tt.dir)
+			}
+
+			lines, _ := ile.LayoutInlineContent(p, 0, 0, 400, WhiteSpaceNormal)
+			if len(lines) != 1 {
+				t.Fatalf("Expected 1 line, got %d", len(lines))
+			}
+			texts := lineTexts(t, lines[0])
+			if strings.Join(texts, "|") != strings.Join(tt.expected, "|") {
+				t.Fatalf("Expected boxes %q, got %q", tt.expected, texts)
+			}
+			for i, box := range lines[0].InlineBoxes {
+				if box.BidiLevel != tt.levels[i] {
+					t.Errorf("Box %q: expected level %d, got %d", box.Text, tt.levels[i], box.BidiLevel)
+				}
+			}
+		})
+	}
+}
+
+func TestInlineLayoutRTLAlignment(t *testing.T) {
+	ile := NewInlineLayoutEngine(NewFontMetrics(16.0), 16.0)
+
+	p := newBidiParagraph(newTextNode("אבג דהו"))
+	p.ComputedStyle = &Style{Direction: "rtl"}
+	lines, _ := ile.LayoutInlineContent(p, 0, 0, 400, WhiteSpaceNormal)
+	line := lines[0]
+	if right := line.X + line.Width; right < 399 || right > 401 {
+		t.Errorf("Expected rtl text to end at the right edge, got line from %f to %f", line.X, right)
+	}
+	if texts := lineTexts(t, line); texts[0] != "דהו" {
+		t.Errorf("Expected the second word first in visual order, got %q", texts)
+	}
+
+	// text-align: start and end follow the direction
+	p.ComputedStyle.TextAlign = "end"
+	lines, _ = ile.LayoutInlineContent(p, 0, 0, 400, WhiteSpaceNormal)
+	if lines[0].X != 0 {
+		t.Errorf("Expected end alignment to put rtl text on the left, got X %f", lines[0].X)
+	}
+	p.ComputedStyle.TextAlign = "left"
+	lines, _ = ile.LayoutInlineContent(p, 0, 0, 400, WhiteSpaceNormal)
+	if lines[0].X != 0 {
+		t.Errorf("Expected text-align: left to stay on the left, got X %f", lines[0].X)
+	}
+}
+
+func TestInlineLayoutBidiElements(t *testing.T) {
+	ile := NewInlineLayoutEngine(NewFontMetrics(16.0), 16.0)
+
+	// A bdo element overrides the direction of its content
+	bdo := NewRenderNode(NodeTypeElement)
+	bdo.TagName = "bdo"
+	bdo.SetAttribute("dir", "rtl")
+	inner := newTextNode("abc def")
+	inner.Parent = bdo
+	bdo.AddChild(inner)
+
+	p := newBidiParagraph(newTextNode("x"), bdo)
+	lines, _ := ile.LayoutInlineContent(p, 0, 0, 400, WhiteSpaceNormal)
+	if texts := lineTexts(t, lines[0]); strings.Join(texts, "|") != "x|def|abc" {
+		t.Errorf("Expected bdo content reversed, got %q", texts)
+	}
+
+	// An element with a dir attribute is isolated from its surroundings
+	span := NewRenderNode(NodeTypeElement)
+	span.TagName = "span"
+	span.SetAttribute("dir", "ltr")
+	spanText := newTextNode("abc def")
+	spanText.Parent = span
+	span.AddChild(spanText)
+
+	p = newBidiParagraph(newTextNode("אבג"), span, newTextNode("דהו"))
+	p.SetAttribute("dir", "rtl")
+	lines, _ = ile.LayoutInlineContent(p, 0, 0, 400, WhiteSpaceNormal)
+	if texts := lineTexts(t, lines[0]); strings.Join(texts, "|") != "דהו|abc|def|אבג" {
+		t.Errorf("Expected the ltr span to keep its order inside rtl text, got %q", texts)
+	}
+
+	// CSS unicode-bidi: bidi-override reverses ltr words in an rtl context
+	em := NewRenderNode(NodeTypeElement)
+	em.TagName = "em"
+	em.ComputedStyle = &Style{Direction: "rtl", UnicodeBidi: "bidi-override"}
+	emText := newTextNode("one two")
+	emText.Parent = em
+	em.AddChild(emText)
+
+	p = newBidiParagraph(em)
+	lines, _ = ile.LayoutInlineContent(p, 0, 0, 400, WhiteSpaceNormal)
+	if texts := lineTexts(t, lines[0]); strings.Join(texts, "|") != "two|one" {
+		t.Errorf("Expected overridden words reversed, got %q", texts)
+	}
+}
+
+func TestInlineLayoutBidiAcrossLines(t *testing.T) {
+	ile := NewInlineLayoutEngine(NewFontMetrics(16.0), 16.0)
+
+	// Lines are reordered on their own after line breaking
+	p := newBidiParagraph(newTextNode("אבג דהו זחט יכל מנס עפצ"))
+	p.SetAttribute("dir", "rtl")
+	lines, _ := ile.LayoutInlineContent(p, 0, 0, 80, WhiteSpaceNormal)
+	if len(lines) < 2 {
+		t.Fatalf("Expected the paragraph to wrap, got %d lines", len(lines))
+	}
+	if texts := lineTexts(t, lines[0]); texts[len(texts)-1] != "אבג" {
+		t.Errorf("Expected the first word at the right end of the first line, got %q", texts)
+	}
+
+	// Preserved newlines end bidi paragraphs
+	p = newBidiParagraph(newTextNode("abc אבג\nדהו def"))
+	lines, _ = ile.LayoutInlineContent(p, 0, 0, 400, WhiteSpacePre)
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(lines))
+	}
+	if texts := lineTexts(t, lines[1]); strings.Join(texts, "|") != "דהו| def" {
+		t.Errorf("Expected the second paragraph to be resolved on its own, got %q", texts)
+	}
+}
+
+func TestCanvasPaintsBidiFragments(t *testing.T) {
+	text := newTextNode("abc אבג דהו")
+	newBidiParagraph(text)
+	cmd := &PaintCommand{
+		Type: PaintText,
+		Node: text,
+		Text: text.Text,
+		// Inline layout placed the Hebrew words right to left
+		Fragments: []TextFragment{
+			{Text: "abc", Box: Rect{X: 0, Y: 0, Width: 30, Height: 16}},
+			{Text: "דהו", Box: Rect{X: 35, Y: 0, Width: 30, Height: 16}, BidiLevel: 1},
+			{Text: "אבג", Box: Rect{X: 70, Y: 0, Width: 30, Height: 16}, BidiLevel: 1},
+		},
+	}
+
+	objects := make([]fyne.CanvasObject, 0)
+	NewCanvasRenderer(800, 600).renderCommand(cmd, &objects)
+	if len(objects) != 1 {
+		t.Fatalf("Expected 1 object, got %d", len(objects))
+	}
+	label, ok := objects[0].(*ui.SelectableText)
+	if !ok {
+		t.Fatalf("Expected selectable text, got %T", objects[0])
+	}
+	if got := label.GetText(); got != "abc והד גבא" {
+		t.Errorf("Expected the fragments in visual order, got %q", got)
+	}
+
+	// Left-to-right text keeps its logical text
+	cmd.Fragments = cmd.Fragments[:1]
+	if got := visualText(cmd); got != cmd.Text {
+		t.Errorf("Expected left-to-right text to be unchanged, got %q", got)
+	}
+}
+
+func TestBidiVisualText(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"abc", "cba"},
+		{"(a)", "(a)"},
+		{"a[b", "b]a"},
+		{"a<b", "b<a"}, // only paired brackets are mirrored
+		{"e\u0301x", "xe\u0301"}, // combining marks stay with their base
+	}
+	for _, tt := range tests {
+		if got := bidiVisualText(tt.text); got != tt.expected {
+			t.Errorf("bidiVisualText(%q) = %q, want %q", tt.text, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package renderer
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+)
+
+// CornerRadius is the horizontal and vertical radius of a rounded corner
+type CornerRadius struct {
+	X float32 `json:"x"`
+	Y float32 `json:"y"`
+}
+
+// CornerRadii holds the radii of the top-left, top-right, bottom-right and
+// bottom-left corners of a box
+type CornerRadii [4]CornerRadius
+
+// IsZero reports whether every corner is square
+func (radii CornerRadii) IsZero() bool {
+	return radii == CornerRadii{}
+}
+
+// inset returns the radii of a box whose edges are moved inwards by the given
+// widths, as for the padding edge inside a border
+func (radii CornerRadii) inset(top, right, bottom, left float32) CornerRadii {
+	return CornerRadii{
+		{max(radii[0].X-left, 0), max(radii[0].Y-top, 0)},
+		{max(radii[1].X-right, 0), max(radii[1].Y-top, 0)},
+		{max(radii[2].X-right, 0), max(radii[2].Y-bottom, 0)},
+		{max(radii[3].X-left, 0), max(radii[3].Y-bottom, 0)},
+	}
+}
+
+// outset returns the radii of a box grown by d on every side, keeping square
+// corners square, as for shadow spread and outlines
+func (radii CornerRadii) outset(d float32) CornerRadii {
+	for i, r := range radii {
+		if r.X > 0 && r.Y > 0 {
+			radii[i] = CornerRadius{max(r.X+d, 0), max(r.Y+d, 0)}
+		}
+	}
+	return radii
+}
+
+// fit scales the radii down so that adjacent corners do not overlap on a box
+// of the given size
+func (radii CornerRadii) fit(width, height float32) CornerRadii {
+	scale := float32(1)
+	for _, side := range [][3]float32{
+		{width, radii[0].X, radii[1].X},
+		{height, radii[1].Y, radii[2].Y},
+		{width, radii[2].X, radii[3].X},
+		{height, radii[3].Y, radii[0].Y},
+	} {
+		if sum := side[1] + side[2]; sum > side[0] {
+			scale = min(scale, max(side[0], 0)/sum)
+		}
+	}
+	if scale < 1 {
+		for i := range radii {
+			radii[i].X *= scale
+			radii[i].Y *= scale
+		}
+	}
+	return radii
+}
+
+// resolveCornerRadii resolves the border-radius of a style for a border box
+// Percentages refer to the width for horizontal radii and to the height for
+// vertical radii.
+func resolveCornerRadii(style *Style, box Rect, fontSize float32) CornerRadii {
+	var radii CornerRadii
+	for i, value := range []string{style.BorderTopLeftRadius, style.BorderTopRightRadius, style.BorderBottomRightRadius, style.BorderBottomLeftRadius} {
+		parts := strings.Fields(value)
+		if len(parts) == 0 {
+			continue
+		}
+		radii[i].X = resolveRadiusLength(parts[0], box.Width, fontSize)
+		radii[i].Y = radii[i].X
+		if len(parts) > 1 {
+			radii[i].Y = resolveRadiusLength(parts[1], box.Height, fontSize)
+		}
+		if strings.HasSuffix(parts[0], "%") && len(parts) == 1 {
+			radii[i].Y = resolveRadiusLength(parts[0], box.Height, fontSize)
+		}
+		if radii[i].X <= 0 || radii[i].Y <= 0 {
+			radii[i] = CornerRadius{}
+		}
+	}
+	return radii.fit(box.Width, box.Height)
+}
+
+// resolveRadiusLength resolves a radius length or percentage of reference
+func resolveRadiusLength(value string, reference, fontSize float32) float32 {
+	if percent, ok := strings.CutSuffix(value, "%"); ok {
+		return parseLength(percent, fontSize) * reference / 100
+	}
+	return parseLength(value, fontSize)
+}
+
+// insideRoundedRect reports whether a point lies inside a rounded rectangle
+func insideRoundedRect(r Rect, radii CornerRadii, x, y float32) bool {
+	if x < r.X || y < r.Y || x >= r.X+r.Width || y >= r.Y+r.Height {
+		return false
+	}
+	// Corner ellipse centers, in top-left, top-right, bottom-right, bottom-left order
+	corners := [4][2]float32{
+		{r.X + radii[0].X, r.Y + radii[0].Y},
+		{r.X + r.Width - radii[1].X, r.Y + radii[1].Y},
+		{r.X + r.Width - radii[2].X, r.Y + r.Height - radii[2].Y},
+		{r.X + radii[3].X, r.Y + r.Height - radii[3].Y},
+	}
+	for i, c := range corners {
+		radius := radii[i]
+		if radius.X <= 0 || radius.Y <= 0 {
+			continue
+		}
+		inCornerX := (i == 0 || i == 3) && x < c[0] || (i == 1 || i == 2) && x > c[0]
+		inCornerY := (i == 0 || i == 1) && y < c[1] || (i == 2 || i == 3) && y > c[1]
+		if inCornerX && inCornerY {
+			dx, dy := (x-c[0])/radius.X, (y-c[1])/radius.Y
+			return dx*dx+dy*dy <= 1
+		}
+	}
+	return true
+}
+
+// roundedSamples is the number of samples per axis used to antialias rounded edges
+const roundedSamples = 4
+
+// roundedRectCoverage returns the part of pixel (px, py) covered by a rounded rectangle
+func roundedRectCoverage(r Rect, radii CornerRadii, px, py int) float32 {
+	x0, y0 := max(float32(px), r.X), max(float32(py), r.Y)
+	x1, y1 := min(float32(px+1), r.X+r.Width), min(float32(py+1), r.Y+r.Height)
+	if x1 <= x0 || y1 <= y0 {
+		return 0
+	}
+	if !touchesCorner(r, radii, px, py) {
+		return (x1 - x0) * (y1 - y0)
+	}
+
+	var inside int
+	for sy := 0; sy < roundedSamples; sy++ {
+		for sx := 0; sx < roundedSamples; sx++ {
+			x := float32(px) + (float32(sx)+0.5)/roundedSamples
+			y := float32(py) + (float32(sy)+0.5)/roundedSamples
+			if insideRoundedRect(r, radii, x, y) {
+				inside++
+			}
+		}
+	}
+	return float32(inside) / (roundedSamples * roundedSamples)
+}
+
+// touchesCorner reports whether pixel (px, py) overlaps the box of a rounded corner
+func touchesCorner(r Rect, radii CornerRadii, px, py int) bool {
+	x, y := float32(px), float32(py)
+	left := x < r.X+max(radii[0].X, radii[3].X)
+	right := x+1 > r.X+r.Width-max(radii[1].X, radii[2].X)
+	top := y < r.Y+max(radii[0].Y, radii[1].Y)
+	bottom := y+1 > r.Y+r.Height-max(radii[2].Y, radii[3].Y)
+	return (left || right) && (top || bottom)
+}
+
+// fillRoundedRect blends a color over a rounded rectangle of dst
+func fillRoundedRect(dst *image.RGBA, r Rect, radii CornerRadii, fill color.Color) {
+	if radii.IsZero() {
+		fillRect(dst, r, fill)
+		return
+	}
+	if fill == nil {
+		return
+	}
+	bounds := r.outerPixels().Intersect(dst.Bounds())
+	mask := image.NewAlpha(bounds)
+	for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
+		for px := bounds.Min.X; px < bounds.Max.X; px++ {
+			mask.SetAlpha(px, py, color.Alpha{A: uint8(roundedRectCoverage(r, radii, px, py)*255 + 0.5)})
+		}
+	}
+	draw.DrawMask(dst, bounds, image.NewUniform(fill), image.Point{}, mask, bounds.Min, draw.Over)
+}
+
+// paintRoundedBorder paints a border with rounded corners; each pixel of the
+// ring takes the color of the side it is closest to, relative to side widths
+func paintRoundedBorder(dst *image.RGBA, cmd *PaintCommand) {
+	box := cmd.Box
+	inner := Rect{
+		X:      box.X + cmd.BorderLeftWidth,
+		Y:      box.Y + cmd.BorderTopWidth,
+		Width:  box.Width - cmd.BorderLeftWidth - cmd.BorderRightWidth,
+		Height: box.Height - cmd.BorderTopWidth - cmd.BorderBottomWidth,
+	}
+	innerRadii := cmd.Radii.inset(cmd.BorderTopWidth, cmd.BorderRightWidth, cmd.BorderBottomWidth, cmd.BorderLeftWidth)
+
+	widths := cmd.borderWidths()
+	colors := cmd.borderColors()
+	styles := cmd.borderStyles()
+	bounds := box.outerPixels().Intersect(dst.Bounds())
+	for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
+		for px := bounds.Min.X; px < bounds.Max.X; px++ {
+			coverage := roundedRectCoverage(box, cmd.Radii, px, py) - roundedRectCoverage(inner, innerRadii, px, py)
+			if coverage <= 0 {
+				continue
+			}
+			side := borderSideAt(box, widths, float32(px)+0.5, float32(py)+0.5)
+			if side < 0 || !borderSideVisible(widths[side], styles[side]) || colors[side] == nil {
+				continue
+			}
+			blendPixel(dst, px, py, colors[side], coverage)
+		}
+	}
+}
+
+// borderSideAt returns the side of a border, in top, right, bottom, left
+// order, that a point belongs to, or -1 for a border without widths
+func borderSideAt(box Rect, widths [4]float32, x, y float32) int {
+	distances := [4]float32{y - box.Y, box.X + box.Width - x, box.Y + box.Height - y, x - box.X}
+	side := -1
+	best := float32(math.Inf(1))
+	for i, d := range distances {
+		if widths[i] <= 0 {
+			continue
+		}
+		if relative := d / widths[i]; relative < best {
+			side, best = i, relative
+		}
+	}
+	return side
+}
+
+// blendPixel blends a color over one pixel of dst with the given coverage
+func blendPixel(dst *image.RGBA, x, y int, c color.Color, coverage float32) {
+	mask := image.NewUniform(color.Alpha{A: uint8(min(coverage, 1)*255 + 0.5)})
+	r := image.Rect(x, y, x+1, y+1)
+	draw.DrawMask(dst, r, image.NewUniform(c), image.Point{}, mask, image.Point{}, draw.Over)
+}
+
+// outerPixels returns the pixels a rectangle touches
+func (r Rect) outerPixels() image.Rectangle {
+	return image.Rect(
+		int(math.Floor(float64(r.X))),
+		int(math.Floor(float64(r.Y))),
+		int(math.Ceil(float64(r.X+r.Width))),
+		int(math.Ceil(float64(r.Y+r.Height))),
+	)
+}
+
+// outset returns the rectangle grown by d on every side
+func (r Rect) outset(d float32) Rect {
+	return Rect{X: r.X - d, Y: r.Y - d, Width: max(r.Width+2*d, 0), Height: max(r.Height+2*d, 0)}
+}
+
+// boxShadowBounds returns the area a shadow command may paint
+func boxShadowBounds(cmd *PaintCommand) Rect {
+	if cmd.ShadowInset {
+		return cmd.Box
+	}
+	shape := cmd.Box.outset(cmd.ShadowSpread)
+	shape.X += cmd.ShadowOffsetX
+	shape.Y += cmd.ShadowOffsetY
+	return shape.outset(max(cmd.ShadowBlur, 0))
+}
+
+// renderBoxShadow paints a shadow command into a transparent image whose
+// bounds are the pixels it covers, in page coordinates
+// Outer shadows are not painted under the box that casts them, and inset
+// shadows are painted inside the box only. The blur is a Gaussian with a
+// standard deviation of half the blur radius, approximated by three box blurs.
+func renderBoxShadow(cmd *PaintCommand) *image.RGBA {
+	bounds := boxShadowBounds(cmd).outerPixels()
+	if bounds.Empty() || cmd.FillColor == nil {
+		return image.NewRGBA(image.Rectangle{})
+	}
+
+	// The shape whose blurred edge makes the shadow: the spread box for outer
+	// shadows, the hole left inside the box for inset shadows
+	spread := cmd.ShadowSpread
+	if cmd.ShadowInset {
+		spread = -spread
+	}
+	shape := cmd.Box.outset(spread)
+	shape.X += cmd.ShadowOffsetX
+	shape.Y += cmd.ShadowOffsetY
+	shapeRadii := cmd.Radii.outset(spread)
+
+	// Blurred coverage of the shape, over the bounds grown by the blur so
+	// that the blur sees what lies beyond them
+	blur := max(cmd.ShadowBlur, 0)
+	margin := int(math.Ceil(float64(blur)))
+	area := bounds.Inset(-margin)
+	width, height := area.Dx(), area.Dy()
+	coverage := make([]float32, width*height)
+	for py := area.Min.Y; py < area.Max.Y; py++ {
+		for px := area.Min.X; px < area.Max.X; px++ {
+			coverage[(py-area.Min.Y)*width+px-area.Min.X] = roundedRectCoverage(shape, shapeRadii, px, py)
+		}
+	}
+	if blur > 0 {
+		gaussianBlur(coverage, width, height, float64(blur)/2)
+	}
+
+	img := image.NewRGBA(bounds)
+	fill := image.NewUniform(cmd.FillColor)
+	mask := image.NewAlpha(bounds)
+	for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
+		for px := bounds.Min.X; px < bounds.Max.X; px++ {
+			alpha := coverage[(py-area.Min.Y)*width+px-area.Min.X]
+			box := roundedRectCoverage(cmd.Box, cmd.Radii, px, py)
+			if cmd.ShadowInset {
+				alpha = box * (1 - alpha)
+			} else {
+				alpha *= 1 - box
+			}
+			mask.SetAlpha(px, py, color.Alpha{A: uint8(min(max(alpha, 0), 1)*255 + 0.5)})
+		}
+	}
+	draw.DrawMask(img, bounds, fill, image.Point{}, mask, bounds.Min, draw.Src)
+	return img
+}
+
+// paintBoxShadow blends a shadow command over dst
+func paintBoxShadow(dst *image.RGBA, cmd *PaintCommand) {
+	if !boxShadowBounds(cmd).outerPixels().Overlaps(dst.Bounds()) {
+		return
+	}
+	shadow := renderBoxShadow(cmd)
+	draw.Draw(dst, shadow.Bounds(), shadow, shadow.Bounds().Min, draw.Over)
+}
+
+// gaussianBlur blurs a width × height buffer in place with three box blurs
+// approximating a Gaussian of the given standard deviation; values beyond
+// the buffer count as zero
+func gaussianBlur(values []float32, width, height int, sigma float64) {
+	tmp := make([]float32, len(values))
+	for _, size := range gaussianBoxSizes(sigma, 3) {
+		radius := (size - 1) / 2
+		boxBlur(values, tmp, width, height, 1, width, radius)
+		boxBlur(tmp, values, height, width, width, 1, radius)
+	}
+}
+
+// gaussianBoxSizes returns the widths of n box blurs approximating a Gaussian
+func gaussianBoxSizes(sigma float64, n int) []int {
+	ideal := math.Sqrt(12*sigma*sigma/float64(n) + 1)
+	lower := int(math.Floor(ideal))
+	if lower%2 == 0 {
+		lower--
+	}
+	upper := lower + 2
+	m := int(math.Round((12*sigma*sigma - float64(n*lower*lower) - float64(4*n*lower) - float64(3*n)) / float64(-4*lower-4)))
+	sizes := make([]int, n)
+	for i := range sizes {
+		if i < m {
+			sizes[i] = lower
+		} else {
+			sizes[i] = upper
+		}
+	}
+	return sizes
+}
+
+// boxBlur averages each value of src over 2*radius+1 neighbours along one
+// axis into dst; lines are count values apart by lineStep, values within a
+// line step apart by step
+func boxBlur(src, dst []float32, lineLength, count, step, lineStep, radius int) {
+	scale := 1 / float32(2*radius+1)
+	for line := 0; line < count; line++ {
+		base := line * lineStep
+		var sum float32
+		for i := 0; i <= radius && i < lineLength; i++ {
+			sum += src[base+i*step]
+		}
+		for i := 0; i < lineLength; i++ {
+			dst[base+i*step] = sum * scale
+			if next := i + radius + 1; next < lineLength {
+				sum += src[base+next*step]
+			}
+			if prev := i - radius; prev >= 0 {
+				sum -= src[base+prev*step]
+			}
+		}
+	}
+}
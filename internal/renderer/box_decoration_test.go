@@ -0,0 +1,207 @@
+package renderer
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/vyquocvu/goosie/internal/css"
+)
+
+// decoratedNode lays out a page and returns the commands painted for the
+// element with the given class
+func decoratedNode(t *testing.T, htmlContent, class string) []*PaintCommand {
+	t.Helper()
+	r := layoutCompositorPage(t, htmlContent)
+	node := findNodeByClass(r.RenderTree(), class)
+	if node == nil {
+		t.Fatalf("Node with class %q not found", class)
+	}
+	var commands []*PaintCommand
+	for _, cmd := range r.DisplayList().Commands {
+		if cmd.NodeID == node.ID {
+			commands = append(commands, cmd)
+		}
+	}
+	return commands
+}
+
+func TestParseBorderRadius(t *testing.T) {
+	sm := NewStyleManager(nil)
+	node := &RenderNode{Type: NodeTypeElement, ComputedStyle: &Style{}}
+	style := node.ComputedStyle
+	sm.applyDeclaration(node, css.Declaration{Property: "border-radius", Value: "10px 20px / 5px"})
+	if style.BorderTopLeftRadius != "10px 5px" || style.BorderTopRightRadius != "20px 5px" ||
+		style.BorderBottomRightRadius != "10px 5px" || style.BorderBottomLeftRadius != "20px 5px" {
+		t.Errorf("Unexpected radii %q %q %q %q", style.BorderTopLeftRadius, style.BorderTopRightRadius,
+			style.BorderBottomRightRadius, style.BorderBottomLeftRadius)
+	}
+	sm.applyDeclaration(node, css.Declaration{Property: "border-top-left-radius", Value: "50%"})
+	if style.BorderTopLeftRadius != "50%" {
+		t.Errorf("Expected the longhand to override the corner, got %q", style.BorderTopLeftRadius)
+	}
+}
+
+func TestResolveCornerRadii(t *testing.T) {
+	style := &Style{BorderTopLeftRadius: "50%", BorderTopRightRadius: "2em 10px"}
+	radii := resolveCornerRadii(style, Rect{Width: 200, Height: 100}, 10)
+	if radii[0] != (CornerRadius{X: 100, Y: 50}) || radii[1] != (CornerRadius{X: 20, Y: 10}) {
+		t.Errorf("Unexpected resolved radii %v", radii)
+	}
+	// Radii too large for the box are scaled down together
+	big := resolveCornerRadii(&Style{BorderTopLeftRadius: "150px", BorderTopRightRadius: "150px"}, Rect{Width: 200, Height: 200}, 10)
+	if big[0].X+big[1].X > 200.01 || big[0].X != big[1].X {
+		t.Errorf("Expected the radii to fit the box, got %v", big)
+	}
+	if !resolveCornerRadii(&Style{}, Rect{Width: 10, Height: 10}, 10).IsZero() {
+		t.Error("Expected no radii without border-radius")
+	}
+}
+
+func TestParseBoxShadow(t *testing.T) {
+	sm := NewStyleManager(nil)
+	node := &RenderNode{Type: NodeTypeElement, ComputedStyle: &Style{}}
+	style := node.ComputedStyle
+	sm.applyDeclaration(node, css.Declaration{Property: "box-shadow", Value: "2px 4px 6px rgba(0, 0, 0, 0.5), inset 0 0 3px 1px red"})
+	if len(style.BoxShadow) != 2 {
+		t.Fatalf("Expected two shadows, got %+v", style.BoxShadow)
+	}
+	outer, inner := style.BoxShadow[0], style.BoxShadow[1]
+	if outer.OffsetX != "2px" || outer.OffsetY != "4px" || outer.Blur != "6px" || outer.Inset {
+		t.Errorf("Unexpected outer shadow %+v", outer)
+	}
+	if _, _, _, a := outer.Color.RGBA(); a < 0x7f00 || a > 0x8100 {
+		t.Errorf("Expected a half transparent shadow color, got %v", outer.Color)
+	}
+	if !inner.Inset || inner.Spread != "1px" || inner.Color != (color.RGBA{R: 255, A: 255}) {
+		t.Errorf("Unexpected inset shadow %+v", inner)
+	}
+
+	sm.applyDeclaration(node, css.Declaration{Property: "box-shadow", Value: "none"})
+	if len(style.BoxShadow) != 0 {
+		t.Errorf("Expected none to remove the shadows, got %+v", style.BoxShadow)
+	}
+}
+
+func TestParseOutline(t *testing.T) {
+	sm := NewStyleManager(nil)
+	node := &RenderNode{Type: NodeTypeElement, ComputedStyle: &Style{}}
+	style := node.ComputedStyle
+	sm.applyDeclaration(node, css.Declaration{Property: "outline", Value: "dashed 2px blue"})
+	sm.applyDeclaration(node, css.Declaration{Property: "outline-offset", Value: "4px"})
+	if style.OutlineStyle != "dashed" || style.OutlineWidth != "2px" || style.OutlineColor != (color.RGBA{B: 255, A: 255}) || style.OutlineOffset != "4px" {
+		t.Errorf("Unexpected outline %q %q %v %q", style.OutlineStyle, style.OutlineWidth, style.OutlineColor, style.OutlineOffset)
+	}
+}
+
+func TestDisplayListBoxDecorationOrder(t *testing.T) {
+	commands := decoratedNode(t, `<html><head><style>
+.card { background-color: white; border: 2px solid black; border-radius: 8px;
+	box-shadow: inset 0 0 4px gray, 0 2px 4px black, 1px 1px red; outline: 1px solid blue; outline-offset: 2px; }
+</style></head><body><div class="card"><p>Card</p></div></body></html>`, "card")
+
+	var types []PaintCommandType
+	for _, cmd := range commands {
+		types = append(types, cmd.Type)
+	}
+	expected := []PaintCommandType{PaintBoxShadow, PaintBoxShadow, PaintRect, PaintBoxShadow, PaintBorder, PaintBorder}
+	if len(types) != len(expected) {
+		t.Fatalf("Expected commands %v, got %v", expected, types)
+	}
+	for i := range expected {
+		if types[i] != expected[i] {
+			t.Fatalf("Expected commands %v, got %v", expected, types)
+		}
+	}
+
+	// The last outer shadow is painted first, below the others
+	if commands[0].ShadowBlur != 0 || commands[1].ShadowBlur != 4 {
+		t.Errorf("Expected the shadows in reverse order, got blurs %v and %v", commands[0].ShadowBlur, commands[1].ShadowBlur)
+	}
+	background, inset, border, outline := commands[2], commands[3], commands[4], commands[5]
+	if background.Radii[0] != (CornerRadius{X: 8, Y: 8}) || border.Radii != background.Radii {
+		t.Errorf("Expected the background and border rounded, got %v and %v", background.Radii, border.Radii)
+	}
+	if !inset.ShadowInset || inset.Box.X != background.Box.X+2 || inset.Radii[0] != (CornerRadius{X: 6, Y: 6}) {
+		t.Errorf("Expected the inset shadow inside the border, got %+v", inset)
+	}
+	if outline.Box.X != border.Box.X-3 || outline.Box.Width != border.Box.Width+6 || outline.BorderTopWidth != 1 ||
+		outline.Radii[0] != (CornerRadius{X: 11, Y: 11}) {
+		t.Errorf("Expected the outline around the border box, got %+v", outline)
+	}
+}
+
+func TestRasterRendererRoundedRect(t *testing.T) {
+	dl := NewDisplayList()
+	radii := CornerRadii{{X: 10, Y: 10}, {X: 10, Y: 10}, {X: 10, Y: 10}, {X: 10, Y: 10}}
+	dl.AddCommand(&PaintCommand{Type: PaintRect, Box: Rect{X: 10, Y: 10, Width: 40, Height: 30}, FillColor: testRed, Radii: radii})
+	dl.AddCommand(&PaintCommand{
+		Type: PaintBorder, Box: Rect{X: 60, Y: 10, Width: 40, Height: 30}, Radii: radii,
+		BorderTopWidth: 3, BorderRightWidth: 3, BorderBottomWidth: 3, BorderLeftWidth: 3,
+		BorderTopStyle: "solid", BorderRightStyle: "solid", BorderBottomStyle: "solid", BorderLeftStyle: "solid",
+		BorderTopColor: testBlue, BorderRightColor: testBlue, BorderBottomColor: testBlue, BorderLeftColor: testBlue,
+	})
+
+	img := NewRasterRenderer().Render(dl, 110, 50)
+	if !sameColor(img, 10, 10, color.White) || !sameColor(img, 49, 39, color.White) {
+		t.Error("Expected the corners of the rectangle to stay unpainted")
+	}
+	if !sameColor(img, 30, 25, testRed) || !sameColor(img, 30, 10, testRed) || !sameColor(img, 10, 25, testRed) {
+		t.Error("Expected the rectangle filled away from its corners")
+	}
+	if !sameColor(img, 60, 10, color.White) || !sameColor(img, 80, 11, testBlue) || !sameColor(img, 61, 25, testBlue) {
+		t.Error("Expected a rounded border ring")
+	}
+	if !sameColor(img, 80, 25, color.White) {
+		t.Error("Expected the inside of the rounded border unpainted")
+	}
+}
+
+func TestRasterRendererBoxShadows(t *testing.T) {
+	dl := NewDisplayList()
+	dl.AddCommand(&PaintCommand{Type: PaintBoxShadow, Box: Rect{X: 20, Y: 20, Width: 40, Height: 40},
+		FillColor: color.Black, ShadowOffsetX: 5, ShadowOffsetY: 5, ShadowBlur: 4})
+	dl.AddCommand(&PaintCommand{Type: PaintBoxShadow, Box: Rect{X: 80, Y: 20, Width: 40, Height: 40},
+		FillColor: color.Black, ShadowSpread: 5, ShadowInset: true})
+
+	img := NewRasterRenderer().Render(dl, 140, 80)
+	if !sameColor(img, 40, 40, color.White) {
+		t.Error("Expected no outer shadow under the box")
+	}
+	if !sameColor(img, 60, 50, color.Black) {
+		t.Errorf("Expected the offset shadow beside the box, got %v", img.At(60, 50))
+	}
+	inner := img.RGBAAt(63, 50)
+	if inner.R == 0 || inner.R == 255 {
+		t.Errorf("Expected the shadow edge blurred, got %v", inner)
+	}
+	if !sameColor(img, 10, 10, color.White) {
+		t.Error("Expected nothing painted away from the shadow")
+	}
+
+	if !sameColor(img, 82, 40, color.Black) || !sameColor(img, 100, 40, color.White) || !sameColor(img, 78, 40, color.White) {
+		t.Error("Expected the inset shadow along the inside of the box only")
+	}
+}
+
+func TestRasterRendererOutline(t *testing.T) {
+	img, _ := rasterizeStyledHTML(t, `<html><head><style>
+body { margin: 20px; }
+.box { height: 20px; outline: 2px solid red; outline-offset: 3px; }
+</style></head><body><div class="box"></div></body></html>`)
+	// The box starts at (20, 20), so the outline is 3 to 5 pixels outside it
+	if !sameColor(img, 15, 30, testRed) || !sameColor(img, 16, 30, testRed) {
+		t.Errorf("Expected the outline outside the box, got %v", img.At(15, 30))
+	}
+	if !sameColor(img, 18, 30, color.White) || !sameColor(img, 14, 30, color.White) {
+		t.Error("Expected the outline offset from the box")
+	}
+}
+
+// rasterizeStyledHTML lays out a page with its style sheets and paints it
+func rasterizeStyledHTML(t *testing.T, htmlContent string) (*image.RGBA, *DisplayList) {
+	t.Helper()
+	r := layoutCompositorPage(t, htmlContent)
+	dl := r.DisplayList()
+	return NewRasterRenderer().Render(dl, 800, 600), dl
+}
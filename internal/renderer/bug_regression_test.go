@@ -49,9 +49,9 @@ func TestBugFixDuplicateRendering(t *testing.T) {
 		t.Fatalf("Expected canvasObject to be *fyne.Container, got %T", canvasObject)
 	}
 	
-	// Expected: 3 objects (h1, p, link)
+	// Expected: 4 objects (body background, h1, p, link)
 	// Before fix: 19 objects (each word rendered separately, causing duplication)
-	expectedCount := 3
+	expectedCount := 4
 	actualCount := len(vbox.Objects)
 	
 	if actualCount != expectedCount {
@@ -64,16 +64,16 @@ func TestBugFixDuplicateRendering(t *testing.T) {
 	}
 	
 	// Verify the content is correct
-	if actualCount >= 3 {
+	if actualCount >= 4 {
 		// Check h1
-		if label, ok := vbox.Objects[0].(*widget.Label); ok {
+		if label, ok := vbox.Objects[1].(*widget.Label); ok {
 			if label.Text != "Example Domain" {
 				t.Errorf("Expected h1 text 'Example Domain', got '%s'", label.Text)
 			}
 		}
 		
 		// Check paragraph
-		if label, ok := vbox.Objects[1].(*widget.Label); ok {
+		if label, ok := vbox.Objects[2].(*widget.Label); ok {
 			expectedText := "This domain is for use in documentation examples without needing permission. Avoid use in operations."
 			if label.Text != expectedText {
 				t.Errorf("Expected paragraph text, got '%s'", label.Text)
@@ -81,7 +81,7 @@ func TestBugFixDuplicateRendering(t *testing.T) {
 		}
 		
 		// Check link
-		if label, ok := vbox.Objects[2].(*widget.Label); ok {
+		if label, ok := vbox.Objects[3].(*widget.Label); ok {
 			if label.Text != "Learn more" {
 				t.Errorf("Expected link text 'Learn more', got '%s'", label.Text)
 			}
@@ -1,13 +1,17 @@
 package renderer
 
 import (
+	"image"
 	"image/color"
 	"net/url"
+	"slices"
+	"sort"
 	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/widget"
 
 	imageloader "github.com/vyquocvu/goosie/internal/image"
@@ -44,6 +48,27 @@ type CanvasRenderer struct {
 
 	// OnRefresh is a test hook to signal when a refresh is triggered.
 	OnRefresh func()
+
+	// Layout engine owning scroll offsets of overflow scroll containers
+	layoutEngine *LayoutEngine
+
+	// Clip regions of the last render, keyed by node ID of the clipping box
+	clipRegions map[int64]*clipRegion
+
+	// Web fonts declared by @font-face rules of the current document
+	fontFaces *FontFaceSet
+
+	// Rasterizer for layers composited as a group, created on first use
+	raster *RasterRenderer
+
+	// Canvas objects created for the commands of the last painted display
+	// list; the next list reuses them for commands that paint the same
+	paintedList    *DisplayList
+	paintedObjects map[*PaintCommand][]fyne.CanvasObject
+
+	// Dirty nodes since the last paint, used to limit the comparison of
+	// rebuilt display lists
+	invalidation *InvalidationTracker
 }
 
 // NewCanvasRenderer creates a new canvas renderer
@@ -83,6 +108,49 @@ func (cr *CanvasRenderer) onImageLoaded(source string) {
 	})
 }
 
+// SetLayoutEngine sets the layout engine used to scroll overflow containers
+func (cr *CanvasRenderer) SetLayoutEngine(le *LayoutEngine) {
+	cr.layoutEngine = le
+}
+
+// SetFontFaces sets the web fonts used to paint text of the current document
+func (cr *CanvasRenderer) SetFontFaces(fonts *FontFaceSet) {
+	cr.fontFaces = fonts
+	cr.cachedDisplayList = nil
+	cr.paintedList = nil
+	cr.paintedObjects = nil
+}
+
+// SetInvalidationTracker sets the tracker of nodes changed since the last
+// paint. Commands of clean nodes keep their canvas objects unless they moved.
+// The renderer clears the tracker once it has patched the canvas objects.
+func (cr *CanvasRenderer) SetInvalidationTracker(it *InvalidationTracker) {
+	cr.invalidation = it
+}
+
+// ScrollAt scrolls the innermost scroll container under (x, y) that can consume
+// the delta, chaining to ancestors at their scroll limits. Returns true if a
+// container scrolled.
+func (cr *CanvasRenderer) ScrollAt(x, y, dx, dy float32) bool {
+	if cr.layoutEngine == nil || cr.cachedLayoutRoot == nil {
+		return false
+	}
+
+	target := cr.layoutEngine.FindScrollTarget(cr.cachedLayoutRoot, x, y, dx, dy)
+	if target == nil || !cr.layoutEngine.ScrollBy(target, dx, dy) {
+		return false
+	}
+
+	// Descendant boxes are translated by the new offset on the next build
+	cr.cachedDisplayList = nil
+
+	if region, ok := cr.clipRegions[target.NodeID]; ok {
+		region.SetOffset(target.ScrollX, target.ScrollY)
+	}
+
+	return true
+}
+
 // SetViewport sets the current viewport for optimized rendering
 func (cr *CanvasRenderer) SetViewport(y, height float32) {
 	cr.viewportY = y
@@ -353,6 +421,37 @@ func (t *TappableHyperlink) Tapped(_ *fyne.PointEvent) {
 	}
 }
 
+// linkArea is an invisible tap target over a link painted into an image
+type linkArea struct {
+	widget.BaseWidget
+	url        string
+	onNavigate ui.NavigationCallback
+}
+
+// newLinkArea creates a tap target navigating to a URL
+func newLinkArea(urlStr string, onNavigate ui.NavigationCallback) *linkArea {
+	area := &linkArea{url: urlStr, onNavigate: onNavigate}
+	area.ExtendBaseWidget(area)
+	return area
+}
+
+// CreateRenderer draws nothing; the link is part of the image under the area
+func (a *linkArea) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(canvas.NewRectangle(color.Transparent))
+}
+
+// Tapped navigates to the link's URL
+func (a *linkArea) Tapped(_ *fyne.PointEvent) {
+	if a.onNavigate != nil {
+		a.onNavigate(a.url)
+	}
+}
+
+// Cursor shows the pointer cursor over the link
+func (a *linkArea) Cursor() desktop.Cursor {
+	return desktop.PointerCursor
+}
+
 // urlParse is a helper that returns nil on parse error
 func urlParse(urlStr string) *url.URL {
 	parsed, err := url.Parse(urlStr)
@@ -604,12 +703,47 @@ func (cr *CanvasRenderer) RenderWithViewport(root *RenderNode, layoutRoot *Layou
 		cr.cachedRenderRoot = root
 		cr.cachedLayoutRoot = layoutRoot
 	}
+	cr.patchObjects(displayList)
 
-	// Filter commands based on viewport
+	// Filter commands based on viewport. Clip commands are always processed so
+	// that content of clipping boxes is grouped into a clip region.
 	objects := make([]fyne.CanvasObject, 0)
-	for _, cmd := range displayList.Commands {
-		if cr.isInViewport(cmd.Box) {
-			cr.renderCommand(cmd, &objects)
+	var clipStack []clipGroup
+	cr.clipRegions = make(map[int64]*clipRegion)
+	commands := displayList.Commands
+	for i := 0; i < len(commands); i++ {
+		cmd := commands[i]
+		switch cmd.Type {
+		case PaintPushLayer:
+			// Transformed layers are rasterized as a group, so the transform and
+			// opacity apply to the subtree as a whole. Other layers keep their
+			// widgets, which stay selectable and tappable.
+			if cmd.Transform == nil {
+				continue
+			}
+			end := matchingPopLayer(commands, i)
+			if cr.isInViewport(cmd.Box) {
+				cr.addRasterImage(cr.renderLayer(commands[i:end+1]), &objects)
+			}
+			i = end
+		case PaintPushClip:
+			clipStack = append(clipStack, clipGroup{cmd: cmd, parent: objects})
+			objects = make([]fyne.CanvasObject, 0)
+		case PaintPopClip:
+			if len(clipStack) == 0 {
+				continue
+			}
+			group := clipStack[len(clipStack)-1]
+			clipStack = clipStack[:len(clipStack)-1]
+			region := cr.newClipRegion(group.cmd, objects)
+			objects = group.parent
+			if cr.isInViewport(group.cmd.Box) {
+				objects = append(objects, region)
+			}
+		default:
+			if cr.isInViewport(cmd.Box) {
+				objects = append(objects, cr.commandObjects(cmd)...)
+			}
 		}
 	}
 
@@ -620,6 +754,83 @@ func (cr *CanvasRenderer) RenderWithViewport(root *RenderNode, layoutRoot *Layou
 	return container.NewVBox(objects...)
 }
 
+// patchObjects keeps the canvas objects of the commands a new display list
+// paints the same, dropping those of changed and removed commands
+func (cr *CanvasRenderer) patchObjects(displayList *DisplayList) {
+	if displayList == cr.paintedList {
+		return
+	}
+
+	objects := make(map[*PaintCommand][]fyne.CanvasObject)
+	if cr.paintedList != nil {
+		diff := DiffDisplayLists(cr.paintedList, displayList, cr.invalidation)
+		for _, pair := range diff.Unchanged {
+			// Objects also depend on the computed style of the node
+			if pair.Old.Node != pair.New.Node {
+				continue
+			}
+			if painted, ok := cr.paintedObjects[pair.Old]; ok {
+				objects[pair.New] = painted
+			}
+		}
+	}
+
+	cr.paintedList = displayList
+	cr.paintedObjects = objects
+	if cr.invalidation != nil {
+		cr.invalidation.ClearAll()
+	}
+}
+
+// commandObjects returns the canvas objects of a command, creating them on
+// first use
+func (cr *CanvasRenderer) commandObjects(cmd *PaintCommand) []fyne.CanvasObject {
+	if objects, ok := cr.paintedObjects[cmd]; ok {
+		return objects
+	}
+	objects := make([]fyne.CanvasObject, 0, 1)
+	cr.renderCommand(cmd, &objects)
+	if cr.paintedObjects != nil {
+		cr.paintedObjects[cmd] = objects
+	}
+	return objects
+}
+
+// visualText returns the text of a text command in display order: when bidi
+// layout placed right-to-left fragments, the fragments are read line by line
+// in their visual order, right-to-left ones reversed
+func visualText(cmd *PaintCommand) string {
+	if !slices.ContainsFunc(cmd.Fragments, func(f TextFragment) bool { return f.BidiLevel%2 == 1 }) {
+		return cmd.Text
+	}
+
+	fragments := slices.Clone(cmd.Fragments)
+	sort.SliceStable(fragments, func(i, j int) bool {
+		if fragments[i].Box.Y != fragments[j].Box.Y {
+			return fragments[i].Box.Y < fragments[j].Box.Y
+		}
+		return fragments[i].Box.X < fragments[j].Box.X
+	})
+
+	var text strings.Builder
+	for i, fragment := range fragments {
+		if i > 0 {
+			prev := fragments[i-1]
+			if fragment.Box.Y != prev.Box.Y {
+				text.WriteByte('\n')
+			} else if fragment.Box.X > prev.Box.X+prev.Box.Width+0.01 {
+				text.WriteByte(' ')
+			}
+		}
+		if fragment.BidiLevel%2 == 1 {
+			text.WriteString(bidiVisualText(fragment.Text))
+		} else {
+			text.WriteString(fragment.Text)
+		}
+	}
+	return text.String()
+}
+
 // renderCommand renders a single paint command to canvas objects
 func (cr *CanvasRenderer) renderCommand(cmd *PaintCommand, objects *[]fyne.CanvasObject) {
 	switch cmd.Type {
@@ -628,36 +839,37 @@ func (cr *CanvasRenderer) renderCommand(cmd *PaintCommand, objects *[]fyne.Canva
 			return
 		}
 
-		// Check if the node has CSS styles that require custom rendering
-		if cr.hasCustomStyles(cmd.Node) {
+		// Web fonts and CSS styles require custom rendering
+		fontSource, hidden := cr.fontSource(cmd)
+		if fontSource != nil || hidden || cr.hasCustomStyles(cmd.Node) {
 			// Create a canvas.Text object with CSS styles
-			textObj := canvas.NewText(cmd.Text, color.Black)
+			textObj := canvas.NewText(visualText(cmd), color.Black)
 			textObj.TextSize = cr.defaultSize
 
-			style := cmd.Node.ComputedStyle
-
-			if style.Color != nil {
-				textObj.Color = style.Color
+			textStyle := fyne.TextStyle{Bold: cmd.Bold, Italic: cmd.Italic}
+			if style := cmd.Node.ComputedStyle; style != nil {
+				if style.Color != nil {
+					textObj.Color = style.Color
+				}
+				if style.FontSize > 0 {
+					textObj.TextSize = style.FontSize
+				}
+				if style.FontWeight == "bold" {
+					textStyle.Bold = true
+				}
 			}
+			textObj.TextStyle = textStyle
+			textObj.FontSource = fontSource
 
-			if style.FontSize > 0 {
-				textObj.TextSize = style.FontSize
+			// Text waiting for a web font in its block period is invisible
+			if hidden {
+				textObj.Color = color.Transparent
 			}
 
-			// Apply text style
-			textStyle := fyne.TextStyle{}
-			if style.FontWeight == "bold" || cmd.Bold {
-				textStyle.Bold = true
-			}
-			if cmd.Italic {
-				textStyle.Italic = true
-			}
-			textObj.TextStyle = textStyle
-
 			*objects = append(*objects, textObj)
 		} else {
 			// Use standard label widget
-			selectableText := ui.NewSelectableText(cmd.Text)
+			selectableText := ui.NewSelectableText(visualText(cmd))
 			selectableText.SetWrapping(fyne.TextWrapWord)
 
 			if cmd.Bold && cmd.Italic {
@@ -674,7 +886,16 @@ func (cr *CanvasRenderer) renderCommand(cmd *PaintCommand, objects *[]fyne.Canva
 	case PaintRect:
 		rect := canvas.NewRectangle(cmd.FillColor)
 		rect.SetMinSize(fyne.NewSize(cmd.Box.Width, cmd.Box.Height))
+		setCornerRadii(rect, cmd.Radii)
 		*objects = append(*objects, rect)
+	
+	case PaintBoxShadow:
+		// Shadows are blurred by the rasterizer and shown as an image
+		cr.addRasterImage(renderBoxShadow(cmd), objects)
+	
+	case PaintBackgroundImage, PaintGradient:
+		// Background layers are tiled by the rasterizer and shown as an image
+		cr.addRasterImage(renderBackground(cmd), objects)
 
 	case PaintImage:
 		// Try to load and render the actual image if loader is available
@@ -778,6 +999,17 @@ func (cr *CanvasRenderer) renderCommand(cmd *PaintCommand, objects *[]fyne.Canva
 		}
 	
 	case PaintBorder:
+		// Rounded borders with the same sides are a stroked rounded rectangle
+		if !cmd.Radii.IsZero() && uniformBorder(cmd) {
+			rect := canvas.NewRectangle(color.Transparent)
+			rect.StrokeColor = cmd.BorderTopColor
+			rect.StrokeWidth = cmd.BorderTopWidth
+			rect.SetMinSize(fyne.NewSize(cmd.Box.Width, cmd.Box.Height))
+			setCornerRadii(rect, cmd.Radii)
+			*objects = append(*objects, rect)
+			return
+		}
+		
 		// Render borders as lines or rectangles
 		// Borders meet at corners without overlapping
 		borderContainer := container.NewWithoutLayout()
@@ -823,11 +1055,117 @@ func (cr *CanvasRenderer) renderCommand(cmd *PaintCommand, objects *[]fyne.Canva
 	}
 }
 
+// matchingPopLayer returns the index of the command ending the layer started
+// at start, or the last index if the layer is not ended
+func matchingPopLayer(commands []*PaintCommand, start int) int {
+	depth := 0
+	for i := start; i < len(commands); i++ {
+		switch commands[i].Type {
+		case PaintPushLayer:
+			depth++
+		case PaintPopLayer:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(commands) - 1
+}
+
+// renderLayer paints the commands of a layer, including its push and pop
+// commands, into an image of the pixels they reach
+func (cr *CanvasRenderer) renderLayer(commands []*PaintCommand) *image.RGBA {
+	if cr.raster == nil {
+		cr.raster = NewRasterRenderer()
+	}
+	cr.raster.SetFontFaces(cr.fontFaces)
+
+	displayList := &DisplayList{Commands: commands}
+	root := BuildLayers(displayList)
+	if len(root.Children) == 0 {
+		return nil
+	}
+	layer := root.Children[0]
+	extent := layer.extent()
+	if layer.Transform != identityTransform {
+		extent = transformBounds(layer.Transform, extent)
+	}
+	if extent.Empty() {
+		return nil
+	}
+	dst := image.NewRGBA(extent)
+	cr.raster.Paint(dst, displayList)
+	return dst
+}
+
+// addRasterImage adds an image painted by the rasterizer at its natural size
+func (cr *CanvasRenderer) addRasterImage(src *image.RGBA, objects *[]fyne.CanvasObject) {
+	if src == nil {
+		return
+	}
+	img := canvas.NewImageFromImage(src)
+	img.FillMode = canvas.ImageFillOriginal
+	img.SetMinSize(fyne.NewSize(float32(src.Bounds().Dx()), float32(src.Bounds().Dy())))
+	*objects = append(*objects, img)
+}
+
+// viewportObject places an image of the viewport at the viewport's position
+// in a container as tall as the page, with tap targets over the links the
+// image shows
+func (cr *CanvasRenderer) viewportObject(pixels *image.RGBA, displayList *DisplayList, contentHeight float32) fyne.CanvasObject {
+	// The page's height keeps the container scrollable past the viewport
+	page := canvas.NewRectangle(color.Transparent)
+	page.SetMinSize(fyne.NewSize(cr.canvasWidth, contentHeight))
+	page.Resize(page.MinSize())
+
+	img := canvas.NewImageFromImage(pixels)
+	img.FillMode = canvas.ImageFillOriginal
+	img.Resize(fyne.NewSize(float32(pixels.Bounds().Dx()), float32(pixels.Bounds().Dy())))
+	img.Move(fyne.NewPos(0, cr.viewportY))
+
+	objects := []fyne.CanvasObject{page, img}
+	if cr.onNavigate != nil && displayList != nil {
+		for _, cmd := range displayList.Commands {
+			if cmd.Type != PaintLink || cmd.LinkText == "" || !cr.isInViewport(cmd.Box) {
+				continue
+			}
+			area := newLinkArea(cr.resolveURL(cmd.LinkURL), cr.onNavigate)
+			area.Resize(fyne.NewSize(cmd.Box.Width, cmd.Box.Height))
+			area.Move(fyne.NewPos(cmd.Box.X, cmd.Box.Y))
+			objects = append(objects, area)
+		}
+	}
+	return container.NewWithoutLayout(objects...)
+}
+
+// setCornerRadii rounds the corners of a rectangle; Fyne corners are circular,
+// so elliptical radii use their smaller axis
+func setCornerRadii(rect *canvas.Rectangle, radii CornerRadii) {
+	rect.TopLeftCornerRadius = min(radii[0].X, radii[0].Y)
+	rect.TopRightCornerRadius = min(radii[1].X, radii[1].Y)
+	rect.BottomRightCornerRadius = min(radii[2].X, radii[2].Y)
+	rect.BottomLeftCornerRadius = min(radii[3].X, radii[3].Y)
+}
+
+// uniformBorder reports whether all four sides of a border are painted alike
+func uniformBorder(cmd *PaintCommand) bool {
+	widths, colors, styles := cmd.borderWidths(), cmd.borderColors(), cmd.borderStyles()
+	for i := 1; i < 4; i++ {
+		if widths[i] != widths[0] || styles[i] != styles[0] || !colorsEqual(colors[i], colors[0]) {
+			return false
+		}
+	}
+	return borderSideVisible(widths[0], styles[0]) && colors[0] != nil
+}
+
 // ClearCache clears the cached display list to force re-rendering
 func (cr *CanvasRenderer) ClearCache() {
 	cr.cachedDisplayList = nil
 	cr.cachedLayoutRoot = nil
 	cr.cachedRenderRoot = nil
+	cr.paintedList = nil
+	cr.paintedObjects = nil
 }
 
 func (cr *CanvasRenderer) renderInput(node *RenderNode, objects *[]fyne.CanvasObject) {
@@ -905,6 +1243,38 @@ func (cr *CanvasRenderer) renderTextarea(node *RenderNode, objects *[]fyne.Canva
 	*objects = append(*objects, entry)
 }
 
+// fontSource returns the web font used to paint a text command, and whether
+// the text is hidden while the font loads
+func (cr *CanvasRenderer) fontSource(cmd *PaintCommand) (fyne.Resource, bool) {
+	return paintFontSource(cr.fontFaces, cmd)
+}
+
+// paintFontSource returns the web font used to paint a text command, and
+// whether the text is hidden while the font loads. The first family of the
+// command's font-family list that is a web font, an installed font or a
+// generic family decides; web fonts that failed or missed their swap period
+// fall through to the next family.
+func paintFontSource(fonts *FontFaceSet, cmd *PaintCommand) (fyne.Resource, bool) {
+	if fonts == nil || cmd.FontFamily == "" {
+		return nil, false
+	}
+
+	style := fyne.TextStyle{Bold: cmd.Bold, Italic: cmd.Italic}
+	for _, family := range ParseFontFamilyList(cmd.FontFamily) {
+		if fonts.HasFamily(family) {
+			source, hidden := fonts.PaintSource(family, style)
+			if source != nil || hidden {
+				return source, hidden
+			}
+			continue
+		}
+		if DefaultTextShaper().HasFamily(family, style) {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
 // hasCustomStyles checks if a node has CSS styles that require custom rendering
 func (cr *CanvasRenderer) hasCustomStyles(node *RenderNode) bool {
 	return node != nil && node.ComputedStyle != nil && (
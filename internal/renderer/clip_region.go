@@ -0,0 +1,130 @@
+package renderer
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// clipGroup collects the objects painted between a PaintPushClip and its PaintPopClip
+type clipGroup struct {
+	cmd    *PaintCommand
+	parent []fyne.CanvasObject
+}
+
+// clipRegion is a widget that clips its content to the clip box of an
+// overflow container
+type clipRegion struct {
+	widget.BaseWidget
+
+	content fyne.CanvasObject
+	size    fyne.Size
+	offsetX float32
+	offsetY float32
+}
+
+// scrollRegion is a clipRegion of a user-scrollable container. It routes wheel
+// and drag input back to the canvas renderer so nested containers scroll
+// independently. Only scroll containers accept scroll input, so wheel events
+// over overflow: hidden boxes still reach the enclosing scroller.
+type scrollRegion struct {
+	clipRegion
+
+	origin   fyne.Position
+	renderer *CanvasRenderer
+}
+
+// Declare conformity with the interfaces used for input routing
+var (
+	_ fyne.Widget     = (*clipRegion)(nil)
+	_ fyne.Scrollable = (*scrollRegion)(nil)
+	_ fyne.Draggable  = (*scrollRegion)(nil)
+)
+
+// newClipRegion creates a clip region for a PaintPushClip command
+func (cr *CanvasRenderer) newClipRegion(cmd *PaintCommand, objects []fyne.CanvasObject) fyne.CanvasObject {
+	var obj fyne.CanvasObject
+	var clip *clipRegion
+	if cmd.UserScrollable {
+		scroll := &scrollRegion{
+			origin:   fyne.NewPos(cmd.Box.X, cmd.Box.Y),
+			renderer: cr,
+		}
+		scroll.ExtendBaseWidget(scroll)
+		obj, clip = scroll, &scroll.clipRegion
+	} else {
+		plain := &clipRegion{}
+		plain.ExtendBaseWidget(plain)
+		obj, clip = plain, plain
+	}
+
+	clip.content = container.NewVBox(objects...)
+	clip.size = fyne.NewSize(cmd.Box.Width, cmd.Box.Height)
+	clip.offsetX = cmd.ScrollX
+	clip.offsetY = cmd.ScrollY
+
+	if cr.clipRegions != nil {
+		cr.clipRegions[cmd.NodeID] = clip
+	}
+
+	return obj
+}
+
+// SetOffset moves the content to show the given scroll offset
+func (c *clipRegion) SetOffset(x, y float32) {
+	c.offsetX = x
+	c.offsetY = y
+	c.Refresh()
+}
+
+// MinSize returns the size of the clip box
+func (c *clipRegion) MinSize() fyne.Size {
+	return c.size
+}
+
+// CreateRenderer implements fyne.Widget
+func (c *clipRegion) CreateRenderer() fyne.WidgetRenderer {
+	return &clipRegionRenderer{region: c}
+}
+
+// Scrolled routes wheel input to the innermost scroll container under the pointer
+func (s *scrollRegion) Scrolled(ev *fyne.ScrollEvent) {
+	s.renderer.ScrollAt(s.origin.X+ev.Position.X, s.origin.Y+ev.Position.Y, -ev.Scrolled.DX, -ev.Scrolled.DY)
+}
+
+// Dragged scrolls the container with touch or mouse drags
+func (s *scrollRegion) Dragged(ev *fyne.DragEvent) {
+	s.renderer.ScrollAt(s.origin.X+ev.Position.X, s.origin.Y+ev.Position.Y, -ev.Dragged.DX, -ev.Dragged.DY)
+}
+
+// DragEnd is required by fyne.Draggable
+func (s *scrollRegion) DragEnd() {}
+
+// clipRegionRenderer lays out the scrolled content of a clipRegion
+type clipRegionRenderer struct {
+	region *clipRegion
+}
+
+func (r *clipRegionRenderer) Layout(size fyne.Size) {
+	content := r.region.content
+	content.Resize(content.MinSize().Max(size))
+	content.Move(fyne.NewPos(-r.region.offsetX, -r.region.offsetY))
+}
+
+func (r *clipRegionRenderer) MinSize() fyne.Size {
+	return r.region.size
+}
+
+func (r *clipRegionRenderer) Refresh() {
+	r.Layout(r.region.Size())
+	r.region.content.Refresh()
+}
+
+func (r *clipRegionRenderer) Objects() []fyne.CanvasObject {
+	return []fyne.CanvasObject{r.region.content}
+}
+
+func (r *clipRegionRenderer) Destroy() {}
+
+// IsClip marks the region as clipping its content
+func (r *clipRegionRenderer) IsClip() {}
@@ -0,0 +1,589 @@
+package renderer
+
+import (
+	"image"
+	"image/draw"
+	"math"
+	"sort"
+
+	"golang.org/x/image/math/f64"
+)
+
+const (
+	// defaultTileSize is the width and height of a tile in pixels
+	defaultTileSize = 256
+	// defaultMaxTiles is the number of tiles kept before the least recently
+	// composited ones are dropped
+	defaultMaxTiles = 128
+	// paintOverflow is how far the pixels of a command may reach outside its
+	// boxes, for glyphs and wrapped text that overflow their block
+	paintOverflow = 64
+)
+
+// identityTransform is the transform of layers that are not transformed
+var identityTransform = f64.Aff3{1, 0, 0, 0, 1, 0}
+
+// Layer is a group of paint commands composited as one image
+// Commands are in the layer's content coordinates: display list coordinates
+// with the scroll offsets of the layer and its scroll layer ancestors undone,
+// so scrolling moves the layer without changing its commands.
+type Layer struct {
+	Kind     LayerKind
+	NodeID   int64           // Node whose box created the layer, 0 for the root
+	Commands []*PaintCommand // Commands painted in the layer's own tiles
+	Children []*Layer        // Layers composited over the layer's own commands, in paint order
+
+	Clip      *Rect   // Clip in the parent's content coordinates, nil for none
+	ScrollX   float32 // Scroll offset of LayerScroll layers
+	ScrollY   float32
+	Opacity   float32  // Opacity the layer is composited with
+	Transform f64.Aff3 // Maps content coordinates to the parent's, identity if untransformed
+
+	bounds image.Rectangle // Pixels reached by the commands
+	tiles  map[image.Point]*tile
+
+	// Image commands and whether their image was loaded when last checked
+	images       []*PaintCommand
+	imagesLoaded []bool
+}
+
+// tile is a cached raster of part of a layer
+type tile struct {
+	img      *image.RGBA // Nil for tiles without content
+	lastUsed int         // Frame the tile was last composited in
+}
+
+// layerKey identifies a layer across updates
+type layerKey struct {
+	kind   LayerKind
+	nodeID int64
+}
+
+// Compositor splits display lists into layers and rasterizes each layer into
+// cached tiles with a RasterRenderer. Scrolling the page or a scroll layer
+// only re-composites tiles; tiles are repainted when Update finds commands
+// that changed over them, when an image under them loads, or when they are
+// invalidated. A Compositor is not safe for concurrent use.
+type Compositor struct {
+	raster   *RasterRenderer
+	tileSize int
+	maxTiles int
+
+	root   *Layer
+	layers map[layerKey]*Layer
+
+	frame        int // Number of composed frames
+	tilesPainted int // Number of tiles rasterized so far
+}
+
+// NewCompositor creates a compositor that paints tiles with the given renderer
+func NewCompositor(raster *RasterRenderer) *Compositor {
+	return &Compositor{
+		raster:   raster,
+		tileSize: defaultTileSize,
+		maxTiles: defaultMaxTiles,
+		root:     newLayer(LayerRoot, 0),
+		layers:   make(map[layerKey]*Layer),
+	}
+}
+
+// Root returns the root layer of the last display list passed to Update
+func (c *Compositor) Root() *Layer {
+	return c.root
+}
+
+// TilesPainted returns the number of tiles rasterized since the compositor was created
+func (c *Compositor) TilesPainted() int {
+	return c.tilesPainted
+}
+
+// Update replaces the composited display list, keeping the tiles of each
+// layer that no changed command covers
+func (c *Compositor) Update(displayList *DisplayList) {
+	root := BuildLayers(displayList)
+	layers := make(map[layerKey]*Layer)
+
+	var walk func(layer *Layer)
+	walk = func(layer *Layer) {
+		key := layerKey{layer.Kind, layer.NodeID}
+		layers[key] = layer
+		if old := c.layers[key]; old != nil {
+			c.reuseTiles(old, layer)
+		}
+		for _, child := range layer.Children {
+			walk(child)
+		}
+	}
+	walk(root)
+
+	c.root = root
+	c.layers = layers
+}
+
+// reuseTiles moves the tiles of a layer to its new build, dropping the tiles
+// under commands that changed
+func (c *Compositor) reuseTiles(old, layer *Layer) {
+	layer.tiles = old.tiles
+
+	diff := DiffDisplayLists(&DisplayList{Commands: old.Commands}, &DisplayList{Commands: layer.Commands}, nil)
+	for _, cmd := range diff.Added {
+		c.invalidate(layer, commandExtent(cmd))
+	}
+	for _, cmd := range diff.Removed {
+		c.invalidate(layer, commandExtent(cmd))
+	}
+	for _, change := range diff.Changed {
+		c.invalidate(layer, commandExtent(change.Old))
+		c.invalidate(layer, commandExtent(change.New))
+	}
+
+	// Tiles show images in the state they had when last checked
+	loaded := make(map[imageKey]bool)
+	for i, cmd := range old.images {
+		loaded[newImageKey(cmd)] = old.imagesLoaded[i]
+	}
+	for i, cmd := range layer.images {
+		if state, ok := loaded[newImageKey(cmd)]; ok {
+			layer.imagesLoaded[i] = state
+		}
+	}
+}
+
+// InvalidateAll drops every tile, for example once a web font swaps in
+func (c *Compositor) InvalidateAll() {
+	for _, layer := range c.layers {
+		layer.tiles = make(map[image.Point]*tile)
+	}
+}
+
+// InvalidateNode drops the tiles under the commands of a node
+func (c *Compositor) InvalidateNode(nodeID int64) {
+	for _, layer := range c.layers {
+		for _, cmd := range layer.Commands {
+			if cmd.NodeID == nodeID {
+				c.invalidate(layer, commandExtent(cmd))
+			}
+		}
+	}
+}
+
+// SetLayerScroll sets the scroll offset of the scroll layer of a node, and
+// returns false if there is none. No tile is repainted.
+func (c *Compositor) SetLayerScroll(nodeID int64, x, y float32) bool {
+	layer := c.layers[layerKey{LayerScroll, nodeID}]
+	if layer == nil {
+		return false
+	}
+	layer.ScrollX, layer.ScrollY = x, y
+	return true
+}
+
+// Compose composites the layers into dst, with the page scrolled so that
+// its point (scrollX, scrollY) is at the origin of dst
+func (c *Compositor) Compose(dst *image.RGBA, scrollX, scrollY float32) {
+	c.frame++
+	c.checkImages(c.root)
+
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(c.raster.background), image.Point{}, draw.Src)
+	offset := image.Pt(roundPixel(scrollX), roundPixel(scrollY))
+	c.composeLayer(dst, c.root, offset, dst.Bounds())
+
+	c.evictTiles()
+}
+
+// composeLayer draws a layer and its children into dst; the layer's content
+// point p is drawn at p - offset, clipped to clip
+func (c *Compositor) composeLayer(dst *image.RGBA, layer *Layer, offset image.Point, clip image.Rectangle) {
+	clip = clip.Intersect(dst.Bounds())
+	if clip.Empty() {
+		return
+	}
+	c.drawTiles(dst, layer, offset, clip)
+
+	for _, child := range layer.Children {
+		childOffset, childClip := offset, clip
+		if child.Clip != nil {
+			childClip = childClip.Intersect(pixelRect(*child.Clip).Sub(offset))
+		}
+		switch child.Kind {
+		case LayerScroll:
+			childOffset = childOffset.Add(image.Pt(roundPixel(child.ScrollX), roundPixel(child.ScrollY)))
+		case LayerFixed:
+			// Fixed layers hang off the root and do not scroll with the page
+			childOffset = image.Point{}
+		}
+		if childClip.Empty() {
+			continue
+		}
+
+		switch {
+		case child.Transform != identityTransform:
+			c.composeTransformed(dst, child, childOffset, childClip)
+		case child.Opacity < 1:
+			buf := image.NewRGBA(childClip)
+			c.composeLayer(buf, child, childOffset, childClip)
+			drawWithOpacity(dst, buf, child.Opacity)
+		default:
+			c.composeLayer(dst, child, childOffset, childClip)
+		}
+	}
+}
+
+// composeTransformed draws a transformed layer by composing it untransformed
+// into an image of its extent and mapping that image into dst
+func (c *Compositor) composeTransformed(dst *image.RGBA, layer *Layer, offset image.Point, clip image.Rectangle) {
+	extent := layer.extent()
+	if extent.Empty() {
+		return
+	}
+	buf := image.NewRGBA(extent)
+	c.composeLayer(buf, layer, image.Point{}, extent)
+
+	// Content coordinates to the parent's, then to dst
+	m := layer.Transform
+	s2d := f64.Aff3{m[0], m[1], m[2] - float64(offset.X), m[3], m[4], m[5] - float64(offset.Y)}
+	if layer.Opacity < 1 {
+		tmp := image.NewRGBA(clip)
+		transformImage(tmp, s2d, buf)
+		drawWithOpacity(dst, tmp, layer.Opacity)
+		return
+	}
+	transformImage(dst.SubImage(clip).(*image.RGBA), s2d, buf)
+}
+
+// drawTiles draws the tiles of a layer's own commands that fall inside clip
+func (c *Compositor) drawTiles(dst *image.RGBA, layer *Layer, offset image.Point, clip image.Rectangle) {
+	visible := clip.Add(offset).Intersect(layer.bounds)
+	if visible.Empty() {
+		return
+	}
+
+	op := draw.Over
+	if layer.Kind == LayerRoot {
+		// Root tiles are painted on the page background
+		op = draw.Src
+	}
+	size := c.tileSize
+	for ty := floorDiv(visible.Min.Y, size); ty*size < visible.Max.Y; ty++ {
+		for tx := floorDiv(visible.Min.X, size); tx*size < visible.Max.X; tx++ {
+			t := c.tile(layer, image.Pt(tx, ty))
+			if t.img == nil {
+				continue
+			}
+			r := t.img.Bounds().Sub(offset).Intersect(clip)
+			draw.Draw(dst, r, t.img, r.Min.Add(offset), op)
+		}
+	}
+}
+
+// tile returns a tile of a layer, painting it if it is not cached
+func (c *Compositor) tile(layer *Layer, at image.Point) *tile {
+	t := layer.tiles[at]
+	if t == nil {
+		t = &tile{img: c.paintTile(layer, at)}
+		layer.tiles[at] = t
+	}
+	t.lastUsed = c.frame
+	return t
+}
+
+// paintTile rasterizes the commands of a layer over one tile
+func (c *Compositor) paintTile(layer *Layer, at image.Point) *image.RGBA {
+	size := c.tileSize
+	bounds := image.Rect(at.X*size, at.Y*size, (at.X+1)*size, (at.Y+1)*size)
+
+	// Clip commands are kept so that the clip stack stays balanced
+	var commands []*PaintCommand
+	painted := false
+	for _, cmd := range layer.Commands {
+		switch {
+		case cmd.Type == PaintPushClip || cmd.Type == PaintPopClip:
+			commands = append(commands, cmd)
+		case commandExtent(cmd).Overlaps(bounds):
+			commands = append(commands, cmd)
+			painted = true
+		}
+	}
+	if !painted {
+		return nil
+	}
+
+	img := image.NewRGBA(bounds)
+	if layer.Kind == LayerRoot {
+		draw.Draw(img, bounds, image.NewUniform(c.raster.background), image.Point{}, draw.Src)
+	}
+	c.raster.Paint(img, &DisplayList{Commands: commands})
+	c.tilesPainted++
+	return img
+}
+
+// invalidate drops the tiles of a layer that overlap r
+func (c *Compositor) invalidate(layer *Layer, r image.Rectangle) {
+	if r.Empty() || len(layer.tiles) == 0 {
+		return
+	}
+	size := c.tileSize
+	for ty := floorDiv(r.Min.Y, size); ty*size < r.Max.Y; ty++ {
+		for tx := floorDiv(r.Min.X, size); tx*size < r.Max.X; tx++ {
+			delete(layer.tiles, image.Pt(tx, ty))
+		}
+	}
+}
+
+// checkImages drops the tiles under images that loaded since they were painted
+func (c *Compositor) checkImages(layer *Layer) {
+	for i, cmd := range layer.images {
+		if loaded := imageLoaded(cmd); loaded != layer.imagesLoaded[i] {
+			layer.imagesLoaded[i] = loaded
+			c.invalidate(layer, commandExtent(cmd))
+		}
+	}
+	for _, child := range layer.Children {
+		c.checkImages(child)
+	}
+}
+
+// evictTiles drops the least recently composited tiles over the tile limit,
+// keeping those of the current frame
+func (c *Compositor) evictTiles() {
+	type cachedTile struct {
+		layer *Layer
+		at    image.Point
+		used  int
+	}
+	var cached []cachedTile
+	for _, layer := range c.layers {
+		for at, t := range layer.tiles {
+			cached = append(cached, cachedTile{layer, at, t.lastUsed})
+		}
+	}
+	if len(cached) <= c.maxTiles {
+		return
+	}
+	sort.Slice(cached, func(i, j int) bool { return cached[i].used < cached[j].used })
+	for _, t := range cached[:len(cached)-c.maxTiles] {
+		if t.used == c.frame {
+			break
+		}
+		delete(t.layer.tiles, t.at)
+	}
+}
+
+// BuildLayers splits a display list into a tree of layers
+// Scroll layers are created for user scrollable clips, and fixed, opacity and
+// transform layers for layer commands. Fixed layers are children of the root,
+// as they do not scroll with any scroll container.
+func BuildLayers(displayList *DisplayList) *Layer {
+	root := newLayer(LayerRoot, 0)
+
+	// state is the layer commands go to, its current clip in content
+	// coordinates, and the offset from display list to content coordinates
+	type state struct {
+		layer  *Layer
+		clip   *Rect
+		dx, dy float32
+	}
+	type entry struct {
+		saved    state
+		newLayer bool
+	}
+	current := state{layer: root}
+	var stack []entry
+
+	if displayList != nil {
+		for _, cmd := range displayList.Commands {
+			switch cmd.Type {
+			case PaintPushClip:
+				stack = append(stack, entry{saved: current, newLayer: cmd.UserScrollable})
+				clip := intersectClip(current.clip, shiftRect(cmd.Box, current.dx, current.dy))
+				if !cmd.UserScrollable {
+					current.layer.addCommand(normalizeCommand(cmd, current.dx, current.dy))
+					current.clip = &clip
+					continue
+				}
+				layer := newLayer(LayerScroll, cmd.NodeID)
+				layer.Clip = &clip
+				layer.ScrollX, layer.ScrollY = cmd.ScrollX, cmd.ScrollY
+				current.layer.Children = append(current.layer.Children, layer)
+				current = state{layer: layer, dx: current.dx + cmd.ScrollX, dy: current.dy + cmd.ScrollY}
+
+			case PaintPushLayer:
+				stack = append(stack, entry{saved: current, newLayer: true})
+				layer := newLayer(cmd.LayerKind, cmd.NodeID)
+				if cmd.Opacity > 0 && cmd.Opacity < 1 {
+					layer.Opacity = cmd.Opacity
+				}
+				if cmd.Transform != nil {
+					// Transforms map display list coordinates; fixed layers
+					// share them, other layers are offset by current.dx, dy
+					layer.Transform = *cmd.Transform
+					if cmd.LayerKind != LayerFixed {
+						dx, dy := float64(current.dx), float64(current.dy)
+						layer.Transform = multiplyAff3(f64.Aff3{1, 0, dx, 0, 1, dy}, multiplyAff3(layer.Transform, f64.Aff3{1, 0, -dx, 0, 1, -dy}))
+					}
+				}
+				if cmd.LayerKind == LayerFixed {
+					// Fixed boxes are painted where the display list places them
+					root.Children = append(root.Children, layer)
+					current = state{layer: layer}
+					continue
+				}
+				layer.Clip = current.clip
+				current.layer.Children = append(current.layer.Children, layer)
+				current = state{layer: layer, dx: current.dx, dy: current.dy}
+
+			case PaintPopClip, PaintPopLayer:
+				if len(stack) == 0 {
+					continue
+				}
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if !top.newLayer {
+					current.layer.addCommand(normalizeCommand(cmd, current.dx, current.dy))
+				}
+				current = top.saved
+
+			default:
+				current.layer.addCommand(normalizeCommand(cmd, current.dx, current.dy))
+			}
+		}
+	}
+	return root
+}
+
+// newLayer creates an empty opaque layer
+func newLayer(kind LayerKind, nodeID int64) *Layer {
+	return &Layer{
+		Kind:      kind,
+		NodeID:    nodeID,
+		Opacity:   1,
+		Transform: identityTransform,
+		tiles:     make(map[image.Point]*tile),
+	}
+}
+
+// addCommand appends a command to the layer's own commands
+func (layer *Layer) addCommand(cmd *PaintCommand) {
+	layer.Commands = append(layer.Commands, cmd)
+	if cmd.Type == PaintPushClip || cmd.Type == PaintPopClip {
+		return
+	}
+	layer.bounds = layer.bounds.Union(commandExtent(cmd))
+	if cmd.Type == PaintImage || cmd.Type == PaintBackgroundImage {
+		layer.images = append(layer.images, cmd)
+		layer.imagesLoaded = append(layer.imagesLoaded, imageLoaded(cmd))
+	}
+}
+
+// extent returns the pixels reached by a layer and its descendants, in its
+// content coordinates
+func (layer *Layer) extent() image.Rectangle {
+	extent := layer.bounds
+	for _, child := range layer.Children {
+		var r image.Rectangle
+		switch {
+		case child.Kind == LayerFixed:
+			continue
+		case child.Clip != nil:
+			r = pixelRect(*child.Clip)
+		case child.Transform != identityTransform:
+			r = transformBounds(child.Transform, child.extent())
+		default:
+			r = child.extent()
+		}
+		extent = extent.Union(r)
+	}
+	return extent
+}
+
+// transformBounds returns the bounding box of a transformed rectangle
+func transformBounds(m f64.Aff3, r image.Rectangle) image.Rectangle {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range []image.Point{r.Min, {r.Max.X, r.Min.Y}, {r.Min.X, r.Max.Y}, r.Max} {
+		x := m[0]*float64(p.X) + m[1]*float64(p.Y) + m[2]
+		y := m[3]*float64(p.X) + m[4]*float64(p.Y) + m[5]
+		minX, minY = math.Min(minX, x), math.Min(minY, y)
+		maxX, maxY = math.Max(maxX, x), math.Max(maxY, y)
+	}
+	return image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX)), int(math.Ceil(maxY)))
+}
+
+// normalizeCommand returns a copy of a command shifted into content coordinates
+func normalizeCommand(cmd *PaintCommand, dx, dy float32) *PaintCommand {
+	normalized := *cmd
+	normalized.Box = shiftRect(cmd.Box, dx, dy)
+	if len(cmd.Fragments) > 0 {
+		normalized.Fragments = make([]TextFragment, len(cmd.Fragments))
+		for i, fragment := range cmd.Fragments {
+			fragment.Box = shiftRect(fragment.Box, dx, dy)
+			normalized.Fragments[i] = fragment
+		}
+	}
+	return &normalized
+}
+
+// commandExtent returns the pixels a command may paint, which reach outside
+// its boxes, even empty ones, by up to paintOverflow
+func commandExtent(cmd *PaintCommand) image.Rectangle {
+	extent := pixelRect(cmd.Box)
+	if cmd.Type == PaintBoxShadow {
+		extent = extent.Union(boxShadowBounds(cmd).outerPixels())
+	}
+	for _, fragment := range cmd.Fragments {
+		r := pixelRect(fragment.Box)
+		extent.Min.X, extent.Min.Y = min(extent.Min.X, r.Min.X), min(extent.Min.Y, r.Min.Y)
+		extent.Max.X, extent.Max.Y = max(extent.Max.X, r.Max.X), max(extent.Max.Y, r.Max.Y)
+	}
+	return extent.Inset(-paintOverflow)
+}
+
+// imageKey identifies the image of an image or background image command
+type imageKey struct {
+	node       *RenderNode
+	background int // Background layer, or -1 for the image of an <img>
+}
+
+func newImageKey(cmd *PaintCommand) imageKey {
+	if cmd.Type == PaintBackgroundImage {
+		return imageKey{cmd.Node, cmd.BackgroundIndex}
+	}
+	return imageKey{cmd.Node, -1}
+}
+
+// imageLoaded reports whether the image of an image or background image
+// command is loaded
+func imageLoaded(cmd *PaintCommand) bool {
+	return commandImage(cmd) != nil
+}
+
+// intersectClip intersects a rectangle with an optional clip
+func intersectClip(clip *Rect, r Rect) Rect {
+	if clip == nil {
+		return r
+	}
+	x0, y0 := max(clip.X, r.X), max(clip.Y, r.Y)
+	x1, y1 := min(clip.X+clip.Width, r.X+r.Width), min(clip.Y+clip.Height, r.Y+r.Height)
+	return Rect{X: x0, Y: y0, Width: max(x1-x0, 0), Height: max(y1-y0, 0)}
+}
+
+// shiftRect moves a rectangle by an offset
+func shiftRect(r Rect, dx, dy float32) Rect {
+	r.X += dx
+	r.Y += dy
+	return r
+}
+
+// roundPixel rounds an offset to whole pixels
+func roundPixel(v float32) int {
+	return int(math.Round(float64(v)))
+}
+
+// floorDiv divides rounding towards negative infinity
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
@@ -0,0 +1,466 @@
+package renderer
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"golang.org/x/image/math/f64"
+
+	imageloader "github.com/vyquocvu/goosie/internal/image"
+)
+
+// compositorTestPage returns a page with a scroll container, a translucent
+// box and the given number of paragraphs
+func compositorTestPage(paragraphs int) string {
+	var sb strings.Builder
+	sb.WriteString(`<html><head><style>
+.scroller { overflow: auto; height: 100px; border: 2px solid black; }
+.faded { opacity: 0.5; border: 4px solid red; }
+</style></head><body>`)
+	sb.WriteString(`<div class="scroller">`)
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&sb, "<p>Scrolled line %d</p>", i)
+	}
+	sb.WriteString(`</div><div class="faded"><p>Translucent text</p></div>`)
+	for i := 0; i < paragraphs; i++ {
+		fmt.Fprintf(&sb, "<p>Paragraph %d of the page, long enough to hold a few words.</p>", i)
+	}
+	sb.WriteString(`</body></html>`)
+	return sb.String()
+}
+
+// layoutCompositorPage lays out a page for compositor tests
+func layoutCompositorPage(t *testing.T, htmlContent string) *Renderer {
+	t.Helper()
+	r := NewRenderer(800, 600)
+	if _, err := r.LayoutHTML(htmlContent); err != nil {
+		t.Fatalf("Failed to lay out: %v", err)
+	}
+	return r
+}
+
+// assertSameImage fails if dst differs from the part of the page image
+// starting at (0, scrollY)
+func assertSameImage(t *testing.T, page, dst *image.RGBA, scrollY int) {
+	t.Helper()
+	expected := image.NewRGBA(dst.Bounds())
+	for y := 0; y < dst.Bounds().Dy(); y++ {
+		copy(expected.Pix[y*expected.Stride:(y+1)*expected.Stride], page.Pix[(y+scrollY)*page.Stride:])
+	}
+	if maxDifference, pixels, _ := compareImages(expected, dst); pixels > 0 {
+		t.Errorf("Expected the composited image to match the raster render at %d, %d pixels differ by up to %d", scrollY, pixels, maxDifference)
+	}
+}
+
+func TestBuildLayers(t *testing.T) {
+	dl := NewDisplayList()
+	dl.AddCommand(&PaintCommand{Type: PaintRect, NodeID: 1, Box: Rect{Width: 100, Height: 10}})
+	dl.AddCommand(&PaintCommand{Type: PaintPushClip, NodeID: 2, Box: Rect{Y: 10, Width: 100, Height: 50}, ScrollY: 30, UserScrollable: true})
+	dl.AddCommand(&PaintCommand{Type: PaintRect, NodeID: 3, Box: Rect{Y: -20, Width: 100, Height: 10}})
+	dl.AddCommand(&PaintCommand{Type: PaintPushLayer, NodeID: 4, LayerKind: LayerOpacity, Opacity: 0.5})
+	dl.AddCommand(&PaintCommand{Type: PaintRect, NodeID: 4, Box: Rect{Y: 0, Width: 100, Height: 10}})
+	dl.AddCommand(&PaintCommand{Type: PaintPushLayer, NodeID: 5, LayerKind: LayerFixed})
+	dl.AddCommand(&PaintCommand{Type: PaintRect, NodeID: 5, Box: Rect{Y: 5, Width: 100, Height: 10}})
+	dl.AddCommand(&PaintCommand{Type: PaintPopLayer, NodeID: 5})
+	dl.AddCommand(&PaintCommand{Type: PaintPopLayer, NodeID: 4})
+	dl.AddCommand(&PaintCommand{Type: PaintPopClip, NodeID: 2})
+	dl.AddCommand(&PaintCommand{Type: PaintPushClip, NodeID: 6, Box: Rect{Y: 60, Width: 50, Height: 50}})
+	dl.AddCommand(&PaintCommand{Type: PaintRect, NodeID: 7, Box: Rect{Y: 60, Width: 100, Height: 10}})
+	dl.AddCommand(&PaintCommand{Type: PaintPopClip, NodeID: 6})
+
+	root := BuildLayers(dl)
+	if len(root.Commands) != 4 || root.Commands[1].Type != PaintPushClip || root.Commands[3].Type != PaintPopClip {
+		t.Fatalf("Expected the root to keep its own commands and clips, got %d commands", len(root.Commands))
+	}
+	if len(root.Children) != 2 || root.Children[0].Kind != LayerScroll || root.Children[1].Kind != LayerFixed {
+		t.Fatalf("Expected a scroll layer and the fixed layer under the root, got %d children", len(root.Children))
+	}
+
+	scroll := root.Children[0]
+	if scroll.NodeID != 2 || scroll.ScrollY != 30 || scroll.Clip == nil || *scroll.Clip != (Rect{Y: 10, Width: 100, Height: 50}) {
+		t.Errorf("Expected the scroll layer to keep its clip and offset, got %+v", scroll)
+	}
+	if len(scroll.Commands) != 1 || scroll.Commands[0].Box.Y != 10 {
+		t.Errorf("Expected scroll layer commands in unscrolled coordinates, got %+v", scroll.Commands)
+	}
+	if dl.Commands[2].Box.Y != -20 {
+		t.Error("Expected the display list not to be modified")
+	}
+
+	if len(scroll.Children) != 1 {
+		t.Fatalf("Expected the opacity layer inside the scroll layer, got %d children", len(scroll.Children))
+	}
+	faded := scroll.Children[0]
+	if faded.Kind != LayerOpacity || faded.Opacity != 0.5 || len(faded.Commands) != 1 || faded.Commands[0].Box.Y != 30 {
+		t.Errorf("Expected a translucent layer with one command, got %+v", faded)
+	}
+
+	fixed := root.Children[1]
+	if fixed.Opacity != 1 || fixed.Clip != nil || len(fixed.Commands) != 1 || fixed.Commands[0].Box.Y != 5 {
+		t.Errorf("Expected the fixed layer at its display list position, got %+v", fixed)
+	}
+}
+
+func TestDisplayListLayerCommands(t *testing.T) {
+	r := layoutCompositorPage(t, `<html><head><style>
+.faded { opacity: 0.25; }
+.header { position: fixed; }
+</style></head><body><div class="header"><p>Header</p></div><div class="faded"><p>Faded</p></div></body></html>`)
+
+	var layers []*PaintCommand
+	for _, cmd := range r.DisplayList().Commands {
+		if cmd.Type == PaintPushLayer {
+			layers = append(layers, cmd)
+		}
+	}
+	if len(layers) != 2 || layers[0].LayerKind != LayerFixed || layers[1].LayerKind != LayerOpacity || layers[1].Opacity != 0.25 {
+		t.Fatalf("Expected a fixed and an opacity layer, got %+v", layers)
+	}
+	if layers[0].Box.Y != layers[1].Box.Y {
+		t.Errorf("Expected the fixed box to take no space in the flow, got %v and %v", layers[0].Box, layers[1].Box)
+	}
+}
+
+func TestRasterRendererPaintsOpacityLayers(t *testing.T) {
+	dl := NewDisplayList()
+	dl.AddCommand(&PaintCommand{Type: PaintPushLayer, LayerKind: LayerOpacity, Opacity: 0.5})
+	dl.AddCommand(&PaintCommand{Type: PaintRect, Box: Rect{Width: 20, Height: 20}, FillColor: color.Black})
+	dl.AddCommand(&PaintCommand{Type: PaintRect, Box: Rect{X: 10, Width: 20, Height: 20}, FillColor: color.Black})
+	dl.AddCommand(&PaintCommand{Type: PaintPopLayer})
+
+	img := NewRasterRenderer().Render(dl, 40, 20)
+	gray := color.RGBA{R: 127, G: 127, B: 127, A: 255}
+	// Overlapping commands of a layer are blended as one image
+	if !sameColor(img, 5, 5, gray) || !sameColor(img, 15, 5, gray) || !sameColor(img, 25, 5, gray) {
+		t.Errorf("Expected the layer blended at half opacity, got %v and %v", img.At(5, 5), img.At(15, 5))
+	}
+	if !sameColor(img, 35, 5, color.White) {
+		t.Error("Expected nothing painted outside the layer")
+	}
+}
+
+func TestCompositorMatchesRaster(t *testing.T) {
+	r := layoutCompositorPage(t, compositorTestPage(60))
+	dl := r.DisplayList()
+	height := int(r.GetContentHeight())
+	page := NewRasterRenderer().Render(dl, 800, height)
+
+	c := NewCompositor(NewRasterRenderer())
+	c.Update(dl)
+	if len(c.Root().Children) != 2 {
+		t.Fatalf("Expected a scroll and an opacity layer, got %d", len(c.Root().Children))
+	}
+	for _, scrollY := range []int{0, 250, 1000, height - 600} {
+		dst := image.NewRGBA(image.Rect(0, 0, 800, 600))
+		c.Compose(dst, 0, float32(scrollY))
+		assertSameImage(t, page, dst, scrollY)
+	}
+}
+
+func TestCompositorScrollRepaintsOnlyNewTiles(t *testing.T) {
+	r := layoutCompositorPage(t, compositorTestPage(100))
+	c := NewCompositor(NewRasterRenderer())
+	c.Update(r.DisplayList())
+
+	dst := image.NewRGBA(image.Rect(0, 0, 800, 600))
+	c.Compose(dst, 0, 0)
+	first := c.TilesPainted()
+	if first == 0 {
+		t.Fatal("Expected the first frame to paint tiles")
+	}
+
+	// Scrolling within painted tiles only re-composites them
+	c.Compose(dst, 0, 100)
+	if c.TilesPainted() != first {
+		t.Errorf("Expected no tiles painted when scrolling within cached tiles, got %d more", c.TilesPainted()-first)
+	}
+
+	// Scrolling a viewport further paints the newly visible rows only
+	c.Compose(dst, 0, 600)
+	if painted := c.TilesPainted() - first; painted == 0 || painted > 8 {
+		t.Errorf("Expected at most two new rows of four tiles, got %d", painted)
+	}
+
+	// Scrolling back reuses the cached tiles
+	painted := c.TilesPainted()
+	c.Compose(dst, 0, 0)
+	if c.TilesPainted() != painted {
+		t.Error("Expected scrolling back to reuse cached tiles")
+	}
+}
+
+func TestCompositorScrollLayer(t *testing.T) {
+	r := layoutCompositorPage(t, compositorTestPage(0))
+	c := r.Compositor()
+	scroller := c.Root().Children[0]
+	if scroller.Kind != LayerScroll {
+		t.Fatalf("Expected a scroll layer, got %v", scroller.Kind)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, 800, 600))
+	c.Compose(dst, 0, 0)
+	painted := c.TilesPainted()
+
+	// Scrolling the container moves its layer without repainting
+	if !c.SetLayerScroll(scroller.NodeID, 0, 40) {
+		t.Fatal("Expected the scroll layer to be found")
+	}
+	c.Compose(dst, 0, 0)
+	if c.TilesPainted() != painted {
+		t.Errorf("Expected no tiles painted when scrolling a layer, got %d", c.TilesPainted()-painted)
+	}
+	if c.SetLayerScroll(-1, 0, 40) {
+		t.Error("Expected no scroll layer for an unknown node")
+	}
+
+	// The result matches a display list built with the container scrolled
+	r.layoutEngine.ScrollTo(r.layoutEngine.GetLayoutBox(scroller.NodeID), 0, 40)
+	page := NewRasterRenderer().Render(r.DisplayList(), 800, 600)
+	assertSameImage(t, page, dst, 0)
+}
+
+func TestCompositorUpdateRepaintsChangedTiles(t *testing.T) {
+	r := layoutCompositorPage(t, compositorTestPage(100))
+	c := r.Compositor()
+	dst := image.NewRGBA(image.Rect(0, 0, 800, 600))
+	c.Compose(dst, 0, 0)
+	c.Compose(dst, 0, 600)
+	painted := c.TilesPainted()
+
+	// Change the text of a paragraph in the second viewport
+	target := findText(r.RenderTree(), "Paragraph 20 of the page, long enough to hold a few words.")
+	if target == nil {
+		t.Fatal("Expected the paragraph text")
+	}
+	target.Text = "Paragraph 20 was edited."
+	r.Relayout()
+
+	c = r.Compositor()
+	c.Compose(dst, 0, 0)
+	if c.TilesPainted() != painted {
+		t.Errorf("Expected no repaint away from the change, got %d tiles", c.TilesPainted()-painted)
+	}
+	c.Compose(dst, 0, 600)
+	if repainted := c.TilesPainted() - painted; repainted == 0 || repainted > 8 {
+		t.Errorf("Expected only the tiles around the paragraph repainted, got %d", repainted)
+	}
+	page := NewRasterRenderer().Render(r.DisplayList(), 800, 1200)
+	assertSameImage(t, page, dst, 600)
+
+	// Invalidating a node repaints its tiles only
+	painted = c.TilesPainted()
+	c.InvalidateNode(target.ID)
+	c.Compose(dst, 0, 600)
+	if repainted := c.TilesPainted() - painted; repainted == 0 || repainted > 8 {
+		t.Errorf("Expected the tiles of the node repainted, got %d", repainted)
+	}
+}
+
+func TestCompositorRepaintsLoadedImages(t *testing.T) {
+	r := layoutCompositorPage(t, `<html><body><p>Before</p><img src="cat.png" alt="A cat"><p>After</p></body></html>`)
+	c := r.Compositor()
+	dst := image.NewRGBA(image.Rect(0, 0, 800, 600))
+	c.Compose(dst, 0, 0)
+	painted := c.TilesPainted()
+
+	var img *RenderNode
+	for _, cmd := range r.DisplayList().Commands {
+		if cmd.Type == PaintImage {
+			img = cmd.Node
+		}
+	}
+	if img == nil {
+		t.Fatal("Expected an image command")
+	}
+	pixels := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := range pixels.Pix {
+		pixels.Pix[i] = 255
+	}
+	img.ImageData = &imageloader.ImageData{State: imageloader.StateLoaded, Image: pixels}
+
+	c.Compose(dst, 0, 0)
+	if c.TilesPainted() == painted {
+		t.Error("Expected the tiles under a loaded image to be repainted")
+	}
+	page := NewRasterRenderer().Render(r.DisplayList(), 800, 600)
+	assertSameImage(t, page, dst, 0)
+}
+
+func TestCompositorTransformLayer(t *testing.T) {
+	dl := NewDisplayList()
+	dl.AddCommand(&PaintCommand{Type: PaintPushLayer, NodeID: 1, LayerKind: LayerTransform})
+	dl.AddCommand(&PaintCommand{Type: PaintRect, NodeID: 2, Box: Rect{X: 10, Y: 10, Width: 20, Height: 20}, FillColor: testRed})
+	dl.AddCommand(&PaintCommand{Type: PaintPopLayer, NodeID: 1})
+
+	c := NewCompositor(NewRasterRenderer())
+	c.Update(dl)
+	layer := c.Root().Children[0]
+	layer.Transform = f64.Aff3{1, 0, 50, 0, 1, 5}
+
+	dst := image.NewRGBA(image.Rect(0, 0, 100, 50))
+	c.Compose(dst, 0, 0)
+	if !sameColor(dst, 70, 25, testRed) {
+		t.Errorf("Expected the layer translated, got %v", dst.At(70, 25))
+	}
+	if !sameColor(dst, 20, 20, color.White) {
+		t.Error("Expected nothing painted at the untransformed position")
+	}
+}
+
+func BenchmarkCompositorScroll(b *testing.B) {
+	r := NewRenderer(800, 600)
+	if _, err := r.LayoutHTML(compositorTestPage(2000)); err != nil {
+		b.Fatalf("Failed to lay out: %v", err)
+	}
+	c := r.Compositor()
+	dst := image.NewRGBA(image.Rect(0, 0, 800, 600))
+	height := r.GetContentHeight() - 600
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Scroll down 40 pixels per frame, wrapping at the end of the page
+		c.Compose(dst, 0, float32(i*40%int(height)))
+	}
+	b.ReportMetric(float64(c.TilesPainted())/float64(b.N), "tiles-painted/op")
+}
+
+func BenchmarkRasterScroll(b *testing.B) {
+	r := NewRenderer(800, 600)
+	if _, err := r.LayoutHTML(compositorTestPage(2000)); err != nil {
+		b.Fatalf("Failed to lay out: %v", err)
+	}
+	dl := r.DisplayList()
+	raster := NewRasterRenderer()
+	height := r.GetContentHeight() - 600
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Repaint the viewport from the display list at each scroll position
+		y := i * 40 % int(height)
+		dst := image.NewRGBA(image.Rect(0, y, 800, y+600))
+		raster.Paint(dst, dl)
+	}
+}
+
+func TestRendererComposeViewport(t *testing.T) {
+	r := layoutCompositorPage(t, compositorTestPage(60))
+	page := NewRasterRenderer().Render(r.DisplayList(), 800, int(r.GetContentHeight()))
+
+	r.SetViewport(300, 400)
+	img := r.ComposeViewport()
+	if img.Bounds() != image.Rect(0, 0, 800, 400) {
+		t.Fatalf("Expected an image of the viewport, got %v", img.Bounds())
+	}
+	assertSameImage(t, page, img, 300)
+
+	// The compositor is updated once the layout changes
+	c := r.Compositor()
+	root := c.Root()
+	if r.Compositor().Root() != root {
+		t.Error("Expected the layers to be kept while the layout is unchanged")
+	}
+	r.Relayout()
+	if r.Compositor().Root() == root {
+		t.Error("Expected the layers to be rebuilt after a relayout")
+	}
+}
+
+func TestRendererComposeViewportImageReusesTiles(t *testing.T) {
+	r := layoutCompositorPage(t, compositorTestPage(60))
+	page := NewRasterRenderer().Render(r.DisplayList(), 800, int(r.GetContentHeight()))
+
+	r.SetViewport(0, 400)
+	if obj := r.ComposeViewportImage(); obj.MinSize().Height < r.GetContentHeight() {
+		t.Errorf("Expected the viewport object as tall as the page, got %v", obj.MinSize())
+	}
+	painted := r.Compositor().TilesPainted()
+	if painted == 0 {
+		t.Fatal("Expected the first viewport to be painted from tiles")
+	}
+
+	// Scrolling within the painted tiles and back rasterizes nothing
+	for _, y := range []float32{60, 100, 0} {
+		r.SetViewport(y, 400)
+		obj := r.ComposeViewportImage()
+		if got := r.Compositor().TilesPainted() - painted; got != 0 {
+			t.Errorf("Expected no tiles rasterized scrolling to %v, got %d", y, got)
+		}
+		img := findViewportImage(t, obj)
+		if img.Position().Y != y {
+			t.Errorf("Expected the viewport image at %v, got %v", y, img.Position().Y)
+		}
+		assertSameImage(t, page, img.Image.(*image.RGBA), int(y))
+	}
+
+	// A change repaints only the tiles under it
+	target := findText(r.RenderTree(), "Paragraph 2 of the page, long enough to hold a few words.")
+	if target == nil {
+		t.Fatal("Expected the paragraph text")
+	}
+	target.Text = "Paragraph 2 was edited."
+	r.Relayout()
+	r.ComposeViewportImage()
+	if repainted := r.Compositor().TilesPainted() - painted; repainted == 0 || repainted > 8 {
+		t.Errorf("Expected only the tiles around the paragraph repainted, got %d", repainted)
+	}
+
+	// UpdateViewport keeps painting the widget tree, so text stays
+	// selectable and form controls live
+	content, ok := r.UpdateViewport().(*fyne.Container)
+	if !ok || len(content.Objects) < 2 {
+		t.Fatalf("Expected the widgets of the viewport, got %#v", content)
+	}
+	for _, child := range content.Objects {
+		if _, ok := child.(*linkArea); ok {
+			t.Error("Expected UpdateViewport not to paint from tiles")
+		}
+	}
+}
+
+// findViewportImage returns the image of a viewport painted by ComposeViewportImage
+func findViewportImage(t *testing.T, obj fyne.CanvasObject) *canvas.Image {
+	t.Helper()
+	if c, ok := obj.(*fyne.Container); ok {
+		for _, child := range c.Objects {
+			if img, ok := child.(*canvas.Image); ok {
+				return img
+			}
+		}
+	}
+	t.Fatalf("Expected a viewport image, got %T", obj)
+	return nil
+}
+
+func TestViewportObjectLinks(t *testing.T) {
+	cr := NewCanvasRenderer(800, 600)
+	var navigated string
+	cr.SetNavigationCallback(func(url string) { navigated = url }, "https://example.com/")
+	cr.SetViewport(0, 600)
+
+	dl := NewDisplayList()
+	dl.AddCommand(&PaintCommand{Type: PaintLink, NodeID: 1, LinkURL: "/next", LinkText: "Next", Box: Rect{X: 10, Y: 20, Width: 40, Height: 16}})
+	dl.AddCommand(&PaintCommand{Type: PaintLink, NodeID: 2, LinkURL: "/far", LinkText: "Far", Box: Rect{Y: 5000, Width: 40, Height: 16}})
+	obj := cr.viewportObject(image.NewRGBA(image.Rect(0, 0, 800, 600)), dl, 6000).(*fyne.Container)
+
+	var areas []*linkArea
+	for _, child := range obj.Objects {
+		if area, ok := child.(*linkArea); ok {
+			areas = append(areas, area)
+		}
+	}
+	if len(areas) != 1 {
+		t.Fatalf("Expected a tap target for the link in the viewport only, got %d", len(areas))
+	}
+	if areas[0].Position() != fyne.NewPos(10, 20) || areas[0].Size() != fyne.NewSize(40, 16) {
+		t.Errorf("Expected the tap target over the link, got %v %v", areas[0].Position(), areas[0].Size())
+	}
+	areas[0].Tapped(&fyne.PointEvent{})
+	if navigated != "https://example.com/next" {
+		t.Errorf("Expected tapping the link to navigate, got %q", navigated)
+	}
+}
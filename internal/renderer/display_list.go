@@ -3,6 +3,8 @@ package renderer
 import (
 	"image/color"
 	"strings"
+
+	"golang.org/x/image/math/f64"
 )
 
 // PaintCommandType represents the type of paint command
@@ -19,6 +21,36 @@ const (
 	PaintLink
 	// PaintBorder represents a border paint command
 	PaintBorder
+	// PaintPushClip starts clipping following commands to Box
+	PaintPushClip
+	// PaintPopClip ends the clip started by the matching PaintPushClip
+	PaintPopClip
+	// PaintPushLayer starts a group of commands composited as one layer
+	PaintPushLayer
+	// PaintPopLayer ends the layer started by the matching PaintPushLayer
+	PaintPopLayer
+	// PaintBoxShadow represents an outer or inset box shadow
+	PaintBoxShadow
+	// PaintBackgroundImage represents a url() background layer
+	PaintBackgroundImage
+	// PaintGradient represents a gradient background layer
+	PaintGradient
+)
+
+// LayerKind is the reason a group of commands is composited separately
+type LayerKind int
+
+const (
+	// LayerRoot holds the page content outside any other layer
+	LayerRoot LayerKind = iota
+	// LayerScroll holds the content of a user scrollable scroll container
+	LayerScroll
+	// LayerFixed holds a position: fixed box, which does not scroll with the page
+	LayerFixed
+	// LayerOpacity holds a box with an opacity below 1
+	LayerOpacity
+	// LayerTransform holds a transformed box
+	LayerTransform
 )
 
 // PaintCommand represents a single paint operation
@@ -29,10 +61,12 @@ type PaintCommand struct {
 	Box    Rect    // Position and size for the command
 	
 	// Text-specific fields
-	Text      string
-	FontSize  float32
-	Bold      bool
-	Italic    bool
+	Text       string
+	FontSize   float32
+	FontFamily string // CSS font-family list
+	Bold       bool
+	Italic     bool
+	Fragments  []TextFragment // Line-by-line placement of inline text (empty for block text)
 	
 	// Rectangle-specific fields
 	FillColor   color.Color
@@ -60,6 +94,43 @@ type PaintCommand struct {
 	BorderRightStyle  string
 	BorderBottomStyle string
 	BorderLeftStyle   string
+	
+	// Rounded corners of rectangle, border and shadow commands
+	Radii CornerRadii
+	
+	// Shadow-specific fields (Box holds the border box, or the padding box for
+	// inset shadows, and FillColor the shadow color)
+	ShadowOffsetX float32
+	ShadowOffsetY float32
+	ShadowBlur    float32
+	ShadowSpread  float32
+	ShadowInset   bool
+	
+	// Background-specific fields (Box holds the painting area from
+	// background-clip, and Radii its rounded corners)
+	Tiling          *BackgroundTiling
+	Gradient        *Gradient
+	BackgroundIndex int // Layer of a background image in RenderNode.BackgroundImages
+	
+	// Clip-specific fields (Box holds the clip rectangle)
+	ScrollX          float32 // Scroll offset of the clipping scroll container
+	ScrollY          float32
+	ScrollWidth      float32 // Size of the scrollable overflow area
+	ScrollHeight     float32
+	UserScrollable   bool    // True if wheel and drag input may scroll the clip
+	
+	// Layer-specific fields (Box holds the bounds of the layer's box)
+	LayerKind LayerKind
+	Opacity   float32 // Opacity the layer is composited with
+	Transform *f64.Aff3 // Maps the layer's content into display list coordinates, nil if untransformed
+}
+
+// TextFragment is a piece of a text command placed on one line by inline layout
+type TextFragment struct {
+	Text      string  `json:"text"`
+	Box       Rect    `json:"box"`                 // Position and size of the inline box
+	Baseline  float32 `json:"baseline"`            // Distance from the top of Box to the text baseline
+	BidiLevel int     `json:"bidiLevel,omitempty"` // Resolved bidi embedding level; odd levels run right to left
 }
 
 // DisplayList represents a list of paint commands
@@ -88,6 +159,13 @@ func (dl *DisplayList) Clear() {
 type DisplayListBuilder struct {
 	defaultFontSize float32
 	fontMetrics     *FontMetrics
+	
+	// Accumulated scroll offset of enclosing scroll containers while building
+	offsetX float32
+	offsetY float32
+	
+	// Box of the root element, the positioning area of fixed backgrounds
+	rootBox Rect
 }
 
 // NewDisplayListBuilder creates a new display list builder
@@ -109,6 +187,9 @@ func (dlb *DisplayListBuilder) Build(layoutRoot *LayoutBox, renderRoot *RenderNo
 	
 	// Build a map of render nodes by ID for quick lookup
 	renderMap := dlb.buildRenderMap(renderRoot)
+	dlb.offsetX = 0
+	dlb.offsetY = 0
+	dlb.rootBox = layoutRoot.Box
 	
 	// Walk the layout tree and generate paint commands
 	dlb.buildRecursive(layoutRoot, renderMap, displayList)
@@ -148,24 +229,51 @@ func (dlb *DisplayListBuilder) buildRecursive(layoutBox *LayoutBox, renderMap ma
 		return
 	}
 	
-	// Add border paint command if the element has borders
-	dlb.addBorderCommand(layoutBox, renderNode, displayList)
+	// Group the commands of fixed, transformed and translucent boxes into a layer
+	layer, opacity, transform := dlb.layerKind(layoutBox, renderNode)
+	if layer != LayerRoot {
+		displayList.AddCommand(&PaintCommand{
+			Type:      PaintPushLayer,
+			NodeID:    layoutBox.NodeID,
+			Node:      renderNode,
+			Box:       dlb.translate(layoutBox.Box),
+			LayerKind: layer,
+			Opacity:   opacity,
+			Transform: transform,
+		})
+	}
+	
+	// Paint the box behind its content: outer shadows, the background, inset
+	// shadows and the border
+	radii := dlb.cornerRadii(layoutBox, renderNode)
+	dlb.addBoxShadowCommands(layoutBox, renderNode, radii, false, displayList)
+	dlb.addBackgroundCommands(layoutBox, renderNode, radii, displayList)
+	dlb.addBoxShadowCommands(layoutBox, renderNode, radii, true, displayList)
+	dlb.addBorderCommand(layoutBox, renderNode, radii, displayList)
+	
+	// Clip the content of boxes with non-visible overflow, and shift it by the
+	// scroll offset of scroll containers
+	clips := layoutBox.ClipsContent()
+	if clips {
+		dlb.pushClip(layoutBox, displayList)
+	}
 	
 	// Check if this layout box has inline content (LineBoxes)
 	if len(layoutBox.LineBoxes) > 0 {
-		// Group inline boxes by NodeID to avoid duplicates
-		processedNodes := make(map[int64]bool)
+		// Group inline boxes by NodeID into one command per text node
+		textCommands := make(map[int64]*PaintCommand)
 		
 		// Process inline boxes from LineBoxes
 		for _, lineBox := range layoutBox.LineBoxes {
 			for _, inlineBox := range lineBox.InlineBoxes {
-				// Skip if we've already processed this node
-				if processedNodes[inlineBox.NodeID] {
+				if !inlineBox.IsText {
+					// Handle inline-block elements if needed
+					// For now, skip them as they should have their own LayoutBox
 					continue
 				}
-				processedNodes[inlineBox.NodeID] = true
 				
-				if inlineBox.IsText {
+				cmd, processed := textCommands[inlineBox.NodeID]
+				if !processed {
 					// Get the render node for this inline box
 					inlineRenderNode, inlineExists := renderMap[inlineBox.NodeID]
 					if !inlineExists {
@@ -183,21 +291,35 @@ func (dlb *DisplayListBuilder) buildRecursive(layoutBox *LayoutBox, renderMap ma
 					
 					// Create paint command for the full text of the node
 					// Use the layout box dimensions for the entire element
-					cmd := &PaintCommand{
-						Type:     PaintText,
-						NodeID:   inlineBox.NodeID,
-						Node:     inlineRenderNode,
-						Box:      layoutBox.Box,
-						Text:     inlineRenderNode.Text,
-						FontSize: fontSize,
-						Bold:     style.Bold,
-						Italic:   style.Italic,
+					cmd = &PaintCommand{
+						Type:       PaintText,
+						NodeID:     inlineBox.NodeID,
+						Node:       inlineRenderNode,
+						Box:        dlb.translate(layoutBox.Box),
+						Text:       dlb.transformText(inlineRenderNode),
+						FontSize:   fontSize,
+						FontFamily: dlb.fontFamily(inlineRenderNode),
+						Bold:       style.Bold,
+						Italic:     style.Italic,
 					}
+					textCommands[inlineBox.NodeID] = cmd
 					
 					displayList.AddCommand(cmd)
-				} else {
-					// Handle inline-block elements if needed
-					// For now, skip them as they should have their own LayoutBox
+				}
+				
+				// Each inline box becomes a fragment placed on its line
+				if inlineBox.Text != "" {
+					cmd.Fragments = append(cmd.Fragments, TextFragment{
+						Text: inlineBox.Text,
+						Box: dlb.translate(Rect{
+							X:      lineBox.X + inlineBox.X,
+							Y:      lineBox.Y + inlineBox.Y,
+							Width:  inlineBox.Width,
+							Height: inlineBox.Ascent + inlineBox.Descent,
+						}),
+						Baseline:  inlineBox.Ascent,
+						BidiLevel: inlineBox.BidiLevel,
+					})
 				}
 			}
 		}
@@ -214,11 +336,88 @@ func (dlb *DisplayListBuilder) buildRecursive(layoutBox *LayoutBox, renderMap ma
 	for _, child := range layoutBox.Children {
 		dlb.buildRecursive(child, renderMap, displayList)
 	}
+	
+	if clips {
+		dlb.popClip(layoutBox, displayList)
+	}
+	
+	// Outlines are painted over the content
+	dlb.addOutlineCommand(layoutBox, renderNode, radii, displayList)
+	
+	if layer != LayerRoot {
+		displayList.AddCommand(&PaintCommand{
+			Type:   PaintPopLayer,
+			NodeID: layoutBox.NodeID,
+		})
+	}
+}
+
+// layerKind returns the layer a node's commands are grouped into, LayerRoot
+// for none, the layer opacity, and its transform in display list coordinates
+func (dlb *DisplayListBuilder) layerKind(layoutBox *LayoutBox, node *RenderNode) (LayerKind, float32, *f64.Aff3) {
+	if node.Type != NodeTypeElement || node.ComputedStyle == nil {
+		return LayerRoot, 1, nil
+	}
+	// An opacity of 0 means the property is unset
+	opacity := node.ComputedStyle.Opacity
+	if opacity <= 0 || opacity > 1 {
+		opacity = 1
+	}
+	var transform *f64.Aff3
+	if layoutBox.Transform != nil {
+		m := layoutBox.Transform.Matrix(dlb.translate(layoutBox.Box))
+		transform = &m
+	}
+	if node.IsFixed() {
+		return LayerFixed, opacity, transform
+	}
+	if transform != nil {
+		return LayerTransform, opacity, transform
+	}
+	if opacity < 1 {
+		return LayerOpacity, opacity, nil
+	}
+	return LayerRoot, 1, nil
+}
+
+// pushClip emits a clip command for a box and applies its scroll offset to descendants
+func (dlb *DisplayListBuilder) pushClip(layoutBox *LayoutBox, displayList *DisplayList) {
+	displayList.AddCommand(&PaintCommand{
+		Type:           PaintPushClip,
+		NodeID:         layoutBox.NodeID,
+		Box:            dlb.translate(layoutBox.GetClipBox()),
+		ScrollX:        layoutBox.ScrollX,
+		ScrollY:        layoutBox.ScrollY,
+		ScrollWidth:    layoutBox.ScrollWidth,
+		ScrollHeight:   layoutBox.ScrollHeight,
+		UserScrollable: layoutBox.IsUserScrollable(),
+	})
+	
+	dlb.offsetX -= layoutBox.ScrollX
+	dlb.offsetY -= layoutBox.ScrollY
+}
+
+// popClip ends the clip started by pushClip and restores the scroll offset
+func (dlb *DisplayListBuilder) popClip(layoutBox *LayoutBox, displayList *DisplayList) {
+	dlb.offsetX += layoutBox.ScrollX
+	dlb.offsetY += layoutBox.ScrollY
+	
+	displayList.AddCommand(&PaintCommand{
+		Type:   PaintPopClip,
+		NodeID: layoutBox.NodeID,
+	})
+}
+
+// translate shifts a rectangle by the scroll offset of enclosing scroll containers
+func (dlb *DisplayListBuilder) translate(box Rect) Rect {
+	box.X += dlb.offsetX
+	box.Y += dlb.offsetY
+	return box
 }
 
 // addTextCommand adds a text paint command
 func (dlb *DisplayListBuilder) addTextCommand(layoutBox *LayoutBox, renderNode *RenderNode, displayList *DisplayList) {
-	text := renderNode.Text
+	text := dlb.transformText(renderNode)
 	if text == "" {
 		return
 	}
@@ -233,19 +432,30 @@ func (dlb *DisplayListBuilder) addTextCommand(layoutBox *LayoutBox, renderNode *
 	}
 	
 	cmd := &PaintCommand{
-		Type:     PaintText,
-		NodeID:   layoutBox.NodeID,
-		Node:     renderNode,
-		Box:      layoutBox.Box,
-		Text:     text,
-		FontSize: fontSize,
-		Bold:     style.Bold,
-		Italic:   style.Italic,
+		Type:       PaintText,
+		NodeID:     layoutBox.NodeID,
+		Node:       renderNode,
+		Box:        dlb.translate(layoutBox.Box),
+		Text:       text,
+		FontSize:   fontSize,
+		FontFamily: dlb.fontFamily(renderNode),
+		Bold:       style.Bold,
+		Italic:     style.Italic,
 	}
 	
 	displayList.AddCommand(cmd)
 }
 
+// transformText returns the text of a node with its CSS text-transform applied
+func (dlb *DisplayListBuilder) transformText(renderNode *RenderNode) string {
+	return ApplyTextTransform(renderNode.Text, inheritedStyleValue(renderNode, func(s *Style) string { return s.TextTransform }))
+}
+
+// fontFamily returns the inherited CSS font-family list of a node
+func (dlb *DisplayListBuilder) fontFamily(renderNode *RenderNode) string {
+	return inheritedStyleValue(renderNode, func(s *Style) string { return s.FontFamily })
+}
+
 // addElementCommand adds paint commands for an element
 func (dlb *DisplayListBuilder) addElementCommand(layoutBox *LayoutBox, renderNode *RenderNode, displayList *DisplayList) {
 	// For link elements, add a link paint command
@@ -259,7 +469,7 @@ func (dlb *DisplayListBuilder) addElementCommand(layoutBox *LayoutBox, renderNod
 					Type:     PaintLink,
 					NodeID:   layoutBox.NodeID,
 					Node:     renderNode,
-					Box:      layoutBox.Box,
+					Box:      dlb.translate(layoutBox.Box),
 					LinkURL:  href,
 					LinkText: linkText,
 				}
@@ -276,7 +486,7 @@ func (dlb *DisplayListBuilder) addElementCommand(layoutBox *LayoutBox, renderNod
 			Type:        PaintRect,
 			NodeID:      layoutBox.NodeID,
 			Node:        renderNode,
-			Box:         layoutBox.Box,
+			Box:         dlb.translate(layoutBox.Box),
 			FillColor:   color.RGBA{R: 200, G: 200, B: 200, A: 255},
 			StrokeColor: color.RGBA{R: 150, G: 150, B: 150, A: 255},
 			StrokeWidth: 1.0,
@@ -292,7 +502,7 @@ func (dlb *DisplayListBuilder) addElementCommand(layoutBox *LayoutBox, renderNod
 				Type:     PaintImage,
 				NodeID:   layoutBox.NodeID,
 				Node:     renderNode,
-				Box:      layoutBox.Box,
+				Box:      dlb.translate(layoutBox.Box),
 				ImageSrc: src,
 				ImageAlt: alt,
 			}
@@ -329,7 +539,7 @@ func (dlb *DisplayListBuilder) extractText(node *RenderNode) string {
 }
 
 // addBorderCommand adds border paint commands for an element
-func (dlb *DisplayListBuilder) addBorderCommand(layoutBox *LayoutBox, renderNode *RenderNode, displayList *DisplayList) {
+func (dlb *DisplayListBuilder) addBorderCommand(layoutBox *LayoutBox, renderNode *RenderNode, radii CornerRadii, displayList *DisplayList) {
 	// Check if any border is present
 	hasBorder := false
 	
@@ -350,7 +560,7 @@ func (dlb *DisplayListBuilder) addBorderCommand(layoutBox *LayoutBox, renderNode
 		Type:   PaintBorder,
 		NodeID: layoutBox.NodeID,
 		Node:   renderNode,
-		Box:    layoutBox.Box,
+		Box:    dlb.translate(layoutBox.Box),
 		
 		BorderTopWidth:    layoutBox.BorderTopWidth,
 		BorderRightWidth:  layoutBox.BorderRightWidth,
@@ -366,7 +576,227 @@ func (dlb *DisplayListBuilder) addBorderCommand(layoutBox *LayoutBox, renderNode
 		BorderRightColor:  layoutBox.BorderRightColor,
 		BorderBottomColor: layoutBox.BorderBottomColor,
 		BorderLeftColor:   layoutBox.BorderLeftColor,
+		
+		Radii: radii,
 	}
 	
 	displayList.AddCommand(cmd)
 }
+
+// cornerRadii returns the resolved border-radius of an element's border box
+func (dlb *DisplayListBuilder) cornerRadii(layoutBox *LayoutBox, renderNode *RenderNode) CornerRadii {
+	if renderNode.Type != NodeTypeElement || renderNode.ComputedStyle == nil {
+		return CornerRadii{}
+	}
+	return resolveCornerRadii(renderNode.ComputedStyle, layoutBox.Box, dlb.styleFontSize(renderNode))
+}
+
+// styleFontSize returns the font size em lengths of a node's style refer to
+func (dlb *DisplayListBuilder) styleFontSize(renderNode *RenderNode) float32 {
+	if style := renderNode.ComputedStyle; style != nil && style.FontSize > 0 {
+		return style.FontSize
+	}
+	return dlb.defaultFontSize
+}
+
+// currentColor returns the inherited text color of a node
+func (dlb *DisplayListBuilder) currentColor(renderNode *RenderNode) color.Color {
+	for node := renderNode; node != nil; node = node.Parent {
+		if node.ComputedStyle != nil && node.ComputedStyle.Color != nil {
+			return node.ComputedStyle.Color
+		}
+	}
+	return color.Black
+}
+
+// addBackgroundCommands adds the background color and the background
+// layers of an element, from the bottom layer up
+func (dlb *DisplayListBuilder) addBackgroundCommands(layoutBox *LayoutBox, renderNode *RenderNode, radii CornerRadii, displayList *DisplayList) {
+	style := renderNode.ComputedStyle
+	if renderNode.Type != NodeTypeElement || style == nil || layoutBox.Box.Width <= 0 || layoutBox.Box.Height <= 0 {
+		return
+	}
+	layers := len(style.BackgroundImage)
+	
+	// The color is clipped like the bottom layer
+	if style.BackgroundColor != nil {
+		if _, _, _, a := style.BackgroundColor.RGBA(); a != 0 {
+			clip, clipRadii := dlb.backgroundBox(layoutBox, radii, backgroundValue(style.BackgroundClip, max(layers-1, 0), "border-box"))
+			displayList.AddCommand(&PaintCommand{
+				Type:      PaintRect,
+				NodeID:    layoutBox.NodeID,
+				Node:      renderNode,
+				Box:       dlb.translate(clip),
+				FillColor: style.BackgroundColor,
+				Radii:     clipRadii,
+			})
+		}
+	}
+	
+	fontSize := dlb.styleFontSize(renderNode)
+	for i := layers - 1; i >= 0; i-- {
+		value := style.BackgroundImage[i]
+		if value == "none" {
+			continue
+		}
+		cmd := &PaintCommand{
+			NodeID:          layoutBox.NodeID,
+			Node:            renderNode,
+			BackgroundIndex: i,
+		}
+		if src, ok := backgroundImageURL(value); ok {
+			cmd.Type = PaintBackgroundImage
+			cmd.ImageSrc = src
+		} else if gradient, ok := parseGradient(value, fontSize); ok {
+			cmd.Type = PaintGradient
+			cmd.Gradient = gradient
+		} else {
+			continue
+		}
+		
+		clip, clipRadii := dlb.backgroundBox(layoutBox, radii, backgroundValue(style.BackgroundClip, i, "border-box"))
+		area, _ := dlb.backgroundBox(layoutBox, radii, backgroundValue(style.BackgroundOrigin, i, "padding-box"))
+		area = dlb.translate(area)
+		if backgroundValue(style.BackgroundAttachment, i, "scroll") == "fixed" {
+			area = dlb.rootBox
+		}
+		
+		tiling := &BackgroundTiling{Area: area}
+		var ok bool
+		if tiling.Fit, tiling.Width, tiling.Height, ok = parseBackgroundSize(backgroundValue(style.BackgroundSize, i, "auto"), area, fontSize); !ok {
+			continue
+		}
+		if tiling.X, tiling.Y, ok = parsePosition(backgroundValue(style.BackgroundPosition, i, "0% 0%"), fontSize); !ok {
+			tiling.X, tiling.Y = LengthPercent{}, LengthPercent{}
+		}
+		tiling.RepeatX, tiling.RepeatY = parseBackgroundRepeat(backgroundValue(style.BackgroundRepeat, i, "repeat"))
+		
+		cmd.Box = dlb.translate(clip)
+		cmd.Radii = clipRadii
+		cmd.Tiling = tiling
+		displayList.AddCommand(cmd)
+	}
+}
+
+// backgroundBox returns the border, padding or content box of an element and
+// its rounded corners
+func (dlb *DisplayListBuilder) backgroundBox(layoutBox *LayoutBox, radii CornerRadii, box string) (Rect, CornerRadii) {
+	var top, right, bottom, left float32
+	switch box {
+	case "padding-box":
+		top, right, bottom, left = layoutBox.BorderTopWidth, layoutBox.BorderRightWidth, layoutBox.BorderBottomWidth, layoutBox.BorderLeftWidth
+	case "content-box":
+		top = layoutBox.BorderTopWidth + layoutBox.PaddingTop
+		right = layoutBox.BorderRightWidth + layoutBox.PaddingRight
+		bottom = layoutBox.BorderBottomWidth + layoutBox.PaddingBottom
+		left = layoutBox.BorderLeftWidth + layoutBox.PaddingLeft
+	default:
+		return layoutBox.Box, radii
+	}
+	b := layoutBox.Box
+	inner := Rect{X: b.X + left, Y: b.Y + top, Width: max(b.Width-left-right, 0), Height: max(b.Height-top-bottom, 0)}
+	return inner, radii.inset(top, right, bottom, left)
+}
+
+// addBoxShadowCommands adds the outer or the inset shadows of an element
+// The first shadow is painted on top, so shadows are added in reverse order.
+func (dlb *DisplayListBuilder) addBoxShadowCommands(layoutBox *LayoutBox, renderNode *RenderNode, radii CornerRadii, inset bool, displayList *DisplayList) {
+	style := renderNode.ComputedStyle
+	if renderNode.Type != NodeTypeElement || style == nil || len(style.BoxShadow) == 0 {
+		return
+	}
+	
+	box := layoutBox.Box
+	if inset {
+		// Inset shadows are painted inside the padding box
+		box = Rect{
+			X:      box.X + layoutBox.BorderLeftWidth,
+			Y:      box.Y + layoutBox.BorderTopWidth,
+			Width:  box.Width - layoutBox.BorderLeftWidth - layoutBox.BorderRightWidth,
+			Height: box.Height - layoutBox.BorderTopWidth - layoutBox.BorderBottomWidth,
+		}
+		radii = radii.inset(layoutBox.BorderTopWidth, layoutBox.BorderRightWidth, layoutBox.BorderBottomWidth, layoutBox.BorderLeftWidth)
+	}
+	if box.Width <= 0 || box.Height <= 0 {
+		return
+	}
+	
+	fontSize := dlb.styleFontSize(renderNode)
+	for i := len(style.BoxShadow) - 1; i >= 0; i-- {
+		shadow := style.BoxShadow[i]
+		if shadow.Inset != inset {
+			continue
+		}
+		shadowColor := shadow.Color
+		if shadowColor == nil {
+			shadowColor = dlb.currentColor(renderNode)
+		}
+		displayList.AddCommand(&PaintCommand{
+			Type:          PaintBoxShadow,
+			NodeID:        layoutBox.NodeID,
+			Node:          renderNode,
+			Box:           dlb.translate(box),
+			FillColor:     shadowColor,
+			Radii:         radii,
+			ShadowOffsetX: parseLength(shadow.OffsetX, fontSize),
+			ShadowOffsetY: parseLength(shadow.OffsetY, fontSize),
+			ShadowBlur:    max(parseLength(shadow.Blur, fontSize), 0),
+			ShadowSpread:  parseLength(shadow.Spread, fontSize),
+			ShadowInset:   inset,
+		})
+	}
+}
+
+// addOutlineCommand adds a border command for the outline of an element,
+// drawn outside the border box at the outline offset
+func (dlb *DisplayListBuilder) addOutlineCommand(layoutBox *LayoutBox, renderNode *RenderNode, radii CornerRadii, displayList *DisplayList) {
+	style := renderNode.ComputedStyle
+	if renderNode.Type != NodeTypeElement || style == nil {
+		return
+	}
+	outlineStyle := style.OutlineStyle
+	if outlineStyle == "" || outlineStyle == "none" || outlineStyle == "hidden" {
+		return
+	}
+	if outlineStyle == "auto" {
+		outlineStyle = "solid"
+	}
+	
+	fontSize := dlb.styleFontSize(renderNode)
+	width := float32(3) // medium
+	if style.OutlineWidth != "" {
+		width = parseLength(style.OutlineWidth, fontSize)
+	}
+	if width <= 0 {
+		return
+	}
+	outlineColor := style.OutlineColor
+	if outlineColor == nil {
+		outlineColor = dlb.currentColor(renderNode)
+	}
+	grow := parseLength(style.OutlineOffset, fontSize) + width
+	
+	displayList.AddCommand(&PaintCommand{
+		Type:   PaintBorder,
+		NodeID: layoutBox.NodeID,
+		Node:   renderNode,
+		Box:    dlb.translate(layoutBox.Box.outset(grow)),
+		
+		BorderTopWidth:    width,
+		BorderRightWidth:  width,
+		BorderBottomWidth: width,
+		BorderLeftWidth:   width,
+		
+		BorderTopStyle:    outlineStyle,
+		BorderRightStyle:  outlineStyle,
+		BorderBottomStyle: outlineStyle,
+		BorderLeftStyle:   outlineStyle,
+		
+		BorderTopColor:    outlineColor,
+		BorderRightColor:  outlineColor,
+		BorderBottomColor: outlineColor,
+		BorderLeftColor:   outlineColor,
+		
+		Radii: radii.outset(grow),
+	})
+}
@@ -0,0 +1,1040 @@
+package renderer
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+
+	"golang.org/x/image/math/f64"
+)
+
+// Display lists serialize to JSON for debugging and golden tests, and to a
+// compact binary form. Commands keep their NodeID but lose the Node pointer,
+// and colors decode as color.NRGBA.
+
+var paintCommandTypeNames = [...]string{
+	PaintText:            "text",
+	PaintRect:            "rect",
+	PaintImage:           "image",
+	PaintLink:            "link",
+	PaintBorder:          "border",
+	PaintPushClip:        "push-clip",
+	PaintPopClip:         "pop-clip",
+	PaintPushLayer:       "push-layer",
+	PaintPopLayer:        "pop-layer",
+	PaintBoxShadow:       "box-shadow",
+	PaintBackgroundImage: "background-image",
+	PaintGradient:        "gradient",
+}
+
+// String returns the name of the command type used by the JSON encoding
+func (t PaintCommandType) String() string {
+	if t >= 0 && int(t) < len(paintCommandTypeNames) {
+		return paintCommandTypeNames[t]
+	}
+	return fmt.Sprintf("PaintCommandType(%d)", int(t))
+}
+
+// parsePaintCommandType returns the command type with the given name
+func parsePaintCommandType(name string) (PaintCommandType, error) {
+	for t, typeName := range paintCommandTypeNames {
+		if typeName == name {
+			return PaintCommandType(t), nil
+		}
+	}
+	return 0, fmt.Errorf("display list: unknown command type %q", name)
+}
+
+var gradientKindNames = [...]string{
+	GradientLinear: "linear",
+	GradientRadial: "radial",
+	GradientConic:  "conic",
+}
+
+// String returns the name of the gradient kind used by the JSON encoding
+func (k GradientKind) String() string {
+	if k >= 0 && int(k) < len(gradientKindNames) {
+		return gradientKindNames[k]
+	}
+	return fmt.Sprintf("GradientKind(%d)", int(k))
+}
+
+// parseGradientKind returns the gradient kind with the given name
+func parseGradientKind(name string) (GradientKind, error) {
+	for k, kindName := range gradientKindNames {
+		if kindName == name {
+			return GradientKind(k), nil
+		}
+	}
+	return 0, fmt.Errorf("display list: unknown gradient kind %q", name)
+}
+
+var layerKindNames = [...]string{
+	LayerRoot:      "root",
+	LayerScroll:    "scroll",
+	LayerFixed:     "fixed",
+	LayerOpacity:   "opacity",
+	LayerTransform: "transform",
+}
+
+// String returns the name of the layer kind used by the JSON encoding
+func (k LayerKind) String() string {
+	if k >= 0 && int(k) < len(layerKindNames) {
+		return layerKindNames[k]
+	}
+	return fmt.Sprintf("LayerKind(%d)", int(k))
+}
+
+// parseLayerKind returns the layer kind with the given name
+func parseLayerKind(name string) (LayerKind, error) {
+	for k, kindName := range layerKindNames {
+		if kindName == name {
+			return LayerKind(k), nil
+		}
+	}
+	return 0, fmt.Errorf("display list: unknown layer kind %q", name)
+}
+
+// paintCommandJSON is the JSON form of a paint command
+type paintCommandJSON struct {
+	Type   string `json:"type"`
+	NodeID int64  `json:"node"`
+	Box    Rect   `json:"box"`
+
+	Text       string         `json:"text,omitempty"`
+	FontSize   float32        `json:"fontSize,omitempty"`
+	FontFamily string         `json:"fontFamily,omitempty"`
+	Bold       bool           `json:"bold,omitempty"`
+	Italic     bool           `json:"italic,omitempty"`
+	Fragments  []TextFragment `json:"fragments,omitempty"`
+
+	FillColor   *jsonColor `json:"fill,omitempty"`
+	StrokeColor *jsonColor `json:"stroke,omitempty"`
+	StrokeWidth float32    `json:"strokeWidth,omitempty"`
+
+	ImageSrc string `json:"src,omitempty"`
+	ImageAlt string `json:"alt,omitempty"`
+
+	LinkURL  string `json:"href,omitempty"`
+	LinkText string `json:"linkText,omitempty"`
+
+	BorderWidths *[4]float32    `json:"borderWidths,omitempty"` // Top, right, bottom, left
+	BorderColors *[4]*jsonColor `json:"borderColors,omitempty"`
+	BorderStyles *[4]string     `json:"borderStyles,omitempty"`
+
+	Scroll         *[4]float32 `json:"scroll,omitempty"` // X, Y, width, height
+	UserScrollable bool        `json:"userScrollable,omitempty"`
+
+	Layer     string    `json:"layer,omitempty"`
+	Opacity   float32   `json:"opacity,omitempty"`
+	Transform *f64.Aff3 `json:"transform,omitempty"` // Affine matrix, row major
+
+	Radii  *CornerRadii `json:"radii,omitempty"`
+	Shadow *shadowJSON  `json:"shadow,omitempty"`
+
+	Tiling          *BackgroundTiling `json:"tiling,omitempty"`
+	Gradient        *gradientJSON     `json:"gradient,omitempty"`
+	BackgroundIndex int               `json:"backgroundIndex,omitempty"`
+}
+
+// gradientJSON is the JSON form of a gradient
+type gradientJSON struct {
+	Kind      string             `json:"kind"`
+	Repeating bool               `json:"repeating,omitempty"`
+	Angle     float32            `json:"angle,omitempty"`
+	ToCorner  bool               `json:"toCorner,omitempty"`
+	CenterX   LengthPercent      `json:"centerX"`
+	CenterY   LengthPercent      `json:"centerY"`
+	Circle    bool               `json:"circle,omitempty"`
+	Extent    string             `json:"extent,omitempty"`
+	RadiusX   LengthPercent      `json:"radiusX"`
+	RadiusY   LengthPercent      `json:"radiusY"`
+	Stops     []gradientStopJSON `json:"stops"`
+}
+
+// gradientStopJSON is the JSON form of a gradient color stop
+type gradientStopJSON struct {
+	Color    *jsonColor    `json:"color"`
+	Position LengthPercent `json:"position"`
+	Auto     bool          `json:"auto,omitempty"`
+}
+
+// newGradientJSON returns the JSON form of a gradient, or nil for no gradient
+func newGradientJSON(g *Gradient) *gradientJSON {
+	if g == nil {
+		return nil
+	}
+	out := &gradientJSON{
+		Kind:      g.Kind.String(),
+		Repeating: g.Repeating,
+		Angle:     g.Angle,
+		ToCorner:  g.ToCorner,
+		CenterX:   g.CenterX,
+		CenterY:   g.CenterY,
+		Circle:    g.Circle,
+		Extent:    g.Extent,
+		RadiusX:   g.RadiusX,
+		RadiusY:   g.RadiusY,
+		Stops:     make([]gradientStopJSON, len(g.Stops)),
+	}
+	for i, stop := range g.Stops {
+		out.Stops[i] = gradientStopJSON{Color: newJSONColor(stop.Color), Position: stop.Position, Auto: stop.Auto}
+	}
+	return out
+}
+
+// gradient returns the decoded gradient
+func (in *gradientJSON) gradient() (*Gradient, error) {
+	kind, err := parseGradientKind(in.Kind)
+	if err != nil {
+		return nil, err
+	}
+	g := &Gradient{
+		Kind:      kind,
+		Repeating: in.Repeating,
+		Angle:     in.Angle,
+		ToCorner:  in.ToCorner,
+		CenterX:   in.CenterX,
+		CenterY:   in.CenterY,
+		Circle:    in.Circle,
+		Extent:    in.Extent,
+		RadiusX:   in.RadiusX,
+		RadiusY:   in.RadiusY,
+		Stops:     make([]GradientStop, len(in.Stops)),
+	}
+	for i, stop := range in.Stops {
+		if stop.Color == nil {
+			return nil, errors.New("display list: gradient stop without a color")
+		}
+		g.Stops[i] = GradientStop{Color: stop.Color.color(), Position: stop.Position, Auto: stop.Auto}
+	}
+	return g, nil
+}
+
+// shadowJSON is the JSON form of the shadow fields of a command
+type shadowJSON struct {
+	OffsetX float32 `json:"offsetX,omitempty"`
+	OffsetY float32 `json:"offsetY,omitempty"`
+	Blur    float32 `json:"blur,omitempty"`
+	Spread  float32 `json:"spread,omitempty"`
+	Inset   bool    `json:"inset,omitempty"`
+}
+
+// jsonColor is a color written as "#rrggbbaa"
+type jsonColor struct {
+	color.NRGBA
+}
+
+// newJSONColor returns the JSON form of a color, or nil for no color
+func newJSONColor(c color.Color) *jsonColor {
+	if c == nil {
+		return nil
+	}
+	return &jsonColor{color.NRGBAModel.Convert(c).(color.NRGBA)}
+}
+
+// color returns the decoded color, or nil for no color
+func (c *jsonColor) color() color.Color {
+	if c == nil {
+		return nil
+	}
+	return c.NRGBA
+}
+
+func (c jsonColor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A))
+}
+
+func (c *jsonColor) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	if _, err := fmt.Sscanf(text, "#%02x%02x%02x%02x", &c.R, &c.G, &c.B, &c.A); err != nil || len(text) != 9 {
+		return fmt.Errorf("display list: invalid color %q", text)
+	}
+	return nil
+}
+
+// MarshalJSON encodes a paint command, leaving out fields its type does not use
+func (cmd *PaintCommand) MarshalJSON() ([]byte, error) {
+	out := paintCommandJSON{
+		Type:            cmd.Type.String(),
+		NodeID:          cmd.NodeID,
+		Box:             cmd.Box,
+		Text:            cmd.Text,
+		FontSize:        cmd.FontSize,
+		FontFamily:      cmd.FontFamily,
+		Bold:            cmd.Bold,
+		Italic:          cmd.Italic,
+		Fragments:       cmd.Fragments,
+		FillColor:       newJSONColor(cmd.FillColor),
+		StrokeColor:     newJSONColor(cmd.StrokeColor),
+		StrokeWidth:     cmd.StrokeWidth,
+		ImageSrc:        cmd.ImageSrc,
+		ImageAlt:        cmd.ImageAlt,
+		LinkURL:         cmd.LinkURL,
+		LinkText:        cmd.LinkText,
+		UserScrollable:  cmd.UserScrollable,
+		Tiling:          cmd.Tiling,
+		Gradient:        newGradientJSON(cmd.Gradient),
+		BackgroundIndex: cmd.BackgroundIndex,
+	}
+	if cmd.Type == PaintPushLayer {
+		out.Layer = cmd.LayerKind.String()
+		out.Opacity = cmd.Opacity
+		out.Transform = cmd.Transform
+	}
+	if widths := cmd.borderWidths(); widths != [4]float32{} {
+		out.BorderWidths = &widths
+	}
+	if colors := cmd.borderColors(); colors != [4]color.Color{} {
+		out.BorderColors = &[4]*jsonColor{}
+		for i, c := range colors {
+			out.BorderColors[i] = newJSONColor(c)
+		}
+	}
+	if styles := cmd.borderStyles(); styles != [4]string{} {
+		out.BorderStyles = &styles
+	}
+	if scroll := cmd.scroll(); scroll != [4]float32{} {
+		out.Scroll = &scroll
+	}
+	if !cmd.Radii.IsZero() {
+		radii := cmd.Radii
+		out.Radii = &radii
+	}
+	if cmd.Type == PaintBoxShadow {
+		out.Shadow = &shadowJSON{
+			OffsetX: cmd.ShadowOffsetX,
+			OffsetY: cmd.ShadowOffsetY,
+			Blur:    cmd.ShadowBlur,
+			Spread:  cmd.ShadowSpread,
+			Inset:   cmd.ShadowInset,
+		}
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes a paint command
+func (cmd *PaintCommand) UnmarshalJSON(data []byte) error {
+	var in paintCommandJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	cmdType, err := parsePaintCommandType(in.Type)
+	if err != nil {
+		return err
+	}
+
+	*cmd = PaintCommand{
+		Type:            cmdType,
+		NodeID:          in.NodeID,
+		Box:             in.Box,
+		Text:            in.Text,
+		FontSize:        in.FontSize,
+		FontFamily:      in.FontFamily,
+		Bold:            in.Bold,
+		Italic:          in.Italic,
+		Fragments:       in.Fragments,
+		FillColor:       in.FillColor.color(),
+		StrokeColor:     in.StrokeColor.color(),
+		StrokeWidth:     in.StrokeWidth,
+		ImageSrc:        in.ImageSrc,
+		ImageAlt:        in.ImageAlt,
+		LinkURL:         in.LinkURL,
+		LinkText:        in.LinkText,
+		UserScrollable:  in.UserScrollable,
+		Tiling:          in.Tiling,
+		BackgroundIndex: in.BackgroundIndex,
+	}
+	if in.Gradient != nil {
+		if cmd.Gradient, err = in.Gradient.gradient(); err != nil {
+			return err
+		}
+	}
+	if in.BorderWidths != nil {
+		cmd.setBorderWidths(*in.BorderWidths)
+	}
+	if in.BorderColors != nil {
+		var colors [4]color.Color
+		for i, c := range in.BorderColors {
+			colors[i] = c.color()
+		}
+		cmd.setBorderColors(colors)
+	}
+	if in.BorderStyles != nil {
+		cmd.setBorderStyles(*in.BorderStyles)
+	}
+	if in.Scroll != nil {
+		cmd.setScroll(*in.Scroll)
+	}
+	if in.Layer != "" {
+		if cmd.LayerKind, err = parseLayerKind(in.Layer); err != nil {
+			return err
+		}
+		cmd.Opacity = in.Opacity
+		cmd.Transform = in.Transform
+	}
+	if in.Radii != nil {
+		cmd.Radii = *in.Radii
+	}
+	if in.Shadow != nil {
+		cmd.ShadowOffsetX = in.Shadow.OffsetX
+		cmd.ShadowOffsetY = in.Shadow.OffsetY
+		cmd.ShadowBlur = in.Shadow.Blur
+		cmd.ShadowSpread = in.Shadow.Spread
+		cmd.ShadowInset = in.Shadow.Inset
+	}
+	return nil
+}
+
+// displayListJSON is the JSON form of a display list
+type displayListJSON struct {
+	Commands []*PaintCommand `json:"commands"`
+}
+
+// MarshalJSON encodes the display list as an object holding its commands
+func (dl *DisplayList) MarshalJSON() ([]byte, error) {
+	commands := dl.Commands
+	if commands == nil {
+		commands = []*PaintCommand{}
+	}
+	return json.Marshal(displayListJSON{Commands: commands})
+}
+
+// UnmarshalJSON decodes a display list written by MarshalJSON
+func (dl *DisplayList) UnmarshalJSON(data []byte) error {
+	var in displayListJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	dl.Commands = make([]*PaintCommand, 0, len(in.Commands))
+	for _, cmd := range in.Commands {
+		if cmd == nil {
+			return errors.New("display list: null command")
+		}
+		dl.Commands = append(dl.Commands, cmd)
+	}
+	return nil
+}
+
+// Grouped fields, in top, right, bottom, left order for borders
+
+func (cmd *PaintCommand) borderWidths() [4]float32 {
+	return [4]float32{cmd.BorderTopWidth, cmd.BorderRightWidth, cmd.BorderBottomWidth, cmd.BorderLeftWidth}
+}
+
+func (cmd *PaintCommand) setBorderWidths(w [4]float32) {
+	cmd.BorderTopWidth, cmd.BorderRightWidth, cmd.BorderBottomWidth, cmd.BorderLeftWidth = w[0], w[1], w[2], w[3]
+}
+
+func (cmd *PaintCommand) borderColors() [4]color.Color {
+	return [4]color.Color{cmd.BorderTopColor, cmd.BorderRightColor, cmd.BorderBottomColor, cmd.BorderLeftColor}
+}
+
+func (cmd *PaintCommand) setBorderColors(c [4]color.Color) {
+	cmd.BorderTopColor, cmd.BorderRightColor, cmd.BorderBottomColor, cmd.BorderLeftColor = c[0], c[1], c[2], c[3]
+}
+
+func (cmd *PaintCommand) borderStyles() [4]string {
+	return [4]string{cmd.BorderTopStyle, cmd.BorderRightStyle, cmd.BorderBottomStyle, cmd.BorderLeftStyle}
+}
+
+func (cmd *PaintCommand) setBorderStyles(s [4]string) {
+	cmd.BorderTopStyle, cmd.BorderRightStyle, cmd.BorderBottomStyle, cmd.BorderLeftStyle = s[0], s[1], s[2], s[3]
+}
+
+func (cmd *PaintCommand) scroll() [4]float32 {
+	return [4]float32{cmd.ScrollX, cmd.ScrollY, cmd.ScrollWidth, cmd.ScrollHeight}
+}
+
+func (cmd *PaintCommand) setScroll(s [4]float32) {
+	cmd.ScrollX, cmd.ScrollY, cmd.ScrollWidth, cmd.ScrollHeight = s[0], s[1], s[2], s[3]
+}
+
+func (cmd *PaintCommand) shadow() [4]float32 {
+	return [4]float32{cmd.ShadowOffsetX, cmd.ShadowOffsetY, cmd.ShadowBlur, cmd.ShadowSpread}
+}
+
+func (cmd *PaintCommand) setShadow(s [4]float32) {
+	cmd.ShadowOffsetX, cmd.ShadowOffsetY, cmd.ShadowBlur, cmd.ShadowSpread = s[0], s[1], s[2], s[3]
+}
+
+// The binary form starts with a magic number and a version byte, followed by
+// the command count. Each command is its type, its node ID and a bit mask of
+// the fields that follow; numbers are varints or little-endian float32 and
+// strings are length prefixed.
+
+var displayListMagic = [3]byte{'G', 'D', 'L'}
+
+const displayListVersion = 1
+
+var errDisplayListTruncated = errors.New("display list: truncated data")
+
+// Fields present in a binary command
+const (
+	fieldBox = 1 << iota
+	fieldText
+	fieldFontSize
+	fieldFontFamily
+	fieldFlags
+	fieldFragments
+	fieldFillColor
+	fieldStrokeColor
+	fieldStrokeWidth
+	fieldImageSrc
+	fieldImageAlt
+	fieldLinkURL
+	fieldLinkText
+	fieldBorderWidths
+	fieldBorderColors
+	fieldBorderStyles
+	fieldScroll
+	fieldLayer
+	fieldRadii
+	fieldShadow
+	fieldTiling
+	fieldGradient
+	fieldBackgroundIndex
+	fieldTransform
+)
+
+// Bits of the flags byte of a binary gradient
+const (
+	gradientRepeating = 1 << iota
+	gradientToCorner
+	gradientCircle
+)
+
+// Bits of the fieldFlags byte
+const (
+	flagBold = 1 << iota
+	flagItalic
+	flagUserScrollable
+	flagShadowInset
+)
+
+// MarshalBinary encodes the display list in its compact binary form
+func (dl *DisplayList) MarshalBinary() ([]byte, error) {
+	w := &binaryWriter{}
+	w.buf = append(w.buf, displayListMagic[:]...)
+	w.buf = append(w.buf, displayListVersion)
+	w.uvarint(uint64(len(dl.Commands)))
+	for _, cmd := range dl.Commands {
+		w.command(cmd)
+	}
+	return w.buf, nil
+}
+
+// UnmarshalBinary decodes a display list written by MarshalBinary
+func (dl *DisplayList) UnmarshalBinary(data []byte) error {
+	if len(data) < len(displayListMagic)+1 || [3]byte(data[:3]) != displayListMagic {
+		return errors.New("display list: not a binary display list")
+	}
+	if data[3] != displayListVersion {
+		return fmt.Errorf("display list: unsupported version %d", data[3])
+	}
+
+	r := &binaryReader{buf: data[4:]}
+	count := r.uvarint()
+	// Every command takes at least three bytes
+	if count > uint64(len(r.buf)/3) {
+		return errDisplayListTruncated
+	}
+	commands := make([]*PaintCommand, 0, count)
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		commands = append(commands, r.command())
+	}
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.buf) > 0 {
+		return errors.New("display list: unexpected data after the last command")
+	}
+	dl.Commands = commands
+	return nil
+}
+
+// binaryWriter appends the binary form of display list values
+type binaryWriter struct {
+	buf []byte
+}
+
+func (w *binaryWriter) uvarint(v uint64) {
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *binaryWriter) float(f float32) {
+	w.buf = binary.LittleEndian.AppendUint32(w.buf, math.Float32bits(f))
+}
+
+func (w *binaryWriter) string(s string) {
+	w.uvarint(uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+func (w *binaryWriter) rect(r Rect) {
+	w.float(r.X)
+	w.float(r.Y)
+	w.float(r.Width)
+	w.float(r.Height)
+}
+
+func (w *binaryWriter) color(c color.Color) {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	w.buf = append(w.buf, n.R, n.G, n.B, n.A)
+}
+
+func (w *binaryWriter) command(cmd *PaintCommand) {
+	var flags byte
+	if cmd.Bold {
+		flags |= flagBold
+	}
+	if cmd.Italic {
+		flags |= flagItalic
+	}
+	if cmd.UserScrollable {
+		flags |= flagUserScrollable
+	}
+	if cmd.ShadowInset {
+		flags |= flagShadowInset
+	}
+	widths, colors, styles, scroll := cmd.borderWidths(), cmd.borderColors(), cmd.borderStyles(), cmd.scroll()
+	shadow := cmd.shadow()
+
+	var fields uint64
+	set := func(field uint64, present bool) {
+		if present {
+			fields |= field
+		}
+	}
+	set(fieldBox, cmd.Box != Rect{})
+	set(fieldText, cmd.Text != "")
+	set(fieldFontSize, cmd.FontSize != 0)
+	set(fieldFontFamily, cmd.FontFamily != "")
+	set(fieldFlags, flags != 0)
+	set(fieldFragments, len(cmd.Fragments) > 0)
+	set(fieldFillColor, cmd.FillColor != nil)
+	set(fieldStrokeColor, cmd.StrokeColor != nil)
+	set(fieldStrokeWidth, cmd.StrokeWidth != 0)
+	set(fieldImageSrc, cmd.ImageSrc != "")
+	set(fieldImageAlt, cmd.ImageAlt != "")
+	set(fieldLinkURL, cmd.LinkURL != "")
+	set(fieldLinkText, cmd.LinkText != "")
+	set(fieldBorderWidths, widths != [4]float32{})
+	set(fieldBorderColors, colors != [4]color.Color{})
+	set(fieldBorderStyles, styles != [4]string{})
+	set(fieldScroll, scroll != [4]float32{})
+	set(fieldLayer, cmd.LayerKind != LayerRoot || cmd.Opacity != 0)
+	set(fieldRadii, !cmd.Radii.IsZero())
+	set(fieldShadow, shadow != [4]float32{})
+	set(fieldTiling, cmd.Tiling != nil)
+	set(fieldGradient, cmd.Gradient != nil)
+	set(fieldBackgroundIndex, cmd.BackgroundIndex != 0)
+	set(fieldTransform, cmd.Transform != nil)
+
+	w.uvarint(uint64(cmd.Type))
+	w.buf = binary.AppendVarint(w.buf, cmd.NodeID)
+	w.uvarint(fields)
+
+	if fields&fieldBox != 0 {
+		w.rect(cmd.Box)
+	}
+	if fields&fieldText != 0 {
+		w.string(cmd.Text)
+	}
+	if fields&fieldFontSize != 0 {
+		w.float(cmd.FontSize)
+	}
+	if fields&fieldFontFamily != 0 {
+		w.string(cmd.FontFamily)
+	}
+	if fields&fieldFlags != 0 {
+		w.buf = append(w.buf, flags)
+	}
+	if fields&fieldFragments != 0 {
+		w.uvarint(uint64(len(cmd.Fragments)))
+		for _, fragment := range cmd.Fragments {
+			w.string(fragment.Text)
+			w.rect(fragment.Box)
+			w.float(fragment.Baseline)
+			w.uvarint(uint64(fragment.BidiLevel))
+		}
+	}
+	if fields&fieldFillColor != 0 {
+		w.color(cmd.FillColor)
+	}
+	if fields&fieldStrokeColor != 0 {
+		w.color(cmd.StrokeColor)
+	}
+	if fields&fieldStrokeWidth != 0 {
+		w.float(cmd.StrokeWidth)
+	}
+	if fields&fieldImageSrc != 0 {
+		w.string(cmd.ImageSrc)
+	}
+	if fields&fieldImageAlt != 0 {
+		w.string(cmd.ImageAlt)
+	}
+	if fields&fieldLinkURL != 0 {
+		w.string(cmd.LinkURL)
+	}
+	if fields&fieldLinkText != 0 {
+		w.string(cmd.LinkText)
+	}
+	if fields&fieldBorderWidths != 0 {
+		for _, width := range widths {
+			w.float(width)
+		}
+	}
+	if fields&fieldBorderColors != 0 {
+		// A mask of the sides with a color precedes the colors
+		var sides byte
+		for i, c := range colors {
+			if c != nil {
+				sides |= 1 << i
+			}
+		}
+		w.buf = append(w.buf, sides)
+		for _, c := range colors {
+			if c != nil {
+				w.color(c)
+			}
+		}
+	}
+	if fields&fieldBorderStyles != 0 {
+		for _, style := range styles {
+			w.string(style)
+		}
+	}
+	if fields&fieldScroll != 0 {
+		for _, v := range scroll {
+			w.float(v)
+		}
+	}
+	if fields&fieldLayer != 0 {
+		w.uvarint(uint64(cmd.LayerKind))
+		w.float(cmd.Opacity)
+	}
+	if fields&fieldRadii != 0 {
+		for _, radius := range cmd.Radii {
+			w.float(radius.X)
+			w.float(radius.Y)
+		}
+	}
+	if fields&fieldShadow != 0 {
+		for _, v := range shadow {
+			w.float(v)
+		}
+	}
+	if fields&fieldTiling != 0 {
+		t := cmd.Tiling
+		w.rect(t.Area)
+		w.string(t.Fit)
+		for _, v := range [6]float32{t.Width, t.Height, t.X.Pixels, t.X.Fraction, t.Y.Pixels, t.Y.Fraction} {
+			w.float(v)
+		}
+		w.string(t.RepeatX)
+		w.string(t.RepeatY)
+	}
+	if fields&fieldGradient != 0 {
+		w.gradient(cmd.Gradient)
+	}
+	if fields&fieldBackgroundIndex != 0 {
+		w.uvarint(uint64(cmd.BackgroundIndex))
+	}
+	if fields&fieldTransform != 0 {
+		for _, v := range cmd.Transform {
+			w.buf = binary.LittleEndian.AppendUint64(w.buf, math.Float64bits(v))
+		}
+	}
+}
+
+func (w *binaryWriter) gradient(g *Gradient) {
+	var flags byte
+	if g.Repeating {
+		flags |= gradientRepeating
+	}
+	if g.ToCorner {
+		flags |= gradientToCorner
+	}
+	if g.Circle {
+		flags |= gradientCircle
+	}
+	w.uvarint(uint64(g.Kind))
+	w.buf = append(w.buf, flags)
+	w.float(g.Angle)
+	for _, l := range [4]LengthPercent{g.CenterX, g.CenterY, g.RadiusX, g.RadiusY} {
+		w.float(l.Pixels)
+		w.float(l.Fraction)
+	}
+	w.string(g.Extent)
+	w.uvarint(uint64(len(g.Stops)))
+	for _, stop := range g.Stops {
+		w.color(stop.Color)
+		w.float(stop.Position.Pixels)
+		w.float(stop.Position.Fraction)
+		var auto byte
+		if stop.Auto {
+			auto = 1
+		}
+		w.buf = append(w.buf, auto)
+	}
+}
+
+// binaryReader decodes display list values, keeping the first error
+type binaryReader struct {
+	buf []byte
+	err error
+}
+
+func (r *binaryReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+	r.buf = nil
+}
+
+func (r *binaryReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.buf) {
+		r.fail(errDisplayListTruncated)
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *binaryReader) byte() byte {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.fail(errDisplayListTruncated)
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *binaryReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.fail(errDisplayListTruncated)
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *binaryReader) float() float32 {
+	if b := r.bytes(4); b != nil {
+		return math.Float32frombits(binary.LittleEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (r *binaryReader) string() string {
+	n := r.uvarint()
+	if n > uint64(len(r.buf)) {
+		r.fail(errDisplayListTruncated)
+		return ""
+	}
+	return string(r.bytes(int(n)))
+}
+
+func (r *binaryReader) rect() Rect {
+	return Rect{X: r.float(), Y: r.float(), Width: r.float(), Height: r.float()}
+}
+
+func (r *binaryReader) color() color.Color {
+	b := r.bytes(4)
+	if b == nil {
+		return nil
+	}
+	return color.NRGBA{R: b[0], G: b[1], B: b[2], A: b[3]}
+}
+
+func (r *binaryReader) lengthPercent() LengthPercent {
+	return LengthPercent{Pixels: r.float(), Fraction: r.float()}
+}
+
+func (r *binaryReader) gradient() *Gradient {
+	g := &Gradient{}
+	kind := r.uvarint()
+	if kind >= uint64(len(gradientKindNames)) {
+		r.fail(fmt.Errorf("display list: unknown gradient kind %d", kind))
+		return g
+	}
+	g.Kind = GradientKind(kind)
+	flags := r.byte()
+	g.Repeating = flags&gradientRepeating != 0
+	g.ToCorner = flags&gradientToCorner != 0
+	g.Circle = flags&gradientCircle != 0
+	g.Angle = r.float()
+	g.CenterX, g.CenterY = r.lengthPercent(), r.lengthPercent()
+	g.RadiusX, g.RadiusY = r.lengthPercent(), r.lengthPercent()
+	g.Extent = r.string()
+	n := r.uvarint()
+	// Every stop takes thirteen bytes
+	if n > uint64(len(r.buf)/13) {
+		r.fail(errDisplayListTruncated)
+		return g
+	}
+	g.Stops = make([]GradientStop, 0, n)
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		g.Stops = append(g.Stops, GradientStop{Color: r.color(), Position: r.lengthPercent(), Auto: r.byte() != 0})
+	}
+	return g
+}
+
+func (r *binaryReader) command() *PaintCommand {
+	cmd := &PaintCommand{}
+	cmdType := r.uvarint()
+	if cmdType >= uint64(len(paintCommandTypeNames)) {
+		r.fail(fmt.Errorf("display list: unknown command type %d", cmdType))
+		return cmd
+	}
+	cmd.Type = PaintCommandType(cmdType)
+	cmd.NodeID = r.varint()
+	fields := r.uvarint()
+
+	if fields&fieldBox != 0 {
+		cmd.Box = r.rect()
+	}
+	if fields&fieldText != 0 {
+		cmd.Text = r.string()
+	}
+	if fields&fieldFontSize != 0 {
+		cmd.FontSize = r.float()
+	}
+	if fields&fieldFontFamily != 0 {
+		cmd.FontFamily = r.string()
+	}
+	if fields&fieldFlags != 0 {
+		flags := r.byte()
+		cmd.Bold = flags&flagBold != 0
+		cmd.Italic = flags&flagItalic != 0
+		cmd.UserScrollable = flags&flagUserScrollable != 0
+		cmd.ShadowInset = flags&flagShadowInset != 0
+	}
+	if fields&fieldFragments != 0 {
+		n := r.uvarint()
+		if n > uint64(len(r.buf)) {
+			r.fail(errDisplayListTruncated)
+			return cmd
+		}
+		cmd.Fragments = make([]TextFragment, 0, n)
+		for i := uint64(0); i < n && r.err == nil; i++ {
+			cmd.Fragments = append(cmd.Fragments, TextFragment{
+				Text:      r.string(),
+				Box:       r.rect(),
+				Baseline:  r.float(),
+				BidiLevel: int(r.uvarint()),
+			})
+		}
+	}
+	if fields&fieldFillColor != 0 {
+		cmd.FillColor = r.color()
+	}
+	if fields&fieldStrokeColor != 0 {
+		cmd.StrokeColor = r.color()
+	}
+	if fields&fieldStrokeWidth != 0 {
+		cmd.StrokeWidth = r.float()
+	}
+	if fields&fieldImageSrc != 0 {
+		cmd.ImageSrc = r.string()
+	}
+	if fields&fieldImageAlt != 0 {
+		cmd.ImageAlt = r.string()
+	}
+	if fields&fieldLinkURL != 0 {
+		cmd.LinkURL = r.string()
+	}
+	if fields&fieldLinkText != 0 {
+		cmd.LinkText = r.string()
+	}
+	if fields&fieldBorderWidths != 0 {
+		cmd.setBorderWidths([4]float32{r.float(), r.float(), r.float(), r.float()})
+	}
+	if fields&fieldBorderColors != 0 {
+		sides := r.byte()
+		var colors [4]color.Color
+		for i := range colors {
+			if sides&(1<<i) != 0 {
+				colors[i] = r.color()
+			}
+		}
+		cmd.setBorderColors(colors)
+	}
+	if fields&fieldBorderStyles != 0 {
+		cmd.setBorderStyles([4]string{r.string(), r.string(), r.string(), r.string()})
+	}
+	if fields&fieldScroll != 0 {
+		cmd.setScroll([4]float32{r.float(), r.float(), r.float(), r.float()})
+	}
+	if fields&fieldLayer != 0 {
+		kind := r.uvarint()
+		if kind >= uint64(len(layerKindNames)) {
+			r.fail(fmt.Errorf("display list: unknown layer kind %d", kind))
+		}
+		cmd.LayerKind = LayerKind(kind)
+		cmd.Opacity = r.float()
+	}
+	if fields&fieldRadii != 0 {
+		for i := range cmd.Radii {
+			cmd.Radii[i] = CornerRadius{X: r.float(), Y: r.float()}
+		}
+	}
+	if fields&fieldShadow != 0 {
+		cmd.setShadow([4]float32{r.float(), r.float(), r.float(), r.float()})
+	}
+	if fields&fieldTiling != 0 {
+		cmd.Tiling = &BackgroundTiling{
+			Area:   r.rect(),
+			Fit:    r.string(),
+			Width:  r.float(),
+			Height: r.float(),
+			X:      r.lengthPercent(),
+			Y:      r.lengthPercent(),
+		}
+		cmd.Tiling.RepeatX, cmd.Tiling.RepeatY = r.string(), r.string()
+	}
+	if fields&fieldGradient != 0 {
+		cmd.Gradient = r.gradient()
+	}
+	if fields&fieldBackgroundIndex != 0 {
+		cmd.BackgroundIndex = int(r.uvarint())
+	}
+	if fields&fieldTransform != 0 {
+		cmd.Transform = &f64.Aff3{}
+		for i := range cmd.Transform {
+			if b := r.bytes(8); b != nil {
+				cmd.Transform[i] = math.Float64frombits(binary.LittleEndian.Uint64(b))
+			}
+		}
+	}
+	if fields >= fieldTransform<<1 {
+		r.fail(fmt.Errorf("display list: unknown fields %#x", fields))
+	}
+	return cmd
+}
@@ -0,0 +1,214 @@
+package renderer
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/math/f64"
+)
+
+var updateDisplayLists = flag.Bool("displaylist.update", false, "rewrite the golden display lists in testdata/display_lists")
+
+// codecTestList returns a display list using every field of the encodings
+func codecTestList() *DisplayList {
+	dl := NewDisplayList()
+	dl.AddCommand(&PaintCommand{
+		Type:       PaintText,
+		NodeID:     7,
+		Box:        Rect{X: 1, Y: 2, Width: 30.5, Height: 18},
+		Text:       "héllo world",
+		FontSize:   14,
+		FontFamily: `"Open Sans", serif`,
+		Bold:       true,
+		Italic:     true,
+		Fragments: []TextFragment{
+			{Text: "héllo", Box: Rect{X: 1, Y: 2, Width: 12, Height: 18}, Baseline: 14},
+			{Text: "world", Box: Rect{X: 1, Y: 20, Width: 15, Height: 18}, Baseline: 14, BidiLevel: 1},
+		},
+	})
+	dl.AddCommand(&PaintCommand{Type: PaintRect, NodeID: 8, Box: Rect{Width: 10, Height: 10},
+		FillColor: color.RGBA{R: 255, A: 255}, StrokeColor: color.NRGBA{B: 255, A: 128}, StrokeWidth: 1.5})
+	dl.AddCommand(&PaintCommand{Type: PaintImage, NodeID: 9, ImageSrc: "cat.png", ImageAlt: "A cat"})
+	dl.AddCommand(&PaintCommand{Type: PaintLink, NodeID: -1, LinkURL: "https://example.com/", LinkText: "Example"})
+	dl.AddCommand(&PaintCommand{
+		Type:             PaintBorder,
+		NodeID:           10,
+		Box:              Rect{X: 5, Y: 5, Width: 100, Height: 50},
+		BorderTopWidth:   1,
+		BorderLeftWidth:  3,
+		BorderTopColor:   color.RGBA{G: 128, A: 255},
+		BorderLeftColor:  color.Black,
+		BorderTopStyle:   "solid",
+		BorderLeftStyle:  "dashed",
+		BorderRightStyle: "none",
+		Radii:            CornerRadii{{X: 4, Y: 4}, {X: 8, Y: 2}, {}, {X: 1, Y: 1}},
+	})
+	dl.AddCommand(&PaintCommand{Type: PaintBoxShadow, NodeID: 10, Box: Rect{X: 5, Y: 5, Width: 100, Height: 50},
+		FillColor: color.NRGBA{A: 64}, ShadowOffsetX: 2, ShadowOffsetY: -3, ShadowBlur: 6, ShadowSpread: 1, ShadowInset: true})
+	dl.AddCommand(&PaintCommand{Type: PaintBackgroundImage, NodeID: 10, Box: Rect{X: 5, Y: 5, Width: 100, Height: 50},
+		ImageSrc: "tile.png", BackgroundIndex: 1, Tiling: &BackgroundTiling{Area: Rect{X: 6, Y: 6, Width: 98, Height: 48},
+			Width: 20, X: LengthPercent{Pixels: -4, Fraction: 1}, Y: LengthPercent{Fraction: 0.5}, RepeatX: "space", RepeatY: "no-repeat"}})
+	dl.AddCommand(&PaintCommand{Type: PaintGradient, NodeID: 10, Box: Rect{X: 5, Y: 5, Width: 100, Height: 50},
+		Tiling: &BackgroundTiling{Area: Rect{X: 5, Y: 5, Width: 100, Height: 50}, Fit: "cover", RepeatX: "repeat", RepeatY: "repeat"},
+		Gradient: &Gradient{Kind: GradientRadial, Repeating: true, Circle: true, Extent: "closest-side",
+			CenterX: LengthPercent{Fraction: 0.25}, CenterY: LengthPercent{Pixels: 10},
+			Stops: []GradientStop{{Color: color.White, Auto: true}, {Color: color.NRGBA{R: 10, A: 200}, Position: LengthPercent{Pixels: 5}}}}})
+	dl.AddCommand(&PaintCommand{Type: PaintPushClip, NodeID: 11, Box: Rect{Width: 50, Height: 40},
+		ScrollY: 12, ScrollWidth: 50, ScrollHeight: 200, UserScrollable: true})
+	dl.AddCommand(&PaintCommand{Type: PaintPopClip, NodeID: 11})
+	dl.AddCommand(&PaintCommand{Type: PaintPushLayer, NodeID: 12, Box: Rect{Width: 50, Height: 20}, LayerKind: LayerOpacity, Opacity: 0.5})
+	dl.AddCommand(&PaintCommand{Type: PaintPopLayer, NodeID: 12})
+	dl.AddCommand(&PaintCommand{Type: PaintPushLayer, NodeID: 13, Box: Rect{Width: 50, Height: 20}, LayerKind: LayerTransform,
+		Opacity: 1, Transform: &f64.Aff3{0.5, -0.25, 10, 0.25, 0.5, -3.125}})
+	dl.AddCommand(&PaintCommand{Type: PaintPopLayer, NodeID: 13})
+	return dl
+}
+
+// assertSameCommands fails unless two display lists paint the same
+func assertSameCommands(t *testing.T, expected, actual *DisplayList) {
+	t.Helper()
+	if len(actual.Commands) != len(expected.Commands) {
+		t.Fatalf("Expected %d commands, got %d", len(expected.Commands), len(actual.Commands))
+	}
+	for i, cmd := range expected.Commands {
+		if !cmd.Equal(actual.Commands[i]) {
+			t.Errorf("Command %d differs:\nexpected %+v\ngot      %+v", i, cmd, actual.Commands[i])
+		}
+	}
+}
+
+func TestDisplayListJSONRoundTrip(t *testing.T) {
+	dl := codecTestList()
+	data, err := json.Marshal(dl)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	for _, expected := range []string{`"type":"text"`, `"fill":"#ff0000ff"`, `"stroke":"#0000ff80"`, `"borderStyles":["solid","none","","dashed"]`, `"layer":"opacity"`, `"type":"box-shadow"`, `"inset":true`, `"kind":"radial"`, `"repeatX":"space"`} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("Expected %s in %s", expected, data)
+		}
+	}
+	if strings.Contains(string(data), "Node") {
+		t.Error("Expected the render node not to be serialized")
+	}
+
+	decoded := &DisplayList{}
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSameCommands(t, dl, decoded)
+
+	for _, invalid := range []string{`{"commands":[{"type":"circle"}]}`, `{"commands":[{"type":"push-layer","layer":"sphere"}]}`, `{"commands":[null]}`, `{"commands":[{"type":"rect","fill":"red"}]}`} {
+		if err := json.Unmarshal([]byte(invalid), &DisplayList{}); err == nil {
+			t.Errorf("Expected an error decoding %s", invalid)
+		}
+	}
+}
+
+func TestDisplayListBinaryRoundTrip(t *testing.T) {
+	dl := codecTestList()
+	data, err := dl.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	jsonData, _ := json.Marshal(dl)
+	if len(data) >= len(jsonData)/2 {
+		t.Errorf("Expected the binary form to be compact, got %d bytes for %d bytes of JSON", len(data), len(jsonData))
+	}
+
+	decoded := &DisplayList{}
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	assertSameCommands(t, dl, decoded)
+
+	empty, _ := NewDisplayList().MarshalBinary()
+	if err := decoded.UnmarshalBinary(empty); err != nil || len(decoded.Commands) != 0 {
+		t.Errorf("Expected an empty list, got %d commands and %v", len(decoded.Commands), err)
+	}
+
+	// Every truncation of the data is an error
+	for n := 0; n < len(data); n++ {
+		if err := (&DisplayList{}).UnmarshalBinary(data[:n]); err == nil {
+			t.Fatalf("Expected an error for data truncated to %d bytes", n)
+		}
+	}
+	if err := (&DisplayList{}).UnmarshalBinary(append(data, 0)); err == nil {
+		t.Error("Expected an error for trailing data")
+	}
+	version := bytes.Clone(data)
+	version[3] = 99
+	if err := (&DisplayList{}).UnmarshalBinary(version); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Errorf("Expected an unsupported version error, got %v", err)
+	}
+}
+
+// normalizeNodeIDs renumbers the node IDs of a display list in order of first
+// use, as IDs depend on the nodes created before
+func normalizeNodeIDs(dl *DisplayList) {
+	ids := make(map[int64]int64)
+	for _, cmd := range dl.Commands {
+		id, ok := ids[cmd.NodeID]
+		if !ok {
+			id = int64(len(ids) + 1)
+			ids[cmd.NodeID] = id
+		}
+		cmd.NodeID = id
+	}
+}
+
+func TestDisplayListGolden(t *testing.T) {
+	paths, err := filepath.Glob("testdata/display_lists/*.html")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("Expected pages in testdata/display_lists: %v", err)
+	}
+
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".html")
+		t.Run(name, func(t *testing.T) {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read %s: %v", path, err)
+			}
+			r := NewRenderer(800, 600)
+			if _, err := r.LayoutHTML(string(content)); err != nil {
+				t.Fatalf("Failed to lay out %s: %v", path, err)
+			}
+			dl := r.DisplayList()
+			normalizeNodeIDs(dl)
+			actual, err := json.MarshalIndent(dl, "", "  ")
+			if err != nil {
+				t.Fatalf("Failed to encode: %v", err)
+			}
+			actual = append(actual, '\n')
+
+			golden := strings.TrimSuffix(path, ".html") + ".json"
+			if *updateDisplayLists {
+				if err := os.WriteFile(golden, actual, 0o644); err != nil {
+					t.Fatalf("Failed to write %s: %v", golden, err)
+				}
+				return
+			}
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("Failed to read %s (run with -displaylist.update to create it): %v", golden, err)
+			}
+			if !bytes.Equal(expected, actual) {
+				t.Errorf("Display list of %s differs from %s (run with -displaylist.update to accept):\n%s", path, golden, actual)
+			}
+
+			// The golden file decodes to the same commands
+			decoded := &DisplayList{}
+			if err := json.Unmarshal(expected, decoded); err != nil {
+				t.Fatalf("Failed to decode %s: %v", golden, err)
+			}
+			assertSameCommands(t, dl, decoded)
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package renderer
+
+import (
+	"image/color"
+	"slices"
+
+	"golang.org/x/image/math/f64"
+)
+
+// DisplayListDiff holds the differences between two builds of a display list
+// Commands are matched by node, type and order among the commands of their
+// node, so a repaint can keep whatever was drawn for unchanged commands.
+type DisplayListDiff struct {
+	Added     []*PaintCommand      // Commands of the new list without a match in the old one
+	Removed   []*PaintCommand      // Commands of the old list without a match in the new one
+	Changed   []PaintCommandChange // Matched commands that paint differently
+	Unchanged []PaintCommandChange // Matched commands that paint the same
+}
+
+// PaintCommandChange pairs a command of the old list with its match in the new one
+type PaintCommandChange struct {
+	Old *PaintCommand
+	New *PaintCommand
+}
+
+// Empty reports whether the two lists paint the same
+func (d *DisplayListDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// paintCommandKey identifies a command across builds of a display list
+type paintCommandKey struct {
+	nodeID int64
+	typ    PaintCommandType
+	index  int // Position among the commands of the same node and type
+}
+
+// DiffDisplayLists compares a display list with the one it replaces
+// With a tracker, only commands of dirty nodes are compared field by field;
+// commands of clean nodes count as changed only when they moved, as layout
+// changes elsewhere shift them without marking them dirty. A nil tracker
+// compares every command. Commands painted in a different order relative to
+// the other matched commands also count as changed, so that the areas they
+// cover are repainted in the new order.
+func DiffDisplayLists(prev, next *DisplayList, dirty *InvalidationTracker) *DisplayListDiff {
+	diff := &DisplayListDiff{}
+
+	old := make(map[paintCommandKey]*PaintCommand)
+	position := make(map[*PaintCommand]int)
+	matched := make(map[*PaintCommand]bool)
+	if prev != nil {
+		counts := make(map[paintCommandKey]int)
+		for i, cmd := range prev.Commands {
+			old[commandKey(cmd, counts)] = cmd
+			position[cmd] = i
+		}
+	}
+
+	pairs := make([]PaintCommandChange, 0)
+	same := make([]bool, 0)
+	if next != nil {
+		counts := make(map[paintCommandKey]int)
+		for _, cmd := range next.Commands {
+			key := commandKey(cmd, counts)
+			match, ok := old[key]
+			if !ok {
+				diff.Added = append(diff.Added, cmd)
+				continue
+			}
+			delete(old, key)
+			matched[match] = true
+
+			pairs = append(pairs, PaintCommandChange{Old: match, New: cmd})
+			if dirty == nil || dirty.IsDirty(cmd.NodeID) {
+				same = append(same, match.Equal(cmd))
+			} else {
+				same = append(same, sameGeometry(match, cmd))
+			}
+		}
+	}
+
+	// Commands outside the longest run kept in the old order were reordered
+	positions := make([]int, len(pairs))
+	for i, pair := range pairs {
+		positions[i] = position[pair.Old]
+	}
+	inOrder := longestIncreasing(positions)
+	for i, pair := range pairs {
+		if same[i] && inOrder[i] {
+			diff.Unchanged = append(diff.Unchanged, pair)
+		} else {
+			diff.Changed = append(diff.Changed, pair)
+		}
+	}
+
+	// Removed commands are reported in their order in the old list
+	if prev != nil {
+		for _, cmd := range prev.Commands {
+			if !matched[cmd] {
+				diff.Removed = append(diff.Removed, cmd)
+			}
+		}
+	}
+
+	return diff
+}
+
+// longestIncreasing marks the values of a longest increasing subsequence
+func longestIncreasing(values []int) []bool {
+	// tails[k] is the index of the smallest value ending an increasing
+	// subsequence of length k+1; prev links each value to its predecessor
+	tails := make([]int, 0)
+	prev := make([]int, len(values))
+	for i, value := range values {
+		k, _ := slices.BinarySearchFunc(tails, value, func(j, target int) int { return values[j] - target })
+		prev[i] = -1
+		if k > 0 {
+			prev[i] = tails[k-1]
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+
+	in := make([]bool, len(values))
+	if len(tails) > 0 {
+		for i := tails[len(tails)-1]; i >= 0; i = prev[i] {
+			in[i] = true
+		}
+	}
+	return in
+}
+
+// commandKey returns the key of the next command of a list, counting the
+// commands seen so far per node and type
+func commandKey(cmd *PaintCommand, counts map[paintCommandKey]int) paintCommandKey {
+	key := paintCommandKey{nodeID: cmd.NodeID, typ: cmd.Type}
+	index := counts[key]
+	counts[key] = index + 1
+	key.index = index
+	return key
+}
+
+// Equal reports whether two commands paint the same
+// The Node pointer is not compared, so a command equals its serialized copy.
+func (cmd *PaintCommand) Equal(other *PaintCommand) bool {
+	if cmd == nil || other == nil {
+		return cmd == other
+	}
+	return cmd.Type == other.Type &&
+		cmd.NodeID == other.NodeID &&
+		cmd.Box == other.Box &&
+		cmd.Text == other.Text &&
+		cmd.FontSize == other.FontSize &&
+		cmd.FontFamily == other.FontFamily &&
+		cmd.Bold == other.Bold &&
+		cmd.Italic == other.Italic &&
+		slices.Equal(cmd.Fragments, other.Fragments) &&
+		colorsEqual(cmd.FillColor, other.FillColor) &&
+		colorsEqual(cmd.StrokeColor, other.StrokeColor) &&
+		cmd.StrokeWidth == other.StrokeWidth &&
+		cmd.ImageSrc == other.ImageSrc &&
+		cmd.ImageAlt == other.ImageAlt &&
+		cmd.LinkURL == other.LinkURL &&
+		cmd.LinkText == other.LinkText &&
+		cmd.borderWidths() == other.borderWidths() &&
+		colorsEqual(cmd.BorderTopColor, other.BorderTopColor) &&
+		colorsEqual(cmd.BorderRightColor, other.BorderRightColor) &&
+		colorsEqual(cmd.BorderBottomColor, other.BorderBottomColor) &&
+		colorsEqual(cmd.BorderLeftColor, other.BorderLeftColor) &&
+		cmd.borderStyles() == other.borderStyles() &&
+		cmd.scroll() == other.scroll() &&
+		cmd.UserScrollable == other.UserScrollable &&
+		cmd.LayerKind == other.LayerKind &&
+		cmd.Opacity == other.Opacity &&
+		transformsEqual(cmd.Transform, other.Transform) &&
+		cmd.Radii == other.Radii &&
+		cmd.shadow() == other.shadow() &&
+		cmd.ShadowInset == other.ShadowInset &&
+		tilingsEqual(cmd.Tiling, other.Tiling) &&
+		gradientsEqual(cmd.Gradient, other.Gradient) &&
+		cmd.BackgroundIndex == other.BackgroundIndex
+}
+
+// transformsEqual reports whether two optional layer transforms are equal
+func transformsEqual(a, b *f64.Aff3) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// tilingsEqual reports whether two optional background tilings are equal
+func tilingsEqual(a, b *BackgroundTiling) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// gradientsEqual reports whether two optional gradients are equal
+func gradientsEqual(a, b *Gradient) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Kind == b.Kind && a.Repeating == b.Repeating &&
+		a.Angle == b.Angle && a.ToCorner == b.ToCorner &&
+		a.CenterX == b.CenterX && a.CenterY == b.CenterY &&
+		a.Circle == b.Circle && a.Extent == b.Extent &&
+		a.RadiusX == b.RadiusX && a.RadiusY == b.RadiusY &&
+		slices.EqualFunc(a.Stops, b.Stops, func(x, y GradientStop) bool {
+			return colorsEqual(x.Color, y.Color) && x.Position == y.Position && x.Auto == y.Auto
+		})
+}
+
+// sameGeometry reports whether two commands cover the same area
+func sameGeometry(a, b *PaintCommand) bool {
+	if a.Box != b.Box || len(a.Fragments) != len(b.Fragments) || a.scroll() != b.scroll() ||
+		a.shadow() != b.shadow() {
+		return false
+	}
+	for i := range a.Fragments {
+		if a.Fragments[i].Box != b.Fragments[i].Box {
+			return false
+		}
+	}
+	return true
+}
+
+// colorsEqual reports whether two colors are equal, comparing their RGBA values
+// so that colors of different models match
+func colorsEqual(a, b color.Color) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	r1, g1, b1, a1 := a.RGBA()
+	r2, g2, b2, a2 := b.RGBA()
+	return r1 == r2 && g1 == g2 && b1 == b2 && a1 == a2
+}
@@ -0,0 +1,163 @@
+package renderer
+
+import (
+	"image/color"
+	"testing"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/test"
+)
+
+func TestDiffDisplayLists(t *testing.T) {
+	prev := NewDisplayList()
+	prev.AddCommand(&PaintCommand{Type: PaintText, NodeID: 1, Text: "Title", Box: Rect{Width: 100, Height: 20}})
+	prev.AddCommand(&PaintCommand{Type: PaintBorder, NodeID: 2, Box: Rect{Y: 20, Width: 100, Height: 40}, BorderTopWidth: 1, BorderTopColor: color.Black})
+	prev.AddCommand(&PaintCommand{Type: PaintText, NodeID: 3, Text: "Body", Box: Rect{Y: 60, Width: 100, Height: 20}})
+	prev.AddCommand(&PaintCommand{Type: PaintImage, NodeID: 4, ImageSrc: "a.png", Box: Rect{Y: 80, Width: 10, Height: 10}})
+
+	next := NewDisplayList()
+	next.AddCommand(&PaintCommand{Type: PaintText, NodeID: 1, Text: "Title", Box: Rect{Width: 100, Height: 20}})
+	next.AddCommand(&PaintCommand{Type: PaintBorder, NodeID: 2, Box: Rect{Y: 20, Width: 100, Height: 40}, BorderTopWidth: 1, BorderTopColor: color.NRGBA{A: 255}})
+	next.AddCommand(&PaintCommand{Type: PaintText, NodeID: 3, Text: "New body", Box: Rect{Y: 60, Width: 100, Height: 20}})
+	next.AddCommand(&PaintCommand{Type: PaintLink, NodeID: 5, LinkURL: "/next", Box: Rect{Y: 80, Width: 10, Height: 10}})
+
+	diff := DiffDisplayLists(prev, next, nil)
+	if len(diff.Unchanged) != 2 || diff.Unchanged[1].New != next.Commands[1] {
+		t.Errorf("Expected the title and the border (same color in another model) unchanged, got %d", len(diff.Unchanged))
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].Old != prev.Commands[2] || diff.Changed[0].New != next.Commands[2] {
+		t.Errorf("Expected the body text to change, got %+v", diff.Changed)
+	}
+	if len(diff.Added) != 1 || diff.Added[0] != next.Commands[3] {
+		t.Errorf("Expected the link to be added, got %+v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0] != prev.Commands[3] {
+		t.Errorf("Expected the image to be removed, got %+v", diff.Removed)
+	}
+	if diff.Empty() {
+		t.Error("Expected a non-empty diff")
+	}
+
+	if same := DiffDisplayLists(prev, prev, nil); !same.Empty() || len(same.Unchanged) != len(prev.Commands) {
+		t.Error("Expected a list to equal itself")
+	}
+	if all := DiffDisplayLists(nil, next, nil); len(all.Added) != len(next.Commands) {
+		t.Error("Expected every command to be added to an empty list")
+	}
+}
+
+func TestDiffDisplayListsMatchesRepeatedCommands(t *testing.T) {
+	prev := NewDisplayList()
+	prev.AddCommand(&PaintCommand{Type: PaintText, NodeID: 1, Text: "a"})
+	prev.AddCommand(&PaintCommand{Type: PaintText, NodeID: 1, Text: "b"})
+
+	next := NewDisplayList()
+	next.AddCommand(&PaintCommand{Type: PaintText, NodeID: 1, Text: "a"})
+	next.AddCommand(&PaintCommand{Type: PaintText, NodeID: 1, Text: "b"})
+	next.AddCommand(&PaintCommand{Type: PaintText, NodeID: 1, Text: "c"})
+
+	diff := DiffDisplayLists(prev, next, nil)
+	if len(diff.Unchanged) != 2 || len(diff.Added) != 1 || diff.Added[0].Text != "c" {
+		t.Errorf("Expected commands of a node to match in order, got %d unchanged and %+v added", len(diff.Unchanged), diff.Added)
+	}
+}
+
+func TestDiffDisplayListsPaintOrder(t *testing.T) {
+	red := &PaintCommand{Type: PaintRect, NodeID: 1, FillColor: color.NRGBA{R: 255, A: 255}, Box: Rect{Width: 50, Height: 50}}
+	blue := &PaintCommand{Type: PaintRect, NodeID: 2, FillColor: color.NRGBA{B: 255, A: 255}, Box: Rect{X: 25, Y: 25, Width: 50, Height: 50}}
+	text := &PaintCommand{Type: PaintText, NodeID: 3, Text: "x", Box: Rect{Y: 100, Width: 10, Height: 10}}
+
+	// Swapping the overlapping rectangles changes what shows where they overlap
+	diff := DiffDisplayLists(&DisplayList{Commands: []*PaintCommand{red, blue, text}}, &DisplayList{Commands: []*PaintCommand{blue, red, text}}, nil)
+	if diff.Empty() || len(diff.Changed) != 1 || len(diff.Unchanged) != 2 {
+		t.Fatalf("Expected one rectangle to change its paint order, got %d changed and %d unchanged", len(diff.Changed), len(diff.Unchanged))
+	}
+	if moved := diff.Changed[0].New; moved != red && moved != blue {
+		t.Errorf("Expected a rectangle to be reordered, got %+v", moved)
+	}
+
+	// Commands added in between keep the others in order
+	link := &PaintCommand{Type: PaintLink, NodeID: 4, LinkURL: "/", Box: Rect{Width: 10, Height: 10}}
+	diff = DiffDisplayLists(&DisplayList{Commands: []*PaintCommand{red, blue, text}}, &DisplayList{Commands: []*PaintCommand{red, link, blue, text}}, nil)
+	if len(diff.Changed) != 0 || len(diff.Unchanged) != 3 || len(diff.Added) != 1 {
+		t.Errorf("Expected only the link to be added, got %d changed", len(diff.Changed))
+	}
+}
+
+func TestDiffDisplayListsWithDirtyNodes(t *testing.T) {
+	prev := NewDisplayList()
+	prev.AddCommand(&PaintCommand{Type: PaintText, NodeID: 1, Text: "clean", Box: Rect{Width: 50, Height: 20}})
+	prev.AddCommand(&PaintCommand{Type: PaintText, NodeID: 2, Text: "dirty", Box: Rect{Y: 20, Width: 50, Height: 20}})
+	prev.AddCommand(&PaintCommand{Type: PaintText, NodeID: 3, Text: "moved", Box: Rect{Y: 40, Width: 50, Height: 20}})
+
+	next := NewDisplayList()
+	next.AddCommand(&PaintCommand{Type: PaintText, NodeID: 1, Text: "not compared", Box: Rect{Width: 50, Height: 20}})
+	next.AddCommand(&PaintCommand{Type: PaintText, NodeID: 2, Text: "changed", Box: Rect{Y: 20, Width: 50, Height: 40}})
+	next.AddCommand(&PaintCommand{Type: PaintText, NodeID: 3, Text: "moved", Box: Rect{Y: 60, Width: 50, Height: 20}})
+
+	tracker := NewInvalidationTracker()
+	tracker.MarkDirty(2, DirtyPaint|DirtyLayout)
+
+	diff := DiffDisplayLists(prev, next, tracker)
+	if len(diff.Unchanged) != 1 || diff.Unchanged[0].New.NodeID != 1 {
+		t.Errorf("Expected only the clean node in place to be unchanged, got %+v", diff.Unchanged)
+	}
+	if len(diff.Changed) != 2 || diff.Changed[0].New.NodeID != 2 || diff.Changed[1].New.NodeID != 3 {
+		t.Errorf("Expected the dirty node and the moved node to change, got %+v", diff.Changed)
+	}
+}
+
+func TestCanvasRendererReusesObjects(t *testing.T) {
+	test.NewApp()
+	htmlContent := `<html><body><p>First paragraph</p><p>Second paragraph</p></body></html>`
+	root, err := parseHTMLToRenderTree(htmlContent)
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+	layoutRoot := NewLayoutEngine(800, 600).ComputeLayout(root)
+
+	cr := NewCanvasRenderer(800, 600)
+	objects := func() []fyne.CanvasObject {
+		return cr.RenderWithViewport(root, layoutRoot).(*fyne.Container).Objects
+	}
+	first := objects()
+	if len(first) != 2 {
+		t.Fatalf("Expected 2 objects, got %d", len(first))
+	}
+
+	// A rebuilt display list keeps the objects of unchanged commands
+	cr.cachedDisplayList = nil
+	second := objects()
+	if len(second) != 2 || second[0] != first[0] || second[1] != first[1] {
+		t.Error("Expected the objects of unchanged commands to be reused")
+	}
+
+	// Dirty nodes whose commands changed get new objects
+	var secondText *RenderNode
+	for _, cmd := range cr.paintedList.Commands {
+		if cmd.Text == "Second paragraph" {
+			secondText = cmd.Node
+		}
+	}
+	if secondText == nil {
+		t.Fatal("Expected a command for the second paragraph")
+	}
+	secondText.Text = "Changed paragraph"
+	tracker := NewInvalidationTracker()
+	tracker.MarkDirty(secondText.ID, DirtyPaint)
+	cr.SetInvalidationTracker(tracker)
+	cr.cachedDisplayList = nil
+	third := objects()
+	if len(third) != 2 || third[0] != first[0] || third[1] == first[1] {
+		t.Error("Expected only the changed command to get a new object")
+	}
+	if len(tracker.GetDirtyNodes()) != 0 {
+		t.Error("Expected the tracker to be cleared after the paint")
+	}
+
+	// Clearing the cache drops every object
+	cr.ClearCache()
+	if fourth := objects(); fourth[0] == first[0] {
+		t.Error("Expected ClearCache to recreate the objects")
+	}
+}
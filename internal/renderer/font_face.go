@@ -0,0 +1,594 @@
+package renderer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"github.com/go-text/typesetting/font"
+
+	"github.com/vyquocvu/goosie/internal/css"
+	"github.com/vyquocvu/goosie/internal/net"
+	"github.com/vyquocvu/goosie/internal/webfont"
+)
+
+// FontDisplay is the font-display descriptor of a @font-face rule
+type FontDisplay string
+
+const (
+	// FontDisplayAuto behaves like block
+	FontDisplayAuto FontDisplay = "auto"
+	// FontDisplayBlock hides text for up to 3s, then swaps whenever the font loads
+	FontDisplayBlock FontDisplay = "block"
+	// FontDisplaySwap shows fallback text at once and swaps whenever the font loads
+	FontDisplaySwap FontDisplay = "swap"
+	// FontDisplayFallback hides text for 100ms and swaps only within 3s
+	FontDisplayFallback FontDisplay = "fallback"
+	// FontDisplayOptional uses the font only if it loads within 100ms
+	FontDisplayOptional FontDisplay = "optional"
+)
+
+// Block and swap periods of the font-display values
+const (
+	fontBlockPeriodShort = 100 * time.Millisecond
+	fontBlockPeriodLong  = 3 * time.Second
+	fontSwapPeriodShort  = 3 * time.Second
+)
+
+// ParseFontDisplay parses a font-display value, defaulting to auto
+func ParseFontDisplay(value string) FontDisplay {
+	switch display := FontDisplay(strings.ToLower(strings.TrimSpace(value))); display {
+	case FontDisplayBlock, FontDisplaySwap, FontDisplayFallback, FontDisplayOptional:
+		return display
+	default:
+		return FontDisplayAuto
+	}
+}
+
+// periods returns the block period, during which text waiting for the font is
+// invisible, and the swap period after it, during which a loaded font still
+// replaces the fallback. A negative swap period never ends.
+func (d FontDisplay) periods() (block, swap time.Duration) {
+	switch d {
+	case FontDisplaySwap:
+		return 0, -1
+	case FontDisplayFallback:
+		return fontBlockPeriodShort, fontSwapPeriodShort
+	case FontDisplayOptional:
+		return fontBlockPeriodShort, 0
+	default:
+		return fontBlockPeriodLong, -1
+	}
+}
+
+// FontFaceSource is an entry of the src descriptor of a @font-face rule
+type FontFaceSource struct {
+	URL    string // url() source, empty for local() sources
+	Local  string // Font name of a local() source
+	Format string // format() hint, empty if absent
+}
+
+// FontFaceRule is a parsed @font-face rule
+type FontFaceRule struct {
+	Family    string
+	Sources   []FontFaceSource
+	WeightMin int
+	WeightMax int
+	Style     string // "normal", "italic" or "oblique"
+	Display   FontDisplay
+}
+
+// ParseFontFaceRules returns the valid @font-face rules of a stylesheet
+func ParseFontFaceRules(stylesheet *css.StyleSheet) []FontFaceRule {
+	rules := make([]FontFaceRule, 0)
+	if stylesheet == nil {
+		return rules
+	}
+	for _, atRule := range stylesheet.AtRules {
+		if !strings.EqualFold(atRule.Name, "font-face") {
+			continue
+		}
+		if rule, ok := parseFontFaceRule(atRule.Declarations); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// parseFontFaceRule parses the descriptors of a @font-face rule
+// Rules without a family or a source are invalid.
+func parseFontFaceRule(declarations []css.Declaration) (FontFaceRule, bool) {
+	rule := FontFaceRule{
+		WeightMin: 400,
+		WeightMax: 400,
+		Style:     "normal",
+		Display:   FontDisplayAuto,
+	}
+
+	for _, decl := range declarations {
+		switch strings.ToLower(decl.Property) {
+		case "font-family":
+			if families := ParseFontFamilyList(decl.Value); len(families) == 1 {
+				rule.Family = families[0]
+			}
+		case "src":
+			rule.Sources = parseFontFaceSources(decl.Value)
+		case "font-weight":
+			rule.WeightMin, rule.WeightMax = parseFontWeightRange(decl.Value)
+		case "font-style":
+			rule.Style = parseFontStyleKeyword(decl.Value)
+		case "font-display":
+			rule.Display = ParseFontDisplay(decl.Value)
+		}
+	}
+
+	return rule, rule.Family != "" && len(rule.Sources) > 0
+}
+
+// parseFontFaceSources parses a src descriptor into its url() and local() sources
+func parseFontFaceSources(value string) []FontFaceSource {
+	sources := make([]FontFaceSource, 0)
+	for _, entry := range splitTopLevel(value, ',') {
+		source := FontFaceSource{}
+		for _, fn := range splitTopLevel(entry, ' ') {
+			name, arg, ok := parseCSSFunction(fn)
+			if !ok {
+				continue
+			}
+			switch name {
+			case "url":
+				source.URL = arg
+			case "local":
+				source.Local = arg
+			case "format":
+				source.Format = arg
+			}
+		}
+		if source.URL != "" || source.Local != "" {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// parseCSSFunction splits a CSS function like url("a.woff2") into its name and unquoted argument
+func parseCSSFunction(value string) (name, arg string, ok bool) {
+	open := strings.Index(value, "(")
+	if open <= 0 || !strings.HasSuffix(value, ")") {
+		return "", "", false
+	}
+	name = strings.ToLower(strings.TrimSpace(value[:open]))
+	arg = strings.Trim(strings.TrimSpace(value[open+1:len(value)-1]), `"'`)
+	return name, arg, true
+}
+
+// splitTopLevel splits value on sep outside of parentheses and quotes
+func splitTopLevel(value string, sep rune) []string {
+	parts := make([]string, 0)
+	depth := 0
+	var quote rune
+	start := 0
+	for i, ch := range value {
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '(':
+			depth++
+		case ch == ')':
+			depth--
+		case ch == sep && depth == 0:
+			if part := strings.TrimSpace(value[start:i]); part != "" {
+				parts = append(parts, part)
+			}
+			start = i + 1
+		}
+	}
+	if part := strings.TrimSpace(value[start:]); part != "" {
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// ParseFontWeight parses a font-weight value to a number between 1 and 1000
+// Relative keywords are resolved against normal weight.
+func ParseFontWeight(value string) int {
+	switch value = strings.ToLower(strings.TrimSpace(value)); value {
+	case "", "normal":
+		return 400
+	case "bold", "bolder":
+		return 700
+	case "lighter":
+		return 300
+	}
+	weight, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 400
+	}
+	return int(min(max(weight, 1), 1000))
+}
+
+// parseFontWeightRange parses the font-weight descriptor of a @font-face rule,
+// which may be a range for variable fonts
+func parseFontWeightRange(value string) (int, int) {
+	fields := strings.Fields(value)
+	switch len(fields) {
+	case 1:
+		weight := ParseFontWeight(fields[0])
+		return weight, weight
+	case 2:
+		low, high := ParseFontWeight(fields[0]), ParseFontWeight(fields[1])
+		return min(low, high), max(low, high)
+	default:
+		return 400, 400
+	}
+}
+
+// parseFontStyleKeyword reduces a font-style value to normal, italic or oblique
+func parseFontStyleKeyword(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch {
+	case value == "italic":
+		return "italic"
+	case strings.HasPrefix(value, "oblique"):
+		return "oblique"
+	default:
+		return "normal"
+	}
+}
+
+// FontFaceState is the loading state of a web font
+type FontFaceState int
+
+const (
+	// FontFaceUnloaded means the font has not been requested yet
+	FontFaceUnloaded FontFaceState = iota
+	// FontFaceLoading means the font is being fetched
+	FontFaceLoading
+	// FontFaceLoaded means the font was fetched and decoded
+	FontFaceLoaded
+	// FontFaceError means no source of the font could be loaded
+	FontFaceError
+)
+
+// FontFetchFunc fetches the data of a font resource
+type FontFetchFunc func(url string) ([]byte, error)
+
+// fontFaceGeneration numbers the states of all font face sets, so that shaped
+// runs cached for one state are never reused for another
+var fontFaceGeneration atomic.Uint64
+
+// FontFace is a font declared by a @font-face rule
+type FontFace struct {
+	Rule FontFaceRule
+
+	set      *FontFaceSet
+	state    FontFaceState
+	face     *font.Face
+	resource fyne.Resource
+	started  time.Time
+	usable   bool
+}
+
+// State returns the loading state of the font
+func (f *FontFace) State() FontFaceState {
+	f.set.mu.Lock()
+	defer f.set.mu.Unlock()
+	return f.state
+}
+
+// Usable reports whether the font loaded in time to be used by font-display
+func (f *FontFace) Usable() bool {
+	f.set.mu.Lock()
+	defer f.set.mu.Unlock()
+	return f.usable
+}
+
+// FontFaceSet holds the web fonts of a document
+// Fonts are fetched lazily the first time text is laid out in them.
+type FontFaceSet struct {
+	mu sync.Mutex
+
+	faces      map[string][]*FontFace // By normalized family name
+	baseURL    string
+	fetch      FontFetchFunc
+	now        func() time.Time
+	onChange   func()
+	generation uint64
+}
+
+// scheduledFontFetch returns a fetch function loading fonts through
+// net.DefaultScheduler under a context, cancelled when it is done
+func scheduledFontFetch(ctx context.Context) FontFetchFunc {
+	return func(url string) ([]byte, error) {
+		resp, err := net.DefaultScheduler.Fetch(ctx, net.ResourceRequest{URL: url, Type: net.ResourceFont})
+		if err != nil {
+			return nil, err
+		}
+		if !resp.OK() {
+			return nil, fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		return resp.Body, nil
+	}
+}
+
+// NewFontFaceSet creates the font face set of a document
+// Relative source URLs are resolved against baseURL. A nil fetch function
+// fetches fonts over the network.
+func NewFontFaceSet(rules []FontFaceRule, baseURL string, fetch FontFetchFunc) *FontFaceSet {
+	if fetch == nil {
+		fetch = scheduledFontFetch(context.Background())
+	}
+
+	fs := &FontFaceSet{
+		faces:      make(map[string][]*FontFace),
+		baseURL:    baseURL,
+		fetch:      fetch,
+		now:        time.Now,
+		generation: fontFaceGeneration.Add(1),
+	}
+	for _, rule := range rules {
+		family := font.NormalizeFamily(rule.Family)
+		fs.faces[family] = append(fs.faces[family], &FontFace{Rule: rule, set: fs})
+	}
+	return fs
+}
+
+// SetOnChange sets the callback run when a font finishes loading or its block
+// period ends, either of which changes how text is laid out or painted
+func (fs *FontFaceSet) SetOnChange(callback func()) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.onChange = callback
+}
+
+// Generation identifies the set of fonts usable for layout
+func (fs *FontFaceSet) Generation() uint64 {
+	if fs == nil {
+		return 0
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.generation
+}
+
+// Loading reports whether any font of the set is still being fetched
+func (fs *FontFaceSet) Loading() bool {
+	if fs == nil {
+		return false
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for _, faces := range fs.faces {
+		for _, face := range faces {
+			if face.state == FontFaceLoading {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasFamily reports whether a family is declared by a @font-face rule
+// Declared families hide installed fonts of the same name.
+func (fs *FontFaceSet) HasFamily(family string) bool {
+	if fs == nil {
+		return false
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return len(fs.faces[font.NormalizeFamily(family)]) > 0
+}
+
+// Match returns the face of a family that best matches a text style, following
+// the CSS font matching algorithm for font-style and font-weight
+func (fs *FontFaceSet) Match(family string, style fyne.TextStyle) *FontFace {
+	if fs == nil {
+		return nil
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.match(family, style)
+}
+
+func (fs *FontFaceSet) match(family string, style fyne.TextStyle) *FontFace {
+	faces := fs.faces[font.NormalizeFamily(family)]
+	if len(faces) == 0 {
+		return nil
+	}
+
+	// Italic text prefers italic, then oblique faces; normal text the reverse
+	styleOrder := []string{"normal", "oblique", "italic"}
+	if style.Italic {
+		styleOrder = []string{"italic", "oblique", "normal"}
+	}
+	weight := 400
+	if style.Bold {
+		weight = 700
+	}
+
+	for _, fontStyle := range styleOrder {
+		var best *FontFace
+		bestRank := 0
+		for _, face := range faces {
+			if face.Rule.Style != fontStyle {
+				continue
+			}
+			if rank := fontWeightRank(weight, face.Rule.WeightMin, face.Rule.WeightMax); best == nil || rank < bestRank {
+				best, bestRank = face, rank
+			}
+		}
+		if best != nil {
+			return best
+		}
+	}
+	return nil
+}
+
+// fontWeightRank orders a face's weight range by closeness to the desired
+// weight, lower is better. Between 400 and 500 heavier weights up to 500 are
+// tried first, then lighter ones, then heavier ones; below 400 lighter weights
+// come first and above 500 heavier weights do.
+func fontWeightRank(desired, low, high int) int {
+	switch {
+	case desired >= low && desired <= high:
+		return 0
+	case desired >= 400 && desired <= 500:
+		if low > desired && low <= 500 {
+			return low - desired
+		}
+		if high < desired {
+			return 1000 + desired - high
+		}
+		return 2000 + low - desired
+	case desired < 400:
+		if high < desired {
+			return desired - high
+		}
+		return 1000 + low - desired
+	default:
+		if low > desired {
+			return low - desired
+		}
+		return 1000 + desired - high
+	}
+}
+
+// resolve returns the loaded face of a family for layout, starting to load it
+// if needed. It returns nil while the font is not usable, so that the next
+// family in the font-family list is used instead.
+func (fs *FontFaceSet) resolve(family string, style fyne.TextStyle) *font.Face {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	face := fs.match(family, style)
+	if face == nil {
+		return nil
+	}
+	fs.load(face)
+	if !face.usable {
+		return nil
+	}
+	return face.face
+}
+
+// PaintSource returns the font data used to paint text in a face of a family,
+// and whether the text is hidden because the font is in its block period
+func (fs *FontFaceSet) PaintSource(family string, style fyne.TextStyle) (fyne.Resource, bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	face := fs.match(family, style)
+	if face == nil {
+		return nil, false
+	}
+	fs.load(face)
+	if face.usable {
+		return face.resource, false
+	}
+
+	block, _ := face.Rule.Display.periods()
+	hidden := face.state == FontFaceLoading && fs.now().Sub(face.started) < block
+	return nil, hidden
+}
+
+// load starts fetching a face in the background. Must be called with fs.mu held.
+func (fs *FontFaceSet) load(face *FontFace) {
+	if face.state != FontFaceUnloaded {
+		return
+	}
+	face.state = FontFaceLoading
+	face.started = fs.now()
+
+	// Text hidden during the block period is shown with the fallback font
+	// once the period ends
+	if block, _ := face.Rule.Display.periods(); block > 0 {
+		time.AfterFunc(block, func() {
+			if face.State() == FontFaceLoading {
+				fs.notify()
+			}
+		})
+	}
+
+	go fs.fetchFace(face)
+}
+
+// fetchFace loads the first source of a face that can be fetched and decoded
+func (fs *FontFaceSet) fetchFace(face *FontFace) {
+	for _, source := range face.Rule.Sources {
+		// Painting needs the font data, which local() sources don't provide
+		if source.URL == "" {
+			continue
+		}
+		if source.Format != "" && !webfont.SupportsFormat(source.Format) {
+			continue
+		}
+
+		resolved := fs.resolveURL(source.URL)
+		data, err := fs.fetch(resolved)
+		if err != nil {
+			continue
+		}
+		sfnt, err := webfont.Decode(data)
+		if err != nil {
+			continue
+		}
+		parsed, err := font.ParseTTF(bytes.NewReader(sfnt))
+		if err != nil {
+			continue
+		}
+
+		fs.mu.Lock()
+		face.state = FontFaceLoaded
+		face.face = parsed
+		face.resource = fyne.NewStaticResource(path.Base(resolved), sfnt)
+		block, swap := face.Rule.Display.periods()
+		face.usable = swap < 0 || fs.now().Sub(face.started) <= block+swap
+		if face.usable {
+			fs.generation = fontFaceGeneration.Add(1)
+		}
+		fs.mu.Unlock()
+
+		fs.notify()
+		return
+	}
+
+	fs.mu.Lock()
+	face.state = FontFaceError
+	fs.mu.Unlock()
+	fs.notify()
+}
+
+// resolveURL resolves a font URL against the document base URL
+func (fs *FontFaceSet) resolveURL(href string) string {
+	base, err := url.Parse(fs.baseURL)
+	if err != nil || fs.baseURL == "" {
+		return href
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// notify runs the change callback
+func (fs *FontFaceSet) notify() {
+	fs.mu.Lock()
+	callback := fs.onChange
+	fs.mu.Unlock()
+	if callback != nil {
+		callback()
+	}
+}
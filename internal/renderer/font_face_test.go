@@ -0,0 +1,412 @@
+package renderer
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/theme"
+
+	"github.com/vyquocvu/goosie/internal/css"
+)
+
+// fakeFontClock is a manually advanced clock for font-display periods
+type fakeFontClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeFontClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeFontClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newTestFontFaceSet creates a font face set for rules with a fake clock,
+// returning a channel that receives each change notification
+func newTestFontFaceSet(t *testing.T, rules []FontFaceRule, fetch FontFetchFunc) (*FontFaceSet, *fakeFontClock, chan struct{}) {
+	t.Helper()
+	clock := &fakeFontClock{now: time.Unix(0, 0)}
+	changes := make(chan struct{}, 16)
+
+	fonts := NewFontFaceSet(rules, "https://example.com/css/site.css", fetch)
+	fonts.now = clock.Now
+	fonts.SetOnChange(func() { changes <- struct{}{} })
+	return fonts, clock, changes
+}
+
+// waitForFontChange waits for a change notification of a font face set
+func waitForFontChange(t *testing.T, changes chan struct{}) {
+	t.Helper()
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a web font to load")
+	}
+}
+
+// monoFontRule declares the bundled monospace font as a web font
+func monoFontRule(display FontDisplay) FontFaceRule {
+	return FontFaceRule{
+		Family:    "Web Mono",
+		Sources:   []FontFaceSource{{URL: "/fonts/mono.ttf", Format: "truetype"}},
+		WeightMin: 400,
+		WeightMax: 400,
+		Style:     "normal",
+		Display:   display,
+	}
+}
+
+// serveMonoFont fetches the bundled monospace font for any URL
+func serveMonoFont(url string) ([]byte, error) {
+	return theme.DefaultTextMonospaceFont().Content(), nil
+}
+
+func TestParseFontFaceRules(t *testing.T) {
+	stylesheet, err := css.NewParser(`
+		@font-face {
+			font-family: "Web Sans";
+			src: local("Web Sans Regular"), url(fonts/web.woff2) format("woff2"), url('web.ttf') format('truetype');
+			font-weight: 300 700;
+			font-style: italic;
+			font-display: swap;
+		}
+		@font-face { font-family: Missing Source; }
+		p { font-family: "Web Sans", sans-serif; }
+	`).Parse()
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	rules := ParseFontFaceRules(stylesheet)
+	if len(rules) != 1 {
+		t.Fatalf("Expected 1 valid @font-face rule, got %d", len(rules))
+	}
+
+	rule := rules[0]
+	if rule.Family != "Web Sans" {
+		t.Errorf("Expected family 'Web Sans', got %q", rule.Family)
+	}
+	expected := []FontFaceSource{
+		{Local: "Web Sans Regular"},
+		{URL: "fonts/web.woff2", Format: "woff2"},
+		{URL: "web.ttf", Format: "truetype"},
+	}
+	if len(rule.Sources) != len(expected) {
+		t.Fatalf("Expected %d sources, got %+v", len(expected), rule.Sources)
+	}
+	for i, source := range expected {
+		if rule.Sources[i] != source {
+			t.Errorf("Source %d: expected %+v, got %+v", i, source, rule.Sources[i])
+		}
+	}
+	if rule.WeightMin != 300 || rule.WeightMax != 700 {
+		t.Errorf("Expected weight range 300-700, got %d-%d", rule.WeightMin, rule.WeightMax)
+	}
+	if rule.Style != "italic" || rule.Display != FontDisplaySwap {
+		t.Errorf("Expected italic/swap, got %q/%q", rule.Style, rule.Display)
+	}
+}
+
+func TestParseFontWeight(t *testing.T) {
+	tests := map[string]int{
+		"":        400,
+		"normal":  400,
+		"BOLD":    700,
+		"600":     600,
+		"1200":    1000,
+		"lighter": 300,
+		"heavy":   400,
+	}
+	for value, expected := range tests {
+		if got := ParseFontWeight(value); got != expected {
+			t.Errorf("ParseFontWeight(%q) = %d, expected %d", value, got, expected)
+		}
+	}
+}
+
+func TestFontFaceMatching(t *testing.T) {
+	face := func(weight int, style string) FontFaceRule {
+		return FontFaceRule{Family: "Family", Sources: []FontFaceSource{{URL: "f.ttf"}}, WeightMin: weight, WeightMax: weight, Style: style}
+	}
+	fonts := NewFontFaceSet([]FontFaceRule{face(300, "normal"), face(500, "normal"), face(800, "normal"), face(400, "oblique")}, "", serveMonoFont)
+
+	tests := []struct {
+		style  fyne.TextStyle
+		weight int
+		fstyle string
+	}{
+		// 400 tries heavier weights up to 500 first
+		{fyne.TextStyle{}, 500, "normal"},
+		// 700 tries heavier weights first
+		{fyne.TextStyle{Bold: true}, 800, "normal"},
+		// Italic text falls back to oblique faces before normal ones
+		{fyne.TextStyle{Italic: true}, 400, "oblique"},
+	}
+	for _, tt := range tests {
+		matched := fonts.Match("family", tt.style)
+		if matched == nil {
+			t.Fatalf("Expected a match for %+v", tt.style)
+		}
+		if matched.Rule.WeightMin != tt.weight || matched.Rule.Style != tt.fstyle {
+			t.Errorf("Style %+v matched %d %s, expected %d %s", tt.style, matched.Rule.WeightMin, matched.Rule.Style, tt.weight, tt.fstyle)
+		}
+	}
+
+	if fonts.Match("Other", fyne.TextStyle{}) != nil {
+		t.Error("Expected no match for an undeclared family")
+	}
+
+	ranks := []struct {
+		desired, better, worse int
+	}{
+		{300, 200, 400}, // Lighter weights first below 400
+		{700, 900, 600}, // Heavier weights first above 500
+		{400, 500, 300}, // Up to 500 first at 400
+		{400, 300, 600}, // Then lighter weights before heavier ones
+	}
+	for _, r := range ranks {
+		if fontWeightRank(r.desired, r.better, r.better) >= fontWeightRank(r.desired, r.worse, r.worse) {
+			t.Errorf("For weight %d expected %d to rank before %d", r.desired, r.better, r.worse)
+		}
+	}
+	if fontWeightRank(450, 300, 700) != 0 {
+		t.Error("Expected a weight range containing the desired weight to match exactly")
+	}
+}
+
+func TestWebFontSwapsIntoLayout(t *testing.T) {
+	fonts, _, changes := newTestFontFaceSet(t, []FontFaceRule{monoFontRule(FontDisplaySwap)}, serveMonoFont)
+	fm := NewFontMetrics(16)
+	fm.SetFontFaces(fonts)
+
+	text := "iiiiiiii"
+	fallback := fm.MeasureTextInFamily(text, "", 16, fyne.TextStyle{})
+	mono := fm.MeasureTextInFamily(text, "", 16, fyne.TextStyle{Monospace: true})
+
+	// Until the font loads, text is measured with the next family
+	before := fm.MeasureTextInFamily(text, `"Web Mono", sans-serif`, 16, fyne.TextStyle{})
+	if before.Width != fallback.Width {
+		t.Errorf("Expected fallback width %f before the font loads, got %f", fallback.Width, before.Width)
+	}
+
+	waitForFontChange(t, changes)
+	face := fonts.Match("Web Mono", fyne.TextStyle{})
+	if face.State() != FontFaceLoaded || !face.Usable() {
+		t.Fatalf("Expected the font to be loaded and usable, got state %d", face.State())
+	}
+
+	after := fm.MeasureTextInFamily(text, `"Web Mono", sans-serif`, 16, fyne.TextStyle{})
+	if after.Width != mono.Width {
+		t.Errorf("Expected web font width %f after loading, got %f", mono.Width, after.Width)
+	}
+}
+
+func TestWebFontDisplayPeriods(t *testing.T) {
+	release := make(chan struct{})
+	var clock *fakeFontClock
+	fetch := func(url string) ([]byte, error) {
+		if url != "https://example.com/fonts/mono.ttf" {
+			t.Errorf("Expected the source to resolve against the base URL, got %s", url)
+		}
+		<-release
+		clock.Advance(500 * time.Millisecond)
+		return serveMonoFont(url)
+	}
+
+	tests := []struct {
+		display      FontDisplay
+		hiddenAtLoad bool
+		usable       bool
+	}{
+		{FontDisplayBlock, true, true},
+		{FontDisplaySwap, false, true},
+		{FontDisplayFallback, true, true},
+		// The font arrives after the 100ms block period, too late for optional
+		{FontDisplayOptional, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.display), func(t *testing.T) {
+			var fonts *FontFaceSet
+			var changes chan struct{}
+			fonts, clock, changes = newTestFontFaceSet(t, []FontFaceRule{monoFontRule(tt.display)}, fetch)
+
+			source, hidden := fonts.PaintSource("Web Mono", fyne.TextStyle{})
+			if source != nil || hidden != tt.hiddenAtLoad {
+				t.Errorf("Expected hidden=%v while loading, got source=%v hidden=%v", tt.hiddenAtLoad, source != nil, hidden)
+			}
+
+			release <- struct{}{}
+			waitForFontChange(t, changes)
+
+			source, hidden = fonts.PaintSource("Web Mono", fyne.TextStyle{})
+			if hidden {
+				t.Error("Expected loaded fonts never to hide text")
+			}
+			if (source != nil) != tt.usable {
+				t.Errorf("Expected usable=%v, got source %v", tt.usable, source)
+			}
+		})
+	}
+}
+
+func TestWebFontBlockPeriodEnds(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	fetch := func(url string) ([]byte, error) {
+		<-release
+		return nil, errors.New("offline")
+	}
+
+	fonts, clock, _ := newTestFontFaceSet(t, []FontFaceRule{monoFontRule(FontDisplayAuto)}, fetch)
+	if _, hidden := fonts.PaintSource("Web Mono", fyne.TextStyle{}); !hidden {
+		t.Fatal("Expected text to be hidden at the start of the block period")
+	}
+	if !fonts.Loading() {
+		t.Error("Expected the font to be loading")
+	}
+
+	clock.Advance(fontBlockPeriodLong)
+	if _, hidden := fonts.PaintSource("Web Mono", fyne.TextStyle{}); hidden {
+		t.Error("Expected text to be shown with the fallback font after the block period")
+	}
+}
+
+func TestWebFontLoadFailureFallsBack(t *testing.T) {
+	rule := monoFontRule(FontDisplaySwap)
+	rule.Sources = []FontFaceSource{
+		{URL: "missing.woff2", Format: "woff2"},
+		{URL: "legacy.eot", Format: "embedded-opentype"},
+		{URL: "garbage.ttf"},
+	}
+	var fetched []string
+	var mu sync.Mutex
+	fetch := func(url string) ([]byte, error) {
+		mu.Lock()
+		fetched = append(fetched, url)
+		mu.Unlock()
+		if url == "https://example.com/css/missing.woff2" {
+			return nil, errors.New("404")
+		}
+		return []byte("not a font"), nil
+	}
+
+	fonts, _, changes := newTestFontFaceSet(t, []FontFaceRule{rule}, fetch)
+	if fonts.resolve("Web Mono", fyne.TextStyle{}) != nil {
+		t.Error("Expected no face before loading")
+	}
+	waitForFontChange(t, changes)
+
+	if state := fonts.Match("Web Mono", fyne.TextStyle{}).State(); state != FontFaceError {
+		t.Errorf("Expected the load to fail, got state %d", state)
+	}
+	if fonts.Loading() {
+		t.Error("Expected no font to be loading after the load failed")
+	}
+	mu.Lock()
+	if len(fetched) != 2 {
+		t.Errorf("Expected unsupported formats to be skipped, fetched %v", fetched)
+	}
+	mu.Unlock()
+
+	// Failed fonts fall through to the next family
+	cr := NewCanvasRenderer(800, 600)
+	cr.SetFontFaces(fonts)
+	if source, hidden := cr.fontSource(&PaintCommand{FontFamily: `"Web Mono", sans-serif`}); source != nil || hidden {
+		t.Errorf("Expected the fallback font, got source=%v hidden=%v", source != nil, hidden)
+	}
+}
+
+func TestRendererPaintsWithWOFF2WebFont(t *testing.T) {
+	fontData, err := os.ReadFile("../webfont/testdata/open-sans-regular.woff2")
+	if err != nil {
+		t.Fatalf("failed to read test font: %v", err)
+	}
+
+	loaded := make(chan string, 1)
+	r := NewRenderer(800, 600)
+	r.SetCurrentURL("https://example.com/index.html")
+	r.SetFontFetcher(func(url string) ([]byte, error) {
+		loaded <- url
+		return fontData, nil
+	})
+
+	htmlContent := `<html><head><style>
+		@font-face { font-family: "Open Sans Web"; src: url(/fonts/open-sans.woff2) format("woff2"); font-display: swap; }
+		p { font-family: "Open Sans Web", sans-serif; }
+	</style></head><body><p>Hello web fonts</p></body></html>`
+	if _, err := r.RenderHTML(htmlContent); err != nil {
+		t.Fatalf("RenderHTML failed: %v", err)
+	}
+
+	select {
+	case url := <-loaded:
+		if url != "https://example.com/fonts/open-sans.woff2" {
+			t.Errorf("Expected the font URL to resolve against the page, got %s", url)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected laying out the paragraph to fetch its web font")
+	}
+
+	face := r.fontFaces.Match("Open Sans Web", fyne.TextStyle{})
+	deadline := time.Now().Add(5 * time.Second)
+	for face.State() == FontFaceLoading && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if face.State() != FontFaceLoaded {
+		t.Fatalf("Expected the WOFF2 font to load, got state %d", face.State())
+	}
+
+	// Layout and painting use the web font
+	paragraph := findNodeByTag(r.currentRenderTree, "p")
+	cmd := &PaintCommand{FontFamily: inheritedStyleValue(paragraph.Children[0], func(s *Style) string { return s.FontFamily })}
+	if source, _ := r.canvasRenderer.fontSource(cmd); source == nil {
+		t.Error("Expected text to be painted with the web font")
+	}
+
+	fallback := r.layoutEngine.fontMetrics.MeasureTextInFamily("Hello web fonts", "", 16, fyne.TextStyle{})
+	web := r.layoutEngine.fontMetrics.MeasureTextInFamily("Hello web fonts", `"Open Sans Web", sans-serif`, 16, fyne.TextStyle{})
+	if web.Width == fallback.Width {
+		t.Error("Expected the web font to change text measurement")
+	}
+}
+
+func TestTextStyleFromCSSFontProperties(t *testing.T) {
+	fm := NewFontMetrics(16)
+
+	strong := NewRenderNode(NodeTypeElement)
+	strong.TagName = "strong"
+	strong.ComputedStyle = &Style{}
+	span := NewRenderNode(NodeTypeElement)
+	span.TagName = "span"
+	span.ComputedStyle = &Style{FontStyle: "italic"}
+	strong.AddChild(span)
+	text := NewRenderNode(NodeTypeText)
+	text.Text = "x"
+	span.AddChild(text)
+
+	if style := fm.GetTextStyleFromNode(text); !style.Bold || !style.Italic {
+		t.Errorf("Expected bold italic text, got %+v", style)
+	}
+
+	// The nearest font-weight overrides the tag's default
+	span.ComputedStyle.FontWeight = "normal"
+	if style := fm.GetTextStyleFromNode(text); style.Bold {
+		t.Error("Expected font-weight: normal to override <strong>")
+	}
+
+	span.ComputedStyle.FontWeight = "600"
+	if style := fm.GetTextStyleFromNode(text); !style.Bold {
+		t.Error("Expected font-weight: 600 to be bold")
+	}
+}
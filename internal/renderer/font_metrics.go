@@ -1,70 +1,76 @@
 package renderer
 
 import (
+	"strings"
+	"unicode"
+	
 	"fyne.io/fyne/v2"
 )
 
 // FontMetrics provides accurate text measurement using font metrics
 type FontMetrics struct {
 	defaultFontSize float32
-	// Cache for Fyne app availability
-	fyneAvailable bool
-	checkedFyne   bool
+	// shaper loads fonts and shapes text; nil falls back to estimation
+	shaper *TextShaper
+	// fonts holds the web fonts of the current document
+	fonts *FontFaceSet
 }
 
 // NewFontMetrics creates a new FontMetrics instance
 func NewFontMetrics(defaultSize float32) *FontMetrics {
 	return &FontMetrics{
 		defaultFontSize: defaultSize,
-		fyneAvailable:   false,
-		checkedFyne:     false,
+		shaper:          DefaultTextShaper(),
 	}
 }
 
+// SetFontFaces sets the web fonts declared by the current document
+func (fm *FontMetrics) SetFontFaces(fonts *FontFaceSet) {
+	fm.fonts = fonts
+}
+
 // TextMetrics represents the measured dimensions of text
 type TextMetrics struct {
 	Width   float32
 	Height  float32
 	Ascent  float32
 	Descent float32
+	LineGap float32
 }
 
 // MeasureText measures text using actual font metrics
 // Returns accurate width, height, ascent, and descent values
 func (fm *FontMetrics) MeasureText(text string, fontSize float32, style fyne.TextStyle) TextMetrics {
+	return fm.MeasureTextInFamily(text, "", fontSize, style)
+}
+
+// MeasureTextInFamily measures text shaped with a font family
+// The same fonts are used with or without a running Fyne app, so headless
+// layout matches on-screen layout. An empty family selects the default font.
+func (fm *FontMetrics) MeasureTextInFamily(text, family string, fontSize float32, style fyne.TextStyle) TextMetrics {
 	if text == "" {
 		return TextMetrics{}
 	}
 	
-	// Try to use Fyne's MeasureText if available (runtime environment)
-	if !fm.checkedFyne {
-		fm.fyneAvailable = isFyneAppAvailable()
-		fm.checkedFyne = true
-	}
-	
-	var width, height float32
-	
-	if fm.fyneAvailable {
-		// Use Fyne's accurate measurement when app is running
-		size := fyne.MeasureText(text, fontSize, style)
-		width = size.Width
-		height = size.Height
-	} else {
-		// Fallback to improved estimation for tests
-		width = fm.estimateTextWidth(text, fontSize, style)
-		height = fontSize * 1.2 // Line height with spacing
+	if fm.shaper != nil {
+		if run, ok := fm.shaper.ShapeWithFonts(text, family, fontSize, style, fm.fonts); ok {
+			return TextMetrics{
+				Width:   run.Width,
+				Height:  run.Ascent + run.Descent + run.LineGap,
+				Ascent:  run.Ascent,
+				Descent: run.Descent,
+				LineGap: run.LineGap,
+			}
+		}
 	}
 	
-	// Calculate ascent and descent based on font metrics
+	// Fallback to estimation when no font could be loaded
 	// For most fonts, ascent is about 75-80% of font size, descent is about 20-25%
-	ascent := fontSize * 0.75
-	descent := fontSize * 0.25
-	
 	return TextMetrics{
-		Width:   width,
-		Height:  height,
-		Ascent:  ascent,
-		Descent: descent,
+		Width:   fm.estimateTextWidth(text, fontSize, style),
+		Height:  fontSize * 1.2, // Line height with spacing
+		Ascent:  fontSize * 0.75,
+		Descent: fontSize * 0.25,
 	}
 }
 
@@ -123,19 +129,6 @@ func (fm *FontMetrics) estimateTextWidth(text string, fontSize float32, style fy
 	return totalWidth
 }
 
-// isFyneAppAvailable checks if Fyne app is available
-func isFyneAppAvailable() bool {
-	defer func() {
-		if r := recover(); r != nil {
-			// Fyne panicked, app not available
-		}
-	}()
-	
-	// Try to get current app - if it fails, Fyne is not initialized
-	app := fyne.CurrentApp()
-	return app != nil
-}
-
 // MeasureTextWithWrapping measures text with word wrapping
 // Returns the dimensions when text is wrapped to fit within maxWidth
 func (fm *FontMetrics) MeasureTextWithWrapping(text string, fontSize float32, style fyne.TextStyle, maxWidth float32) TextMetrics {
@@ -162,13 +155,10 @@ func (fm *FontMetrics) MeasureTextWithWrapping(text string, fontSize float32, st
 	
 	for _, word := range words {
 		// Try adding word to current line
-		testLine := lines[currentLine]
-		if testLine != "" {
-			testLine += " "
-		}
-		testLine += word
+		testLine := lines[currentLine] + word
 		
-		testMetrics := fm.MeasureText(testLine, fontSize, style)
+		// Trailing spaces hang past the end of the line
+		testMetrics := fm.MeasureText(strings.TrimRight(testLine, " "), fontSize, style)
 		
 		if testMetrics.Width <= maxWidth {
 			// Word fits on current line
@@ -199,7 +189,7 @@ func (fm *FontMetrics) MeasureTextWithWrapping(text string, fontSize float32, st
 	maxLineWidth := float32(0)
 	for _, line := range lines {
 		if line != "" {
-			lineMetrics := fm.MeasureText(line, fontSize, style)
+			lineMetrics := fm.MeasureText(strings.TrimRight(line, " "), fontSize, style)
 			if lineMetrics.Width > maxLineWidth {
 				maxLineWidth = lineMetrics.Width
 			}
@@ -211,6 +201,7 @@ func (fm *FontMetrics) MeasureTextWithWrapping(text string, fontSize float32, st
 		Height:  totalHeight,
 		Ascent:  singleLine.Ascent,
 		Descent: singleLine.Descent,
+		LineGap: singleLine.LineGap,
 	}
 }
 
@@ -249,17 +240,35 @@ func (fm *FontMetrics) GetTextStyle(tagName string) fyne.TextStyle {
 }
 
 // GetTextStyleFromNode returns the text style based on the node and its parents
+// The nearest CSS font-weight or font-style overrides the styling of tags further up.
 func (fm *FontMetrics) GetTextStyleFromNode(node *RenderNode) fyne.TextStyle {
 	style := fyne.TextStyle{}
+	weightSet, italicSet := false, false
 	
 	// Traverse up the tree to collect style properties
 	current := node
 	for current != nil {
+		computed := current.ComputedStyle
+		if !weightSet && computed != nil && computed.FontWeight != "" {
+			style.Bold = ParseFontWeight(computed.FontWeight) >= 600
+			weightSet = true
+		}
+		if !italicSet && computed != nil && computed.FontStyle != "" {
+			style.Italic = parseFontStyleKeyword(computed.FontStyle) != "normal"
+			italicSet = true
+		}
+		
 		switch current.TagName {
 		case "h1", "h2", "h3", "h4", "h5", "h6", "strong", "b":
-			style.Bold = true
+			if !weightSet {
+				style.Bold = true
+				weightSet = true
+			}
 		case "em", "i":
-			style.Italic = true
+			if !italicSet {
+				style.Italic = true
+				italicSet = true
+			}
 		case "code", "pre":
 			style.Monospace = true
 		}
@@ -269,24 +278,20 @@ func (fm *FontMetrics) GetTextStyleFromNode(node *RenderNode) fyne.TextStyle {
 	return style
 }
 
-// splitIntoWords splits text into words for wrapping
+// splitIntoWords splits text into words at its UAX #14 line break opportunities
+// White space after a word is kept as a single space
 func splitIntoWords(text string) []string {
 	words := []string{}
-	currentWord := ""
 	
-	for _, ch := range text {
-		if ch == ' ' || ch == '\t' || ch == '\n' {
-			if currentWord != "" {
-				words = append(words, currentWord)
-				currentWord = ""
-			}
-		} else {
-			currentWord += string(ch)
+	for _, segment := range lineBreakSegments(text) {
+		word := strings.TrimRightFunc(segment, unicode.IsSpace)
+		if word == "" {
+			continue
 		}
-	}
-	
-	if currentWord != "" {
-		words = append(words, currentWord)
+		if len(word) < len(segment) {
+			word += " "
+		}
+		words = append(words, word)
 	}
 	
 	return words
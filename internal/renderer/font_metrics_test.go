@@ -56,11 +56,17 @@ func TestMeasureText(t *testing.T) {
 				t.Errorf("Expected descent > 0, got %f", metrics.Descent)
 			}
 			
-			// Ascent + Descent should approximately equal font size
+			// Ascent + Descent come from the font's extents, which cover at
+			// least the em square and usually some extra room for accents
 			expectedHeight := tt.fontSize
 			actualHeight := metrics.Ascent + metrics.Descent
-			if actualHeight < expectedHeight*0.8 || actualHeight > expectedHeight*1.2 {
-				t.Errorf("Ascent+Descent (%f) should be close to font size (%f)", actualHeight, expectedHeight)
+			if actualHeight < expectedHeight || actualHeight > expectedHeight*1.5 {
+				t.Errorf("Ascent+Descent (%f) should be between 1 and 1.5 times the font size (%f)", actualHeight, expectedHeight)
+			}
+			
+			// Height is the full line: ascent, descent and line gap
+			if metrics.Height != metrics.Ascent+metrics.Descent+metrics.LineGap {
+				t.Errorf("Expected height %f, got %f", metrics.Ascent+metrics.Descent+metrics.LineGap, metrics.Height)
 			}
 		})
 	}
@@ -252,15 +258,17 @@ func TestSplitIntoWords(t *testing.T) {
 		text     string
 		expected []string
 	}{
-		{"simple", "hello world", []string{"hello", "world"}},
-		{"multiple spaces", "hello  world", []string{"hello", "world"}},
-		{"with newline", "hello\nworld", []string{"hello", "world"}},
-		{"with tab", "hello\tworld", []string{"hello", "world"}},
+		{"simple", "hello world", []string{"hello ", "world"}},
+		{"multiple spaces", "hello  world", []string{"hello ", "world"}},
+		{"with newline", "hello\nworld", []string{"hello ", "world"}},
+		{"with tab", "hello\tworld", []string{"hello ", "world"}},
 		{"single word", "hello", []string{"hello"}},
 		{"empty", "", []string{}},
 		{"only spaces", "   ", []string{}},
-		{"trailing space", "hello ", []string{"hello"}},
+		{"trailing space", "hello ", []string{"hello "}},
 		{"leading space", " hello", []string{"hello"}},
+		{"ideographs", "日本語", []string{"日", "本", "語"}},
+		{"hyphenated", "well-known", []string{"well-", "known"}},
 	}
 	
 	for _, tt := range tests {
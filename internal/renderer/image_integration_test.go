@@ -9,6 +9,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	imageloader "github.com/vyquocvu/goosie/internal/image"
 )
 
 func TestRendererWithImages(t *testing.T) {
@@ -169,3 +171,60 @@ func TestImageCacheEviction(t *testing.T) {
 		t.Errorf("Expected cache length <= 2, got %d", r.imageLoader.GetCache().Len())
 	}
 }
+
+func TestRendererLayoutHTMLWithoutCanvas(t *testing.T) {
+	tmpDir := t.TempDir()
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	f, err := os.Create(filepath.Join(tmpDir, "pixel.png"))
+	if err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+	f.Close()
+
+	r := NewRenderer(800, 600)
+	r.SetCurrentURL(filepath.Join(tmpDir, "page.html"))
+	layoutTree, err := r.LayoutHTML(`<html><body><h1>Title</h1><img src="pixel.png" alt="Pixel"></body></html>`)
+	if err != nil {
+		t.Fatalf("LayoutHTML failed: %v", err)
+	}
+	if layoutTree == nil || r.LayoutTree() != layoutTree || r.RenderTree() == nil {
+		t.Fatal("Expected LayoutHTML to cache the document trees")
+	}
+	if r.content != nil {
+		t.Error("Expected LayoutHTML not to create canvas objects")
+	}
+
+	// Images are loaded on the calling goroutine, relative to the document
+	r.LoadImagesSync()
+	var imgNode *RenderNode
+	var find func(node *RenderNode)
+	find = func(node *RenderNode) {
+		if node.TagName == "img" {
+			imgNode = node
+		}
+		for _, child := range node.Children {
+			find(child)
+		}
+	}
+	find(r.RenderTree())
+	if imgNode == nil || imgNode.ImageData == nil || imgNode.ImageData.State != imageloader.StateLoaded {
+		t.Fatal("Expected the image to be loaded synchronously")
+	}
+
+	hasImage := false
+	for _, cmd := range r.DisplayList().Commands {
+		if cmd.Type == PaintImage {
+			hasImage = true
+		}
+	}
+	if !hasImage {
+		t.Error("Expected the display list to paint the image")
+	}
+	if r.Relayout() == layoutTree {
+		t.Error("Expected Relayout to compute a new layout tree")
+	}
+}
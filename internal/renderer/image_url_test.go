@@ -1,9 +1,13 @@
 package renderer
 
 import (
+	"context"
+	"maps"
 	"strings"
 	"testing"
+	"time"
 
+	imageloader "github.com/vyquocvu/goosie/internal/image"
 	"golang.org/x/net/html"
 )
 
@@ -125,3 +129,62 @@ func TestImageLoadingWithRelativeURL(t *testing.T) {
 		t.Errorf("Expected resolved URL %v, got %v", expectedResolvedURL, resolvedURL)
 	}
 }
+
+// priorityImageLoader records which images were loaded as offscreen
+type priorityImageLoader struct {
+	mockImageLoader
+	offscreen map[string]bool
+	ctx       context.Context
+}
+
+func (l *priorityImageLoader) Load(source string) (*imageloader.ImageData, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.offscreen[source] = false
+	return &imageloader.ImageData{State: imageloader.StateLoading}, nil
+}
+
+func (l *priorityImageLoader) LoadOffscreen(source string) (*imageloader.ImageData, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.offscreen[source] = true
+	return &imageloader.ImageData{State: imageloader.StateLoading}, nil
+}
+
+func (l *priorityImageLoader) SetContext(ctx context.Context) {
+	l.ctx = ctx
+}
+
+func TestImagesOutsideViewportLoadOffscreen(t *testing.T) {
+	r := NewRenderer(800, 600)
+	loader := &priorityImageLoader{offscreen: make(map[string]bool)}
+	r.imageLoader = loader
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.SetLoadContext(ctx)
+	if loader.ctx != ctx {
+		t.Error("Expected the load context to reach the image loader")
+	}
+
+	if _, err := r.LayoutHTML(`<html><head><style>.spacer { height: 5000px; }</style></head><body>
+<img src="top.png" width="10" height="10"><div class="spacer"></div><img src="bottom.png" width="10" height="10">
+</body></html>`); err != nil {
+		t.Fatal(err)
+	}
+	r.loadImages(r.currentRenderTree)
+
+	expected := map[string]bool{"top.png": false, "bottom.png": true}
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		loader.mu.Lock()
+		done := len(loader.offscreen) == len(expected)
+		got := maps.Clone(loader.offscreen)
+		loader.mu.Unlock()
+		if done {
+			if !maps.Equal(got, expected) {
+				t.Errorf("Expected offscreen loads %v, got %v", expected, got)
+			}
+			return
+		}
+	}
+	t.Fatal("Timed out waiting for the images to load")
+}
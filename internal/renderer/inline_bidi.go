@@ -0,0 +1,300 @@
+package renderer
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/bidi"
+)
+
+// nodeDirection returns the direction specified on a node itself: its CSS
+// direction, or else its dir attribute ("ltr", "rtl" or "auto"), or "" if it
+// inherits its direction
+func nodeDirection(node *RenderNode) string {
+	if node.ComputedStyle != nil && node.ComputedStyle.Direction != "" {
+		return node.ComputedStyle.Direction
+	}
+	if dir, ok := node.GetAttribute("dir"); ok {
+		switch dir = strings.ToLower(strings.TrimSpace(dir)); dir {
+		case "ltr", "rtl", "auto":
+			return dir
+		}
+	}
+	if node.TagName == "bdi" {
+		// bdi elements take their direction from their content
+		return "auto"
+	}
+	return ""
+}
+
+// inheritedDirection returns the direction that applies to a node: "ltr", "rtl" or "auto"
+func inheritedDirection(node *RenderNode) string {
+	for current := node; current != nil; current = current.Parent {
+		if dir := nodeDirection(current); dir != "" {
+			return dir
+		}
+	}
+	return "ltr"
+}
+
+// nodeUnicodeBidi returns the unicode-bidi value of an element, including the
+// isolation implied by the dir attribute and by bdi and bdo elements
+func nodeUnicodeBidi(node *RenderNode) string {
+	if node.ComputedStyle != nil && node.ComputedStyle.UnicodeBidi != "" {
+		return node.ComputedStyle.UnicodeBidi
+	}
+	switch node.TagName {
+	case "bdo":
+		return "isolate-override"
+	case "bdi":
+		return "isolate"
+	}
+	if _, ok := node.GetAttribute("dir"); ok {
+		return "isolate"
+	}
+	return "normal"
+}
+
+// paragraphBidiLevel returns the base embedding level of a block's inline
+// content, or -1 when it comes from the first strong character of the text
+func paragraphBidiLevel(node *RenderNode) int {
+	if nodeUnicodeBidi(node) == "plaintext" {
+		return -1
+	}
+	switch inheritedDirection(node) {
+	case "rtl":
+		return 1
+	case "auto":
+		return -1
+	}
+	return 0
+}
+
+// bidiControls returns the formatting characters that open and close the bidi
+// context of an inline element, as the CSS Writing Modes spec describes them
+func bidiControls(node *RenderNode) (opening, closing []rune) {
+	dir := inheritedDirection(node)
+	embed, isolate, override := bidiLRE, bidiLRI, bidiLRO
+	if dir == "rtl" {
+		embed, isolate, override = bidiRLE, bidiRLI, bidiRLO
+	} else if dir == "auto" {
+		isolate = bidiFSI
+	}
+
+	switch nodeUnicodeBidi(node) {
+	case "embed":
+		return []rune{embed}, []rune{bidiPDF}
+	case "isolate":
+		return []rune{isolate}, []rune{bidiPDI}
+	case "bidi-override":
+		return []rune{override}, []rune{bidiPDF}
+	case "isolate-override":
+		return []rune{isolate, override}, []rune{bidiPDF, bidiPDI}
+	case "plaintext":
+		return []rune{bidiFSI}, []rune{bidiPDI}
+	}
+	return nil, nil
+}
+
+// bidiElementChain returns the inline ancestors of a box's node below the
+// container that open a bidi context, outermost first
+func bidiElementChain(node, container *RenderNode) []*RenderNode {
+	var chain []*RenderNode
+	if node == nil {
+		return chain
+	}
+	for current := node.Parent; current != nil && current != container; current = current.Parent {
+		if nodeUnicodeBidi(current) != "normal" {
+			chain = append([]*RenderNode{current}, chain...)
+		}
+	}
+	return chain
+}
+
+// bidiItem is a box or an inter-word space of a line in logical order
+type bidiItem struct {
+	box        *InlineBox // nil for the space between two boxes
+	width      float32
+	start, end int // range of the item in the paragraph text
+	level      int
+}
+
+// reorderBidiLines resolves the embedding levels of a container's inline
+// content and puts the inline boxes of every line in visual order (UAX #9
+// rules L1 and L2); lines ending in a preserved newline end a bidi paragraph;
+// it returns the paragraph level of the first paragraph
+func (ile *InlineLayoutEngine) reorderBidiLines(container *RenderNode, lines []*LineBox, level int) int {
+	resolved := max(level, 0)
+	start := 0
+	for i, line := range lines {
+		if !line.HardBreak && i < len(lines)-1 {
+			continue
+		}
+		paraLevel := ile.reorderBidiParagraph(container, lines[start:i+1], level)
+		if start == 0 {
+			resolved = paraLevel
+			if level < 0 && nodeUnicodeBidi(container) != "plaintext" {
+				// dir=auto takes the direction of the first paragraph for the whole element
+				level = paraLevel
+			}
+		}
+		start = i + 1
+	}
+	return resolved
+}
+
+// reorderBidiParagraph reorders the lines of one bidi paragraph and returns its level
+func (ile *InlineLayoutEngine) reorderBidiParagraph(container *RenderNode, lines []*LineBox, level int) int {
+	text := make([]rune, 0)
+	items := make([][]bidiItem, len(lines))
+	var open []*RenderNode
+
+	for li, line := range lines {
+		for bi, box := range line.InlineBoxes {
+			// Close the bidi contexts the box is not part of
+			chain := bidiElementChain(box.node, container)
+			common := 0
+			for common < len(open) && common < len(chain) && open[common] == chain[common] {
+				common++
+			}
+			for k := len(open) - 1; k >= common; k-- {
+				_, closing := bidiControls(open[k])
+				text = append(text, closing...)
+			}
+
+			// The space between words is resolved like a space character
+			if bi > 0 {
+				prev := line.InlineBoxes[bi-1]
+				if gap := box.X - (prev.X + prev.Width); gap > 0.01 {
+					items[li] = append(items[li], bidiItem{width: gap, start: len(text), end: len(text) + 1})
+					text = append(text, ' ')
+				}
+			}
+
+			for k := common; k < len(chain); k++ {
+				opening, _ := bidiControls(chain[k])
+				text = append(text, opening...)
+			}
+			open = chain
+
+			item := bidiItem{box: box, width: box.Width, start: len(text)}
+			if box.IsText {
+				text = append(text, []rune(box.Text)...)
+			} else {
+				// Atomic inlines are neutral
+				text = append(text, '\uFFFC')
+			}
+			item.end = len(text)
+			items[li] = append(items[li], item)
+		}
+	}
+
+	if level <= 0 && !hasBidiContent(string(text)) {
+		return 0
+	}
+
+	levels, paraLevel := resolveBidiLevels(text, level)
+	for li, line := range lines {
+		lineItems := ile.splitBidiItems(items[li], text, levels)
+		if len(lineItems) == 0 {
+			continue
+		}
+
+		// L1: white space at the end of a line takes the paragraph level
+		for k := len(lineItems) - 1; k >= 0 && isBidiWhiteSpace(text[lineItems[k].start:lineItems[k].end]); k-- {
+			lineItems[k].level = paraLevel
+		}
+
+		itemLevels := make([]int, len(lineItems))
+		for k, item := range lineItems {
+			itemLevels[k] = item.level
+		}
+
+		x := float32(0)
+		if first := lineItems[0].box; first != nil {
+			x = first.X
+		}
+		boxes := make([]*InlineBox, 0, len(lineItems))
+		for _, k := range bidiVisualOrder(itemLevels) {
+			item := lineItems[k]
+			if item.box != nil {
+				item.box.X = x
+				item.box.BidiLevel = item.level
+				boxes = append(boxes, item.box)
+			}
+			x += item.width
+		}
+		line.InlineBoxes = boxes
+	}
+	return paraLevel
+}
+
+// splitBidiItems gives every item of a line a single embedding level,
+// splitting text boxes whose characters resolved to different levels
+func (ile *InlineLayoutEngine) splitBidiItems(items []bidiItem, text []rune, levels []int) []bidiItem {
+	result := make([]bidiItem, 0, len(items))
+	for _, item := range items {
+		if item.start == item.end {
+			item.level = -1
+			result = append(result, item)
+			continue
+		}
+		item.level = levels[item.start]
+
+		split := false
+		for i := item.start + 1; i < item.end; i++ {
+			if levels[i] != item.level {
+				split = true
+				break
+			}
+		}
+		if !split || item.box == nil || !item.box.IsText || item.box.node == nil {
+			result = append(result, item)
+			continue
+		}
+
+		props := ile.resolveTextProps(item.box.node, WhiteSpaceNormal)
+		x := item.box.X
+		for start := item.start; start < item.end; {
+			end := start + 1
+			for end < item.end && levels[end] == levels[start] {
+				end++
+			}
+			part := *item.box
+			part.Text = string(text[start:end])
+			part.X = x
+			part.Width = ile.measureText(part.Text, props).Width
+			x += part.Width
+			result = append(result, bidiItem{box: &part, width: part.Width, start: start, end: end, level: levels[start]})
+			start = end
+		}
+	}
+
+	// Empty boxes, such as the placeholder of a blank line, sit at the paragraph level of their neighbours
+	for k := range result {
+		if result[k].level >= 0 {
+			continue
+		}
+		result[k].level = 0
+		if k > 0 {
+			result[k].level = result[k-1].level
+		} else if k+1 < len(result) && result[k+1].level >= 0 {
+			result[k].level = result[k+1].level
+		}
+	}
+	return result
+}
+
+// isBidiWhiteSpace reports whether text consists only of white space and segment separators
+func isBidiWhiteSpace(text []rune) bool {
+	for _, r := range text {
+		switch bidiClass(r) {
+		case bidi.WS, bidi.S, bidi.BN, bidi.LRI, bidi.RLI, bidi.FSI, bidi.PDI:
+		default:
+			if !unicode.IsSpace(r) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -1,6 +1,7 @@
 package renderer
 
 import (
+	"strconv"
 	"strings"
 	"unicode"
 	
@@ -45,6 +46,118 @@ const (
 	VerticalAlignSuper
 )
 
+// TextAlign represents horizontal alignment of line boxes
+type TextAlign int
+
+const (
+	// TextAlignLeft aligns lines to the left edge
+	TextAlignLeft TextAlign = iota
+	// TextAlignRight aligns lines to the right edge
+	TextAlignRight
+	// TextAlignCenter centers lines
+	TextAlignCenter
+	// TextAlignJustify stretches lines to fill the available width
+	TextAlignJustify
+)
+
+// ParseWhiteSpaceMode converts a CSS white-space value to a WhiteSpaceMode
+func ParseWhiteSpaceMode(value string) WhiteSpaceMode {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "nowrap":
+		return WhiteSpaceNoWrap
+	case "pre":
+		return WhiteSpacePre
+	case "pre-wrap", "break-spaces":
+		return WhiteSpacePreWrap
+	case "pre-line":
+		return WhiteSpacePreLine
+	default:
+		return WhiteSpaceNormal
+	}
+}
+
+// ParseVerticalAlign converts a CSS vertical-align keyword to a VerticalAlign
+func ParseVerticalAlign(value string) VerticalAlign {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "top":
+		return VerticalAlignTop
+	case "bottom":
+		return VerticalAlignBottom
+	case "middle":
+		return VerticalAlignMiddle
+	case "text-top":
+		return VerticalAlignTextTop
+	case "text-bottom":
+		return VerticalAlignTextBottom
+	case "sub":
+		return VerticalAlignSub
+	case "super":
+		return VerticalAlignSuper
+	default:
+		return VerticalAlignBaseline
+	}
+}
+
+// ParseTextAlign converts a CSS text-align value to a TextAlign
+func ParseTextAlign(value string) TextAlign {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "right", "end":
+		return TextAlignRight
+	case "center":
+		return TextAlignCenter
+	case "justify":
+		return TextAlignJustify
+	default:
+		return TextAlignLeft
+	}
+}
+
+// textAlignForDirection resolves the start and end values of text-align against the paragraph direction
+func textAlignForDirection(value string, rtl bool) TextAlign {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "start":
+		if rtl {
+			return TextAlignRight
+		}
+		return TextAlignLeft
+	case "end":
+		if rtl {
+			return TextAlignLeft
+		}
+		return TextAlignRight
+	default:
+		return ParseTextAlign(value)
+	}
+}
+
+// ApplyTextTransform applies a CSS text-transform value to text
+func ApplyTextTransform(text, transform string) string {
+	switch strings.ToLower(strings.TrimSpace(transform)) {
+	case "uppercase":
+		return strings.ToUpper(text)
+	case "lowercase":
+		return strings.ToLower(text)
+	case "capitalize":
+		var result strings.Builder
+		atWordStart := true
+		for _, ch := range text {
+			if unicode.IsSpace(ch) || unicode.IsPunct(ch) && ch != '\'' {
+				atWordStart = true
+				result.WriteRune(ch)
+				continue
+			}
+			if atWordStart {
+				ch = unicode.ToTitle(ch)
+				atWordStart = false
+			}
+			result.WriteRune(ch)
+		}
+		return result.String()
+	default:
+		return text
+	}
+}
+
 // LineBox represents a horizontal line containing inline elements
 type LineBox struct {
 	X              float32        // X position of line
@@ -55,6 +168,12 @@ type LineBox struct {
 	Descent        float32        // Distance from baseline to bottom
 	InlineBoxes    []*InlineBox   // Inline boxes in this line
 	AvailableWidth float32        // Available width for line
+	HardBreak      bool           // True if the line ends with a preserved newline
+	
+	// Strut of the containing block: its font's ascent and descent and its line height
+	StrutAscent     float32
+	StrutDescent    float32
+	StrutLineHeight float32
 }
 
 // InlineBox represents an inline-level box (text or inline element)
@@ -69,7 +188,23 @@ type InlineBox struct {
 	Text           string         // Text content (for text nodes)
 	IsText         bool           // True if this is a text node
 	VerticalAlign  VerticalAlign  // Vertical alignment
+	LineHeight     float32        // CSS line-height in pixels (0 for normal)
 	LayoutBox      *LayoutBox     // Reference to layout box for inline-block elements
+	BidiLevel      int            // Resolved bidi embedding level (odd for right-to-left)
+	
+	node *RenderNode // Node the box was created for
+}
+
+// inlineTextProps holds the resolved text properties of a text node
+type inlineTextProps struct {
+	fontFamily    string
+	fontSize      float32
+	style         fyne.TextStyle
+	letterSpacing float32
+	wordSpacing   float32
+	lineHeight    float32
+	verticalAlign VerticalAlign
+	wrap          bool
 }
 
 // InlineLayoutEngine handles inline layout calculations
@@ -97,6 +232,24 @@ func (ile *InlineLayoutEngine) LayoutInlineContent(
 	lines := make([]*LineBox, 0)
 	currentLine := ile.newLineBox(x, y, availableWidth)
 	
+	// Every line starts with a strut of the container's font and line height
+	fontSize := ile.fontMetrics.GetFontSize(node.TagName)
+	fontFamily := inheritedStyleValue(node, func(s *Style) string { return s.FontFamily })
+	strut := ile.fontMetrics.MeasureTextInFamily("x", fontFamily, fontSize, ile.fontMetrics.GetTextStyleFromNode(node))
+	currentLine.StrutAscent = strut.Ascent
+	currentLine.StrutDescent = strut.Descent
+	currentLine.StrutLineHeight = parseLineHeight(inheritedStyleValue(node, func(s *Style) string { return s.LineHeight }), fontSize)
+	
+	// text-indent shifts the first line from its start edge; percentages refer to the container width
+	bidiLevel := paragraphBidiLevel(node)
+	indent := inheritedStyleValue(node, func(s *Style) string { return s.TextIndent })
+	if indentWidth := parseTextIndent(indent, fontSize, availableWidth); indentWidth != 0 {
+		if bidiLevel != 1 {
+			currentLine.X += indentWidth
+		}
+		currentLine.AvailableWidth -= indentWidth
+	}
+	
 	// Process all inline children and text nodes
 	for _, child := range node.Children {
 		ile.addNodeToLines(child, &currentLine, &lines, x, availableWidth, whiteSpaceMode)
@@ -108,6 +261,11 @@ func (ile *InlineLayoutEngine) LayoutInlineContent(
 		lines = append(lines, currentLine)
 	}
 	
+	// Bidirectional text is reordered before the lines are aligned to their start edge
+	rtl := ile.reorderBidiLines(node, lines, bidiLevel)%2 == 1
+	textAlign := inheritedStyleValue(node, func(s *Style) string { return s.TextAlign })
+	ile.alignLines(lines, textAlignForDirection(textAlign, rtl), rtl)
+	
 	// Calculate total height
 	totalHeight := float32(0)
 	for _, line := range lines {
@@ -129,6 +287,11 @@ func (ile *InlineLayoutEngine) addNodeToLines(
 		return
 	}
 	
+	// Inline descendants may override the container's white-space mode
+	if node.ComputedStyle != nil && node.ComputedStyle.WhiteSpace != "" {
+		whiteSpaceMode = ParseWhiteSpaceMode(node.ComputedStyle.WhiteSpace)
+	}
+	
 	if node.Type == NodeTypeText {
 		ile.addTextToLines(node, currentLine, lines, lineX, availableWidth, whiteSpaceMode)
 	} else if node.Type == NodeTypeElement {
@@ -163,23 +326,128 @@ func (ile *InlineLayoutEngine) addTextToLines(
 		return
 	}
 	
-	// Get font properties
-	fontSize := ile.getFontSizeForNode(node)
-	style := ile.fontMetrics.GetTextStyleFromNode(node)
+	text = ApplyTextTransform(text, inheritedStyleValue(node, func(s *Style) string { return s.TextTransform }))
+	props := ile.resolveTextProps(node, whiteSpaceMode)
+	
+	// Preserved newlines force line breaks
+	segments := []string{text}
+	if whiteSpaceMode == WhiteSpacePre || whiteSpaceMode == WhiteSpacePreWrap || whiteSpaceMode == WhiteSpacePreLine {
+		segments = strings.Split(text, "\n")
+	}
+	
+	for i, segment := range segments {
+		if i > 0 {
+			ile.forceLineBreak(node, currentLine, lines, lineX, availableWidth, props)
+		}
+		ile.addTextSegment(segment, node, currentLine, lines, lineX, availableWidth, props, whiteSpaceMode)
+	}
+}
+
+// addTextSegment adds text without newlines to line boxes, wrapping it if the mode allows
+func (ile *InlineLayoutEngine) addTextSegment(
+	text string,
+	node *RenderNode,
+	currentLine **LineBox,
+	lines *[]*LineBox,
+	lineX, availableWidth float32,
+	props *inlineTextProps,
+	whiteSpaceMode WhiteSpaceMode,
+) {
+	if text == "" {
+		return
+	}
 	
-	// Split text into words or characters based on white space mode
-	if whiteSpaceMode == WhiteSpacePre || whiteSpaceMode == WhiteSpaceNoWrap {
+	if !props.wrap {
 		// No wrapping - add as single piece
-		ile.addTextPiece(text, node, currentLine, lines, lineX, availableWidth, fontSize, style, false)
-	} else {
-		// Word wrapping
-		words := ile.splitTextForWrapping(text, whiteSpaceMode)
-		for i, word := range words {
-			// Add space before word if not first word
-			addSpace := i > 0 && !strings.HasPrefix(word, " ")
-			ile.addTextPiece(word, node, currentLine, lines, lineX, availableWidth, fontSize, style, addSpace)
+		ile.addTextPiece(text, node, currentLine, lines, lineX, availableWidth, props, false)
+		return
+	}
+	
+	if whiteSpaceMode == WhiteSpacePreWrap {
+		// Preserved spaces stay attached to the following word
+		for _, piece := range ile.splitTextPreservingSpaces(text) {
+			ile.addTextPiece(piece, node, currentLine, lines, lineX, availableWidth, props, false)
 		}
+		return
+	}
+	
+	// Word wrapping at line break opportunities; collapsed spaces become gaps between pieces
+	spaceBefore := false
+	for _, segment := range ile.splitTextForWrapping(text) {
+		word := strings.TrimRight(segment, " ")
+		if word != "" {
+			ile.addTextPiece(word, node, currentLine, lines, lineX, availableWidth, props, spaceBefore)
+		}
+		spaceBefore = len(word) < len(segment)
+	}
+}
+
+// forceLineBreak ends the current line at a preserved newline
+// Empty lines get a zero-width box so that they keep the height of the text
+func (ile *InlineLayoutEngine) forceLineBreak(
+	node *RenderNode,
+	currentLine **LineBox,
+	lines *[]*LineBox,
+	lineX, availableWidth float32,
+	props *inlineTextProps,
+) {
+	if len((*currentLine).InlineBoxes) == 0 {
+		metrics := ile.measureText(" ", props)
+		(*currentLine).InlineBoxes = append((*currentLine).InlineBoxes, &InlineBox{
+			NodeID:        node.ID,
+			X:             (*currentLine).Width,
+			Height:        metrics.Height,
+			Ascent:        metrics.Ascent,
+			Descent:       metrics.Descent,
+			IsText:        true,
+			VerticalAlign: props.verticalAlign,
+			LineHeight:    props.lineHeight,
+			node:          node,
+		})
 	}
+	
+	(*currentLine).HardBreak = true
+	ile.startNewLine(currentLine, lines, lineX, availableWidth)
+}
+
+// startNewLine finalizes the current line and starts the next one below it
+func (ile *InlineLayoutEngine) startNewLine(currentLine **LineBox, lines *[]*LineBox, lineX, availableWidth float32) {
+	previous := *currentLine
+	ile.finalizeLine(previous)
+	*lines = append(*lines, previous)
+	
+	*currentLine = ile.newLineBox(lineX, previous.Y+previous.Height, availableWidth)
+	(*currentLine).StrutAscent = previous.StrutAscent
+	(*currentLine).StrutDescent = previous.StrutDescent
+	(*currentLine).StrutLineHeight = previous.StrutLineHeight
+}
+
+// resolveTextProps resolves the font and text properties that apply to a text node
+func (ile *InlineLayoutEngine) resolveTextProps(node *RenderNode, whiteSpaceMode WhiteSpaceMode) *inlineTextProps {
+	fontSize := ile.getFontSizeForNode(node)
+	
+	return &inlineTextProps{
+		fontFamily:    inheritedStyleValue(node, func(s *Style) string { return s.FontFamily }),
+		fontSize:      fontSize,
+		style:         ile.fontMetrics.GetTextStyleFromNode(node),
+		letterSpacing: parseLength(inheritedStyleValue(node, func(s *Style) string { return s.LetterSpacing }), fontSize),
+		wordSpacing:   parseLength(inheritedStyleValue(node, func(s *Style) string { return s.WordSpacing }), fontSize),
+		lineHeight:    parseLineHeight(inheritedStyleValue(node, func(s *Style) string { return s.LineHeight }), fontSize),
+		verticalAlign: ile.getVerticalAlignForNode(node),
+		wrap:          whiteSpaceMode != WhiteSpacePre && whiteSpaceMode != WhiteSpaceNoWrap,
+	}
+}
+
+// measureText measures text including letter and word spacing
+func (ile *InlineLayoutEngine) measureText(text string, props *inlineTextProps) TextMetrics {
+	metrics := ile.fontMetrics.MeasureTextInFamily(text, props.fontFamily, props.fontSize, props.style)
+	if props.letterSpacing != 0 {
+		metrics.Width += props.letterSpacing * float32(len([]rune(text)))
+	}
+	if props.wordSpacing != 0 {
+		metrics.Width += props.wordSpacing * float32(strings.Count(text, " "))
+	}
+	return metrics
 }
 
 // addTextPiece adds a piece of text to the current line or creates a new line
@@ -189,8 +457,7 @@ func (ile *InlineLayoutEngine) addTextPiece(
 	currentLine **LineBox,
 	lines *[]*LineBox,
 	lineX, availableWidth float32,
-	fontSize float32,
-	style fyne.TextStyle,
+	props *inlineTextProps,
 	addSpaceBefore bool,
 ) {
 	if text == "" {
@@ -198,25 +465,21 @@ func (ile *InlineLayoutEngine) addTextPiece(
 	}
 	
 	// Measure text
-	metrics := ile.fontMetrics.MeasureText(text, fontSize, style)
+	metrics := ile.measureText(text, props)
 	
 	// Add space width if needed
 	spaceWidth := float32(0)
 	if addSpaceBefore && len((*currentLine).InlineBoxes) > 0 {
-		spaceMetrics := ile.fontMetrics.MeasureText(" ", fontSize, style)
+		spaceMetrics := ile.measureText(" ", props)
 		spaceWidth = spaceMetrics.Width
 	}
 	
 	totalWidth := metrics.Width + spaceWidth
 	
 	// Check if text fits on current line
-	if (*currentLine).Width+totalWidth > (*currentLine).AvailableWidth && len((*currentLine).InlineBoxes) > 0 {
+	if props.wrap && (*currentLine).Width+totalWidth > (*currentLine).AvailableWidth && len((*currentLine).InlineBoxes) > 0 {
 		// Text doesn't fit - finalize current line and create new one
-		ile.finalizeLine(*currentLine)
-		*lines = append(*lines, *currentLine)
-		
-		nextY := (*currentLine).Y + (*currentLine).Height
-		*currentLine = ile.newLineBox(lineX, nextY, availableWidth)
+		ile.startNewLine(currentLine, lines, lineX, availableWidth)
 		spaceWidth = 0 // No space at start of new line
 		
 		// Re-measure for new line
@@ -224,8 +487,8 @@ func (ile *InlineLayoutEngine) addTextPiece(
 	}
 	
 	// If text still doesn't fit (very long word), break it into characters
-	if metrics.Width > (*currentLine).AvailableWidth && len((*currentLine).InlineBoxes) == 0 {
-		ile.addTextWithCharacterBreaking(text, node, currentLine, lines, lineX, availableWidth, fontSize, style)
+	if props.wrap && metrics.Width > (*currentLine).AvailableWidth && len((*currentLine).InlineBoxes) == 0 {
+		ile.addTextWithCharacterBreaking(text, node, currentLine, lines, lineX, availableWidth, props)
 		return
 	}
 	
@@ -240,19 +503,13 @@ func (ile *InlineLayoutEngine) addTextPiece(
 		Descent:       metrics.Descent,
 		Text:          text,
 		IsText:        true,
-		VerticalAlign: VerticalAlignBaseline,
+		VerticalAlign: props.verticalAlign,
+		LineHeight:    props.lineHeight,
+		node:          node,
 	}
 	
 	(*currentLine).InlineBoxes = append((*currentLine).InlineBoxes, inlineBox)
 	(*currentLine).Width += totalWidth
-	
-	// Update line metrics
-	if inlineBox.Ascent > (*currentLine).Ascent {
-		(*currentLine).Ascent = inlineBox.Ascent
-	}
-	if inlineBox.Descent > (*currentLine).Descent {
-		(*currentLine).Descent = inlineBox.Descent
-	}
 }
 
 // addTextWithCharacterBreaking breaks very long words at character boundaries
@@ -262,90 +519,60 @@ func (ile *InlineLayoutEngine) addTextWithCharacterBreaking(
 	currentLine **LineBox,
 	lines *[]*LineBox,
 	lineX, availableWidth float32,
-	fontSize float32,
-	style fyne.TextStyle,
+	props *inlineTextProps,
 ) {
-	// Break text into characters and fit as many as possible on each line
+	// Break text into grapheme clusters and fit as many as possible on each line
 	currentPiece := strings.Builder{}
 	
-	for _, ch := range text {
-		testPiece := currentPiece.String() + string(ch)
-		testMetrics := ile.fontMetrics.MeasureText(testPiece, fontSize, style)
+	for _, cluster := range graphemeClusters(text) {
+		testPiece := currentPiece.String() + cluster
+		testMetrics := ile.measureText(testPiece, props)
 		
 		if testMetrics.Width <= (*currentLine).AvailableWidth {
-			// Character fits
-			currentPiece.WriteRune(ch)
+			// Cluster fits
+			currentPiece.WriteString(cluster)
 		} else {
-			// Character doesn't fit - add current piece and start new line
+			// Cluster doesn't fit - add current piece and start new line
 			if currentPiece.Len() > 0 {
-				piece := currentPiece.String()
-				pieceMetrics := ile.fontMetrics.MeasureText(piece, fontSize, style)
-				
-				inlineBox := &InlineBox{
-					NodeID:        node.ID,
-					X:             (*currentLine).Width,
-					Y:             0,
-					Width:         pieceMetrics.Width,
-					Height:        pieceMetrics.Height,
-					Ascent:        pieceMetrics.Ascent,
-					Descent:       pieceMetrics.Descent,
-					Text:          piece,
-					IsText:        true,
-					VerticalAlign: VerticalAlignBaseline,
-				}
-				
-				(*currentLine).InlineBoxes = append((*currentLine).InlineBoxes, inlineBox)
-				(*currentLine).Width += pieceMetrics.Width
-				
-				if inlineBox.Ascent > (*currentLine).Ascent {
-					(*currentLine).Ascent = inlineBox.Ascent
-				}
-				if inlineBox.Descent > (*currentLine).Descent {
-					(*currentLine).Descent = inlineBox.Descent
-				}
+				ile.addCharacterPiece(currentPiece.String(), node, *currentLine, props)
 			}
 			
 			// Start new line
-			ile.finalizeLine(*currentLine)
-			*lines = append(*lines, *currentLine)
-			
-			nextY := (*currentLine).Y + (*currentLine).Height
-			*currentLine = ile.newLineBox(lineX, nextY, availableWidth)
+			ile.startNewLine(currentLine, lines, lineX, availableWidth)
 			
-			// Start new piece with current character
+			// Start new piece with current cluster
 			currentPiece.Reset()
-			currentPiece.WriteRune(ch)
+			currentPiece.WriteString(cluster)
 		}
 	}
 	
 	// Add remaining piece
 	if currentPiece.Len() > 0 {
-		piece := currentPiece.String()
-		pieceMetrics := ile.fontMetrics.MeasureText(piece, fontSize, style)
-		
-		inlineBox := &InlineBox{
-			NodeID:        node.ID,
-			X:             (*currentLine).Width,
-			Y:             0,
-			Width:         pieceMetrics.Width,
-			Height:        pieceMetrics.Height,
-			Ascent:        pieceMetrics.Ascent,
-			Descent:       pieceMetrics.Descent,
-			Text:          piece,
-			IsText:        true,
-			VerticalAlign: VerticalAlignBaseline,
-		}
-		
-		(*currentLine).InlineBoxes = append((*currentLine).InlineBoxes, inlineBox)
-		(*currentLine).Width += pieceMetrics.Width
-		
-		if inlineBox.Ascent > (*currentLine).Ascent {
-			(*currentLine).Ascent = inlineBox.Ascent
-		}
-		if inlineBox.Descent > (*currentLine).Descent {
-			(*currentLine).Descent = inlineBox.Descent
-		}
+		ile.addCharacterPiece(currentPiece.String(), node, *currentLine, props)
+	}
+}
+
+// addCharacterPiece appends a piece of a broken word to the end of a line
+func (ile *InlineLayoutEngine) addCharacterPiece(piece string, node *RenderNode, line *LineBox, props *inlineTextProps) {
+	pieceMetrics := ile.measureText(piece, props)
+	
+	inlineBox := &InlineBox{
+		NodeID:        node.ID,
+		X:             line.Width,
+		Y:             0,
+		Width:         pieceMetrics.Width,
+		Height:        pieceMetrics.Height,
+		Ascent:        pieceMetrics.Ascent,
+		Descent:       pieceMetrics.Descent,
+		Text:          piece,
+		IsText:        true,
+		VerticalAlign: props.verticalAlign,
+		LineHeight:    props.lineHeight,
+		node:          node,
 	}
+	
+	line.InlineBoxes = append(line.InlineBoxes, inlineBox)
+	line.Width += pieceMetrics.Width
 }
 
 // addInlineBlockToLines adds an inline-block element to lines
@@ -366,11 +593,7 @@ func (ile *InlineLayoutEngine) addInlineBlockToLines(
 	// Check if inline-block fits on current line
 	if (*currentLine).Width+width > (*currentLine).AvailableWidth && len((*currentLine).InlineBoxes) > 0 {
 		// Doesn't fit - start new line
-		ile.finalizeLine(*currentLine)
-		*lines = append(*lines, *currentLine)
-		
-		nextY := (*currentLine).Y + (*currentLine).Height
-		*currentLine = ile.newLineBox(lineX, nextY, availableWidth)
+		ile.startNewLine(currentLine, lines, lineX, availableWidth)
 	}
 	
 	// Create inline box for inline-block
@@ -384,56 +607,170 @@ func (ile *InlineLayoutEngine) addInlineBlockToLines(
 		Descent:       height * 0.25,
 		Text:          "",
 		IsText:        false,
-		VerticalAlign: VerticalAlignBaseline,
+		VerticalAlign: ile.getVerticalAlignForNode(node),
+		node:          node,
 	}
 	
 	(*currentLine).InlineBoxes = append((*currentLine).InlineBoxes, inlineBox)
 	(*currentLine).Width += width
-	
-	// Update line metrics
-	if inlineBox.Ascent > (*currentLine).Ascent {
-		(*currentLine).Ascent = inlineBox.Ascent
-	}
-	if inlineBox.Descent > (*currentLine).Descent {
-		(*currentLine).Descent = inlineBox.Descent
-	}
 }
 
 // finalizeLine finalizes a line box by computing final positions and height
+// Boxes aligned relative to the baseline determine the line's ascent and descent,
+// then top and bottom aligned boxes are placed against the line box edges
 func (ile *InlineLayoutEngine) finalizeLine(line *LineBox) {
 	if len(line.InlineBoxes) == 0 {
 		return
 	}
 	
-	// Set line height based on maximum ascent and descent
-	line.Height = line.Ascent + line.Descent
+	// The strut contributes the container's font and line height
+	strutLeading := halfLeading(line.StrutAscent, line.StrutDescent, line.StrutLineHeight)
+	ascent := line.StrutAscent + strutLeading
+	descent := line.StrutDescent + strutLeading
+	if line.StrutAscent+line.StrutDescent == 0 {
+		ascent, descent = 0, 0
+	}
+	
+	for _, box := range line.InlineBoxes {
+		if box.VerticalAlign == VerticalAlignTop || box.VerticalAlign == VerticalAlignBottom {
+			continue
+		}
+		leading := halfLeading(box.Ascent, box.Descent, box.LineHeight)
+		shift := ile.baselineShift(box, line)
+		if a := box.Ascent + leading - shift; a > ascent {
+			ascent = a
+		}
+		if d := box.Descent + leading + shift; d > descent {
+			descent = d
+		}
+	}
+	
+	// Top and bottom aligned boxes taller than the line grow it away from their edge
+	height := ascent + descent
+	for _, box := range line.InlineBoxes {
+		if box.VerticalAlign != VerticalAlignTop && box.VerticalAlign != VerticalAlignBottom {
+			continue
+		}
+		boxHeight := box.Ascent + box.Descent + 2*halfLeading(box.Ascent, box.Descent, box.LineHeight)
+		if boxHeight > height {
+			if box.VerticalAlign == VerticalAlignTop {
+				descent += boxHeight - height
+			} else {
+				ascent += boxHeight - height
+			}
+			height = boxHeight
+		}
+	}
+	
+	line.Ascent = ascent
+	line.Descent = descent
+	line.Height = height
 	
 	// Adjust vertical positions of inline boxes based on vertical alignment
 	for _, box := range line.InlineBoxes {
+		leading := halfLeading(box.Ascent, box.Descent, box.LineHeight)
 		switch box.VerticalAlign {
-		case VerticalAlignBaseline:
-			// Position relative to baseline
-			box.Y = line.Ascent - box.Ascent
 		case VerticalAlignTop:
-			box.Y = 0
+			box.Y = leading
 		case VerticalAlignBottom:
-			box.Y = line.Height - box.Height
-		case VerticalAlignMiddle:
-			box.Y = (line.Height - box.Height) / 2
-		case VerticalAlignTextTop:
-			box.Y = 0
-		case VerticalAlignTextBottom:
-			box.Y = line.Height - box.Height
-		case VerticalAlignSub:
-			// Subscript - lower than baseline
-			box.Y = line.Ascent - box.Ascent + box.Height*0.2
-		case VerticalAlignSuper:
-			// Superscript - higher than baseline
-			box.Y = line.Ascent - box.Ascent - box.Height*0.3
+			box.Y = line.Height - leading - box.Ascent - box.Descent
+		default:
+			// Position relative to the (shifted) baseline
+			box.Y = line.Ascent + ile.baselineShift(box, line) - box.Ascent
 		}
 	}
 }
 
+// baselineShift returns how far below the line's baseline a box's baseline sits
+func (ile *InlineLayoutEngine) baselineShift(box *InlineBox, line *LineBox) float32 {
+	switch box.VerticalAlign {
+	case VerticalAlignSub:
+		// Subscript - lower than baseline
+		return box.Height * 0.2
+	case VerticalAlignSuper:
+		// Superscript - higher than baseline
+		return -box.Height * 0.3
+	case VerticalAlignTextTop:
+		// Box top at the top of the parent's content area
+		return box.Ascent - line.StrutAscent
+	case VerticalAlignTextBottom:
+		// Box bottom at the bottom of the parent's content area
+		return line.StrutDescent - box.Descent
+	case VerticalAlignMiddle:
+		// Box midpoint at the baseline plus half the parent's x-height
+		xHeight := (line.StrutAscent + line.StrutDescent) * 0.5
+		return (box.Ascent-box.Descent)/2 - xHeight/2
+	default:
+		return 0
+	}
+}
+
+// halfLeading returns the space added above and below a box by its line height
+func halfLeading(ascent, descent, lineHeight float32) float32 {
+	if lineHeight <= 0 {
+		return 0
+	}
+	return (lineHeight - ascent - descent) / 2
+}
+
+// alignLines positions line boxes horizontally according to text-align
+// Justified lines distribute the free space between words, except the last line
+// and lines ending in a preserved newline, which are aligned to the start edge
+func (ile *InlineLayoutEngine) alignLines(lines []*LineBox, align TextAlign, rtl bool) {
+	for i, line := range lines {
+		free := line.AvailableWidth - line.Width
+		if free <= 0 {
+			continue
+		}
+		
+		switch align {
+		case TextAlignRight:
+			line.X += free
+		case TextAlignCenter:
+			line.X += free / 2
+		case TextAlignJustify:
+			if i == len(lines)-1 || line.HardBreak {
+				if rtl {
+					line.X += free
+				}
+				continue
+			}
+			ile.justifyLine(line, free)
+		}
+	}
+}
+
+// justifyLine widens the gaps between words of a line by the free space
+func (ile *InlineLayoutEngine) justifyLine(line *LineBox, free float32) {
+	// Find the gaps before shifting any box
+	gapBefore := make([]bool, len(line.InlineBoxes))
+	gaps := 0
+	for i := 1; i < len(line.InlineBoxes); i++ {
+		if isWordGap(line.InlineBoxes[i-1], line.InlineBoxes[i]) {
+			gapBefore[i] = true
+			gaps++
+		}
+	}
+	if gaps == 0 {
+		return
+	}
+	
+	extra := free / float32(gaps)
+	offset := float32(0)
+	for i := 1; i < len(line.InlineBoxes); i++ {
+		if gapBefore[i] {
+			offset += extra
+		}
+		line.InlineBoxes[i].X += offset
+	}
+	line.Width = line.AvailableWidth
+}
+
+// isWordGap reports whether two adjacent inline boxes are separated by a space
+func isWordGap(prev, next *InlineBox) bool {
+	return next.X > prev.X+prev.Width+0.01 || strings.HasPrefix(next.Text, " ")
+}
+
 // newLineBox creates a new line box
 func (ile *InlineLayoutEngine) newLineBox(x, y, availableWidth float32) *LineBox {
 	return &LineBox{
@@ -497,28 +834,80 @@ func (ile *InlineLayoutEngine) collapseWhiteSpacePreserveNewlines(text string) s
 	return strings.Join(lines, "\n")
 }
 
-// splitTextForWrapping splits text into wrappable pieces
-func (ile *InlineLayoutEngine) splitTextForWrapping(text string, mode WhiteSpaceMode) []string {
-	// For normal and pre-line modes, split on white space
-	words := make([]string, 0)
-	currentWord := strings.Builder{}
-	
-	for _, ch := range text {
-		if unicode.IsSpace(ch) {
-			if currentWord.Len() > 0 {
-				words = append(words, currentWord.String())
-				currentWord.Reset()
-			}
-		} else {
-			currentWord.WriteRune(ch)
+// splitTextForWrapping splits collapsed text at its UAX #14 line break opportunities
+// It matches splitIntoWords: white space after a piece is kept as a single space and
+// white-space-only text yields no pieces; preserved spaces go through splitTextPreservingSpaces
+func (ile *InlineLayoutEngine) splitTextForWrapping(text string) []string {
+	return splitIntoWords(text)
+}
+
+// splitTextPreservingSpaces splits text at line break opportunities into
+// pieces that keep their preceding spaces
+func (ile *InlineLayoutEngine) splitTextPreservingSpaces(text string) []string {
+	pieces := make([]string, 0)
+	pending := ""
+	
+	for _, segment := range lineBreakSegments(text) {
+		word := strings.TrimRight(segment, " \t")
+		if word == "" {
+			pending += segment
+			continue
 		}
+		pieces = append(pieces, pending+word)
+		pending = segment[len(word):]
 	}
 	
-	if currentWord.Len() > 0 {
-		words = append(words, currentWord.String())
+	if pending != "" {
+		pieces = append(pieces, pending)
 	}
 	
-	return words
+	return pieces
+}
+
+// getVerticalAlignForNode returns the vertical alignment of a node's inline box
+// vertical-align is not inherited, but text moves with its inline ancestors,
+// so the nearest inline element with an alignment within the line wins
+func (ile *InlineLayoutEngine) getVerticalAlignForNode(node *RenderNode) VerticalAlign {
+	for current := node; current != nil; current = current.Parent {
+		if current.Type == NodeTypeElement && current.IsBlock() {
+			break
+		}
+		if current.ComputedStyle != nil && current.ComputedStyle.VerticalAlign != "" {
+			return ParseVerticalAlign(current.ComputedStyle.VerticalAlign)
+		}
+		switch current.TagName {
+		case "sub":
+			return VerticalAlignSub
+		case "sup":
+			return VerticalAlignSuper
+		}
+	}
+	return VerticalAlignBaseline
+}
+
+// inheritedStyleValue returns the first non-empty value of an inherited
+// property on the node or its ancestors
+func inheritedStyleValue(node *RenderNode, get func(*Style) string) string {
+	for current := node; current != nil; current = current.Parent {
+		if current.ComputedStyle != nil {
+			if value := get(current.ComputedStyle); value != "" {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// parseTextIndent parses a CSS text-indent value, resolving percentages against the container width
+func parseTextIndent(value string, fontSize, containerWidth float32) float32 {
+	value = strings.TrimSpace(value)
+	if strings.HasSuffix(value, "%") {
+		if val, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 32); err == nil {
+			return float32(val) / 100 * containerWidth
+		}
+		return 0
+	}
+	return parseLength(value, fontSize)
 }
 
 // getFontSizeForNode returns the font size for a node
@@ -1,7 +1,9 @@
 package renderer
 
 import (
+	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 func TestNewInlineLayoutEngine(t *testing.T) {
@@ -80,15 +82,18 @@ func TestSplitTextForWrapping(t *testing.T) {
 		expected []string
 	}{
 		{"single word", "hello", []string{"hello"}},
-		{"two words", "hello world", []string{"hello", "world"}},
-		{"multiple words", "the quick brown fox", []string{"the", "quick", "brown", "fox"}},
+		{"two words", "hello world", []string{"hello ", "world"}},
+		{"multiple words", "the quick brown fox", []string{"the ", "quick ", "brown ", "fox"}},
 		{"empty string", "", []string{}},
 		{"only spaces", "   ", []string{}},
+		{"ideographs", "中文字", []string{"中", "文", "字"}},
+		{"no break before ideographic full stop", "中文。字", []string{"中", "文。", "字"}},
+		{"mixed scripts", "Hello世界", []string{"Hello", "世", "界"}},
 	}
 	
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := ile.splitTextForWrapping(tt.input, WhiteSpaceNormal)
+			result := ile.splitTextForWrapping(tt.input)
 			if len(result) != len(tt.expected) {
 				t.Errorf("Expected %d words, got %d", len(tt.expected), len(result))
 				return
@@ -102,6 +107,23 @@ func TestSplitTextForWrapping(t *testing.T) {
 	}
 }
 
+func TestSplitHelpersAgreeOnCollapsedText(t *testing.T) {
+	ile := NewInlineLayoutEngine(NewFontMetrics(16.0), 16.0)
+	
+	for _, text := range []string{"", "   ", "hello  world", " hello", "中文。字", "well-known"} {
+		wrapped := ile.splitTextForWrapping(text)
+		words := splitIntoWords(text)
+		if strings.Join(wrapped, "|") != strings.Join(words, "|") {
+			t.Errorf("%q: splitTextForWrapping gave %q, splitIntoWords gave %q", text, wrapped, words)
+		}
+	}
+	
+	// pre-wrap keeps white-space-only text so that preserved spaces still take room
+	if pieces := ile.splitTextPreservingSpaces("   "); len(pieces) != 1 || pieces[0] != "   " {
+		t.Errorf("Expected preserved spaces to be kept as one piece, got %q", pieces)
+	}
+}
+
 func TestProcessWhiteSpace(t *testing.T) {
 	ile := NewInlineLayoutEngine(NewFontMetrics(16.0), 16.0)
 	
@@ -486,6 +508,72 @@ func TestCharacterBreaking(t *testing.T) {
 	}
 }
 
+func TestCharacterBreakingKeepsGraphemeClusters(t *testing.T) {
+	ile := NewInlineLayoutEngine(NewFontMetrics(16.0), 16.0)
+	
+	// Combining accents and emoji ZWJ sequences are never split from their base
+	text := strings.Repeat("e\u0301", 20) + strings.Repeat("👩\u200d👩\u200d👧", 5)
+	p := NewRenderNode(NodeTypeElement)
+	p.TagName = "p"
+	textNode := NewRenderNode(NodeTypeText)
+	textNode.Text = text
+	textNode.Parent = p
+	p.AddChild(textNode)
+	
+	lines, _ := ile.LayoutInlineContent(p, 0, 0, 40, WhiteSpaceNormal)
+	if len(lines) <= 1 {
+		t.Fatalf("Expected the text to be broken across lines, got %d", len(lines))
+	}
+	
+	var joined strings.Builder
+	for i, line := range lines {
+		for _, box := range line.InlineBoxes {
+			first, _ := utf8.DecodeRuneInString(box.Text)
+			last, _ := utf8.DecodeLastRuneInString(box.Text)
+			if first == '\u0301' || first == '\u200d' || last == '\u200d' {
+				t.Errorf("Line %d: box %q splits a grapheme cluster", i, box.Text)
+			}
+			joined.WriteString(box.Text)
+		}
+	}
+	if joined.String() != text {
+		t.Error("Expected the broken pieces to join back to the original text")
+	}
+}
+
+func TestLayoutWrapsCJKText(t *testing.T) {
+	ile := NewInlineLayoutEngine(NewFontMetrics(16.0), 16.0)
+	
+	p := NewRenderNode(NodeTypeElement)
+	p.TagName = "p"
+	text := NewRenderNode(NodeTypeText)
+	text.Text = "日本語の文章は単語の間に空白がありません。"
+	text.Parent = p
+	p.AddChild(text)
+	
+	lines, _ := ile.LayoutInlineContent(p, 0, 0, 100, WhiteSpaceNormal)
+	if len(lines) <= 1 {
+		t.Fatalf("Expected CJK text to wrap between ideographs, got %d lines", len(lines))
+	}
+	for i, line := range lines {
+		if line.Width > line.AvailableWidth+0.01 {
+			t.Errorf("Line %d width %f exceeds available width %f", i, line.Width, line.AvailableWidth)
+		}
+		for j := 1; j < len(line.InlineBoxes); j++ {
+			if isWordGap(line.InlineBoxes[j-1], line.InlineBoxes[j]) {
+				t.Errorf("Line %d: expected no spaces between ideographs", i)
+			}
+		}
+	}
+	
+	// The ideographic full stop never starts a line
+	for i, line := range lines[1:] {
+		if strings.HasPrefix(line.InlineBoxes[0].Text, "。") {
+			t.Errorf("Line %d starts with a full stop", i+1)
+		}
+	}
+}
+
 // Helper method to provide a string representation for WhiteSpaceMode
 func (mode WhiteSpaceMode) String() string {
 	switch mode {
@@ -100,9 +100,23 @@ func (it *InvalidationTracker) markSubtreeDirty(node *RenderNode) {
 }
 
 // IncrementalLayoutEngine extends LayoutEngine with incremental layout support
+// Dirty nodes are laid out again while clean boxes of the previous layout are
+// reused, moved down or up when content before them changed size. A changed
+// size propagates to the parent only until a box keeps its size, such as a
+// box with a fixed height that clips its overflow.
 type IncrementalLayoutEngine struct {
 	*LayoutEngine
 	invalidation *InvalidationTracker
+	
+	// Nodes laid out by the current pass, and the node that must not be reused
+	laidOut map[int64]bool
+	forced  int64
+	
+	// Number of boxes laid out by the last incremental pass
+	lastLaidOut int
+	
+	// Nodes passed to InvalidateNode since the last layout, by ID
+	invalidated map[int64]*RenderNode
 }
 
 // NewIncrementalLayoutEngine creates a layout engine with invalidation tracking
@@ -114,11 +128,25 @@ func NewIncrementalLayoutEngine(width, height float32) *IncrementalLayoutEngine
 }
 
 // InvalidateNode marks a node as needing relayout
+// Unlike InvalidationTracker.PropagateInvalidation, ancestors are not marked:
+// they are laid out again only if the node changes size. Style changes that
+// are inherited by descendants need DirtySubtree.
 func (ile *IncrementalLayoutEngine) InvalidateNode(node *RenderNode, flags DirtyFlag) {
-	ile.invalidation.PropagateInvalidation(node, flags)
+	if node == nil {
+		return
+	}
+	ile.invalidation.MarkDirty(node.ID, flags)
+	if ile.invalidated == nil {
+		ile.invalidated = make(map[int64]*RenderNode)
+	}
+	ile.invalidated[node.ID] = node
+	if flags&DirtySubtree != 0 {
+		ile.invalidation.markSubtreeDirty(node)
+	}
 }
 
 // ComputeIncrementalLayout performs incremental layout, only recomputing dirty subtrees
+// previousLayout must be the last layout computed by this engine for root.
 func (ile *IncrementalLayoutEngine) ComputeIncrementalLayout(root *RenderNode, previousLayout *LayoutBox) *LayoutBox {
 	if root == nil {
 		return nil
@@ -130,16 +158,189 @@ func (ile *IncrementalLayoutEngine) ComputeIncrementalLayout(root *RenderNode, p
 		return previousLayout
 	}
 	
-	// For now, do a full recompute if any node is dirty
-	// A more sophisticated implementation would only recompute dirty subtrees
-	layoutRoot := ile.LayoutEngine.ComputeLayout(root)
+	if previousLayout == nil || previousLayout.NodeID != root.ID || ile.needsLayout(root) {
+		layoutRoot := ile.LayoutEngine.ComputeLayout(root)
+		ile.invalidation.ClearAll()
+		ile.invalidated = nil
+		return layoutRoot
+	}
+	
+	ile.laidOut = make(map[int64]bool)
+	ile.reuse = ile.reuseBox
+	defer func() {
+		ile.lastLaidOut = len(ile.laidOut)
+		ile.reuse = nil
+		ile.laidOut = nil
+	}()
+	
+	// Lay out the nearest box of each dirty node again, collecting the
+	// parents of boxes that changed size with their depth
+	layoutRoot := previousLayout
+	resized := make(map[*RenderNode]int)
+	for _, node := range ile.dirtyRenderNodes(root, dirtyNodes) {
+		if !ile.needsLayout(node) {
+			continue // Already laid out with an ancestor
+		}
+		// Nodes without a box of their own are laid out by an ancestor: text
+		// and inline elements by their block, hidden and new nodes by their parent
+		target := node
+		for target != nil && ile.ownBox(target) == nil {
+			target = target.Parent
+		}
+		if target == nil || ile.laidOut[target.ID] {
+			continue
+		}
+		layoutRoot = ile.layOutAgain(target, layoutRoot, resized)
+	}
+	
+	// Then lay out the ancestors of resized boxes, deepest first, up to the
+	// boxes that keep their size
+	for len(resized) > 0 {
+		var target *RenderNode
+		depth := -1
+		for node, d := range resized {
+			if d > depth {
+				target, depth = node, d
+			}
+		}
+		delete(resized, target)
+		layoutRoot = ile.layOutAgain(target, layoutRoot, resized)
+	}
 	
 	// Clear dirty flags after layout
 	ile.invalidation.ClearAll()
+	ile.invalidated = nil
 	
 	return layoutRoot
 }
 
+// layOutAgain lays out the box of a node at its previous position, replacing
+// it in its parent box. If its size changed, the node of the parent box is
+// added to resized. Returns the new layout root.
+func (ile *IncrementalLayoutEngine) layOutAgain(node *RenderNode, layoutRoot *LayoutBox, resized map[*RenderNode]int) *LayoutBox {
+	previous := ile.ownBox(node)
+	ile.forced = node.ID
+	layoutBox := ile.buildLayoutBox(node, previous.layoutX, previous.layoutY, previous.layoutWidth)
+	ile.forced = 0
+	
+	parent := node.Parent
+	for parent != nil && ile.ownBox(parent) == nil {
+		parent = parent.Parent
+	}
+	if parent == nil {
+		// A root that is no longer displayed keeps its box
+		if layoutBox == nil {
+			return previous
+		}
+		return layoutBox
+	}
+	
+	replaceChildBox(ile.ownBox(parent), previous, layoutBox)
+	if outerSizeChanged(previous, layoutBox) {
+		depth := 0
+		for ancestor := parent.Parent; ancestor != nil; ancestor = ancestor.Parent {
+			depth++
+		}
+		resized[parent] = depth
+	}
+	return layoutRoot
+}
+
+// dirtyRenderNodes returns the nodes of the given IDs, looking them up in the
+// tree only for nodes marked dirty without InvalidateNode
+func (ile *IncrementalLayoutEngine) dirtyRenderNodes(root *RenderNode, ids []int64) []*RenderNode {
+	var index map[int64]*RenderNode
+	nodes := make([]*RenderNode, 0, len(ids))
+	for _, id := range ids {
+		node := ile.invalidated[id]
+		if node == nil {
+			if index == nil {
+				index = indexRenderTree(root)
+			}
+			node = index[id]
+		}
+		if node != nil {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// reuseBox is the LayoutEngine.reuse hook of an incremental pass
+func (ile *IncrementalLayoutEngine) reuseBox(node *RenderNode, x, y, availableWidth float32) *LayoutBox {
+	previous := ile.ownBox(node)
+	if previous == nil || node.ID == ile.forced || ile.needsLayout(node) ||
+		previous.layoutX != x || previous.layoutWidth != availableWidth {
+		ile.laidOut[node.ID] = true
+		return nil
+	}
+	
+	// Content before the box changed size: move it without laying it out
+	previous.translate(y - previous.layoutY)
+	return previous
+}
+
+// needsLayout reports whether a node is dirty and not yet laid out by the current pass
+func (ile *IncrementalLayoutEngine) needsLayout(node *RenderNode) bool {
+	return ile.invalidation.IsDirty(node.ID) && !ile.laidOut[node.ID]
+}
+
+// ownBox returns the box laid out for a node itself, as opposed to the block
+// holding the line boxes of inline content
+func (ile *IncrementalLayoutEngine) ownBox(node *RenderNode) *LayoutBox {
+	if layoutBox := ile.nodeMap[node.ID]; layoutBox != nil && layoutBox.NodeID == node.ID {
+		return layoutBox
+	}
+	return nil
+}
+
+// indexRenderTree maps the IDs of the nodes of a tree to the nodes
+func indexRenderTree(root *RenderNode) map[int64]*RenderNode {
+	nodes := make(map[int64]*RenderNode)
+	var walk func(*RenderNode)
+	walk = func(node *RenderNode) {
+		nodes[node.ID] = node
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(root)
+	return nodes
+}
+
+// replaceChildBox replaces a child box with its new layout, removing it when
+// the node is no longer displayed
+func replaceChildBox(parent, previous, layoutBox *LayoutBox) {
+	for i, child := range parent.Children {
+		if child != previous {
+			continue
+		}
+		if layoutBox == nil {
+			parent.Children = append(parent.Children[:i], parent.Children[i+1:]...)
+		} else {
+			parent.Children[i] = layoutBox
+		}
+		return
+	}
+}
+
+// outerSizeChanged reports whether a new layout of a box affects the layout of
+// its parent: its margin box or, unless it clips, its overflow changed
+func outerSizeChanged(previous, layoutBox *LayoutBox) bool {
+	if layoutBox == nil {
+		return true
+	}
+	if previous.Box != layoutBox.Box ||
+		previous.MarginTop != layoutBox.MarginTop || previous.MarginRight != layoutBox.MarginRight ||
+		previous.MarginBottom != layoutBox.MarginBottom || previous.MarginLeft != layoutBox.MarginLeft {
+		return true
+	}
+	if layoutBox.ClipsContent() {
+		return false
+	}
+	return previous.ScrollWidth != layoutBox.ScrollWidth || previous.ScrollHeight != layoutBox.ScrollHeight
+}
+
 // IsNodeDirty checks if a node needs recomputation
 func (ile *IncrementalLayoutEngine) IsNodeDirty(nodeID int64) bool {
 	return ile.invalidation.IsDirty(nodeID)
@@ -1,6 +1,7 @@
 package renderer
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -271,3 +272,132 @@ func TestDirtyFlagCombinations(t *testing.T) {
 		})
 	}
 }
+
+// styledRenderTree builds a render tree with the styles of its <style> elements
+func styledRenderTree(tb testing.TB, htmlContent string) *RenderNode {
+	tb.Helper()
+	r := NewRenderer(800, 600)
+	if _, err := r.LayoutHTML(htmlContent); err != nil {
+		tb.Fatalf("Failed to lay out HTML: %v", err)
+	}
+	return r.RenderTree()
+}
+
+// findText returns the text node with the given text
+func findText(node *RenderNode, text string) *RenderNode {
+	if node.Type == NodeTypeText && node.Text == text {
+		return node
+	}
+	for _, child := range node.Children {
+		if found := findText(child, text); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// near reports whether two coordinates are equal up to rounding, as moved
+// boxes add offsets that a full layout sums in another order
+func near(a, b float32) bool {
+	return a-b < 0.01 && b-a < 0.01
+}
+
+func nearRect(a, b Rect) bool {
+	return near(a.X, b.X) && near(a.Y, b.Y) && near(a.Width, b.Width) && near(a.Height, b.Height)
+}
+
+// assertSameLayout fails unless two layout trees have the same geometry
+func assertSameLayout(t *testing.T, expected, actual *LayoutBox) {
+	t.Helper()
+	if expected.NodeID != actual.NodeID || !nearRect(expected.Box, actual.Box) ||
+		!near(expected.ScrollWidth, actual.ScrollWidth) || !near(expected.ScrollHeight, actual.ScrollHeight) {
+		t.Fatalf("Box of node %d: expected %+v, got %+v (node %d)", expected.NodeID, expected.Box, actual.Box, actual.NodeID)
+	}
+	if len(expected.LineBoxes) != len(actual.LineBoxes) {
+		t.Fatalf("Node %d: expected %d lines, got %d", expected.NodeID, len(expected.LineBoxes), len(actual.LineBoxes))
+	}
+	for i, line := range expected.LineBoxes {
+		other := actual.LineBoxes[i]
+		if !nearRect(Rect{line.X, line.Y, line.Width, line.Height}, Rect{other.X, other.Y, other.Width, other.Height}) {
+			t.Fatalf("Node %d line %d: expected %+v, got %+v", expected.NodeID, i, *line, *other)
+		}
+	}
+	if len(expected.Children) != len(actual.Children) {
+		t.Fatalf("Node %d: expected %d children, got %d", expected.NodeID, len(expected.Children), len(actual.Children))
+	}
+	for i := range expected.Children {
+		assertSameLayout(t, expected.Children[i], actual.Children[i])
+	}
+}
+
+const incrementalTestPage = `<html><head><style>
+.fixed { height: 60px; overflow: hidden; }
+.hidden { display: none; }
+</style></head><body>
+<div class="fixed"><p>Inside a fixed box</p></div>
+<p>Edited paragraph</p>
+<div><p>Following paragraph</p><p>Last paragraph</p></div>
+</body></html>`
+
+func TestComputeIncrementalLayoutMatchesFullLayout(t *testing.T) {
+	root := styledRenderTree(t, incrementalTestPage)
+	ile := NewIncrementalLayoutEngine(800, 600)
+	previous := ile.ComputeIncrementalLayout(root, nil)
+	following := ile.GetLayoutBox(findText(root, "Following paragraph").Parent.ID)
+	followingY := following.Box.Y
+
+	// Text that wraps onto more lines pushes the following boxes down
+	edited := findText(root, "Edited paragraph")
+	edited.Text = strings.Repeat("Edited paragraph with much longer text ", 40)
+	ile.InvalidateNode(edited, DirtyLayout)
+	layout := ile.ComputeIncrementalLayout(root, previous)
+
+	assertSameLayout(t, NewLayoutEngine(800, 600).ComputeLayout(root), layout)
+	if ile.GetLayoutBox(following.NodeID) != following {
+		t.Error("Expected the following box to be moved rather than laid out again")
+	}
+	if following.Box.Y <= followingY {
+		t.Errorf("Expected the following box to move down from %v, got %v", followingY, following.Box.Y)
+	}
+
+	// Hiding and showing a box changes the children of its parent
+	paragraph := findText(root, "Last paragraph").Parent
+	paragraph.ComputedStyle.Display = "none"
+	ile.InvalidateNode(paragraph, DirtyLayout)
+	layout = ile.ComputeIncrementalLayout(root, layout)
+	assertSameLayout(t, NewLayoutEngine(800, 600).ComputeLayout(root), layout)
+
+	paragraph.ComputedStyle.Display = "block"
+	ile.InvalidateNode(paragraph, DirtyLayout)
+	layout = ile.ComputeIncrementalLayout(root, layout)
+	assertSameLayout(t, NewLayoutEngine(800, 600).ComputeLayout(root), layout)
+}
+
+func TestComputeIncrementalLayoutStopsAtLayoutBoundary(t *testing.T) {
+	root := styledRenderTree(t, incrementalTestPage)
+	ile := NewIncrementalLayoutEngine(800, 600)
+	previous := ile.ComputeIncrementalLayout(root, nil)
+
+	inside := findText(root, "Inside a fixed box")
+	fixed := ile.GetLayoutBox(inside.Parent.Parent.ID)
+	edited := ile.GetLayoutBox(findText(root, "Edited paragraph").Parent.ID)
+	editedY := edited.Box.Y
+
+	inside.Text = strings.Repeat("Overflowing text ", 200)
+	ile.InvalidateNode(inside, DirtyLayout)
+	layout := ile.ComputeIncrementalLayout(root, previous)
+
+	if layout != previous {
+		t.Error("Expected the root box to be kept")
+	}
+	if ile.lastLaidOut != 2 {
+		t.Errorf("Expected only the paragraph and the fixed box to be laid out, got %d boxes", ile.lastLaidOut)
+	}
+	if ile.GetLayoutBox(fixed.NodeID) == fixed {
+		t.Error("Expected the fixed box to be laid out again, as its overflow changed")
+	}
+	if ile.GetLayoutBox(edited.NodeID) != edited || edited.Box.Y != editedY {
+		t.Error("Expected the boxes after the fixed box to stay in place")
+	}
+	assertSameLayout(t, NewLayoutEngine(800, 600).ComputeLayout(root), layout)
+}
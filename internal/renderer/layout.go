@@ -21,6 +21,21 @@ type LayoutEngine struct {
 	
 	// inlineLayoutEngine handles inline layout
 	inlineLayoutEngine *InlineLayoutEngine
+	
+	// scrollOffsets remembers the scroll position of scroll containers by node ID
+	// It survives relayout so that scrolled boxes keep their position
+	scrollOffsets map[int64]scrollOffset
+	
+	// reuse returns a box of a previous layout that is still valid for a node
+	// laid out at (x, y) with the given available width, or nil to lay it out
+	// Set by IncrementalLayoutEngine while it relays out part of a tree
+	reuse func(node *RenderNode, x, y, availableWidth float32) *LayoutBox
+}
+
+// scrollOffset is the scroll position of a single scroll container
+type scrollOffset struct {
+	X float32
+	Y float32
 }
 
 // NewLayoutEngine creates a new layout engine
@@ -35,9 +50,15 @@ func NewLayoutEngine(width, height float32) *LayoutEngine {
 		nodeMap:            make(map[int64]*LayoutBox),
 		fontMetrics:        fontMetrics,
 		inlineLayoutEngine: NewInlineLayoutEngine(fontMetrics, defaultSize),
+		scrollOffsets:      make(map[int64]scrollOffset),
 	}
 }
 
+// SetFontFaces sets the web fonts used to measure text of the current document
+func (le *LayoutEngine) SetFontFaces(fonts *FontFaceSet) {
+	le.fontMetrics.SetFontFaces(fonts)
+}
+
 // Layout performs layout calculations on the render tree and returns a layout tree
 // This is the new API that produces a separate layout tree
 func (le *LayoutEngine) ComputeLayout(root *RenderNode) *LayoutBox {
@@ -60,7 +81,14 @@ func (le *LayoutEngine) buildLayoutBox(node *RenderNode, x, y, availableWidth fl
 		return nil
 	}
 	
+	if le.reuse != nil {
+		if layoutBox := le.reuse(node, x, y, availableWidth); layoutBox != nil {
+			return layoutBox
+		}
+	}
+	
 	layoutBox := NewLayoutBox(node.ID)
+	layoutBox.layoutX, layoutBox.layoutY, layoutBox.layoutWidth = x, y, availableWidth
 	le.nodeMap[node.ID] = layoutBox
 	
 	// Determine display type from computed style
@@ -72,6 +100,7 @@ func (le *LayoutEngine) buildLayoutBox(node *RenderNode, x, y, availableWidth fl
 			layoutBox.Display = DisplayInline
 		case "none":
 			layoutBox.Display = DisplayNone
+			delete(le.nodeMap, node.ID)
 			return nil // Don't layout non-displayed elements
 		default:
 			layoutBox.Display = DisplayInline // Default for unknown values
@@ -97,9 +126,99 @@ func (le *LayoutEngine) buildLayoutBox(node *RenderNode, x, y, availableWidth fl
 	// Bottom margin is also external and should not be included in height
 	layoutBox.Box.Height = currentY - (y + layoutBox.MarginTop)
 	
+	// An explicit CSS height fixes the box size; content that doesn't fit overflows
+	naturalHeight := layoutBox.Box.Height
+	if _, height := le.explicitSize(node); height > 0 {
+		layoutBox.Box.Height = height + layoutBox.PaddingTop + layoutBox.PaddingBottom
+	}
+	
+	le.computeScrollOverflow(layoutBox, naturalHeight)
+	
 	return layoutBox
 }
 
+// whiteSpaceMode returns the white-space mode for the inline content of a node
+// Elements that preserve white space by default use pre unless styled otherwise;
+// that default applies before values inherited from their ancestors
+func (le *LayoutEngine) whiteSpaceMode(node *RenderNode) WhiteSpaceMode {
+	for current := node; current != nil; current = current.Parent {
+		if current.ComputedStyle != nil && current.ComputedStyle.WhiteSpace != "" {
+			return ParseWhiteSpaceMode(current.ComputedStyle.WhiteSpace)
+		}
+		if value := defaultWhiteSpace(current.TagName); value != "" {
+			return ParseWhiteSpaceMode(value)
+		}
+	}
+	return WhiteSpaceNormal
+}
+
+// explicitSize returns the CSS width and height of a node in pixels
+// Values that are unset or cannot be resolved (auto, percentages) return 0
+func (le *LayoutEngine) explicitSize(node *RenderNode) (float32, float32) {
+	if node.ComputedStyle == nil {
+		return 0, 0
+	}
+	
+	fontSize := le.defaultFontSize
+	if node.ComputedStyle.FontSize > 0 {
+		fontSize = node.ComputedStyle.FontSize
+	}
+	
+	return parseLength(node.ComputedStyle.Width, fontSize), parseLength(node.ComputedStyle.Height, fontSize)
+}
+
+// computeScrollOverflow computes the scrollable overflow area of a box
+// and restores the remembered scroll offset of scroll containers
+func (le *LayoutEngine) computeScrollOverflow(layoutBox *LayoutBox, naturalHeight float32) {
+	clip := layoutBox.GetClipBox()
+	right := clip.X + clip.Width
+	bottom := layoutBox.Box.Y + naturalHeight
+	
+	for _, child := range layoutBox.Children {
+		childWidth := child.Box.Width
+		childHeight := child.Box.Height
+		// Overflow of non-clipping children propagates to this box
+		if !child.ClipsContent() {
+			if child.ScrollWidth > childWidth {
+				childWidth = child.ScrollWidth
+			}
+			if child.ScrollHeight > childHeight {
+				childHeight = child.ScrollHeight
+			}
+		}
+		if edge := child.Box.X + childWidth + child.MarginRight + layoutBox.PaddingRight; edge > right {
+			right = edge
+		}
+		if edge := child.Box.Y + childHeight + child.MarginBottom + layoutBox.PaddingBottom; edge > bottom {
+			bottom = edge
+		}
+	}
+	
+	for _, line := range layoutBox.LineBoxes {
+		if edge := line.X + line.Width + layoutBox.PaddingRight; edge > right {
+			right = edge
+		}
+		if edge := line.Y + line.Height + layoutBox.PaddingBottom; edge > bottom {
+			bottom = edge
+		}
+	}
+	
+	layoutBox.ScrollWidth = right - clip.X
+	layoutBox.ScrollHeight = bottom - clip.Y
+	if layoutBox.ScrollWidth < clip.Width {
+		layoutBox.ScrollWidth = clip.Width
+	}
+	if layoutBox.ScrollHeight < clip.Height {
+		layoutBox.ScrollHeight = clip.Height
+	}
+	
+	if layoutBox.IsScrollContainer() {
+		offset := le.scrollOffsets[layoutBox.NodeID]
+		layoutBox.ScrollX = clampScrollOffset(offset.X, layoutBox.MaxScrollX())
+		layoutBox.ScrollY = clampScrollOffset(offset.Y, layoutBox.MaxScrollY())
+	}
+}
+
 // applyBoxModel applies box model properties (margin, padding, border) from computed style to layout box
 func (le *LayoutEngine) applyBoxModel(node *RenderNode, layoutBox *LayoutBox) {
 	if node.ComputedStyle == nil {
@@ -139,6 +258,34 @@ func (le *LayoutEngine) applyBoxModel(node *RenderNode, layoutBox *LayoutBox) {
 	layoutBox.BorderRightColor = node.ComputedStyle.BorderRightColor
 	layoutBox.BorderBottomColor = node.ComputedStyle.BorderBottomColor
 	layoutBox.BorderLeftColor = node.ComputedStyle.BorderLeftColor
+	
+	// Apply overflow
+	// If only one axis is visible while the other clips, visible computes to auto
+	layoutBox.OverflowX = ParseOverflowMode(node.ComputedStyle.OverflowX)
+	layoutBox.OverflowY = ParseOverflowMode(node.ComputedStyle.OverflowY)
+	if layoutBox.OverflowX == OverflowVisible && layoutBox.OverflowY != OverflowVisible && layoutBox.OverflowY != OverflowClip {
+		layoutBox.OverflowX = OverflowAuto
+	}
+	if layoutBox.OverflowY == OverflowVisible && layoutBox.OverflowX != OverflowVisible && layoutBox.OverflowX != OverflowClip {
+		layoutBox.OverflowY = OverflowAuto
+	}
+	
+	// Transforms resolve their percentages against the border box once it is laid out
+	layoutBox.Transform = parseTransform(node.ComputedStyle.Transform, node.ComputedStyle.TransformOrigin, fontSize)
+}
+
+// updateTransform recomputes the transform of a node's box after its style
+// changed without a relayout
+func (le *LayoutEngine) updateTransform(node *RenderNode) {
+	layoutBox := le.nodeMap[node.ID]
+	if layoutBox == nil || layoutBox.NodeID != node.ID || node.ComputedStyle == nil {
+		return
+	}
+	fontSize := le.defaultFontSize
+	if node.ComputedStyle.FontSize > 0 {
+		fontSize = node.ComputedStyle.FontSize
+	}
+	layoutBox.Transform = parseTransform(node.ComputedStyle.Transform, node.ComputedStyle.TransformOrigin, fontSize)
 }
 
 // computeLayoutBox computes the layout for a single box
@@ -154,6 +301,12 @@ func (le *LayoutEngine) computeLayoutBox(node *RenderNode, layoutBox *LayoutBox,
 	layoutBox.Box.Y = y
 	layoutBox.Box.Width = availableWidth
 	
+	// An explicit CSS width (content-box sizing) replaces the available width
+	if width, _ := le.explicitSize(node); width > 0 {
+		layoutBox.Box.Width = width + layoutBox.PaddingLeft + layoutBox.PaddingRight
+		availableWidth = layoutBox.Box.Width
+	}
+	
 	currentY := y
 	
 	if node.Type == NodeTypeText {
@@ -220,7 +373,7 @@ func (le *LayoutEngine) computeElementLayout(node *RenderNode, layoutBox *Layout
 	if node.IsBlock() && le.hasInlineContent(node) {
 		// Use inline layout for the children
 		lines, totalHeight := le.inlineLayoutEngine.LayoutInlineContent(
-			node, childX, currentY, contentWidth, WhiteSpaceNormal,
+			node, childX, currentY, contentWidth, le.whiteSpaceMode(node),
 		)
 		
 		// Store line boxes in the layout box
@@ -248,14 +401,17 @@ func (le *LayoutEngine) computeElementLayout(node *RenderNode, layoutBox *Layout
 			childLayoutBox := le.buildLayoutBox(child, childX, childY, contentWidth)
 			if childLayoutBox != nil {
 				layoutBox.AddChild(childLayoutBox)
-				childY = childLayoutBox.Box.Y + childLayoutBox.Box.Height + childLayoutBox.MarginBottom
+				// Fixed boxes stay at their static position without taking space in the flow
+				if !child.IsFixed() {
+					childY = childLayoutBox.Box.Y + childLayoutBox.Box.Height + childLayoutBox.MarginBottom
+				}
 			}
 		}
 	} else {
 		// Inline elements: use inline layout engine
 		if le.hasInlineContent(node) {
 			lines, totalHeight := le.inlineLayoutEngine.LayoutInlineContent(
-				node, childX, currentY, contentWidth, WhiteSpaceNormal,
+				node, childX, currentY, contentWidth, le.whiteSpaceMode(node),
 			)
 			
 			// Store line boxes in the layout box
@@ -318,19 +474,120 @@ func (le *LayoutEngine) HitTest(layoutRoot *LayoutBox, x, y float32) int64 {
 
 // hitTestRecursive recursively searches for the deepest box containing (x, y)
 func (le *LayoutEngine) hitTestRecursive(box *LayoutBox, x, y float32) int64 {
-	if !box.Contains(x, y) {
+	path := le.hitTestPath(box, x, y, nil)
+	if len(path) == 0 {
 		return 0
 	}
+	return path[len(path)-1].NodeID
+}
+
+// HitTestPath returns the chain of layout boxes containing the point (x, y),
+// ordered from the root to the deepest box
+// Scroll offsets of scroll containers and CSS transforms are taken into account
+func (le *LayoutEngine) HitTestPath(layoutRoot *LayoutBox, x, y float32) []*LayoutBox {
+	if layoutRoot == nil {
+		return nil
+	}
+	
+	return le.hitTestPath(layoutRoot, x, y, nil)
+}
+
+// hitTestPath appends the boxes containing (x, y) to path, depth first
+func (le *LayoutEngine) hitTestPath(box *LayoutBox, x, y float32, path []*LayoutBox) []*LayoutBox {
+	// Map the point back through the box's transform into its layout coordinates
+	if box.Transform != nil {
+		inverse, ok := invertAff3(box.Transform.Matrix(box.Box))
+		if !ok {
+			return path
+		}
+		x, y = transformPoint(inverse, x, y)
+	}
+	
+	if !box.Contains(x, y) {
+		return path
+	}
+	
+	path = append(path, box)
+	
+	// Children of a clipping box are painted shifted by its scroll offset
+	childX, childY := x, y
+	if box.ClipsContent() {
+		clip := box.GetClipBox()
+		if x < clip.X || x > clip.X+clip.Width || y < clip.Y || y > clip.Y+clip.Height {
+			return path
+		}
+		childX += box.ScrollX
+		childY += box.ScrollY
+	}
 	
 	// Check children first (depth-first search for deepest match)
 	for _, child := range box.Children {
-		if hitID := le.hitTestRecursive(child, x, y); hitID != 0 {
-			return hitID
+		if childPath := le.hitTestPath(child, childX, childY, path); len(childPath) > len(path) {
+			return childPath
+		}
+	}
+	
+	// If no child contains the point, this box is the deepest match
+	return path
+}
+
+// FindScrollTarget returns the innermost user-scrollable box under (x, y)
+// that can still scroll by (dx, dy), or nil if no such box exists
+// Scrolling chains to ancestors once an inner container reaches its limit
+func (le *LayoutEngine) FindScrollTarget(layoutRoot *LayoutBox, x, y, dx, dy float32) *LayoutBox {
+	path := le.HitTestPath(layoutRoot, x, y)
+	for i := len(path) - 1; i >= 0; i-- {
+		box := path[i]
+		if box.IsUserScrollable() && box.CanScroll(dx, dy) {
+			return box
 		}
 	}
+	return nil
+}
+
+// ScrollBy scrolls a scroll container by (dx, dy), clamped to its scroll range
+// Returns true if the scroll offset changed
+func (le *LayoutEngine) ScrollBy(box *LayoutBox, dx, dy float32) bool {
+	if box == nil {
+		return false
+	}
+	return le.ScrollTo(box, box.ScrollX+dx, box.ScrollY+dy)
+}
+
+// ScrollTo sets the scroll offset of a scroll container, clamped to its scroll range
+// The offset is remembered across relayouts
+// Returns true if the scroll offset changed
+func (le *LayoutEngine) ScrollTo(box *LayoutBox, x, y float32) bool {
+	if box == nil || !box.IsScrollContainer() {
+		return false
+	}
 	
-	// If no child contains the point, return this box's node ID
-	return box.NodeID
+	x = clampScrollOffset(x, box.MaxScrollX())
+	y = clampScrollOffset(y, box.MaxScrollY())
+	changed := x != box.ScrollX || y != box.ScrollY
+	
+	box.ScrollX = x
+	box.ScrollY = y
+	le.scrollOffsets[box.NodeID] = scrollOffset{X: x, Y: y}
+	
+	return changed
+}
+
+// GetScrollOffset returns the remembered scroll offset for a node
+func (le *LayoutEngine) GetScrollOffset(nodeID int64) (float32, float32) {
+	offset := le.scrollOffsets[nodeID]
+	return offset.X, offset.Y
+}
+
+// clampScrollOffset clamps a scroll offset to the range [0, max]
+func clampScrollOffset(offset, max float32) float32 {
+	if offset < 0 {
+		return 0
+	}
+	if offset > max {
+		return max
+	}
+	return offset
 }
 
 // Layout performs layout calculations on the render tree (deprecated - use ComputeLayout)
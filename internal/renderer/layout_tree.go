@@ -1,6 +1,9 @@
 package renderer
 
-import "image/color"
+import (
+	"image/color"
+	"strings"
+)
 
 // DisplayType represents the display type of a layout box
 type DisplayType string
@@ -14,12 +17,40 @@ const (
 	DisplayNone DisplayType = "none"
 )
 
+// OverflowMode represents how content that overflows a box is handled
+type OverflowMode string
+
+const (
+	// OverflowVisible lets content spill outside the box (the default)
+	OverflowVisible OverflowMode = "visible"
+	// OverflowHidden clips content; the box can only be scrolled programmatically
+	OverflowHidden OverflowMode = "hidden"
+	// OverflowScroll clips content and always allows user scrolling
+	OverflowScroll OverflowMode = "scroll"
+	// OverflowAuto clips content and allows user scrolling when content overflows
+	OverflowAuto OverflowMode = "auto"
+	// OverflowClip clips content and forbids all scrolling
+	OverflowClip OverflowMode = "clip"
+)
+
+// ParseOverflowMode converts a CSS overflow keyword to an OverflowMode
+// Unknown or empty values map to OverflowVisible
+func ParseOverflowMode(value string) OverflowMode {
+	mode := OverflowMode(strings.ToLower(strings.TrimSpace(value)))
+	switch mode {
+	case OverflowHidden, OverflowScroll, OverflowAuto, OverflowClip:
+		return mode
+	default:
+		return OverflowVisible
+	}
+}
+
 // Rect represents a rectangular box with position and dimensions
 type Rect struct {
-	X      float32 // X position
-	Y      float32 // Y position
-	Width  float32 // Width
-	Height float32 // Height
+	X      float32 `json:"x"`      // X position
+	Y      float32 `json:"y"`      // Y position
+	Width  float32 `json:"width"`  // Width
+	Height float32 `json:"height"` // Height
 }
 
 // LayoutBox represents a node in the layout tree
@@ -60,6 +91,23 @@ type LayoutBox struct {
 	
 	// Inline layout information
 	LineBoxes []*LineBox // Line boxes for inline content (if this contains inline children)
+	
+	// Overflow handling
+	OverflowX    OverflowMode // Horizontal overflow behavior
+	OverflowY    OverflowMode // Vertical overflow behavior
+	ScrollX      float32      // Current horizontal scroll offset (scroll containers only)
+	ScrollY      float32      // Current vertical scroll offset (scroll containers only)
+	ScrollWidth  float32      // Width of the scrollable overflow area
+	ScrollHeight float32      // Height of the scrollable overflow area
+	
+	// Transform is the box's CSS transform, or nil if it is not transformed
+	Transform *Transform
+	
+	// Position and available width the box was laid out with, which decide
+	// whether incremental layout may reuse it
+	layoutX     float32
+	layoutY     float32
+	layoutWidth float32
 }
 
 // NewLayoutBox creates a new layout box
@@ -67,8 +115,10 @@ func NewLayoutBox(nodeID int64) *LayoutBox {
 	return &LayoutBox{
 		NodeID:   nodeID,
 		Box:      Rect{},
-		Display:  DisplayBlock,
-		Children: make([]*LayoutBox, 0),
+		Display:   DisplayBlock,
+		Children:  make([]*LayoutBox, 0),
+		OverflowX: OverflowVisible,
+		OverflowY: OverflowVisible,
 	}
 }
 
@@ -77,6 +127,21 @@ func (lb *LayoutBox) AddChild(child *LayoutBox) {
 	lb.Children = append(lb.Children, child)
 }
 
+// translate moves the box, its line boxes and its descendants down by dy
+func (lb *LayoutBox) translate(dy float32) {
+	if dy == 0 {
+		return
+	}
+	lb.Box.Y += dy
+	lb.layoutY += dy
+	for _, line := range lb.LineBoxes {
+		line.Y += dy
+	}
+	for _, child := range lb.Children {
+		child.translate(dy)
+	}
+}
+
 // IsBlock returns true if this is a block-level box
 func (lb *LayoutBox) IsBlock() bool {
 	return lb.Display == DisplayBlock
@@ -102,3 +167,69 @@ func (lb *LayoutBox) Contains(x, y float32) bool {
 	return x >= lb.Box.X && x <= lb.Box.X+lb.Box.Width &&
 		y >= lb.Box.Y && y <= lb.Box.Y+lb.Box.Height
 }
+
+
+// ClipsContent returns true if content outside the padding box is clipped
+func (lb *LayoutBox) ClipsContent() bool {
+	return lb.OverflowX != OverflowVisible && lb.OverflowX != "" ||
+		lb.OverflowY != OverflowVisible && lb.OverflowY != ""
+}
+
+// IsScrollContainer returns true if the box establishes a scroll container
+// Boxes with overflow hidden are scroll containers that only scripts can scroll
+func (lb *LayoutBox) IsScrollContainer() bool {
+	return lb.ClipsContent() && lb.OverflowX != OverflowClip && lb.OverflowY != OverflowClip
+}
+
+// IsUserScrollable returns true if wheel and drag input may scroll this box
+func (lb *LayoutBox) IsUserScrollable() bool {
+	return isUserScrollableMode(lb.OverflowX) || isUserScrollableMode(lb.OverflowY)
+}
+
+// GetClipBox returns the padding box, which is the clip rectangle for overflow
+func (lb *LayoutBox) GetClipBox() Rect {
+	return Rect{
+		X:      lb.Box.X + lb.BorderLeftWidth,
+		Y:      lb.Box.Y + lb.BorderTopWidth,
+		Width:  lb.Box.Width - lb.BorderLeftWidth - lb.BorderRightWidth,
+		Height: lb.Box.Height - lb.BorderTopWidth - lb.BorderBottomWidth,
+	}
+}
+
+// MaxScrollX returns the largest horizontal scroll offset for this box
+func (lb *LayoutBox) MaxScrollX() float32 {
+	max := lb.ScrollWidth - lb.GetClipBox().Width
+	if max < 0 {
+		return 0
+	}
+	return max
+}
+
+// MaxScrollY returns the largest vertical scroll offset for this box
+func (lb *LayoutBox) MaxScrollY() float32 {
+	max := lb.ScrollHeight - lb.GetClipBox().Height
+	if max < 0 {
+		return 0
+	}
+	return max
+}
+
+// CanScroll returns true if user input can move the box by (dx, dy) without
+// hitting its scroll limits. Axes with overflow hidden only scroll programmatically
+func (lb *LayoutBox) CanScroll(dx, dy float32) bool {
+	if !lb.IsScrollContainer() {
+		return false
+	}
+	if isUserScrollableMode(lb.OverflowX) && (dx < 0 && lb.ScrollX > 0 || dx > 0 && lb.ScrollX < lb.MaxScrollX()) {
+		return true
+	}
+	if isUserScrollableMode(lb.OverflowY) && (dy < 0 && lb.ScrollY > 0 || dy > 0 && lb.ScrollY < lb.MaxScrollY()) {
+		return true
+	}
+	return false
+}
+
+// isUserScrollableMode reports whether an overflow mode accepts user scrolling
+func isUserScrollableMode(mode OverflowMode) bool {
+	return mode == OverflowScroll || mode == OverflowAuto
+}
@@ -0,0 +1,42 @@
+package renderer
+
+import (
+	"github.com/go-text/typesetting/segmenter"
+)
+
+// lineBreakSegments splits text at UAX #14 line break opportunities
+// Each segment keeps the white space that trails it, so joining the
+// segments gives back the original text
+func lineBreakSegments(text string) []string {
+	if text == "" {
+		return nil
+	}
+
+	var seg segmenter.Segmenter
+	seg.Init([]rune(text))
+
+	segments := make([]string, 0)
+	iter := seg.LineIterator()
+	for iter.Next() {
+		segments = append(segments, string(iter.Line().Text))
+	}
+	return segments
+}
+
+// graphemeClusters splits text into UAX #29 extended grapheme clusters
+// so that combining marks, emoji sequences and Hangul syllables stay whole
+func graphemeClusters(text string) []string {
+	if text == "" {
+		return nil
+	}
+
+	var seg segmenter.Segmenter
+	seg.Init([]rune(text))
+
+	clusters := make([]string, 0, len(text))
+	iter := seg.GraphemeIterator()
+	for iter.Next() {
+		clusters = append(clusters, string(iter.Grapheme().Text))
+	}
+	return clusters
+}
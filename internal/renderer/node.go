@@ -30,11 +30,15 @@ type RenderNode struct {
 	TagName       string            // HTML tag name (e.g., "div", "p", "h1")
 	Text          string            // Text content for text nodes
 	Attrs         map[string]string // HTML attributes
+	Source        *html.Node        // Element the node was built from, nil for text and anonymous nodes
 	Children      []*RenderNode     // Child nodes
 	Parent        *RenderNode       // Parent node
 	ComputedStyle *Style
 	Box           *Box
 	ImageData     *image.ImageData // For `<img>` elements
+	
+	// Images of url() background layers, by layer index
+	BackgroundImages []*image.ImageData
 }
 
 // Style represents computed styles for a node (placeholder for future CSS support)
@@ -44,11 +48,42 @@ type Style struct {
 	FontWeight      string
 	Color           color.Color
 	BackgroundColor color.Color
+	
+	// Background layers, first layer on top; each list holds one value per
+	// layer and repeats when it is shorter than BackgroundImage
+	BackgroundImage      []string
+	BackgroundPosition   []string
+	BackgroundSize       []string
+	BackgroundRepeat     []string
+	BackgroundAttachment []string
+	BackgroundOrigin     []string
+	BackgroundClip       []string
+	
 	Width           string
 	Height          string
 	FontFamily      string
+	FontStyle       string
 	Opacity         float32
 	
+	// Transform properties, parsed when the box is laid out
+	Transform       string
+	TransformOrigin string
+	
+	// Transition and animation properties; each list holds one value per
+	// transition or animation and repeats when it is shorter than the names
+	TransitionProperty       []string
+	TransitionDuration       []string
+	TransitionTimingFunction []string
+	TransitionDelay          []string
+	AnimationName            []string
+	AnimationDuration        []string
+	AnimationTimingFunction  []string
+	AnimationDelay           []string
+	AnimationIterationCount  []string
+	AnimationDirection       []string
+	AnimationFillMode        []string
+	AnimationPlayState       []string
+	
 	// Box model properties
 	MarginTop       string
 	MarginRight     string
@@ -74,6 +109,48 @@ type Style struct {
 	BorderRightColor   color.Color
 	BorderBottomColor  color.Color
 	BorderLeftColor    color.Color
+	
+	// Border radius per corner: a length or percentage, or horizontal and vertical radii
+	BorderTopLeftRadius     string
+	BorderTopRightRadius    string
+	BorderBottomRightRadius string
+	BorderBottomLeftRadius  string
+	
+	// Box decoration properties
+	BoxShadow          []BoxShadow // Shadows in paint order, front-most first
+	OutlineWidth       string
+	OutlineStyle       string
+	OutlineColor       color.Color
+	OutlineOffset      string
+	
+	// Overflow properties
+	OverflowX          string
+	OverflowY          string
+	
+	// Positioning properties
+	Position           string // "static" or "fixed"
+	
+	// Text properties
+	WhiteSpace         string
+	TextAlign          string
+	LineHeight         string
+	LetterSpacing      string
+	WordSpacing        string
+	TextIndent         string
+	TextTransform      string
+	VerticalAlign      string
+	Direction          string
+	UnicodeBidi        string
+}
+
+// BoxShadow is one shadow of the CSS box-shadow property
+type BoxShadow struct {
+	OffsetX string
+	OffsetY string
+	Blur    string
+	Spread  string
+	Color   color.Color // Nil for the current text color
+	Inset   bool
 }
 
 // Box represents the layout box for a render node
@@ -129,6 +206,11 @@ func (n *RenderNode) IsBlock() bool {
 	return blockElements[n.TagName]
 }
 
+// IsFixed returns true if the node is positioned relative to the viewport
+func (n *RenderNode) IsFixed() bool {
+	return n.ComputedStyle != nil && n.ComputedStyle.Position == "fixed"
+}
+
 // BuildRenderTree builds a render tree from an HTML node
 func BuildRenderTree(htmlNode *html.Node) *RenderNode {
 	if htmlNode == nil {
@@ -170,6 +252,7 @@ func processElementNode(htmlNode *html.Node) *RenderNode {
 	}
 	node := NewRenderNode(NodeTypeElement)
 	node.TagName = htmlNode.Data
+	node.Source = htmlNode
 	for _, attr := range htmlNode.Attr {
 		node.SetAttribute(attr.Key, attr.Val)
 	}
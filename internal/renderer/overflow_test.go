@@ -0,0 +1,310 @@
+package renderer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vyquocvu/goosie/internal/css"
+	"golang.org/x/net/html"
+)
+
+// layoutOverflowHTML parses, styles and lays out an HTML document
+func layoutOverflowHTML(t *testing.T, le *LayoutEngine, htmlContent string) (*RenderNode, *LayoutBox) {
+	t.Helper()
+	doc, err := html.Parse(strings.NewReader(htmlContent))
+	if err != nil {
+		t.Fatalf("html.Parse failed: %v", err)
+	}
+
+	renderTree := BuildRenderTree(findBodyNode(doc))
+	if renderTree == nil {
+		t.Fatal("BuildRenderTree returned nil")
+	}
+	NewStyleManager(extractAndParseCSS(doc)).ApplyStyles(renderTree)
+
+	return renderTree, le.ComputeLayout(renderTree)
+}
+
+// findLayoutBoxByTag returns the layout box of the first node with the given tag
+func findLayoutBoxByTag(le *LayoutEngine, renderTree *RenderNode, tagName string) *LayoutBox {
+	node := findNodeByTag(renderTree, tagName)
+	if node == nil {
+		return nil
+	}
+	return le.GetLayoutBox(node.ID)
+}
+
+const nestedScrollHTML = `
+<html>
+	<head>
+		<style>
+			section { overflow: auto; height: 100px; }
+			article { overflow-y: scroll; height: 60px; }
+			p { height: 40px; }
+		</style>
+	</head>
+	<body>
+		<section>
+			<article><p>one</p><p>two</p><p>three</p></article>
+			<p>four</p><p>five</p><p>six</p>
+		</section>
+	</body>
+</html>`
+
+func TestParseOverflowMode(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected OverflowMode
+	}{
+		{"", OverflowVisible},
+		{"visible", OverflowVisible},
+		{"hidden", OverflowHidden},
+		{"SCROLL", OverflowScroll},
+		{" auto ", OverflowAuto},
+		{"clip", OverflowClip},
+		{"overlay", OverflowVisible},
+	}
+
+	for _, tt := range tests {
+		if got := ParseOverflowMode(tt.value); got != tt.expected {
+			t.Errorf("ParseOverflowMode(%q) = %q, expected %q", tt.value, got, tt.expected)
+		}
+	}
+}
+
+func TestOverflowStyleParsing(t *testing.T) {
+	node := NewRenderNode(NodeTypeElement)
+	node.ComputedStyle = &Style{}
+	sm := NewStyleManager(nil)
+
+	sm.applyDeclaration(node, css.Declaration{Property: "overflow", Value: "hidden scroll"})
+	if node.ComputedStyle.OverflowX != "hidden" || node.ComputedStyle.OverflowY != "scroll" {
+		t.Errorf("Expected overflow hidden/scroll, got %q/%q", node.ComputedStyle.OverflowX, node.ComputedStyle.OverflowY)
+	}
+
+	sm.applyDeclaration(node, css.Declaration{Property: "overflow", Value: "auto"})
+	if node.ComputedStyle.OverflowX != "auto" || node.ComputedStyle.OverflowY != "auto" {
+		t.Errorf("Expected overflow auto/auto, got %q/%q", node.ComputedStyle.OverflowX, node.ComputedStyle.OverflowY)
+	}
+
+	sm.applyDeclaration(node, css.Declaration{Property: "overflow-x", Value: "clip"})
+	if node.ComputedStyle.OverflowX != "clip" {
+		t.Errorf("Expected overflow-x clip, got %q", node.ComputedStyle.OverflowX)
+	}
+}
+
+func TestOverflowVisibleComputesToAuto(t *testing.T) {
+	le := NewLayoutEngine(800, 600)
+	renderTree, _ := layoutOverflowHTML(t, le, `<html><head><style>div { overflow-y: hidden; height: 10px; } p { height: 50px; }</style></head><body><div><p>x</p></div></body></html>`)
+
+	box := findLayoutBoxByTag(le, renderTree, "div")
+	if box == nil {
+		t.Fatal("div layout box not found")
+	}
+	if box.OverflowX != OverflowAuto {
+		t.Errorf("Expected overflow-x to compute to auto, got %q", box.OverflowX)
+	}
+	if !box.ClipsContent() || !box.IsScrollContainer() {
+		t.Error("Expected div to clip and be a scroll container")
+	}
+	if box.MaxScrollY() <= 0 {
+		t.Fatal("Expected the div to overflow vertically")
+	}
+	if box.CanScroll(0, 10) {
+		t.Error("Expected overflow-y: hidden not to be user scrollable vertically")
+	}
+	if !le.ScrollTo(box, 0, 10) {
+		t.Error("Expected overflow-y: hidden to be scrollable programmatically")
+	}
+}
+
+func TestScrollOverflowExtents(t *testing.T) {
+	le := NewLayoutEngine(800, 600)
+	renderTree, _ := layoutOverflowHTML(t, le, nestedScrollHTML)
+
+	section := findLayoutBoxByTag(le, renderTree, "section")
+	article := findLayoutBoxByTag(le, renderTree, "article")
+	if section == nil || article == nil {
+		t.Fatal("scroll container layout boxes not found")
+	}
+
+	if section.Box.Height != 100 {
+		t.Errorf("Expected section height 100, got %f", section.Box.Height)
+	}
+	if article.Box.Height != 60 {
+		t.Errorf("Expected article height 60, got %f", article.Box.Height)
+	}
+
+	// The article clips its own overflow, so only its border box counts for the section
+	if article.ScrollHeight < 120 {
+		t.Errorf("Expected article scroll height >= 120, got %f", article.ScrollHeight)
+	}
+	if section.ScrollHeight < 180 {
+		t.Errorf("Expected section scroll height >= 180, got %f", section.ScrollHeight)
+	}
+	if article.MaxScrollY() != article.ScrollHeight-60 {
+		t.Errorf("Expected article max scroll %f, got %f", article.ScrollHeight-60, article.MaxScrollY())
+	}
+	if article.MaxScrollX() != 0 {
+		t.Errorf("Expected no horizontal overflow, got %f", article.MaxScrollX())
+	}
+}
+
+func TestScrollToClampsAndPersists(t *testing.T) {
+	le := NewLayoutEngine(800, 600)
+	renderTree, _ := layoutOverflowHTML(t, le, nestedScrollHTML)
+
+	article := findLayoutBoxByTag(le, renderTree, "article")
+	if !le.ScrollTo(article, 0, 1000) {
+		t.Fatal("Expected ScrollTo to change the offset")
+	}
+	if article.ScrollY != article.MaxScrollY() {
+		t.Errorf("Expected scroll to clamp to %f, got %f", article.MaxScrollY(), article.ScrollY)
+	}
+	if le.ScrollTo(article, 0, 2000) {
+		t.Error("Expected ScrollTo at the limit to report no change")
+	}
+
+	// Relayout keeps the scroll position
+	le.ComputeLayout(renderTree)
+	article = findLayoutBoxByTag(le, renderTree, "article")
+	if article.ScrollY != article.MaxScrollY() {
+		t.Errorf("Expected scroll offset to survive relayout, got %f", article.ScrollY)
+	}
+	if _, y := le.GetScrollOffset(article.NodeID); y != article.ScrollY {
+		t.Errorf("Expected remembered offset %f, got %f", article.ScrollY, y)
+	}
+
+	// Boxes with visible overflow cannot be scrolled
+	body := le.GetLayoutBox(renderTree.ID)
+	if le.ScrollTo(body, 0, 10) {
+		t.Error("Expected ScrollTo on a non-scroll container to fail")
+	}
+}
+
+func TestFindScrollTargetChaining(t *testing.T) {
+	le := NewLayoutEngine(800, 600)
+	renderTree, layoutRoot := layoutOverflowHTML(t, le, nestedScrollHTML)
+
+	section := findLayoutBoxByTag(le, renderTree, "section")
+	article := findLayoutBoxByTag(le, renderTree, "article")
+	x := article.Box.X + 5
+	y := article.Box.Y + 5
+
+	// The inner container scrolls first
+	if target := le.FindScrollTarget(layoutRoot, x, y, 0, 20); target != article {
+		t.Fatalf("Expected article to be the scroll target, got %v", target)
+	}
+
+	// Scrolling up at the top has nowhere to go
+	if target := le.FindScrollTarget(layoutRoot, x, y, 0, -20); target != nil {
+		t.Errorf("Expected no scroll target when scrolling up at the top, got node %d", target.NodeID)
+	}
+
+	// Once the inner container is at its limit, scrolling chains to the ancestor
+	le.ScrollTo(article, 0, article.MaxScrollY())
+	if target := le.FindScrollTarget(layoutRoot, x, y, 0, 20); target != section {
+		t.Errorf("Expected section to be the scroll target, got %v", target)
+	}
+}
+
+func TestHitTestWithScrollOffset(t *testing.T) {
+	le := NewLayoutEngine(800, 600)
+	renderTree, layoutRoot := layoutOverflowHTML(t, le, nestedScrollHTML)
+
+	section := findLayoutBoxByTag(le, renderTree, "section")
+	x := section.Box.X + 5
+
+	// Points below the clip box of the section don't hit its content
+	below := section.Box.Y + section.Box.Height + 10
+	for _, box := range le.HitTestPath(layoutRoot, x, below) {
+		if box == section {
+			t.Fatal("Expected point below the section not to hit it")
+		}
+	}
+
+	// After scrolling the section to the bottom, its last paragraph is visible
+	le.ScrollTo(section, 0, section.MaxScrollY())
+	last := section.Children[len(section.Children)-1]
+	hit := le.HitTest(layoutRoot, x, section.Box.Y+section.Box.Height-5)
+	path := le.HitTestPath(layoutRoot, x, section.Box.Y+section.Box.Height-5)
+	found := false
+	for _, box := range path {
+		if box == last {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected scrolled hit test to reach the last paragraph, got node %d", hit)
+	}
+}
+
+func TestDisplayListClipCommands(t *testing.T) {
+	le := NewLayoutEngine(800, 600)
+	renderTree, layoutRoot := layoutOverflowHTML(t, le, nestedScrollHTML)
+
+	article := findLayoutBoxByTag(le, renderTree, "article")
+	le.ScrollTo(article, 0, 30)
+
+	displayList := NewDisplayListBuilder().Build(layoutRoot, renderTree)
+
+	depth := 0
+	pushes := 0
+	var articleClip *PaintCommand
+	for _, cmd := range displayList.Commands {
+		switch cmd.Type {
+		case PaintPushClip:
+			depth++
+			pushes++
+			if cmd.NodeID == article.NodeID {
+				articleClip = cmd
+			}
+		case PaintPopClip:
+			depth--
+			if depth < 0 {
+				t.Fatal("Unbalanced PaintPopClip")
+			}
+		}
+	}
+	if depth != 0 {
+		t.Fatalf("Expected balanced clip commands, depth is %d", depth)
+	}
+	if pushes != 2 {
+		t.Errorf("Expected 2 clip commands, got %d", pushes)
+	}
+	if articleClip == nil {
+		t.Fatal("Expected a clip command for the article")
+	}
+	if articleClip.ScrollY != 30 || !articleClip.UserScrollable {
+		t.Errorf("Expected scrollable clip with offset 30, got %f (%v)", articleClip.ScrollY, articleClip.UserScrollable)
+	}
+
+	// Content of the article is painted shifted by its scroll offset
+	firstParagraph := article.Children[0]
+	for _, cmd := range displayList.Commands {
+		if cmd.Type == PaintText && cmd.NodeID == firstParagraph.NodeID {
+			if cmd.Box.Y != firstParagraph.Box.Y-30 {
+				t.Errorf("Expected text at %f, got %f", firstParagraph.Box.Y-30, cmd.Box.Y)
+			}
+		}
+	}
+}
+
+func TestCanvasRendererScrollAt(t *testing.T) {
+	r := NewRenderer(800, 600)
+	_, err := r.RenderHTML(nestedScrollHTML)
+	if err != nil {
+		t.Fatalf("RenderHTML failed: %v", err)
+	}
+
+	article := findLayoutBoxByTag(r.layoutEngine, r.currentRenderTree, "article")
+	if !r.canvasRenderer.ScrollAt(article.Box.X+5, article.Box.Y+5, 0, 25) {
+		t.Fatal("Expected ScrollAt to scroll the article")
+	}
+	if article.ScrollY != 25 {
+		t.Errorf("Expected article scroll offset 25, got %f", article.ScrollY)
+	}
+	if r.canvasRenderer.cachedDisplayList != nil {
+		t.Error("Expected ScrollAt to invalidate the cached display list")
+	}
+}
@@ -0,0 +1,495 @@
+package renderer
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/theme"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/f64"
+	"golang.org/x/image/math/fixed"
+)
+
+// linkColor is the color of link text without a CSS color
+var linkColor = color.RGBA{R: 0, G: 0, B: 238, A: 255}
+
+// RasterRenderer paints display lists into images in software, so pages can
+// be rendered without a window, display or GPU. Text is drawn with
+// golang.org/x/image using Fyne's bundled fonts and loaded web fonts.
+// A RasterRenderer is not safe for concurrent use.
+type RasterRenderer struct {
+	background  color.Color
+	fontFaces   *FontFaceSet
+	fontMetrics *FontMetrics
+
+	// Parsed fonts by resource, and faces by font and size
+	fonts map[fyne.Resource]*opentype.Font
+	faces map[rasterFaceKey]font.Face
+}
+
+// rasterFaceKey identifies a font face at a size
+type rasterFaceKey struct {
+	font *opentype.Font
+	size float32
+}
+
+// NewRasterRenderer creates a software renderer that paints on a white background
+func NewRasterRenderer() *RasterRenderer {
+	return &RasterRenderer{
+		background:  color.White,
+		fontMetrics: NewFontMetrics(16.0),
+		fonts:       make(map[fyne.Resource]*opentype.Font),
+		faces:       make(map[rasterFaceKey]font.Face),
+	}
+}
+
+// SetBackground sets the color the page is painted on
+func (rr *RasterRenderer) SetBackground(background color.Color) {
+	rr.background = background
+}
+
+// SetFontFaces sets the web fonts of the document being painted
+func (rr *RasterRenderer) SetFontFaces(fonts *FontFaceSet) {
+	rr.fontFaces = fonts
+}
+
+// Render paints a display list into a new image of the given size
+func (rr *RasterRenderer) Render(displayList *DisplayList, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(rr.background), image.Point{}, draw.Src)
+	rr.Paint(dst, displayList)
+	return dst
+}
+
+// RenderPNG paints a display list and writes it to w as a PNG image
+func (rr *RasterRenderer) RenderPNG(w io.Writer, displayList *DisplayList, width, height int) error {
+	return png.Encode(w, rr.Render(displayList, width, height))
+}
+
+// Paint paints a display list over dst. Commands are in page coordinates, so
+// an image whose bounds do not start at the origin receives that part of the page.
+// Translucent layers are painted into a separate image and blended when they end.
+func (rr *RasterRenderer) Paint(dst *image.RGBA, displayList *DisplayList) {
+	if displayList == nil {
+		return
+	}
+
+	target := dst
+	clip := dst.Bounds()
+	var clips []image.Rectangle
+	var layers []rasterLayer
+	var extent *image.Rectangle
+	for _, cmd := range displayList.Commands {
+		switch cmd.Type {
+		case PaintPushClip:
+			clips = append(clips, clip)
+			clip = clip.Intersect(pixelRect(cmd.Box))
+		case PaintPopClip:
+			if len(clips) > 0 {
+				clip = clips[len(clips)-1]
+				clips = clips[:len(clips)-1]
+			}
+		case PaintPushLayer:
+			layers = append(layers, rasterLayer{dst: target, clip: clip, opacity: cmd.Opacity, transform: cmd.Transform})
+			switch {
+			case cmd.Transform != nil:
+				// Paint the untransformed content that can land inside the clip,
+				// bounded by the extent of the page so shrunk layers stay small
+				inverse, ok := invertAff3(*cmd.Transform)
+				if !ok {
+					clip = image.Rectangle{}
+				} else {
+					if extent == nil {
+						extent = displayListExtent(displayList)
+					}
+					clip = transformBounds(inverse, clip).Intersect(*extent)
+				}
+				target = image.NewRGBA(clip)
+			case cmd.Opacity > 0 && cmd.Opacity < 1:
+				target = image.NewRGBA(clip)
+			}
+		case PaintPopLayer:
+			if len(layers) > 0 {
+				layer := layers[len(layers)-1]
+				layers = layers[:len(layers)-1]
+				switch {
+				case layer.transform != nil:
+					drawTransformed(layer.dst.SubImage(layer.clip).(*image.RGBA), target, *layer.transform, layer.opacity)
+				case target != layer.dst:
+					drawWithOpacity(layer.dst, target, layer.opacity)
+				}
+				target = layer.dst
+				clip = layer.clip
+			}
+		default:
+			if clip.Empty() {
+				continue
+			}
+			rr.paintCommand(target.SubImage(clip).(*image.RGBA), cmd)
+		}
+	}
+}
+
+// rasterLayer is a layer being painted: the image and clip to draw it into
+// when it ends, its opacity and its transform
+type rasterLayer struct {
+	dst       *image.RGBA
+	clip      image.Rectangle
+	opacity   float32
+	transform *f64.Aff3
+}
+
+// displayListExtent returns the pixels reached by the commands of a display list
+func displayListExtent(displayList *DisplayList) *image.Rectangle {
+	var extent image.Rectangle
+	for _, cmd := range displayList.Commands {
+		switch cmd.Type {
+		case PaintPushClip, PaintPopClip, PaintPushLayer, PaintPopLayer:
+			continue
+		}
+		extent = extent.Union(commandExtent(cmd))
+	}
+	return &extent
+}
+
+// drawWithOpacity blends src over dst at the given opacity
+func drawWithOpacity(dst draw.Image, src *image.RGBA, opacity float32) {
+	mask := image.NewUniform(color.Alpha{A: uint8(math.Round(float64(opacity) * 255))})
+	draw.DrawMask(dst, src.Bounds(), src, src.Bounds().Min, mask, image.Point{}, draw.Over)
+}
+
+// drawTransformed maps src through m and blends it over dst at the given
+// opacity, where an opacity of 0 means unset
+func drawTransformed(dst *image.RGBA, src *image.RGBA, m f64.Aff3, opacity float32) {
+	if src.Bounds().Empty() || dst.Bounds().Empty() {
+		return
+	}
+	if opacity > 0 && opacity < 1 {
+		tmp := image.NewRGBA(dst.Bounds())
+		transformImage(tmp, m, src)
+		drawWithOpacity(dst, tmp, opacity)
+		return
+	}
+	transformImage(dst, m, src)
+}
+
+// transformImage draws src mapped through m over dst. Integer translations
+// are drawn directly, as the shortcut xdraw takes for them misplaces sources
+// whose bounds start at different x and y.
+func transformImage(dst draw.Image, m f64.Aff3, src *image.RGBA) {
+	if m[0] == 1 && m[1] == 0 && m[3] == 0 && m[4] == 1 && m[2] == math.Trunc(m[2]) && m[5] == math.Trunc(m[5]) {
+		offset := image.Pt(int(m[2]), int(m[5]))
+		draw.Draw(dst, src.Bounds().Add(offset), src, src.Bounds().Min, draw.Over)
+		return
+	}
+	xdraw.ApproxBiLinear.Transform(dst, m, src, src.Bounds(), draw.Over, nil)
+}
+
+// paintCommand paints a single command, clipped to the bounds of dst
+func (rr *RasterRenderer) paintCommand(dst *image.RGBA, cmd *PaintCommand) {
+	switch cmd.Type {
+	case PaintRect:
+		fillRoundedRect(dst, cmd.Box, cmd.Radii, cmd.FillColor)
+		if cmd.StrokeWidth > 0 {
+			strokeRect(dst, cmd.Box, cmd.StrokeColor, cmd.StrokeWidth)
+		}
+
+	case PaintBorder:
+		if !cmd.Radii.IsZero() {
+			paintRoundedBorder(dst, cmd)
+			return
+		}
+		rr.paintBorder(dst, cmd)
+
+	case PaintBoxShadow:
+		paintBoxShadow(dst, cmd)
+
+	case PaintBackgroundImage, PaintGradient:
+		paintBackground(dst, cmd)
+
+	case PaintText:
+		rr.paintText(dst, cmd)
+
+	case PaintLink:
+		face, hidden := rr.face(cmd)
+		if face == nil || hidden {
+			return
+		}
+		drawWrappedText(dst, face, cmd.LinkText, cmd.Box, linkColor, true, false)
+
+	case PaintImage:
+		rr.paintImage(dst, cmd)
+	}
+}
+
+// paintBorder paints the four sides of a border; sides meet at corners without overlapping
+func (rr *RasterRenderer) paintBorder(dst *image.RGBA, cmd *PaintCommand) {
+	box := cmd.Box
+	if borderSideVisible(cmd.BorderTopWidth, cmd.BorderTopStyle) {
+		fillRect(dst, Rect{X: box.X, Y: box.Y, Width: box.Width, Height: cmd.BorderTopWidth}, cmd.BorderTopColor)
+	}
+	if borderSideVisible(cmd.BorderBottomWidth, cmd.BorderBottomStyle) {
+		fillRect(dst, Rect{X: box.X, Y: box.Y + box.Height - cmd.BorderBottomWidth, Width: box.Width, Height: cmd.BorderBottomWidth}, cmd.BorderBottomColor)
+	}
+	sideHeight := box.Height - cmd.BorderTopWidth - cmd.BorderBottomWidth
+	if borderSideVisible(cmd.BorderLeftWidth, cmd.BorderLeftStyle) {
+		fillRect(dst, Rect{X: box.X, Y: box.Y + cmd.BorderTopWidth, Width: cmd.BorderLeftWidth, Height: sideHeight}, cmd.BorderLeftColor)
+	}
+	if borderSideVisible(cmd.BorderRightWidth, cmd.BorderRightStyle) {
+		fillRect(dst, Rect{X: box.X + box.Width - cmd.BorderRightWidth, Y: box.Y + cmd.BorderTopWidth, Width: cmd.BorderRightWidth, Height: sideHeight}, cmd.BorderRightColor)
+	}
+}
+
+// borderSideVisible reports whether a border side is painted
+func borderSideVisible(width float32, style string) bool {
+	return width > 0 && style != "" && style != "none"
+}
+
+// paintText paints a text command at the positions inline layout gave its
+// fragments, or wrapped inside its box when it has none
+func (rr *RasterRenderer) paintText(dst *image.RGBA, cmd *PaintCommand) {
+	if strings.TrimSpace(cmd.Text) == "" {
+		return
+	}
+	face, hidden := rr.face(cmd)
+	if face == nil || hidden {
+		// Text waiting for a web font in its block period is invisible
+		return
+	}
+
+	textColor, underline := rasterTextColor(cmd.Node)
+	if len(cmd.Fragments) == 0 {
+		drawWrappedText(dst, face, cmd.Text, cmd.Box, textColor, underline, preservesNewlines(cmd.Node))
+		return
+	}
+
+	for _, fragment := range cmd.Fragments {
+		text := strings.ReplaceAll(fragment.Text, "\t", "    ")
+		if fragment.BidiLevel%2 == 1 {
+			text = bidiVisualText(text)
+		}
+		drawText(dst, face, text, fragment.Box.X, fragment.Box.Y+fragment.Baseline, textColor, underline)
+	}
+}
+
+// paintImage paints a loaded image scaled to its box, or its alt text while
+// the placeholder rectangle stands in for it
+func (rr *RasterRenderer) paintImage(dst *image.RGBA, cmd *PaintCommand) {
+	if img := commandImage(cmd); img != nil {
+		xdraw.ApproxBiLinear.Scale(dst, pixelRect(cmd.Box), img, img.Bounds(), draw.Over, nil)
+		return
+	}
+
+	if cmd.ImageAlt == "" {
+		return
+	}
+	face, hidden := rr.face(cmd)
+	if face == nil || hidden {
+		return
+	}
+	inset := Rect{X: cmd.Box.X + 4, Y: cmd.Box.Y + 4, Width: cmd.Box.Width - 8, Height: cmd.Box.Height - 8}
+	drawWrappedText(dst, face, cmd.ImageAlt, inset, color.RGBA{R: 80, G: 80, B: 80, A: 255}, false, false)
+}
+
+// face returns the font face a command is painted with, and whether its text
+// is hidden while a web font loads. Web fonts are used when loaded; other
+// families fall back to Fyne's bundled fonts.
+func (rr *RasterRenderer) face(cmd *PaintCommand) (font.Face, bool) {
+	style := fyne.TextStyle{Bold: cmd.Bold, Italic: cmd.Italic}
+	size := cmd.FontSize
+	if cmd.Node != nil {
+		style.Monospace = rr.fontMetrics.GetTextStyleFromNode(cmd.Node).Monospace
+		if computed := cmd.Node.ComputedStyle; computed != nil && computed.FontSize > 0 {
+			size = computed.FontSize
+		}
+	}
+	if size <= 0 {
+		size = rr.fontMetrics.defaultFontSize
+	}
+	for _, family := range ParseFontFamilyList(cmd.FontFamily) {
+		if strings.EqualFold(family, "monospace") {
+			style.Monospace = true
+			break
+		}
+	}
+
+	resource, hidden := paintFontSource(rr.fontFaces, cmd)
+	if hidden {
+		return nil, true
+	}
+	var parsed *opentype.Font
+	if resource != nil {
+		parsed = rr.parseFont(resource)
+	}
+	if parsed == nil {
+		parsed = rr.parseFont(bundledFont(style))
+	}
+	if parsed == nil {
+		return nil, false
+	}
+
+	key := rasterFaceKey{font: parsed, size: size}
+	if face, ok := rr.faces[key]; ok {
+		return face, false
+	}
+	face, err := opentype.NewFace(parsed, &opentype.FaceOptions{Size: float64(size), DPI: 72, Hinting: font.HintingNone})
+	if err != nil {
+		return nil, false
+	}
+	rr.faces[key] = face
+	return face, false
+}
+
+// parseFont parses a font resource once, returning nil if it is not a valid font
+func (rr *RasterRenderer) parseFont(resource fyne.Resource) *opentype.Font {
+	parsed, ok := rr.fonts[resource]
+	if !ok {
+		parsed, _ = opentype.Parse(resource.Content())
+		rr.fonts[resource] = parsed
+	}
+	return parsed
+}
+
+// bundledFont returns the Fyne font resource for a text style
+func bundledFont(style fyne.TextStyle) fyne.Resource {
+	switch {
+	case style.Monospace:
+		return theme.DefaultTextMonospaceFont()
+	case style.Bold && style.Italic:
+		return theme.DefaultTextBoldItalicFont()
+	case style.Bold:
+		return theme.DefaultTextBoldFont()
+	case style.Italic:
+		return theme.DefaultTextItalicFont()
+	default:
+		return theme.DefaultTextFont()
+	}
+}
+
+// rasterTextColor returns the color of a text node, and whether it is
+// underlined because it is inside a link
+func rasterTextColor(node *RenderNode) (color.Color, bool) {
+	var textColor color.Color
+	for current := node; current != nil; current = current.Parent {
+		if textColor == nil && current.ComputedStyle != nil && current.ComputedStyle.Color != nil {
+			textColor = current.ComputedStyle.Color
+		}
+		if current.TagName == "a" {
+			if href, ok := current.GetAttribute("href"); ok && href != "" {
+				if textColor == nil {
+					textColor = linkColor
+				}
+				return textColor, true
+			}
+		}
+	}
+	if textColor == nil {
+		textColor = color.Black
+	}
+	return textColor, false
+}
+
+// preservesNewlines reports whether the white-space mode of a node keeps newlines
+func preservesNewlines(node *RenderNode) bool {
+	if node == nil {
+		return false
+	}
+	for current := node; current != nil; current = current.Parent {
+		if current.TagName == "pre" {
+			return true
+		}
+	}
+	switch ParseWhiteSpaceMode(inheritedStyleValue(node, func(s *Style) string { return s.WhiteSpace })) {
+	case WhiteSpacePre, WhiteSpacePreWrap, WhiteSpacePreLine:
+		return true
+	}
+	return false
+}
+
+// drawText draws a single line of text with its baseline at y
+func drawText(dst *image.RGBA, face font.Face, text string, x, y float32, textColor color.Color, underline bool) {
+	drawer := &font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(textColor),
+		Face: face,
+		Dot:  fixed.Point26_6{X: toFixed(x), Y: toFixed(y)},
+	}
+	drawer.DrawString(text)
+
+	if underline {
+		size := float32(face.Metrics().Height.Round())
+		thickness := max(1, size/16)
+		width := float32(drawer.Dot.X-toFixed(x)) / 64
+		fillRect(dst, Rect{X: x, Y: y + thickness*1.5, Width: width, Height: thickness}, textColor)
+	}
+}
+
+// drawWrappedText draws text inside a box, wrapping it at line break opportunities
+func drawWrappedText(dst *image.RGBA, face font.Face, text string, box Rect, textColor color.Color, underline, preserveNewlines bool) {
+	metrics := face.Metrics()
+	ascent := float32(metrics.Ascent) / 64
+	lineHeight := float32(metrics.Height) / 64
+
+	paragraphs := []string{strings.Join(strings.Fields(text), " ")}
+	if preserveNewlines {
+		paragraphs = strings.Split(strings.ReplaceAll(text, "\t", "    "), "\n")
+	}
+
+	y := box.Y + ascent
+	for _, paragraph := range paragraphs {
+		x := box.X
+		for _, segment := range lineBreakSegments(paragraph) {
+			word := strings.TrimRight(segment, " ")
+			width := float32(font.MeasureString(face, word)) / 64
+			if x > box.X && x+width > box.X+box.Width {
+				x = box.X
+				y += lineHeight
+			}
+			drawText(dst, face, word, x, y, textColor, underline)
+			x += float32(font.MeasureString(face, segment)) / 64
+		}
+		y += lineHeight
+	}
+}
+
+// fillRect blends a color over a rectangle of dst
+func fillRect(dst *image.RGBA, r Rect, fill color.Color) {
+	if fill == nil {
+		return
+	}
+	if _, _, _, a := fill.RGBA(); a == 0 {
+		return
+	}
+	draw.Draw(dst, pixelRect(r).Intersect(dst.Bounds()), image.NewUniform(fill), image.Point{}, draw.Over)
+}
+
+// strokeRect draws the outline of a rectangle inside its edges
+func strokeRect(dst *image.RGBA, r Rect, stroke color.Color, width float32) {
+	fillRect(dst, Rect{X: r.X, Y: r.Y, Width: r.Width, Height: width}, stroke)
+	fillRect(dst, Rect{X: r.X, Y: r.Y + r.Height - width, Width: r.Width, Height: width}, stroke)
+	fillRect(dst, Rect{X: r.X, Y: r.Y + width, Width: width, Height: r.Height - 2*width}, stroke)
+	fillRect(dst, Rect{X: r.X + r.Width - width, Y: r.Y + width, Width: width, Height: r.Height - 2*width}, stroke)
+}
+
+// pixelRect rounds a rectangle to whole pixels
+func pixelRect(r Rect) image.Rectangle {
+	return image.Rect(
+		int(math.Round(float64(r.X))),
+		int(math.Round(float64(r.Y))),
+		int(math.Round(float64(r.X+r.Width))),
+		int(math.Round(float64(r.Y+r.Height))),
+	)
+}
+
+// toFixed converts a float to 26.6 fixed point
+func toFixed(v float32) fixed.Int26_6 {
+	return fixed.Int26_6(math.Round(float64(v) * 64))
+}
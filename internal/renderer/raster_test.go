@@ -0,0 +1,258 @@
+package renderer
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	imageloader "github.com/vyquocvu/goosie/internal/image"
+)
+
+var (
+	testRed  = color.RGBA{R: 255, A: 255}
+	testBlue = color.RGBA{B: 255, A: 255}
+)
+
+// sameColor reports whether a pixel has exactly the expected color
+func sameColor(img image.Image, x, y int, expected color.Color) bool {
+	r1, g1, b1, a1 := img.At(x, y).RGBA()
+	r2, g2, b2, a2 := expected.RGBA()
+	return r1 == r2 && g1 == g2 && b1 == b2 && a1 == a2
+}
+
+// countInkPixels counts pixels inside r that differ from white
+func countInkPixels(img image.Image, r image.Rectangle) int {
+	count := 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if !sameColor(img, x, y, color.White) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// rasterizeHTML lays out an HTML document and paints it into an image
+func rasterizeHTML(t *testing.T, htmlStr string, width, height int) (*image.RGBA, *DisplayList) {
+	t.Helper()
+	renderTree, err := parseHTMLToRenderTree(htmlStr)
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+	layoutRoot := NewLayoutEngine(float32(width), float32(height)).ComputeLayout(renderTree)
+	displayList := NewDisplayListBuilder().Build(layoutRoot, renderTree)
+	return NewRasterRenderer().Render(displayList, width, height), displayList
+}
+
+func TestRasterRendererRects(t *testing.T) {
+	dl := NewDisplayList()
+	dl.AddCommand(&PaintCommand{
+		Type:        PaintRect,
+		Box:         Rect{X: 10, Y: 10, Width: 30, Height: 20},
+		FillColor:   testRed,
+		StrokeColor: testBlue,
+		StrokeWidth: 2,
+	})
+
+	img := NewRasterRenderer().Render(dl, 50, 50)
+	if img.Bounds() != image.Rect(0, 0, 50, 50) {
+		t.Fatalf("Expected a 50x50 image, got %v", img.Bounds())
+	}
+	if !sameColor(img, 5, 5, color.White) {
+		t.Errorf("Expected the background to be white, got %v", img.At(5, 5))
+	}
+	if !sameColor(img, 25, 20, testRed) {
+		t.Errorf("Expected the fill color inside the rectangle, got %v", img.At(25, 20))
+	}
+	for _, p := range []image.Point{{10, 15}, {11, 15}, {39, 15}, {25, 10}, {25, 29}} {
+		if !sameColor(img, p.X, p.Y, testBlue) {
+			t.Errorf("Expected the stroke color at %v, got %v", p, img.At(p.X, p.Y))
+		}
+	}
+	if !sameColor(img, 40, 15, color.White) || !sameColor(img, 25, 30, color.White) {
+		t.Error("Expected nothing painted outside the rectangle")
+	}
+}
+
+func TestRasterRendererBorders(t *testing.T) {
+	dl := NewDisplayList()
+	dl.AddCommand(&PaintCommand{
+		Type:              PaintBorder,
+		Box:               Rect{X: 0, Y: 0, Width: 40, Height: 40},
+		BorderTopWidth:    4,
+		BorderTopStyle:    "solid",
+		BorderTopColor:    testRed,
+		BorderLeftWidth:   4,
+		BorderLeftStyle:   "solid",
+		BorderLeftColor:   testBlue,
+		BorderRightWidth:  4,
+		BorderRightStyle:  "none",
+		BorderRightColor:  testBlue,
+		BorderBottomWidth: 0,
+	})
+
+	img := NewRasterRenderer().Render(dl, 40, 40)
+	if !sameColor(img, 20, 1, testRed) || !sameColor(img, 1, 1, testRed) {
+		t.Error("Expected the top border across the full width")
+	}
+	if !sameColor(img, 1, 20, testBlue) {
+		t.Errorf("Expected the left border below the top border, got %v", img.At(1, 20))
+	}
+	if !sameColor(img, 38, 20, color.White) {
+		t.Error("Expected no right border with style none")
+	}
+	if !sameColor(img, 20, 20, color.White) {
+		t.Error("Expected the inside of the border box to stay unpainted")
+	}
+}
+
+func TestRasterRendererClipsContent(t *testing.T) {
+	dl := NewDisplayList()
+	dl.AddCommand(&PaintCommand{Type: PaintPushClip, Box: Rect{X: 10, Y: 10, Width: 20, Height: 20}})
+	dl.AddCommand(&PaintCommand{Type: PaintRect, Box: Rect{X: 0, Y: 0, Width: 50, Height: 50}, FillColor: testRed})
+	dl.AddCommand(&PaintCommand{Type: PaintPopClip})
+	dl.AddCommand(&PaintCommand{Type: PaintRect, Box: Rect{X: 40, Y: 40, Width: 10, Height: 10}, FillColor: testBlue})
+
+	img := NewRasterRenderer().Render(dl, 50, 50)
+	if !sameColor(img, 15, 15, testRed) {
+		t.Error("Expected the clipped rectangle inside the clip")
+	}
+	if !sameColor(img, 5, 5, color.White) || !sameColor(img, 35, 15, color.White) {
+		t.Error("Expected nothing painted outside the clip")
+	}
+	if !sameColor(img, 45, 45, testBlue) {
+		t.Error("Expected commands after the clip to paint unclipped")
+	}
+}
+
+func TestRasterRendererPaintsTiles(t *testing.T) {
+	dl := NewDisplayList()
+	dl.AddCommand(&PaintCommand{Type: PaintRect, Box: Rect{X: 100, Y: 200, Width: 10, Height: 10}, FillColor: testRed})
+
+	// An image covering part of the page receives that part
+	tile := image.NewRGBA(image.Rect(96, 196, 128, 228))
+	NewRasterRenderer().Paint(tile, dl)
+	if !sameColor(tile, 105, 205, testRed) {
+		t.Errorf("Expected the rectangle at its page coordinates, got %v", tile.At(105, 205))
+	}
+	if !sameColor(tile, 120, 220, color.Transparent) {
+		t.Error("Expected Paint to leave the rest of the tile untouched")
+	}
+}
+
+func TestRasterRendererImages(t *testing.T) {
+	source := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			source.Set(x, y, testBlue)
+		}
+	}
+	node := NewRenderNode(NodeTypeElement)
+	node.TagName = "img"
+	node.ImageData = &imageloader.ImageData{Image: source, Width: 4, Height: 4, State: imageloader.StateLoaded}
+
+	dl := NewDisplayList()
+	dl.AddCommand(&PaintCommand{Type: PaintImage, Node: node, Box: Rect{X: 10, Y: 10, Width: 20, Height: 20}})
+
+	img := NewRasterRenderer().Render(dl, 40, 40)
+	if !sameColor(img, 20, 20, testBlue) {
+		t.Errorf("Expected the image scaled into its box, got %v", img.At(20, 20))
+	}
+	if !sameColor(img, 35, 35, color.White) {
+		t.Error("Expected nothing painted outside the image box")
+	}
+
+	// Images that are not loaded show their alt text
+	node.ImageData = &imageloader.ImageData{State: imageloader.StateError}
+	dl.Commands[0].ImageAlt = "A picture"
+	img = NewRasterRenderer().Render(dl, 40, 40)
+	if countInkPixels(img, image.Rect(10, 10, 30, 30)) == 0 {
+		t.Error("Expected alt text to be painted for an image that failed to load")
+	}
+}
+
+func TestRasterRendererText(t *testing.T) {
+	img, dl := rasterizeHTML(t, `<html><body><p>Hello <b>world</b></p><p>Second paragraph</p></body></html>`, 400, 200)
+
+	var hello, world *PaintCommand
+	for _, cmd := range dl.Commands {
+		if cmd.Type != PaintText {
+			continue
+		}
+		switch cmd.Text {
+		case "Hello":
+			hello = cmd
+		case "world":
+			world = cmd
+		}
+	}
+	if hello == nil || world == nil {
+		t.Fatal("Expected text commands for both text nodes")
+	}
+	if len(hello.Fragments) != 1 || len(world.Fragments) != 1 {
+		t.Fatalf("Expected one fragment per text node, got %d and %d", len(hello.Fragments), len(world.Fragments))
+	}
+	helloBox, worldBox := hello.Fragments[0].Box, world.Fragments[0].Box
+	if worldBox.X < helloBox.X+helloBox.Width-0.01 {
+		t.Errorf("Expected the bold text after the plain text, got %v and %v", helloBox, worldBox)
+	}
+
+	// Glyphs are drawn inside the fragments and nowhere above the first line
+	if countInkPixels(img, pixelRect(helloBox)) == 0 || countInkPixels(img, pixelRect(worldBox)) == 0 {
+		t.Error("Expected text to be drawn in its fragments")
+	}
+	if top := int(helloBox.Y); top > 0 && countInkPixels(img, image.Rect(0, 0, 400, top)) != 0 {
+		t.Error("Expected nothing drawn above the first line")
+	}
+}
+
+func TestRasterRendererLinkText(t *testing.T) {
+	img, dl := rasterizeHTML(t, `<html><body><p><a href="/next">Next page</a></p></body></html>`, 400, 100)
+
+	var fragment *TextFragment
+	for _, cmd := range dl.Commands {
+		if cmd.Type == PaintText && len(cmd.Fragments) > 0 {
+			fragment = &cmd.Fragments[0]
+		}
+	}
+	if fragment == nil {
+		t.Fatal("Expected a text fragment for the link text")
+	}
+
+	blue := 0
+	r := pixelRect(fragment.Box)
+	for y := r.Min.Y; y < r.Max.Y+4; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			cr, cg, cb, _ := img.At(x, y).RGBA()
+			if cb > 0x8000 && cr < 0x4000 && cg < 0x4000 {
+				blue++
+			}
+		}
+	}
+	if blue == 0 {
+		t.Error("Expected link text to be painted in the link color")
+	}
+}
+
+func TestRasterRendererPNG(t *testing.T) {
+	dl := NewDisplayList()
+	dl.AddCommand(&PaintCommand{Type: PaintRect, Box: Rect{X: 0, Y: 0, Width: 8, Height: 8}, FillColor: testRed})
+
+	var buf bytes.Buffer
+	if err := NewRasterRenderer().RenderPNG(&buf, dl, 16, 12); err != nil {
+		t.Fatalf("RenderPNG failed: %v", err)
+	}
+	decoded, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	if decoded.Bounds().Dx() != 16 || decoded.Bounds().Dy() != 12 {
+		t.Errorf("Expected a 16x12 image, got %v", decoded.Bounds())
+	}
+	if !sameColor(decoded, 4, 4, testRed) {
+		t.Errorf("Expected the rectangle in the PNG, got %v", decoded.At(4, 4))
+	}
+}
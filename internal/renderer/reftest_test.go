@@ -0,0 +1,325 @@
+package renderer
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// Reftests render a test page and a reference page through the same pipeline
+// and compare the pixels. A test names its reference with a
+// <link rel="match" href="..."> (or rel="mismatch" when the renderings must
+// differ), and may allow small differences with
+// <meta name="fuzzy" content="maxDifference=0-2;totalPixels=0-40">.
+// Pages without such a link are references and are not run on their own.
+
+const (
+	reftestDir    = "testdata/reftests"
+	reftestWidth  = 800
+	reftestHeight = 600
+)
+
+var reftestOutput = flag.String("reftest.out", "", "directory for the images of failing reftests (default a new temporary directory)")
+
+// reftest is a test page with its reference
+type reftest struct {
+	path      string
+	reference string
+	mismatch  bool
+	fuzzy     reftestFuzzy
+}
+
+// reftestFuzzy is the tolerated difference between a test and its reference:
+// the largest difference of a color channel and the number of pixels that
+// differ, both as inclusive ranges
+type reftestFuzzy struct {
+	minDifference, maxDifference int
+	minPixels, maxPixels         int
+}
+
+// matches reports whether a comparison is within the tolerance; identical
+// renderings always match
+func (f reftestFuzzy) matches(maxDifference, pixels int) bool {
+	if pixels == 0 {
+		return true
+	}
+	return maxDifference >= f.minDifference && maxDifference <= f.maxDifference &&
+		pixels >= f.minPixels && pixels <= f.maxPixels
+}
+
+// parseReftestFuzzy parses the content of a fuzzy meta element, either
+// "maxDifference=A-B;totalPixels=C-D" or the short form "A-B;C-D", where a
+// single number N stands for the range 0-N
+func parseReftestFuzzy(content string) (reftestFuzzy, error) {
+	var fuzzy reftestFuzzy
+	parts := strings.Split(content, ";")
+	if len(parts) != 2 {
+		return fuzzy, fmt.Errorf("expected two ranges in %q", content)
+	}
+	for i, part := range parts {
+		name, value, named := strings.Cut(strings.TrimSpace(part), "=")
+		if !named {
+			name, value = "", name
+		}
+		low, high, err := parseReftestRange(value)
+		if err != nil {
+			return fuzzy, err
+		}
+		switch {
+		case name == "maxDifference" || (name == "" && i == 0):
+			fuzzy.minDifference, fuzzy.maxDifference = low, high
+		case name == "totalPixels" || (name == "" && i == 1):
+			fuzzy.minPixels, fuzzy.maxPixels = low, high
+		default:
+			return fuzzy, fmt.Errorf("unknown fuzzy parameter %q", name)
+		}
+	}
+	return fuzzy, nil
+}
+
+// parseReftestRange parses "A-B" or "N" (meaning 0-N)
+func parseReftestRange(value string) (int, int, error) {
+	lowText, highText, isRange := strings.Cut(strings.TrimSpace(value), "-")
+	if !isRange {
+		lowText, highText = "0", lowText
+	}
+	low, err := strconv.Atoi(strings.TrimSpace(lowText))
+	if err != nil {
+		return 0, 0, err
+	}
+	high, err := strconv.Atoi(strings.TrimSpace(highText))
+	if err != nil {
+		return 0, 0, err
+	}
+	return low, high, nil
+}
+
+// loadReftests finds the tests of a directory
+func loadReftests(dir string) ([]reftest, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+
+	var tests []reftest
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		doc, err := html.Parse(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		test := reftest{path: path}
+		var walk func(*html.Node) error
+		walk = func(n *html.Node) error {
+			if n.Type == html.ElementNode {
+				attrs := make(map[string]string)
+				for _, attr := range n.Attr {
+					attrs[attr.Key] = attr.Val
+				}
+				switch {
+				case n.Data == "link" && (attrs["rel"] == "match" || attrs["rel"] == "mismatch"):
+					test.reference = filepath.Join(dir, attrs["href"])
+					test.mismatch = attrs["rel"] == "mismatch"
+				case n.Data == "meta" && attrs["name"] == "fuzzy":
+					fuzzy, err := parseReftestFuzzy(attrs["content"])
+					if err != nil {
+						return fmt.Errorf("%s: %w", path, err)
+					}
+					test.fuzzy = fuzzy
+				}
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				if err := walk(c); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err := walk(doc); err != nil {
+			return nil, err
+		}
+		if test.reference != "" {
+			tests = append(tests, test)
+		}
+	}
+	return tests, nil
+}
+
+// renderReftestPage renders an HTML file through layout, the display list
+// builder and the headless rasterizer
+func renderReftestPage(t *testing.T, path string) *image.RGBA {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+
+	r := NewRenderer(reftestWidth, reftestHeight)
+	absPath, _ := filepath.Abs(path)
+	r.SetCurrentURL(absPath)
+	if _, err := r.LayoutHTML(string(content)); err != nil {
+		t.Fatalf("Failed to lay out %s: %v", path, err)
+	}
+	r.LoadImagesSync()
+
+	raster := NewRasterRenderer()
+	raster.SetFontFaces(r.FontFaces())
+	return raster.Render(r.DisplayList(), reftestWidth, reftestHeight)
+}
+
+// compareImages returns the largest channel difference between two images of
+// the same size, the number of pixels that differ, and an image showing them
+func compareImages(a, b *image.RGBA) (maxDifference, pixels int, diff *image.RGBA) {
+	bounds := a.Bounds()
+	diff = image.NewRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			ca, cb := a.RGBAAt(x, y), b.RGBAAt(x, y)
+			d := max(channelDifference(ca.R, cb.R), channelDifference(ca.G, cb.G),
+				channelDifference(ca.B, cb.B), channelDifference(ca.A, cb.A))
+			if d == 0 {
+				// Matching pixels are shown faded, so the differences stand out
+				gray := uint8((int(ca.R)+int(ca.G)+int(ca.B))/3/4 + 192)
+				diff.SetRGBA(x, y, color.RGBA{R: gray, G: gray, B: gray, A: 255})
+				continue
+			}
+			pixels++
+			maxDifference = max(maxDifference, d)
+			diff.SetRGBA(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+	return maxDifference, pixels, diff
+}
+
+func channelDifference(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
+
+// writeReftestImages saves the renderings of a failing test and their difference
+func writeReftestImages(t *testing.T, test reftest, images map[string]*image.RGBA) {
+	t.Helper()
+	dir := *reftestOutput
+	if dir == "" {
+		var err error
+		if dir, err = os.MkdirTemp("", "reftest-"); err != nil {
+			t.Logf("Failed to create a directory for the reftest images: %v", err)
+			return
+		}
+		*reftestOutput = dir
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Logf("Failed to create %s: %v", dir, err)
+		return
+	}
+
+	name := strings.TrimSuffix(filepath.Base(test.path), ".html")
+	for suffix, img := range images {
+		path := filepath.Join(dir, name+"-"+suffix+".png")
+		file, err := os.Create(path)
+		if err != nil {
+			t.Logf("Failed to write %s: %v", path, err)
+			continue
+		}
+		err = png.Encode(file, img)
+		file.Close()
+		if err != nil {
+			t.Logf("Failed to encode %s: %v", path, err)
+			continue
+		}
+		t.Logf("Wrote %s", path)
+	}
+}
+
+func TestReftests(t *testing.T) {
+	tests, err := loadReftests(reftestDir)
+	if err != nil {
+		t.Fatalf("Failed to load reftests: %v", err)
+	}
+	if len(tests) == 0 {
+		t.Fatalf("Expected reftests in %s", reftestDir)
+	}
+
+	for _, test := range tests {
+		name := strings.TrimSuffix(filepath.Base(test.path), ".html")
+		t.Run(name, func(t *testing.T) {
+			testImage := renderReftestPage(t, test.path)
+			referenceImage := renderReftestPage(t, test.reference)
+			maxDifference, pixels, diff := compareImages(testImage, referenceImage)
+
+			matches := test.fuzzy.matches(maxDifference, pixels)
+			if matches == !test.mismatch {
+				return
+			}
+			if test.mismatch {
+				t.Errorf("Expected %s to render differently from %s", filepath.Base(test.path), filepath.Base(test.reference))
+			} else {
+				t.Errorf("%s differs from %s: %d pixels, max difference %d", filepath.Base(test.path), filepath.Base(test.reference), pixels, maxDifference)
+			}
+			writeReftestImages(t, test, map[string]*image.RGBA{"test": testImage, "ref": referenceImage, "diff": diff})
+		})
+	}
+}
+
+func TestReftestFuzzy(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected reftestFuzzy
+	}{
+		{"maxDifference=0-2;totalPixels=0-40", reftestFuzzy{0, 2, 0, 40}},
+		{"totalPixels=10-20; maxDifference=5", reftestFuzzy{0, 5, 10, 20}},
+		{"3;100", reftestFuzzy{0, 3, 0, 100}},
+	}
+	for _, tt := range tests {
+		fuzzy, err := parseReftestFuzzy(tt.content)
+		if err != nil {
+			t.Errorf("parseReftestFuzzy(%q) failed: %v", tt.content, err)
+			continue
+		}
+		if fuzzy != tt.expected {
+			t.Errorf("parseReftestFuzzy(%q) = %+v, want %+v", tt.content, fuzzy, tt.expected)
+		}
+	}
+	if _, err := parseReftestFuzzy("maxDifference=2"); err == nil {
+		t.Error("Expected an error for a single range")
+	}
+
+	fuzzy := reftestFuzzy{1, 2, 1, 10}
+	if !fuzzy.matches(0, 0) || !fuzzy.matches(2, 10) {
+		t.Error("Expected identical images and differences within range to match")
+	}
+	if fuzzy.matches(3, 5) || fuzzy.matches(2, 11) {
+		t.Error("Expected differences out of range not to match")
+	}
+}
+
+func TestCompareImages(t *testing.T) {
+	a := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	b := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	b.SetRGBA(1, 2, color.RGBA{R: 3})
+	b.SetRGBA(3, 3, color.RGBA{B: 10, A: 1})
+
+	maxDifference, pixels, diff := compareImages(a, b)
+	if maxDifference != 10 || pixels != 2 {
+		t.Errorf("Expected 2 pixels with max difference 10, got %d pixels with %d", pixels, maxDifference)
+	}
+	if diff.RGBAAt(1, 2) != (color.RGBA{R: 255, A: 255}) || diff.RGBAAt(0, 0).R != diff.RGBAAt(0, 0).G {
+		t.Error("Expected differing pixels in red and matching pixels in gray")
+	}
+}
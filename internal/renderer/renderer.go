@@ -1,8 +1,12 @@
 package renderer
 
 import (
+	"context"
+	"image"
+	"math"
 	"net/url"
 	"strings"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -11,24 +15,51 @@ import (
 
 	"github.com/vyquocvu/goosie/internal/css"
 	imageloader "github.com/vyquocvu/goosie/internal/image"
+	"github.com/vyquocvu/goosie/internal/net"
 )
 
 // Renderer is the main HTML renderer that coordinates parsing, layout, and rendering
 type Renderer struct {
 	layoutEngine   *LayoutEngine
+	incremental    *IncrementalLayoutEngine // Lays out animated boxes again on top of layoutEngine
 	canvasRenderer *CanvasRenderer
 	imageLoader    imageloader.Loader
 	stylesheet     *css.StyleSheet
 
+	// Web fonts of the current document and how to fetch them
+	fontFaces *FontFaceSet
+	fontFetch FontFetchFunc
+
+	// Context the document's subresources load under
+	loadCtx context.Context
+
+	// Styles added after the document's own, such as element hiding rules
+	extraStyles func(pageURL string) string
+
+	// Canvas object of the current document, updated in place when fonts swap
+	content fyne.CanvasObject
+
 	// Cached trees for performance
 	currentRenderTree *RenderNode
 	currentLayoutTree *LayoutBox
 
+	// Tile compositor, and the layout tree and display list it was last
+	// updated with
+	compositor       *Compositor
+	compositedLayout *LayoutBox
+	compositedList   *DisplayList
+
 	// Navigation callback for link clicks
 	onNavigate func(url string)
 
 	// Current page URL for resolving relative links
 	currentURL string
+
+	// Transitions and animations of the current document, whether frames are
+	// being ticked for them, and the handler of their end events
+	timeline         *AnimationTimeline
+	framesScheduled  bool
+	onAnimationEvent func(AnimationEvent)
 }
 
 // NewRenderer creates a new HTML renderer
@@ -36,24 +67,58 @@ func NewRenderer(width, height float32) *Renderer {
 	imageLoader := imageloader.NewLoader(100) // Cache up to 100 images
 	canvasRenderer := NewCanvasRenderer(width, height)
 	canvasRenderer.imageLoader = imageLoader
+	layoutEngine := NewLayoutEngine(width, height)
+	canvasRenderer.SetLayoutEngine(layoutEngine)
 
 	return &Renderer{
-		layoutEngine:   NewLayoutEngine(width, height),
+		layoutEngine:   layoutEngine,
+		incremental:    &IncrementalLayoutEngine{LayoutEngine: layoutEngine, invalidation: NewInvalidationTracker()},
 		canvasRenderer: canvasRenderer,
 		imageLoader:    imageLoader,
+		timeline:       NewAnimationTimeline(systemClock{}),
 	}
 }
 
 // RenderHTML renders HTML content and returns a Fyne canvas object
 func (r *Renderer) RenderHTML(htmlContent string) (fyne.CanvasObject, error) {
+	layoutTree, err := r.LayoutHTML(htmlContent)
+	if err != nil {
+		return nil, err
+	}
+	if layoutTree == nil {
+		// Return empty container if no content
+		return r.canvasRenderer.Render(nil), nil
+	}
+	renderTree := r.currentRenderTree
+
+	// Pass navigation callback to canvas renderer
+	r.canvasRenderer.SetNavigationCallback(r.onNavigate, r.currentURL)
+
+	// Render to canvas with viewport optimization
+	canvasObject := r.canvasRenderer.RenderWithViewport(renderTree, layoutTree)
+	r.content = canvasObject
+	r.imageLoader.SetOnLoadCallback(r.onImageLoaded)
+	r.loadImages(renderTree)
+	r.scheduleFrames()
+
+	return canvasObject, nil
+}
+
+// LayoutHTML parses, styles and lays out an HTML document without creating
+// canvas objects, caching the trees for later painting
+// It returns nil if the document has no content.
+func (r *Renderer) LayoutHTML(htmlContent string) (*LayoutBox, error) {
 	// Parse HTML
 	doc, err := html.Parse(strings.NewReader(htmlContent))
 	if err != nil {
 		return nil, err
 	}
 
-	// Extract and parse CSS from <style> tags
-	r.stylesheet = extractAndParseCSS(doc)
+	// Extract and parse CSS from the <style> tags the page's policy allows
+	r.stylesheet = extractAllowedCSS(doc, r.inlineStyleAllowed)
+	r.addExtraStyles()
+	r.loadFontFaces()
+	r.timeline.Reset(r.stylesheet)
 
 	// Find body element
 	bodyNode := findBodyNode(doc)
@@ -65,15 +130,13 @@ func (r *Renderer) RenderHTML(htmlContent string) (fyne.CanvasObject, error) {
 	// Build render tree
 	renderTree := BuildRenderTree(bodyNode)
 	if renderTree == nil {
-		// Return empty container if no content
-		return r.canvasRenderer.Render(nil), nil
+		r.currentRenderTree = nil
+		r.currentLayoutTree = nil
+		return nil, nil
 	}
 
 	// Apply styles
-	if r.stylesheet != nil {
-		styleManager := NewStyleManager(r.stylesheet)
-		styleManager.ApplyStyles(renderTree)
-	}
+	r.applyStyles(renderTree)
 
 	// Perform layout
 	layoutTree := r.layoutEngine.ComputeLayout(renderTree)
@@ -82,15 +145,231 @@ func (r *Renderer) RenderHTML(htmlContent string) (fyne.CanvasObject, error) {
 	r.currentRenderTree = renderTree
 	r.currentLayoutTree = layoutTree
 
-	// Pass navigation callback to canvas renderer
-	r.canvasRenderer.SetNavigationCallback(r.onNavigate, r.currentURL)
+	return layoutTree, nil
+}
 
-	// Render to canvas with viewport optimization
-	canvasObject := r.canvasRenderer.RenderWithViewport(renderTree, layoutTree)
-	r.imageLoader.SetOnLoadCallback(r.onImageLoaded)
-	r.loadImages(renderTree)
+// Relayout recomputes the layout of the current document, for example once
+// its web fonts have loaded
+func (r *Renderer) Relayout() *LayoutBox {
+	if r.currentRenderTree == nil {
+		return nil
+	}
+	r.currentLayoutTree = r.layoutEngine.ComputeLayout(r.currentRenderTree)
+	return r.currentLayoutTree
+}
 
-	return canvasObject, nil
+// Restyle applies the stylesheet to the current document again after its
+// attributes change, starting transitions of the properties that changed,
+// and lays it out again
+func (r *Renderer) Restyle() *LayoutBox {
+	if r.currentRenderTree == nil {
+		return nil
+	}
+	r.timeline.snapshot(r.currentRenderTree)
+	r.applyStyles(r.currentRenderTree)
+	r.scheduleFrames()
+	return r.Relayout()
+}
+
+// Tick advances the transitions and animations of the current document to
+// the animation clock's time. Only the subtrees of animated elements are
+// restyled, and laid out again only when a property that affects layout is
+// animating. It returns the transitionend and animationend events of those
+// that ended, which are also passed to the animation event handler.
+func (r *Renderer) Tick() []AnimationEvent {
+	if r.currentRenderTree == nil || r.stylesheet == nil || !r.timeline.Running() {
+		return nil
+	}
+	animated := r.timeline.animating()
+	roots := animationRoots(r.currentRenderTree, animated)
+
+	styleManager := NewStyleManager(r.stylesheet)
+	styleManager.timeline = r.timeline
+	r.timeline.begin()
+	for _, node := range roots {
+		resetStyles(node)
+		styleManager.ApplyStyles(node)
+	}
+	events := r.timeline.finish()
+	r.deliverAnimationEvents(events)
+
+	affectsLayout := false
+	for _, properties := range animated {
+		for property := range properties {
+			if !paintOnlyProperties[property] {
+				affectsLayout = true
+			}
+		}
+	}
+	if affectsLayout {
+		for _, node := range roots {
+			r.incremental.InvalidateNode(node, DirtyLayout|DirtySubtree)
+		}
+		r.currentLayoutTree = r.incremental.ComputeIncrementalLayout(r.currentRenderTree, r.currentLayoutTree)
+	} else {
+		for node := range animated {
+			r.layoutEngine.updateTransform(node)
+		}
+	}
+
+	// The layout tree changed in place, so display lists built from it are stale
+	r.canvasRenderer.cachedDisplayList = nil
+	r.compositedList = nil
+	return events
+}
+
+// animationRoots returns the animated elements of a render tree that have no
+// animated ancestor, in tree order
+func animationRoots(root *RenderNode, animated map[*RenderNode]map[string]bool) []*RenderNode {
+	var roots []*RenderNode
+	var walk func(node *RenderNode)
+	walk = func(node *RenderNode) {
+		if animated[node] != nil {
+			roots = append(roots, node)
+			return
+		}
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(root)
+	return roots
+}
+
+// AnimationsRunning reports whether the current document has transitions or
+// animations in progress
+func (r *Renderer) AnimationsRunning() bool {
+	return r.timeline.Running()
+}
+
+// SetAnimationClock sets the clock transitions and animations are sampled
+// with, such as a VirtualClock for tests; set it before loading a document
+func (r *Renderer) SetAnimationClock(clock Clock) {
+	r.timeline.clock = clock
+}
+
+// SetAnimationEventHandler sets the handler of transitionend and
+// animationend events
+func (r *Renderer) SetAnimationEventHandler(handler func(AnimationEvent)) {
+	r.onAnimationEvent = handler
+}
+
+// applyStyles cascades the stylesheet over a render tree with the values of
+// running transitions and animations, and delivers the events of those that
+// ended
+func (r *Renderer) applyStyles(renderTree *RenderNode) []AnimationEvent {
+	if r.stylesheet == nil {
+		return nil
+	}
+	resetStyles(renderTree)
+	styleManager := NewStyleManager(r.stylesheet)
+	styleManager.timeline = r.timeline
+	r.timeline.begin()
+	styleManager.ApplyStyles(renderTree)
+
+	events := r.timeline.finish()
+	r.deliverAnimationEvents(events)
+	return events
+}
+
+// deliverAnimationEvents passes the end events of a style pass to the
+// animation event handler
+func (r *Renderer) deliverAnimationEvents(events []AnimationEvent) {
+	if r.onAnimationEvent == nil {
+		return
+	}
+	for _, event := range events {
+		r.onAnimationEvent(event)
+	}
+}
+
+// resetStyles clears the computed styles of a render tree before it is styled again
+func resetStyles(node *RenderNode) {
+	node.ComputedStyle = nil
+	for _, child := range node.Children {
+		resetStyles(child)
+	}
+}
+
+// scheduleFrames ticks running transitions and animations on the window about
+// 60 times a second, until none are left
+func (r *Renderer) scheduleFrames() {
+	if r.framesScheduled || r.canvasRenderer.window == nil || !r.timeline.Running() {
+		return
+	}
+	r.framesScheduled = true
+	go func() {
+		ticker := time.NewTicker(frameInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			running := false
+			fyne.DoAndWait(func() {
+				running = r.renderAnimationFrame()
+				r.framesScheduled = running
+			})
+			if !running {
+				return
+			}
+		}
+	}()
+}
+
+// renderAnimationFrame ticks the animations and repaints the document in
+// place, reporting whether animations are still running
+func (r *Renderer) renderAnimationFrame() bool {
+	if r.currentRenderTree == nil {
+		return false
+	}
+	r.Tick()
+	r.refreshContent()
+	return r.timeline.Running()
+}
+
+// RenderTree returns the render tree of the current document
+func (r *Renderer) RenderTree() *RenderNode {
+	return r.currentRenderTree
+}
+
+// LayoutTree returns the layout tree of the current document
+func (r *Renderer) LayoutTree() *LayoutBox {
+	return r.currentLayoutTree
+}
+
+// FontFaces returns the web fonts of the current document
+func (r *Renderer) FontFaces() *FontFaceSet {
+	return r.fontFaces
+}
+
+// DisplayList builds the display list of the current document
+func (r *Renderer) DisplayList() *DisplayList {
+	if r.currentRenderTree == nil || r.currentLayoutTree == nil {
+		return NewDisplayList()
+	}
+	return NewDisplayListBuilder().Build(r.currentLayoutTree, r.currentRenderTree)
+}
+
+// Compositor returns the tile compositor of the current document, updated
+// with its display list once the layout changes
+func (r *Renderer) Compositor() *Compositor {
+	if r.compositor == nil {
+		r.compositor = NewCompositor(NewRasterRenderer())
+	}
+	r.compositor.raster.SetFontFaces(r.fontFaces)
+	if r.compositedList == nil || r.compositedLayout != r.currentLayoutTree {
+		r.compositedList = r.DisplayList()
+		r.compositor.Update(r.compositedList)
+		r.compositedLayout = r.currentLayoutTree
+	}
+	return r.compositor
+}
+
+// ComposeViewport paints the viewport set by SetViewport from cached tiles,
+// so scrolling repaints only tiles that were not visible before
+func (r *Renderer) ComposeViewport() *image.RGBA {
+	cr := r.canvasRenderer
+	dst := image.NewRGBA(image.Rect(0, 0, int(math.Ceil(float64(cr.canvasWidth))), int(math.Ceil(float64(cr.viewportHeight)))))
+	r.Compositor().Compose(dst, 0, cr.viewportY)
+	return dst
 }
 
 // SetViewport updates the viewport for optimized rendering during scroll
@@ -106,6 +385,19 @@ func (r *Renderer) UpdateViewport() fyne.CanvasObject {
 	return r.canvasRenderer.RenderWithViewport(r.currentRenderTree, r.currentLayoutTree)
 }
 
+// ComposeViewportImage paints the viewport set by SetViewport from the
+// compositor's tiles as a canvas object as tall as the page, with tap targets
+// over its links. Cached tiles are reused, so only tiles scrolled into view
+// for the first time or under commands that changed are rasterized. Unlike
+// UpdateViewport, text is not selectable and form controls are not live.
+func (r *Renderer) ComposeViewportImage() fyne.CanvasObject {
+	if r.currentRenderTree == nil || r.currentLayoutTree == nil {
+		return container.NewVBox()
+	}
+	pixels := r.ComposeViewport()
+	return r.canvasRenderer.viewportObject(pixels, r.compositedList, r.GetContentHeight())
+}
+
 // GetContentHeight returns the total height of the rendered content
 func (r *Renderer) GetContentHeight() float32 {
 	if r.currentLayoutTree == nil {
@@ -206,24 +498,119 @@ func (r *Renderer) SetWindow(w fyne.Window) {
 	r.canvasRenderer.SetWindow(w)
 }
 
+// LoadImagesSync loads the images of the current document, waiting for each
+// of them, so that they can be painted without a window
+func (r *Renderer) LoadImagesSync() {
+	if r.currentRenderTree != nil {
+		r.loadImagesSync(r.currentRenderTree)
+	}
+}
+
+func (r *Renderer) loadImagesSync(node *RenderNode) {
+	if node.TagName == "img" {
+		if src, ok := node.GetAttribute("src"); ok {
+			if img := r.loadImageSync(r.resolveURL(src)); img != nil {
+				node.ImageData = img
+			}
+		}
+	}
+	for i, src := range backgroundImageSources(node) {
+		if src != "" {
+			node.BackgroundImages[i] = r.loadImageSync(r.resolveURL(src))
+		}
+	}
+	for _, child := range node.Children {
+		r.loadImagesSync(child)
+	}
+}
+
+// loadImageSync loads an image, waiting for it if the loader supports it
+func (r *Renderer) loadImageSync(src string) *imageloader.ImageData {
+	var img *imageloader.ImageData
+	if loader, ok := r.imageLoader.(syncImageLoader); ok {
+		img, _ = loader.LoadSync(src)
+	} else {
+		img, _ = r.imageLoader.Load(src)
+	}
+	return img
+}
+
+// syncImageLoader is implemented by image loaders that can load an image
+// on the calling goroutine
+type syncImageLoader interface {
+	LoadSync(source string) (*imageloader.ImageData, error)
+}
+
+// offscreenImageLoader is implemented by image loaders that load images
+// outside the viewport after visible ones
+type offscreenImageLoader interface {
+	LoadOffscreen(source string) (*imageloader.ImageData, error)
+}
+
+// contextImageLoader is implemented by image loaders whose loads can be
+// cancelled with a context
+type contextImageLoader interface {
+	SetContext(ctx context.Context)
+}
+
+// loadImages starts loading the images of a render tree; those outside the
+// viewport load after the visible ones
 func (r *Renderer) loadImages(node *RenderNode) {
+	visible := make(map[int64]bool)
+	if r.currentLayoutTree != nil {
+		r.collectVisible(r.currentLayoutTree, visible)
+	}
+	r.loadImagesIn(node, visible)
+}
+
+// collectVisible records the nodes whose boxes are in the viewport
+func (r *Renderer) collectVisible(box *LayoutBox, visible map[int64]bool) {
+	if r.canvasRenderer.isInViewport(box.Box) {
+		visible[box.NodeID] = true
+	}
+	for _, child := range box.Children {
+		r.collectVisible(child, visible)
+	}
+}
+
+func (r *Renderer) loadImagesIn(node *RenderNode, visible map[int64]bool) {
 	if node.TagName == "img" {
 		if src, ok := node.GetAttribute("src"); ok {
 			// Resolve relative URLs before loading
 			resolvedSrc := r.resolveURL(src)
 			go func() {
-				img, err := r.imageLoader.Load(resolvedSrc)
+				img, err := r.loadImage(resolvedSrc, visible[node.ID])
 				if err == nil {
 					node.ImageData = img
 				}
 			}()
 		}
 	}
+	for i, src := range backgroundImageSources(node) {
+		if src == "" {
+			continue
+		}
+		resolvedSrc := r.resolveURL(src)
+		go func() {
+			img, err := r.loadImage(resolvedSrc, visible[node.ID])
+			if err == nil {
+				node.BackgroundImages[i] = img
+			}
+		}()
+	}
 	for _, child := range node.Children {
-		r.loadImages(child)
+		r.loadImagesIn(child, visible)
 	}
 }
 
+// loadImage starts loading an image, at a lower priority when it is not visible
+func (r *Renderer) loadImage(src string, visible bool) (*imageloader.ImageData, error) {
+	if loader, ok := r.imageLoader.(offscreenImageLoader); ok && !visible {
+		return loader.LoadOffscreen(src)
+	}
+	return r.imageLoader.Load(src)
+}
+
 // resolveURL resolves a relative or absolute URL against the current page URL
 func (r *Renderer) resolveURL(href string) string {
 	// If href is already absolute, return as-is
@@ -253,6 +640,91 @@ func (r *Renderer) resolveURL(href string) string {
 	return resolved.String()
 }
 
+// SetFontFetcher sets how @font-face sources are fetched; nil uses the network
+func (r *Renderer) SetFontFetcher(fetch FontFetchFunc) {
+	r.fontFetch = fetch
+}
+
+// SetLoadContext sets the context images and fonts of the documents laid
+// out from now on load under. When it is done, such as when the tab
+// navigates away, their queued and in-flight requests are cancelled.
+func (r *Renderer) SetLoadContext(ctx context.Context) {
+	r.loadCtx = ctx
+	if loader, ok := r.imageLoader.(contextImageLoader); ok {
+		loader.SetContext(ctx)
+	}
+}
+
+// SetExtraStyles sets the styles added to the documents laid out from now
+// on, such as the element hiding rules of a content blocker. styles returns
+// the CSS of a page, applied after the page's own so its rules win; ""
+// adds none.
+func (r *Renderer) SetExtraStyles(styles func(pageURL string) string) {
+	r.extraStyles = styles
+}
+
+// addExtraStyles appends the extra styles of the current page to its
+// stylesheet
+func (r *Renderer) addExtraStyles() {
+	if r.extraStyles == nil {
+		return
+	}
+	extra := r.extraStyles(r.currentURL)
+	if extra == "" {
+		return
+	}
+	stylesheet, err := css.NewParser(extra).Parse()
+	if err != nil {
+		return
+	}
+	r.stylesheet.Rules = append(r.stylesheet.Rules, stylesheet.Rules...)
+}
+
+// loadFontFaces registers the @font-face rules of the current stylesheet
+// Fonts are fetched once text is laid out in them.
+func (r *Renderer) loadFontFaces() {
+	fetch := r.fontFetch
+	if fetch == nil && r.loadCtx != nil {
+		fetch = scheduledFontFetch(r.loadCtx)
+	}
+	fonts := NewFontFaceSet(ParseFontFaceRules(r.stylesheet), r.currentURL, fetch)
+	fonts.SetOnChange(func() { r.onFontsChanged(fonts) })
+
+	r.fontFaces = fonts
+	r.layoutEngine.SetFontFaces(fonts)
+	r.canvasRenderer.SetFontFaces(fonts)
+}
+
+// onFontsChanged lays out and repaints the document when a web font swaps in,
+// or when its block period ends and hidden text is shown with the fallback font
+func (r *Renderer) onFontsChanged(fonts *FontFaceSet) {
+	if r.canvasRenderer.window == nil {
+		return
+	}
+	fyne.Do(func() {
+		if fonts != r.fontFaces || r.currentRenderTree == nil {
+			return
+		}
+		r.Relayout()
+		if r.compositor != nil {
+			// Text hidden while the font loaded paints without a layout change
+			r.compositor.InvalidateAll()
+		}
+		r.refreshContent()
+	})
+}
+
+// refreshContent paints the current layout into the document's canvas object
+func (r *Renderer) refreshContent() {
+	updated := r.canvasRenderer.RenderWithViewport(r.currentRenderTree, r.currentLayoutTree)
+
+	content, ok := r.content.(*fyne.Container)
+	if replacement, isContainer := updated.(*fyne.Container); ok && isContainer {
+		content.Objects = replacement.Objects
+		content.Refresh()
+	}
+}
+
 func (r *Renderer) onImageLoaded(src string) {
 	if r.canvasRenderer.window != nil {
 		fyne.Do(func() {
@@ -261,17 +733,46 @@ func (r *Renderer) onImageLoaded(src string) {
 	}
 }
 
+// inlineStyleAllowed reports whether the Content-Security-Policy of the
+// document being loaded allows a <style> element with the given content
+func (r *Renderer) inlineStyleAllowed(style *html.Node, content string) bool {
+	if r.loadCtx == nil {
+		return true
+	}
+	policy := net.DocumentPolicyFrom(r.loadCtx)
+	if policy == nil {
+		return true
+	}
+	var nonce string
+	for _, attr := range style.Attr {
+		if attr.Key == "nonce" {
+			nonce = attr.Val
+		}
+	}
+	return policy.AllowsInline(net.ResourceStylesheet, nonce, content)
+}
+
 // extractAndParseCSS finds all <style> tags, extracts their content, and parses it.
 func extractAndParseCSS(node *html.Node) *css.StyleSheet {
+	return extractAllowedCSS(node, nil)
+}
+
+// extractAllowedCSS is extractAndParseCSS for the <style> tags allowed
+// accepts; a nil allowed accepts all of them
+func extractAllowedCSS(node *html.Node, allowed func(style *html.Node, content string) bool) *css.StyleSheet {
 	var cssContent string
 	var f func(*html.Node)
 	f = func(n *html.Node) {
 		if n.Type == html.ElementNode && n.Data == "style" {
+			var content string
 			for c := n.FirstChild; c != nil; c = c.NextSibling {
 				if c.Type == html.TextNode {
-					cssContent += c.Data
+					content += c.Data
 				}
 			}
+			if allowed == nil || allowed(n, content) {
+				cssContent += content
+			}
 		}
 		for c := n.FirstChild; c != nil; c = c.NextSibling {
 			f(c)
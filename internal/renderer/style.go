@@ -3,6 +3,7 @@ package renderer
 import (
 	"fmt"
 	"image/color"
+	"math"
 	"strconv"
 	"strings"
 
@@ -12,6 +13,7 @@ import (
 // StyleManager applies styles from a stylesheet to a render tree.
 type StyleManager struct {
 	stylesheet *css.StyleSheet
+	timeline   *AnimationTimeline // Transitions and animations applied over the cascade, if any
 }
 
 // NewStyleManager creates a new StyleManager.
@@ -33,15 +35,43 @@ func (sm *StyleManager) ApplyStyles(node *RenderNode) {
 	if node.Parent != nil && node.Parent.ComputedStyle != nil {
 		node.ComputedStyle.Color = node.Parent.ComputedStyle.Color
 		node.ComputedStyle.FontSize = node.Parent.ComputedStyle.FontSize
+		
+		// Inherited text properties (vertical-align is not inherited)
+		parentStyle := node.Parent.ComputedStyle
+		node.ComputedStyle.WhiteSpace = parentStyle.WhiteSpace
+		node.ComputedStyle.TextAlign = parentStyle.TextAlign
+		node.ComputedStyle.LineHeight = parentStyle.LineHeight
+		node.ComputedStyle.LetterSpacing = parentStyle.LetterSpacing
+		node.ComputedStyle.WordSpacing = parentStyle.WordSpacing
+		node.ComputedStyle.TextIndent = parentStyle.TextIndent
+		node.ComputedStyle.TextTransform = parentStyle.TextTransform
+	}
+
+	// User agent defaults come before author rules and override inherited values
+	if value := defaultWhiteSpace(node.TagName); value != "" {
+		node.ComputedStyle.WhiteSpace = value
 	}
 
 	sm.applyMatchingRules(node)
+	if sm.timeline != nil && node.Type == NodeTypeElement {
+		sm.timeline.apply(sm, node)
+	}
 
 	for _, child := range node.Children {
 		sm.ApplyStyles(child)
 	}
 }
 
+// defaultWhiteSpace returns the white-space value the user agent style sheet
+// gives an element, or "" when it inherits
+func defaultWhiteSpace(tagName string) string {
+	switch tagName {
+	case "pre", "textarea", "listing":
+		return "pre"
+	}
+	return ""
+}
+
 func (sm *StyleManager) applyMatchingRules(node *RenderNode) {
 	for _, rule := range sm.stylesheet.Rules {
 		for _, selectorSeq := range rule.Selectors {
@@ -339,16 +369,68 @@ func (sm *StyleManager) applyDeclaration(node *RenderNode, decl css.Declaration)
 		if val, err := parseColor(decl.Value); err == nil {
 			style.BackgroundColor = val
 		}
+	case "background":
+		parseBackgroundShorthand(decl.Value, style)
+	case "background-image":
+		style.BackgroundImage = parseBackgroundList(decl.Value)
+	case "background-position":
+		style.BackgroundPosition = parseBackgroundList(decl.Value)
+	case "background-size":
+		style.BackgroundSize = parseBackgroundList(decl.Value)
+	case "background-repeat":
+		style.BackgroundRepeat = parseBackgroundList(decl.Value)
+	case "background-attachment":
+		style.BackgroundAttachment = parseBackgroundList(decl.Value)
+	case "background-origin":
+		style.BackgroundOrigin = parseBackgroundList(decl.Value)
+	case "background-clip":
+		style.BackgroundClip = parseBackgroundList(decl.Value)
 	case "width":
 		style.Width = decl.Value
 	case "height":
 		style.Height = decl.Value
 	case "font-family":
 		style.FontFamily = decl.Value
+	case "font-style":
+		style.FontStyle = strings.ToLower(strings.TrimSpace(decl.Value))
 	case "opacity":
 		if val, err := strconv.ParseFloat(decl.Value, 32); err == nil {
 			style.Opacity = float32(val)
 		}
+	case "transform":
+		style.Transform = strings.TrimSpace(decl.Value)
+	case "transform-origin":
+		style.TransformOrigin = strings.TrimSpace(decl.Value)
+	
+	// Transition and animation properties
+	case "transition":
+		parseTransitionShorthand(decl.Value, style)
+	case "transition-property":
+		style.TransitionProperty = parseAnimationList(decl.Value)
+	case "transition-duration":
+		style.TransitionDuration = parseAnimationList(decl.Value)
+	case "transition-timing-function":
+		style.TransitionTimingFunction = parseAnimationList(decl.Value)
+	case "transition-delay":
+		style.TransitionDelay = parseAnimationList(decl.Value)
+	case "animation":
+		parseAnimationShorthand(decl.Value, style)
+	case "animation-name":
+		style.AnimationName = splitTopLevel(decl.Value, ',')
+	case "animation-duration":
+		style.AnimationDuration = parseAnimationList(decl.Value)
+	case "animation-timing-function":
+		style.AnimationTimingFunction = parseAnimationList(decl.Value)
+	case "animation-delay":
+		style.AnimationDelay = parseAnimationList(decl.Value)
+	case "animation-iteration-count":
+		style.AnimationIterationCount = parseAnimationList(decl.Value)
+	case "animation-direction":
+		style.AnimationDirection = parseAnimationList(decl.Value)
+	case "animation-fill-mode":
+		style.AnimationFillMode = parseAnimationList(decl.Value)
+	case "animation-play-state":
+		style.AnimationPlayState = parseAnimationList(decl.Value)
 	
 	// Margin properties
 	case "margin":
@@ -456,6 +538,80 @@ func (sm *StyleManager) applyDeclaration(node *RenderNode, decl css.Declaration)
 		parseBorderShorthand(decl.Value, style, "bottom")
 	case "border-left":
 		parseBorderShorthand(decl.Value, style, "left")
+	
+	// Border radius properties
+	case "border-radius":
+		radii := parseBorderRadius(decl.Value)
+		style.BorderTopLeftRadius = radii[0]
+		style.BorderTopRightRadius = radii[1]
+		style.BorderBottomRightRadius = radii[2]
+		style.BorderBottomLeftRadius = radii[3]
+	case "border-top-left-radius":
+		style.BorderTopLeftRadius = decl.Value
+	case "border-top-right-radius":
+		style.BorderTopRightRadius = decl.Value
+	case "border-bottom-right-radius":
+		style.BorderBottomRightRadius = decl.Value
+	case "border-bottom-left-radius":
+		style.BorderBottomLeftRadius = decl.Value
+	
+	// Box decoration properties
+	case "box-shadow":
+		style.BoxShadow = parseBoxShadow(decl.Value)
+	case "outline":
+		parseOutlineShorthand(decl.Value, style)
+	case "outline-width":
+		style.OutlineWidth = decl.Value
+	case "outline-style":
+		style.OutlineStyle = decl.Value
+	case "outline-color":
+		if val, err := parseColor(decl.Value); err == nil {
+			style.OutlineColor = val
+		}
+	case "outline-offset":
+		style.OutlineOffset = decl.Value
+	
+	// Positioning properties
+	case "position":
+		style.Position = strings.ToLower(strings.TrimSpace(decl.Value))
+	
+	// Overflow properties
+	case "overflow":
+		// Shorthand: one value applies to both axes, two values are x then y
+		values := strings.Fields(decl.Value)
+		if len(values) == 1 {
+			style.OverflowX = values[0]
+			style.OverflowY = values[0]
+		} else if len(values) == 2 {
+			style.OverflowX = values[0]
+			style.OverflowY = values[1]
+		}
+	case "overflow-x":
+		style.OverflowX = decl.Value
+	case "overflow-y":
+		style.OverflowY = decl.Value
+	
+	// Text properties
+	case "white-space":
+		style.WhiteSpace = strings.ToLower(decl.Value)
+	case "text-align":
+		style.TextAlign = strings.ToLower(decl.Value)
+	case "line-height":
+		style.LineHeight = decl.Value
+	case "letter-spacing":
+		style.LetterSpacing = decl.Value
+	case "word-spacing":
+		style.WordSpacing = decl.Value
+	case "text-indent":
+		style.TextIndent = decl.Value
+	case "text-transform":
+		style.TextTransform = strings.ToLower(decl.Value)
+	case "vertical-align":
+		style.VerticalAlign = strings.ToLower(decl.Value)
+	case "direction":
+		style.Direction = strings.ToLower(strings.TrimSpace(decl.Value))
+	case "unicode-bidi":
+		style.UnicodeBidi = strings.ToLower(strings.TrimSpace(decl.Value))
 	}
 }
 
@@ -523,6 +679,29 @@ func parseLength(value string, fontSize float32) float32 {
 	return 0
 }
 
+// parseLineHeight parses a CSS line-height value and returns it in pixels
+// Unitless numbers and percentages are relative to the font size, "normal" returns 0
+func parseLineHeight(value string, fontSize float32) float32 {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "normal" {
+		return 0
+	}
+	
+	if strings.HasSuffix(value, "%") {
+		if val, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 32); err == nil {
+			return float32(val) / 100 * fontSize
+		}
+		return 0
+	}
+	
+	// A plain number is a multiplier of the font size, unlike other lengths
+	if val, err := strconv.ParseFloat(value, 32); err == nil {
+		return float32(val) * fontSize
+	}
+	
+	return parseLength(value, fontSize)
+}
+
 func parseColor(value string) (color.Color, error) {
 	lowerValue := strings.ToLower(value)
 	if hex, ok := colorNameToHex[lowerValue]; ok {
@@ -531,10 +710,54 @@ func parseColor(value string) (color.Color, error) {
 	if strings.HasPrefix(lowerValue, "#") {
 		return parseHexColor(lowerValue)
 	}
-	// Add support for other color formats like rgb() later
+	if lowerValue == "transparent" {
+		return color.NRGBA{}, nil
+	}
+	if strings.HasPrefix(lowerValue, "rgb(") || strings.HasPrefix(lowerValue, "rgba(") {
+		return parseRGBColor(lowerValue)
+	}
 	return color.Black, fmt.Errorf("unsupported color format: %s", value)
 }
 
+// parseRGBColor parses rgb() and rgba() colors, with comma or space
+// separated channels and an optional alpha after a slash
+func parseRGBColor(value string) (color.Color, error) {
+	open := strings.Index(value, "(")
+	if open < 0 || !strings.HasSuffix(value, ")") {
+		return nil, fmt.Errorf("invalid rgb color: %s", value)
+	}
+	args := strings.NewReplacer(",", " ", "/", " ").Replace(value[open+1 : len(value)-1])
+	parts := strings.Fields(args)
+	if len(parts) != 3 && len(parts) != 4 {
+		return nil, fmt.Errorf("invalid rgb color: %s", value)
+	}
+	
+	var channels [4]float64
+	channels[3] = 1
+	for i, part := range parts {
+		percent := strings.HasSuffix(part, "%")
+		val, err := strconv.ParseFloat(strings.TrimSuffix(part, "%"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rgb color: %s", value)
+		}
+		switch {
+		case percent && i < 3:
+			val = val * 255 / 100
+		case percent:
+			val /= 100
+		}
+		channels[i] = val
+	}
+	
+	clamp := func(v, limit float64) float64 { return math.Max(0, math.Min(v, limit)) }
+	return color.NRGBA{
+		R: uint8(math.Round(clamp(channels[0], 255))),
+		G: uint8(math.Round(clamp(channels[1], 255))),
+		B: uint8(math.Round(clamp(channels[2], 255))),
+		A: uint8(math.Round(clamp(channels[3], 1) * 255)),
+	}, nil
+}
+
 func parseHexColor(hex string) (color.Color, error) {
 	hex = strings.TrimPrefix(hex, "#")
 	if len(hex) == 3 {
@@ -765,6 +988,68 @@ func parseBorderShorthand(value string, style *Style, side string) {
 	}
 }
 
+// parseBorderRadius parses the border-radius shorthand
+// Returns [top-left, top-right, bottom-right, bottom-left] radii, each either
+// one value or horizontal and vertical values when a slash is used
+func parseBorderRadius(value string) [4]string {
+	horizontal, vertical, hasVertical := strings.Cut(value, "/")
+	radii := parseBoxShorthand(horizontal)
+	if hasVertical {
+		verticalRadii := parseBoxShorthand(vertical)
+		for i := range radii {
+			radii[i] += " " + verticalRadii[i]
+		}
+	}
+	return radii
+}
+
+// parseBoxShadow parses the box-shadow property; invalid shadows are skipped
+func parseBoxShadow(value string) []BoxShadow {
+	if strings.EqualFold(strings.TrimSpace(value), "none") {
+		return nil
+	}
+	
+	var shadows []BoxShadow
+	for _, item := range splitTopLevel(value, ',') {
+		var shadow BoxShadow
+		var lengths []string
+		for _, part := range splitTopLevel(item, ' ') {
+			if strings.EqualFold(part, "inset") {
+				shadow.Inset = true
+			} else if c, err := parseColor(part); err == nil {
+				shadow.Color = c
+			} else {
+				lengths = append(lengths, part)
+			}
+		}
+		if len(lengths) < 2 || len(lengths) > 4 {
+			continue
+		}
+		shadow.OffsetX, shadow.OffsetY = lengths[0], lengths[1]
+		if len(lengths) > 2 {
+			shadow.Blur = lengths[2]
+		}
+		if len(lengths) > 3 {
+			shadow.Spread = lengths[3]
+		}
+		shadows = append(shadows, shadow)
+	}
+	return shadows
+}
+
+// parseOutlineShorthand parses "outline: 2px solid red" in any order
+func parseOutlineShorthand(value string, style *Style) {
+	for _, part := range strings.Fields(value) {
+		if isBorderStyle(part) || part == "auto" {
+			style.OutlineStyle = part
+		} else if c, err := parseColor(part); err == nil {
+			style.OutlineColor = c
+		} else {
+			style.OutlineWidth = part
+		}
+	}
+}
+
 // isBorderStyle checks if a string is a valid border style
 func isBorderStyle(s string) bool {
 	styles := []string{"none", "hidden", "dotted", "dashed", "solid", "double", "groove", "ridge", "inset", "outset"}
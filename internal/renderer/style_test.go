@@ -1,11 +1,16 @@
 package renderer
 
 import (
+	"context"
 	"image/color"
+	"net/http"
+	"net/url"
 	"strings"
 	"testing"
 
 	"golang.org/x/net/html"
+
+	"github.com/vyquocvu/goosie/internal/net"
 )
 
 func TestStyleApplication(t *testing.T) {
@@ -205,3 +210,58 @@ func TestNamedColorApplication(t *testing.T) {
 		t.Errorf("expected background color %v, got %v", expectedBgColor, divNode.ComputedStyle.BackgroundColor)
 	}
 }
+
+func TestExtraStylesAfterPageStyles(t *testing.T) {
+	r := NewRenderer(800, 600)
+	r.SetCurrentURL("https://news.example/")
+	var styledURL string
+	r.SetExtraStyles(func(pageURL string) string {
+		styledURL = pageURL
+		return ".ad { display: none !important; }\n"
+	})
+
+	_, err := r.LayoutHTML(`<html><head><style>.ad { display: block; color: red; }</style></head>
+		<body><div class="ad">Buy now</div><p>Story</p></body></html>`)
+	if err != nil {
+		t.Fatalf("LayoutHTML failed: %v", err)
+	}
+	if styledURL != "https://news.example/" {
+		t.Errorf("Expected the extra styles of the page's URL, got %q", styledURL)
+	}
+	ad := findNodeByClass(r.currentRenderTree, "ad")
+	if ad == nil || ad.ComputedStyle.Display != "none" {
+		t.Fatalf("Expected the extra rule to win over the page's, got %+v", ad)
+	}
+	if ad.ComputedStyle.Color != (color.RGBA{R: 0xff, A: 0xff}) {
+		t.Errorf("Expected the page's other declarations to apply, got %v", ad.ComputedStyle.Color)
+	}
+}
+
+func TestInlineStylesFollowContentSecurityPolicy(t *testing.T) {
+	page, _ := url.Parse("https://news.example/")
+	header := http.Header{}
+	header.Set("Content-Security-Policy", "style-src 'self' 'nonce-n0nce'")
+	policy := net.NewDocumentPolicy(page, header)
+	var violations []net.Violation
+	policy.OnViolation = func(v net.Violation) { violations = append(violations, v) }
+
+	r := NewRenderer(800, 600)
+	r.SetLoadContext(net.WithDocumentPolicy(context.Background(), policy))
+	_, err := r.LayoutHTML(`<html><head>
+		<style nonce="n0nce">.a { color: red; }</style>
+		<style>.b { color: red; }</style>
+		</head><body><p class="a">Allowed</p><p class="b">Refused</p></body></html>`)
+	if err != nil {
+		t.Fatalf("LayoutHTML failed: %v", err)
+	}
+	red := color.RGBA{R: 0xff, A: 0xff}
+	if a := findNodeByClass(r.currentRenderTree, "a"); a == nil || a.ComputedStyle.Color != red {
+		t.Errorf("Expected the <style> with the nonce to apply, got %+v", a)
+	}
+	if b := findNodeByClass(r.currentRenderTree, "b"); b == nil || b.ComputedStyle.Color == red {
+		t.Errorf("Expected the <style> without the nonce to be refused, got %+v", b)
+	}
+	if len(violations) != 1 || !violations[0].Inline {
+		t.Errorf("Expected one inline style violation, got %v", violations)
+	}
+}
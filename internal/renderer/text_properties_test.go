@@ -0,0 +1,333 @@
+package renderer
+
+import (
+	"testing"
+
+	"github.com/vyquocvu/goosie/internal/css"
+)
+
+// newStyledParagraph creates a paragraph with a single text child and the given declarations
+func newStyledParagraph(text string, decls ...css.Declaration) (*RenderNode, *RenderNode) {
+	p := NewRenderNode(NodeTypeElement)
+	p.TagName = "p"
+	p.ComputedStyle = &Style{}
+
+	sm := NewStyleManager(nil)
+	for _, decl := range decls {
+		sm.applyDeclaration(p, decl)
+	}
+
+	child := NewRenderNode(NodeTypeText)
+	child.Text = text
+	p.AddChild(child)
+
+	return p, child
+}
+
+func TestTextPropertyParsing(t *testing.T) {
+	p, _ := newStyledParagraph("x",
+		css.Declaration{Property: "white-space", Value: "Pre-Wrap"},
+		css.Declaration{Property: "text-align", Value: "justify"},
+		css.Declaration{Property: "line-height", Value: "1.5"},
+		css.Declaration{Property: "letter-spacing", Value: "2px"},
+		css.Declaration{Property: "word-spacing", Value: "0.5em"},
+		css.Declaration{Property: "text-indent", Value: "10%"},
+		css.Declaration{Property: "text-transform", Value: "uppercase"},
+		css.Declaration{Property: "vertical-align", Value: "super"},
+	)
+
+	style := p.ComputedStyle
+	if ParseWhiteSpaceMode(style.WhiteSpace) != WhiteSpacePreWrap {
+		t.Errorf("Expected white-space pre-wrap, got %q", style.WhiteSpace)
+	}
+	if ParseTextAlign(style.TextAlign) != TextAlignJustify {
+		t.Errorf("Expected text-align justify, got %q", style.TextAlign)
+	}
+	if got := parseLineHeight(style.LineHeight, 16); got != 24 {
+		t.Errorf("Expected line-height 24px, got %f", got)
+	}
+	if got := parseLength(style.WordSpacing, 16); got != 8 {
+		t.Errorf("Expected word-spacing 8px, got %f", got)
+	}
+	if got := parseTextIndent(style.TextIndent, 16, 300); got != 30 {
+		t.Errorf("Expected text-indent 30px, got %f", got)
+	}
+	if ParseVerticalAlign(style.VerticalAlign) != VerticalAlignSuper {
+		t.Errorf("Expected vertical-align super, got %q", style.VerticalAlign)
+	}
+}
+
+func TestParseLineHeight(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected float32
+	}{
+		{"", 0},
+		{"normal", 0},
+		{"2", 32},
+		{"150%", 24},
+		{"20px", 20},
+		{"1.25em", 20},
+	}
+
+	for _, tt := range tests {
+		if got := parseLineHeight(tt.value, 16); got != tt.expected {
+			t.Errorf("parseLineHeight(%q) = %f, expected %f", tt.value, got, tt.expected)
+		}
+	}
+}
+
+func TestApplyTextTransform(t *testing.T) {
+	tests := []struct {
+		transform string
+		expected  string
+	}{
+		{"none", "hello wORLD-wide"},
+		{"uppercase", "HELLO WORLD-WIDE"},
+		{"lowercase", "hello world-wide"},
+		{"capitalize", "Hello WORLD-Wide"},
+	}
+
+	for _, tt := range tests {
+		if got := ApplyTextTransform("hello wORLD-wide", tt.transform); got != tt.expected {
+			t.Errorf("ApplyTextTransform(%q) = %q, expected %q", tt.transform, got, tt.expected)
+		}
+	}
+}
+
+func TestWhiteSpacePreForcesLineBreaks(t *testing.T) {
+	ile := NewInlineLayoutEngine(NewFontMetrics(16.0), 16.0)
+	p, _ := newStyledParagraph("one\n\nthree")
+
+	lines, _ := ile.LayoutInlineContent(p, 0, 0, 400, WhiteSpacePre)
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %d", len(lines))
+	}
+	if lines[1].Height != lines[0].Height {
+		t.Errorf("Expected empty line to keep the line height %f, got %f", lines[0].Height, lines[1].Height)
+	}
+	if !lines[0].HardBreak || lines[2].HardBreak {
+		t.Error("Expected only lines ending in a newline to be hard breaks")
+	}
+}
+
+func TestWhiteSpaceNoWrapDoesNotWrap(t *testing.T) {
+	ile := NewInlineLayoutEngine(NewFontMetrics(16.0), 16.0)
+	p, _ := newStyledParagraph("This text is far too long for the available width")
+
+	lines, _ := ile.LayoutInlineContent(p, 0, 0, 50, WhiteSpaceNoWrap)
+	if len(lines) != 1 {
+		t.Errorf("Expected nowrap text on a single line, got %d lines", len(lines))
+	}
+
+	lines, _ = ile.LayoutInlineContent(p, 0, 0, 50, WhiteSpacePreWrap)
+	if len(lines) <= 1 {
+		t.Errorf("Expected pre-wrap text to wrap, got %d lines", len(lines))
+	}
+}
+
+func TestWhiteSpaceFromStyle(t *testing.T) {
+	le := NewLayoutEngine(800, 600)
+	p, _ := newStyledParagraph("a\nb", css.Declaration{Property: "white-space", Value: "pre-line"})
+
+	layout := le.ComputeLayout(p)
+	if len(layout.LineBoxes) != 2 {
+		t.Errorf("Expected pre-line to produce 2 lines, got %d", len(layout.LineBoxes))
+	}
+
+	pre := NewRenderNode(NodeTypeElement)
+	pre.TagName = "pre"
+	if le.whiteSpaceMode(pre) != WhiteSpacePre {
+		t.Error("Expected pre elements to default to white-space: pre")
+	}
+}
+
+func TestWhiteSpacePreDefaultOverridesInherited(t *testing.T) {
+	for _, tt := range []struct {
+		css      string
+		expected WhiteSpaceMode
+	}{
+		{"div { white-space: normal }", WhiteSpacePre},
+		{"pre { white-space: normal }", WhiteSpaceNormal},
+		{"div { white-space: pre-line }", WhiteSpacePre},
+	} {
+		stylesheet, err := css.NewParser(tt.css).Parse()
+		if err != nil {
+			t.Fatalf("Failed to parse CSS: %v", err)
+		}
+		renderTree, err := parseHTMLToRenderTree("<div><pre>a  b\nc</pre></div>")
+		if err != nil {
+			t.Fatalf("Failed to parse HTML: %v", err)
+		}
+		NewStyleManager(stylesheet).ApplyStyles(renderTree)
+
+		pre := findNodeByTag(renderTree, "pre")
+		if pre == nil {
+			t.Fatal("Expected a pre element")
+		}
+		le := NewLayoutEngine(800, 600)
+		if mode := le.whiteSpaceMode(pre); mode != tt.expected {
+			t.Errorf("%s: expected white-space mode %v for pre, got %v", tt.css, tt.expected, mode)
+		}
+	}
+}
+
+func TestTextAlign(t *testing.T) {
+	ile := NewInlineLayoutEngine(NewFontMetrics(16.0), 16.0)
+
+	for _, align := range []string{"right", "center"} {
+		p, _ := newStyledParagraph("short", css.Declaration{Property: "text-align", Value: align})
+		lines, _ := ile.LayoutInlineContent(p, 10, 0, 400, WhiteSpaceNormal)
+		if len(lines) != 1 {
+			t.Fatalf("Expected 1 line, got %d", len(lines))
+		}
+
+		free := lines[0].AvailableWidth - lines[0].Width
+		expected := 10 + free
+		if align == "center" {
+			expected = 10 + free/2
+		}
+		if lines[0].X != expected {
+			t.Errorf("text-align %s: expected line X %f, got %f", align, expected, lines[0].X)
+		}
+	}
+}
+
+func TestTextAlignJustify(t *testing.T) {
+	ile := NewInlineLayoutEngine(NewFontMetrics(16.0), 16.0)
+	p, _ := newStyledParagraph("the quick brown fox jumps over the lazy dog again and again",
+		css.Declaration{Property: "text-align", Value: "justify"})
+
+	lines, _ := ile.LayoutInlineContent(p, 0, 0, 150, WhiteSpaceNormal)
+	if len(lines) < 2 {
+		t.Fatalf("Expected multiple lines, got %d", len(lines))
+	}
+
+	for i, line := range lines[:len(lines)-1] {
+		last := line.InlineBoxes[len(line.InlineBoxes)-1]
+		if end := last.X + last.Width; end < line.AvailableWidth-0.01 || end > line.AvailableWidth+0.01 {
+			t.Errorf("Line %d: expected justified text to end at %f, got %f", i, line.AvailableWidth, end)
+		}
+	}
+
+	lastLine := lines[len(lines)-1]
+	if lastLine.Width >= lastLine.AvailableWidth {
+		t.Error("Expected the last line not to be justified")
+	}
+}
+
+func TestTextIndent(t *testing.T) {
+	ile := NewInlineLayoutEngine(NewFontMetrics(16.0), 16.0)
+	p, _ := newStyledParagraph("the quick brown fox jumps over the lazy dog",
+		css.Declaration{Property: "text-indent", Value: "2em"})
+
+	lines, _ := ile.LayoutInlineContent(p, 0, 0, 150, WhiteSpaceNormal)
+	if len(lines) < 2 {
+		t.Fatalf("Expected multiple lines, got %d", len(lines))
+	}
+	if lines[0].X != 32 || lines[0].AvailableWidth != 118 {
+		t.Errorf("Expected first line indented by 32px, got X=%f width=%f", lines[0].X, lines[0].AvailableWidth)
+	}
+	if lines[1].X != 0 {
+		t.Errorf("Expected following lines not to be indented, got X=%f", lines[1].X)
+	}
+}
+
+func TestLetterAndWordSpacing(t *testing.T) {
+	ile := NewInlineLayoutEngine(NewFontMetrics(16.0), 16.0)
+
+	plain, _ := newStyledParagraph("ab cd")
+	spaced, _ := newStyledParagraph("ab cd",
+		css.Declaration{Property: "letter-spacing", Value: "1px"},
+		css.Declaration{Property: "word-spacing", Value: "4px"})
+
+	plainLines, _ := ile.LayoutInlineContent(plain, 0, 0, 400, WhiteSpaceNormal)
+	spacedLines, _ := ile.LayoutInlineContent(spaced, 0, 0, 400, WhiteSpaceNormal)
+
+	// Four letters, one space with letter spacing, and the word spacing
+	if diff := spacedLines[0].Width - plainLines[0].Width; diff != 9 {
+		t.Errorf("Expected spacing to add 9px, got %f", diff)
+	}
+}
+
+func TestLineHeight(t *testing.T) {
+	ile := NewInlineLayoutEngine(NewFontMetrics(16.0), 16.0)
+	p, _ := newStyledParagraph("one two three four five six seven eight",
+		css.Declaration{Property: "line-height", Value: "30px"})
+
+	lines, totalHeight := ile.LayoutInlineContent(p, 0, 0, 100, WhiteSpaceNormal)
+	for i, line := range lines {
+		if line.Height != 30 {
+			t.Errorf("Line %d: expected height 30, got %f", i, line.Height)
+		}
+	}
+	if totalHeight != 30*float32(len(lines)) {
+		t.Errorf("Expected total height %f, got %f", 30*float32(len(lines)), totalHeight)
+	}
+}
+
+func TestVerticalAlignFromStyle(t *testing.T) {
+	ile := NewInlineLayoutEngine(NewFontMetrics(16.0), 16.0)
+
+	p, _ := newStyledParagraph("base ")
+	sup := NewRenderNode(NodeTypeElement)
+	sup.TagName = "sup"
+	p.AddChild(sup)
+	supText := NewRenderNode(NodeTypeText)
+	supText.Text = "2"
+	sup.AddChild(supText)
+
+	span := NewRenderNode(NodeTypeElement)
+	span.TagName = "span"
+	span.ComputedStyle = &Style{VerticalAlign: "sub"}
+	p.AddChild(span)
+	spanText := NewRenderNode(NodeTypeText)
+	spanText.Text = "n"
+	span.AddChild(spanText)
+
+	lines, _ := ile.LayoutInlineContent(p, 0, 0, 400, WhiteSpaceNormal)
+	if len(lines) != 1 || len(lines[0].InlineBoxes) != 3 {
+		t.Fatalf("Expected one line with 3 boxes, got %d lines", len(lines))
+	}
+
+	base, super, sub := lines[0].InlineBoxes[0], lines[0].InlineBoxes[1], lines[0].InlineBoxes[2]
+	if super.VerticalAlign != VerticalAlignSuper || sub.VerticalAlign != VerticalAlignSub {
+		t.Fatalf("Expected super and sub alignment, got %d and %d", super.VerticalAlign, sub.VerticalAlign)
+	}
+	if super.Y >= base.Y {
+		t.Errorf("Expected superscript above the baseline box (%f >= %f)", super.Y, base.Y)
+	}
+	if sub.Y <= base.Y {
+		t.Errorf("Expected subscript below the baseline box (%f <= %f)", sub.Y, base.Y)
+	}
+
+	// Shifted boxes grow the line beyond a single line of text
+	if lines[0].Height <= base.Ascent+base.Descent {
+		t.Errorf("Expected line height to include shifted boxes, got %f", lines[0].Height)
+	}
+}
+
+func TestVerticalAlignTopAndBottom(t *testing.T) {
+	ile := NewInlineLayoutEngine(NewFontMetrics(16.0), 16.0)
+
+	line := ile.newLineBox(0, 0, 400)
+	small := &InlineBox{Ascent: 9, Descent: 3, Height: 14, VerticalAlign: VerticalAlignBaseline}
+	tall := &InlineBox{Ascent: 30, Descent: 10, Height: 48, VerticalAlign: VerticalAlignTop}
+	bottom := &InlineBox{Ascent: 6, Descent: 2, Height: 10, VerticalAlign: VerticalAlignBottom}
+	line.InlineBoxes = append(line.InlineBoxes, small, tall, bottom)
+
+	ile.finalizeLine(line)
+
+	if line.Height != 40 {
+		t.Errorf("Expected the top aligned box to grow the line to 40, got %f", line.Height)
+	}
+	if tall.Y != 0 {
+		t.Errorf("Expected top aligned box at 0, got %f", tall.Y)
+	}
+	if bottom.Y != 32 {
+		t.Errorf("Expected bottom aligned box at 32, got %f", bottom.Y)
+	}
+	if small.Y != 0 {
+		t.Errorf("Expected baseline box at the top of the grown line, got %f", small.Y)
+	}
+}
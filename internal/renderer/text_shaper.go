@@ -0,0 +1,384 @@
+package renderer
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/theme"
+	"github.com/go-text/typesetting/di"
+	"github.com/go-text/typesetting/font"
+	"github.com/go-text/typesetting/fontscan"
+	"github.com/go-text/typesetting/shaping"
+	"golang.org/x/image/math/fixed"
+)
+
+// defaultShapedRunCacheSize is the number of shaped runs kept by a TextShaper
+const defaultShapedRunCacheSize = 4096
+
+// ShapedRun holds the metrics of a shaped run of text in pixels
+type ShapedRun struct {
+	Width   float32 // Advance of the run, including kerning
+	Ascent  float32 // Font ascent above the baseline
+	Descent float32 // Font descent below the baseline
+	LineGap float32 // Suggested gap between lines
+	Glyphs  int     // Number of glyphs after ligature substitution
+}
+
+// TextShaper loads fonts and shapes text with HarfBuzz-style shaping
+// Fyne's bundled fonts are always available; other families are looked up
+// among a document's web fonts and the system fonts. Shaped runs are cached by text, font and size.
+type TextShaper struct {
+	mu sync.Mutex
+
+	shaper    shaping.HarfbuzzShaper
+	segmenter shaping.Segmenter
+
+	// Fyne's bundled faces by style, plus the symbol font used as a fallback
+	bundled map[fyne.TextStyle]*font.Face
+	symbol  *font.Face
+
+	// System fonts, loaded on the first lookup of a non-generic family
+	systemFonts *fontscan.FontMap
+	systemOnce  sync.Once
+	families    map[familyKey]*font.Face
+
+	// LRU cache of shaped runs
+	capacity int
+	runs     map[runKey]*list.Element
+	lruList  *list.List
+}
+
+// familyKey identifies a face of a font family
+type familyKey struct {
+	family string
+	bold   bool
+	italic bool
+}
+
+// runKey identifies a shaped run
+type runKey struct {
+	text   string
+	family string
+	size   float32
+	style  fyne.TextStyle
+	fonts  uint64 // Generation of the document's web fonts
+}
+
+// runEntry is an entry of the shaped run cache
+type runEntry struct {
+	key runKey
+	run ShapedRun
+}
+
+var (
+	defaultTextShaper     *TextShaper
+	defaultTextShaperOnce sync.Once
+)
+
+// DefaultTextShaper returns the process wide text shaper
+// Parsing fonts is expensive, so all FontMetrics share one shaper
+func DefaultTextShaper() *TextShaper {
+	defaultTextShaperOnce.Do(func() {
+		defaultTextShaper = NewTextShaper(defaultShapedRunCacheSize)
+	})
+	return defaultTextShaper
+}
+
+// NewTextShaper creates a text shaper with Fyne's bundled fonts
+func NewTextShaper(cacheSize int) *TextShaper {
+	if cacheSize <= 0 {
+		cacheSize = defaultShapedRunCacheSize
+	}
+
+	ts := &TextShaper{
+		bundled:  make(map[fyne.TextStyle]*font.Face),
+		families: make(map[familyKey]*font.Face),
+		capacity: cacheSize,
+		runs:     make(map[runKey]*list.Element),
+		lruList:  list.New(),
+	}
+
+	bundled := map[fyne.TextStyle]fyne.Resource{
+		{}:                         theme.DefaultTextFont(),
+		{Bold: true}:               theme.DefaultTextBoldFont(),
+		{Italic: true}:             theme.DefaultTextItalicFont(),
+		{Bold: true, Italic: true}: theme.DefaultTextBoldItalicFont(),
+		{Monospace: true}:          theme.DefaultTextMonospaceFont(),
+	}
+	for style, resource := range bundled {
+		if face, err := parseFontResource(resource); err == nil {
+			ts.bundled[style] = face
+		} else {
+			fyne.LogError("failed to load bundled font", err)
+		}
+	}
+	if face, err := parseFontResource(theme.DefaultSymbolFont()); err == nil {
+		ts.symbol = face
+	}
+
+	return ts
+}
+
+// parseFontResource parses a TrueType or OpenType font from a Fyne resource
+func parseFontResource(resource fyne.Resource) (*font.Face, error) {
+	if resource == nil {
+		return nil, fmt.Errorf("missing font resource")
+	}
+	return font.ParseTTF(bytes.NewReader(resource.Content()))
+}
+
+// Shape shapes text in the given font-family list, size and style
+// An empty family selects the bundled font. Returns false if no font is available.
+func (ts *TextShaper) Shape(text, family string, size float32, style fyne.TextStyle) (ShapedRun, bool) {
+	return ts.ShapeWithFonts(text, family, size, style, nil)
+}
+
+// ShapeWithFonts shapes text like Shape, looking families up among the web
+// fonts of a document before the installed fonts
+func (ts *TextShaper) ShapeWithFonts(text, family string, size float32, style fyne.TextStyle, fonts *FontFaceSet) (ShapedRun, bool) {
+	// Scanning the system fonts is slow, so it happens before taking the lock
+	for _, name := range ParseFontFamilyList(family) {
+		if !isBundledFontFamily(name) && !fonts.HasFamily(name) {
+			ts.loadSystemFonts()
+			break
+		}
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	key := runKey{text: text, family: family, size: size, style: style, fonts: fonts.Generation()}
+	if elem, ok := ts.runs[key]; ok {
+		ts.lruList.MoveToFront(elem)
+		return elem.Value.(*runEntry).run, true
+	}
+
+	faces := ts.faceChain(family, style, fonts)
+	if len(faces) == 0 {
+		return ShapedRun{}, false
+	}
+
+	run := ts.shapeRuns(text, size, faces)
+	ts.addRun(key, run)
+	return run, true
+}
+
+// shapeRuns splits text into runs by script, direction and font and shapes each of them
+func (ts *TextShaper) shapeRuns(text string, size float32, faces faceChain) ShapedRun {
+	// Tabs and newlines are measured as spaces
+	runes := []rune(strings.NewReplacer("\t", " ", "\n", " ", "\r", "").Replace(text))
+
+	input := shaping.Input{
+		Text:      runes,
+		RunStart:  0,
+		RunEnd:    len(runes),
+		Direction: di.DirectionLTR,
+		Face:      faces[0],
+		Size:      floatToFixed(size),
+	}
+
+	// The primary face defines the line metrics, even for empty text
+	run := ShapedRun{}
+	ts.applyLineBounds(&run, faces[0], size)
+
+	if len(runes) == 0 {
+		return run
+	}
+
+	for _, in := range ts.segmenter.Split(input, faces) {
+		out := ts.shaper.Shape(in)
+		run.Width += fixedToFloat(out.Advance)
+		run.Glyphs += len(out.Glyphs)
+		if in.Face != faces[0] {
+			ts.applyLineBounds(&run, in.Face, size)
+		}
+	}
+
+	return run
+}
+
+// applyLineBounds grows the line metrics of a run to fit a face
+func (ts *TextShaper) applyLineBounds(run *ShapedRun, face *font.Face, size float32) {
+	extents, ok := face.FontHExtents()
+	if !ok || face.Upem() == 0 {
+		return
+	}
+
+	scale := size / float32(face.Upem())
+	if ascent := extents.Ascender * scale; ascent > run.Ascent {
+		run.Ascent = ascent
+	}
+	if descent := -extents.Descender * scale; descent > run.Descent {
+		run.Descent = descent
+	}
+	if gap := extents.LineGap * scale; gap > run.LineGap {
+		run.LineGap = gap
+	}
+}
+
+// faceChain returns the faces used for text in a font-family list and style,
+// in fallback order: the listed families that are loaded web fonts or
+// installed, then the bundled font for the style, then the symbol font
+func (ts *TextShaper) faceChain(families string, style fyne.TextStyle, fonts *FontFaceSet) faceChain {
+	chain := make(faceChain, 0, 3)
+
+	for _, family := range ParseFontFamilyList(families) {
+		if strings.EqualFold(family, "monospace") || strings.EqualFold(family, "ui-monospace") {
+			style = fyne.TextStyle{Monospace: true}
+		}
+		if fonts.HasFamily(family) {
+			if face := fonts.resolve(family, style); face != nil {
+				chain = append(chain, face)
+			}
+			continue
+		}
+		if face := ts.lookupFamily(family, style); face != nil {
+			chain = append(chain, face)
+		}
+	}
+
+	bundledStyle := fyne.TextStyle{Bold: style.Bold, Italic: style.Italic}
+	if style.Monospace {
+		bundledStyle = fyne.TextStyle{Monospace: true}
+	}
+	if face := ts.bundled[bundledStyle]; face != nil {
+		chain = append(chain, face)
+	} else if face := ts.bundled[fyne.TextStyle{}]; face != nil {
+		chain = append(chain, face)
+	}
+
+	if ts.symbol != nil {
+		chain = append(chain, ts.symbol)
+	}
+
+	return chain
+}
+
+// ParseFontFamilyList splits a CSS font-family value into unquoted family names
+func ParseFontFamilyList(value string) []string {
+	families := make([]string, 0)
+	for _, family := range strings.Split(value, ",") {
+		family = strings.Trim(strings.TrimSpace(family), `"'`)
+		if family != "" {
+			families = append(families, family)
+		}
+	}
+	return families
+}
+
+// HasFamily reports whether a font family is installed or served by the bundled fonts
+func (ts *TextShaper) HasFamily(family string, style fyne.TextStyle) bool {
+	if isBundledFontFamily(family) {
+		return true
+	}
+	ts.loadSystemFonts()
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.lookupFamily(family, style) != nil
+}
+
+// lookupFamily returns the system face of a font family, or nil for generic
+// families and families that are not installed
+// Callers load the system fonts before taking the lock, so this rarely scans
+func (ts *TextShaper) lookupFamily(family string, style fyne.TextStyle) *font.Face {
+	if isBundledFontFamily(family) {
+		return nil
+	}
+
+	key := familyKey{family: font.NormalizeFamily(family), bold: style.Bold, italic: style.Italic}
+	if face, ok := ts.families[key]; ok {
+		return face
+	}
+
+	var face *font.Face
+	ts.loadSystemFonts()
+	if fm := ts.systemFonts; fm != nil {
+		aspect := font.Aspect{Style: font.StyleNormal, Weight: font.WeightNormal}
+		if style.Bold {
+			aspect.Weight = font.WeightBold
+		}
+		if style.Italic {
+			aspect.Style = font.StyleItalic
+		}
+
+		fm.SetQuery(fontscan.Query{Families: []string{family}, Aspect: aspect})
+		if candidate := fm.ResolveFace(' '); candidate != nil {
+			// The font map falls back to other families; only accept an exact match
+			if resolved, _ := fm.FontMetadata(candidate.Font); font.NormalizeFamily(resolved) == key.family {
+				face = candidate
+			}
+		}
+	}
+
+	ts.families[key] = face
+	return face
+}
+
+// loadSystemFonts indexes the system fonts on first use
+// The scan can take seconds, so callers run it before taking ts.mu
+func (ts *TextShaper) loadSystemFonts() {
+	ts.systemOnce.Do(func() {
+		fm := fontscan.NewFontMap(log.New(io.Discard, "", 0))
+		if err := fm.UseSystemFonts(""); err == nil {
+			ts.systemFonts = fm
+		}
+	})
+}
+
+// addRun stores a shaped run, evicting the least recently used one if full
+func (ts *TextShaper) addRun(key runKey, run ShapedRun) {
+	elem := ts.lruList.PushFront(&runEntry{key: key, run: run})
+	ts.runs[key] = elem
+
+	if ts.lruList.Len() > ts.capacity {
+		oldest := ts.lruList.Back()
+		ts.lruList.Remove(oldest)
+		delete(ts.runs, oldest.Value.(*runEntry).key)
+	}
+}
+
+// CachedRuns returns the number of shaped runs in the cache
+func (ts *TextShaper) CachedRuns() int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.lruList.Len()
+}
+
+// isBundledFontFamily reports whether a family is served by Fyne's bundled fonts
+func isBundledFontFamily(family string) bool {
+	switch strings.ToLower(family) {
+	case "", "sans-serif", "system-ui", "ui-sans-serif", "monospace", "ui-monospace", "-apple-system":
+		return true
+	default:
+		return false
+	}
+}
+
+// faceChain is a font fallback list implementing shaping.Fontmap
+type faceChain []*font.Face
+
+// ResolveFace returns the first face with a glyph for r, or the primary face
+func (fc faceChain) ResolveFace(r rune) *font.Face {
+	for _, face := range fc {
+		if _, ok := face.NominalGlyph(r); ok {
+			return face
+		}
+	}
+	return fc[0]
+}
+
+// floatToFixed converts pixels to 26.6 fixed point
+func floatToFixed(f float32) fixed.Int26_6 {
+	return fixed.Int26_6(f * 64)
+}
+
+// fixedToFloat converts 26.6 fixed point to pixels
+func fixedToFloat(i fixed.Int26_6) float32 {
+	return float32(i) / 64
+}
@@ -0,0 +1,141 @@
+package renderer
+
+import (
+	"sync"
+	"testing"
+
+	"fyne.io/fyne/v2"
+)
+
+func TestTextShaperLoadsBundledFonts(t *testing.T) {
+	ts := NewTextShaper(16)
+
+	for _, style := range []fyne.TextStyle{{}, {Bold: true}, {Italic: true}, {Bold: true, Italic: true}, {Monospace: true}} {
+		if ts.bundled[style] == nil {
+			t.Errorf("Expected bundled font for style %+v", style)
+		}
+	}
+}
+
+func TestTextShaperMetrics(t *testing.T) {
+	ts := NewTextShaper(16)
+
+	run, ok := ts.Shape("Hello", "", 16, fyne.TextStyle{})
+	if !ok {
+		t.Fatal("Expected text to be shaped")
+	}
+	if run.Width <= 0 || run.Ascent <= 0 || run.Descent <= 0 {
+		t.Errorf("Expected positive metrics, got %+v", run)
+	}
+
+	// Metrics scale linearly with the font size
+	double, _ := ts.Shape("Hello", "", 32, fyne.TextStyle{})
+	if diff := double.Width - 2*run.Width; diff > 0.5 || diff < -0.5 {
+		t.Errorf("Expected width %f at double size, got %f", 2*run.Width, double.Width)
+	}
+	if diff := double.Ascent - 2*run.Ascent; diff > 0.01 || diff < -0.01 {
+		t.Errorf("Expected ascent %f at double size, got %f", 2*run.Ascent, double.Ascent)
+	}
+}
+
+func TestTextShaperKerning(t *testing.T) {
+	ts := NewTextShaper(16)
+
+	pair, _ := ts.Shape("AV", "", 32, fyne.TextStyle{})
+	a, _ := ts.Shape("A", "", 32, fyne.TextStyle{})
+	v, _ := ts.Shape("V", "", 32, fyne.TextStyle{})
+
+	if pair.Width >= a.Width+v.Width {
+		t.Errorf("Expected kerning to tighten AV (%f >= %f)", pair.Width, a.Width+v.Width)
+	}
+}
+
+func TestTextShaperMonospace(t *testing.T) {
+	ts := NewTextShaper(16)
+	mono := fyne.TextStyle{Monospace: true}
+
+	narrow, _ := ts.Shape("iiii", "", 16, mono)
+	wide, _ := ts.Shape("MMMM", "", 16, mono)
+	if narrow.Width != wide.Width {
+		t.Errorf("Expected equal widths in the monospace font, got %f and %f", narrow.Width, wide.Width)
+	}
+
+	// The generic monospace family selects the same font
+	generic, _ := ts.Shape("iiii", "monospace", 16, fyne.TextStyle{})
+	if generic.Width != narrow.Width {
+		t.Errorf("Expected font-family monospace to use the monospace font, got %f and %f", generic.Width, narrow.Width)
+	}
+}
+
+func TestTextShaperUnknownFamilyFallsBack(t *testing.T) {
+	ts := NewTextShaper(16)
+
+	fallback, ok := ts.Shape("Hello", `"No Such Font Family", sans-serif`, 16, fyne.TextStyle{})
+	if !ok {
+		t.Fatal("Expected text to be shaped with the fallback font")
+	}
+	bundled, _ := ts.Shape("Hello", "", 16, fyne.TextStyle{})
+	if fallback.Width != bundled.Width {
+		t.Errorf("Expected fallback to the bundled font (%f), got %f", bundled.Width, fallback.Width)
+	}
+}
+
+func TestTextShaperConcurrentSystemLookup(t *testing.T) {
+	ts := NewTextShaper(16)
+
+	// The first system font lookup scans outside the lock shared with bundled text
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, ok := ts.Shape("Hello", `"No Such Font Family"`, 16, fyne.TextStyle{}); !ok {
+				t.Error("Expected text in a missing family to be shaped with the fallback font")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, ok := ts.Shape("Hello", "", 16, fyne.TextStyle{}); !ok {
+				t.Error("Expected text to be shaped with the bundled font")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if ts.HasFamily("No Such Font Family", fyne.TextStyle{}) {
+		t.Error("Expected a missing family not to be found")
+	}
+}
+
+func TestTextShaperCache(t *testing.T) {
+	ts := NewTextShaper(2)
+
+	ts.Shape("one", "", 16, fyne.TextStyle{})
+	ts.Shape("one", "", 16, fyne.TextStyle{})
+	if ts.CachedRuns() != 1 {
+		t.Errorf("Expected 1 cached run, got %d", ts.CachedRuns())
+	}
+
+	// Size and style are part of the cache key
+	ts.Shape("one", "", 20, fyne.TextStyle{})
+	ts.Shape("one", "", 20, fyne.TextStyle{Bold: true})
+	if ts.CachedRuns() != 2 {
+		t.Errorf("Expected the cache to be capped at 2 runs, got %d", ts.CachedRuns())
+	}
+	if _, ok := ts.runs[runKey{text: "one", size: 16}]; ok {
+		t.Error("Expected the least recently used run to be evicted")
+	}
+}
+
+func TestParseFontFamilyList(t *testing.T) {
+	families := ParseFontFamilyList(` "Open Sans", 'Noto Serif' ,serif,`)
+	expected := []string{"Open Sans", "Noto Serif", "serif"}
+	if len(families) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, families)
+	}
+	for i := range expected {
+		if families[i] != expected[i] {
+			t.Errorf("Expected %q at %d, got %q", expected[i], i, families[i])
+		}
+	}
+}
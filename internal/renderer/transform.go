@@ -0,0 +1,234 @@
+package renderer
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/math/f64"
+)
+
+// TransformKind is the kind of a CSS transform function
+type TransformKind int
+
+const (
+	// TransformTranslate moves the box by X and Y
+	TransformTranslate TransformKind = iota
+	// TransformScale scales the box by Values[0] and Values[1]
+	TransformScale
+	// TransformRotate rotates the box clockwise by Values[0] degrees
+	TransformRotate
+	// TransformSkew skews the box by Values[0] and Values[1] degrees
+	TransformSkew
+	// TransformMatrix applies matrix(a, b, c, d, e, f) from Values
+	TransformMatrix
+)
+
+// TransformFunction is one function of a CSS transform list. Translations
+// keep their offsets as lengths or percentages of the border box.
+type TransformFunction struct {
+	Kind   TransformKind
+	X, Y   LengthPercent
+	Values [6]float32
+}
+
+// Transform is a parsed CSS transform and its transform-origin, resolved
+// against the border box when painting and hit testing
+type Transform struct {
+	Functions        []TransformFunction
+	OriginX, OriginY LengthPercent
+}
+
+// parseTransform parses the transform and transform-origin style values.
+// It returns nil for none and for invalid transforms, which are ignored.
+func parseTransform(value, origin string, fontSize float32) *Transform {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" || value == "none" {
+		return nil
+	}
+
+	t := &Transform{OriginX: LengthPercent{Fraction: 0.5}, OriginY: LengthPercent{Fraction: 0.5}}
+	for value != "" {
+		open := strings.IndexByte(value, '(')
+		end := strings.IndexByte(value, ')')
+		if open <= 0 || end < open {
+			return nil
+		}
+		fn, ok := parseTransformFunction(strings.TrimSpace(value[:open]), value[open+1:end], fontSize)
+		if !ok {
+			return nil
+		}
+		t.Functions = append(t.Functions, fn)
+		value = strings.TrimSpace(value[end+1:])
+	}
+
+	if x, y, ok := parsePosition(strings.ToLower(origin), fontSize); ok {
+		t.OriginX, t.OriginY = x, y
+	}
+	return t
+}
+
+// parseTransformFunction parses the comma separated arguments of a transform
+// function
+func parseTransformFunction(name, args string, fontSize float32) (TransformFunction, bool) {
+	var values []string
+	for _, arg := range strings.Split(args, ",") {
+		values = append(values, strings.TrimSpace(arg))
+	}
+
+	fn := TransformFunction{}
+	switch name {
+	case "translate", "translatex", "translatey":
+		fn.Kind = TransformTranslate
+		if name == "translate" && len(values) > 2 || name != "translate" && len(values) != 1 {
+			return fn, false
+		}
+		first, ok := parseLengthPercent(values[0], fontSize)
+		if !ok {
+			return fn, false
+		}
+		switch {
+		case name == "translatey":
+			fn.Y = first
+		case len(values) == 2:
+			if fn.Y, ok = parseLengthPercent(values[1], fontSize); !ok {
+				return fn, false
+			}
+			fallthrough
+		default:
+			fn.X = first
+		}
+
+	case "scale", "scalex", "scaley":
+		fn.Kind = TransformScale
+		if name == "scale" && len(values) > 2 || name != "scale" && len(values) != 1 {
+			return fn, false
+		}
+		factors, ok := parseTransformNumbers(values)
+		if !ok {
+			return fn, false
+		}
+		switch name {
+		case "scalex":
+			fn.Values[0], fn.Values[1] = factors[0], 1
+		case "scaley":
+			fn.Values[0], fn.Values[1] = 1, factors[0]
+		default:
+			fn.Values[0], fn.Values[1] = factors[0], factors[len(factors)-1]
+		}
+
+	case "rotate":
+		fn.Kind = TransformRotate
+		angle, ok := parseAngle(values[0])
+		if len(values) != 1 || !ok {
+			return fn, false
+		}
+		fn.Values[0] = angle
+
+	case "skew", "skewx", "skewy":
+		fn.Kind = TransformSkew
+		if name == "skew" && len(values) > 2 || name != "skew" && len(values) != 1 {
+			return fn, false
+		}
+		for i, value := range values {
+			angle, ok := parseAngle(value)
+			if !ok {
+				return fn, false
+			}
+			fn.Values[i] = angle
+		}
+		if name == "skewy" {
+			fn.Values[0], fn.Values[1] = 0, fn.Values[0]
+		}
+
+	case "matrix":
+		fn.Kind = TransformMatrix
+		numbers, ok := parseTransformNumbers(values)
+		if len(values) != 6 || !ok {
+			return fn, false
+		}
+		copy(fn.Values[:], numbers)
+
+	default:
+		return fn, false
+	}
+	return fn, true
+}
+
+// parseTransformNumbers parses numbers and percentages, returning
+// percentages as fractions
+func parseTransformNumbers(values []string) ([]float32, bool) {
+	numbers := make([]float32, len(values))
+	for i, value := range values {
+		scale := 1.0
+		if number, ok := strings.CutSuffix(value, "%"); ok {
+			value, scale = number, 0.01
+		}
+		number, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return nil, false
+		}
+		numbers[i] = float32(number * scale)
+	}
+	return numbers, true
+}
+
+// Matrix returns the affine matrix mapping the content of a box with the
+// given border box to the coordinates it is painted at
+func (t *Transform) Matrix(box Rect) f64.Aff3 {
+	originX := float64(box.X + t.OriginX.resolve(box.Width))
+	originY := float64(box.Y + t.OriginY.resolve(box.Height))
+
+	m := f64.Aff3{1, 0, originX, 0, 1, originY}
+	for _, fn := range t.Functions {
+		m = multiplyAff3(m, fn.matrix(box))
+	}
+	return multiplyAff3(m, f64.Aff3{1, 0, -originX, 0, 1, -originY})
+}
+
+// matrix returns the matrix of a single transform function
+func (fn TransformFunction) matrix(box Rect) f64.Aff3 {
+	v := fn.Values
+	switch fn.Kind {
+	case TransformTranslate:
+		return f64.Aff3{1, 0, float64(fn.X.resolve(box.Width)), 0, 1, float64(fn.Y.resolve(box.Height))}
+	case TransformScale:
+		return f64.Aff3{float64(v[0]), 0, 0, 0, float64(v[1]), 0}
+	case TransformRotate:
+		sin, cos := math.Sincos(float64(v[0]) * math.Pi / 180)
+		return f64.Aff3{cos, -sin, 0, sin, cos, 0}
+	case TransformSkew:
+		return f64.Aff3{1, math.Tan(float64(v[0]) * math.Pi / 180), 0, math.Tan(float64(v[1]) * math.Pi / 180), 1, 0}
+	case TransformMatrix:
+		// matrix(a, b, c, d, e, f) maps (x, y) to (ax + cy + e, bx + dy + f)
+		return f64.Aff3{float64(v[0]), float64(v[2]), float64(v[4]), float64(v[1]), float64(v[3]), float64(v[5])}
+	}
+	return identityTransform
+}
+
+// multiplyAff3 returns the matrix applying b and then a
+func multiplyAff3(a, b f64.Aff3) f64.Aff3 {
+	return f64.Aff3{
+		a[0]*b[0] + a[1]*b[3], a[0]*b[1] + a[1]*b[4], a[0]*b[2] + a[1]*b[5] + a[2],
+		a[3]*b[0] + a[4]*b[3], a[3]*b[1] + a[4]*b[4], a[3]*b[2] + a[4]*b[5] + a[5],
+	}
+}
+
+// invertAff3 returns the inverse of a matrix, and false if it is singular,
+// as a box scaled to nothing is
+func invertAff3(m f64.Aff3) (f64.Aff3, bool) {
+	det := m[0]*m[4] - m[1]*m[3]
+	if math.Abs(det) < 1e-12 {
+		return f64.Aff3{}, false
+	}
+	return f64.Aff3{
+		m[4] / det, -m[1] / det, (m[1]*m[5] - m[4]*m[2]) / det,
+		-m[3] / det, m[0] / det, (m[3]*m[2] - m[0]*m[5]) / det,
+	}, true
+}
+
+// transformPoint maps a point through a matrix
+func transformPoint(m f64.Aff3, x, y float32) (float32, float32) {
+	fx, fy := float64(x), float64(y)
+	return float32(m[0]*fx + m[1]*fy + m[2]), float32(m[3]*fx + m[4]*fy + m[5])
+}
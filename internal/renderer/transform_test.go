@@ -0,0 +1,148 @@
+package renderer
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"golang.org/x/image/math/f64"
+)
+
+// sameAff3 reports whether two matrices are equal up to rounding
+func sameAff3(a, b f64.Aff3) bool {
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-6 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseTransform(t *testing.T) {
+	box := Rect{Width: 100, Height: 50}
+	tests := []struct {
+		value, origin string
+		expected      f64.Aff3
+	}{
+		{"translate(10px, 50%)", "0 0", f64.Aff3{1, 0, 10, 0, 1, 25}},
+		{"translateY(2em)", "", f64.Aff3{1, 0, 0, 0, 1, 32}},
+		{"scale(2)", "", f64.Aff3{2, 0, -50, 0, 2, -25}},
+		{"scaleX(50%)", "left top", f64.Aff3{0.5, 0, 0, 0, 1, 0}},
+		{"rotate(90deg)", "0 0", f64.Aff3{0, -1, 0, 1, 0, 0}},
+		{"rotate(0.5turn)", "", f64.Aff3{-1, 0, 100, 0, -1, 50}},
+		{"skewX(45deg)", "left top", f64.Aff3{1, 1, 0, 0, 1, 0}},
+		{"matrix(1, 2, 3, 4, 5, 6)", "0 0", f64.Aff3{1, 3, 5, 2, 4, 6}},
+		{"translateX(10px) scale(2)", "0 0", f64.Aff3{2, 0, 10, 0, 2, 0}},
+		{"scale(2) translateX(10px)", "0 0", f64.Aff3{2, 0, 20, 0, 2, 0}},
+	}
+	for _, tt := range tests {
+		transform := parseTransform(tt.value, tt.origin, 16)
+		if transform == nil {
+			t.Errorf("parseTransform(%q) failed", tt.value)
+			continue
+		}
+		if m := transform.Matrix(box); !sameAff3(m, tt.expected) {
+			t.Errorf("parseTransform(%q, %q) = %v, expected %v", tt.value, tt.origin, m, tt.expected)
+		}
+	}
+
+	for _, value := range []string{"", "none", "rotate(10px)", "perspective(10px)", "scale(2", "translate(1px, 2px, 3px)"} {
+		if transform := parseTransform(value, "", 16); transform != nil {
+			t.Errorf("Expected %q to be ignored, got %+v", value, transform)
+		}
+	}
+}
+
+func TestInvertAff3(t *testing.T) {
+	m := parseTransform("rotate(30deg) scale(2, 3) translate(5px, 7px)", "", 16).Matrix(Rect{X: 10, Y: 20, Width: 100, Height: 50})
+	inverse, ok := invertAff3(m)
+	if !ok {
+		t.Fatal("Expected the matrix to be invertible")
+	}
+	if product := multiplyAff3(m, inverse); !sameAff3(product, identityTransform) {
+		t.Errorf("Expected the product with the inverse to be the identity, got %v", product)
+	}
+	if _, ok := invertAff3(f64.Aff3{0, 0, 5, 0, 1, 0}); ok {
+		t.Error("Expected a matrix scaling to nothing to be singular")
+	}
+}
+
+const transformTestPage = `<html><head><style>
+body { margin: 0; }
+.moved { transform: translate(100px, 20px); width: 50px; height: 20px; background-color: red; }
+.turned { transform: rotate(90deg); width: 100px; height: 20px; margin: 60px 0; background-color: red; }
+.faded { opacity: 0.5; width: 50px; height: 20px; background-color: black; }
+</style></head><body>
+<div class="moved"></div><div class="turned"></div><div class="faded"></div>
+</body></html>`
+
+func TestDisplayListTransformLayer(t *testing.T) {
+	commands := decoratedNode(t, transformTestPage, "moved")
+	if len(commands) == 0 || commands[0].Type != PaintPushLayer {
+		t.Fatal("Expected the transformed box to start a layer")
+	}
+	push := commands[0]
+	if push.LayerKind != LayerTransform || push.Transform == nil {
+		t.Fatalf("Expected a transform layer, got kind %v with transform %v", push.LayerKind, push.Transform)
+	}
+	if x, y := transformPoint(*push.Transform, push.Box.X, push.Box.Y); x != push.Box.X+100 || y != push.Box.Y+20 {
+		t.Errorf("Expected the box moved by (100, 20), got (%v, %v)", x-push.Box.X, y-push.Box.Y)
+	}
+}
+
+func TestRasterRendererTransforms(t *testing.T) {
+	r := layoutCompositorPage(t, transformTestPage)
+	moved := r.layoutEngine.GetLayoutBox(findNodeByClass(r.RenderTree(), "moved").ID).Box
+	turned := r.layoutEngine.GetLayoutBox(findNodeByClass(r.RenderTree(), "turned").ID).Box
+	img := NewRasterRenderer().Render(r.DisplayList(), 800, 600)
+
+	if !sameColor(img, int(moved.X)+125, int(moved.Y)+30, testRed) {
+		t.Errorf("Expected the translated box painted at its new position, got %v", img.At(int(moved.X)+125, int(moved.Y)+30))
+	}
+	if !sameColor(img, int(moved.X)+25, int(moved.Y)+10, color.White) {
+		t.Error("Expected nothing painted at the untranslated position")
+	}
+
+	// Rotated a quarter turn about its center, the wide box stands upright
+	centerX, centerY := int(turned.X+turned.Width/2), int(turned.Y+turned.Height/2)
+	if !sameColor(img, centerX, centerY+40, testRed) || !sameColor(img, centerX, centerY-40, testRed) {
+		t.Error("Expected the rotated box to extend above and below its center")
+	}
+	if !sameColor(img, centerX+40, centerY, color.White) {
+		t.Error("Expected nothing painted beside the rotated box's center")
+	}
+
+	// The compositor maps transformed layers the same way
+	c := NewCompositor(NewRasterRenderer())
+	c.Update(r.DisplayList())
+	dst := image.NewRGBA(image.Rect(0, 0, 800, 600))
+	c.Compose(dst, 0, 0)
+	if maxDifference, _, _ := compareImages(img, dst); maxDifference > 8 {
+		t.Errorf("Expected the composited page to match the raster render, pixels differ by up to %d", maxDifference)
+	}
+}
+
+func TestHitTestTransform(t *testing.T) {
+	r := layoutCompositorPage(t, transformTestPage)
+	root := r.LayoutTree()
+	movedNode := findNodeByClass(r.RenderTree(), "moved")
+	turnedNode := findNodeByClass(r.RenderTree(), "turned")
+	moved := r.layoutEngine.GetLayoutBox(movedNode.ID).Box
+	turned := r.layoutEngine.GetLayoutBox(turnedNode.ID).Box
+
+	if id := r.layoutEngine.HitTest(root, moved.X+125, moved.Y+30); id != movedNode.ID {
+		t.Errorf("Expected a click on the translated box to hit it, got node %d", id)
+	}
+	if id := r.layoutEngine.HitTest(root, moved.X+25, moved.Y+10); id == movedNode.ID {
+		t.Error("Expected a click at the untranslated position to miss the box")
+	}
+
+	centerX, centerY := turned.X+turned.Width/2, turned.Y+turned.Height/2
+	if id := r.layoutEngine.HitTest(root, centerX, centerY+40); id != turnedNode.ID {
+		t.Errorf("Expected a click below the rotated box's center to hit it, got node %d", id)
+	}
+	if id := r.layoutEngine.HitTest(root, centerX+40, centerY); id == turnedNode.ID {
+		t.Error("Expected a click beside the rotated box's center to miss it")
+	}
+}
@@ -0,0 +1,74 @@
+package ui
+
+import (
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+)
+
+// aboutPage wraps the body of an internal about: page in a document
+func aboutPage(title, body string) string {
+	return fmt.Sprintf("<!DOCTYPE html>\n<html>\n<head>\n<title>%s</title>\n</head>\n<body>\n<h1>%s</h1>\n%s</body>\n</html>\n",
+		html.EscapeString(title), html.EscapeString(title), body)
+}
+
+// linkList renders URLs as a list of links, or a note when there are none
+func linkList(urls []string, empty string) string {
+	if len(urls) == 0 {
+		return "<p>" + html.EscapeString(empty) + "</p>\n"
+	}
+	var b strings.Builder
+	b.WriteString("<ul>\n")
+	for _, u := range urls {
+		escaped := html.EscapeString(u)
+		fmt.Fprintf(&b, "<li><a href=\"%s\">%s</a></li>\n", escaped, escaped)
+	}
+	b.WriteString("</ul>\n")
+	return b.String()
+}
+
+// HistoryPage generates about:history, the pages visited in each tab with
+// the most recent first
+func (b *Browser) HistoryPage() string {
+	var body strings.Builder
+	for i, tab := range b.tabItems {
+		history := tab.state.GetHistory()
+		slices.Reverse(history)
+		fmt.Fprintf(&body, "<h2>Tab %d</h2>\n", i+1)
+		body.WriteString(linkList(history, "No pages visited."))
+	}
+	if len(b.tabItems) == 0 {
+		body.WriteString(linkList(nil, "No pages visited."))
+	}
+	return aboutPage("History", body.String())
+}
+
+// BookmarksPage generates about:bookmarks
+func (b *Browser) BookmarksPage() string {
+	return aboutPage("Bookmarks", linkList(b.state.GetBookmarks(), "No bookmarks yet."))
+}
+
+// SettingsPage generates about:settings, a summary of the current settings
+// Settings are changed in the settings dialog.
+func (b *Browser) SettingsPage() string {
+	enabled := func(on bool) string {
+		if on {
+			return "Enabled"
+		}
+		return "Disabled"
+	}
+	rows := [][2]string{
+		{"Homepage", b.settings.GetHomepage()},
+		{"Search engine", b.settings.GetDefaultSearchEngine()},
+		{"JavaScript", enabled(b.settings.GetEnableJavaScript())},
+		{"Images", enabled(b.settings.GetEnableImages())},
+	}
+	var body strings.Builder
+	body.WriteString("<table>\n")
+	for _, row := range rows {
+		fmt.Fprintf(&body, "<tr><th>%s</th><td>%s</td></tr>\n", html.EscapeString(row[0]), html.EscapeString(row[1]))
+	}
+	body.WriteString("</table>\n<p>Use the settings button to change these.</p>\n")
+	return aboutPage("Settings", body.String())
+}
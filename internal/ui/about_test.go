@@ -0,0 +1,32 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAboutPages(t *testing.T) {
+	tab := &Tab{state: NewBrowserState()}
+	tab.state.AddToHistory("https://example.com/")
+	tab.state.AddToHistory("https://example.org/?a=1&b=2")
+	b := &Browser{state: NewBrowserState(), settings: NewSettings(), tabItems: []*Tab{tab}}
+	b.state.AddBookmark("https://example.net/")
+	b.settings.SetEnableImages(false)
+
+	history := b.HistoryPage()
+	recent, older := strings.Index(history, `href="https://example.org/?a=1&amp;b=2"`), strings.Index(history, `href="https://example.com/"`)
+	if recent < 0 || older < recent {
+		t.Errorf("Expected escaped history links, most recent first, got %s", history)
+	}
+	if bookmarks := b.BookmarksPage(); !strings.Contains(bookmarks, `<a href="https://example.net/">`) {
+		t.Errorf("Expected the bookmark to be listed, got %s", bookmarks)
+	}
+	if settings := b.SettingsPage(); !strings.Contains(settings, "<tr><th>Images</th><td>Disabled</td></tr>") {
+		t.Errorf("Expected the settings to be listed, got %s", settings)
+	}
+
+	b.state.RemoveBookmark("https://example.net/")
+	if bookmarks := b.BookmarksPage(); !strings.Contains(bookmarks, "No bookmarks yet.") {
+		t.Errorf("Expected a note for no bookmarks, got %s", bookmarks)
+	}
+}
@@ -0,0 +1,100 @@
+package ui
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"fyne.io/fyne/v2"
+	"github.com/vyquocvu/goosie/internal/adblock"
+	"github.com/vyquocvu/goosie/internal/net"
+)
+
+// extraStylesSetter is implemented by renderers that can add styles to the
+// pages they render, such as element hiding rules
+type extraStylesSetter interface {
+	SetExtraStyles(styles func(pageURL string) string)
+}
+
+// SetContentBlocker blocks the ads and trackers of an engine's filter lists
+// in every tab: requests of page subresources its network filters match
+// fail, and elements its element hiding filters match are hidden. The
+// toolbar shows how many requests were blocked on the active tab's page.
+func (b *Browser) SetContentBlocker(engine *adblock.Engine) {
+	b.contentBlocker = engine
+	for _, tab := range b.tabItems {
+		b.installContentBlocker(tab)
+	}
+	b.updateBlockedCount()
+}
+
+// installContentBlocker adds the content blocker to a tab's interceptors
+// and renderer, replacing the one it had
+func (b *Browser) installContentBlocker(tab *Tab) {
+	if tab.removeBlocker != nil {
+		tab.removeBlocker()
+		tab.removeBlocker = nil
+	}
+	engine := b.contentBlocker
+	if engine != nil {
+		tab.removeBlocker = tab.Network().Add(net.Block(func(req *http.Request) bool {
+			return tab.blocks(engine, req)
+		}))
+	}
+	b.setRendererStyles(tab)
+}
+
+// setRendererStyles hides the elements of the content blocker in the pages
+// of a tab's renderer
+func (b *Browser) setRendererStyles(tab *Tab) {
+	setter, ok := tab.htmlRenderer.(extraStylesSetter)
+	if !ok {
+		return
+	}
+	if b.contentBlocker == nil {
+		setter.SetExtraStyles(nil)
+	} else {
+		setter.SetExtraStyles(b.contentBlocker.HidingCSS)
+	}
+}
+
+// blocks reports whether an engine blocks a request of the tab's page,
+// counting it if so
+func (t *Tab) blocks(engine *adblock.Engine, req *http.Request) bool {
+	var document *url.URL
+	if current := t.state.GetCurrentURL(); current != "" {
+		document, _ = url.Parse(current)
+	}
+	filter := engine.Match(adblock.Request{URL: req.URL, Document: document, Type: net.ResourceTypeFrom(req.Context())})
+	if filter == nil {
+		return false
+	}
+	t.blocked.Add(1)
+	if t.browser != nil {
+		t.browser.updateBlockedCount()
+	}
+	return true
+}
+
+// BlockedCount returns how many requests the content blocker blocked on
+// the tab's current page
+func (t *Tab) BlockedCount() int {
+	return int(t.blocked.Load())
+}
+
+// updateBlockedCount shows the blocked count of the active tab in the
+// toolbar, or hides it without a content blocker
+func (b *Browser) updateBlockedCount() {
+	if b.blockedLabel == nil {
+		return
+	}
+	fyne.Do(func() {
+		tab := b.ActiveTab()
+		if b.contentBlocker == nil || tab == nil {
+			b.blockedLabel.Hide()
+			return
+		}
+		b.blockedLabel.SetText(fmt.Sprintf("Blocked: %d", tab.BlockedCount()))
+		b.blockedLabel.Show()
+	})
+}
@@ -0,0 +1,73 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/vyquocvu/goosie/internal/adblock"
+	"github.com/vyquocvu/goosie/internal/net"
+)
+
+// stylesRenderer records the extra styles it is given
+type stylesRenderer struct {
+	HTMLRenderer
+	styles func(pageURL string) string
+}
+
+func (r *stylesRenderer) SetExtraStyles(styles func(pageURL string) string) {
+	r.styles = styles
+}
+
+func TestContentBlocker(t *testing.T) {
+	engine := adblock.NewEngine()
+	if _, err := engine.AddList(strings.NewReader("||ads.example^\n##.ad-banner\n")); err != nil {
+		t.Fatal(err)
+	}
+	renderer := &stylesRenderer{}
+	tab := &Tab{state: NewBrowserState(), htmlRenderer: renderer}
+	tab.state.AddToHistory("https://news.example/")
+	b := &Browser{tabItems: []*Tab{tab}}
+	tab.browser = b
+	b.SetContentBlocker(engine)
+
+	send := func(req *http.Request) (*http.Response, error) {
+		return net.NewMockResponse(req, http.StatusOK, "image/png", nil), nil
+	}
+	get := func(rawURL string, resourceType net.ResourceType) error {
+		ctx := net.WithResourceType(context.Background(), resourceType)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+		_, err := tab.Network().RoundTrip(req, send)
+		return err
+	}
+
+	if err := get("https://ads.example/banner.png", net.ResourceImage); !errors.Is(err, net.ErrBlocked) {
+		t.Errorf("Expected the ad to be blocked, got %v", err)
+	}
+	if err := get("https://news.example/photo.png", net.ResourceImage); err != nil {
+		t.Errorf("Expected the page's own image to load, got %v", err)
+	}
+	if err := get("https://ads.example/", net.ResourceDocument); err != nil {
+		t.Errorf("Expected navigations not to be blocked, got %v", err)
+	}
+	if tab.BlockedCount() != 1 {
+		t.Errorf("Expected 1 blocked request, got %d", tab.BlockedCount())
+	}
+	if renderer.styles == nil || !strings.Contains(renderer.styles("https://news.example/"), ".ad-banner { display: none") {
+		t.Error("Expected the renderer to hide the filters' elements")
+	}
+
+	// A new page starts its count again
+	tab.SetLoadContext(context.Background())
+	if tab.BlockedCount() != 0 {
+		t.Errorf("Expected the count to reset, got %d", tab.BlockedCount())
+	}
+
+	// Setting the blocker again replaces its interceptor
+	b.SetContentBlocker(engine)
+	if tab.Network().Len() != 1 {
+		t.Errorf("Expected one interceptor, got %d", tab.Network().Len())
+	}
+}
@@ -1,13 +1,17 @@
 package ui
 
 import (
+    "context"
     "fmt"
+    "sync/atomic"
     "fyne.io/fyne/v2"
     "fyne.io/fyne/v2/app"
     "fyne.io/fyne/v2/container"
     "fyne.io/fyne/v2/dialog"
     "fyne.io/fyne/v2/widget"
+    "github.com/vyquocvu/goosie/internal/adblock"
     "github.com/vyquocvu/goosie/internal/js"
+    "github.com/vyquocvu/goosie/internal/net"
 )
 
 // fixedHeightLayout is a custom layout that sets a fixed height for a widget
@@ -36,6 +40,22 @@ func (l *fixedHeightLayout) Layout(objects []fyne.CanvasObject, size fyne.Size)
 // NavigationCallback is a function that is called when navigation is requested
 type NavigationCallback func(url string)
 
+// NavigationType says how a navigation was started, so page loads can choose
+// how to use the HTTP cache
+type NavigationType int
+
+const (
+	// NavigationNormal is a link click or a typed URL
+	NavigationNormal NavigationType = iota
+	// NavigationBackForward moves through the tab's history
+	NavigationBackForward
+	// NavigationReload loads the current page again
+	NavigationReload
+)
+
+// TypedNavigationCallback is called when navigation is requested, with how it started
+type TypedNavigationCallback func(url string, navigationType NavigationType)
+
 // Browser represents the browser UI
 type Browser struct {
 	app                 fyne.App
@@ -49,15 +69,19 @@ type Browser struct {
 	bookmarkButton      *widget.Button
 	settingsButton      *widget.Button
 	consoleButton       *widget.Button
+	blockedLabel        *widget.Label
 	loadingBar          *widget.ProgressBarInfinite
 	loadingBarContainer *fyne.Container
 	onNavigate          NavigationCallback
+	onTypedNavigate     TypedNavigationCallback
 	tabs                *container.DocTabs
 	tabItems            []*Tab
 	consolePanel        *ConsolePanel
 	consoleSplit        *container.Split
 	consoleVisible      bool
 	consoleContainer    *fyne.Container
+	cookieJar           *net.CookieJar
+	contentBlocker      *adblock.Engine
 	RendererFactory     func() HTMLRenderer
 }
 
@@ -71,6 +95,16 @@ type Tab struct {
 	state         *BrowserState
 	browser       *Browser
 	jsRuntime     *js.Runtime
+	loadCtx       context.Context
+	network       *net.NetworkContext
+	removeBlocker func()       // Removes the content blocker's interceptor
+	blocked       atomic.Int32 // Requests the content blocker blocked on the current page
+}
+
+// loadContextSetter is implemented by renderers whose subresource loads can
+// be cancelled with a context
+type loadContextSetter interface {
+	SetLoadContext(ctx context.Context)
 }
 
 // window interface to allow testing
@@ -132,6 +166,7 @@ func NewBrowser() *Browser {
 	browser.tabs.OnSelected = func(tab *container.TabItem) {
 		browser.updateNavigationButtons()
 		browser.updateConsoleFromActiveTab()
+		browser.updateBlockedCount()
 	}
 	browser.tabs.SetTabLocation(container.TabLocationTop)
 
@@ -171,7 +206,7 @@ func (b *Browser) newTabInternal() *Tab {
 
 	tabState := NewBrowserState()
 
-	return &Tab{
+	tab := &Tab{
 		title:         "New Tab",
 		content:       contentScroll,
 		contentBox:    contentBox,
@@ -179,7 +214,12 @@ func (b *Browser) newTabInternal() *Tab {
 		htmlRenderer:  htmlRenderer,
 		state:         tabState,
 		browser:       b,
+		network:       net.NewNetworkContext(),
+	}
+	if b.contentBlocker != nil {
+		b.installContentBlocker(tab)
 	}
+	return tab
 }
 
 // NewTab creates a new browser tab and adds it to the tab container
@@ -231,6 +271,10 @@ func (b *Browser) RenderHTMLContent(htmlContent string) error {
             return fmt.Errorf("RendererFactory returned nil renderer")
         }
         tab.htmlRenderer.SetWindow(b.window)
+        if setter, ok := tab.htmlRenderer.(loadContextSetter); ok && tab.loadCtx != nil {
+            setter.SetLoadContext(tab.loadCtx)
+        }
+        b.setRendererStyles(tab)
         tab.htmlRenderer.SetNavigationCallback(func(url string) {
             if b.onNavigate != nil {
                 b.onNavigate(url)
@@ -260,12 +304,27 @@ func (b *Browser) SetNavigationCallback(callback NavigationCallback) {
 	b.onNavigate = callback
 }
 
+// SetTypedNavigationCallback sets the callback for back, forward and reload
+// navigations; without one they use the navigation callback
+func (b *Browser) SetTypedNavigationCallback(callback TypedNavigationCallback) {
+	b.onTypedNavigate = callback
+}
+
+// navigate requests a navigation started by the browser's own controls
+func (b *Browser) navigate(url string, navigationType NavigationType) {
+	if b.onTypedNavigate != nil {
+		b.onTypedNavigate(url, navigationType)
+	} else if b.onNavigate != nil {
+		b.onNavigate(url)
+	}
+}
+
 // Show displays the browser window
 func (b *Browser) Show() {
 	// Create navigation bar
 	navBar := container.NewBorder(nil, nil,
 		container.NewHBox(b.backButton, b.forwardButton, b.refreshButton),
-		container.NewHBox(b.bookmarkButton, b.consoleButton, b.settingsButton),
+		container.NewHBox(b.blockedLabel, b.bookmarkButton, b.consoleButton, b.settingsButton),
 		b.urlEntry,
 	)
 
@@ -313,9 +372,7 @@ func (b *Browser) createNavigationControls() {
 	b.backButton = widget.NewButton("←", func() {
 		if tab := b.ActiveTab(); tab != nil {
 			if url, ok := tab.state.GoBack(); ok {
-				if b.onNavigate != nil {
-					b.onNavigate(url)
-				}
+				b.navigate(url, NavigationBackForward)
 			}
 		}
 	})
@@ -325,9 +382,7 @@ func (b *Browser) createNavigationControls() {
 	b.forwardButton = widget.NewButton("→", func() {
 		if tab := b.ActiveTab(); tab != nil {
 			if url, ok := tab.state.GoForward(); ok {
-				if b.onNavigate != nil {
-					b.onNavigate(url)
-				}
+				b.navigate(url, NavigationBackForward)
 			}
 		}
 	})
@@ -336,9 +391,8 @@ func (b *Browser) createNavigationControls() {
 	// Refresh button
 	b.refreshButton = widget.NewButton("⟳", func() {
 		if tab := b.ActiveTab(); tab != nil {
-			currentURL := tab.state.GetCurrentURL()
-			if b.onNavigate != nil && currentURL != "" {
-				b.onNavigate(currentURL)
+			if currentURL := tab.state.GetCurrentURL(); currentURL != "" {
+				b.navigate(currentURL, NavigationReload)
 			}
 		}
 	})
@@ -354,6 +408,10 @@ func (b *Browser) createNavigationControls() {
 		b.toggleConsole()
 	})
 
+	// Count of requests the content blocker blocked, shown once one is set
+	b.blockedLabel = widget.NewLabel("")
+	b.blockedLabel.Hide()
+
 	// Settings button
 	b.settingsButton = widget.NewButton("⚙", func() {
 		b.showSettings()
@@ -380,6 +438,33 @@ func (t *Tab) GetRenderer() HTMLRenderer {
 	return t.htmlRenderer
 }
 
+// Network returns the network context whose interceptors the requests of
+// the tab go through
+func (t *Tab) Network() *net.NetworkContext {
+	if t.network == nil {
+		t.network = net.NewNetworkContext()
+	}
+	return t.network
+}
+
+// SetLoadContext sets the context the images and fonts of the tab's next
+// page load under; cancelling it when the tab navigates away cancels them.
+// Their requests go through the tab's interceptors, and the page starts
+// with no blocked requests.
+func (t *Tab) SetLoadContext(ctx context.Context) {
+	t.blocked.Store(0)
+	if t.browser != nil {
+		t.browser.updateBlockedCount()
+	}
+	if net.NetworkContextFrom(ctx) == nil {
+		ctx = net.WithNetworkContext(ctx, t.Network())
+	}
+	t.loadCtx = ctx
+	if setter, ok := t.htmlRenderer.(loadContextSetter); ok {
+		setter.SetLoadContext(ctx)
+	}
+}
+
 // toggleBookmark adds or removes the current page from bookmarks
 func (b *Browser) toggleBookmark() {
 	if tab := b.ActiveTab(); tab != nil {
@@ -408,6 +493,18 @@ func (b *Browser) NavigateTo(url string) {
 	}
 }
 
+// ReplaceCurrentURL shows the URL a page load ended at after redirects in
+// the URL bar and history; relative links of the page resolve against it
+func (b *Browser) ReplaceCurrentURL(url string) {
+	if tab := b.ActiveTab(); tab != nil {
+		tab.state.ReplaceCurrentURL(url)
+		fyne.Do(func() {
+			b.urlEntry.SetText(url)
+			b.updateNavigationButtons()
+		})
+	}
+}
+
 // updateNavigationButtons updates the enabled/disabled state of navigation buttons
 func (b *Browser) updateNavigationButtons() {
 	tab := b.ActiveTab()
@@ -537,12 +634,80 @@ func (b *Browser) showSettings() {
 		},
 	}
 
+	if b.cookieJar != nil {
+		form.Items = append(form.Items, &widget.FormItem{Text: "Cookies", Widget: widget.NewButton("Manage Cookies...", b.showCookies)})
+	}
+
 	// Create custom dialog
 	d := dialog.NewCustom("Settings", "Close", form, b.window)
 	d.Resize(fyne.NewSize(500, 300))
 	d.Show()
 }
 
+// SetCookieJar sets the cookie jar the settings dialog shows and clears
+func (b *Browser) SetCookieJar(jar *net.CookieJar) {
+	b.cookieJar = jar
+}
+
+// showCookies displays the stored cookies, which can be removed one at a
+// time or all at once
+func (b *Browser) showCookies() {
+	cookies := b.cookieJar.All()
+	selected := -1
+
+	list := widget.NewList(
+		func() int { return len(cookies) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			item.(*widget.Label).SetText(describeCookie(cookies[id]))
+		},
+	)
+	removeButton := widget.NewButton("Remove", nil)
+	removeButton.Disable()
+
+	reload := func() {
+		cookies = b.cookieJar.All()
+		selected = -1
+		list.UnselectAll()
+		removeButton.Disable()
+		list.Refresh()
+	}
+	list.OnSelected = func(id widget.ListItemID) {
+		selected = id
+		removeButton.Enable()
+	}
+	removeButton.OnTapped = func() {
+		if selected >= 0 && selected < len(cookies) {
+			b.cookieJar.Remove(cookies[selected])
+			reload()
+		}
+	}
+	clearButton := widget.NewButton("Clear All", func() {
+		b.cookieJar.Clear()
+		reload()
+	})
+
+	content := container.NewBorder(nil, container.NewHBox(removeButton, clearButton), nil, nil, list)
+	d := dialog.NewCustom("Cookies", "Close", content, b.window)
+	d.Resize(fyne.NewSize(600, 400))
+	d.Show()
+}
+
+// describeCookie summarizes a cookie for the cookie viewer
+func describeCookie(cookie net.CookieInfo) string {
+	details := "session"
+	if !cookie.Expires.IsZero() {
+		details = "expires " + cookie.Expires.Local().Format("2006-01-02 15:04")
+	}
+	if cookie.Secure {
+		details += ", Secure"
+	}
+	if cookie.HttpOnly {
+		details += ", HttpOnly"
+	}
+	return fmt.Sprintf("%s%s  %s=%s  (%s)", cookie.Domain, cookie.Path, cookie.Name, cookie.Value, details)
+}
+
 // updateConsoleFromActiveTab updates the console panel with messages from the active tab
 func (b *Browser) updateConsoleFromActiveTab() {
 	tab := b.ActiveTab()
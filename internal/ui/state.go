@@ -73,6 +73,18 @@ func (s *BrowserState) GoForward() (string, bool) {
 	return s.history[s.currentIndex], true
 }
 
+// ReplaceCurrentURL replaces the URL of the current history entry, such as
+// with the URL a redirect ended at
+func (s *BrowserState) ReplaceCurrentURL(url string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.currentIndex < 0 || s.currentIndex >= len(s.history) {
+		return
+	}
+	s.history[s.currentIndex] = url
+}
+
 // GetCurrentURL returns the current URL
 func (s *BrowserState) GetCurrentURL() string {
 	s.mu.RLock()
@@ -183,3 +183,22 @@ func TestGetCurrentURLEmptyHistory(t *testing.T) {
 		t.Errorf("GetCurrentURL() on empty history = %s, want empty string", url)
 	}
 }
+
+func TestReplaceCurrentURL(t *testing.T) {
+	state := NewBrowserState()
+	state.ReplaceCurrentURL("https://ignored.com")
+	if len(state.GetHistory()) != 0 {
+		t.Error("ReplaceCurrentURL() on empty history should not add an entry")
+	}
+	
+	state.AddToHistory("http://example.com")
+	state.AddToHistory("http://example.com/old")
+	state.ReplaceCurrentURL("https://example.com/new")
+	
+	if url := state.GetCurrentURL(); url != "https://example.com/new" {
+		t.Errorf("GetCurrentURL() = %s, want https://example.com/new", url)
+	}
+	if history := state.GetHistory(); len(history) != 2 || history[0] != "http://example.com" {
+		t.Errorf("ReplaceCurrentURL() should only replace the current entry, got %v", history)
+	}
+}
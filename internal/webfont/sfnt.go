@@ -0,0 +1,174 @@
+package webfont
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// errTruncated is returned when font data ends before a structure it declares
+var errTruncated = errors.New("webfont: truncated font data")
+
+// sfntTable is a table of an sfnt font
+type sfntTable struct {
+	tag  uint32
+	data []byte
+}
+
+// writeSFNT assembles tables into an sfnt font, computing the table directory
+// and checksums
+func writeSFNT(flavor uint32, tables []sfntTable) []byte {
+	sort.Slice(tables, func(i, j int) bool { return tables[i].tag < tables[j].tag })
+
+	numTables := len(tables)
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= numTables {
+		entrySelector++
+	}
+	searchRange := (1 << entrySelector) * 16
+
+	size := 12 + 16*numTables
+	for _, t := range tables {
+		size += pad4(len(t.data))
+	}
+
+	out := make([]byte, size)
+	binary.BigEndian.PutUint32(out[0:], flavor)
+	binary.BigEndian.PutUint16(out[4:], uint16(numTables))
+	binary.BigEndian.PutUint16(out[6:], uint16(searchRange))
+	binary.BigEndian.PutUint16(out[8:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(out[10:], uint16(numTables*16-searchRange))
+
+	headOffset := -1
+	offset := 12 + 16*numTables
+	for i, t := range tables {
+		data := out[offset : offset+len(t.data)]
+		copy(data, t.data)
+		if t.tag == tagHead && len(data) >= 12 {
+			// checkSumAdjustment is computed once the whole font is written
+			binary.BigEndian.PutUint32(data[8:], 0)
+			headOffset = offset
+		}
+
+		record := out[12+16*i:]
+		binary.BigEndian.PutUint32(record[0:], t.tag)
+		binary.BigEndian.PutUint32(record[4:], checksum(data))
+		binary.BigEndian.PutUint32(record[8:], uint32(offset))
+		binary.BigEndian.PutUint32(record[12:], uint32(len(t.data)))
+		offset += pad4(len(t.data))
+	}
+
+	if headOffset >= 0 {
+		binary.BigEndian.PutUint32(out[headOffset+8:], 0xB1B0AFBA-checksum(out))
+	}
+
+	return out
+}
+
+// checksum computes the sfnt checksum of data, padded with zeros to 4 bytes
+func checksum(data []byte) uint32 {
+	var sum uint32
+	for len(data) >= 4 {
+		sum += binary.BigEndian.Uint32(data)
+		data = data[4:]
+	}
+	if len(data) > 0 {
+		var last [4]byte
+		copy(last[:], data)
+		sum += binary.BigEndian.Uint32(last[:])
+	}
+	return sum
+}
+
+// pad4 rounds n up to a multiple of 4
+func pad4(n int) int {
+	return (n + 3) &^ 3
+}
+
+// reader reads big-endian values from font data, remembering the first error
+// so that parsers can check once after reading a structure
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+// bytes returns the next n bytes, or nil if the data is too short
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.data)-r.pos {
+		r.err = errTruncated
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+// skip advances past n bytes
+func (r *reader) skip(n int) {
+	r.bytes(n)
+}
+
+func (r *reader) u8() uint8 {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) u16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) s16() int16 {
+	return int16(r.u16())
+}
+
+func (r *reader) u32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+// base128 reads a WOFF2 UIntBase128 value
+func (r *reader) base128() uint32 {
+	var value uint32
+	for i := 0; i < 5; i++ {
+		b := r.u8()
+		if r.err != nil {
+			return 0
+		}
+		// Leading zeros and values that overflow 32 bits are invalid
+		if (i == 0 && b == 0x80) || value&0xFE000000 != 0 {
+			r.err = errors.New("webfont: invalid UIntBase128 value")
+			return 0
+		}
+		value = value<<7 | uint32(b&0x7f)
+		if b&0x80 == 0 {
+			return value
+		}
+	}
+	r.err = errors.New("webfont: UIntBase128 value exceeds 5 bytes")
+	return 0
+}
+
+// u255 reads a WOFF2 255UInt16 value
+func (r *reader) u255() uint16 {
+	switch code := r.u8(); code {
+	case 253:
+		return r.u16()
+	case 254:
+		return uint16(r.u8()) + 253*2
+	case 255:
+		return uint16(r.u8()) + 253
+	default:
+		return uint16(code)
+	}
+}
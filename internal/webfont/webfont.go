@@ -0,0 +1,91 @@
+// Package webfont decodes the font formats referenced by CSS @font-face rules
+// (TrueType, OpenType, WOFF and WOFF2) into plain sfnt data.
+package webfont
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// Format identifies the container format of a font file
+type Format string
+
+const (
+	// FormatUnknown is returned for data that is not a supported font
+	FormatUnknown Format = ""
+	// FormatTrueType is an sfnt font with TrueType outlines
+	FormatTrueType Format = "truetype"
+	// FormatOpenType is an sfnt font with CFF outlines
+	FormatOpenType Format = "opentype"
+	// FormatWOFF is a WOFF 1.0 font
+	FormatWOFF Format = "woff"
+	// FormatWOFF2 is a WOFF 2.0 font
+	FormatWOFF2 Format = "woff2"
+)
+
+// Table tags and signatures used while decoding
+const (
+	sfntVersionTrueType = 0x00010000
+	sfntVersionApple    = 0x74727565 // "true"
+	sfntVersionCFF      = 0x4F54544F // "OTTO"
+	collectionTag       = 0x74746366 // "ttcf"
+	woffSignature       = 0x774F4646 // "wOFF"
+	woff2Signature      = 0x774F4632 // "wOF2"
+
+	tagGlyf = 0x676C7966
+	tagLoca = 0x6C6F6361
+	tagHead = 0x68656164
+	tagHhea = 0x68686561
+	tagHmtx = 0x686D7478
+)
+
+// ErrUnsupportedFormat is returned when data is not a font in a supported format
+var ErrUnsupportedFormat = errors.New("webfont: unsupported font format")
+
+// Sniff detects the format of font data from its signature
+func Sniff(data []byte) Format {
+	if len(data) < 4 {
+		return FormatUnknown
+	}
+	switch binary.BigEndian.Uint32(data) {
+	case sfntVersionTrueType, sfntVersionApple:
+		return FormatTrueType
+	case sfntVersionCFF:
+		return FormatOpenType
+	case woffSignature:
+		return FormatWOFF
+	case woff2Signature:
+		return FormatWOFF2
+	default:
+		return FormatUnknown
+	}
+}
+
+// Decode converts font data in any supported format to sfnt data that can be
+// parsed as a TrueType or OpenType font. sfnt data is returned unchanged.
+func Decode(data []byte) ([]byte, error) {
+	switch Sniff(data) {
+	case FormatTrueType, FormatOpenType:
+		return data, nil
+	case FormatWOFF:
+		return decodeWOFF(data)
+	case FormatWOFF2:
+		return decodeWOFF2(data)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
+
+// SupportsFormat reports whether a CSS format() hint names a supported format
+// Variable font hints such as "woff2-variations" are accepted as well.
+func SupportsFormat(hint string) bool {
+	hint = strings.ToLower(strings.Trim(strings.TrimSpace(hint), `"'`))
+	hint = strings.TrimSuffix(hint, "-variations")
+	switch Format(hint) {
+	case FormatTrueType, FormatOpenType, FormatWOFF, FormatWOFF2:
+		return true
+	default:
+		return false
+	}
+}
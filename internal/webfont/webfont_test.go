@@ -0,0 +1,242 @@
+package webfont
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"fyne.io/fyne/v2/theme"
+	"github.com/go-text/typesetting/font"
+)
+
+// encodeWOFF wraps sfnt data in a WOFF 1.0 container, compressing every table
+func encodeWOFF(t *testing.T, sfnt []byte) []byte {
+	t.Helper()
+	numTables := int(binary.BigEndian.Uint16(sfnt[4:]))
+
+	header := make([]byte, 44+20*numTables)
+	binary.BigEndian.PutUint32(header[0:], woffSignature)
+	copy(header[4:8], sfnt[0:4])
+	binary.BigEndian.PutUint16(header[12:], uint16(numTables))
+
+	var body []byte
+	for i := 0; i < numTables; i++ {
+		record := sfnt[12+16*i:]
+		offset := binary.BigEndian.Uint32(record[8:])
+		length := binary.BigEndian.Uint32(record[12:])
+		table := sfnt[offset : offset+length]
+
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		zw.Write(table)
+		zw.Close()
+		stored := compressed.Bytes()
+		if len(stored) >= len(table) {
+			stored = table
+		}
+
+		entry := header[44+20*i:]
+		copy(entry[0:4], record[0:4])
+		binary.BigEndian.PutUint32(entry[4:], uint32(len(header)+len(body)))
+		binary.BigEndian.PutUint32(entry[8:], uint32(len(stored)))
+		binary.BigEndian.PutUint32(entry[12:], length)
+		body = append(body, stored...)
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+	}
+
+	return append(header, body...)
+}
+
+// sfntTables returns the tables of sfnt data by tag
+func sfntTables(t *testing.T, sfnt []byte) map[string][]byte {
+	t.Helper()
+	tables := make(map[string][]byte)
+	numTables := int(binary.BigEndian.Uint16(sfnt[4:]))
+	for i := 0; i < numTables; i++ {
+		record := sfnt[12+16*i:]
+		offset := binary.BigEndian.Uint32(record[8:])
+		length := binary.BigEndian.Uint32(record[12:])
+		if int(offset+length) > len(sfnt) {
+			t.Fatalf("table %s extends past the end of the font", record[0:4])
+		}
+		if offset%4 != 0 {
+			t.Errorf("table %s is not 4-byte aligned", record[0:4])
+		}
+		tables[string(record[0:4])] = sfnt[offset : offset+length]
+	}
+	return tables
+}
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		data     []byte
+		expected Format
+	}{
+		{[]byte{0, 1, 0, 0}, FormatTrueType},
+		{[]byte("true"), FormatTrueType},
+		{[]byte("OTTO"), FormatOpenType},
+		{[]byte("wOFF"), FormatWOFF},
+		{[]byte("wOF2"), FormatWOFF2},
+		{[]byte("ttcf"), FormatUnknown},
+		{[]byte("<htm"), FormatUnknown},
+		{[]byte{0, 1}, FormatUnknown},
+	}
+
+	for _, tt := range tests {
+		if got := Sniff(tt.data); got != tt.expected {
+			t.Errorf("Sniff(%q) = %q, expected %q", tt.data, got, tt.expected)
+		}
+	}
+}
+
+func TestSupportsFormat(t *testing.T) {
+	for _, hint := range []string{"woff2", `"woff"`, "'truetype'", "opentype", "woff2-variations", " WOFF2 "} {
+		if !SupportsFormat(hint) {
+			t.Errorf("Expected format %q to be supported", hint)
+		}
+	}
+	for _, hint := range []string{"embedded-opentype", "svg", "collection", ""} {
+		if SupportsFormat(hint) {
+			t.Errorf("Expected format %q to be unsupported", hint)
+		}
+	}
+}
+
+func TestDecodeSFNTPassesThrough(t *testing.T) {
+	data := theme.DefaultTextFont().Content()
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if !bytes.Equal(decoded, data) {
+		t.Error("Expected sfnt data to be returned unchanged")
+	}
+
+	if _, err := Decode([]byte("not a font")); err != ErrUnsupportedFormat {
+		t.Errorf("Expected ErrUnsupportedFormat, got %v", err)
+	}
+}
+
+func TestDecodeWOFF(t *testing.T) {
+	sfnt := theme.DefaultTextFont().Content()
+	decoded, err := Decode(encodeWOFF(t, sfnt))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	original := sfntTables(t, sfnt)
+	tables := sfntTables(t, decoded)
+	if len(tables) != len(original) {
+		t.Fatalf("Expected %d tables, got %d", len(original), len(tables))
+	}
+	for tag, data := range original {
+		if tag == "head" {
+			// checkSumAdjustment is recomputed
+			continue
+		}
+		if !bytes.Equal(tables[tag], data) {
+			t.Errorf("Table %q differs after decoding", tag)
+		}
+	}
+
+	if _, err := font.ParseTTF(bytes.NewReader(decoded)); err != nil {
+		t.Errorf("Decoded WOFF font failed to parse: %v", err)
+	}
+
+	// Truncated fonts are rejected rather than partially decoded
+	if _, err := Decode(encodeWOFF(t, sfnt)[:100]); err == nil {
+		t.Error("Expected an error for a truncated WOFF font")
+	}
+}
+
+func TestDecodeWOFF2(t *testing.T) {
+	data, err := os.ReadFile("testdata/open-sans-regular.woff2")
+	if err != nil {
+		t.Fatalf("failed to read test font: %v", err)
+	}
+
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if Sniff(decoded) != FormatTrueType {
+		t.Fatalf("Expected TrueType output, got %q", Sniff(decoded))
+	}
+
+	tables := sfntTables(t, decoded)
+	for _, tag := range []string{"glyf", "loca", "hmtx", "head", "cmap"} {
+		if len(tables[tag]) == 0 {
+			t.Errorf("Expected a %q table", tag)
+		}
+	}
+	if checksum(decoded) != 0xB1B0AFBA {
+		t.Errorf("Expected the font checksum to be 0xB1B0AFBA, got %#x", checksum(decoded))
+	}
+
+	face, err := font.ParseTTF(bytes.NewReader(decoded))
+	if err != nil {
+		t.Fatalf("Decoded WOFF2 font failed to parse: %v", err)
+	}
+	if face.Upem() != 2048 {
+		t.Errorf("Expected 2048 units per em, got %d", face.Upem())
+	}
+
+	// Reference values from the Open Sans TrueType font
+	glyph, ok := face.NominalGlyph('A')
+	if !ok {
+		t.Fatal("Expected a glyph for 'A'")
+	}
+	if advance := face.HorizontalAdvance(glyph); advance != 1296 {
+		t.Errorf("Expected advance 1296 for 'A', got %f", advance)
+	}
+	outline, ok := face.GlyphData(glyph).(font.GlyphOutline)
+	if !ok || len(outline.Segments) < 2 {
+		t.Fatal("Expected an outline for 'A'")
+	}
+	if first := outline.Segments[0].Args[0]; first.X != 1120 || first.Y != 0 {
+		t.Errorf("Expected the outline of 'A' to start at (1120, 0), got (%f, %f)", first.X, first.Y)
+	}
+	if extents, ok := face.GlyphExtents(glyph); !ok || extents.Width <= 0 || extents.Height == 0 {
+		t.Errorf("Expected non-empty extents for 'A', got %+v", extents)
+	}
+
+	// Composite glyphs are reconstructed as well
+	aacute, ok := face.NominalGlyph('Á')
+	if !ok {
+		t.Fatal("Expected a glyph for 'Á'")
+	}
+	if outline, ok := face.GlyphData(aacute).(font.GlyphOutline); !ok || len(outline.Segments) <= len(face.GlyphData(glyph).(font.GlyphOutline).Segments) {
+		t.Error("Expected the composite glyph for 'Á' to include the outline of 'A' and its accent")
+	}
+
+	if _, err := Decode(data[:len(data)/2]); err == nil {
+		t.Error("Expected an error for a truncated WOFF2 font")
+	}
+}
+
+func TestReaderVariableLengthIntegers(t *testing.T) {
+	r := &reader{data: []byte{0x3F, 0x81, 0x00, 0x80}}
+	if v := r.base128(); v != 63 {
+		t.Errorf("Expected 63, got %d", v)
+	}
+	if v := r.base128(); v != 128 {
+		t.Errorf("Expected 128, got %d", v)
+	}
+	if r.base128(); r.err == nil {
+		t.Error("Expected an error for a UIntBase128 with a leading zero")
+	}
+
+	r = &reader{data: []byte{252, 255, 0, 254, 0, 253, 0x12, 0x34}}
+	for _, expected := range []uint16{252, 253, 506, 0x1234} {
+		if v := r.u255(); v != expected {
+			t.Errorf("Expected %d, got %d", expected, v)
+		}
+	}
+	if r.err != nil {
+		t.Errorf("Unexpected error: %v", r.err)
+	}
+}
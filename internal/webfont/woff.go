@@ -0,0 +1,88 @@
+package webfont
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// decodeWOFF converts a WOFF 1.0 font to sfnt data
+// Each table is stored on its own, optionally zlib compressed.
+func decodeWOFF(data []byte) ([]byte, error) {
+	r := &reader{data: data}
+	if r.u32() != woffSignature {
+		return nil, ErrUnsupportedFormat
+	}
+	flavor := r.u32()
+	r.skip(4) // length
+	numTables := int(r.u16())
+	r.skip(2)     // reserved
+	r.skip(4)     // totalSfntSize
+	r.skip(4)     // majorVersion, minorVersion
+	r.skip(5 * 4) // metadata and private data blocks
+	if r.err != nil {
+		return nil, r.err
+	}
+	if flavor == collectionTag {
+		return nil, errors.New("webfont: font collections are not supported")
+	}
+	if numTables == 0 {
+		return nil, errors.New("webfont: WOFF font has no tables")
+	}
+
+	tables := make([]sfntTable, numTables)
+	for i := range tables {
+		tag := r.u32()
+		offset := int(r.u32())
+		compLength := int(r.u32())
+		origLength := int(r.u32())
+		r.skip(4) // origChecksum
+		if r.err != nil {
+			return nil, r.err
+		}
+		if offset < 0 || compLength > len(data)-offset {
+			return nil, errTruncated
+		}
+
+		stored := data[offset : offset+compLength]
+		switch {
+		case compLength == origLength:
+			tables[i] = sfntTable{tag: tag, data: stored}
+		case compLength < origLength:
+			table, err := inflateTable(stored, origLength)
+			if err != nil {
+				return nil, fmt.Errorf("webfont: WOFF table %s: %w", tagString(tag), err)
+			}
+			tables[i] = sfntTable{tag: tag, data: table}
+		default:
+			return nil, fmt.Errorf("webfont: WOFF table %s is larger compressed than uncompressed", tagString(tag))
+		}
+	}
+
+	return writeSFNT(flavor, tables), nil
+}
+
+// inflateTable decompresses a zlib compressed table of a known size
+func inflateTable(data []byte, size int) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	table, err := io.ReadAll(io.LimitReader(zr, int64(size)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(table) != size {
+		return nil, errors.New("decompressed size mismatch")
+	}
+	return table, nil
+}
+
+// tagString formats a table tag for error messages
+func tagString(tag uint32) string {
+	return string([]byte{byte(tag >> 24), byte(tag >> 16), byte(tag >> 8), byte(tag)})
+}
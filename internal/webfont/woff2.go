@@ -0,0 +1,526 @@
+package webfont
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/andybalholm/brotli"
+)
+
+// woff2KnownTags are the table tags that WOFF2 encodes as a 6-bit index
+var woff2KnownTags = [63]string{
+	"cmap", "head", "hhea", "hmtx", "maxp", "name", "OS/2", "post",
+	"cvt ", "fpgm", "glyf", "loca", "prep", "CFF ", "VORG", "EBDT",
+	"EBLC", "gasp", "hdmx", "kern", "LTSH", "PCLT", "VDMX", "vhea",
+	"vmtx", "BASE", "GDEF", "GPOS", "GSUB", "EBSC", "JSTF", "MATH",
+	"CBDT", "CBLC", "COLR", "CPAL", "SVG ", "sbix", "acnt", "avar",
+	"bdat", "bloc", "bsln", "cvar", "fdsc", "feat", "fmtx", "fvar",
+	"gvar", "hsty", "just", "lcar", "mort", "morx", "opbd", "prop",
+	"trak", "Zapf", "Silf", "Glat", "Gloc", "Feat", "Sill",
+}
+
+// Composite glyph flags that determine the size of a component record
+const (
+	compositeArgsAreWords     = 0x0001
+	compositeHaveScale        = 0x0008
+	compositeMoreComponents   = 0x0020
+	compositeHaveXYScale      = 0x0040
+	compositeHaveTwoByTwo     = 0x0080
+	compositeHaveInstructions = 0x0100
+)
+
+// Simple glyph flags written by the glyf reconstruction
+const (
+	glyphOnCurve       = 0x01
+	glyphOverlapSimple = 0x40
+)
+
+// woff2Table is an entry of the WOFF2 table directory
+type woff2Table struct {
+	tag         uint32
+	transformed bool
+	length      uint32 // Length of the table in the decompressed stream
+	data        []byte
+}
+
+// decodeWOFF2 converts a WOFF 2.0 font to sfnt data
+// All tables share one Brotli stream; glyf, loca and hmtx may additionally be
+// stored in transformed form and are reconstructed here.
+func decodeWOFF2(data []byte) ([]byte, error) {
+	r := &reader{data: data}
+	if r.u32() != woff2Signature {
+		return nil, ErrUnsupportedFormat
+	}
+	flavor := r.u32()
+	r.skip(4) // length
+	numTables := int(r.u16())
+	r.skip(2) // reserved
+	r.skip(4) // totalSfntSize
+	compressedSize := int(r.u32())
+	r.skip(4)     // majorVersion, minorVersion
+	r.skip(5 * 4) // metadata and private data blocks
+	if r.err != nil {
+		return nil, r.err
+	}
+	if flavor == collectionTag {
+		return nil, errors.New("webfont: WOFF2 font collections are not supported")
+	}
+	if numTables == 0 {
+		return nil, errors.New("webfont: WOFF2 font has no tables")
+	}
+
+	tables := make([]*woff2Table, numTables)
+	streamSize := 0
+	for i := range tables {
+		flags := r.u8()
+		var tag uint32
+		if index := flags & 0x3f; index == 0x3f {
+			tag = r.u32()
+		} else {
+			tag = binary.BigEndian.Uint32([]byte(woff2KnownTags[index]))
+		}
+
+		// Transform version 0 is the glyf/loca transform, but the null
+		// transform for every other table
+		version := flags >> 6
+		t := &woff2Table{tag: tag}
+		if tag == tagGlyf || tag == tagLoca {
+			t.transformed = version == 0
+		} else {
+			t.transformed = version != 0
+		}
+
+		t.length = r.base128()
+		if t.transformed {
+			t.length = r.base128()
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		streamSize += int(t.length)
+		tables[i] = t
+	}
+
+	compressed := r.bytes(compressedSize)
+	if r.err != nil {
+		return nil, r.err
+	}
+	stream, err := io.ReadAll(io.LimitReader(brotli.NewReader(bytes.NewReader(compressed)), int64(streamSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("webfont: WOFF2 decompression failed: %w", err)
+	}
+	if len(stream) != streamSize {
+		return nil, errors.New("webfont: WOFF2 decompressed size mismatch")
+	}
+
+	byTag := make(map[uint32]*woff2Table, numTables)
+	offset := 0
+	for _, t := range tables {
+		t.data = stream[offset : offset+int(t.length)]
+		offset += int(t.length)
+		byTag[t.tag] = t
+	}
+
+	if err := reconstructWOFF2Tables(byTag); err != nil {
+		return nil, err
+	}
+
+	sfnt := make([]sfntTable, 0, numTables)
+	for _, t := range tables {
+		sfnt = append(sfnt, sfntTable{tag: t.tag, data: t.data})
+	}
+	return writeSFNT(flavor, sfnt), nil
+}
+
+// reconstructWOFF2Tables undoes the glyf/loca and hmtx transforms
+func reconstructWOFF2Tables(byTag map[uint32]*woff2Table) error {
+	glyf, loca := byTag[tagGlyf], byTag[tagLoca]
+	if glyf != nil && glyf.transformed {
+		if loca == nil || !loca.transformed {
+			return errors.New("webfont: WOFF2 transformed glyf without transformed loca")
+		}
+	}
+
+	var xMins []int16
+	if glyf != nil && glyf.transformed {
+		glyfData, locaData, mins, indexFormat, err := reconstructGlyf(glyf.data)
+		if err != nil {
+			return err
+		}
+		glyf.data, loca.data, xMins = glyfData, locaData, mins
+		glyf.transformed, loca.transformed = false, false
+
+		// The head table must agree with the offset format of the new loca
+		if head := byTag[tagHead]; head != nil && len(head.data) >= 52 {
+			binary.BigEndian.PutUint16(head.data[50:], indexFormat)
+		}
+	}
+
+	for _, t := range byTag {
+		if !t.transformed {
+			continue
+		}
+		if t.tag != tagHmtx {
+			return fmt.Errorf("webfont: unsupported WOFF2 transform of table %s", tagString(t.tag))
+		}
+
+		hhea := byTag[tagHhea]
+		if xMins == nil || hhea == nil || len(hhea.data) < 36 {
+			return errors.New("webfont: WOFF2 transformed hmtx requires glyf and hhea")
+		}
+		numHMetrics := int(binary.BigEndian.Uint16(hhea.data[34:]))
+		hmtx, err := reconstructHmtx(t.data, numHMetrics, xMins)
+		if err != nil {
+			return err
+		}
+		t.data = hmtx
+		t.transformed = false
+	}
+
+	return nil
+}
+
+// reconstructGlyf rebuilds the glyf and loca tables from the transformed glyf
+// table, returning the xMin of every glyph for the hmtx transform
+func reconstructGlyf(data []byte) (glyf, loca []byte, xMins []int16, indexFormat uint16, err error) {
+	r := &reader{data: data}
+	r.skip(2) // reserved
+	optionFlags := r.u16()
+	numGlyphs := int(r.u16())
+	indexFormat = r.u16()
+
+	var sizes [7]int
+	for i := range sizes {
+		sizes[i] = int(r.u32())
+	}
+	if r.err != nil {
+		return nil, nil, nil, 0, r.err
+	}
+
+	var streams [7]*reader
+	for i, size := range sizes {
+		streams[i] = &reader{data: r.bytes(size)}
+	}
+	nContourStream, nPointsStream, flagStream, glyphStream := streams[0], streams[1], streams[2], streams[3]
+	compositeStream, bboxStream, instructionStream := streams[4], streams[5], streams[6]
+
+	var overlapBitmap []byte
+	if optionFlags&1 != 0 {
+		overlapBitmap = r.bytes((numGlyphs + 7) / 8)
+	}
+	bboxBitmap := bboxStream.bytes(((numGlyphs + 31) / 32) * 4)
+	if r.err != nil || bboxStream.err != nil {
+		return nil, nil, nil, 0, errTruncated
+	}
+
+	g := &glyfBuilder{
+		glyph:       glyphStream,
+		bbox:        bboxStream,
+		instruction: instructionStream,
+	}
+	offsets := make([]int, numGlyphs+1)
+	xMins = make([]int16, numGlyphs)
+
+	for i := 0; i < numGlyphs; i++ {
+		offsets[i] = len(g.out)
+		nContours := int(nContourStream.s16())
+		hasBBox := bitSet(bboxBitmap, i)
+
+		switch {
+		case nContours == 0:
+			if hasBBox {
+				return nil, nil, nil, 0, fmt.Errorf("webfont: empty glyph %d has a bounding box", i)
+			}
+		case nContours > 0:
+			xMins[i], err = g.simpleGlyph(nContours, hasBBox, bitSet(overlapBitmap, i), nPointsStream, flagStream)
+		case nContours == -1:
+			if !hasBBox {
+				return nil, nil, nil, 0, fmt.Errorf("webfont: composite glyph %d has no bounding box", i)
+			}
+			xMins[i], err = g.compositeGlyph(compositeStream)
+		default:
+			err = fmt.Errorf("webfont: invalid contour count %d in glyph %d", nContours, i)
+		}
+		if err != nil {
+			return nil, nil, nil, 0, err
+		}
+
+		for len(g.out)%4 != 0 {
+			g.out = append(g.out, 0)
+		}
+	}
+	offsets[numGlyphs] = len(g.out)
+
+	for _, s := range streams {
+		if s.err != nil {
+			return nil, nil, nil, 0, s.err
+		}
+	}
+
+	switch indexFormat {
+	case 0:
+		if len(g.out)/2 > 0xffff {
+			return nil, nil, nil, 0, errors.New("webfont: glyf table too large for short loca offsets")
+		}
+		loca = make([]byte, 2*len(offsets))
+		for i, offset := range offsets {
+			binary.BigEndian.PutUint16(loca[2*i:], uint16(offset/2))
+		}
+	case 1:
+		loca = make([]byte, 4*len(offsets))
+		for i, offset := range offsets {
+			binary.BigEndian.PutUint32(loca[4*i:], uint32(offset))
+		}
+	default:
+		return nil, nil, nil, 0, fmt.Errorf("webfont: invalid loca index format %d", indexFormat)
+	}
+
+	return g.out, loca, xMins, indexFormat, nil
+}
+
+// glyfBuilder writes glyph records from the streams of a transformed glyf table
+type glyfBuilder struct {
+	glyph       *reader
+	bbox        *reader
+	instruction *reader
+	out         []byte
+}
+
+// simpleGlyph decodes a glyph with contours and returns its xMin
+func (g *glyfBuilder) simpleGlyph(nContours int, hasBBox, overlap bool, nPoints, flags *reader) (int16, error) {
+	endPoints := make([]uint16, nContours)
+	total := 0
+	for c := range endPoints {
+		total += int(nPoints.u255())
+		if total == 0 || total > 0xffff {
+			return 0, errors.New("webfont: invalid point count in simple glyph")
+		}
+		endPoints[c] = uint16(total - 1)
+	}
+
+	onCurve := make([]bool, total)
+	xs := make([]int, total)
+	ys := make([]int, total)
+	x, y := 0, 0
+	for p := 0; p < total; p++ {
+		flag := flags.u8()
+		onCurve[p] = flag>>7 == 0
+		dx, dy := decodeTriplet(flag&0x7f, g.glyph)
+		x += dx
+		y += dy
+		xs[p], ys[p] = x, y
+	}
+
+	instructionLength := int(g.glyph.u255())
+	instructions := g.instruction.bytes(instructionLength)
+	if nPoints.err != nil || flags.err != nil || g.glyph.err != nil || g.instruction.err != nil {
+		return 0, errTruncated
+	}
+
+	var bbox [4]int16
+	if hasBBox {
+		for i := range bbox {
+			bbox[i] = g.bbox.s16()
+		}
+	} else {
+		bbox = [4]int16{int16(xs[0]), int16(ys[0]), int16(xs[0]), int16(ys[0])}
+		for p := range xs {
+			bbox[0] = min(bbox[0], int16(xs[p]))
+			bbox[1] = min(bbox[1], int16(ys[p]))
+			bbox[2] = max(bbox[2], int16(xs[p]))
+			bbox[3] = max(bbox[3], int16(ys[p]))
+		}
+	}
+
+	g.out = binary.BigEndian.AppendUint16(g.out, uint16(nContours))
+	for _, v := range bbox {
+		g.out = binary.BigEndian.AppendUint16(g.out, uint16(v))
+	}
+	for _, end := range endPoints {
+		g.out = binary.BigEndian.AppendUint16(g.out, end)
+	}
+	g.out = binary.BigEndian.AppendUint16(g.out, uint16(instructionLength))
+	g.out = append(g.out, instructions...)
+
+	// Coordinates are written as 16-bit deltas, so flags only carry on-curve
+	// and overlap bits
+	for p := range onCurve {
+		var flag byte
+		if onCurve[p] {
+			flag |= glyphOnCurve
+		}
+		if p == 0 && overlap {
+			flag |= glyphOverlapSimple
+		}
+		g.out = append(g.out, flag)
+	}
+	prevX, prevY := 0, 0
+	for p := range xs {
+		g.out = binary.BigEndian.AppendUint16(g.out, uint16(int16(xs[p]-prevX)))
+		prevX = xs[p]
+	}
+	for p := range ys {
+		g.out = binary.BigEndian.AppendUint16(g.out, uint16(int16(ys[p]-prevY)))
+		prevY = ys[p]
+	}
+
+	return bbox[0], nil
+}
+
+// compositeGlyph copies a composite glyph and returns its xMin
+func (g *glyfBuilder) compositeGlyph(composite *reader) (int16, error) {
+	start := composite.pos
+	haveInstructions := false
+	for {
+		flags := composite.u16()
+		composite.skip(2) // glyphIndex
+		if flags&compositeArgsAreWords != 0 {
+			composite.skip(4)
+		} else {
+			composite.skip(2)
+		}
+		switch {
+		case flags&compositeHaveScale != 0:
+			composite.skip(2)
+		case flags&compositeHaveXYScale != 0:
+			composite.skip(4)
+		case flags&compositeHaveTwoByTwo != 0:
+			composite.skip(8)
+		}
+		if flags&compositeHaveInstructions != 0 {
+			haveInstructions = true
+		}
+		if flags&compositeMoreComponents == 0 || composite.err != nil {
+			break
+		}
+	}
+	if composite.err != nil {
+		return 0, composite.err
+	}
+	components := composite.data[start:composite.pos]
+
+	var bbox [4]int16
+	for i := range bbox {
+		bbox[i] = g.bbox.s16()
+	}
+	if g.bbox.err != nil {
+		return 0, g.bbox.err
+	}
+
+	g.out = binary.BigEndian.AppendUint16(g.out, 0xffff)
+	for _, v := range bbox {
+		g.out = binary.BigEndian.AppendUint16(g.out, uint16(v))
+	}
+	g.out = append(g.out, components...)
+
+	if haveInstructions {
+		instructionLength := int(g.glyph.u255())
+		instructions := g.instruction.bytes(instructionLength)
+		if g.glyph.err != nil || g.instruction.err != nil {
+			return 0, errTruncated
+		}
+		g.out = binary.BigEndian.AppendUint16(g.out, uint16(instructionLength))
+		g.out = append(g.out, instructions...)
+	}
+
+	return bbox[0], nil
+}
+
+// decodeTriplet decodes a point delta of the WOFF2 triplet encoding
+func decodeTriplet(flag byte, r *reader) (dx, dy int) {
+	switch {
+	case flag < 10:
+		dy = withSign(flag, int(flag&14)<<7+int(r.u8()))
+	case flag < 20:
+		dx = withSign(flag, int((flag-10)&14)<<7+int(r.u8()))
+	case flag < 84:
+		b0 := int(flag - 20)
+		b1 := int(r.u8())
+		dx = withSign(flag, 1+(b0&0x30)+(b1>>4))
+		dy = withSign(flag>>1, 1+((b0&0x0c)<<2)+(b1&0x0f))
+	case flag < 120:
+		b0 := int(flag - 84)
+		b1 := int(r.u8())
+		b2 := int(r.u8())
+		dx = withSign(flag, 1+((b0/12)<<8)+b1)
+		dy = withSign(flag>>1, 1+(((b0%12)>>2)<<8)+b2)
+	case flag < 124:
+		b1 := int(r.u8())
+		b2 := int(r.u8())
+		b3 := int(r.u8())
+		dx = withSign(flag, (b1<<4)+(b2>>4))
+		dy = withSign(flag>>1, ((b2&0x0f)<<8)+b3)
+	default:
+		b1 := int(r.u8())
+		b2 := int(r.u8())
+		b3 := int(r.u8())
+		b4 := int(r.u8())
+		dx = withSign(flag, (b1<<8)+b2)
+		dy = withSign(flag>>1, (b3<<8)+b4)
+	}
+	return dx, dy
+}
+
+// withSign applies the sign bit of a triplet flag to a value
+func withSign(flag byte, value int) int {
+	if flag&1 != 0 {
+		return value
+	}
+	return -value
+}
+
+// reconstructHmtx rebuilds the hmtx table, taking omitted left side bearings
+// from the xMin of the glyphs
+func reconstructHmtx(data []byte, numHMetrics int, xMins []int16) ([]byte, error) {
+	numGlyphs := len(xMins)
+	if numHMetrics < 1 || numHMetrics > numGlyphs {
+		return nil, errors.New("webfont: invalid numberOfHMetrics")
+	}
+
+	r := &reader{data: data}
+	flags := r.u8()
+	if flags&0xfc != 0 || flags&0x03 == 0 {
+		return nil, errors.New("webfont: invalid WOFF2 hmtx transform flags")
+	}
+
+	advances := make([]uint16, numHMetrics)
+	for i := range advances {
+		advances[i] = r.u16()
+	}
+	bearings := make([]int16, numGlyphs)
+	for i := range bearings {
+		omitted := flags&0x01 != 0
+		if i >= numHMetrics {
+			omitted = flags&0x02 != 0
+		}
+		if omitted {
+			bearings[i] = xMins[i]
+		} else {
+			bearings[i] = r.s16()
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	out := make([]byte, 0, 4*numHMetrics+2*(numGlyphs-numHMetrics))
+	for i, advance := range advances {
+		out = binary.BigEndian.AppendUint16(out, advance)
+		out = binary.BigEndian.AppendUint16(out, uint16(bearings[i]))
+	}
+	for _, bearing := range bearings[numHMetrics:] {
+		out = binary.BigEndian.AppendUint16(out, uint16(bearing))
+	}
+	return out, nil
+}
+
+// bitSet reports whether bit i of a big-endian bitmap is set
+func bitSet(bitmap []byte, i int) bool {
+	if i>>3 >= len(bitmap) {
+		return false
+	}
+	return bitmap[i>>3]&(0x80>>(i&7)) != 0
+}